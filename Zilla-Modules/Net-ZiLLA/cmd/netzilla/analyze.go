@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"net-zilla/internal/models"
+	"net-zilla/internal/storage"
+	"net-zilla/internal/visualization"
+)
+
+// outputFlag registers --output and its short form -o on fs.
+func outputFlag(fs *flag.FlagSet, def string, supported ...string) *string {
+	format := new(string)
+	usage := "output format: " + strings.Join(supported, ", ")
+	fs.StringVar(format, "output", def, usage)
+	fs.StringVar(format, "o", def, "shorthand for -output")
+	return format
+}
+
+// signalContext is cancelled by Ctrl-C or SIGTERM so analyses stop cleanly.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// readTargets reads one target per line, skipping blank lines and # comments.
+func readTargets(r io.Reader) ([]string, error) {
+	var targets []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets, scanner.Err()
+}
+
+// locatedTarget matches a URL prefixed with the place it was found, as in
+// "docs/links.md:12:https://example.com" or, with a column,
+// "docs/links.md:12:5:https://example.com".
+var locatedTarget = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)?(.+)$`)
+
+// splitLocations separates the targets read by readTargets from the files and
+// lines they were found at. The locations are nil when no line had one.
+func splitLocations(lines []string) ([]string, []visualization.SARIFLocation) {
+	targets := make([]string, len(lines))
+	locations := make([]visualization.SARIFLocation, len(lines))
+	found := false
+	for i, line := range lines {
+		targets[i] = line
+		m := locatedTarget.FindStringSubmatch(line)
+		// A URL with a port also has digits between colons; only the path
+		// may come before the scheme
+		if m == nil || strings.Contains(m[1], "://") || !strings.Contains(m[4], "://") {
+			continue
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		targets[i] = strings.TrimSpace(m[4])
+		locations[i] = visualization.SARIFLocation{Path: m[1], Line: lineNo, Column: col}
+		found = true
+	}
+	if !found {
+		return targets, nil
+	}
+	return targets, locations
+}
+
+// failedReport stands in for a target whose analysis returned an error, so
+// batch output still has one entry per target.
+func failedReport(target string, err error) *models.AdvancedReport {
+	return &models.AdvancedReport{Target: target, Findings: []string{fmt.Sprintf("Analysis failed: %v", err)}}
+}
+
+// runAnalyze implements "netzilla analyze": it analyzes the targets given as
+// arguments, or listed on stdin with "-", one after another.
+func runAnalyze(args []string) int {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, outputTable, outputJSON, outputCSV, outputSARIF, outputSTIX)
+	verbose := fs.Bool("v", false, "log progress to stderr")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla analyze [flags] <url>... | -")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := checkOutput(*output, outputTable, outputJSON, outputCSV, outputSARIF, outputSTIX); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	targets := fs.Args()
+	if len(targets) == 1 && targets[0] == "-" {
+		var err error
+		if targets, err = readTargets(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitError
+		}
+	}
+	if len(targets) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	a, err := newApp(*verbose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	defer a.close()
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	var reports []*models.AdvancedReport
+	var codes []int
+	for _, target := range targets {
+		report, err := a.service.PerformAnalysis(ctx, target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", target, err)
+			report = failedReport(target, err)
+		}
+		reports = append(reports, report)
+		codes = append(codes, verdictExitCode(report))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err := writeReports(os.Stdout, *output, reports, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return worstExitCode(codes...)
+}
+
+// runBatch implements "netzilla batch": it analyzes a list of targets read from
+// a file or stdin, several at a time, and reports them in input order.
+func runBatch(args []string) int {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, outputTable, outputJSON, outputCSV, outputSARIF, outputSTIX)
+	concurrency := fs.Int("concurrency", 4, "targets analyzed at once (the service runs at most 5)")
+	verbose := fs.Bool("v", false, "log progress to stderr")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla batch [flags] [file|-]\n\nReads one URL per line; # starts a comment. Without a file, reads stdin.\n"+
+			"Lines of the form path:line:url or path:line:column:url, as printed by grep -no or rg --vimgrep -o,\n"+
+			"are reported at that place in SARIF output.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := checkOutput(*output, outputTable, outputJSON, outputCSV, outputSARIF, outputSTIX); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	if fs.NArg() > 1 || *concurrency < 1 || *concurrency > 5 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	in := io.Reader(os.Stdin)
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		in = f
+	}
+	lines, err := readTargets(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	targets, locations := splitLocations(lines)
+	if len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ no targets to analyze")
+		return exitUsage
+	}
+
+	a, err := newApp(*verbose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	defer a.close()
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	reports := make([]*models.AdvancedReport, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				report, err := a.service.PerformAnalysis(ctx, targets[i])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "❌ %s: %v\n", targets[i], err)
+					report = failedReport(targets[i], err)
+				}
+				reports[i] = report
+			}
+		}()
+	}
+	for i := range targets {
+		if ctx.Err() != nil {
+			reports[i] = failedReport(targets[i], ctx.Err())
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	codes := make([]int, len(reports))
+	for i, r := range reports {
+		codes[i] = verdictExitCode(r)
+	}
+	if err := writeReports(os.Stdout, *output, reports, locations); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return worstExitCode(codes...)
+}
+
+// runHistory implements "netzilla history": it lists recent analyses.
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, outputTable, outputJSON, outputCSV)
+	limit := fs.Int("limit", 20, "number of analyses to list, newest first")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := checkOutput(*output, outputTable, outputJSON, outputCSV); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	a, err := newApp(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	defer a.close()
+	if err := a.requireDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	history, err := a.service.GetAnalysisHistory(context.Background(), *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	if err := writeHistory(os.Stdout, *output, history); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// runShow implements "netzilla show": it prints a stored report by ID.
+func runShow(args []string) int {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	output := outputFlag(fs, outputJSON, outputTable, outputJSON, outputCSV, outputSARIF, outputSTIX)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla show [flags] <report-id>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := checkOutput(*output, outputTable, outputJSON, outputCSV, outputSARIF, outputSTIX); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	a, err := newApp(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	defer a.close()
+	if err := a.requireDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	report, err := a.service.GetReport(context.Background(), fs.Arg(0))
+	if errors.Is(err, storage.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "❌ no report with ID %s\n", fs.Arg(0))
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	if err := writeReports(os.Stdout, *output, []*models.AdvancedReport{report}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"net-zilla/internal/config"
+	"net-zilla/internal/services"
+	"net-zilla/internal/storage"
+	"net-zilla/pkg/logger"
+)
+
+// app is what the scripted commands share: configuration, the store and the
+// analysis service. Logs go to stderr so stdout carries only command output.
+type app struct {
+	cfg     *config.Config
+	logger  *logger.Logger
+	db      storage.Store
+	service *services.AnalysisService
+}
+
+// newApp loads the configuration and opens storage. Storage failures are
+// fatal only for commands that need it, so they are reported by requireDB.
+func newApp(verbose bool) (*app, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	l := logger.NewLogger()
+	l.SetOutput(os.Stderr)
+	if !verbose {
+		l.SetLevel(logger.WARN)
+	}
+
+	a := &app{cfg: cfg, logger: l}
+	if store, err := storage.Open(cfg.Storage.Driver, cfg.Storage.DSN); err != nil {
+		l.Warn("Failed to initialize database: %v", err)
+	} else {
+		a.db = store
+	}
+	a.service = services.NewAnalysisService(l, a.db, cfg)
+	return a, nil
+}
+
+func (a *app) requireDB() error {
+	if a.db == nil {
+		return fmt.Errorf("database unavailable (storage %s %q)", a.cfg.Storage.Driver, a.cfg.Storage.DSN)
+	}
+	return nil
+}
+
+func (a *app) close() {
+	a.service.Close()
+	if a.db != nil {
+		a.db.Close()
+	}
+}
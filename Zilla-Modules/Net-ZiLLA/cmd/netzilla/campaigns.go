@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"net-zilla/internal/correlation"
+	"net-zilla/internal/storage"
+)
+
+const campaignsUsage = `Usage: netzilla campaigns <command> [flags]
+
+Commands:
+  list  List campaigns of related analyses, most recently active first
+  show  Print the members, evidence and timeline of a campaign
+
+Analyses join a campaign when they share a certificate, IPs or name servers,
+URL path structure, page content or registration details.
+`
+
+// runCampaigns implements the "netzilla campaigns" subcommands.
+func runCampaigns(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, campaignsUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "list":
+		return runCampaignsList(args[1:])
+	case "show":
+		return runCampaignsShow(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown campaigns command %q\n\n%s", args[0], campaignsUsage)
+		return exitUsage
+	}
+}
+
+func runCampaignsList(args []string) int {
+	fs := flag.NewFlagSet("campaigns list", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, outputTable, outputJSON)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla campaigns list [flags]")
+		fs.PrintDefaults()
+	}
+	a, code := graphCommand(fs, args, output, []string{outputTable, outputJSON}, 0)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	campaigns, err := a.service.Campaigns(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	if *output == outputJSON {
+		if campaigns == nil {
+			campaigns = []correlation.Campaign{}
+		}
+		err = writeJSON(os.Stdout, campaigns)
+	} else {
+		rows := make([][]string, len(campaigns))
+		for i, c := range campaigns {
+			rows[i] = []string{c.ID, c.RiskLevel, strconv.Itoa(len(c.Members)), strconv.Itoa(c.Targets),
+				formatSeen(c.FirstSeen), formatSeen(c.LastSeen), campaignSummary(c.Evidence)}
+		}
+		err = writeTable(os.Stdout, []string{"CAMPAIGN", "RISK", "ANALYSES", "TARGETS", "FIRST SEEN", "LAST SEEN", "EVIDENCE"}, rows)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func runCampaignsShow(args []string) int {
+	fs := flag.NewFlagSet("campaigns show", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, outputTable, outputJSON)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla campaigns show [flags] <campaign-id>")
+		fs.PrintDefaults()
+	}
+	a, code := graphCommand(fs, args, output, []string{outputTable, outputJSON}, 1)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	campaign, err := a.service.GetCampaign(context.Background(), fs.Arg(0))
+	if errors.Is(err, storage.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "❌ no campaign with ID %s\n", fs.Arg(0))
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	if *output == outputJSON {
+		err = writeJSON(os.Stdout, campaign)
+	} else {
+		err = writeCampaign(os.Stdout, campaign)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// writeCampaign prints a campaign's evidence, members and timeline.
+func writeCampaign(w io.Writer, c *correlation.Campaign) error {
+	fmt.Fprintf(w, "Campaign %s  %s  %s → %s\n\nEvidence:\n", c.ID, c.RiskLevel, formatSeen(c.FirstSeen), formatSeen(c.LastSeen))
+	for _, e := range c.Evidence {
+		fmt.Fprintf(w, "  - %s\n", e)
+	}
+	fmt.Fprintln(w)
+
+	rows := make([][]string, len(c.Members))
+	for i, m := range c.Members {
+		rows[i] = []string{m.AnalysisID, m.RiskLevel, formatSeen(m.AnalyzedAt), m.Target}
+	}
+	if err := writeTable(w, []string{"ANALYSIS", "RISK", "ANALYZED", "TARGET"}, rows); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+
+	rows = make([][]string, len(c.Timeline))
+	for i, d := range c.Timeline {
+		rows[i] = []string{d.Date, strconv.Itoa(d.Analyses), strings.Join(d.Targets, ", ")}
+	}
+	return writeTable(w, []string{"DATE", "ANALYSES", "TARGETS"}, rows)
+}
+
+// campaignSummary shortens the evidence list of a campaign for a table cell.
+func campaignSummary(evidence []string) string {
+	if len(evidence) > 2 {
+		evidence = append(evidence[:2:2], fmt.Sprintf("+%d more", len(evidence)-2))
+	}
+	return strings.Join(evidence, "; ")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"net-zilla/internal/ai"
+	"net-zilla/internal/eval"
+	"net-zilla/pkg/logger"
+)
+
+// runEval implements "netzilla eval": it scores the labeled corpus offline, prints
+// per-component metrics and either checks them against the baseline or rewrites it.
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	corpusPath := fs.String("corpus", "data/eval/corpus.jsonl", "labeled corpus with recorded fixtures (JSONL)")
+	baselinePath := fs.String("baseline", "data/eval/baseline.json", "baseline to compare against; empty to skip")
+	write := fs.Bool("write-baseline", false, "write this run's metrics to -baseline instead of comparing")
+	modelPath := fs.String("model", "", "score go_agent with a trained URL model instead of the heuristics")
+	tolerance := fs.Float64("tolerance", 0.01, "allowed drop in a metric before it counts as a regression")
+	verbose := fs.Bool("v", false, "list the cases each component got wrong")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "❌ unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	if *write && *baselinePath == "" {
+		fmt.Fprintln(os.Stderr, "❌ -write-baseline needs a -baseline path")
+		return 2
+	}
+
+	cases, err := eval.LoadCorpusFile(*corpusPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	evaluator := eval.NewEvaluator(logger.NewLogger())
+	if *modelPath != "" {
+		model, err := ai.LoadURLModel(*modelPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		evaluator.SetModel(model)
+	}
+
+	report, err := evaluator.Run(context.Background(), cases)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Evaluation failed: %v\n", err)
+		return 1
+	}
+	report.Corpus = *corpusPath
+	printEvalReport(report, *verbose)
+
+	if *baselinePath == "" {
+		return 0
+	}
+	if *write {
+		if err := report.Save(*baselinePath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		fmt.Printf("✅ Baseline written to %s\n", *baselinePath)
+		return 0
+	}
+
+	if _, statErr := os.Stat(*baselinePath); os.IsNotExist(statErr) {
+		fmt.Printf("No baseline at %s; run with -write-baseline to create one\n", *baselinePath)
+		return 0
+	}
+	baseline, err := eval.LoadBaseline(*baselinePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	regressions, err := eval.Compare(baseline, report, *tolerance)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if len(regressions) > 0 {
+		fmt.Fprintf(os.Stderr, "❌ %d regression(s) against %s:\n", len(regressions), *baselinePath)
+		for _, r := range regressions {
+			fmt.Fprintf(os.Stderr, "  %s\n", r)
+		}
+		return 1
+	}
+	fmt.Printf("✅ No regressions against %s\n", *baselinePath)
+	return 0
+}
+
+func printEvalReport(r *eval.Report, verbose bool) {
+	fmt.Printf("Corpus: %s (%d cases: %d benign, %d phishing, %d malware), go_agent: %s\n\n",
+		r.Corpus, r.Cases, r.Labels[eval.LabelBenign], r.Labels[eval.LabelPhishing], r.Labels[eval.LabelMalware], r.GoAgentMode)
+
+	fmt.Printf("%-17s %9s %7s %7s %7s %7s %5s %5s %5s %5s\n", "COMPONENT", "PRECISION", "RECALL", "F1", "ROC-AUC", "FPR", "TP", "FP", "TN", "FN")
+	for _, name := range eval.Components {
+		c := r.Components[name]
+		fmt.Printf("%-17s %9.4f %7.4f %7.4f %7.4f %7.4f %5d %5d %5d %5d\n",
+			name, c.Precision, c.Recall, c.F1, c.AUC, c.FPR, c.Confusion.TP, c.Confusion.FP, c.Confusion.TN, c.Confusion.FN)
+	}
+
+	fmt.Println("\nVerdicts by label (flagged malicious / total):")
+	fmt.Printf("%-17s %10s %10s %10s\n", "COMPONENT", eval.LabelBenign, eval.LabelPhishing, eval.LabelMalware)
+	for _, name := range eval.Components {
+		fmt.Printf("%-17s", name)
+		for _, label := range eval.Labels {
+			counts := r.Components[name].Confusion.ByLabel[label]
+			fmt.Printf(" %10s", fmt.Sprintf("%d/%d", counts["malicious"], counts["malicious"]+counts[eval.LabelBenign]))
+		}
+		fmt.Println()
+	}
+
+	if !verbose {
+		return
+	}
+	fmt.Println("\nMisclassified:")
+	for _, name := range eval.Components {
+		for _, res := range r.Results {
+			p := res.Predictions[name]
+			if p.Malicious != (res.Label != eval.LabelBenign) {
+				fmt.Printf("  %-17s %-8s score=%.2f %s\n", name, res.Label, p.Score, res.URL)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"net-zilla/internal/fileanalysis"
+	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
+)
+
+// runFile implements "netzilla file": it statically analyzes a file or attachment
+// on disk and prints the members, macros, URLs and verdict. Nothing in the file
+// is executed.
+func runFile(args []string) int {
+	fs := flag.NewFlagSet("file", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the full analysis as JSON")
+	yaraPath := fs.String("yara", "", ".yar file or directory of rules to run in addition to the built-in ones")
+	showCode := fs.Bool("macros", false, "print the source of extracted VBA macros")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla file [flags] <path>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	data, err := io.ReadAll(io.LimitReader(f, fileanalysis.MaxFileSize+1))
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	l := logger.NewLogger()
+	l.SetLevel(logger.WARN)
+	analyzer := fileanalysis.NewAnalyzer(l)
+	if *yaraPath != "" {
+		if err := analyzer.LoadYaraRules(*yaraPath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+	}
+
+	result, err := analyzer.Analyze(context.Background(), filepath.Base(path), data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	printFileAnalysis(result, *showCode)
+	return 0
+}
+
+func printFileAnalysis(r *models.FileAnalysis, showCode bool) {
+	fmt.Printf("File:   %s (%s, %d bytes)\n", r.FileName, r.Type, r.Size)
+	fmt.Printf("SHA256: %s\n", r.Hashes["SHA256"])
+	fmt.Printf("Risk:   %s (%d/100)\n\n", r.RiskLevel, r.RiskScore)
+
+	fmt.Printf("%-7s %10s %5s  %s\n", "TYPE", "SIZE", "RISK", "MEMBER")
+	for _, m := range r.Members {
+		risk := 0
+		if m.Behavior != nil {
+			risk = m.Behavior.RiskScore
+		}
+		fmt.Printf("%-7s %10d %5d  %s%s\n", m.Type, m.Size, risk, strings.Repeat("  ", m.Depth), m.Path)
+		for _, match := range m.YaraMatches {
+			fmt.Printf("%25s  %s  YARA %s %s\n", "", strings.Repeat("  ", m.Depth), match.Rule, strings.Join(match.Strings, ","))
+		}
+	}
+
+	if len(r.Macros) > 0 {
+		fmt.Println("\nVBA macros:")
+		for _, m := range r.Macros {
+			fmt.Printf("  %s in %s\n", m.Module, m.Member)
+			if len(m.AutoExec) > 0 {
+				fmt.Printf("    runs on: %s\n", strings.Join(m.AutoExec, ", "))
+			}
+			if len(m.Suspicious) > 0 {
+				fmt.Printf("    calls:   %s\n", strings.Join(m.Suspicious, ", "))
+			}
+			if showCode {
+				fmt.Printf("    ---\n%s\n    ---\n", m.Code)
+			}
+		}
+	}
+	if len(r.URLs) > 0 {
+		fmt.Println("\nURLs:")
+		for _, u := range r.URLs {
+			fmt.Printf("  %s\n", u)
+		}
+	}
+	if len(r.Findings) > 0 {
+		fmt.Println("\nFindings:")
+		for _, f := range r.Findings {
+			fmt.Printf("  ⚠️  %s\n", f)
+		}
+	}
+	if len(r.Warnings) > 0 {
+		fmt.Println("\nNot fully analyzed:")
+		for _, w := range r.Warnings {
+			fmt.Printf("  %s\n", w)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"net-zilla/internal/correlation"
+	"net-zilla/internal/visualization"
+)
+
+const graphUsage = `Usage: netzilla graph <command> [flags]
+
+Commands:
+  neighbors  Show the infrastructure around a URL, domain, IP, name server or certificate
+  path       Show the shortest chain of infrastructure linking two nodes
+  clusters   List groups of infrastructure shared by several analyses
+  export     Write the whole graph as JSON, GraphML, Cytoscape JSON or DOT
+
+Nodes are given by value ("evil.example") or by ID ("DOMAIN:evil.example").
+`
+
+// Graph output formats: a node table plus every visualization.GraphFormats.
+var graphOutputs = append([]string{outputTable}, visualization.GraphFormats...)
+
+// runGraph implements the "netzilla graph" subcommands.
+func runGraph(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, graphUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "neighbors":
+		return runGraphNeighbors(args[1:])
+	case "path":
+		return runGraphPath(args[1:])
+	case "clusters":
+		return runGraphClusters(args[1:])
+	case "export":
+		return runGraphExport(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown graph command %q\n\n%s", args[0], graphUsage)
+		return exitUsage
+	}
+}
+
+// graphCommand parses the flags of a graph subcommand taking nargs
+// positional arguments and opens the app. It returns nil and the exit code
+// when the command cannot run.
+func graphCommand(fs *flag.FlagSet, args []string, output *string, supported []string, nargs int) (*app, int) {
+	if err := fs.Parse(args); err != nil {
+		return nil, exitUsage
+	}
+	if err := checkOutput(*output, supported...); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return nil, exitUsage
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return nil, exitUsage
+	}
+
+	a, err := newApp(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return nil, exitError
+	}
+	if err := a.requireDB(); err != nil {
+		a.close()
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return nil, exitError
+	}
+	return a, exitOK
+}
+
+func runGraphNeighbors(args []string) int {
+	fs := flag.NewFlagSet("graph neighbors", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, graphOutputs...)
+	depth := fs.Int("depth", 1, "hops to follow from the node")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla graph neighbors [flags] <node>")
+		fs.PrintDefaults()
+	}
+	a, code := graphCommand(fs, args, output, graphOutputs, 1)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	g, err := a.service.GraphNeighbors(context.Background(), fs.Arg(0), *depth)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return writeGraphOutput(os.Stdout, *output, g)
+}
+
+func runGraphPath(args []string) int {
+	fs := flag.NewFlagSet("graph path", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, graphOutputs...)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla graph path [flags] <from> <to>")
+		fs.PrintDefaults()
+	}
+	a, code := graphCommand(fs, args, output, graphOutputs, 2)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	g, err := a.service.GraphPath(context.Background(), fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	if *output == outputTable {
+		if err := writePath(os.Stdout, g); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	return writeGraphOutput(os.Stdout, *output, g)
+}
+
+func runGraphClusters(args []string) int {
+	fs := flag.NewFlagSet("graph clusters", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, outputTable, outputJSON)
+	minAnalyses := fs.Int("min-analyses", 2, "only list clusters seen by at least this many analyses")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla graph clusters [flags]\n\nRegistrars and ASNs are ignored when grouping.")
+		fs.PrintDefaults()
+	}
+	a, code := graphCommand(fs, args, output, []string{outputTable, outputJSON}, 0)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	clusters, err := a.service.GraphClusters(context.Background(), *minAnalyses)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	if *output == outputJSON {
+		if clusters == nil {
+			clusters = []correlation.Cluster{}
+		}
+		err = writeJSON(os.Stdout, clusters)
+	} else {
+		rows := make([][]string, len(clusters))
+		for i, c := range clusters {
+			rows[i] = []string{c.ID, strconv.Itoa(len(c.Analyses)), strconv.Itoa(len(c.Graph.Nodes)),
+				formatSeen(c.FirstSeen), formatSeen(c.LastSeen), clusterSummary(c.Graph)}
+		}
+		err = writeTable(os.Stdout, []string{"CLUSTER", "ANALYSES", "NODES", "FIRST SEEN", "LAST SEEN", "INFRASTRUCTURE"}, rows)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func runGraphExport(args []string) int {
+	fs := flag.NewFlagSet("graph export", flag.ContinueOnError)
+	output := outputFlag(fs, visualization.GraphFormatGraphML, visualization.GraphFormats...)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla graph export [flags] > graph.graphml")
+		fs.PrintDefaults()
+	}
+	a, code := graphCommand(fs, args, output, visualization.GraphFormats, 0)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	g, err := a.service.InfrastructureGraph(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return writeGraphOutput(os.Stdout, *output, g)
+}
+
+// writeGraphOutput writes g as a node table or in a visualization.GraphFormats
+// format.
+func writeGraphOutput(w io.Writer, format string, g *correlation.RelationshipGraph) int {
+	var err error
+	if format == outputTable {
+		rows := make([][]string, len(g.Nodes))
+		for i, n := range g.Nodes {
+			rows[i] = []string{n.Type, n.Value, strconv.Itoa(len(n.Analyses)), formatSeen(n.FirstSeen), formatSeen(n.LastSeen)}
+		}
+		err = writeTable(w, []string{"TYPE", "VALUE", "ANALYSES", "FIRST SEEN", "LAST SEEN"}, rows)
+	} else {
+		var data []byte
+		if data, err = visualization.NewGraphRenderer().RenderGraph(g, format); err == nil {
+			_, err = w.Write(data)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// writePath prints a path one node per line with the relationship leading to
+// the next, e.g. "DOMAIN a.example  --RESOLVES_TO-->".
+func writePath(w io.Writer, path *correlation.RelationshipGraph) error {
+	for i, n := range path.Nodes {
+		line := fmt.Sprintf("%-12s %s", n.Type, n.Value)
+		if i < len(path.Edges) {
+			e := path.Edges[i]
+			if e.From == n.ID {
+				line += "  --" + e.Rel + "-->"
+			} else {
+				line += "  <--" + e.Rel + "--"
+			}
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clusterSummary lists the shared infrastructure of a cluster: the nodes
+// other than URLs seen by more than one analysis.
+func clusterSummary(g *correlation.RelationshipGraph) string {
+	var shared []string
+	for _, n := range g.Nodes {
+		if n.Type != correlation.NodeURL && len(n.Analyses) > 1 {
+			shared = append(shared, n.Value)
+		}
+	}
+	if len(shared) > 3 {
+		shared = append(shared[:3], fmt.Sprintf("+%d more", len(shared)-3))
+	}
+	return strings.Join(shared, ", ")
+}
+
+func formatSeen(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04")
+}
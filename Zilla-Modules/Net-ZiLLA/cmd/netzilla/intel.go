@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+const intelUsage = `Usage: netzilla intel <command> [flags]
+
+Commands:
+  lookup  Look indicators (URLs, domains, IPs, hashes) up in the threat intelligence store
+`
+
+// runIntel implements the "netzilla intel" subcommands.
+func runIntel(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, intelUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "lookup":
+		return runIntelLookup(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown intel command %q\n\n%s", args[0], intelUsage)
+		return exitUsage
+	}
+}
+
+// intelMatch is one looked-up value; Indicator is nil when nothing is stored.
+type intelMatch struct {
+	Value     string            `json:"value"`
+	Found     bool              `json:"found"`
+	Indicator *models.Indicator `json:"indicator,omitempty"`
+}
+
+func runIntelLookup(args []string) int {
+	fs := flag.NewFlagSet("intel lookup", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, outputTable, outputJSON, outputCSV)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla intel lookup [flags] <value>... | -\n\nExits 3 when any value is a known indicator.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := checkOutput(*output, outputTable, outputJSON, outputCSV); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	values := fs.Args()
+	if len(values) == 1 && values[0] == "-" {
+		var err error
+		if values, err = readTargets(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitError
+		}
+	}
+	if len(values) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	a, err := newApp(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	defer a.close()
+	if err := a.requireDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	found, err := a.db.GetIndicators(context.Background(), values)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	matches := make([]intelMatch, len(values))
+	code := exitOK
+	rows := make([][]string, len(values))
+	for i, v := range values {
+		ind := found[v]
+		matches[i] = intelMatch{Value: v, Found: ind != nil, Indicator: ind}
+		rows[i] = []string{v, "no", "", "", "", ""}
+		if ind != nil {
+			code = exitMedium
+			rows[i] = []string{v, "yes", string(ind.Type), ind.Severity, fmt.Sprintf("%.2f", ind.Confidence), ind.Source}
+		}
+	}
+
+	columns := []string{"VALUE", "KNOWN", "TYPE", "SEVERITY", "CONFIDENCE", "SOURCE"}
+	switch *output {
+	case outputJSON:
+		err = writeJSON(os.Stdout, matches)
+	case outputCSV:
+		err = writeCSV(os.Stdout, columns, rows)
+	default:
+		err = writeTable(os.Stdout, columns, rows)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return code
+}
+
+const dbUsage = `Usage: netzilla db <command> [flags]
+
+Commands:
+  stats   Show the storage backend, schema version and indicator counts
+`
+
+// runDB implements the "netzilla db" subcommands.
+func runDB(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, dbUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "stats":
+		return runDBStats(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown db command %q\n\n%s", args[0], dbUsage)
+		return exitUsage
+	}
+}
+
+// dbStats is the output of "netzilla db stats".
+type dbStats struct {
+	Driver        string `json:"driver"`
+	SchemaVersion int    `json:"schema_version"`
+	*models.ThreatDBStats
+}
+
+func runDBStats(args []string) int {
+	fs := flag.NewFlagSet("db stats", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, outputTable, outputJSON)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := checkOutput(*output, outputTable, outputJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+
+	a, err := newApp(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	defer a.close()
+	if err := a.requireDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	ctx := context.Background()
+	stats := dbStats{Driver: a.cfg.Storage.Driver}
+	if stats.Driver == "" {
+		stats.Driver = "sqlite"
+	}
+	if stats.SchemaVersion, err = a.db.SchemaVersion(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	if stats.ThreatDBStats, err = a.db.IndicatorStats(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	if *output == outputJSON {
+		if err := writeJSON(os.Stdout, stats); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	fmt.Printf("Driver:          %s\n", stats.Driver)
+	fmt.Printf("Schema version:  %d\n", stats.SchemaVersion)
+	fmt.Printf("Indicators:      %d (%d seen in the last 7 days)\n", stats.TotalIndicators, stats.RecentActivity7d)
+	printCounts("By type:", stats.CountByType)
+	printCounts("By severity:", stats.CountBySeverity)
+	return exitOK
+}
+
+func printCounts(title string, counts map[string]int64) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Println(title)
+	for _, k := range keys {
+		fmt.Printf("  %-14s %d\n", strings.ToLower(k), counts[k])
+	}
+}
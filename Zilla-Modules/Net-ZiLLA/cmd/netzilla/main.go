@@ -1,66 +1,203 @@
 package main
 
 import (
-	"context"
+	"flag"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
+
+	"github.com/mattn/go-isatty"
 
 	"net-zilla/internal/api"
 	"net-zilla/internal/config"
 	"net-zilla/internal/services"
 	"net-zilla/internal/storage"
+	"net-zilla/internal/tui"
 	"net-zilla/internal/utils"
 	"net-zilla/pkg/logger"
 )
 
+const usage = `Usage: netzilla [command] [flags]
+
+Commands:
+  analyze      Analyze URLs given as arguments, or listed on stdin with "-"
+  batch        Analyze a list of URLs from a file or stdin, several at a time
+  history      List recent analyses
+  show         Print a stored report by ID
+  intel        Look values up in the threat intelligence store
+  db           Inspect the analysis database
+  graph        Query the infrastructure shared between analyses
+  campaigns    List campaigns of related analyses
+  trace        Trace the network route to a host
+  serve        Start the REST API
+  interactive  Start the terminal UI (history, report viewer, live progress)
+  file         Statically analyze a file or attachment
+  model        Train or inspect URL classifiers
+  eval         Score the labeled corpus and compare with the baseline
+
+Without a command, netzilla serves the API when server.enable_api is set and
+starts the terminal UI otherwise. Run "netzilla <command> -h" for flags.
+
+Analysis commands exit 0 when every verdict is LOW, 3/4/5 when the worst is
+MEDIUM/HIGH/CRITICAL, 1 on failure and 2 on bad usage.
+`
+
 func main() {
-	// 1. Config & Logger
+	if len(os.Args) < 2 {
+		os.Exit(runDefault())
+	}
+
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "analyze":
+		os.Exit(runAnalyze(args))
+	case "batch":
+		os.Exit(runBatch(args))
+	case "history":
+		os.Exit(runHistory(args))
+	case "show":
+		os.Exit(runShow(args))
+	case "intel":
+		os.Exit(runIntel(args))
+	case "db":
+		os.Exit(runDB(args))
+	case "graph":
+		os.Exit(runGraph(args))
+	case "campaigns":
+		os.Exit(runCampaigns(args))
+	case "trace":
+		os.Exit(runTrace(args))
+	case "serve":
+		os.Exit(runServe(args))
+	case "interactive":
+		os.Exit(runInteractive(args))
+	// Offline subcommands that do not need the configuration
+	case "model":
+		os.Exit(runModel(args))
+	case "eval":
+		os.Exit(runEval(args))
+	case "file":
+		os.Exit(runFile(args))
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(exitUsage)
+	}
+}
+
+// runDefault keeps the behavior of running netzilla without a command.
+func runDefault() int {
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Printf("❌ Failed to load configuration: %v\n", err)
-		os.Exit(1)
+		return exitError
 	}
-	l := logger.NewLogger()
+	if cfg.Server.EnableAPI {
+		return serve(cfg)
+	}
+	return interactive(cfg, false)
+}
+
+// runServe implements "netzilla serve".
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	host := fs.String("host", "", "listen address; overrides server.host")
+	port := fs.Int("port", 0, "listen port; overrides server.port")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load configuration: %v\n", err)
+		return exitError
+	}
+	if *host != "" {
+		cfg.Server.Host = *host
+	}
+	if *port != 0 {
+		cfg.Server.Port = *port
+	}
+	return serve(cfg)
+}
 
-	// 2. Storage
-	db, err := storage.NewDatabase("netzilla.db")
+// runInteractive implements "netzilla interactive".
+func runInteractive(args []string) int {
+	fs := flag.NewFlagSet("interactive", flag.ContinueOnError)
+	plain := fs.Bool("plain", false, "use the line-based menu instead of the full-screen UI")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	cfg, err := config.Load()
 	if err != nil {
+		fmt.Printf("❌ Failed to load configuration: %v\n", err)
+		return exitError
+	}
+	return interactive(cfg, *plain)
+}
+
+// openService opens storage and builds the analysis service. The returned
+// function closes the service, then storage.
+func openService(cfg *config.Config, l *logger.Logger) (*services.AnalysisService, func()) {
+	var db storage.Store
+	if store, err := storage.Open(cfg.Storage.Driver, cfg.Storage.DSN); err != nil {
 		l.Error("Failed to initialize database: %v", err)
 	} else {
-		defer db.Close()
+		db = store
 	}
+	service := services.NewAnalysisService(l, db, cfg)
+	return service, func() {
+		service.Close()
+		if db != nil {
+			db.Close()
+		}
+	}
+}
 
-	// 3. Core Services (New Architecture)
-	analysisService := services.NewAnalysisService(l, db, cfg)
-
-	// 4. Lifecycle Management
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+func serve(cfg *config.Config) int {
+	l := logger.NewLogger()
+	analysisService, closeService := openService(cfg, l)
+	defer closeService()
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	ctx, stop := signalContext()
+	defer stop()
 	go func() {
-		<-sigChan
+		<-ctx.Done()
 		l.Info("🛑 Shutting down...")
-		cancel()
 	}()
 
-	// 5. Entry Point Selection
-	if cfg.Server.EnableAPI {
-		l.Info("Starting Net-Zilla API server...")
-		apiServer := api.NewServer(analysisService, l, cfg)
-		if err := apiServer.Run(ctx); err != nil {
-			l.Error("API server failed: %v", err)
-			os.Exit(1)
-		}
-	} else {
-		l.Info("Starting Net-Zilla CLI...")
-		menu := utils.NewMenu(analysisService, l)
-		if err := menu.Run(); err != nil {
-			l.Error("CLI menu failed: %v", err)
-			os.Exit(1)
+	l.Info("Starting Net-Zilla API server...")
+	apiServer := api.NewServer(analysisService, l, cfg)
+	if err := apiServer.Run(ctx); err != nil {
+		l.Error("API server failed: %v", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// interactive runs the full-screen UI, or the line-based menu when asked to or
+// when stdin or stdout is not a terminal.
+func interactive(cfg *config.Config, plain bool) int {
+	l := logger.NewLogger()
+	analysisService, closeService := openService(cfg, l)
+	defer closeService()
+
+	if !plain && isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd()) {
+		if err := tui.Run(analysisService, l, cfg.Output.ReportPath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Terminal UI failed: %v\n", err)
+			return exitError
 		}
+		return exitOK
+	}
+
+	l.Info("Starting Net-Zilla CLI...")
+	menu := utils.NewMenu(analysisService, l)
+	if err := menu.Run(); err != nil {
+		l.Error("CLI menu failed: %v", err)
+		return exitError
 	}
+	return exitOK
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"net-zilla/internal/ai"
+	"net-zilla/internal/storage"
+)
+
+const modelUsage = `Usage: netzilla model <command> [flags]
+
+Commands:
+  train   Train a URL classifier from a labeled CSV (url,label)
+  info    Show a model file's type, feature set and holdout metrics
+`
+
+// runModel implements the "netzilla model" subcommands and returns the exit code.
+func runModel(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, modelUsage)
+		return 2
+	}
+	switch args[0] {
+	case "train":
+		return runModelTrain(args[1:])
+	case "info":
+		return runModelInfo(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown model command %q\n\n%s", args[0], modelUsage)
+		return 2
+	}
+}
+
+func runModelTrain(args []string) int {
+	fs := flag.NewFlagSet("model train", flag.ContinueOnError)
+	data := fs.String("data", "", "labeled CSV of url,label rows (required)")
+	dbPath := fs.String("db", "netzilla.db", "analysis database used to enrich URLs seen before; empty to skip")
+	modelType := fs.String("type", ai.ModelLogisticRegression, "model type: logistic_regression or gbt")
+	out := fs.String("out", "data/models/url-model.json", "where to write the trained model")
+	iterations := fs.Int("iterations", 0, "training epochs (logistic_regression) or trees (gbt); 0 for the default")
+	holdout := fs.Float64("holdout", 0.2, "fraction of examples held out for calibration and metrics")
+	seed := fs.Int64("seed", 1, "random seed for the holdout split")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *data == "" {
+		fmt.Fprintln(os.Stderr, "❌ -data is required")
+		fs.Usage()
+		return 2
+	}
+
+	f, err := os.Open(*data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	examples, err := ai.LoadLabeledURLs(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", *data, err)
+		return 1
+	}
+
+	var db storage.Store
+	if *dbPath != "" {
+		if _, statErr := os.Stat(*dbPath); statErr == nil {
+			if db, err = storage.NewDatabase(*dbPath); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+				return 1
+			}
+			defer db.Close()
+		}
+	}
+	if err := ai.AttachFeatures(context.Background(), examples, db); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	opts := ai.DefaultTrainOptions(*modelType)
+	opts.HoldoutFraction = *holdout
+	opts.Seed = *seed
+	if *iterations > 0 {
+		opts.Iterations = *iterations
+	}
+
+	model, err := ai.TrainURLModel(examples, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Training failed: %v\n", err)
+		return 1
+	}
+	if err := model.Save(*out); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	enriched := 0
+	for _, ex := range examples {
+		if ex.Enriched {
+			enriched++
+		}
+	}
+	fmt.Printf("✅ Trained %s model on %d URLs (%d enriched from stored analyses)\n", model.Type, len(examples), enriched)
+	printModel(model)
+	fmt.Printf("Model written to %s; set ai.model_path to use it\n", *out)
+	return 0
+}
+
+func runModelInfo(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla model info <model.json>")
+		return 2
+	}
+	model, err := ai.LoadURLModel(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	printModel(model)
+	return 0
+}
+
+func printModel(m *ai.URLModel) {
+	fmt.Printf("Type:        %s\n", m.Type)
+	fmt.Printf("Feature set: %s (%d features)\n", m.FeatureSet, len(m.Features))
+	fmt.Printf("Trained at:  %s\n", m.TrainedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("Threshold:   %.2f\n", m.Threshold)
+
+	names := make([]string, 0, len(m.Metrics))
+	for name := range m.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-17s %.4f\n", name, m.Metrics[name])
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"net-zilla/internal/models"
+	"net-zilla/internal/visualization"
+)
+
+// Exit codes. Analysis commands exit with the severity of the worst verdict so
+// scripts can gate on it without parsing output.
+const (
+	exitOK       = 0 // Command succeeded; every verdict LOW
+	exitError    = 1 // Command or analysis failed
+	exitUsage    = 2 // Bad flags or arguments
+	exitMedium   = 3 // Worst verdict MEDIUM
+	exitHigh     = 4 // Worst verdict HIGH
+	exitCritical = 5 // Worst verdict CRITICAL
+)
+
+// Output formats selected with --output.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+	outputSARIF = "sarif"
+	outputSTIX  = "stix"
+)
+
+// checkOutput validates an --output value against the formats a command supports.
+func checkOutput(format string, supported ...string) error {
+	for _, s := range supported {
+		if format == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output %q (want %s)", format, strings.Join(supported, ", "))
+}
+
+// verdictExitCode maps a report's overall risk to an exit code.
+func verdictExitCode(report *models.AdvancedReport) int {
+	if report == nil || report.RiskAssessment == nil {
+		return exitError
+	}
+	switch strings.ToUpper(report.RiskAssessment.OverallRiskLevel) {
+	case "CRITICAL":
+		return exitCritical
+	case "HIGH":
+		return exitHigh
+	case "MEDIUM":
+		return exitMedium
+	case "LOW":
+		return exitOK
+	default:
+		return exitError
+	}
+}
+
+// exitRank orders exit codes for worstExitCode: a failure outranks a clean
+// result but not a risky verdict.
+var exitRank = map[int]int{exitOK: 0, exitError: 1, exitMedium: 2, exitHigh: 3, exitCritical: 4}
+
+// worstExitCode combines per-target exit codes.
+func worstExitCode(codes ...int) int {
+	worst := exitOK
+	for _, c := range codes {
+		if exitRank[c] > exitRank[worst] {
+			worst = c
+		}
+	}
+	return worst
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+var reportColumns = []string{"TARGET", "VERDICT", "SCORE", "FINDINGS", "REPORT ID"}
+
+func reportRow(r *models.AdvancedReport) []string {
+	verdict, score := "ERROR", ""
+	if r.RiskAssessment != nil {
+		verdict = r.RiskAssessment.OverallRiskLevel
+		score = fmt.Sprintf("%.2f", r.RiskAssessment.RiskScore)
+	}
+	return []string{r.Target, verdict, score, fmt.Sprint(len(r.Findings)), r.ReportID}
+}
+
+// writeReports prints reports in format. JSON prints a single report as an
+// object and several as an array. SARIF results point at locations[i] when
+// locations is not nil.
+func writeReports(w io.Writer, format string, reports []*models.AdvancedReport, locations []visualization.SARIFLocation) error {
+	ef := visualization.NewExportFormatter()
+	switch format {
+	case outputJSON:
+		if len(reports) == 1 {
+			return writeJSON(w, reports[0])
+		}
+		return writeJSON(w, reports)
+	case outputSARIF, outputSTIX:
+		var data []byte
+		var err error
+		if format == outputSARIF {
+			data, err = ef.FormatSARIFWithLocations(reports, locations)
+		} else {
+			data, err = ef.FormatSTIX(reports)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	rows := make([][]string, len(reports))
+	for i, r := range reports {
+		rows[i] = reportRow(r)
+	}
+	if format == outputCSV {
+		return writeCSV(w, reportColumns, rows)
+	}
+	if err := writeTable(w, reportColumns, rows); err != nil {
+		return err
+	}
+	// A single report also gets its findings, which the row only counts.
+	if len(reports) == 1 {
+		for _, f := range reports[0].Findings {
+			fmt.Fprintf(w, "  - %s\n", f)
+		}
+	}
+	return nil
+}
+
+func writeHistory(w io.Writer, format string, history []*models.ThreatAnalysis) error {
+	if format == outputJSON {
+		return writeJSON(w, history)
+	}
+	columns := []string{"ANALYZED", "URL", "THREAT LEVEL", "SCORE", "ANALYSIS ID"}
+	rows := make([][]string, len(history))
+	for i, h := range history {
+		rows[i] = []string{h.AnalyzedAt.Format("2006-01-02 15:04:05"), h.URL, string(h.ThreatLevel), fmt.Sprint(h.ThreatScore), h.AnalysisID}
+	}
+	if format == outputCSV {
+		return writeCSV(w, columns, rows)
+	}
+	return writeTable(w, columns, rows)
+}
+
+func writeTable(w io.Writer, columns []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, columns []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = strings.ToLower(strings.ReplaceAll(c, " ", "_"))
+	}
+	cw.Write(header)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"net-zilla/internal/correlation"
+	"net-zilla/internal/models"
+	"net-zilla/internal/visualization"
+)
+
+func TestVerdictExitCodes(t *testing.T) {
+	report := func(level string) *models.AdvancedReport {
+		return &models.AdvancedReport{RiskAssessment: &models.RiskAssessment{OverallRiskLevel: level}}
+	}
+
+	tests := []struct {
+		name    string
+		reports []*models.AdvancedReport
+		want    int
+	}{
+		{"all low", []*models.AdvancedReport{report("LOW"), report("LOW")}, exitOK},
+		{"worst wins", []*models.AdvancedReport{report("MEDIUM"), report("CRITICAL"), report("HIGH")}, exitCritical},
+		{"failure over clean", []*models.AdvancedReport{report("LOW"), failedReport("x", nil)}, exitError},
+		{"risk over failure", []*models.AdvancedReport{report("ERROR"), report("MEDIUM")}, exitMedium},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var codes []int
+			for _, r := range tt.reports {
+				codes = append(codes, verdictExitCode(r))
+			}
+			if got := worstExitCode(codes...); got != tt.want {
+				t.Errorf("exit code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadTargets(t *testing.T) {
+	in := "http://a.example\n\n  # comment\n  http://b.example  \n"
+	got, err := readTargets(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "http://a.example,http://b.example" {
+		t.Errorf("readTargets = %q", got)
+	}
+}
+
+func TestSplitLocations(t *testing.T) {
+	tests := []struct {
+		line   string
+		target string
+		loc    visualization.SARIFLocation
+	}{
+		{"http://a.example", "http://a.example", visualization.SARIFLocation{}},
+		{"http://a.example:8080/x", "http://a.example:8080/x", visualization.SARIFLocation{}},
+		{"docs/links.md:12:https://b.example/p", "https://b.example/p", visualization.SARIFLocation{Path: "docs/links.md", Line: 12}},
+		{"./src/app.go:7:15:http://c.example:8080/", "http://c.example:8080/", visualization.SARIFLocation{Path: "./src/app.go", Line: 7, Column: 15}},
+		{"README.md:3:not a url", "README.md:3:not a url", visualization.SARIFLocation{}},
+	}
+	var lines []string
+	for _, tt := range tests {
+		lines = append(lines, tt.line)
+	}
+	targets, locations := splitLocations(lines)
+	for i, tt := range tests {
+		if targets[i] != tt.target || locations[i] != tt.loc {
+			t.Errorf("%q = %q at %+v, want %q at %+v", tt.line, targets[i], locations[i], tt.target, tt.loc)
+		}
+	}
+
+	if _, locations := splitLocations([]string{"http://a.example"}); locations != nil {
+		t.Errorf("locations without any located line = %v, want nil", locations)
+	}
+}
+
+func TestWriteReportsCSV(t *testing.T) {
+	var out strings.Builder
+	reports := []*models.AdvancedReport{{
+		ReportID:       "nz-1",
+		Target:         "http://a.example/?q=1,2",
+		RiskAssessment: &models.RiskAssessment{OverallRiskLevel: "HIGH", RiskScore: 0.6},
+		Findings:       []string{"one", "two"},
+	}}
+	if err := writeReports(&out, outputCSV, reports, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "target,verdict,score,findings,report_id\n\"http://a.example/?q=1,2\",HIGH,0.60,2,nz-1\n"
+	if out.String() != want {
+		t.Errorf("csv =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestWritePath(t *testing.T) {
+	g := correlation.NewRelationshipGraph()
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	g.AddEdge(correlation.NodeDomain, "a.example", correlation.RelResolvesTo, correlation.NodeIP, "203.0.113.7", "NZ-1", at)
+	g.AddEdge(correlation.NodeDomain, "b.example", correlation.RelResolvesTo, correlation.NodeIP, "203.0.113.7", "NZ-2", at)
+	path, ok := g.ShortestPath("DOMAIN:a.example", "DOMAIN:b.example")
+	if !ok {
+		t.Fatal("no path")
+	}
+
+	var sb strings.Builder
+	if err := writePath(&sb, path); err != nil {
+		t.Fatal(err)
+	}
+	want := "DOMAIN       a.example  --RESOLVES_TO-->\n" +
+		"IP           203.0.113.7  <--RESOLVES_TO--\n" +
+		"DOMAIN       b.example\n"
+	if sb.String() != want {
+		t.Errorf("writePath =\n%s\nwant\n%s", sb.String(), want)
+	}
+	if got := clusterSummary(g); got != "203.0.113.7" {
+		t.Errorf("clusterSummary = %q", got)
+	}
+}
+
+func TestWriteCampaign(t *testing.T) {
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := &correlation.Campaign{
+		ID: "CMP-0123456789", RiskLevel: "HIGH", FirstSeen: at, LastSeen: at.AddDate(0, 0, 1), Targets: 2,
+		Members: []correlation.CampaignMember{
+			{AnalysisID: "NZ-1", Target: "https://a.example/", AnalyzedAt: at, RiskLevel: "HIGH"},
+			{AnalysisID: "NZ-2", Target: "https://b.example/", AnalyzedAt: at.AddDate(0, 0, 1), RiskLevel: "MEDIUM"},
+		},
+		Evidence: []string{"shared certificate abcdef", "shared IP 203.0.113.7", "same registrar"},
+		Timeline: []correlation.CampaignDay{
+			{Date: "2025-03-01", Analyses: 1, Targets: []string{"https://a.example/"}},
+			{Date: "2025-03-02", Analyses: 1, Targets: []string{"https://b.example/"}},
+		},
+	}
+
+	var sb strings.Builder
+	if err := writeCampaign(&sb, c); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Campaign CMP-0123456789  HIGH  2025-03-01 12:00", "  - shared IP 203.0.113.7\n", "NZ-2", "2025-03-02"} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("writeCampaign output missing %q:\n%s", want, sb.String())
+		}
+	}
+	if got := campaignSummary(c.Evidence); got != "shared certificate abcdef; shared IP 203.0.113.7; +1 more" {
+		t.Errorf("campaignSummary = %q", got)
+	}
+	if len(c.Evidence) != 3 || c.Evidence[2] != "same registrar" {
+		t.Errorf("campaignSummary modified its input: %v", c.Evidence)
+	}
+}
+
+func TestWriteTrace(t *testing.T) {
+	trace := &models.NetworkAnalysis{
+		Target: "evil.example", Mode: "icmp", Reached: true, HopCount: 2, GeoPath: "DE -> US",
+		Warnings: []string{"Hop 1 answered only some probes"},
+		Hops: []models.HopDetail{
+			{Number: 1},
+			{Number: 2, IP: "203.0.113.7", Host: "edge.example", ASN: "AS64500", Country: "US", Latency: 12340 * time.Microsecond, Loss: 33.3},
+		},
+	}
+	var sb strings.Builder
+	if err := writeTrace(&sb, trace); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Trace to evil.example (icmp, reached in 2 hops, 0% loss)", "  ! Hop 1 answered only some probes", "1    *", "203.0.113.7  edge.example  AS64500  US       12.3ms  33%", "Path: DE -> US"} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("writeTrace output missing %q:\n%s", want, sb.String())
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+// runTrace implements "netzilla trace". Mode, hops and probes per hop come
+// from the network.traceroute_* settings unless given as flags.
+func runTrace(args []string) int {
+	fs := flag.NewFlagSet("trace", flag.ContinueOnError)
+	output := outputFlag(fs, outputTable, outputTable, outputJSON)
+	timeout := fs.Duration("timeout", 2*time.Minute, "give up after this long")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: netzilla trace [flags] <url|host|ip>\n\nICMP, UDP and TCP modes need raw sockets (root or CAP_NET_RAW); without them only the destination latency is measured.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := checkOutput(*output, outputTable, outputJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	a, err := newApp(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	defer a.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	trace, err := a.service.Traceroute(ctx, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	if *output == outputJSON {
+		err = writeJSON(os.Stdout, trace)
+	} else {
+		err = writeTrace(os.Stdout, trace)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// writeTrace prints the hops of a traceroute and its summary.
+func writeTrace(w io.Writer, t *models.NetworkAnalysis) error {
+	reached := "not reached"
+	if t.Reached {
+		reached = "reached"
+	}
+	fmt.Fprintf(w, "Trace to %s (%s, %s in %d hops, %.0f%% loss)\n", t.Target, t.Mode, reached, t.HopCount, t.PacketLoss)
+	for _, warning := range t.Warnings {
+		fmt.Fprintf(w, "  ! %s\n", warning)
+	}
+	fmt.Fprintln(w)
+
+	rows := make([][]string, len(t.Hops))
+	for i, h := range t.Hops {
+		ip, rtt := h.IP, ""
+		if ip == "" {
+			ip = "*"
+		} else {
+			rtt = h.Latency.Round(100 * time.Microsecond).String()
+		}
+		rows[i] = []string{strconv.Itoa(h.Number), ip, h.Host, h.ASN, h.Country, rtt, fmt.Sprintf("%.0f%%", h.Loss)}
+	}
+	if err := writeTable(w, []string{"HOP", "IP", "HOST", "ASN", "COUNTRY", "RTT", "LOSS"}, rows); err != nil {
+		return err
+	}
+	if t.GeoPath != "" {
+		fmt.Fprintf(w, "\nPath: %s\n", t.GeoPath)
+	}
+	return nil
+}
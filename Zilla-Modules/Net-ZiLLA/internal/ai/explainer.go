@@ -0,0 +1,469 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"net-zilla/internal/config"
+	"net-zilla/internal/models"
+	"net-zilla/internal/shared_models"
+	"net-zilla/pkg/logger"
+)
+
+// Default budgets for one explanation. Tokens are estimated, not counted, so the
+// prompt budget is kept well below the context size of small local models.
+const (
+	defaultPromptTokens     = 1200
+	defaultCompletionTokens = 300
+	defaultExplainTimeout   = 20 * time.Second
+
+	explainMaxActions = 5
+)
+
+// ExplanationSourceFallback marks an explanation built without a provider.
+const ExplanationSourceFallback = "fallback"
+
+// Explanation is an analyst-facing summary of a ThreatAnalysis.
+type Explanation struct {
+	Summary string   `json:"summary"`
+	Actions []string `json:"actions"`
+	Source  string   `json:"source"`          // Provider name, or "fallback"
+	Error   string   `json:"error,omitempty"` // Why the provider was not used
+}
+
+// Explainer turns analysis results into prose. It asks an LLMProvider when one is
+// configured and falls back to a deterministic summary when it is not, fails or
+// returns something unusable, so callers always get an explanation.
+type Explainer struct {
+	provider         LLMProvider
+	promptTokens     int
+	completionTokens int
+	timeout          time.Duration
+	log              *logger.Logger
+}
+
+// NewExplainer creates an Explainer. provider may be nil to always use the fallback.
+func NewExplainer(provider LLMProvider, l *logger.Logger) *Explainer {
+	return &Explainer{
+		provider:         provider,
+		promptTokens:     defaultPromptTokens,
+		completionTokens: defaultCompletionTokens,
+		timeout:          defaultExplainTimeout,
+		log:              l,
+	}
+}
+
+// NewExplainerFromConfig creates an Explainer that asks the server at
+// cfg.LLMEndpoint, if set, within the cfg.LLM* budgets.
+func NewExplainerFromConfig(cfg *config.AIConfig, l *logger.Logger) *Explainer {
+	var provider LLMProvider
+	if cfg.LLMEndpoint != "" {
+		p := NewOpenAIProvider(cfg.LLMEndpoint, cfg.LLMModel)
+		p.SetAPIKey(cfg.LLMAPIKey)
+		provider = p
+		l.Info("Explanations from %s at %s", cfg.LLMModel, cfg.LLMEndpoint)
+	}
+	e := NewExplainer(provider, l)
+	e.SetBudget(cfg.LLMPromptTokens, cfg.LLMMaxTokens, cfg.LLMTimeout)
+	return e
+}
+
+// SetBudget limits the estimated prompt size, the completion length and the wall
+// time of a provider call. Zero values keep the current setting.
+func (e *Explainer) SetBudget(promptTokens, completionTokens int, timeout time.Duration) {
+	if promptTokens > 0 {
+		e.promptTokens = promptTokens
+	}
+	if completionTokens > 0 {
+		e.completionTokens = completionTokens
+	}
+	if timeout > 0 {
+		e.timeout = timeout
+	}
+}
+
+const explainSystemPrompt = `You are a security analyst assistant for Net-ZiLLA, a link and message threat analyzer.
+Explain the analysis you are given to a SOC analyst in plain language. Use only the evidence provided; do not invent findings.
+Reply in exactly this format:
+EXPLANATION: <two to four sentences on what the link is and why it got its verdict>
+ACTIONS:
+- <one recommended action per line, at most five>`
+
+var explainPromptTemplate = template.Must(template.New("explain").Parse(
+	`Explain this link analysis.
+
+Target: {{.Target}}
+Verdict: {{.Level}} (risk score {{.Score}}/100)
+{{if .Evidence}}Evidence:
+{{range .Evidence}}- {{.}}
+{{end}}{{else}}Evidence: none recorded
+{{end}}{{if .Omitted}}({{.Omitted}} further items omitted for length)
+{{end}}`))
+
+type explainPrompt struct {
+	Target   string
+	Level    string
+	Score    int
+	Evidence []string
+	Omitted  int
+}
+
+// Explain summarizes analysis, using result for the model's verdict when present.
+func (e *Explainer) Explain(ctx context.Context, analysis *models.ThreatAnalysis, result *shared_models.AIAnalysisResult) *Explanation {
+	evidence := explainEvidence(analysis, result)
+	if e.provider == nil {
+		return e.fallback(analysis, evidence, "")
+	}
+
+	prompt, err := e.buildPrompt(analysis, evidence)
+	if err != nil {
+		return e.fallback(analysis, evidence, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	resp, err := e.provider.Complete(ctx, LLMRequest{
+		System:    explainSystemPrompt,
+		Prompt:    prompt,
+		MaxTokens: e.completionTokens,
+	})
+	if err != nil {
+		e.log.Warn("LLM explanation failed, using fallback: %v", err)
+		return e.fallback(analysis, evidence, err.Error())
+	}
+
+	explanation, ok := parseExplanation(resp.Text)
+	if !ok {
+		e.log.Warn("LLM explanation from %s was not usable, using fallback", e.provider.Name())
+		return e.fallback(analysis, evidence, "unusable provider response")
+	}
+	explanation.Source = e.provider.Name()
+	return explanation
+}
+
+// Apply replaces result's reasoning and leading recommendations with an explanation
+// of analysis and records where it came from.
+func (e *Explainer) Apply(ctx context.Context, analysis *models.ThreatAnalysis, result *shared_models.AIAnalysisResult) {
+	if result == nil {
+		return
+	}
+	explanation := e.Explain(ctx, analysis, result)
+
+	result.Reasoning = explanation.Summary
+	recs := append([]string(nil), explanation.Actions...)
+	seen := make(map[string]bool, len(recs))
+	for _, r := range recs {
+		seen[r] = true
+	}
+	for _, r := range result.Recommendations {
+		if !seen[r] {
+			seen[r] = true
+			recs = append(recs, r)
+		}
+	}
+	result.Recommendations = recs
+
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata["explanation_source"] = explanation.Source
+	if explanation.Error != "" {
+		result.Metadata["explanation_error"] = explanation.Error
+	}
+}
+
+// ApplyReport writes an explanation of report into its risk summary and
+// records the recommended actions and where the explanation came from in its
+// metadata.
+func (e *Explainer) ApplyReport(ctx context.Context, report *models.AdvancedReport) {
+	if report == nil || report.RiskAssessment == nil {
+		return
+	}
+	explanation := e.Explain(ctx, reportAnalysis(report), nil)
+
+	report.RiskAssessment.Summary = explanation.Summary
+	if report.Metadata == nil {
+		report.Metadata = make(map[string]interface{})
+	}
+	report.Metadata["recommended_actions"] = explanation.Actions
+	report.Metadata["explanation_source"] = explanation.Source
+	if explanation.Error != "" {
+		report.Metadata["explanation_error"] = explanation.Error
+	}
+}
+
+// reportAnalysis is the ThreatAnalysis a report is explained from: its
+// infrastructure analysis with the final verdict, the matched correlation
+// rules and every finding of the pipeline.
+func reportAnalysis(report *models.AdvancedReport) *models.ThreatAnalysis {
+	var analysis models.ThreatAnalysis
+	if report.BasicAnalysis != nil {
+		analysis = *report.BasicAnalysis
+	}
+	analysis.URL = report.Target
+	analysis.ThreatLevel = models.ThreatLevel(report.RiskAssessment.OverallRiskLevel)
+	analysis.ThreatScore = int(math.Round(report.RiskAssessment.RiskScore * 100))
+
+	findings := make([]string, 0, len(report.Insights)+len(report.Findings)+len(analysis.Findings))
+	for _, in := range report.Insights {
+		findings = append(findings, in.Title)
+	}
+	findings = append(findings, report.Findings...)
+	analysis.Findings = append(findings, analysis.Findings...)
+	return &analysis
+}
+
+// buildPrompt renders the prompt, dropping the lowest-priority evidence until it
+// fits the token budget. Everything that reaches the provider is redacted.
+func (e *Explainer) buildPrompt(analysis *models.ThreatAnalysis, evidence []string) (string, error) {
+	data := explainPrompt{
+		Target: redactSecrets(analysis.URL),
+		Level:  plainThreatLevel(analysis.ThreatLevel),
+		Score:  analysis.ThreatScore,
+	}
+	for _, item := range evidence {
+		data.Evidence = append(data.Evidence, redactSecrets(item))
+	}
+
+	budget := e.promptTokens - estimateTokens(explainSystemPrompt)
+	var prompt string
+	for {
+		var b strings.Builder
+		if err := explainPromptTemplate.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("rendering explain prompt: %w", err)
+		}
+		prompt = b.String()
+		if estimateTokens(prompt) <= budget || len(data.Evidence) == 0 {
+			break
+		}
+		data.Evidence = data.Evidence[:len(data.Evidence)-1]
+		data.Omitted++
+	}
+
+	// A single oversized target or evidence line can still blow the budget.
+	if limit := budget * 4; limit > 0 && len(prompt) > limit {
+		prompt = truncateUTF8(prompt, limit)
+	}
+	return prompt, nil
+}
+
+// fallback builds a deterministic explanation from the analysis alone.
+func (e *Explainer) fallback(analysis *models.ThreatAnalysis, evidence []string, reason string) *Explanation {
+	level := plainThreatLevel(analysis.ThreatLevel)
+	target := redactSecrets(analysis.URL)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s was rated %s with a risk score of %d/100.", target, level, analysis.ThreatScore)
+	switch {
+	case len(evidence) == 0:
+		b.WriteString(" No significant findings were recorded.")
+	default:
+		top := evidence
+		if len(top) > 3 {
+			top = top[:3]
+		}
+		redacted := make([]string, len(top))
+		for i, item := range top {
+			redacted[i] = strings.TrimRight(redactSecrets(item), ".")
+		}
+		fmt.Fprintf(&b, " Main findings: %s.", strings.Join(redacted, "; "))
+		if more := len(evidence) - len(top); more > 0 {
+			fmt.Fprintf(&b, " %d further findings are listed in the report.", more)
+		}
+	}
+
+	return &Explanation{
+		Summary: b.String(),
+		Actions: fallbackActions(analysis, level),
+		Source:  ExplanationSourceFallback,
+		Error:   reason,
+	}
+}
+
+func fallbackActions(analysis *models.ThreatAnalysis, level string) []string {
+	var actions []string
+	switch level {
+	case "CRITICAL", "HIGH":
+		actions = []string{
+			"Block the domain at the web proxy and mail gateway",
+			"Search proxy and mail logs for other users who received or opened the link",
+			"Reset credentials for anyone who entered them on the page",
+		}
+	case "MEDIUM":
+		actions = []string{
+			"Treat the link as suspicious and do not enter credentials",
+			"Confirm the request with the sender through a separate channel",
+		}
+	default:
+		actions = []string{"No action required beyond normal caution"}
+	}
+
+	if analysis.RedirectCount >= 3 {
+		actions = append(actions, fmt.Sprintf("Review the final landing page; the link redirects %d times", analysis.RedirectCount))
+	}
+	if analysis.DNSInfo != nil && analysis.DNSInfo.EmailSecurity != nil && analysis.DNSInfo.EmailSecurity.RiskScore >= 15 {
+		actions = append(actions, fmt.Sprintf("Do not trust mail claiming to come from %s unless it passes DMARC", analysis.DNSInfo.EmailSecurity.Domain))
+	}
+	if len(actions) > explainMaxActions {
+		actions = actions[:explainMaxActions]
+	}
+	return actions
+}
+
+// explainEvidence collects findings in priority order, most telling first, without
+// duplicates. Budgeting drops items from the end.
+func explainEvidence(analysis *models.ThreatAnalysis, result *shared_models.AIAnalysisResult) []string {
+	var out []string
+	seen := make(map[string]bool)
+	add := func(items ...string) {
+		for _, item := range items {
+			item = strings.TrimSpace(item)
+			if item == "" || seen[item] {
+				continue
+			}
+			seen[item] = true
+			out = append(out, item)
+		}
+	}
+
+	add(analysis.PhishingIndicators...)
+	add(analysis.Warnings...)
+	add(analysis.SuspiciousFeatures...)
+
+	if result != nil && result.RiskLevel != "" {
+		add(fmt.Sprintf("ML classifier: %s risk, confidence %.2f", result.RiskLevel, result.Confidence))
+		add(result.Reasoning)
+	}
+	if analysis.RedirectCount > 0 && len(analysis.RedirectChain) > 0 {
+		final := analysis.RedirectChain[len(analysis.RedirectChain)-1].URL
+		add(fmt.Sprintf("Redirects %d times before landing on %s", analysis.RedirectCount, final))
+	}
+	if w := analysis.WhoisInfo; w != nil && w.DomainAgeDays > 0 {
+		add(fmt.Sprintf("Domain registered %d days ago through %s", w.DomainAgeDays, orUnknown(w.Registrar)))
+	}
+	if t := analysis.TLSInfo; t != nil {
+		if !t.CertificateValid {
+			add("TLS certificate is not valid")
+		}
+		if t.Issuer != "" {
+			add(fmt.Sprintf("TLS certificate issued by %s, expires in %d days", t.Issuer, t.ExpiresInDays))
+		}
+	}
+	if g := analysis.GeoAnalysis; g != nil && g.Country != "" {
+		hosting := fmt.Sprintf("Hosted in %s by %s", g.Country, orUnknown(g.ISP))
+		if g.ASN != "" {
+			hosting += " (" + g.ASN + ")"
+		}
+		if g.IsProxy {
+			hosting += ", behind a proxy or VPN"
+		}
+		add(hosting)
+	}
+	if d := analysis.DNSInfo; d != nil && d.EmailSecurity != nil {
+		add(d.EmailSecurity.Findings...)
+	}
+	if result != nil {
+		add(result.Threats...)
+	}
+	add(analysis.Findings...)
+	return out
+}
+
+// Redaction rules applied to everything sent to a provider. Order matters: URL
+// credentials go before the generic email rule so "user:pass@host" is not half-matched.
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), "[REDACTED PRIVATE KEY]"},
+	{regexp.MustCompile(`(?i)\b([a-z][a-z0-9+.-]*://)[^/\s:@]+:[^/\s@]+@`), "${1}[REDACTED]@"},
+	{regexp.MustCompile(`(?i)([?&;#](?:access_token|id_token|refresh_token|token|api_?key|key|secret|client_secret|password|passwd|pwd|pass|session|session_?id|sid|auth|code|otp|sig|signature|x-amz-signature|x-amz-credential|x-amz-security-token)=)[^&#\s]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[a-z0-9._~+/=-]{8,}`), "${1} [REDACTED]"},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]*`), "[REDACTED JWT]"},
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), "[REDACTED AWS KEY]"},
+	{regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35})\b`), "[REDACTED API KEY]"},
+	{regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@([A-Za-z0-9.-]+\.[A-Za-z]{2,})\b`), "[REDACTED]@${1}"},
+}
+
+// redactSecrets masks credentials, tokens and mailbox names so prompts can be sent
+// to a model server without leaking what was in the analyzed link or message.
+func redactSecrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+var listMarker = regexp.MustCompile(`^(?:[-*•]|\d+[.)])\s*`)
+
+// parseExplanation reads the EXPLANATION/ACTIONS reply format. Replies without the
+// markers are accepted as a bare summary; empty replies are not.
+func parseExplanation(text string) (*Explanation, bool) {
+	text = redactSecrets(strings.TrimSpace(text))
+	if text == "" {
+		return nil, false
+	}
+
+	summary := text
+	var actionBlock string
+	upper := strings.ToUpper(text)
+	if i := strings.Index(upper, "ACTIONS:"); i >= 0 {
+		summary = text[:i]
+		actionBlock = text[i+len("ACTIONS:"):]
+	}
+	if i := strings.Index(strings.ToUpper(summary), "EXPLANATION:"); i >= 0 {
+		summary = summary[i+len("EXPLANATION:"):]
+	}
+	summary = strings.Join(strings.Fields(summary), " ")
+	if summary == "" {
+		return nil, false
+	}
+
+	var actions []string
+	for _, line := range strings.Split(actionBlock, "\n") {
+		line = strings.TrimSpace(listMarker.ReplaceAllString(strings.TrimSpace(line), ""))
+		if line == "" {
+			continue
+		}
+		actions = append(actions, line)
+		if len(actions) == explainMaxActions {
+			break
+		}
+	}
+	return &Explanation{Summary: summary, Actions: actions}, true
+}
+
+// plainThreatLevel strips the display emoji from a ThreatLevel.
+func plainThreatLevel(level models.ThreatLevel) string {
+	fields := strings.Fields(string(level))
+	if len(fields) == 0 {
+		return "UNKNOWN"
+	}
+	return fields[len(fields)-1]
+}
+
+// estimateTokens approximates a token count at four bytes per token, which errs
+// on the high side for English text.
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+func truncateUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "an unknown provider"
+	}
+	return s
+}
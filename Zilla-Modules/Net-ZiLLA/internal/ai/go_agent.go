@@ -1,6 +1,7 @@
 package ai
 
 import (
+	"fmt"
 	"math"
 	"net/url"
 	"regexp"
@@ -13,6 +14,7 @@ import (
 // GoAgent implements advanced analysis logic in native Go.
 type GoAgent struct {
 	confidenceThreshold float64
+	model               *URLModel // Trained classifier; nil falls back to the heuristics
 }
 
 // NewGoAgent creates a new GoAgent.
@@ -22,9 +24,22 @@ func NewGoAgent(confidenceThreshold float64) *GoAgent {
 	}
 }
 
+// SetModel makes AnalyzeLink score URLs with a trained model instead of the heuristics.
+func (g *GoAgent) SetModel(m *URLModel) {
+	g.model = m
+}
+
+// Model returns the loaded URL model, or nil when the heuristics are in use.
+func (g *GoAgent) Model() *URLModel {
+	return g.model
+}
+
 // AnalyzeLink performs native Go-based analysis using extracted features and component results.
 func (g *GoAgent) AnalyzeLink(analysis *models.ThreatAnalysis) (*shared_models.AIAnalysisResult, error) {
 	features := g.extractFeatures(analysis)
+	if g.model != nil {
+		return g.analyzeWithModel(analysis, features)
+	}
 
 	// Calculate a heuristic-based "health score" from actual component data
 	healthScore := g.calculateHealthScore(features)
@@ -37,14 +52,7 @@ func (g *GoAgent) AnalyzeLink(analysis *models.ThreatAnalysis) (*shared_models.A
 	overallConfidence := (healthScore + (1.0 - ipRisk)) / 2.0
 	isSafe := overallConfidence > 0.7
 
-	riskLevel := "LOW"
-	if overallConfidence < 0.3 {
-		riskLevel = "CRITICAL"
-	} else if overallConfidence < 0.5 {
-		riskLevel = "HIGH"
-	} else if overallConfidence < 0.7 {
-		riskLevel = "MEDIUM"
-	}
+	riskLevel := riskLevelFor(overallConfidence)
 
 	threats := g.generateThreats(features, healthScore, ipRisk)
 	recommendations := g.generateRecommendations(isSafe, riskLevel, features.IsShortened)
@@ -67,6 +75,72 @@ func (g *GoAgent) AnalyzeLink(analysis *models.ThreatAnalysis) (*shared_models.A
 	return result, nil
 }
 
+// analyzeWithModel scores the URL with the trained model. Confidence is the calibrated
+// probability that the URL is benign, so it can be read like the heuristic score.
+func (g *GoAgent) analyzeWithModel(analysis *models.ThreatAnalysis, features AdvancedFeatures) (*shared_models.AIAnalysisResult, error) {
+	vector := ExtractURLFeatures(analysis)
+	pMalicious, err := g.model.Predict(vector)
+	if err != nil {
+		return nil, fmt.Errorf("url model inference failed: %w", err)
+	}
+
+	confidence := 1 - pMalicious
+	isSafe := pMalicious < g.model.Threshold
+	riskLevel := riskLevelFor(confidence)
+	ipRisk := 0.1
+	if features.IsProxy {
+		ipRisk = 0.8
+	}
+
+	threats := g.generateThreats(features, confidence, ipRisk)
+	var factors []string
+	for _, c := range g.model.Contributions(vector) {
+		if c.Value <= 0 || len(factors) == 3 {
+			continue
+		}
+		factors = append(factors, fmt.Sprintf("%s (+%.2f)", c.Feature, c.Value))
+	}
+
+	result := &shared_models.AIAnalysisResult{
+		IsSafe:          isSafe,
+		Confidence:      confidence,
+		RiskLevel:       riskLevel,
+		IsShortened:     features.IsShortened,
+		HealthScore:     g.calculateHealthScore(features),
+		Threats:         threats,
+		Recommendations: g.generateRecommendations(isSafe, riskLevel, features.IsShortened),
+		Reasoning:       fmt.Sprintf("%s model (%s): P(malicious)=%.3f", g.model.Type, g.model.FeatureSet, pMalicious),
+		Metadata: map[string]interface{}{
+			"model_type":            g.model.Type,
+			"feature_set":           g.model.FeatureSet,
+			"malicious_probability": pMalicious,
+		},
+	}
+	if len(factors) > 0 {
+		result.Reasoning += "; top factors: " + strings.Join(factors, ", ")
+	}
+
+	// The prediction is uncertain when neither class is likely enough.
+	if math.Max(pMalicious, confidence) < g.confidenceThreshold {
+		result.RiskLevel = "UNKNOWN (Low Confidence)"
+		result.Threats = append(result.Threats, "AI analysis confidence below threshold")
+	}
+	return result, nil
+}
+
+// riskLevelFor maps a benign-confidence score to a risk level.
+func riskLevelFor(confidence float64) string {
+	switch {
+	case confidence < 0.3:
+		return "CRITICAL"
+	case confidence < 0.5:
+		return "HIGH"
+	case confidence < 0.7:
+		return "MEDIUM"
+	}
+	return "LOW"
+}
+
 type AdvancedFeatures struct {
 	URLLength       int
 	NumSpecialChars int
@@ -76,7 +150,9 @@ type AdvancedFeatures struct {
 	Entropy         float64
 	KeywordMatches  int
 	DomainAgeDays   int
+	DomainAgeKnown  bool
 	SSLValid        bool
+	SSLKnown        bool
 	IsProxy         bool
 	IsShortened     bool
 	IsPunycode      bool
@@ -93,7 +169,6 @@ func (g *GoAgent) extractFeatures(a *models.ThreatAnalysis) AdvancedFeatures {
 	f := AdvancedFeatures{
 		URLLength:       len(a.URL),
 		NumSpecialChars: strings.Count(lowerURL, "@") + strings.Count(lowerURL, "%") + strings.Count(lowerURL, "&") + strings.Count(lowerURL, "=") + strings.Count(lowerURL, "?") + strings.Count(lowerURL, "#"),
-		SSLValid:        true,
 		IsPunycode:      strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--"),
 	}
 
@@ -122,20 +197,11 @@ func (g *GoAgent) extractFeatures(a *models.ThreatAnalysis) AdvancedFeatures {
 		f.KeywordMatches += 5 // Force high suspicion
 	}
 
-	if a.WhoisInfo != nil {
-		if strings.Contains(a.WhoisInfo.DomainAge, "years") {
-			f.DomainAgeDays = 365 * 2
-		} else if strings.Contains(a.WhoisInfo.DomainAge, "days") {
-			f.DomainAgeDays = 10
-		} else {
-			f.DomainAgeDays = 365
-		}
-	} else {
-		f.DomainAgeDays = 365
-	}
+	f.DomainAgeDays, f.DomainAgeKnown = domainAgeDays(a.WhoisInfo)
 
 	if a.TLSInfo != nil {
 		f.SSLValid = a.TLSInfo.CertificateValid
+		f.SSLKnown = true
 	}
 
 	if a.GeoAnalysis != nil {
@@ -192,10 +258,10 @@ func (g *GoAgent) calculateHealthScore(f AdvancedFeatures) float64 {
 	if f.TLDRisk > 0.5 {
 		score -= 0.2
 	}
-	if f.DomainAgeDays < 30 {
+	if f.DomainAgeKnown && f.DomainAgeDays < 30 {
 		score -= 0.3
 	}
-	if !f.SSLValid {
+	if f.SSLKnown && !f.SSLValid {
 		score -= 0.4
 	}
 	if f.IsProxy {
@@ -225,10 +291,10 @@ func (g *GoAgent) generateThreats(f AdvancedFeatures, healthScore, ipRisk float6
 	if f.TLDRisk > 0.7 {
 		threats = append(threats, "High-risk top-level domain")
 	}
-	if f.DomainAgeDays < 30 && f.DomainAgeDays > 0 {
+	if f.DomainAgeKnown && f.DomainAgeDays < 30 {
 		threats = append(threats, "Very recently registered domain")
 	}
-	if !f.SSLValid {
+	if f.SSLKnown && !f.SSLValid {
 		threats = append(threats, "Invalid or missing SSL/TLS certificate")
 	}
 	if f.IsProxy {
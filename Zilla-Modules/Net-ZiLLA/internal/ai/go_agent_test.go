@@ -1,6 +1,7 @@
 package ai
 
 import (
+	"math"
 	"net-zilla/internal/models"
 	"testing"
 )
@@ -74,3 +75,40 @@ func TestGoAgent_AnalyzeSMS(t *testing.T) {
 		})
 	}
 }
+
+func TestGoAgent_AnalyzeLinkWithModel(t *testing.T) {
+	model, err := TrainURLModel(syntheticExamples(300, 11), DefaultTrainOptions(ModelLogisticRegression))
+	if err != nil {
+		t.Fatalf("TrainURLModel: %v", err)
+	}
+	agent := NewGoAgent(0.7)
+	agent.SetModel(model)
+
+	phish, err := agent.AnalyzeLink(&models.ThreatAnalysis{URL: "http://site42-secure-login.tk/verify?account=7"})
+	if err != nil {
+		t.Fatalf("AnalyzeLink: %v", err)
+	}
+	if phish.IsSafe || phish.Confidence >= 0.5 {
+		t.Errorf("expected unsafe with low benign confidence, got safe=%v confidence=%.3f", phish.IsSafe, phish.Confidence)
+	}
+	if p, ok := phish.Metadata["malicious_probability"].(float64); !ok || math.Abs(p+phish.Confidence-1) > 1e-9 {
+		t.Errorf("confidence should be the calibrated benign probability, metadata %v", phish.Metadata)
+	}
+
+	benign, _ := agent.AnalyzeLink(&models.ThreatAnalysis{URL: "https://www.site42.com/"})
+	if !benign.IsSafe {
+		t.Errorf("expected safe, got %+v", benign)
+	}
+}
+
+func TestGoAgent_UnknownTLSNotAssumedValid(t *testing.T) {
+	agent := NewGoAgent(0.7)
+	f := agent.extractFeatures(&models.ThreatAnalysis{URL: "https://example.com"})
+	if f.SSLKnown || f.SSLValid {
+		t.Errorf("TLS state should be unknown without TLS info, got known=%v valid=%v", f.SSLKnown, f.SSLValid)
+	}
+	f = agent.extractFeatures(&models.ThreatAnalysis{URL: "https://example.com", TLSInfo: &models.TLSAnalysis{}})
+	if !f.SSLKnown || f.SSLValid {
+		t.Errorf("expected known invalid certificate, got known=%v valid=%v", f.SSLKnown, f.SSLValid)
+	}
+}
@@ -0,0 +1,169 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// llmMaxResponseBytes caps how much of a provider response is read.
+const llmMaxResponseBytes = 1 << 20
+
+// LLMRequest is a single chat completion: a system prompt, the user prompt and the
+// completion budget.
+type LLMRequest struct {
+	System    string
+	Prompt    string
+	MaxTokens int
+}
+
+// LLMResponse is the text a provider returned and what it cost.
+type LLMResponse struct {
+	Text             string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Truncated        bool // The provider stopped because MaxTokens ran out
+}
+
+// LLMProvider generates text from a prompt. Implementations must honour ctx.
+type LLMProvider interface {
+	Name() string
+	Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error)
+}
+
+// OpenAIProvider talks to any server exposing the OpenAI chat completions API,
+// such as llama.cpp's server, Ollama or vLLM running next to Net-ZiLLA.
+type OpenAIProvider struct {
+	baseURL    string
+	model      string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewOpenAIProvider creates a provider for the server at baseURL, e.g.
+// "http://127.0.0.1:11434/v1". A missing "/v1" suffix is added.
+func NewOpenAIProvider(baseURL, model string) *OpenAIProvider {
+	base := strings.TrimRight(baseURL, "/")
+	if !strings.HasSuffix(base, "/v1") {
+		base += "/v1"
+	}
+	return &OpenAIProvider{
+		baseURL:    base,
+		model:      model,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetAPIKey sends key as a bearer token. Local servers usually need none.
+func (p *OpenAIProvider) SetAPIKey(key string) {
+	p.apiKey = key
+}
+
+// SetHTTPClient replaces the client used for requests.
+func (p *OpenAIProvider) SetHTTPClient(c *http.Client) {
+	p.httpClient = c
+}
+
+// Name identifies the provider and model in result metadata.
+func (p *OpenAIProvider) Name() string {
+	return "openai-compatible:" + p.model
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature float64       `json:"temperature"`
+	Stream      bool          `json:"stream"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Complete sends one non-streaming chat completion at temperature 0 so the same
+// analysis gets the same explanation.
+func (p *OpenAIProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	messages := make([]chatMessage, 0, 2)
+	if req.System != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: req.System})
+	}
+	messages = append(messages, chatMessage{Role: "user", Content: req.Prompt})
+
+	body, err := json.Marshal(chatRequest{
+		Model:     p.model,
+		Messages:  messages,
+		MaxTokens: req.MaxTokens,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding completion request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("building completion request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("calling %s: %w", p.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, llmMaxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("reading completion response: %w", err)
+	}
+
+	var out chatResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("completion request failed: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("decoding completion response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if out.Error != nil && out.Error.Message != "" {
+			return nil, fmt.Errorf("completion request failed: %s: %s", resp.Status, out.Error.Message)
+		}
+		return nil, fmt.Errorf("completion request failed: %s", resp.Status)
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("completion response has no choices")
+	}
+
+	choice := out.Choices[0]
+	return &LLMResponse{
+		Text:             strings.TrimSpace(choice.Message.Content),
+		Model:            out.Model,
+		PromptTokens:     out.Usage.PromptTokens,
+		CompletionTokens: out.Usage.CompletionTokens,
+		Truncated:        choice.FinishReason == "length",
+	}, nil
+}
@@ -0,0 +1,108 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubLLM is an OpenAI-compatible chat completions server that records the last
+// request and answers with reply.
+type stubLLM struct {
+	reply  string
+	status int
+	delay  time.Duration
+	last   chatRequest
+	auth   string
+	calls  int
+}
+
+func (s *stubLLM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.calls++
+	if r.URL.Path != "/v1/chat/completions" {
+		http.NotFound(w, r)
+		return
+	}
+	s.auth = r.Header.Get("Authorization")
+	if err := json.NewDecoder(r.Body).Decode(&s.last); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if s.status != 0 && s.status != http.StatusOK {
+		w.WriteHeader(s.status)
+		w.Write([]byte(`{"error":{"message":"model not loaded"}}`))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"model": s.last.Model,
+		"choices": []map[string]interface{}{
+			{"message": map[string]string{"role": "assistant", "content": s.reply}, "finish_reason": "stop"},
+		},
+		"usage": map[string]int{"prompt_tokens": 120, "completion_tokens": 40},
+	})
+}
+
+func TestOpenAIProvider_Complete(t *testing.T) {
+	stub := &stubLLM{reply: "  EXPLANATION: fine\n"}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	p := NewOpenAIProvider(srv.URL, "llama3")
+	p.SetAPIKey("local-key")
+	resp, err := p.Complete(context.Background(), LLMRequest{System: "sys", Prompt: "hello", MaxTokens: 64})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	if resp.Text != "EXPLANATION: fine" {
+		t.Errorf("Text = %q", resp.Text)
+	}
+	if resp.PromptTokens != 120 || resp.CompletionTokens != 40 || resp.Model != "llama3" {
+		t.Errorf("unexpected usage: %+v", resp)
+	}
+	if stub.auth != "Bearer local-key" {
+		t.Errorf("Authorization = %q", stub.auth)
+	}
+	if stub.last.MaxTokens != 64 || stub.last.Temperature != 0 || stub.last.Stream {
+		t.Errorf("unexpected request options: %+v", stub.last)
+	}
+	if len(stub.last.Messages) != 2 || stub.last.Messages[0].Role != "system" || stub.last.Messages[1].Content != "hello" {
+		t.Errorf("unexpected messages: %+v", stub.last.Messages)
+	}
+}
+
+func TestOpenAIProvider_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		stub    *stubLLM
+		wantErr string
+	}{
+		{"server error", &stubLLM{status: http.StatusServiceUnavailable}, "model not loaded"},
+		{"slow server", &stubLLM{reply: "late", delay: 2 * time.Second}, "deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.stub)
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			_, err := NewOpenAIProvider(srv.URL+"/v1/", "m").Complete(ctx, LLMRequest{Prompt: "x"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -18,8 +18,9 @@ import (
 type MLAgent struct {
 	config           *config.AIConfig
 	goAgent          *GoAgent
+	explainer        *Explainer
 	orchestrator     analyzer_interface.OrchestratorInterface
-	db               *storage.Database
+	db               storage.Store
 	log              *logger.Logger
 	
 	// Real metrics tracking
@@ -43,7 +44,7 @@ type Metrics struct {
 }
 
 // NewMLAgent creates a production MLAgent
-func NewMLAgent(cfg *config.AIConfig, orch analyzer_interface.OrchestratorInterface, db *storage.Database) (*MLAgent, error) {
+func NewMLAgent(cfg *config.AIConfig, orch analyzer_interface.OrchestratorInterface, db storage.Store) (*MLAgent, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("AI config is required")
 	}
@@ -63,6 +64,18 @@ func NewMLAgent(cfg *config.AIConfig, orch analyzer_interface.OrchestratorInterf
 		},
 	}
 
+	if cfg.ModelPath != "" {
+		model, err := LoadURLModel(cfg.ModelPath)
+		if err != nil {
+			agent.log.Warn("URL model not loaded, using heuristics: %v", err)
+		} else {
+			goAgent.SetModel(model)
+			agent.log.Info("Loaded %s URL model (%s) from %s", model.Type, model.FeatureSet, cfg.ModelPath)
+		}
+	}
+
+	agent.explainer = NewExplainerFromConfig(cfg, agent.log)
+
 	agent.log.Info("MLAgent initialized with AI enabled: %v", cfg.EnableAI)
 	return agent, nil
 }
@@ -105,12 +118,15 @@ func (a *MLAgent) AnalyzeLink(ctx context.Context, threatAnalysis *models.Threat
 			a.recordError("orchestrator_analysis", err)
 			// Continue with AI results only
 			a.updateMetrics(false, time.Since(start))
-			return a.enhanceWithOrchestratorData(goAgentResult, nil, threatAnalysis), nil
+			result := a.enhanceWithOrchestratorData(goAgentResult, nil, threatAnalysis)
+			a.explainer.Apply(ctx, threatAnalysis, result)
+			return result, nil
 		}
 	}
 
 	// Step 3: Correlate AI and orchestrator results
 	finalResult := a.correlateResults(goAgentResult, orchResult, threatAnalysis)
+	a.explainer.Apply(ctx, threatAnalysis, finalResult)
 	finalResult.Metadata["total_processing_ms"] = time.Since(start).Milliseconds()
 
 	// Step 4: Store in database
@@ -0,0 +1,224 @@
+package ai
+
+import (
+	"math"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+// URLFeatureSetVersion identifies the layout of URLFeatureNames. Models record the
+// version they were trained on and refuse to load against a different extractor, so
+// any change to the list or to how a feature is computed must bump it.
+const URLFeatureSetVersion = "url-v1"
+
+// URLFeatureNames lists the features produced by ExtractURLFeatures, in order.
+var URLFeatureNames = []string{
+	"url_length_log",
+	"host_length",
+	"path_depth",
+	"special_chars",
+	"digit_ratio",
+	"subdomain_count",
+	"has_ip_host",
+	"has_redirect_param",
+	"has_at_symbol",
+	"is_https",
+	"tld_risk",
+	"entropy",
+	"keyword_matches",
+	"is_punycode",
+	"is_shortened",
+	"domain_age_log",
+	"domain_age_unknown",
+	"tls_valid",
+	"tls_unknown",
+	"is_proxy",
+	"is_hosting",
+	"redirect_hops",
+	"redirect_domains",
+	"client_side_redirect",
+	"has_mx",
+}
+
+var (
+	urlKeywords    = []string{"login", "verify", "account", "secure", "bank", "paypal", "update", "confirm", "signin", "wallet", "password", "billing"}
+	urlShorteners  = []string{"bit.ly", "tinyurl.com", "goo.gl", "ow.ly", "t.co", "is.gd", "buff.ly", "rebrand.ly", "cutt.ly", "shorturl.at"}
+	highRiskTLDs   = []string{"tk", "ml", "ga", "cf", "gq", "xyz", "top", "zip", "mov", "click", "country", "work", "support"}
+	redirectParams = []string{"redirect=", "url=", "goto=", "next=", "dest=", "destination=", "return="}
+)
+
+// ExtractURLFeatures builds the model input for an analysis. Lexical features come
+// from the URL alone; enrichment features (WHOIS, TLS, geo, redirects, DNS) use the
+// analysis when present and fall back to explicit "unknown" indicators otherwise,
+// so a URL scored before enrichment is not mistaken for one with a valid certificate.
+func ExtractURLFeatures(a *models.ThreatAnalysis) []float64 {
+	f := make([]float64, len(URLFeatureNames))
+	rawURL := a.URL
+	lower := strings.ToLower(rawURL)
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		parsed, _ = url.Parse("http://" + rawURL)
+	}
+	host, path := "", ""
+	if parsed != nil {
+		host = strings.ToLower(parsed.Hostname())
+		path = parsed.EscapedPath()
+	}
+
+	f[0] = math.Log1p(float64(len(rawURL)))
+	f[1] = float64(len(host))
+	f[2] = float64(strings.Count(strings.Trim(path, "/"), "/"))
+	if strings.Trim(path, "/") != "" {
+		f[2]++
+	}
+	for _, c := range "@%&=?#~" {
+		f[3] += float64(strings.Count(rawURL, string(c)))
+	}
+	digits := 0
+	for _, c := range rawURL {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	if len(rawURL) > 0 {
+		f[4] = float64(digits) / float64(len(rawURL))
+	}
+
+	isIP := net.ParseIP(host) != nil
+	if !isIP && host != "" {
+		f[5] = float64(max(strings.Count(host, ".")-1, 0))
+	}
+	f[6] = boolFeature(isIP)
+	f[7] = boolFeature(containsAny(lower, redirectParams))
+	f[8] = boolFeature((parsed != nil && parsed.User != nil) || strings.Contains(urlAuthority(rawURL), "@"))
+	f[9] = boolFeature(parsed != nil && parsed.Scheme == "https")
+	f[10] = tldRisk(host)
+	f[11] = shannonEntropy(rawURL)
+	for _, kw := range urlKeywords {
+		if strings.Contains(lower, kw) {
+			f[12]++
+		}
+	}
+	f[13] = boolFeature(strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--"))
+	for _, s := range urlShorteners {
+		if host == s || strings.HasSuffix(host, "."+s) {
+			f[14] = 1
+			break
+		}
+	}
+
+	if age, ok := domainAgeDays(a.WhoisInfo); ok {
+		f[15] = math.Log1p(float64(age))
+	} else {
+		f[16] = 1
+	}
+
+	if a.TLSInfo != nil {
+		f[17] = boolFeature(a.TLSInfo.CertificateValid)
+	} else {
+		f[18] = 1
+	}
+
+	if a.GeoAnalysis != nil {
+		f[19] = boolFeature(a.GeoAnalysis.IsProxy)
+		f[20] = boolFeature(a.GeoAnalysis.HostingType == "Hosting Provider")
+	}
+
+	if n := len(a.RedirectChain); n > 1 {
+		f[21] = float64(n - 1)
+	}
+	domains := make(map[string]bool)
+	for _, hop := range a.RedirectChain {
+		if u, err := url.Parse(hop.URL); err == nil && u.Hostname() != "" {
+			domains[strings.ToLower(u.Hostname())] = true
+		}
+		switch hop.Mechanism {
+		case models.RedirectMetaRefresh, models.RedirectJavaScript, models.RedirectFrame, models.RedirectRefreshHeader:
+			f[23] = 1
+		}
+	}
+	f[22] = float64(len(domains))
+
+	if a.DNSInfo != nil {
+		f[24] = boolFeature(len(a.DNSInfo.MXRecords) > 0)
+	}
+
+	return f
+}
+
+// domainAgeDays reads the domain age from WHOIS data, preferring the computed day
+// count and falling back to the creation date.
+func domainAgeDays(w *models.WhoisAnalysis) (int, bool) {
+	if w == nil {
+		return 0, false
+	}
+	if w.DomainAgeDays > 0 {
+		return w.DomainAgeDays, true
+	}
+	created, err := time.Parse("2006-01-02", w.CreatedDate)
+	if err != nil || created.Year() < 1985 {
+		return 0, false
+	}
+	return int(time.Since(created).Hours() / 24), true
+}
+
+func tldRisk(host string) float64 {
+	for _, tld := range highRiskTLDs {
+		if host == tld || strings.HasSuffix(host, "."+tld) {
+			return 0.9
+		}
+	}
+	return 0.1
+}
+
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// urlAuthority returns the part of a URL between the scheme and the first path
+// separator, where an "@" hides the real host behind fake credentials.
+func urlAuthority(rawURL string) string {
+	rest := rawURL
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func boolFeature(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
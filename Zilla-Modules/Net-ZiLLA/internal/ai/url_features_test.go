@@ -0,0 +1,98 @@
+package ai
+
+import (
+	"testing"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+func featureValue(t *testing.T, f []float64, name string) float64 {
+	t.Helper()
+	for i, n := range URLFeatureNames {
+		if n == name {
+			return f[i]
+		}
+	}
+	t.Fatalf("unknown feature %s", name)
+	return 0
+}
+
+func TestExtractURLFeatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		analysis *models.ThreatAnalysis
+		want     map[string]float64
+	}{
+		{
+			name:     "lexical only",
+			analysis: &models.ThreatAnalysis{URL: "http://192.168.10.5/login/verify.php?redirect=x"},
+			want: map[string]float64{
+				"has_ip_host": 1, "has_redirect_param": 1, "is_https": 0, "path_depth": 2,
+				"keyword_matches": 2, "domain_age_unknown": 1, "tls_unknown": 1, "tls_valid": 0,
+			},
+		},
+		{
+			name:     "credentials before host and punycode",
+			analysis: &models.ThreatAnalysis{URL: "https://paypal.com@xn--pypal-4ve.secure.example.tk/"},
+			want:     map[string]float64{"has_at_symbol": 1, "is_punycode": 1, "tld_risk": 0.9, "subdomain_count": 2, "is_https": 1},
+		},
+		{
+			name:     "shortener",
+			analysis: &models.ThreatAnalysis{URL: "https://bit.ly/3xYz"},
+			want:     map[string]float64{"is_shortened": 1, "subdomain_count": 0},
+		},
+		{
+			name: "enriched",
+			analysis: &models.ThreatAnalysis{
+				URL:         "https://example.com/",
+				WhoisInfo:   &models.WhoisAnalysis{DomainAgeDays: 3},
+				TLSInfo:     &models.TLSAnalysis{CertificateValid: true},
+				GeoAnalysis: &models.GeoAnalysis{IsProxy: true, HostingType: "Hosting Provider"},
+				DNSInfo:     &models.DNSAnalysis{MXRecords: []string{"mx.example.com"}},
+				RedirectChain: []models.RedirectDetail{
+					{URL: "https://example.com/", Mechanism: models.RedirectHTTP},
+					{URL: "https://landing.example.net/", Mechanism: models.RedirectJavaScript},
+					{URL: "https://final.example.org/"},
+				},
+			},
+			want: map[string]float64{
+				"domain_age_unknown": 0, "tls_valid": 1, "tls_unknown": 0, "is_proxy": 1, "is_hosting": 1,
+				"has_mx": 1, "redirect_hops": 2, "redirect_domains": 3, "client_side_redirect": 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := ExtractURLFeatures(tt.analysis)
+			if len(f) != len(URLFeatureNames) {
+				t.Fatalf("got %d features, want %d", len(f), len(URLFeatureNames))
+			}
+			for name, want := range tt.want {
+				if got := featureValue(t, f, name); got != want {
+					t.Errorf("%s = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDomainAgeDays(t *testing.T) {
+	created := time.Now().AddDate(0, 0, -40).Format("2006-01-02")
+	tests := []struct {
+		whois  *models.WhoisAnalysis
+		want   int
+		wantOK bool
+	}{
+		{nil, 0, false},
+		{&models.WhoisAnalysis{DomainAgeDays: 900}, 900, true},
+		{&models.WhoisAnalysis{CreatedDate: created}, 40, true},
+		{&models.WhoisAnalysis{CreatedDate: "0001-01-01", DomainAge: "Unknown"}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := domainAgeDays(tt.whois)
+		if ok != tt.wantOK || (ok && (got < tt.want-1 || got > tt.want+1)) {
+			t.Errorf("domainAgeDays(%+v) = %d, %v; want %d, %v", tt.whois, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// URL model types supported by the inference engine.
+const (
+	ModelLogisticRegression = "logistic_regression"
+	ModelGradientBoosted    = "gbt"
+)
+
+// urlModelFormat tags model files so unrelated JSON is rejected early.
+const urlModelFormat = "netzilla-url-model/1"
+
+// URLModel is a trained URL classifier. It is serialized as a self-describing JSON
+// document: the feature set it expects, the weights or trees, and the Platt scaling
+// that turns raw scores into calibrated probabilities of the URL being malicious.
+type URLModel struct {
+	Format      string             `json:"format"`
+	Type        string             `json:"type"`
+	FeatureSet  string             `json:"feature_set"`
+	Features    []string           `json:"features"`
+	TrainedAt   time.Time          `json:"trained_at"`
+	Threshold   float64            `json:"threshold"` // Probability at or above which a URL is classified malicious
+	Logistic    *LogisticModel     `json:"logistic,omitempty"`
+	Trees       *TreeEnsemble      `json:"trees,omitempty"`
+	Calibration PlattCalibration   `json:"calibration"`
+	Metrics     map[string]float64 `json:"metrics,omitempty"` // Holdout metrics recorded at training time
+}
+
+// LogisticModel holds standardization parameters and weights.
+type LogisticModel struct {
+	Intercept float64   `json:"intercept"`
+	Weights   []float64 `json:"weights"`
+	Mean      []float64 `json:"mean"`
+	Scale     []float64 `json:"scale"`
+}
+
+// TreeEnsemble is a gradient-boosted set of regression trees over log-odds.
+type TreeEnsemble struct {
+	BaseScore    float64    `json:"base_score"`
+	LearningRate float64    `json:"learning_rate"`
+	Trees        []TreeNode `json:"trees"`
+}
+
+// TreeNode is a split when Left/Right are set and a leaf otherwise.
+type TreeNode struct {
+	Feature   int       `json:"feature,omitempty"`
+	Threshold float64   `json:"threshold,omitempty"` // Samples with value <= Threshold go left
+	Left      *TreeNode `json:"left,omitempty"`
+	Right     *TreeNode `json:"right,omitempty"`
+	Value     float64   `json:"value,omitempty"`
+}
+
+// PlattCalibration maps a raw score s to sigmoid(A*s + B).
+type PlattCalibration struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+}
+
+// FeatureContribution is a feature's share of a logistic regression score.
+type FeatureContribution struct {
+	Feature string
+	Value   float64 // Contribution to the log-odds
+}
+
+// LoadURLModel reads and validates a model file.
+func LoadURLModel(path string) (*URLModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model %s: %w", path, err)
+	}
+	m, err := ParseURLModel(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ParseURLModel decodes a model and checks that it matches this build's feature extractor.
+func ParseURLModel(data []byte) (*URLModel, error) {
+	var m URLModel
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid model JSON: %w", err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Save writes the model as indented JSON.
+func (m *URLModel) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode model: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create model directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write model %s: %w", path, err)
+	}
+	return nil
+}
+
+func (m *URLModel) validate() error {
+	if m.Format != urlModelFormat {
+		return fmt.Errorf("unsupported model format %q", m.Format)
+	}
+	if m.FeatureSet != URLFeatureSetVersion {
+		return fmt.Errorf("model was trained on feature set %s, this build extracts %s", m.FeatureSet, URLFeatureSetVersion)
+	}
+	if len(m.Features) != len(URLFeatureNames) {
+		return fmt.Errorf("model expects %d features, extractor produces %d", len(m.Features), len(URLFeatureNames))
+	}
+	for i, name := range m.Features {
+		if name != URLFeatureNames[i] {
+			return fmt.Errorf("feature %d is %q in the model but %q in the extractor", i, name, URLFeatureNames[i])
+		}
+	}
+	if m.Threshold <= 0 || m.Threshold >= 1 {
+		return fmt.Errorf("threshold %v outside (0, 1)", m.Threshold)
+	}
+
+	n := len(m.Features)
+	switch m.Type {
+	case ModelLogisticRegression:
+		lr := m.Logistic
+		if lr == nil || len(lr.Weights) != n || len(lr.Mean) != n || len(lr.Scale) != n {
+			return fmt.Errorf("logistic model needs %d weights, means and scales", n)
+		}
+	case ModelGradientBoosted:
+		if m.Trees == nil || len(m.Trees.Trees) == 0 {
+			return fmt.Errorf("gbt model has no trees")
+		}
+		for i := range m.Trees.Trees {
+			if err := m.Trees.Trees[i].validate(n); err != nil {
+				return fmt.Errorf("tree %d: %w", i, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported model type %q", m.Type)
+	}
+	return nil
+}
+
+func (n *TreeNode) validate(features int) error {
+	if n.Left == nil && n.Right == nil {
+		return nil
+	}
+	if n.Left == nil || n.Right == nil {
+		return fmt.Errorf("split on feature %d is missing a branch", n.Feature)
+	}
+	if n.Feature < 0 || n.Feature >= features {
+		return fmt.Errorf("split on unknown feature %d", n.Feature)
+	}
+	if err := n.Left.validate(features); err != nil {
+		return err
+	}
+	return n.Right.validate(features)
+}
+
+// RawScore returns the uncalibrated log-odds for a feature vector.
+func (m *URLModel) RawScore(features []float64) (float64, error) {
+	if len(features) != len(m.Features) {
+		return 0, fmt.Errorf("got %d features, model expects %d", len(features), len(m.Features))
+	}
+	switch m.Type {
+	case ModelLogisticRegression:
+		score := m.Logistic.Intercept
+		for i, x := range features {
+			score += m.Logistic.Weights[i] * m.Logistic.standardize(i, x)
+		}
+		return score, nil
+	case ModelGradientBoosted:
+		score := m.Trees.BaseScore
+		for i := range m.Trees.Trees {
+			score += m.Trees.LearningRate * m.Trees.Trees[i].predict(features)
+		}
+		return score, nil
+	}
+	return 0, fmt.Errorf("unsupported model type %q", m.Type)
+}
+
+// Predict returns the calibrated probability that the URL is malicious.
+func (m *URLModel) Predict(features []float64) (float64, error) {
+	raw, err := m.RawScore(features)
+	if err != nil {
+		return 0, err
+	}
+	return m.Calibration.Apply(raw), nil
+}
+
+// Contributions ranks features by their contribution to a logistic regression score.
+// Tree ensembles have no per-feature decomposition and return nil.
+func (m *URLModel) Contributions(features []float64) []FeatureContribution {
+	if m.Type != ModelLogisticRegression || len(features) != len(m.Features) {
+		return nil
+	}
+	out := make([]FeatureContribution, 0, len(features))
+	for i, x := range features {
+		if c := m.Logistic.Weights[i] * m.Logistic.standardize(i, x); c != 0 {
+			out = append(out, FeatureContribution{Feature: m.Features[i], Value: c})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return math.Abs(out[i].Value) > math.Abs(out[j].Value) })
+	return out
+}
+
+func (lr *LogisticModel) standardize(i int, x float64) float64 {
+	if lr.Scale[i] == 0 {
+		return 0
+	}
+	return (x - lr.Mean[i]) / lr.Scale[i]
+}
+
+func (n *TreeNode) predict(features []float64) float64 {
+	for n.Left != nil {
+		if features[n.Feature] <= n.Threshold {
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+	return n.Value
+}
+
+// Apply maps a raw score to a probability.
+func (c PlattCalibration) Apply(raw float64) float64 {
+	return sigmoid(c.A*raw + c.B)
+}
+
+func sigmoid(z float64) float64 {
+	if z >= 0 {
+		return 1 / (1 + math.Exp(-z))
+	}
+	e := math.Exp(z)
+	return e / (1 + e)
+}
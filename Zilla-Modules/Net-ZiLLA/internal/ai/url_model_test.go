@@ -0,0 +1,187 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"net-zilla/internal/models"
+)
+
+// syntheticExamples builds a labeled set where phishing URLs share the usual lexical
+// traits, with some label noise so the classes are not perfectly separable.
+func syntheticExamples(n int, seed int64) []TrainingExample {
+	rng := rand.New(rand.NewSource(seed))
+	benign := []func(string, int) string{
+		func(name string, _ int) string { return "https://www." + name + ".com/" },
+		func(name string, _ int) string { return "https://" + name + ".org/about" },
+		func(name string, _ int) string { return "https://docs." + name + ".io/guide/start" },
+		func(name string, i int) string { return fmt.Sprintf("https://%s.com/blog/post-%d", name, i) },
+	}
+	phish := []func(string, int) string{
+		func(name string, i int) string {
+			return fmt.Sprintf("http://%s-secure-login.tk/verify?account=%d", name, i)
+		},
+		func(_ string, i int) string { return fmt.Sprintf("http://192.168.%d.%d/paypal/login.php", i, i/2) },
+		func(name string, i int) string {
+			return fmt.Sprintf("https://%s.xyz/update/confirm?redirect=%d", name, i)
+		},
+		func(name string, _ int) string { return "http://xn--" + name + "-4ve.top/signin" },
+	}
+
+	var out []TrainingExample
+	for i := 0; i < n; i++ {
+		label := i % 2
+		name, num := fmt.Sprintf("site%d", rng.Intn(10000)), rng.Intn(255)
+		var u string
+		if label == 1 {
+			u = phish[rng.Intn(len(phish))](name, num)
+		} else {
+			u = benign[rng.Intn(len(benign))](name, num)
+		}
+		if rng.Float64() < 0.05 {
+			label = 1 - label
+		}
+		out = append(out, TrainingExample{URL: u, Label: label, Features: ExtractURLFeatures(&models.ThreatAnalysis{URL: u})})
+	}
+	return out
+}
+
+func TestTrainURLModel(t *testing.T) {
+	for _, modelType := range []string{ModelLogisticRegression, ModelGradientBoosted} {
+		t.Run(modelType, func(t *testing.T) {
+			opts := DefaultTrainOptions(modelType)
+			if modelType == ModelGradientBoosted {
+				opts.Iterations = 30
+			}
+			m, err := TrainURLModel(syntheticExamples(400, 7), opts)
+			if err != nil {
+				t.Fatalf("TrainURLModel: %v", err)
+			}
+			if auc := m.Metrics["auc"]; auc < 0.9 {
+				t.Errorf("holdout AUC %.3f, want >= 0.9", auc)
+			}
+			if m.Metrics["holdout_examples"] != 80 {
+				t.Errorf("expected 80 holdout examples, got %v", m.Metrics["holdout_examples"])
+			}
+
+			phish := ExtractURLFeatures(&models.ThreatAnalysis{URL: "http://site1-secure-login.tk/verify?account=1"})
+			benign := ExtractURLFeatures(&models.ThreatAnalysis{URL: "https://www.site1.com/"})
+			pPhish, _ := m.Predict(phish)
+			pBenign, _ := m.Predict(benign)
+			if pPhish <= 0.5 || pBenign >= 0.5 {
+				t.Errorf("P(phish)=%.3f P(benign)=%.3f", pPhish, pBenign)
+			}
+
+			// Round trip through the file format.
+			path := filepath.Join(t.TempDir(), "models", "url.json")
+			if err := m.Save(path); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			loaded, err := LoadURLModel(path)
+			if err != nil {
+				t.Fatalf("LoadURLModel: %v", err)
+			}
+			if p, _ := loaded.Predict(phish); math.Abs(p-pPhish) > 1e-12 {
+				t.Errorf("loaded model predicts %.6f, original %.6f", p, pPhish)
+			}
+		})
+	}
+}
+
+func TestTrainURLModel_Errors(t *testing.T) {
+	examples := syntheticExamples(20, 1)
+	for i := range examples {
+		examples[i].Label = 0
+	}
+	if _, err := TrainURLModel(examples, DefaultTrainOptions(ModelLogisticRegression)); err == nil {
+		t.Error("expected error for single-class data")
+	}
+	if _, err := TrainURLModel(syntheticExamples(5, 1), DefaultTrainOptions(ModelLogisticRegression)); err == nil {
+		t.Error("expected error for too few examples")
+	}
+	if _, err := TrainURLModel(syntheticExamples(50, 1), DefaultTrainOptions("svm")); err == nil {
+		t.Error("expected error for unknown model type")
+	}
+}
+
+func TestParseURLModel_Validation(t *testing.T) {
+	m, err := TrainURLModel(syntheticExamples(60, 3), DefaultTrainOptions(ModelLogisticRegression))
+	if err != nil {
+		t.Fatalf("TrainURLModel: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*URLModel)
+	}{
+		{"other feature set", func(m *URLModel) { m.FeatureSet = "url-v0" }},
+		{"renamed feature", func(m *URLModel) { m.Features[0] = "length" }},
+		{"missing weights", func(m *URLModel) { m.Logistic.Weights = m.Logistic.Weights[:3] }},
+		{"bad threshold", func(m *URLModel) { m.Threshold = 1 }},
+		{"bad format", func(m *URLModel) { m.Format = "onnx" }},
+		{"broken tree", func(m *URLModel) {
+			m.Type = ModelGradientBoosted
+			m.Trees = &TreeEnsemble{Trees: []TreeNode{{Feature: 99, Left: &TreeNode{}, Right: &TreeNode{}}}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "m.json")
+			if err := m.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			clone, _ := LoadURLModel(path)
+			tt.mutate(clone)
+			if err := clone.validate(); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestLoadLabeledURLs(t *testing.T) {
+	src := "url,label\nhttps://good.example/,benign\n# comment\nhttp://bad.example/login, phishing\nhttp://x.example/,1\n"
+	examples, err := LoadLabeledURLs(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("LoadLabeledURLs: %v", err)
+	}
+	if len(examples) != 3 || examples[0].Label != 0 || examples[1].Label != 1 || examples[2].Label != 1 {
+		t.Errorf("unexpected examples %+v", examples)
+	}
+
+	if _, err := LoadLabeledURLs(strings.NewReader("https://a.example/,maybe\n")); err == nil {
+		t.Error("expected error for unknown label")
+	}
+}
+
+func TestFitPlatt(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	var scores, labels []float64
+	for i := 0; i < 5000; i++ {
+		s := rng.NormFloat64() * 2
+		scores = append(scores, s)
+		label := 0.0
+		if rng.Float64() < sigmoid(1.5*s-0.5) {
+			label = 1
+		}
+		labels = append(labels, label)
+	}
+	c := fitPlatt(scores, labels)
+	if math.Abs(c.A-1.5) > 0.15 || math.Abs(c.B+0.5) > 0.15 {
+		t.Errorf("fitPlatt = %+v, want A≈1.5 B≈-0.5", c)
+	}
+}
+
+func TestClassificationMetrics(t *testing.T) {
+	m := ClassificationMetrics([]float64{0.9, 0.8, 0.3, 0.2, 0.6}, []int{1, 1, 0, 0, 0}, 0.5)
+	if m["accuracy"] != 0.8 || m["precision"] != 2.0/3 || m["recall"] != 1 || m["auc"] != 1 {
+		t.Errorf("unexpected metrics %v", m)
+	}
+	if auc := ROCAUC([]float64{0.5, 0.5}, []int{1, 0}); auc != 0.5 {
+		t.Errorf("tied scores AUC = %v, want 0.5", auc)
+	}
+}
@@ -0,0 +1,506 @@
+package ai
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+	"net-zilla/internal/storage"
+)
+
+// TrainingExample is one labeled URL and, once attached, its feature vector.
+type TrainingExample struct {
+	URL      string
+	Label    int // 1 malicious, 0 benign
+	Features []float64
+	Enriched bool // Features came from a stored analysis rather than the URL alone
+}
+
+// TrainOptions controls model training.
+type TrainOptions struct {
+	Type            string  // ModelLogisticRegression or ModelGradientBoosted
+	Iterations      int     // Gradient descent epochs, or number of trees
+	LearningRate    float64 // Step size, or shrinkage for trees
+	L2              float64 // Logistic regression weight penalty / tree leaf regularization
+	MaxDepth        int     // Tree depth
+	MinLeaf         int     // Minimum samples per tree leaf
+	HoldoutFraction float64 // Share of examples kept back for calibration and metrics
+	Seed            int64
+}
+
+// DefaultTrainOptions returns settings that work for a few hundred to a few hundred
+// thousand examples.
+func DefaultTrainOptions(modelType string) TrainOptions {
+	opts := TrainOptions{
+		Type:            modelType,
+		Iterations:      500,
+		LearningRate:    0.1,
+		L2:              0.001,
+		HoldoutFraction: 0.2,
+		Seed:            1,
+	}
+	if modelType == ModelGradientBoosted {
+		opts.Iterations = 100
+		opts.L2 = 1
+		opts.MaxDepth = 3
+		opts.MinLeaf = 5
+	}
+	return opts
+}
+
+// LoadLabeledURLs reads a "url,label" CSV. A header row is optional; labels may be
+// 1/0, true/false or words such as malicious/phishing/bad and benign/legitimate/good.
+func LoadLabeledURLs(r io.Reader) ([]TrainingExample, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	var examples []TrainingExample
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected url,label", line)
+		}
+		rawURL := strings.TrimSpace(record[0])
+		label, ok := parseLabel(record[1])
+		if !ok {
+			if line == 1 && strings.EqualFold(rawURL, "url") {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: unknown label %q", line, record[1])
+		}
+		if rawURL == "" {
+			return nil, fmt.Errorf("line %d: empty url", line)
+		}
+		examples = append(examples, TrainingExample{URL: rawURL, Label: label})
+	}
+	return examples, nil
+}
+
+func parseLabel(s string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "malicious", "phishing", "malware", "bad", "unsafe":
+		return 1, true
+	case "0", "false", "benign", "legitimate", "safe", "good":
+		return 0, true
+	}
+	return 0, false
+}
+
+// AttachFeatures extracts features for every example, using the most recent stored
+// analysis of the URL when db has one so WHOIS, TLS and geo features are populated.
+func AttachFeatures(ctx context.Context, examples []TrainingExample, db storage.Store) error {
+	for i := range examples {
+		analysis := &models.ThreatAnalysis{URL: examples[i].URL}
+		if db != nil {
+			stored, err := db.GetLatestAnalysisByURL(ctx, examples[i].URL)
+			switch {
+			case err == nil:
+				analysis, examples[i].Enriched = stored, true
+			case !errors.Is(err, storage.ErrNotFound):
+				return fmt.Errorf("failed to load stored analysis for %s: %w", examples[i].URL, err)
+			}
+		}
+		examples[i].Features = ExtractURLFeatures(analysis)
+	}
+	return nil
+}
+
+// TrainURLModel fits a model, calibrates it on a holdout split and records holdout
+// metrics in the returned model.
+func TrainURLModel(examples []TrainingExample, opts TrainOptions) (*URLModel, error) {
+	if len(examples) < 10 {
+		return nil, fmt.Errorf("need at least 10 labeled examples, got %d", len(examples))
+	}
+	positives := 0
+	for _, ex := range examples {
+		if len(ex.Features) != len(URLFeatureNames) {
+			return nil, fmt.Errorf("example %s has %d features, expected %d", ex.URL, len(ex.Features), len(URLFeatureNames))
+		}
+		positives += ex.Label
+	}
+	if positives == 0 || positives == len(examples) {
+		return nil, fmt.Errorf("training data needs both malicious and benign examples")
+	}
+
+	train, holdout := splitExamples(examples, opts.HoldoutFraction, opts.Seed)
+	X, y := matrix(train)
+
+	m := &URLModel{
+		Format:     urlModelFormat,
+		Type:       opts.Type,
+		FeatureSet: URLFeatureSetVersion,
+		Features:   append([]string(nil), URLFeatureNames...),
+		TrainedAt:  time.Now().UTC(),
+		Threshold:  0.5,
+		Metrics:    make(map[string]float64),
+	}
+	switch opts.Type {
+	case ModelLogisticRegression:
+		m.Logistic = trainLogistic(X, y, opts)
+	case ModelGradientBoosted:
+		m.Trees = trainTrees(X, y, opts)
+	default:
+		return nil, fmt.Errorf("unsupported model type %q", opts.Type)
+	}
+
+	// Calibrate on data the model has not seen; with too small a holdout fall back to
+	// the training scores, which leaves the model somewhat overconfident.
+	calib := holdout
+	if !hasBothClasses(calib) {
+		calib = train
+	}
+	scores, labels := rawScores(m, calib)
+	m.Calibration = fitPlatt(scores, labels)
+
+	eval := holdout
+	if len(eval) == 0 {
+		eval = train
+	}
+	probs := make([]float64, len(eval))
+	evalLabels := make([]int, len(eval))
+	for i, ex := range eval {
+		probs[i], _ = m.Predict(ex.Features)
+		evalLabels[i] = ex.Label
+	}
+	for k, v := range ClassificationMetrics(probs, evalLabels, m.Threshold) {
+		m.Metrics[k] = v
+	}
+	m.Metrics["train_examples"] = float64(len(train))
+	m.Metrics["holdout_examples"] = float64(len(holdout))
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// splitExamples shuffles deterministically and keeps the class balance in both halves.
+func splitExamples(examples []TrainingExample, fraction float64, seed int64) (train, holdout []TrainingExample) {
+	rng := rand.New(rand.NewSource(seed))
+	byClass := [2][]TrainingExample{}
+	for _, ex := range examples {
+		byClass[ex.Label] = append(byClass[ex.Label], ex)
+	}
+	for _, class := range byClass {
+		rng.Shuffle(len(class), func(i, j int) { class[i], class[j] = class[j], class[i] })
+		n := int(math.Round(float64(len(class)) * fraction))
+		holdout = append(holdout, class[:n]...)
+		train = append(train, class[n:]...)
+	}
+	rng.Shuffle(len(train), func(i, j int) { train[i], train[j] = train[j], train[i] })
+	return train, holdout
+}
+
+func hasBothClasses(examples []TrainingExample) bool {
+	seen := [2]bool{}
+	for _, ex := range examples {
+		seen[ex.Label] = true
+	}
+	return seen[0] && seen[1]
+}
+
+func matrix(examples []TrainingExample) ([][]float64, []float64) {
+	X := make([][]float64, len(examples))
+	y := make([]float64, len(examples))
+	for i, ex := range examples {
+		X[i] = ex.Features
+		y[i] = float64(ex.Label)
+	}
+	return X, y
+}
+
+func rawScores(m *URLModel, examples []TrainingExample) ([]float64, []float64) {
+	scores := make([]float64, len(examples))
+	labels := make([]float64, len(examples))
+	for i, ex := range examples {
+		scores[i], _ = m.RawScore(ex.Features)
+		labels[i] = float64(ex.Label)
+	}
+	return scores, labels
+}
+
+// trainLogistic runs full-batch gradient descent on standardized features.
+func trainLogistic(X [][]float64, y []float64, opts TrainOptions) *LogisticModel {
+	n, d := len(X), len(X[0])
+	lr := &LogisticModel{Weights: make([]float64, d), Mean: make([]float64, d), Scale: make([]float64, d)}
+
+	for j := 0; j < d; j++ {
+		for i := range X {
+			lr.Mean[j] += X[i][j]
+		}
+		lr.Mean[j] /= float64(n)
+		for i := range X {
+			diff := X[i][j] - lr.Mean[j]
+			lr.Scale[j] += diff * diff
+		}
+		lr.Scale[j] = math.Sqrt(lr.Scale[j] / float64(n))
+	}
+
+	Z := make([][]float64, n)
+	for i := range X {
+		Z[i] = make([]float64, d)
+		for j := range X[i] {
+			Z[i][j] = lr.standardize(j, X[i][j])
+		}
+	}
+
+	grad := make([]float64, d)
+	for epoch := 0; epoch < opts.Iterations; epoch++ {
+		for j := range grad {
+			grad[j] = opts.L2 * lr.Weights[j]
+		}
+		gradIntercept := 0.0
+		for i := range Z {
+			z := lr.Intercept
+			for j, v := range Z[i] {
+				z += lr.Weights[j] * v
+			}
+			residual := sigmoid(z) - y[i]
+			gradIntercept += residual / float64(n)
+			for j, v := range Z[i] {
+				grad[j] += residual * v / float64(n)
+			}
+		}
+		lr.Intercept -= opts.LearningRate * gradIntercept
+		for j := range lr.Weights {
+			lr.Weights[j] -= opts.LearningRate * grad[j]
+		}
+	}
+	return lr
+}
+
+// trainTrees fits gradient-boosted regression trees on the logistic loss using
+// second-order (Newton) leaf values.
+func trainTrees(X [][]float64, y []float64, opts TrainOptions) *TreeEnsemble {
+	n := len(X)
+	mean := 0.0
+	for _, v := range y {
+		mean += v
+	}
+	mean /= float64(n)
+	ens := &TreeEnsemble{BaseScore: math.Log(mean / (1 - mean)), LearningRate: opts.LearningRate}
+
+	scores := make([]float64, n)
+	for i := range scores {
+		scores[i] = ens.BaseScore
+	}
+	grad := make([]float64, n)
+	hess := make([]float64, n)
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+
+	b := treeBuilder{X: X, grad: grad, hess: hess, opts: opts}
+	for t := 0; t < opts.Iterations; t++ {
+		for i := range scores {
+			p := sigmoid(scores[i])
+			grad[i] = y[i] - p
+			hess[i] = math.Max(p*(1-p), 1e-6)
+		}
+		tree := b.build(all, 0)
+		for i := range scores {
+			scores[i] += ens.LearningRate * tree.predict(X[i])
+		}
+		ens.Trees = append(ens.Trees, *tree)
+	}
+	return ens
+}
+
+type treeBuilder struct {
+	X    [][]float64
+	grad []float64
+	hess []float64
+	opts TrainOptions
+}
+
+func (b *treeBuilder) build(rows []int, depth int) *TreeNode {
+	G, H := 0.0, 0.0
+	for _, i := range rows {
+		G += b.grad[i]
+		H += b.hess[i]
+	}
+	leaf := &TreeNode{Value: G / (H + b.opts.L2)}
+	if depth >= b.opts.MaxDepth || len(rows) < 2*max(b.opts.MinLeaf, 1) {
+		return leaf
+	}
+
+	parentGain := G * G / (H + b.opts.L2)
+	bestGain, bestFeature, bestThreshold := 1e-9, -1, 0.0
+	sorted := make([]int, len(rows))
+	for f := range b.X[0] {
+		copy(sorted, rows)
+		sort.Slice(sorted, func(i, j int) bool { return b.X[sorted[i]][f] < b.X[sorted[j]][f] })
+
+		GL, HL := 0.0, 0.0
+		for k := 0; k < len(sorted)-1; k++ {
+			i := sorted[k]
+			GL += b.grad[i]
+			HL += b.hess[i]
+			left := k + 1
+			if left < b.opts.MinLeaf || len(sorted)-left < b.opts.MinLeaf {
+				continue
+			}
+			v, next := b.X[i][f], b.X[sorted[k+1]][f]
+			if v == next {
+				continue
+			}
+			GR, HR := G-GL, H-HL
+			gain := GL*GL/(HL+b.opts.L2) + GR*GR/(HR+b.opts.L2) - parentGain
+			if gain > bestGain {
+				bestGain, bestFeature, bestThreshold = gain, f, (v+next)/2
+			}
+		}
+	}
+	if bestFeature < 0 {
+		return leaf
+	}
+
+	var left, right []int
+	for _, i := range rows {
+		if b.X[i][bestFeature] <= bestThreshold {
+			left = append(left, i)
+		} else {
+			right = append(right, i)
+		}
+	}
+	return &TreeNode{
+		Feature:   bestFeature,
+		Threshold: bestThreshold,
+		Left:      b.build(left, depth+1),
+		Right:     b.build(right, depth+1),
+	}
+}
+
+// fitPlatt fits sigmoid(A*s + B) to the labels by Newton's method, using Platt's
+// smoothed targets so a perfectly separated holdout does not push A to infinity.
+func fitPlatt(scores, labels []float64) PlattCalibration {
+	pos := 0.0
+	for _, l := range labels {
+		pos += l
+	}
+	neg := float64(len(labels)) - pos
+	hi, lo := (pos+1)/(pos+2), 1/(neg+2)
+
+	a, b := 1.0, 0.0
+	for iter := 0; iter < 100; iter++ {
+		var ga, gb, haa, hab, hbb float64
+		for i, s := range scores {
+			t := lo
+			if labels[i] > 0.5 {
+				t = hi
+			}
+			p := sigmoid(a*s + b)
+			d := p - t
+			w := math.Max(p*(1-p), 1e-12)
+			ga += d * s
+			gb += d
+			haa += w * s * s
+			hab += w * s
+			hbb += w
+		}
+		haa += 1e-9
+		hbb += 1e-9
+		det := haa*hbb - hab*hab
+		if det <= 0 {
+			break
+		}
+		da := (hbb*ga - hab*gb) / det
+		db := (haa*gb - hab*ga) / det
+		a -= da
+		b -= db
+		if math.Abs(da) < 1e-9 && math.Abs(db) < 1e-9 {
+			break
+		}
+	}
+	return PlattCalibration{A: a, B: b}
+}
+
+// ClassificationMetrics summarizes probabilistic predictions against labels.
+func ClassificationMetrics(probs []float64, labels []int, threshold float64) map[string]float64 {
+	var tp, fp, tn, fn, logLoss, brier float64
+	for i, p := range probs {
+		y := float64(labels[i])
+		predicted := p >= threshold
+		switch {
+		case predicted && labels[i] == 1:
+			tp++
+		case predicted:
+			fp++
+		case labels[i] == 1:
+			fn++
+		default:
+			tn++
+		}
+		clipped := math.Min(math.Max(p, 1e-15), 1-1e-15)
+		logLoss -= y*math.Log(clipped) + (1-y)*math.Log(1-clipped)
+		brier += (p - y) * (p - y)
+	}
+	n := float64(len(probs))
+	metrics := map[string]float64{
+		"accuracy":  safeDiv(tp+tn, n),
+		"precision": safeDiv(tp, tp+fp),
+		"recall":    safeDiv(tp, tp+fn),
+		"fpr":       safeDiv(fp, fp+tn),
+		"log_loss":  safeDiv(logLoss, n),
+		"brier":     safeDiv(brier, n),
+		"auc":       ROCAUC(probs, labels),
+	}
+	metrics["f1"] = safeDiv(2*metrics["precision"]*metrics["recall"], metrics["precision"]+metrics["recall"])
+	return metrics
+}
+
+// ROCAUC computes the area under the ROC curve from rank statistics, averaging ties.
+// It returns 0 when either class is absent.
+func ROCAUC(probs []float64, labels []int) float64 {
+	idx := make([]int, len(probs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return probs[idx[i]] < probs[idx[j]] })
+
+	var pos, neg, rankSum float64
+	for k := 0; k < len(idx); {
+		end := k
+		for end+1 < len(idx) && probs[idx[end+1]] == probs[idx[k]] {
+			end++
+		}
+		avgRank := float64(k+end)/2 + 1
+		for m := k; m <= end; m++ {
+			if labels[idx[m]] == 1 {
+				pos++
+				rankSum += avgRank
+			} else {
+				neg++
+			}
+		}
+		k = end + 1
+	}
+	if pos == 0 || neg == 0 {
+		return 0
+	}
+	return (rankSum - pos*(pos+1)/2) / (pos * neg)
+}
+
+func safeDiv(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
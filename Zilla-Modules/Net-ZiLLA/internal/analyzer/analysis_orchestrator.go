@@ -2,7 +2,11 @@ package analyzer
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"math"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,19 +25,50 @@ type AnalysisOrchestrator struct {
 	screener   *network.SafetyScreener
 	intel      *threat_intel.IntelManager
 	matcher    *patterns.PatternMatcher
+	threat     *ThreatAnalyzer
 	correlator *correlation.EventCorrelator
 	sandbox    *threat_intel.SandboxManager
+	ingestor   *threat_intel.SandboxIngestor
+
+	sandboxes sync.WaitGroup // Sandbox runs outliving the analyses that started them
+	mu        sync.Mutex
+	onSandbox func(SandboxUpdate)
+}
+
+// SandboxUpdate is the outcome of a sandbox run. Runs are not bound by the
+// analysis timeout, so it arrives after the report that escalated to it.
+type SandboxUpdate struct {
+	ReportID string
+	Target   string
+	Run      *threat_intel.SandboxRun // nil when the sandbox did not start
+	Result   *models.SandboxResult    // nil when the artifacts were not ingested
+	Findings []string
+	Err      error
 }
 
 func NewAnalysisOrchestrator(l *logger.Logger, cfg *config.Config) *AnalysisOrchestrator {
-	return &AnalysisOrchestrator{
+	ao := &AnalysisOrchestrator{
 		logger:     l,
 		screener:   network.NewSafetyScreener(),
 		intel:      threat_intel.NewIntelManager("", "", ""), // Keys would come from cfg in real prod
 		matcher:    patterns.NewPatternMatcher(),
+		threat:     NewThreatAnalyzer(nil, l, nil), // Reports are saved by the caller
 		correlator: correlation.NewEventCorrelator(),
-		sandbox:    threat_intel.NewSandboxManager(),
+		sandbox:    threat_intel.NewSandboxManager(l),
+		ingestor:   threat_intel.NewSandboxIngestor(l),
+	}
+	if cfg != nil {
+		ao.sandbox.Configure(cfg.Sandbox)
+	}
+	if err := ao.threat.Configure(cfg); err != nil {
+		l.Error("Network configuration not fully applied: %v", err)
 	}
+	if cfg != nil && cfg.Analysis != nil && cfg.Analysis.CorrelationRules != "" {
+		if err := ao.correlator.LoadRules(cfg.Analysis.CorrelationRules); err != nil {
+			l.Warn("Failed to load correlation rules: %v", err)
+		}
+	}
+	return ao
 }
 
 // Orchestrate runs the multi-stage analysis pipeline concurrently.
@@ -45,92 +80,333 @@ func (ao *AnalysisOrchestrator) Orchestrate(ctx context.Context, target string)
 	ao.logger.Info("Initializing orchestration for: %s", target)
 
 	report := &models.AdvancedReport{
-		ReportID:  fmt.Sprintf("NZ-%d", time.Now().Unix()),
+		ReportID:  NewReportID(),
 		Target:    target,
 		Timestamp: time.Now(),
 		Metadata:  make(map[string]interface{}),
 	}
 
 	// STAGE 1: Safety Screening (Synchronous as it is fast and foundational)
+	ReportProgress(ctx, StageScreening, StageRunning)
 	screening := ao.screener.Screen(target)
 	report.Metadata["screening_risk_score"] = fmt.Sprintf("%d", screening.RiskScore)
+	ReportProgress(ctx, StageScreening, StageDone)
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+	// The concurrent stages hand their results back rather than writing the
+	// report themselves, so a stage still running when the budget runs out
+	// cannot touch the report after it is returned.
+	results := make(chan stageResult, 3)
+	pending := map[string]bool{StageIntel: true, StagePatterns: true, StageInfrastructure: true}
 
 	// STAGE 2: Passive Intelligence (Concurrent)
 	go func() {
-		defer wg.Done()
+		ReportProgress(ctx, StageIntel, StageRunning)
 		intelResult := ao.intel.MultiCheck(ctx, target)
-		report.ThreatIntelligence = &models.IOCRegistry{
-			TotalFound: intelResult.Positives,
-		}
-		if intelResult.Malicious {
-			report.Metadata["intel_malicious"] = "true"
-		}
+		results <- stageResult{stage: StageIntel, apply: func(r *models.AdvancedReport) {
+			r.ThreatIntelligence = &models.IOCRegistry{
+				TotalFound: intelResult.Positives,
+			}
+			if intelResult.Malicious {
+				r.Metadata["intel_malicious"] = "true"
+			}
+		}}
 	}()
 
 	// STAGE 3: Behavioral Pattern Matching (Concurrent)
 	go func() {
-		defer wg.Done()
+		ReportProgress(ctx, StagePatterns, StageRunning)
 		behavior := ao.matcher.AnalyzeContent(target)
-		report.BehavioralAnalysis = behavior
+		results <- stageResult{stage: StagePatterns, apply: func(r *models.AdvancedReport) {
+			r.BehavioralAnalysis = behavior
+		}}
 	}()
 
-	// Wait for concurrent stages with timeout protection
-	done := make(chan struct{})
+	// STAGE 3b: Infrastructure (DNS, WHOIS, TLS, geolocation, redirects; Concurrent)
 	go func() {
-		wg.Wait()
-		close(done)
+		ReportProgress(ctx, StageInfrastructure, StageRunning)
+		analysis, err := ao.threat.ComprehensiveAnalysis(ctx, target)
+		if err != nil {
+			results <- stageResult{stage: StageInfrastructure, err: err}
+			return
+		}
+		results <- stageResult{stage: StageInfrastructure, apply: func(r *models.AdvancedReport) {
+			r.BasicAnalysis = analysis
+		}}
 	}()
 
-	select {
-	case <-done:
-		// All concurrent stages finished
-	case <-ctx.Done():
-		return nil, fmt.Errorf("orchestration timed out: %w", ctx.Err())
+	// Collect the stages until they finish or the budget runs out. A stage
+	// that has not finished by then is marked failed and the report is scored
+	// on what the others found.
+collect:
+	for len(pending) > 0 {
+		select {
+		case res := <-results:
+			delete(pending, res.stage)
+			if res.err != nil {
+				ao.logger.Warn("Stage %s failed: %v", res.stage, res.err)
+				ReportProgress(ctx, res.stage, StageFailed)
+				continue
+			}
+			res.apply(report)
+			ReportProgress(ctx, res.stage, StageDone)
+		case <-ctx.Done():
+			break collect
+		}
+	}
+	if len(pending) > 0 {
+		var timedOut []string
+		for _, stage := range Stages {
+			if pending[stage] {
+				timedOut = append(timedOut, stage)
+				ReportProgress(ctx, stage, StageFailed)
+			}
+		}
+		ao.logger.Warn("Orchestration timed out, stages not finished: %s", strings.Join(timedOut, ", "))
+		report.Metadata["timed_out_stages"] = strings.Join(timedOut, ",")
 	}
 
 	// STAGE 4: Risk-Based Escalation (Sandbox)
-	// Only escalate if initial findings are highly suspicious
-	if screening.RiskScore > 60 || (report.ThreatIntelligence != nil && report.ThreatIntelligence.TotalFound > 0) {
-		ao.logger.Info("Risk threshold exceeded. Escalating to isolated sandbox...")
-		containerID, err := ao.sandbox.SpinUpIsolatedBrowser(ctx, target)
-		if err == nil {
-			report.Metadata["sandbox_escalated"] = "true"
-			report.Metadata["sandbox_container_id"] = containerID
-			// In production, we'd have a cleanup worker, but for now we defer
-			defer ao.sandbox.DestroySandbox(containerID)
-		}
+	// Only escalate if initial findings are highly suspicious. The run is only
+	// queued here; the caller starts it with Escalate once the report is stored.
+	if ao.sandbox.Enabled() && (screening.RiskScore > 60 || (report.ThreatIntelligence != nil && report.ThreatIntelligence.TotalFound > 0)) {
+		ao.logger.Info("Risk threshold exceeded. Queueing isolated sandbox...")
+		report.Metadata["sandbox_escalated"] = "true"
+		report.Metadata["sandbox_status"] = "pending"
+		ReportProgress(ctx, StageSandbox, StageDeferred)
+	} else {
+		ReportProgress(ctx, StageSandbox, StageSkipped)
 	}
 
 	// STAGE 5: Correlation
+	ReportProgress(ctx, StageCorrelation, StageRunning)
 	ao.correlator.Correlate(report)
+	ReportProgress(ctx, StageCorrelation, StageDone)
 
 	// STAGE 6: Final Risk Assessment
+	ReportProgress(ctx, StageScoring, StageRunning)
 	report.RiskAssessment = &models.RiskAssessment{
 		RiskScore:        ao.calculateFinalScore(screening, report),
 		OverallRiskLevel: ao.calculateRiskLevelFromScore(ao.calculateFinalScore(screening, report)),
+		Metrics:          ao.scoreMetrics(screening, report),
 		Summary:          "Analysis completed through concurrent production pipeline.",
 	}
+	if stages, ok := report.Metadata["timed_out_stages"].(string); ok {
+		report.RiskAssessment.Summary = fmt.Sprintf("Analysis timed out before %s finished; scored on partial results.", strings.ReplaceAll(stages, ",", ", "))
+	}
+	ReportProgress(ctx, StageScoring, StageDone)
 
 	return report, nil
 }
 
+// stageResult is what a concurrent stage of Orchestrate hands back: either a
+// function recording its findings in the report, or the error it failed with.
+type stageResult struct {
+	stage string
+	apply func(*models.AdvancedReport)
+	err   error
+}
+
+// NewReportID returns a report ID that starts with its creation time and ends
+// in 64 random bits, so analyses started in the same second get distinct IDs.
+func NewReportID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("NZ-%d-%s", time.Now().Unix(), hex.EncodeToString(b))
+}
+
+// UseCassette routes the network lookups of the infrastructure stage through
+// c; see ThreatAnalyzer.UseCassette.
+func (ao *AnalysisOrchestrator) UseCassette(c *network.Cassette) {
+	ao.threat.UseCassette(c)
+}
+
+// Cassette returns the cassette the infrastructure stage records to or replays
+// from, or nil when lookups are live.
+func (ao *AnalysisOrchestrator) Cassette() *network.Cassette {
+	return ao.threat.Cassette()
+}
+
+// Traceroute traces the route to the host of target with the mode, hop and
+// probe limits of the network config.
+func (ao *AnalysisOrchestrator) Traceroute(ctx context.Context, target string) (*models.NetworkAnalysis, error) {
+	return ao.threat.PerformTraceroute(ctx, target)
+}
+
+// OnSandboxComplete sets the function that receives the outcome of every
+// sandbox run. It is called from the run's goroutine.
+func (ao *AnalysisOrchestrator) OnSandboxComplete(fn func(SandboxUpdate)) {
+	ao.mu.Lock()
+	ao.onSandbox = fn
+	ao.mu.Unlock()
+}
+
+// Close waits for running sandboxes, each bounded by the sandbox budget, then
+// cancels running infrastructure analyses and writes a recorded cassette.
+func (ao *AnalysisOrchestrator) Close() {
+	ao.sandboxes.Wait()
+	ao.threat.Cleanup()
+}
+
+// Escalate starts the sandbox run Orchestrate queued for report and reports
+// whether there was one. The run goes on in the background under the sandbox
+// budget rather than the analysis timeout, and its outcome is handed to the
+// OnSandboxComplete callback, so call Escalate once the report is stored.
+func (ao *AnalysisOrchestrator) Escalate(report *models.AdvancedReport) bool {
+	if report == nil || report.Metadata["sandbox_status"] != "pending" {
+		return false
+	}
+	reportID, target := report.ReportID, report.Target
+
+	ao.sandboxes.Add(1)
+	go func() {
+		defer ao.sandboxes.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), ao.sandbox.Budget())
+		defer cancel()
+
+		u := SandboxUpdate{ReportID: reportID, Target: target}
+		u.Run, u.Err = ao.sandbox.Run(ctx, target)
+		if u.Err != nil {
+			ao.logger.Warn("Sandbox run for %s failed: %v", reportID, u.Err)
+		}
+		if u.Run != nil {
+			u.Result, u.Findings = ao.ingestSandbox(u.Run)
+		}
+
+		ao.mu.Lock()
+		fn := ao.onSandbox
+		ao.mu.Unlock()
+		if fn != nil {
+			fn(u)
+		}
+	}()
+	return true
+}
+
+// ingestSandbox reads what the sandbox observed and raises a finding for every
+// download MalwareAnalyzer considers dangerous.
+func (ao *AnalysisOrchestrator) ingestSandbox(run *threat_intel.SandboxRun) (*models.SandboxResult, []string) {
+	result, err := ao.ingestor.IngestRun(run)
+	if err != nil {
+		ao.logger.Warn("Sandbox artifacts not ingested: %v", err)
+		return nil, nil
+	}
+	var findings []string
+	for _, d := range result.Downloads {
+		if d.Analysis != nil && d.Analysis.RiskScore >= 50 {
+			findings = append(findings, fmt.Sprintf("Sandbox download %s rated %s by malware analysis", d.Name, d.Analysis.Severity))
+		}
+	}
+	return result, findings
+}
+
+// Apply records the update in report, the stored copy of the report that
+// escalated to the sandbox.
+func (u SandboxUpdate) Apply(report *models.AdvancedReport) {
+	if report.Metadata == nil {
+		report.Metadata = make(map[string]interface{})
+	}
+	report.Metadata["sandbox_status"] = "done"
+	if u.Err != nil {
+		report.Metadata["sandbox_status"] = "failed"
+		report.Metadata["sandbox_error"] = u.Err.Error()
+	}
+	if run := u.Run; run != nil {
+		report.Metadata["sandbox_container_id"] = run.ContainerID
+		report.Metadata["sandbox_artifact_dir"] = run.ArtifactDir
+		report.Metadata["sandbox_artifacts"] = fmt.Sprintf("%d", len(run.Artifacts))
+		if run.TimedOut {
+			report.Metadata["sandbox_timed_out"] = "true"
+		}
+	}
+	if u.Result != nil {
+		report.Sandbox = u.Result
+	}
+	report.Findings = append(report.Findings, u.Findings...)
+}
+
+// Points added to the screening score, out of 100, when intelligence sources
+// flag the target and when behavioral patterns match, and the most a spoofable
+// email policy on the target's domain can add.
+const (
+	intelPoints       = 30
+	patternPoints     = 20
+	emailPolicyPoints = 20
+)
+
 func (ao *AnalysisOrchestrator) calculateFinalScore(s network.ScreeningResult, r *models.AdvancedReport) float64 {
 	base := float64(s.RiskScore)
 	if r.ThreatIntelligence != nil && r.ThreatIntelligence.TotalFound > 0 {
-		base += 30
+		base += intelPoints
 	}
 	if r.BehavioralAnalysis != nil && len(r.BehavioralAnalysis.Patterns) > 0 {
-		base += 20
+		base += patternPoints
 	}
+	base += float64(emailPoints(r))
+	base += float64(insightPoints(r))
 	if base > 100 {
 		base = 100
 	}
 	return base / 100.0
 }
 
+// scoreMetrics breaks the final score down by what contributed to it, on the
+// 0-10 scale of RiskMetric.
+func (ao *AnalysisOrchestrator) scoreMetrics(s network.ScreeningResult, r *models.AdvancedReport) []models.RiskMetric {
+	metrics := []models.RiskMetric{{
+		Vector: "screening",
+		Value:  int(math.Round(float64(s.RiskScore) / 10)),
+		Impact: fmt.Sprintf("%d points from URL and host screening", s.RiskScore),
+	}}
+	if r.ThreatIntelligence != nil && r.ThreatIntelligence.TotalFound > 0 {
+		metrics = append(metrics, models.RiskMetric{
+			Vector: "threat_intel",
+			Value:  intelPoints / 10,
+			Impact: fmt.Sprintf("%d points: flagged by %d intelligence source(s)", intelPoints, r.ThreatIntelligence.TotalFound),
+		})
+	}
+	if r.BehavioralAnalysis != nil && len(r.BehavioralAnalysis.Patterns) > 0 {
+		metrics = append(metrics, models.RiskMetric{
+			Vector: "behavior",
+			Value:  patternPoints / 10,
+			Impact: fmt.Sprintf("%d points: %d behavioral pattern(s) matched", patternPoints, len(r.BehavioralAnalysis.Patterns)),
+		})
+	}
+	if points := emailPoints(r); points > 0 {
+		metrics = append(metrics, models.RiskMetric{
+			Vector: "email_policy",
+			Value:  int(math.Round(float64(points) / 10)),
+			Impact: fmt.Sprintf("%d points: domain email policy rated %d/100 for spoofing risk", points, r.BasicAnalysis.DNSInfo.EmailSecurity.RiskScore),
+		})
+	}
+	if points := insightPoints(r); points > 0 {
+		metrics = append(metrics, models.RiskMetric{
+			Vector: "correlation",
+			Value:  int(math.Round(float64(points) / 10)),
+			Impact: fmt.Sprintf("%d points: %d correlation rule(s) matched", points, len(r.Insights)),
+		})
+	}
+	return metrics
+}
+
+// emailPoints is the score contribution of the SPF, DMARC, BIMI and MTA-STS
+// policy of r's domain, in proportion to how easily its mail can be spoofed.
+func emailPoints(r *models.AdvancedReport) int {
+	if r.BasicAnalysis == nil || r.BasicAnalysis.DNSInfo == nil || r.BasicAnalysis.DNSInfo.EmailSecurity == nil {
+		return 0
+	}
+	return r.BasicAnalysis.DNSInfo.EmailSecurity.RiskScore * emailPolicyPoints / 100
+}
+
+// insightPoints is the score contribution of the correlation rules that
+// matched r.
+func insightPoints(r *models.AdvancedReport) int {
+	points := 0
+	for _, in := range r.Insights {
+		points += in.Score
+	}
+	return points
+}
+
 func (ao *AnalysisOrchestrator) calculateRiskLevelFromScore(score float64) string {
 	s := score * 100
 	switch {
@@ -18,6 +18,7 @@ type DomainAnalyzer struct {
 	logger      *logger.Logger
 	dnsClient   *network.DNSClient
 	whoisClient *network.WhoisClient
+	emailAuth   *network.EmailAuthAnalyzer
 	urlParser   *processor.URLParser
 	
 	// Simple cache to avoid redundant lookups
@@ -32,6 +33,7 @@ func NewDomainAnalyzer(logger *logger.Logger, dnsClient *network.DNSClient, whoi
 		logger:      logger,
 		dnsClient:   dnsClient,
 		whoisClient: whoisClient,
+		emailAuth:   network.NewEmailAuthAnalyzer(logger, dnsClient),
 		urlParser:   processor.NewURLParser(),
 		dnsCache:    make(map[string]*models.DNSAnalysis),
 		whoisCache:  make(map[string]*models.WhoisAnalysis),
@@ -124,6 +126,9 @@ func (da *DomainAnalyzer) Analyze(ctx context.Context, parsedURL *url.URL, analy
 							"CNAME points to suspicious domain: "+cname)
 					}
 				}
+				
+				// Spoofable sender domains make the phishing mail behind a link credible
+				score += da.analyzeEmailSecurity(ctx, hostname, dnsInfo)
 			} else {
 				da.logger.Warn("Failed to perform DNS lookup for domain analyzer: %v", err)
 				score += 3
@@ -355,6 +360,23 @@ func (da *DomainAnalyzer) analyzeTLD(hostname string, analysis *models.ThreatAna
 }
 
 // Helper methods
+
+// analyzeEmailSecurity checks the SPF, DMARC, BIMI and MTA-STS records of the
+// host's organizational domain and adds their findings to the DNS warnings.
+func (da *DomainAnalyzer) analyzeEmailSecurity(ctx context.Context, hostname string, dnsInfo *models.DNSAnalysis) int {
+	if da.isIPAddress(hostname) || network.IsReservedDomain(hostname) {
+		return 0
+	}
+	if len(dnsInfo.ARecords)+len(dnsInfo.AAAARecords)+len(dnsInfo.MXRecords) == 0 {
+		return 0 // Nothing resolves; the lookup failures are scored already
+	}
+
+	security := da.emailAuth.Analyze(ctx, network.OrganizationalDomain(hostname))
+	dnsInfo.EmailSecurity = security
+	dnsInfo.Warnings = append(dnsInfo.Warnings, security.Findings...)
+	return security.RiskScore / 5
+}
+
 func (da *DomainAnalyzer) isIPAddress(s string) bool {
 	// Simple IPv4 check
 	parts := strings.Split(s, ".")
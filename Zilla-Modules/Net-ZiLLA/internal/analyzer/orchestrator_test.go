@@ -2,12 +2,21 @@ package analyzer
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"net-zilla/internal/config"
 	"net-zilla/internal/models"
 	"net-zilla/internal/network"
 	"net-zilla/pkg/logger"
+
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 func TestAnalysisOrchestrator_Orchestrate(t *testing.T) {
@@ -28,6 +37,286 @@ func TestAnalysisOrchestrator_Orchestrate(t *testing.T) {
 	}
 }
 
+func TestAnalysisOrchestrator_BasicAnalysis(t *testing.T) {
+	const target = "https://shop.cassette.test/"
+	c := network.NewCassette(network.CassetteReplay)
+	c.SetRecordedAt(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	c.Record("whois", "whois.iana.org shop.cassette.test", []byte("Registrar Name: Example Registrar\nCreation Date: 2024-05-25T00:00:00Z\n"), nil)
+	c.Record("http", "GET "+target, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 13\r\n\r\n<html></html>"), nil)
+	c.Record("http", "HEAD "+target, []byte("HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\n"), nil)
+	recordDNS(c, "shop.cassette.test.", [4]byte{192, 0, 2, 7})
+
+	ao := NewAnalysisOrchestrator(logger.NewLogger(), &config.Config{})
+	ao.UseCassette(c)
+	report, err := ao.Orchestrate(context.Background(), target)
+	if err != nil {
+		t.Fatalf("Orchestrate failed: %v", err)
+	}
+
+	basic := report.BasicAnalysis
+	if basic == nil {
+		t.Fatal("expected the infrastructure stage to set BasicAnalysis")
+	}
+	if basic.WhoisInfo == nil || basic.WhoisInfo.DomainAgeDays != 7 {
+		t.Errorf("expected WHOIS with a 7 day old domain, got %+v", basic.WhoisInfo)
+	}
+	if len(basic.RedirectChain) != 1 {
+		t.Errorf("expected a single redirect hop, got %+v", basic.RedirectChain)
+	}
+	// DNS and geolocation look up the target's host, not its URL
+	if basic.DNSInfo == nil || len(basic.DNSInfo.ARecords) != 1 || basic.DNSInfo.ARecords[0] != "192.0.2.7" {
+		t.Errorf("expected the recorded A record, got %+v", basic.DNSInfo)
+	}
+	if basic.GeoAnalysis == nil || basic.GeoAnalysis.IP != "192.0.2.7" {
+		t.Errorf("expected geolocation of the resolved address, got %+v", basic.GeoAnalysis)
+	}
+}
+
+// recordDNS adds the A answer for name to c, and empty answers for the other
+// record types the DNS client asks for.
+func recordDNS(c *network.Cassette, name string, a [4]byte) {
+	q := dnsmessage.MustNewName(name)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA, dnsmessage.TypeCNAME, dnsmessage.TypeMX, dnsmessage.TypeNS, dnsmessage.TypeTXT} {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+		b.StartQuestions()
+		b.Question(dnsmessage.Question{Name: q, Type: qtype, Class: dnsmessage.ClassINET})
+		b.StartAnswers()
+		if qtype == dnsmessage.TypeA {
+			b.AResource(dnsmessage.ResourceHeader{Name: q, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: a})
+		}
+		msg, _ := b.Finish()
+		c.Record("dns", name+" "+strings.TrimPrefix(qtype.String(), "Type"), msg, nil)
+	}
+}
+
+func TestNewAnalysisOrchestrator_LoadsTLSFingerprints(t *testing.T) {
+	jarm := "2ad2ad16d2ad2ad00042d42d00042ddb04deffa1705e2edc44cae1ed24a4da"
+	path := filepath.Join(t.TempDir(), "known_bad_tls.csv")
+	if err := os.WriteFile(path, []byte("jarm,"+jarm+",Phishing kit proxy\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Network: config.NetworkConfig{TLSFingerprintDB: path}}
+	ao := NewAnalysisOrchestrator(logger.NewLogger(), cfg)
+	matches := ao.threat.sslAnalyzer.Fingerprinter().MatchKnownBad(jarm, "")
+	if len(matches) != 1 || matches[0].Label != "Phishing kit proxy" {
+		t.Errorf("expected network.tls_fingerprint_db to be loaded at startup, got %+v", matches)
+	}
+}
+
+func TestAnalysisOrchestrator_OfflineGeoIP(t *testing.T) {
+	dir := t.TempDir()
+	asnTable := filepath.Join(dir, "ip2asn.tsv")
+	vpnList := filepath.Join(dir, "vpn.txt")
+	if err := os.WriteFile(asnTable, []byte("8.8.8.0/24\t15169\tUS\tGOOGLE\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(vpnList, []byte("8.8.8.0/24 Example VPN\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := network.NewCassette(network.CassetteReplay)
+	recordDNS(c, "vpn.cassette.test.", [4]byte{8, 8, 8, 8})
+	cfg := &config.Config{GeoIP: config.GeoIPConfig{ASNTable: asnTable, VPNCIDRs: vpnList}}
+	ao := NewAnalysisOrchestrator(logger.NewLogger(), cfg)
+	ao.UseCassette(c)
+
+	report, err := ao.Orchestrate(context.Background(), "https://vpn.cassette.test/")
+	if err != nil {
+		t.Fatalf("Orchestrate failed: %v", err)
+	}
+	if report.BasicAnalysis == nil || report.BasicAnalysis.GeoAnalysis == nil {
+		t.Fatal("expected a geolocation section")
+	}
+	geo := report.BasicAnalysis.GeoAnalysis
+	if !strings.Contains(geo.ASN, "15169") || !geo.IsProxy {
+		t.Errorf("expected the geoip section of the config to apply, got ASN %q proxy %v", geo.ASN, geo.IsProxy)
+	}
+}
+
+func TestAnalysisOrchestrator_RedirectBudgets(t *testing.T) {
+	const target = "https://hops.cassette.test/"
+	refresh := `<html><head><meta http-equiv="refresh" content="0;url=/a"></head></html>`
+	tests := []struct {
+		name    string
+		network config.NetworkConfig
+		first   string // Response to the first request
+		hops    int
+		warning string
+	}{
+		{
+			name:    "hop budget",
+			network: config.NetworkConfig{MaxRedirects: 2},
+			first:   "HTTP/1.1 302 Found\r\nLocation: /a\r\nContent-Length: 0\r\n\r\n",
+			hops:    2,
+			warning: "hop budget of 2 exhausted",
+		},
+		{
+			name:    "byte budget",
+			network: config.NetworkConfig{RedirectMaxBytes: 16},
+			first:   fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: %d\r\n\r\n%s", len(refresh), refresh),
+			hops:    1,
+			warning: "byte budget of 16 exhausted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := network.NewCassette(network.CassetteReplay)
+			c.Record("http", "GET "+target, []byte(tt.first), nil)
+			c.Record("http", "GET "+target+"a", []byte("HTTP/1.1 302 Found\r\nLocation: /b\r\nContent-Length: 0\r\n\r\n"), nil)
+			c.Record("http", "GET "+target+"b", []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"), nil)
+
+			ao := NewAnalysisOrchestrator(logger.NewLogger(), &config.Config{Network: tt.network})
+			ao.UseCassette(c)
+			report, err := ao.Orchestrate(context.Background(), target)
+			if err != nil {
+				t.Fatalf("Orchestrate failed: %v", err)
+			}
+			chain := report.BasicAnalysis.RedirectChain
+			if len(chain) != tt.hops {
+				t.Fatalf("got %d hops, want %d: %+v", len(chain), tt.hops, chain)
+			}
+			if warnings := strings.Join(chain[len(chain)-1].Warnings, "; "); !strings.Contains(warnings, tt.warning) {
+				t.Errorf("last hop warnings = %q, want one containing %q", warnings, tt.warning)
+			}
+		})
+	}
+}
+
+func TestAnalysisOrchestrator_ReportsProgress(t *testing.T) {
+	ao := NewAnalysisOrchestrator(logger.NewLogger(), &config.Config{})
+
+	var mu sync.Mutex
+	final := make(map[string]StageState)
+	var order []string
+	ctx := WithProgress(context.Background(), func(stage string, state StageState) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, stage+":"+string(state))
+		final[stage] = state
+	})
+
+	if _, err := ao.Orchestrate(ctx, "http://example.com"); err != nil {
+		t.Fatalf("Orchestrate failed: %v", err)
+	}
+
+	for _, stage := range Stages {
+		if state := final[stage]; state != StageDone && state != StageSkipped {
+			t.Errorf("stage %s ended %q, want done or skipped", stage, state)
+		}
+	}
+	if order[0] != StageScreening+":running" {
+		t.Errorf("first update = %s, want screening:running", order[0])
+	}
+	if last := order[len(order)-1]; last != StageScoring+":done" {
+		t.Errorf("last update = %s, want scoring:done", last)
+	}
+}
+
+func TestAnalysisOrchestrator_TimeoutKeepsFinishedStages(t *testing.T) {
+	// The infrastructure stage stalls on a server that accepts connections
+	// but never answers, and outlasts the caller's deadline.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	ao := NewAnalysisOrchestrator(logger.NewLogger(), &config.Config{})
+	var mu sync.Mutex
+	final := make(map[string]StageState)
+	ctx := WithProgress(context.Background(), func(stage string, state StageState) {
+		mu.Lock()
+		defer mu.Unlock()
+		final[stage] = state
+	})
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	report, err := ao.Orchestrate(ctx, "http://"+ln.Addr().String()+"/login")
+	if err != nil {
+		t.Fatalf("Orchestrate failed: %v", err)
+	}
+	if report.BasicAnalysis != nil {
+		t.Fatal("expected the stalled infrastructure stage to be left out")
+	}
+	if report.ThreatIntelligence == nil || report.BehavioralAnalysis == nil {
+		t.Errorf("expected the finished intel and pattern stages to be kept, got %+v", report)
+	}
+	if report.Metadata["timed_out_stages"] != StageInfrastructure {
+		t.Errorf("timed_out_stages = %v, want %s", report.Metadata["timed_out_stages"], StageInfrastructure)
+	}
+	if report.RiskAssessment == nil {
+		t.Error("expected the partial report to be scored")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if final[StageInfrastructure] != StageFailed || final[StageScoring] != StageDone {
+		t.Errorf("infrastructure ended %q and scoring %q, want failed and done", final[StageInfrastructure], final[StageScoring])
+	}
+}
+
+func TestAnalysisOrchestrator_Escalate(t *testing.T) {
+	cfg := &config.Config{Sandbox: config.SandboxConfig{Enabled: true, DockerSocket: filepath.Join(t.TempDir(), "missing.sock")}}
+	ao := NewAnalysisOrchestrator(logger.NewLogger(), cfg)
+	updates := make(chan SandboxUpdate, 1)
+	ao.OnSandboxComplete(func(u SandboxUpdate) { updates <- u })
+
+	if ao.Escalate(&models.AdvancedReport{ReportID: "NZ-1", Metadata: map[string]interface{}{}}) {
+		t.Error("Escalate started a sandbox that Orchestrate did not queue")
+	}
+
+	report := &models.AdvancedReport{ReportID: "NZ-2", Target: "http://phish.example/", Metadata: map[string]interface{}{"sandbox_status": "pending"}}
+	if !ao.Escalate(report) {
+		t.Fatal("Escalate did not start the queued sandbox")
+	}
+	ao.Close()
+
+	select {
+	case u := <-updates:
+		if u.ReportID != "NZ-2" || u.Target != "http://phish.example/" || u.Err == nil {
+			t.Errorf("update = %+v, want a failed run for NZ-2", u)
+		}
+		u.Apply(report)
+		if report.Metadata["sandbox_status"] != "failed" {
+			t.Errorf("sandbox_status = %v after a failed run", report.Metadata["sandbox_status"])
+		}
+	default:
+		t.Fatal("Close returned before the sandbox outcome was delivered")
+	}
+}
+
+func TestNewReportID_Unique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := NewReportID()
+		if !strings.HasPrefix(id, "NZ-") || seen[id] {
+			t.Fatalf("report ID %q is malformed or repeated after %d IDs", id, i)
+		}
+		seen[id] = true
+	}
+}
+
+func TestReportProgress_WithoutFunc(t *testing.T) {
+	// Contexts without a ProgressFunc are the common case and must be a no-op
+	ReportProgress(context.Background(), StageScreening, StageRunning)
+}
+
 func TestAnalysisOrchestrator_CalculateFinalScore(t *testing.T) {
 	ao := &AnalysisOrchestrator{}
 	
@@ -36,6 +325,8 @@ func TestAnalysisOrchestrator_CalculateFinalScore(t *testing.T) {
 		screening network.ScreeningResult
 		intel     int
 		patterns  int
+		insights  []int // Scores of matched correlation rules
+		email     int   // Risk score of the domain's email policy
 		want      float64
 	}{
 		{
@@ -66,6 +357,18 @@ func TestAnalysisOrchestrator_CalculateFinalScore(t *testing.T) {
 			patterns:  1,
 			want:      1.0, // 60 + 30 + 20 = 110 -> 100
 		},
+		{
+			name:      "Correlation Insights",
+			screening: network.ScreeningResult{RiskScore: 30},
+			insights:  []int{15, 10},
+			want:      0.55, // 30 + 15 + 10
+		},
+		{
+			name:      "Spoofable Email Policy",
+			screening: network.ScreeningResult{RiskScore: 30},
+			email:     75,
+			want:      0.45, // 30 + 75*20/100
+		},
 	}
 
 	for _, tt := range tests {
@@ -79,6 +382,14 @@ func TestAnalysisOrchestrator_CalculateFinalScore(t *testing.T) {
 					Patterns: make([]models.BehavioralPattern, tt.patterns),
 				}
 			}
+			for _, score := range tt.insights {
+				report.Insights = append(report.Insights, models.Insight{Score: score})
+			}
+			if tt.email > 0 {
+				report.BasicAnalysis = &models.ThreatAnalysis{DNSInfo: &models.DNSAnalysis{
+					EmailSecurity: &models.EmailSecurity{RiskScore: tt.email},
+				}}
+			}
 			if got := ao.calculateFinalScore(tt.screening, report); got != tt.want {
 				t.Errorf("calculateFinalScore() = %v, want %v", got, tt.want)
 			}
@@ -86,6 +397,67 @@ func TestAnalysisOrchestrator_CalculateFinalScore(t *testing.T) {
 	}
 }
 
+func TestAnalysisOrchestrator_KnownBadTLSRaisesVerdict(t *testing.T) {
+	ao := NewAnalysisOrchestrator(logger.NewLogger(), &config.Config{})
+	screening := network.ScreeningResult{RiskScore: 10}
+
+	verdict := func(matches []models.FingerprintMatch) string {
+		report := &models.AdvancedReport{
+			BasicAnalysis: &models.ThreatAnalysis{TLSInfo: &models.TLSAnalysis{CertificateValid: true, FingerprintMatches: matches}},
+			Metadata:      make(map[string]interface{}),
+		}
+		ao.correlator.Correlate(report)
+		return ao.calculateRiskLevelFromScore(ao.calculateFinalScore(screening, report))
+	}
+
+	if got := verdict(nil); got != "LOW" {
+		t.Fatalf("verdict without a fingerprint match = %s, want LOW", got)
+	}
+	c2 := []models.FingerprintMatch{{Type: "jarm", Fingerprint: "07d14d16d21d21d07c42d41d00041d24a458a375eef0c576d23a7bab9a9fb1", Label: "Cobalt Strike"}}
+	if got := verdict(c2); got != "HIGH" {
+		t.Errorf("verdict with a known-bad C2 fingerprint = %s, want HIGH", got)
+	}
+}
+
+func TestAnalysisOrchestrator_ScoreMetrics(t *testing.T) {
+	ao := &AnalysisOrchestrator{}
+
+	tests := []struct {
+		name      string
+		screening int
+		intel     int
+		patterns  int
+		insights  int      // Score of one matched correlation rule
+		want      []string // vector:value
+	}{
+		{"Clean", 0, 0, 0, 0, []string{"screening:0"}},
+		{"Screening rounds to the 0-10 scale", 44, 0, 0, 0, []string{"screening:4"}},
+		{"Every vector", 40, 2, 1, 15, []string{"screening:4", "threat_intel:3", "behavior:2", "correlation:2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &models.AdvancedReport{
+				ThreatIntelligence: &models.IOCRegistry{TotalFound: tt.intel},
+				BehavioralAnalysis: &models.BehaviorAnalysis{Patterns: make([]models.BehavioralPattern, tt.patterns)},
+			}
+			if tt.insights > 0 {
+				report.Insights = []models.Insight{{Score: tt.insights}}
+			}
+			var got []string
+			for _, m := range ao.scoreMetrics(network.ScreeningResult{RiskScore: tt.screening}, report) {
+				got = append(got, fmt.Sprintf("%s:%d", m.Vector, m.Value))
+				if m.Impact == "" {
+					t.Errorf("metric %s has no impact text", m.Vector)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("scoreMetrics() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAnalysisOrchestrator_CalculateRiskLevelFromScore(t *testing.T) {
 	ao := &AnalysisOrchestrator{}
 	tests := []struct {
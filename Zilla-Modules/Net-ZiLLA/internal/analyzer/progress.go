@@ -0,0 +1,48 @@
+package analyzer
+
+import "context"
+
+// Pipeline stages reported to a ProgressFunc, in the order Orchestrate runs
+// them. Intel, patterns and infrastructure run concurrently.
+const (
+	StageScreening      = "screening"
+	StageIntel          = "intel"
+	StagePatterns       = "patterns"
+	StageInfrastructure = "infrastructure"
+	StageSandbox        = "sandbox"
+	StageCorrelation    = "correlation"
+	StageScoring        = "scoring"
+)
+
+// Stages lists every stage in pipeline order.
+var Stages = []string{StageScreening, StageIntel, StagePatterns, StageInfrastructure, StageSandbox, StageCorrelation, StageScoring}
+
+// StageState is the state a stage reports.
+type StageState string
+
+const (
+	StageRunning StageState = "running"
+	StageDone    StageState = "done"
+	StageSkipped StageState = "skipped"
+	StageFailed  StageState = "failed"
+	// StageDeferred means the stage goes on after the report is returned.
+	StageDeferred StageState = "deferred"
+)
+
+// ProgressFunc receives stage updates while an analysis runs. Concurrent
+// stages call it from their own goroutines.
+type ProgressFunc func(stage string, state StageState)
+
+type progressKey struct{}
+
+// WithProgress returns a context whose analyses report their stages to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ReportProgress sends a stage update to the ProgressFunc carried by ctx, if any.
+func ReportProgress(ctx context.Context, stage string, state StageState) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(stage, state)
+	}
+}
@@ -21,7 +21,7 @@ func NewSafetyOrchestrator(l *logger.Logger) *SafetyOrchestrator {
 		screener: network.NewSafetyScreener(),
 		intel:    threat_intel.NewIntelManager("", "", ""), // Keys would be injected from config
 		decoy:    network.NewDecoyClient(""),
-		sandbox:  threat_intel.NewSandboxManager(),
+		sandbox:  threat_intel.NewSandboxManager(l),
 		logger:   l,
 	}
 }
@@ -42,9 +42,8 @@ func (so *SafetyOrchestrator) SecureAnalyze(ctx context.Context, target string)
 	// 3. Escalation Decision
 	if screening.RiskScore > 50 || reputation.Malicious {
 		so.logger.Warn("High risk detected. Escalating to isolated sandbox...")
-		containerID, err := so.sandbox.SpinUpIsolatedBrowser(ctx, target)
-		if err == nil {
-			defer so.sandbox.DestroySandbox(containerID)
+		if _, err := so.sandbox.Run(ctx, target); err != nil {
+			so.logger.Warn("Sandbox run failed: %v", err)
 		}
 	} else {
 		so.logger.Info("Low risk confirmed. Proceeding with standard passive analysis.")
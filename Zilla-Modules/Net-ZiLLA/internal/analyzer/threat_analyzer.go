@@ -10,6 +10,7 @@ import (
 
 	"golang.org/x/time/rate"
 
+	"net-zilla/internal/config"
 	"net-zilla/internal/models"
 	"net-zilla/internal/network"
 	"net-zilla/internal/shared_models"
@@ -24,7 +25,7 @@ import (
 type ThreatAnalyzer struct {
 	mlAgent         analyzer_interface.MLAgentInterface
 	logger          *logger.Logger
-	db              *storage.Database
+	db              storage.Store
 	redirectTracer  *network.RedirectTracer
 	domainAnalyzer  *DomainAnalyzer
 	ipAnalyzer      *network.IPAnalyzer
@@ -33,6 +34,7 @@ type ThreatAnalyzer struct {
 	sslAnalyzer     *network.SSLAnalyzer
 	httpClient      *network.HTTPClient
 	tracer          *network.Tracer
+	cassette        *network.Cassette // Record/replay of network responses; nil when live
 
 	// Improvement 1: Timeout configuration
 	timeoutConfig TimeoutConfig
@@ -85,7 +87,7 @@ type AnalysisCache struct {
 }
 
 // NewThreatAnalyzer creates and initializes a new ThreatAnalyzer instance.
-func NewThreatAnalyzer(mlAgent analyzer_interface.MLAgentInterface, logger *logger.Logger, db *storage.Database) *ThreatAnalyzer {
+func NewThreatAnalyzer(mlAgent analyzer_interface.MLAgentInterface, logger *logger.Logger, db storage.Store) *ThreatAnalyzer {
 	ta := &ThreatAnalyzer{
 		mlAgent:        mlAgent,
 		logger:         logger.WithComponent("threat_analyzer"),
@@ -97,7 +99,7 @@ func NewThreatAnalyzer(mlAgent analyzer_interface.MLAgentInterface, logger *logg
 		whoisClient:    network.NewWhoisClient(logger),
 		sslAnalyzer:    network.NewSSLAnalyzer(logger),
 		httpClient:     network.NewHTTPClient(logger),
-		tracer:         network.NewTracer(),
+		tracer:         network.NewTracer(logger),
 
 		// Improvement 1: Configure timeouts
 		timeoutConfig: TimeoutConfig{
@@ -144,9 +146,100 @@ func NewThreatAnalyzer(mlAgent analyzer_interface.MLAgentInterface, logger *logg
 		metricsTracker: metrics.NewTracker(),
 	}
 
+	ta.tracer.SetASNResolver(ta.ipAnalyzer)
+
 	return ta
 }
 
+// Configure applies the network section of the application config to the
+// analyzer's network components. Missing optional resources are logged and
+// skipped so a partial config never prevents analysis.
+func (ta *ThreatAnalyzer) Configure(cfg *config.Config) error {
+	if cfg == nil {
+		return nil
+	}
+
+	if path := cfg.Network.TLSFingerprintDB; path != "" {
+		if err := ta.sslAnalyzer.Fingerprinter().LoadKnownBadFingerprints(path); err != nil {
+			ta.logger.Warn("Known-bad TLS fingerprint list not loaded: %v", err)
+		}
+	}
+
+	ta.redirectTracer.SetMaxHops(cfg.Network.MaxRedirects)
+	ta.redirectTracer.SetByteBudget(0, cfg.Network.RedirectMaxBytes)
+
+	if cfg.Network.TracerouteMode != "" {
+		mode, err := network.ParseTraceMode(cfg.Network.TracerouteMode)
+		if err != nil {
+			return fmt.Errorf("invalid network config: %w", err)
+		}
+		ta.tracer.SetMode(mode)
+	}
+	ta.tracer.SetMaxHops(cfg.Network.TracerouteMaxHops)
+	ta.tracer.SetProbesPerHop(cfg.Network.TracerouteProbes)
+
+	mode, err := network.ParseCassetteMode(cfg.Network.CassetteMode)
+	if err != nil {
+		return fmt.Errorf("invalid network config: %w", err)
+	}
+	if mode != network.CassetteOff {
+		cassette, err := network.OpenCassette(cfg.Network.CassettePath, mode)
+		if err != nil {
+			return fmt.Errorf("invalid network config: %w", err)
+		}
+		ta.UseCassette(cassette)
+		ta.logger.Info("Network cassette %s in %s mode", cfg.Network.CassettePath, mode)
+	}
+
+	geo := cfg.GeoIP
+	db, err := network.OpenGeoIPDatabase(geo.CityDB, geo.ASNDB, geo.ASNTable)
+	if err != nil {
+		ta.logger.Warn("Offline GeoIP database not loaded: %v", err)
+	} else {
+		ta.ipAnalyzer.SetGeoIPDatabase(db)
+	}
+	ta.ipAnalyzer.SetOnlineFallback(geo.OnlineFallback)
+
+	lists := network.NewCIDRLists()
+	for category, path := range map[network.CIDRCategory]string{
+		network.CIDRCategoryHosting: geo.HostingCIDRs,
+		network.CIDRCategoryVPN:     geo.VPNCIDRs,
+		network.CIDRCategoryTorExit: geo.TorExitCIDRs,
+	} {
+		if path == "" {
+			continue
+		}
+		if err := lists.LoadFile(category, path); err != nil {
+			ta.logger.Warn("CIDR list not loaded: %v", err)
+		}
+	}
+	ta.ipAnalyzer.SetCIDRLists(lists)
+
+	return nil
+}
+
+// UseCassette routes the DNS, WHOIS, TLS, HTTP, redirect, MTA-STS and IP lookups
+// of every stage through c, so a run can be recorded and later replayed offline.
+// Traceroute probes are raw packets and stay live. Passing nil restores live lookups.
+func (ta *ThreatAnalyzer) UseCassette(c *network.Cassette) {
+	ta.cassette = c
+	ta.dnsClient.SetCassette(c)
+	ta.whoisClient.SetCassette(c)
+	ta.domainAnalyzer.dnsClient.SetCassette(c)
+	ta.domainAnalyzer.whoisClient.SetCassette(c)
+	ta.domainAnalyzer.emailAuth.SetCassette(c)
+	ta.sslAnalyzer.SetCassette(c)
+	ta.httpClient.SetCassette(c)
+	ta.redirectTracer.SetCassette(c)
+	ta.ipAnalyzer.SetCassette(c)
+}
+
+// Cassette returns the cassette set by Configure or UseCassette, or nil when
+// lookups are live.
+func (ta *ThreatAnalyzer) Cassette() *network.Cassette {
+	return ta.cassette
+}
+
 // ComprehensiveAnalysis performs a detailed security analysis with all improvements.
 func (ta *ThreatAnalyzer) ComprehensiveAnalysis(ctx context.Context, targetURL string) (*models.ThreatAnalysis, error) {
 	// Improvement 6: Start tracing
@@ -458,6 +551,9 @@ func (ta *ThreatAnalyzer) mapComponentScores(analysis *models.ThreatAnalysis) ma
 	}
 	if analysis.DNSInfo != nil {
 		scores["dns"] = 50 // Placeholder
+		if es := analysis.DNSInfo.EmailSecurity; es != nil {
+			scores["dns"] = es.RiskScore
+		}
 	}
 	if analysis.WhoisInfo != nil && analysis.WhoisInfo.DomainAgeDays < 30 {
 		scores["whois"] = 70
@@ -465,6 +561,9 @@ func (ta *ThreatAnalyzer) mapComponentScores(analysis *models.ThreatAnalysis) ma
 	if analysis.TLSInfo != nil && !analysis.TLSInfo.CertificateValid {
 		scores["ssl"] = 80
 	}
+	if analysis.TLSInfo != nil && len(analysis.TLSInfo.FingerprintMatches) > 0 {
+		scores["ssl"] = 95 // Server stack matches known-bad C2/proxy infrastructure
+	}
 	if analysis.AIResult != nil && !analysis.AIResult.IsSafe {
 		scores["ai"] = int((1.0 - analysis.AIResult.Confidence) * 100)
 	}
@@ -536,7 +635,7 @@ func (ta *ThreatAnalyzer) performDNSAnalysisComponent(ctx context.Context, targe
 	dnsCtx, cancel := context.WithTimeout(ctx, ta.timeoutConfig.DNSTimeout)
 	defer cancel()
 
-	dnsInfo, err := ta.dnsClient.Lookup(dnsCtx, target)
+	dnsInfo, err := ta.dnsClient.Lookup(dnsCtx, hostOf(target))
 	if err == nil {
 		analysis.DNSInfo = dnsInfo
 		return 0, nil
@@ -554,7 +653,7 @@ func (ta *ThreatAnalyzer) performWhoisAnalysisComponent(ctx context.Context, tar
 	whoisCtx, cancel := context.WithTimeout(ctx, ta.timeoutConfig.WhoisTimeout)
 	defer cancel()
 
-	whoisInfo, err := ta.whoisClient.Lookup(whoisCtx, target)
+	whoisInfo, err := ta.whoisClient.Lookup(whoisCtx, hostOf(target))
 	if err == nil {
 		analysis.WhoisInfo = whoisInfo
 		return 0, nil
@@ -565,7 +664,7 @@ func (ta *ThreatAnalyzer) performWhoisAnalysisComponent(ctx context.Context, tar
 }
 
 func (ta *ThreatAnalyzer) performIPAnalysisComponent(ctx context.Context, target string, analysis *models.ThreatAnalysis) (int, error) {
-	ipGeo, err := ta.ipAnalyzer.GetGeolocation(ctx, target)
+	ipGeo, err := ta.ipAnalyzer.GetGeolocation(ctx, hostOf(target))
 	if err == nil {
 		analysis.GeoAnalysis = ipGeo
 	}
@@ -580,7 +679,7 @@ func (ta *ThreatAnalyzer) performSSLAnalysisComponent(ctx context.Context, targe
 	sslCtx, cancel := context.WithTimeout(ctx, ta.timeoutConfig.SSLTimeout)
 	defer cancel()
 
-	sslInfo, err := ta.sslAnalyzer.Analyze(sslCtx, target)
+	sslInfo, err := ta.sslAnalyzer.Analyze(sslCtx, hostOf(target))
 	if err == nil {
 		analysis.TLSInfo = sslInfo
 		return 0, nil
@@ -590,6 +689,15 @@ func (ta *ThreatAnalyzer) performSSLAnalysisComponent(ctx context.Context, targe
 	return 0, err
 }
 
+// hostOf returns the host name of a target URL, or target itself when it has
+// none, for the lookups that take a host rather than a URL.
+func hostOf(target string) string {
+	if parsed, err := url.Parse(target); err == nil && parsed.Hostname() != "" {
+		return parsed.Hostname()
+	}
+	return target
+}
+
 func (ta *ThreatAnalyzer) normalizeURL(rawURL string) (string, error) {
 	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
 		rawURL = "https://" + rawURL
@@ -817,7 +925,7 @@ func (ta *ThreatAnalyzer) PerformTLSAnalysis(ctx context.Context, target string)
 }
 
 func (ta *ThreatAnalyzer) PerformTraceroute(ctx context.Context, target string) (*models.NetworkAnalysis, error) {
-	return ta.tracer.Trace(target)
+	return ta.tracer.Trace(ctx, hostOf(target))
 }
 
 func (ta *ThreatAnalyzer) GetHistory(ctx context.Context, limit int) ([]*models.ThreatAnalysis, error) {
@@ -836,4 +944,9 @@ func (ta *ThreatAnalyzer) Cleanup() {
 		cancel()
 	}
 	ta.cancelFuncs = nil
+
+	// A recording is only written once the analyses using it are done.
+	if err := ta.cassette.Close(); err != nil {
+		ta.logger.Error("Failed to save network cassette: %v", err)
+	}
 }
@@ -2,10 +2,12 @@ package analyzer
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
 	"net-zilla/internal/models"
+	"net-zilla/internal/network"
 	"net-zilla/pkg/logger"
 )
 
@@ -203,3 +205,45 @@ func TestThreatAnalyzer_ExecuteStandardAnalysis(t *testing.T) {
 		t.Error("expected some component scores")
 	}
 }
+
+func TestThreatAnalyzer_ReplayCassette(t *testing.T) {
+	const target = "https://shop.cassette.test/"
+	newCassette := func() *network.Cassette {
+		c := network.NewCassette(network.CassetteReplay)
+		c.SetRecordedAt(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+		c.Record("whois", "whois.iana.org shop.cassette.test", []byte("Registrar Name: Example Registrar\nCreation Date: 2024-05-25T00:00:00Z\n"), nil)
+		c.Record("http", "GET "+target, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 13\r\n\r\n<html></html>"), nil)
+		c.Record("http", "HEAD "+target, []byte("HTTP/1.1 200 OK\r\nStrict-Transport-Security: max-age=63072000\r\nContent-Length: 13\r\n\r\n"), nil)
+		return c
+	}
+
+	// Everything not in the cassette fails as a miss instead of reaching the network,
+	// so two runs over the same recording must agree exactly.
+	var results []*models.ThreatAnalysis
+	for i := 0; i < 2; i++ {
+		ta := NewThreatAnalyzer(nil, logger.NewLogger(), nil)
+		ta.UseCassette(newCassette())
+		analysis, err := ta.ComprehensiveAnalysis(context.Background(), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, analysis)
+	}
+
+	a := results[0]
+	if a.WhoisInfo == nil || a.WhoisInfo.DomainAgeDays != 7 {
+		t.Fatalf("expected WHOIS from the cassette with a 7 day old domain, got %+v", a.WhoisInfo)
+	}
+	if len(a.RedirectChain) != 1 || a.RedirectChain[0].StatusCode != 200 {
+		t.Errorf("expected a single replayed hop, got %+v", a.RedirectChain)
+	}
+	if len(a.SecurityHeaders) == 0 || !strings.HasPrefix(a.SecurityHeaders[0], "Strict-Transport-Security") {
+		t.Errorf("expected replayed HSTS header, got %v", a.SecurityHeaders)
+	}
+	if a.TLSInfo != nil || a.DNSInfo == nil || len(a.DNSInfo.ARecords) != 0 {
+		t.Errorf("unrecorded TLS and DNS must fail offline: tls=%+v dns=%+v", a.TLSInfo, a.DNSInfo)
+	}
+	if b := results[1]; b.ThreatScore != a.ThreatScore || b.WhoisInfo.DomainAgeDays != a.WhoisInfo.DomainAgeDays {
+		t.Errorf("replays disagree: score %d vs %d", a.ThreatScore, b.ThreatScore)
+	}
+}
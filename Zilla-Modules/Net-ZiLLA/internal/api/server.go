@@ -3,13 +3,24 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"net-zilla/internal/config"
+	"net-zilla/internal/correlation"
+	"net-zilla/internal/fileanalysis"
+	"net-zilla/internal/message"
 	"net-zilla/internal/middleware"
 	"net-zilla/internal/services"
+	"net-zilla/internal/storage"
+	"net-zilla/internal/visualization"
 	"net-zilla/pkg/logger"
 )
 
@@ -45,6 +56,15 @@ func NewServer(analysisService *services.AnalysisService, logger *logger.Logger,
 
 func (s *APIServer) setupRoutes(mux *http.ServeMux) {
 	mux.Handle("/api/v1/analyze", s.middleware.Chain(http.HandlerFunc(s.analyzeHandler), middleware.LoggerMiddleware(s.logger)))
+	mux.Handle("/api/v1/messages/analyze", s.middleware.Chain(http.HandlerFunc(s.analyzeMessageHandler), middleware.LoggerMiddleware(s.logger)))
+	mux.Handle("/api/v1/files", s.middleware.Chain(http.HandlerFunc(s.analyzeFileHandler), middleware.LoggerMiddleware(s.logger)))
+	mux.Handle("/api/v1/analyses/{id}", s.middleware.Chain(http.HandlerFunc(s.getAnalysisHandler), middleware.LoggerMiddleware(s.logger)))
+	mux.Handle("/api/v1/analyses/{id}/report", s.middleware.Chain(http.HandlerFunc(s.getReportHandler), middleware.LoggerMiddleware(s.logger)))
+	mux.Handle("/api/v1/graph", s.middleware.Chain(http.HandlerFunc(s.graphHandler), middleware.LoggerMiddleware(s.logger)))
+	mux.Handle("/api/v1/graph/path", s.middleware.Chain(http.HandlerFunc(s.graphPathHandler), middleware.LoggerMiddleware(s.logger)))
+	mux.Handle("/api/v1/graph/clusters", s.middleware.Chain(http.HandlerFunc(s.graphClustersHandler), middleware.LoggerMiddleware(s.logger)))
+	mux.Handle("/api/v1/campaigns", s.middleware.Chain(http.HandlerFunc(s.listCampaignsHandler), middleware.LoggerMiddleware(s.logger)))
+	mux.Handle("/api/v1/campaigns/{id}", s.middleware.Chain(http.HandlerFunc(s.getCampaignHandler), middleware.LoggerMiddleware(s.logger)))
 	mux.HandleFunc("/health", s.healthHandler)
 }
 
@@ -98,6 +118,377 @@ func (s *APIServer) analyzeHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(report)
 }
 
+// analyzeMessageHandler accepts either a raw email (Content-Type: message/rfc822)
+// or JSON {"type": "sms"|"email", "content": "...", "sender": "..."}.
+func (s *APIServer) analyzeMessageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, message.MaxEmailSize)
+
+	var msg *message.Message
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "message/rfc822" {
+		msg, err = message.ParseEmail(r.Body)
+	} else {
+		var req struct {
+			Type    string `json:"type"`
+			Content string `json:"content"`
+			Sender  string `json:"sender"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON body"})
+			return
+		}
+		switch strings.ToLower(req.Type) {
+		case message.KindSMS, "":
+			msg, err = message.ParseSMS(req.Content, req.Sender)
+		case message.KindEmail:
+			msg, err = message.ParseEmail(strings.NewReader(req.Content))
+		default:
+			err = fmt.Errorf("type must be %q or %q", message.KindSMS, message.KindEmail)
+		}
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	result, err := s.analysisService.AnalyzeMessage(r.Context(), msg)
+	if err != nil {
+		s.logger.Error("Message analysis failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Internal analysis error"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// analyzeFileHandler accepts a file as the "file" field of a multipart form, or
+// as the raw request body with its name in ?name=. The file is analyzed
+// statically and never stored or executed.
+func (s *APIServer) analyzeFileHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+	// Room for the multipart framing around a maximum-size file
+	r.Body = http.MaxBytesReader(w, r.Body, fileanalysis.MaxFileSize+1<<20)
+
+	var name string
+	var data []byte
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		var file multipart.File
+		var header *multipart.FileHeader
+		file, header, err = r.FormFile("file")
+		if err == nil {
+			defer file.Close()
+			name = header.Filename
+			data, err = io.ReadAll(file)
+		}
+		if r.MultipartForm != nil {
+			defer r.MultipartForm.RemoveAll()
+		}
+	} else {
+		name = r.URL.Query().Get("name")
+		data, err = io.ReadAll(r.Body)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if len(data) == 0 || len(data) > fileanalysis.MaxFileSize {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("file must be between 1 and %d bytes", fileanalysis.MaxFileSize)})
+		return
+	}
+	if name == "" {
+		name = "upload"
+	}
+
+	result, err := s.analysisService.AnalyzeFile(r.Context(), name, data)
+	if err != nil {
+		s.logger.Error("File analysis failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Internal analysis error"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// getAnalysisHandler returns the stored report of a past analysis, exactly as
+// POST /api/v1/analyze returned it.
+func (s *APIServer) getAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	id := r.PathValue("id")
+	report, err := s.analysisService.GetReport(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Analysis not found"})
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to load analysis %s: %v", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load analysis"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+// reportContentTypes lists the formats GET /api/v1/analyses/{id}/report serves.
+var reportContentTypes = map[string]string{
+	visualization.FormatHTML: "text/html; charset=utf-8",
+	visualization.FormatPDF:  "application/pdf",
+}
+
+// getReportHandler renders the stored report of a past analysis as an HTML
+// page or a PDF document, chosen with ?format=html|pdf (html by default).
+func (s *APIServer) getReportHandler(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg})
+	}
+
+	if r.Method != http.MethodGet {
+		fail(http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = visualization.FormatHTML
+	}
+	contentType, ok := reportContentTypes[format]
+	if !ok {
+		fail(http.StatusBadRequest, "Unsupported format, use html or pdf")
+		return
+	}
+
+	id := r.PathValue("id")
+	data, err := s.analysisService.RenderReport(r.Context(), id, format)
+	if errors.Is(err, storage.ErrNotFound) {
+		fail(http.StatusNotFound, "Analysis not found")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to render %s report for analysis %s: %v", format, id, err)
+		fail(http.StatusInternalServerError, "Failed to render report")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": id + "." + format}))
+	w.Write(data)
+}
+
+// graphContentTypes lists the formats the /api/v1/graph endpoints serve.
+var graphContentTypes = map[string]string{
+	visualization.GraphFormatJSON:      "application/json",
+	visualization.GraphFormatGraphML:   "application/graphml+xml",
+	visualization.GraphFormatCytoscape: "application/json",
+	visualization.GraphFormatDOT:       "text/vnd.graphviz",
+}
+
+// Limits on ?depth= for neighbor queries.
+const (
+	defaultGraphDepth = 1
+	maxGraphDepth     = 5
+)
+
+func graphError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// writeGraph renders g in the ?format= of r (json by default).
+func (s *APIServer) writeGraph(w http.ResponseWriter, r *http.Request, g *correlation.RelationshipGraph) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = visualization.GraphFormatJSON
+	}
+	contentType, ok := graphContentTypes[format]
+	if !ok {
+		graphError(w, http.StatusBadRequest, "Unsupported format, use "+strings.Join(visualization.GraphFormats, ", "))
+		return
+	}
+	data, err := visualization.NewGraphRenderer().RenderGraph(g, format)
+	if err != nil {
+		s.logger.Error("Failed to render graph as %s: %v", format, err)
+		graphError(w, http.StatusInternalServerError, "Failed to render graph")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+// graphQueryFailed writes the response for a failed graph query.
+func (s *APIServer) graphQueryFailed(w http.ResponseWriter, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		graphError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.logger.Error("Graph query failed: %v", err)
+	graphError(w, http.StatusInternalServerError, "Failed to query infrastructure graph")
+}
+
+// graphHandler returns the infrastructure graph of every stored analysis, or
+// with ?node= only what lies within ?depth= hops (1 by default) of that node.
+// ?format= selects json, graphml, cytoscape or dot.
+func (s *APIServer) graphHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		graphError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var g *correlation.RelationshipGraph
+	var err error
+	if node := r.URL.Query().Get("node"); node != "" {
+		depth := defaultGraphDepth
+		if v := r.URL.Query().Get("depth"); v != "" {
+			depth, err = strconv.Atoi(v)
+			if err != nil || depth < 0 || depth > maxGraphDepth {
+				graphError(w, http.StatusBadRequest, fmt.Sprintf("depth must be between 0 and %d", maxGraphDepth))
+				return
+			}
+		}
+		g, err = s.analysisService.GraphNeighbors(r.Context(), node, depth)
+	} else {
+		g, err = s.analysisService.InfrastructureGraph(r.Context())
+	}
+	if err != nil {
+		s.graphQueryFailed(w, err)
+		return
+	}
+	s.writeGraph(w, r, g)
+}
+
+// graphPathHandler returns the shortest chain of infrastructure linking
+// ?from= and ?to=, in the ?format= of graphHandler.
+func (s *APIServer) graphPathHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		graphError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if from == "" || to == "" {
+		graphError(w, http.StatusBadRequest, "from and to are required")
+		return
+	}
+	g, err := s.analysisService.GraphPath(r.Context(), from, to)
+	if err != nil {
+		s.graphQueryFailed(w, err)
+		return
+	}
+	s.writeGraph(w, r, g)
+}
+
+// graphClustersHandler returns the groups of infrastructure shared by at
+// least ?min_analyses= analyses (2 by default).
+func (s *APIServer) graphClustersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		graphError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	minAnalyses := 2
+	if v := r.URL.Query().Get("min_analyses"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			graphError(w, http.StatusBadRequest, "min_analyses must be a positive integer")
+			return
+		}
+		minAnalyses = n
+	}
+	clusters, err := s.analysisService.GraphClusters(r.Context(), minAnalyses)
+	if err != nil {
+		s.graphQueryFailed(w, err)
+		return
+	}
+	if clusters == nil {
+		clusters = []correlation.Cluster{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"clusters": clusters})
+}
+
+// listCampaignsHandler returns every campaign of related analyses with its
+// members, evidence and timeline, most recently active first.
+func (s *APIServer) listCampaignsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	campaigns, err := s.analysisService.Campaigns(r.Context())
+	if err != nil {
+		s.logger.Error("Failed to cluster campaigns: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load campaigns"})
+		return
+	}
+	if campaigns == nil {
+		campaigns = []correlation.Campaign{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"campaigns": campaigns})
+}
+
+// getCampaignHandler returns a single campaign by ID.
+func (s *APIServer) getCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	id := r.PathValue("id")
+	campaign, err := s.analysisService.GetCampaign(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Campaign not found"})
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to load campaign %s: %v", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load campaign"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(campaign)
+}
 
 func (s *APIServer) Run(ctx context.Context) error {
 	s.logger.Info("🚀 Net-Zilla API server starting on %s", s.server.Addr)
@@ -2,12 +2,19 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"net-zilla/internal/config"
+	"net-zilla/internal/models"
 	"net-zilla/internal/services"
 	"net-zilla/internal/storage"
 	"net-zilla/pkg/logger"
@@ -112,3 +119,336 @@ func TestAnalyzeHandler_Success(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 }
+
+func TestAnalyzeMessageHandler(t *testing.T) {
+	l := logger.NewLogger()
+	cfg := &config.Config{}
+	svc := services.NewAnalysisService(l, nil, cfg)
+	server := NewServer(svc, l, cfg)
+
+	email := "From: Alerts <alerts@bank.example>\r\nSubject: Verify\r\nAuthentication-Results: mx.example.net; spf=fail smtp.mailfrom=bank.example; dmarc=fail\r\n\r\nVerify at http://192.0.2.10/login\r\n"
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		wantStatus  int
+		wantKind    string
+	}{
+		{name: "method not allowed", method: "GET", wantStatus: http.StatusMethodNotAllowed},
+		{name: "invalid json", method: "POST", body: "{", wantStatus: http.StatusBadRequest},
+		{name: "unknown type", method: "POST", body: `{"type":"fax","content":"hi"}`, wantStatus: http.StatusBadRequest},
+		{name: "empty sms", method: "POST", body: `{"type":"sms","content":""}`, wantStatus: http.StatusBadRequest},
+		{name: "sms", method: "POST", body: `{"type":"sms","content":"Your parcel is held: http://192.0.2.10/pay","sender":"+15550001111"}`, wantStatus: http.StatusOK, wantKind: "sms"},
+		{name: "email in json", method: "POST", body: `{"type":"email","content":` + strconv.Quote(email) + `}`, wantStatus: http.StatusOK, wantKind: "email"},
+		{name: "raw rfc822", method: "POST", contentType: "message/rfc822", body: email, wantStatus: http.StatusOK, wantKind: "email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/api/v1/messages/analyze", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.analyzeMessageHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantKind == "" {
+				return
+			}
+			var result models.MessageAnalysis
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if result.Kind != tt.wantKind || len(result.URLs) != 1 || result.URLs[0].Report == nil || result.Verdict == "" {
+				t.Errorf("unexpected analysis: %+v", result)
+			}
+		})
+	}
+}
+
+func TestAnalyzeFileHandler(t *testing.T) {
+	l := logger.NewLogger()
+	cfg := &config.Config{}
+	svc := services.NewAnalysisService(l, nil, cfg)
+	server := NewServer(svc, l, cfg)
+
+	script := "eval(atob('W21hbGljaW91cyBjb2RlXQ=='))\nlocation = 'https://drop.example/x'"
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "loader.js")
+	fw.Write([]byte(script))
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        []byte
+		wantStatus  int
+		wantName    string
+	}{
+		{name: "method not allowed", method: "GET", target: "/api/v1/files", wantStatus: http.StatusMethodNotAllowed},
+		{name: "empty body", method: "POST", target: "/api/v1/files", wantStatus: http.StatusBadRequest},
+		{name: "form without file", method: "POST", target: "/api/v1/files", contentType: "multipart/form-data; boundary=x", body: []byte("--x--\r\n"), wantStatus: http.StatusBadRequest},
+		{name: "multipart", method: "POST", target: "/api/v1/files", contentType: mw.FormDataContentType(), body: form.Bytes(), wantStatus: http.StatusOK, wantName: "loader.js"},
+		{name: "raw body", method: "POST", target: "/api/v1/files?name=loader.js", contentType: "application/octet-stream", body: []byte(script), wantStatus: http.StatusOK, wantName: "loader.js"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.target, bytes.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.analyzeFileHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantName == "" {
+				return
+			}
+			var result models.FileAnalysis
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if result.FileName != tt.wantName || result.Type != "script" || result.RiskScore < 50 ||
+				len(result.URLs) != 1 || result.URLs[0] != "https://drop.example/x" {
+				t.Errorf("unexpected analysis: %+v", result)
+			}
+		})
+	}
+}
+
+func TestGetAnalysisHandler(t *testing.T) {
+	l := logger.NewLogger()
+	cfg := &config.Config{}
+	dbPath := filepath.Join(t.TempDir(), "analyses.db")
+	db, err := storage.NewDatabase(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	svc := services.NewAnalysisService(l, db, cfg)
+	server := NewServer(svc, l, cfg)
+
+	report, err := svc.PerformAnalysis(context.Background(), "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(report)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"stored report", http.MethodGet, "/api/v1/analyses/" + report.ReportID, http.StatusOK},
+		{"unknown id", http.MethodGet, "/api/v1/analyses/NZ-missing", http.StatusNotFound},
+		{"wrong method", http.MethodDelete, "/api/v1/analyses/" + report.ReportID, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if tt.status == http.StatusOK && strings.TrimSpace(rr.Body.String()) != string(want) {
+				t.Errorf("body differs from the computed report:\n got %s\nwant %s", rr.Body.String(), want)
+			}
+		})
+	}
+}
+
+func TestGetReportHandler(t *testing.T) {
+	l := logger.NewLogger()
+	cfg := &config.Config{}
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "analyses.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	svc := services.NewAnalysisService(l, db, cfg)
+	server := NewServer(svc, l, cfg)
+
+	report, err := svc.PerformAnalysis(context.Background(), "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "/api/v1/analyses/" + report.ReportID + "/report"
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		status      int
+		contentType string
+		prefix      string
+	}{
+		{"html by default", http.MethodGet, base, http.StatusOK, "text/html; charset=utf-8", "<!DOCTYPE html>"},
+		{"html", http.MethodGet, base + "?format=html", http.StatusOK, "text/html; charset=utf-8", "<!DOCTYPE html>"},
+		{"pdf", http.MethodGet, base + "?format=PDF", http.StatusOK, "application/pdf", "%PDF-"},
+		{"unsupported format", http.MethodGet, base + "?format=docx", http.StatusBadRequest, "application/json", "{"},
+		{"unknown id", http.MethodGet, "/api/v1/analyses/NZ-missing/report", http.StatusNotFound, "application/json", "{"},
+		{"wrong method", http.MethodPost, base, http.StatusMethodNotAllowed, "application/json", "{"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if !strings.HasPrefix(rr.Body.String(), tt.prefix) {
+				t.Errorf("body starts %q, want prefix %q", rr.Body.String()[:min(rr.Body.Len(), 20)], tt.prefix)
+			}
+		})
+	}
+}
+
+func TestGraphHandlers(t *testing.T) {
+	l := logger.NewLogger()
+	cfg := &config.Config{}
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "analyses.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	svc := services.NewAnalysisService(l, db, cfg)
+	server := NewServer(svc, l, cfg)
+	if _, err := svc.PerformAnalysis(context.Background(), "http://example.com/login"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		status      int
+		contentType string
+		contains    string
+	}{
+		{"whole graph", http.MethodGet, "/api/v1/graph", http.StatusOK, "application/json", `"DOMAIN:example.com"`},
+		{"neighbors", http.MethodGet, "/api/v1/graph?node=example.com&depth=1", http.StatusOK, "application/json", `"URL:http://example.com/login"`},
+		{"graphml", http.MethodGet, "/api/v1/graph?node=example.com&format=graphml", http.StatusOK, "application/graphml+xml", "<graphml"},
+		{"cytoscape", http.MethodGet, "/api/v1/graph?format=cytoscape", http.StatusOK, "application/json", `"elements"`},
+		{"dot", http.MethodGet, "/api/v1/graph?format=DOT", http.StatusOK, "text/vnd.graphviz", "digraph infrastructure"},
+		{"unknown node", http.MethodGet, "/api/v1/graph?node=never-seen.example", http.StatusNotFound, "application/json", "error"},
+		{"bad depth", http.MethodGet, "/api/v1/graph?node=example.com&depth=9", http.StatusBadRequest, "application/json", "depth"},
+		{"unsupported format", http.MethodGet, "/api/v1/graph?format=svg", http.StatusBadRequest, "application/json", "graphml"},
+		{"wrong method", http.MethodPost, "/api/v1/graph", http.StatusMethodNotAllowed, "application/json", "error"},
+		{"path", http.MethodGet, "/api/v1/graph/path?from=http://example.com/login&to=DOMAIN:example.com", http.StatusOK, "application/json", `"ON_HOST"`},
+		{"path without to", http.MethodGet, "/api/v1/graph/path?from=example.com", http.StatusBadRequest, "application/json", "required"},
+		{"clusters", http.MethodGet, "/api/v1/graph/clusters?min_analyses=1", http.StatusOK, "application/json", `"clusters":[{`},
+		{"no shared clusters", http.MethodGet, "/api/v1/graph/clusters", http.StatusOK, "application/json", `"clusters":[]`},
+		{"bad min_analyses", http.MethodGet, "/api/v1/graph/clusters?min_analyses=0", http.StatusBadRequest, "application/json", "min_analyses"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if !strings.Contains(rr.Body.String(), tt.contains) {
+				t.Errorf("body does not contain %q: %s", tt.contains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestCampaignHandlers(t *testing.T) {
+	l := logger.NewLogger()
+	cfg := &config.Config{}
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "analyses.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, target := range []string{"https://parcel-fee.example/", "https://redelivery-now.example/"} {
+		f := storage.CampaignFeatures{
+			AnalysisID: "NZ-" + strconv.Itoa(i+1), Target: target, RiskLevel: "HIGH",
+			AnalyzedAt: at.AddDate(0, 0, i), Certificates: []string{"abcdef"},
+		}
+		if err := db.SaveCampaignFeatures(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := NewServer(services.NewAnalysisService(l, db, cfg), l, cfg)
+
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/campaigns", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+	var list struct {
+		Campaigns []struct {
+			ID      string `json:"id"`
+			Members []struct {
+				AnalysisID string `json:"analysis_id"`
+			} `json:"members"`
+			Timeline []struct {
+				Date string `json:"date"`
+			} `json:"timeline"`
+		} `json:"campaigns"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Campaigns) != 1 || len(list.Campaigns[0].Members) != 2 || len(list.Campaigns[0].Timeline) != 2 {
+		t.Fatalf("campaigns = %s", rr.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		status   int
+		contains string
+	}{
+		{"by ID", http.MethodGet, "/api/v1/campaigns/" + list.Campaigns[0].ID, http.StatusOK, `"analysis_id":"NZ-2"`},
+		{"unknown ID", http.MethodGet, "/api/v1/campaigns/CMP-0000000000", http.StatusNotFound, "Campaign not found"},
+		{"wrong method", http.MethodPost, "/api/v1/campaigns", http.StatusMethodNotAllowed, "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.contains) {
+				t.Errorf("body does not contain %q: %s", tt.contains, rr.Body.String())
+			}
+		})
+	}
+}
@@ -13,10 +13,12 @@ type Config struct {
 	Security    SecurityConfig    `mapstructure:"security"`
 	AI          AIConfig          `mapstructure:"ai"`
 	Network     NetworkConfig     `mapstructure:"network"`
+	GeoIP       GeoIPConfig       `mapstructure:"geoip"`
 	ThreatIntel ThreatIntelConfig `mapstructure:"threat_intel"`
 	Sandbox     SandboxConfig     `mapstructure:"sandbox"`
 	Analysis    *AnalysisConfig   `mapstructure:"analysis"`
 	Output      OutputConfig      `mapstructure:"output"`
+	Storage     StorageConfig     `mapstructure:"storage"`
 }
 
 type ServerConfig struct {
@@ -26,8 +28,13 @@ type ServerConfig struct {
 	Port      int    `mapstructure:"port"`
 }
 
+// ServiceConfig controls how analyses are coordinated. Replicas behind a load
+// balancer share locks and cached reports through RedisURL; without it both
+// live in process memory.
 type ServiceConfig struct {
-	WaitForDuplicateAnalysis bool `mapstructure:"wait_for_duplicate_analysis"`
+	WaitForDuplicateAnalysis bool   `mapstructure:"wait_for_duplicate_analysis"`
+	RedisURL                 string `mapstructure:"redis_url"`  // redis://[:password@]host:port/db, or any server speaking the Redis protocol
+	KeyPrefix                string `mapstructure:"key_prefix"` // Namespace for shared keys; defaults to "netzilla:"
 }
 
 type SecurityConfig struct {
@@ -38,14 +45,43 @@ type SecurityConfig struct {
 type AIConfig struct {
 	EnableAI            bool    `mapstructure:"enable_ai"`
 	ConfidenceThreshold float64 `mapstructure:"confidence_threshold"`
+	ModelPath           string  `mapstructure:"model_path"` // Trained URL classifier from `netzilla model train`; empty uses heuristics
+
+	// Optional OpenAI-compatible server (llama.cpp, Ollama, vLLM) used to write
+	// analyst explanations. Without an endpoint a built-in summary is used.
+	LLMEndpoint     string        `mapstructure:"llm_endpoint"`
+	LLMModel        string        `mapstructure:"llm_model"`
+	LLMAPIKey       string        `mapstructure:"llm_api_key"`
+	LLMPromptTokens int           `mapstructure:"llm_prompt_tokens"` // Estimated prompt budget
+	LLMMaxTokens    int           `mapstructure:"llm_max_tokens"`    // Completion budget
+	LLMTimeout      time.Duration `mapstructure:"llm_timeout"`
 }
 
 type NetworkConfig struct {
-	ProxyEnabled   bool   `mapstructure:"proxy_enabled"`
-	ProxyURL       string `mapstructure:"proxy_url"`
-	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
-	MaxRedirects   int    `mapstructure:"max_redirects"`
-	UserAgent      string `mapstructure:"user_agent"`
+	ProxyEnabled      bool   `mapstructure:"proxy_enabled"`
+	ProxyURL          string `mapstructure:"proxy_url"`
+	TimeoutSeconds    int    `mapstructure:"timeout_seconds"`
+	MaxRedirects      int    `mapstructure:"max_redirects"`
+	RedirectMaxBytes  int64  `mapstructure:"redirect_max_bytes"` // Body bytes scanned per chain for client-side redirects
+	UserAgent         string `mapstructure:"user_agent"`
+	TLSFingerprintDB  string `mapstructure:"tls_fingerprint_db"` // type,fingerprint,label list of known-bad JARM/JA3S
+	TracerouteMode    string `mapstructure:"traceroute_mode"`    // icmp, udp or tcp
+	TracerouteMaxHops int    `mapstructure:"traceroute_max_hops"`
+	TracerouteProbes  int    `mapstructure:"traceroute_probes"` // Probes per hop, used for loss and jitter
+	CassetteMode      string `mapstructure:"cassette_mode"`     // record or replay network responses; empty for live
+	CassettePath      string `mapstructure:"cassette_path"`     // Cassette file written by record, read by replay
+}
+
+// GeoIPConfig selects the offline geolocation sources. Every path is optional; the
+// online APIs are only consulted when OnlineFallback is set.
+type GeoIPConfig struct {
+	CityDB         string `mapstructure:"city_db"`   // MaxMind GeoLite2/GeoIP2 City .mmdb
+	ASNDB          string `mapstructure:"asn_db"`    // MaxMind GeoLite2/GeoIP2 ASN .mmdb
+	ASNTable       string `mapstructure:"asn_table"` // iptoasn.com ip2asn TSV or "cidr<TAB>asn<TAB>country<TAB>org"
+	HostingCIDRs   string `mapstructure:"hosting_cidrs"`
+	VPNCIDRs       string `mapstructure:"vpn_cidrs"`
+	TorExitCIDRs   string `mapstructure:"tor_exit_cidrs"`
+	OnlineFallback bool   `mapstructure:"online_fallback"`
 }
 
 type ThreatIntelConfig struct {
@@ -54,17 +90,26 @@ type ThreatIntelConfig struct {
 }
 
 type SandboxConfig struct {
-	Enabled        bool   `mapstructure:"enabled"`
-	Type           string `mapstructure:"type"`
-	DockerImage    string `mapstructure:"docker_image"`
-	TimeoutMinutes int    `mapstructure:"timeout_minutes"`
-	AutoDestroy    bool   `mapstructure:"auto_destroy"`
+	Enabled        bool    `mapstructure:"enabled"`
+	Type           string  `mapstructure:"type"`
+	DockerImage    string  `mapstructure:"docker_image"`
+	TimeoutMinutes int     `mapstructure:"timeout_minutes"`
+	AutoDestroy    bool    `mapstructure:"auto_destroy"`
+	DockerSocket   string  `mapstructure:"docker_socket"` // Engine API socket; defaults to /var/run/docker.sock
+	Network        string  `mapstructure:"network"`       // Internal Docker network that only reaches the proxy; empty disables networking
+	ProxyURL       string  `mapstructure:"proxy_url"`     // Egress proxy the browser must use
+	MemoryMB       int     `mapstructure:"memory_mb"`
+	CPUs           float64 `mapstructure:"cpus"`
+	PidsLimit      int     `mapstructure:"pids_limit"`
+	ArtifactDir    string  `mapstructure:"artifact_dir"` // Where HAR, screenshots and DOM are copied
 }
 
 type AnalysisConfig struct {
 	DeepScan          bool              `mapstructure:"deep_scan"`
 	ScoringThresholds ScoringThresholds `mapstructure:"scoring_thresholds"`
 	TimeoutSeconds    int               `mapstructure:"timeout_seconds"`
+	YaraRules         string            `mapstructure:"yara_rules"`        // .yar file or directory added to the built-in file analysis rules
+	CorrelationRules  string            `mapstructure:"correlation_rules"` // .rules file or directory added to the built-in correlation rules
 }
 
 type ScoringThresholds struct {
@@ -73,6 +118,13 @@ type ScoringThresholds struct {
 	LowRisk    int `mapstructure:"low_risk"`
 }
 
+// StorageConfig selects where analyses and threat intelligence are kept. Several
+// API instances can share one store by pointing them at the same PostgreSQL DSN.
+type StorageConfig struct {
+	Driver string `mapstructure:"driver"` // sqlite (default) or postgres
+	DSN    string `mapstructure:"dsn"`    // SQLite file path, or a lib/pq URL or key=value string
+}
+
 type OutputConfig struct {
 	SaveReports  bool   `mapstructure:"save_reports"`
 	ReportFormat string `mapstructure:"report_format"`
@@ -94,6 +146,12 @@ func Load() (*Config, error) {
 	viper.BindEnv("threat_intel.vt_key", "VT_API_KEY")
 	viper.BindEnv("threat_intel.abuse_key", "ABUSEIPDB_API_KEY")
 	viper.BindEnv("threat_intel.av_key", "ALIENVAULT_API_KEY")
+	viper.BindEnv("network.cassette_mode", "NETZILLA_CASSETTE_MODE")
+	viper.BindEnv("network.cassette_path", "NETZILLA_CASSETTE")
+	viper.BindEnv("ai.llm_api_key", "NETZILLA_LLM_API_KEY")
+	viper.BindEnv("storage.driver", "NETZILLA_DB_DRIVER")
+	viper.BindEnv("storage.dsn", "NETZILLA_DB_DSN")
+	viper.BindEnv("service.redis_url", "NETZILLA_REDIS_URL")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("error reading config: %w", err)
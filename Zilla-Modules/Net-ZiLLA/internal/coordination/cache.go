@@ -0,0 +1,29 @@
+package coordination
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrStaleToken is returned by SetFenced when the entry was last written under
+// a larger fencing token.
+var ErrStaleToken = errors.New("fencing token is older than the stored one")
+
+// CacheProvider stores opaque values with a time to live. Values are bytes so
+// that every implementation, local or remote, hands out independent copies.
+type CacheProvider interface {
+	// Get returns the value stored under key and whether it was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value, keeping the fencing token of the entry it replaces.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetFenced stores value written under the lock with token. It fails with
+	// ErrStaleToken, changing nothing, if key was written under a larger token,
+	// so a holder whose lock expired cannot replace its successor's value.
+	SetFenced(ctx context.Context, key string, value []byte, token int64, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Clear removes every entry and returns how many were removed.
+	Clear(ctx context.Context) (int, error)
+	// Len counts the live entries.
+	Len(ctx context.Context) (int, error)
+}
@@ -0,0 +1,264 @@
+package coordination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type backend struct {
+	name string
+	// locks also returns a function that makes the lock on a key expire now.
+	locks func(t *testing.T) (LockProvider, func(key string))
+	cache func(t *testing.T) CacheProvider
+}
+
+func backends() []backend {
+	return []backend{
+		{
+			name: "memory",
+			locks: func(t *testing.T) (LockProvider, func(string)) {
+				m := NewMemoryLocks()
+				return m, func(key string) {
+					m.mu.Lock()
+					l := m.locks[key]
+					l.ExpiresAt = time.Now()
+					m.locks[key] = l
+					m.mu.Unlock()
+				}
+			},
+			cache: func(t *testing.T) CacheProvider { return NewMemoryCache(3) },
+		},
+		{
+			name: "redis",
+			locks: func(t *testing.T) (LockProvider, func(string)) {
+				stub := newRedisStub(t)
+				r := NewRedisLocks(redisClient(t, stub), "test:")
+				return r, func(key string) { stub.expire(r.lockKey(key)) }
+			},
+			cache: func(t *testing.T) CacheProvider {
+				return NewRedisCache(redisClient(t, newRedisStub(t)), "test:")
+			},
+		},
+	}
+}
+
+func redisClient(t *testing.T, stub *redisStub) *redis.Client {
+	t.Helper()
+	client, err := NewRedisClient(context.Background(), stub.URL())
+	if err != nil {
+		t.Fatalf("NewRedisClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestLockProviders(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			locks, expire := b.locks(t)
+
+			first, err := locks.TryAcquire(ctx, "http://a.example", "replica-1", time.Minute)
+			if err != nil || first == nil {
+				t.Fatalf("first acquire = %v, %v", first, err)
+			}
+			if second, err := locks.TryAcquire(ctx, "http://a.example", "replica-2", time.Minute); err != nil || second != nil {
+				t.Fatalf("second acquire should fail while held, got %v, %v", second, err)
+			}
+			if held, _ := locks.Held(ctx, "http://a.example"); !held {
+				t.Error("lock should be held")
+			}
+			other, err := locks.TryAcquire(ctx, "http://b.example", "replica-2", time.Minute)
+			if err != nil || other == nil {
+				t.Fatalf("independent key acquire = %v, %v", other, err)
+			}
+			if other.Token <= first.Token {
+				t.Errorf("tokens must increase: %d then %d", first.Token, other.Token)
+			}
+
+			// A holder whose lock expired and was taken over cannot release it.
+			expire("http://a.example")
+			next, err := locks.TryAcquire(ctx, "http://a.example", "replica-2", time.Minute)
+			if err != nil || next == nil {
+				t.Fatalf("acquire after expiry = %v, %v", next, err)
+			}
+			if next.Token <= other.Token {
+				t.Errorf("token after takeover %d not above %d", next.Token, other.Token)
+			}
+			if err := locks.Release(ctx, first); !errors.Is(err, ErrLockLost) {
+				t.Errorf("stale release = %v, want ErrLockLost", err)
+			}
+			if held, _ := locks.Held(ctx, "http://a.example"); !held {
+				t.Error("stale release must not free the new holder's lock")
+			}
+			if err := locks.Release(ctx, next); err != nil {
+				t.Errorf("release: %v", err)
+			}
+			if held, _ := locks.Held(ctx, "http://a.example"); held {
+				t.Error("lock should be free after release")
+			}
+		})
+	}
+}
+
+func TestLockProviders_WaitRelease(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			locks, _ := b.locks(t)
+
+			if err := locks.WaitRelease(ctx, "free"); err != nil {
+				t.Fatalf("waiting on a free lock: %v", err)
+			}
+
+			lock, _ := locks.TryAcquire(ctx, "busy", "replica-1", time.Minute)
+			woke := make(chan error, 1)
+			go func() { woke <- locks.WaitRelease(ctx, "busy") }()
+
+			select {
+			case err := <-woke:
+				t.Fatalf("WaitRelease returned while held: %v", err)
+			case <-time.After(100 * time.Millisecond):
+			}
+			start := time.Now()
+			if err := locks.Release(ctx, lock); err != nil {
+				t.Fatalf("release: %v", err)
+			}
+			if err := <-woke; err != nil {
+				t.Fatalf("WaitRelease: %v", err)
+			}
+			// Woken by the release itself, not by the expiry poll.
+			if waited := time.Since(start); waited > 500*time.Millisecond {
+				t.Errorf("waiter woke %v after release", waited)
+			}
+
+			lock, _ = locks.TryAcquire(ctx, "busy", "replica-1", time.Minute)
+			short, stop := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer stop()
+			if err := locks.WaitRelease(short, "busy"); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("WaitRelease past deadline = %v", err)
+			}
+			locks.Release(ctx, lock)
+		})
+	}
+}
+
+func TestCacheProviders(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := b.cache(t)
+
+			if _, ok, err := cache.Get(ctx, "missing"); ok || err != nil {
+				t.Fatalf("Get(missing) = %v, %v", ok, err)
+			}
+			if err := cache.Set(ctx, "http://a.example", []byte(`{"target":"a"}`), time.Minute); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			got, ok, err := cache.Get(ctx, "http://a.example")
+			if err != nil || !ok || string(got) != `{"target":"a"}` {
+				t.Fatalf("Get = %q, %v, %v", got, ok, err)
+			}
+			got[0] = 'X'
+			if again, _, _ := cache.Get(ctx, "http://a.example"); string(again) != `{"target":"a"}` {
+				t.Error("cached value changed through a returned slice")
+			}
+
+			cache.Set(ctx, "short", []byte("x"), 20*time.Millisecond)
+			time.Sleep(40 * time.Millisecond)
+			if _, ok, _ := cache.Get(ctx, "short"); ok {
+				t.Error("entry should have expired")
+			}
+
+			cache.Set(ctx, "b", []byte("b"), time.Minute)
+			cache.Delete(ctx, "b")
+			if _, ok, _ := cache.Get(ctx, "b"); ok {
+				t.Error("deleted entry still present")
+			}
+
+			for i := 0; i < 2; i++ {
+				cache.Set(ctx, fmt.Sprintf("k%d", i), []byte("v"), time.Minute)
+			}
+			if n, err := cache.Len(ctx); err != nil || n != 3 {
+				t.Errorf("Len = %d, %v; want 3", n, err)
+			}
+			if n, err := cache.Clear(ctx); err != nil || n != 3 {
+				t.Errorf("Clear = %d, %v; want 3", n, err)
+			}
+			if n, _ := cache.Len(ctx); n != 0 {
+				t.Errorf("Len after Clear = %d", n)
+			}
+		})
+	}
+}
+
+func TestCacheProviders_Fenced(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := b.cache(t)
+
+			if err := cache.SetFenced(ctx, "http://a.example", []byte("second"), 2, time.Minute); err != nil {
+				t.Fatalf("SetFenced(2): %v", err)
+			}
+			if err := cache.SetFenced(ctx, "http://a.example", []byte("first"), 1, time.Minute); !errors.Is(err, ErrStaleToken) {
+				t.Errorf("SetFenced with an older token = %v, want ErrStaleToken", err)
+			}
+			if got, _, _ := cache.Get(ctx, "http://a.example"); string(got) != "second" {
+				t.Errorf("stale write replaced the value: %q", got)
+			}
+
+			// An unfenced update keeps the token, so the stale writer stays out
+			cache.Set(ctx, "http://a.example", []byte("second, updated"), time.Minute)
+			if err := cache.SetFenced(ctx, "http://a.example", []byte("first"), 1, time.Minute); !errors.Is(err, ErrStaleToken) {
+				t.Errorf("SetFenced after Set = %v, want ErrStaleToken", err)
+			}
+			if err := cache.SetFenced(ctx, "http://a.example", []byte("third"), 3, time.Minute); err != nil {
+				t.Errorf("SetFenced with a newer token: %v", err)
+			}
+			if got, _, _ := cache.Get(ctx, "http://a.example"); string(got) != "third" {
+				t.Errorf("Get = %q, want the newest write", got)
+			}
+			if n, _ := cache.Len(ctx); n != 1 {
+				t.Errorf("Len = %d, fencing tokens must not count as entries", n)
+			}
+		})
+	}
+}
+
+func TestMemoryCache_Bounded(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(2)
+	cache.Set(ctx, "oldest", []byte("1"), time.Minute)
+	cache.Set(ctx, "newer", []byte("2"), 2*time.Minute)
+	cache.Set(ctx, "newest", []byte("3"), 3*time.Minute)
+
+	if n, _ := cache.Len(ctx); n != 2 {
+		t.Fatalf("Len = %d, want 2", n)
+	}
+	if _, ok, _ := cache.Get(ctx, "oldest"); ok {
+		t.Error("the entry closest to expiry should have been evicted")
+	}
+}
+
+func TestRedisCache_ClearKeepsOtherKeys(t *testing.T) {
+	ctx := context.Background()
+	stub := newRedisStub(t)
+	client := redisClient(t, stub)
+	client.Set(ctx, "unrelated", "keep", 0)
+
+	cache := NewRedisCache(client, "")
+	cache.Set(ctx, "http://a.example", []byte("a"), time.Minute)
+	if n, err := cache.Clear(ctx); err != nil || n != 1 {
+		t.Fatalf("Clear = %d, %v", n, err)
+	}
+	if v, _ := client.Get(ctx, "unrelated").Result(); v != "keep" {
+		t.Errorf("Clear removed a key outside the cache prefix")
+	}
+}
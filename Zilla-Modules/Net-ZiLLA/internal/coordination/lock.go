@@ -0,0 +1,42 @@
+// Package coordination lets several AnalysisService replicas share work: a
+// LockProvider makes sure only one of them analyzes a target at a time and a
+// CacheProvider lets the others reuse the result. The memory implementations
+// suit a single process; the Redis ones are shared by every replica pointed at
+// the same server.
+package coordination
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLockLost is returned by Release when the lock expired and was taken by
+// another owner, or was already released.
+var ErrLockLost = errors.New("lock no longer held")
+
+// Lock is a held lock. Token is a fencing token: every successful acquisition
+// gets a larger token than the ones before it, so a writer can reject work from
+// a holder whose lock expired while it was paused. CacheProvider.SetFenced is
+// such a writer.
+type Lock struct {
+	Key       string
+	Owner     string
+	Token     int64
+	ExpiresAt time.Time
+}
+
+// LockProvider hands out exclusive, expiring locks keyed by name.
+type LockProvider interface {
+	// TryAcquire takes the lock for ttl without waiting. It returns nil and no
+	// error when another owner holds the lock.
+	TryAcquire(ctx context.Context, key, owner string, ttl time.Duration) (*Lock, error)
+	// Release gives the lock back. It returns ErrLockLost if lock is no longer
+	// the current holder, in which case nothing is changed.
+	Release(ctx context.Context, lock *Lock) error
+	// Held reports whether anyone holds the lock.
+	Held(ctx context.Context, key string) (bool, error)
+	// WaitRelease blocks until the lock is free, either released or expired,
+	// or ctx is done.
+	WaitRelease(ctx context.Context, key string) error
+}
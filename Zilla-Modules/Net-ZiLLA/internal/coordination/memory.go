@@ -0,0 +1,242 @@
+package coordination
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLocks is a LockProvider for a single process.
+type MemoryLocks struct {
+	mu      sync.Mutex
+	locks   map[string]Lock
+	waiters map[string][]chan struct{}
+	fence   int64
+}
+
+// NewMemoryLocks returns an empty in-process lock table.
+func NewMemoryLocks() *MemoryLocks {
+	return &MemoryLocks{
+		locks:   make(map[string]Lock),
+		waiters: make(map[string][]chan struct{}),
+	}
+}
+
+// TryAcquire implements LockProvider.
+func (m *MemoryLocks) TryAcquire(ctx context.Context, key, owner string, ttl time.Duration) (*Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if held, ok := m.locks[key]; ok && now.Before(held.ExpiresAt) {
+		return nil, nil
+	}
+	m.fence++
+	lock := Lock{Key: key, Owner: owner, Token: m.fence, ExpiresAt: now.Add(ttl)}
+	m.locks[key] = lock
+	return &lock, nil
+}
+
+// Release implements LockProvider.
+func (m *MemoryLocks) Release(ctx context.Context, lock *Lock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	held, ok := m.live(lock.Key)
+	if !ok || held.Token != lock.Token {
+		return ErrLockLost
+	}
+	delete(m.locks, lock.Key)
+	for _, ch := range m.waiters[lock.Key] {
+		close(ch)
+	}
+	delete(m.waiters, lock.Key)
+	return nil
+}
+
+// Held implements LockProvider.
+func (m *MemoryLocks) Held(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.live(key)
+	return ok, nil
+}
+
+// WaitRelease implements LockProvider.
+func (m *MemoryLocks) WaitRelease(ctx context.Context, key string) error {
+	for {
+		m.mu.Lock()
+		held, ok := m.live(key)
+		if !ok {
+			m.mu.Unlock()
+			return nil
+		}
+		ch := make(chan struct{})
+		m.waiters[key] = append(m.waiters[key], ch)
+		m.mu.Unlock()
+
+		expiry := time.NewTimer(time.Until(held.ExpiresAt))
+		select {
+		case <-ch:
+		case <-expiry.C:
+		case <-ctx.Done():
+			expiry.Stop()
+			return ctx.Err()
+		}
+		expiry.Stop()
+	}
+}
+
+// live returns the unexpired lock on key, dropping an expired one. m.mu must
+// be held.
+func (m *MemoryLocks) live(key string) (Lock, bool) {
+	held, ok := m.locks[key]
+	if !ok {
+		return Lock{}, false
+	}
+	if time.Now().Before(held.ExpiresAt) {
+		return held, true
+	}
+	delete(m.locks, key)
+	for _, ch := range m.waiters[key] {
+		close(ch)
+	}
+	delete(m.waiters, key)
+	return Lock{}, false
+}
+
+// MemoryCache is a CacheProvider for a single process. Expired entries are
+// dropped when they are read or when the cache is full.
+type MemoryCache struct {
+	mu         sync.Mutex
+	entries    map[string]memoryEntry
+	maxEntries int
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+	token     int64 // Fencing token of the last SetFenced
+}
+
+// NewMemoryCache returns a cache holding at most maxEntries values; zero or
+// less means unbounded.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		entries:    make(map[string]memoryEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// Get implements CacheProvider.
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !time.Now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+// Set implements CacheProvider.
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.put(key, value, c.liveToken(key), ttl)
+	return nil
+}
+
+// SetFenced implements CacheProvider.
+func (c *MemoryCache) SetFenced(ctx context.Context, key string, value []byte, token int64, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.liveToken(key) > token {
+		return ErrStaleToken
+	}
+	c.put(key, value, token, ttl)
+	return nil
+}
+
+// liveToken returns the fencing token of the live entry under key, or zero.
+// c.mu must be held.
+func (c *MemoryCache) liveToken(key string) int64 {
+	entry, ok := c.entries[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return 0
+	}
+	return entry.token
+}
+
+// put stores an entry, evicting another if the cache is full. c.mu must be held.
+func (c *MemoryCache) put(key string, value []byte, token int64, ttl time.Duration) {
+	if _, exists := c.entries[key]; !exists && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.entries[key] = memoryEntry{
+		value:     append([]byte(nil), value...),
+		expiresAt: time.Now().Add(ttl),
+		token:     token,
+	}
+}
+
+// evict makes room for one entry: expired entries go first, then the entry
+// closest to expiry. c.mu must be held.
+func (c *MemoryCache) evict() {
+	now := time.Now()
+	oldestKey := ""
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || entry.expiresAt.Before(oldest) {
+			oldestKey, oldest = key, entry.expiresAt
+		}
+	}
+	if len(c.entries) >= c.maxEntries && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// Delete implements CacheProvider.
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+	return nil
+}
+
+// Clear implements CacheProvider.
+func (c *MemoryCache) Clear(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[string]memoryEntry)
+	return n, nil
+}
+
+// Len implements CacheProvider.
+func (c *MemoryCache) Len(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, entry := range c.entries {
+		if now.Before(entry.expiresAt) {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,257 @@
+package coordination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultKeyPrefix namespaces the keys Net-Zilla writes to a shared server.
+const DefaultKeyPrefix = "netzilla:"
+
+// releasePollInterval bounds how long WaitRelease can miss a lock that expired
+// instead of being released, since expiry publishes nothing.
+const releasePollInterval = time.Second
+
+// releaseScript deletes the lock only if it still holds the caller's value, so
+// a holder whose lock expired cannot free its successor's lock.
+const releaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+
+var releaser = redis.NewScript(releaseScript)
+
+// fencedSetScript writes a cache value and its fencing token unless the token
+// stored for the key is larger. KEYS: value, token; ARGV: value, token, TTL ms.
+const fencedSetScript = `local current = tonumber(redis.call("GET", KEYS[2]) or "0")
+if current > tonumber(ARGV[2]) then return 0 end
+redis.call("SET", KEYS[2], ARGV[2], "PX", ARGV[3])
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+return 1`
+
+var fencedSetter = redis.NewScript(fencedSetScript)
+
+// NewRedisClient connects to the server at a redis:// or rediss:// URL and
+// checks that it answers.
+func NewRedisClient(ctx context.Context, url string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis ping failed: %w", err)
+	}
+	return client, nil
+}
+
+// RedisLocks is a LockProvider shared through a Redis-protocol server. Locks
+// are SET NX PX keys whose value carries the owner and fencing token; tokens
+// come from a single INCR counter. Releases are published so WaitRelease
+// wakes without polling.
+type RedisLocks struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisLocks returns locks stored under prefix, DefaultKeyPrefix if empty.
+func NewRedisLocks(client *redis.Client, prefix string) *RedisLocks {
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+	return &RedisLocks{client: client, prefix: prefix}
+}
+
+func (r *RedisLocks) lockKey(key string) string  { return r.prefix + "lock:" + key }
+func (r *RedisLocks) channel(key string) string  { return r.prefix + "released:" + key }
+func (r *RedisLocks) fenceKey() string           { return r.prefix + "fence" }
+func lockValue(owner string, token int64) string { return owner + "|" + strconv.FormatInt(token, 10) }
+
+// TryAcquire implements LockProvider. A token is drawn even when the lock is
+// busy; tokens only need to increase, not be contiguous.
+func (r *RedisLocks) TryAcquire(ctx context.Context, key, owner string, ttl time.Duration) (*Lock, error) {
+	token, err := r.client.Incr(ctx, r.fenceKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("fencing token: %w", err)
+	}
+	expiresAt := time.Now().Add(ttl)
+	ok, err := r.client.SetNX(ctx, r.lockKey(key), lockValue(owner, token), ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", key, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &Lock{Key: key, Owner: owner, Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// Release implements LockProvider.
+func (r *RedisLocks) Release(ctx context.Context, lock *Lock) error {
+	deleted, err := releaser.Run(ctx, r.client, []string{r.lockKey(lock.Key)}, lockValue(lock.Owner, lock.Token)).Int()
+	if err != nil {
+		return fmt.Errorf("unlock %s: %w", lock.Key, err)
+	}
+	if deleted == 0 {
+		return ErrLockLost
+	}
+	if err := r.client.Publish(ctx, r.channel(lock.Key), strconv.FormatInt(lock.Token, 10)).Err(); err != nil {
+		return fmt.Errorf("announce release of %s: %w", lock.Key, err)
+	}
+	return nil
+}
+
+// Held implements LockProvider.
+func (r *RedisLocks) Held(ctx context.Context, key string) (bool, error) {
+	n, err := r.client.Exists(ctx, r.lockKey(key)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// WaitRelease implements LockProvider. It subscribes before checking the lock
+// so a release between the two cannot be missed.
+func (r *RedisLocks) WaitRelease(ctx context.Context, key string) error {
+	sub := r.client.Subscribe(ctx, r.channel(key))
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+
+	for {
+		held, err := r.Held(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !held {
+			return nil
+		}
+		msg, err := sub.ReceiveTimeout(ctx, releasePollInterval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		if _, ok := msg.(*redis.Message); ok {
+			return nil
+		}
+	}
+}
+
+// RedisCache is a CacheProvider shared through a Redis-protocol server; the
+// server enforces the TTL. Fencing tokens are kept in keys of their own,
+// outside the cache prefix, so that Len and Clear see only values.
+type RedisCache struct {
+	client      *redis.Client
+	prefix      string
+	fencePrefix string
+}
+
+// NewRedisCache returns a cache stored under prefix, DefaultKeyPrefix if empty.
+func NewRedisCache(client *redis.Client, prefix string) *RedisCache {
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+	return &RedisCache{client: client, prefix: prefix + "cache:", fencePrefix: prefix + "cache-fence:"}
+}
+
+// Get implements CacheProvider.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set implements CacheProvider.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+}
+
+// SetFenced implements CacheProvider.
+func (c *RedisCache) SetFenced(ctx context.Context, key string, value []byte, token int64, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	written, err := fencedSetter.Run(ctx, c.client, []string{c.prefix + key, c.fencePrefix + key}, value, token, ms).Int()
+	if err != nil {
+		return err
+	}
+	if written == 0 {
+		return ErrStaleToken
+	}
+	return nil
+}
+
+// Delete implements CacheProvider.
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, c.prefix+key).Err()
+}
+
+// Clear implements CacheProvider. Only keys under the cache prefix are
+// removed, so a server shared with other data is safe to clear.
+func (c *RedisCache) Clear(ctx context.Context) (int, error) {
+	removed := 0
+	err := c.scan(ctx, func(keys []string) error {
+		n, err := c.client.Del(ctx, keys...).Result()
+		removed += int(n)
+		return err
+	})
+	return removed, err
+}
+
+// Len implements CacheProvider.
+func (c *RedisCache) Len(ctx context.Context) (int, error) {
+	n := 0
+	err := c.scan(ctx, func(keys []string) error {
+		n += len(keys)
+		return nil
+	})
+	return n, err
+}
+
+func (c *RedisCache) scan(ctx context.Context, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := c.client.Scan(ctx, cursor, globEscape(c.prefix)+"*", 100).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// globEscape quotes the characters SCAN MATCH treats as patterns.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,297 @@
+package coordination
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redisStub speaks enough of the Redis protocol for the providers in this
+// package: strings with expiry, INCR, SCAN, pub/sub, and the release and fenced
+// set scripts.
+type redisStub struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	values map[string]stubValue
+	subs   map[string]map[*stubConn]bool
+}
+
+type stubValue struct {
+	data      string
+	expiresAt time.Time // zero for no expiry
+}
+
+type stubConn struct {
+	net.Conn
+	wmu sync.Mutex
+	w   *bufio.Writer
+}
+
+func newRedisStub(t *testing.T) *redisStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &redisStub{ln: ln, values: make(map[string]stubValue), subs: make(map[string]map[*stubConn]bool)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(&stubConn{Conn: c, w: bufio.NewWriter(c)})
+		}
+	}()
+	return s
+}
+
+func (s *redisStub) URL() string { return "redis://" + s.ln.Addr().String() }
+
+func (s *redisStub) serve(c *stubConn) {
+	defer func() {
+		s.mu.Lock()
+		for _, conns := range s.subs {
+			delete(conns, c)
+		}
+		s.mu.Unlock()
+		c.Close()
+	}()
+	r := bufio.NewReader(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		c.reply(s.exec(c, args)...)
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// Replies are pre-encoded RESP values.
+func simple(s string) string   { return "+" + s + "\r\n" }
+func errReply(s string) string { return "-" + s + "\r\n" }
+func integer(n int64) string   { return ":" + strconv.FormatInt(n, 10) + "\r\n" }
+func bulk(s string) string     { return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n" }
+
+const nilBulk = "$-1\r\n"
+
+func array(items ...string) string {
+	return "*" + strconv.Itoa(len(items)) + "\r\n" + strings.Join(items, "")
+}
+
+func (c *stubConn) reply(replies ...string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for _, r := range replies {
+		c.w.WriteString(r)
+	}
+	c.w.Flush()
+}
+
+// get returns the live value of key. s.mu must be held.
+func (s *redisStub) get(key string) (stubValue, bool) {
+	v, ok := s.values[key]
+	if ok && !v.expiresAt.IsZero() && !time.Now().Before(v.expiresAt) {
+		delete(s.values, key)
+		return stubValue{}, false
+	}
+	return v, ok
+}
+
+func (s *redisStub) exec(c *stubConn, args []string) []string {
+	if len(args) == 0 {
+		return []string{errReply("ERR empty command")}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch cmd := strings.ToUpper(args[0]); cmd {
+	case "PING":
+		return []string{simple("PONG")}
+	case "SELECT":
+		return []string{simple("OK")}
+	case "GET":
+		if v, ok := s.get(args[1]); ok {
+			return []string{bulk(v.data)}
+		}
+		return []string{nilBulk}
+	case "SET":
+		key, v := args[1], stubValue{data: args[2]}
+		nx := false
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX", "EX":
+				n, _ := strconv.Atoi(args[i+1])
+				unit := time.Millisecond
+				if strings.ToUpper(args[i]) == "EX" {
+					unit = time.Second
+				}
+				v.expiresAt = time.Now().Add(time.Duration(n) * unit)
+				i++
+			}
+		}
+		if _, exists := s.get(key); exists && nx {
+			return []string{nilBulk}
+		}
+		s.values[key] = v
+		return []string{simple("OK")}
+	case "DEL", "EXISTS":
+		var n int64
+		for _, key := range args[1:] {
+			if _, ok := s.get(key); ok {
+				n++
+				if cmd == "DEL" {
+					delete(s.values, key)
+				}
+			}
+		}
+		return []string{integer(n)}
+	case "INCR":
+		v, _ := s.get(args[1])
+		n, _ := strconv.ParseInt(v.data, 10, 64)
+		n++
+		s.values[args[1]] = stubValue{data: strconv.FormatInt(n, 10), expiresAt: v.expiresAt}
+		return []string{integer(n)}
+	case "SCAN":
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		var keys []string
+		for key := range s.values {
+			if _, ok := s.get(key); !ok {
+				continue
+			}
+			if globMatch(pattern, key) {
+				keys = append(keys, bulk(key))
+			}
+		}
+		return []string{array(bulk("0"), array(keys...))}
+	case "PUBLISH":
+		var n int64
+		for sub := range s.subs[args[1]] {
+			n++
+			go sub.reply(array(bulk("message"), bulk(args[1]), bulk(args[2])))
+		}
+		return []string{integer(n)}
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		var replies []string
+		for _, ch := range args[1:] {
+			if cmd == "SUBSCRIBE" {
+				if s.subs[ch] == nil {
+					s.subs[ch] = make(map[*stubConn]bool)
+				}
+				s.subs[ch][c] = true
+			} else {
+				delete(s.subs[ch], c)
+			}
+			replies = append(replies, array(bulk(strings.ToLower(cmd)), bulk(ch), integer(int64(len(s.subs[ch])))))
+		}
+		return replies
+	case "EVALSHA":
+		return []string{errReply("NOSCRIPT No matching script. Please use EVAL.")}
+	case "EVAL":
+		switch args[1] {
+		case releaseScript:
+			key, want := args[3], args[4]
+			if v, ok := s.get(key); ok && v.data == want {
+				delete(s.values, key)
+				return []string{integer(1)}
+			}
+			return []string{integer(0)}
+		case fencedSetScript:
+			valueKey, tokenKey, value, token, ttl := args[3], args[4], args[5], args[6], args[7]
+			current, _ := s.get(tokenKey)
+			have, _ := strconv.ParseInt(current.data, 10, 64)
+			want, _ := strconv.ParseInt(token, 10, 64)
+			if have > want {
+				return []string{integer(0)}
+			}
+			ms, _ := strconv.Atoi(ttl)
+			expiresAt := time.Now().Add(time.Duration(ms) * time.Millisecond)
+			s.values[tokenKey] = stubValue{data: token, expiresAt: expiresAt}
+			s.values[valueKey] = stubValue{data: value, expiresAt: expiresAt}
+			return []string{integer(1)}
+		}
+		return []string{errReply("ERR unknown script")}
+	default:
+		return []string{errReply("ERR unknown command '" + args[0] + "'")}
+	}
+}
+
+// expire ages key so that it expires now, standing in for waiting out a TTL.
+func (s *redisStub) expire(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.values[key]; ok {
+		v.expiresAt = time.Now()
+		s.values[key] = v
+	}
+}
+
+// globMatch implements the subset of Redis glob patterns SCAN needs here: *,
+// ? and backslash escapes. Unlike path.Match, * also matches "/".
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
@@ -0,0 +1,508 @@
+package correlation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/bits"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+	"net-zilla/internal/storage"
+)
+
+// CampaignConfig tunes campaign clustering. Two analyses are linked when the
+// weights of the signals they share reach Threshold, and a campaign is every
+// analysis reachable through such links.
+type CampaignConfig struct {
+	Threshold float64
+
+	CertificateWeight float64 // Same TLS certificate fingerprint
+	IPWeight          float64 // Same hosting or redirect IP
+	NameServerWeight  float64 // Same name server
+
+	PathWeight        float64 // Same landing path structure; partial matches scale it
+	MinPathSimilarity float64 // Share of path segments that must match for a partial match
+
+	ContentWeight      float64 // Landing pages within MaxSimhashDistance bits
+	MaxSimhashDistance int
+
+	// Same registrar with domains created within RegistrationWindow. Too
+	// weak to link analyses on its own with the default weights.
+	RegistrationWeight float64
+	RegistrationWindow time.Duration
+
+	// Infrastructure and path shapes seen in more analyses than this are
+	// ignored, so CDNs, parking IPs and popular DNS hosts do not merge
+	// everything into one campaign.
+	MaxShared int
+}
+
+// DefaultCampaignConfig links analyses sharing a certificate, an IP and a
+// name server, an IP and a path structure, or similar content and either a
+// path structure or a registration pattern.
+func DefaultCampaignConfig() CampaignConfig {
+	return CampaignConfig{
+		Threshold:          1.0,
+		CertificateWeight:  1.0,
+		IPWeight:           0.6,
+		NameServerWeight:   0.4,
+		PathWeight:         0.5,
+		MinPathSimilarity:  0.75,
+		ContentWeight:      0.7,
+		MaxSimhashDistance: 6,
+		RegistrationWeight: 0.3,
+		RegistrationWindow: 7 * 24 * time.Hour,
+		MaxShared:          25,
+	}
+}
+
+// Campaign is a group of analyses of different targets that share
+// infrastructure, URL structure, page content or registration patterns.
+type Campaign struct {
+	ID        string           `json:"id"`
+	FirstSeen time.Time        `json:"first_seen"`
+	LastSeen  time.Time        `json:"last_seen"`
+	RiskLevel string           `json:"risk_level"` // Worst verdict among the members
+	Targets   int              `json:"targets"`    // Distinct targets
+	Members   []CampaignMember `json:"members"`    // Oldest first
+	Evidence  []string         `json:"evidence"`   // Signals that linked the members
+	Timeline  []CampaignDay    `json:"timeline"`
+}
+
+// CampaignMember is one analysis in a campaign.
+type CampaignMember struct {
+	AnalysisID string    `json:"analysis_id"`
+	Target     string    `json:"target"`
+	AnalyzedAt time.Time `json:"analyzed_at"`
+	RiskLevel  string    `json:"risk_level"`
+}
+
+// CampaignDay summarizes the analyses of a campaign on one UTC day.
+type CampaignDay struct {
+	Date     string   `json:"date"` // YYYY-MM-DD
+	Analyses int      `json:"analyses"`
+	Targets  []string `json:"targets"` // Distinct targets, in order of analysis
+}
+
+// riskRanks orders verdicts for picking a campaign's worst one.
+var riskRanks = map[string]int{"LOW": 1, "MEDIUM": 2, "HIGH": 3, "CRITICAL": 4}
+
+// CampaignClusterer groups analyses into campaigns.
+type CampaignClusterer struct {
+	config CampaignConfig
+}
+
+func NewCampaignClusterer(cfg CampaignConfig) *CampaignClusterer {
+	return &CampaignClusterer{config: cfg}
+}
+
+// ExtractCampaignFeatures collects what campaign clustering compares from a
+// report: the IPs, name servers and certificate it observed, the path shape
+// and content SimHash of the landing page, and the WHOIS registrar and
+// creation date.
+func ExtractCampaignFeatures(report *models.AdvancedReport) storage.CampaignFeatures {
+	f := storage.CampaignFeatures{
+		AnalysisID: report.ReportID,
+		Target:     report.Target,
+		AnalyzedAt: report.Timestamp,
+	}
+	if report.RiskAssessment != nil {
+		f.RiskLevel = strings.ToUpper(report.RiskAssessment.OverallRiskLevel)
+	}
+	ba := report.BasicAnalysis
+	if ba == nil {
+		ba = &models.ThreatAnalysis{}
+	}
+
+	landing := report.Target
+	for _, hop := range ba.RedirectChain {
+		if strings.Contains(hop.URL, "://") {
+			landing = hop.URL
+		}
+		if hop.ContentSimhash != "" {
+			f.ContentSimhash = hop.ContentSimhash
+		}
+		f.IPs = appendUnique(f.IPs, normalizeNodeValue(NodeIP, hop.IPAddress))
+	}
+	if report.Sandbox != nil && report.Sandbox.FinalURL != "" {
+		landing = report.Sandbox.FinalURL
+	}
+	f.PathShape = PathShape(landing)
+
+	if dns := ba.DNSInfo; dns != nil {
+		for _, ip := range append(append([]string{}, dns.ARecords...), dns.AAAARecords...) {
+			f.IPs = appendUnique(f.IPs, normalizeNodeValue(NodeIP, ip))
+		}
+		for _, ns := range append(append([]string{}, dns.NameServers...), dns.NSRecords...) {
+			f.NameServers = appendUnique(f.NameServers, normalizeNodeValue(NodeNameServer, ns))
+		}
+	}
+	if geo := ba.GeoAnalysis; geo != nil {
+		f.IPs = appendUnique(f.IPs, normalizeNodeValue(NodeIP, geo.IP))
+	}
+	if tls := ba.TLSInfo; tls != nil {
+		f.Certificates = appendUnique(f.Certificates, normalizeNodeValue(NodeCertificate, tls.Fingerprint))
+	}
+	if whois := ba.WhoisInfo; whois != nil {
+		for _, ns := range whois.NameServers {
+			f.NameServers = appendUnique(f.NameServers, normalizeNodeValue(NodeNameServer, ns))
+		}
+		f.Registrar = strings.TrimSpace(whois.Registrar)
+		// The WHOIS client writes a zero creation date as 0001-01-01.
+		if created, err := time.Parse("2006-01-02", whois.CreatedDate); err == nil && created.Year() > 1 {
+			f.DomainCreated = created
+		}
+	}
+	return f
+}
+
+func appendUnique(list []string, v string) []string {
+	if v == "" {
+		return list
+	}
+	for _, existing := range list {
+		if existing == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// PathShape returns the structure of a URL's path and query: segments are
+// lowercased, numbers become {n}, hex strings {h} and other long random
+// looking tokens {r}, and only the sorted query parameter names are kept.
+// "https://a.example/u/8812/Login.php?id=x&t=y" and
+// "https://b.example/u/9031/login.php?t=z&id=w" both become
+// "/u/{n}/login.php?id&t". The root path has an empty shape.
+func PathShape(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || !strings.Contains(rawURL, "://") {
+		return ""
+	}
+	var segments []string
+	for _, seg := range strings.Split(u.Path, "/") {
+		if seg != "" {
+			segments = append(segments, maskSegment(strings.ToLower(seg)))
+		}
+	}
+	var keys []string
+	for k := range u.Query() {
+		keys = append(keys, strings.ToLower(k))
+	}
+	if len(segments) == 0 && len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	shape := "/" + strings.Join(segments, "/")
+	if len(keys) > 0 {
+		shape += "?" + strings.Join(keys, "&")
+	}
+	return shape
+}
+
+func maskSegment(seg string) string {
+	var digits, letters, hexChars int
+	for _, r := range seg {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+			hexChars++
+		case r >= 'a' && r <= 'f':
+			letters++
+			hexChars++
+		case r >= 'g' && r <= 'z':
+			letters++
+		}
+	}
+	switch {
+	case digits == len(seg):
+		return "{n}"
+	case len(seg) >= 8 && hexChars == len(seg) && digits > 0:
+		return "{h}"
+	case len(seg) >= 12 && digits > 0 && letters > 0 && digits+letters >= len(seg)-2:
+		return "{r}"
+	}
+	return seg
+}
+
+// pathSimilarity is the share of positions at which two path shapes have the
+// same segment.
+func pathSimilarity(a, b string) float64 {
+	sa := strings.Split(strings.Trim(a, "/"), "/")
+	sb := strings.Split(strings.Trim(b, "/"), "/")
+	longest := len(sa)
+	if len(sb) > longest {
+		longest = len(sb)
+	}
+	same := 0
+	for i := 0; i < len(sa) && i < len(sb); i++ {
+		if sa[i] == sb[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(longest)
+}
+
+// simhashDistance returns the Hamming distance between two hex SimHashes.
+func simhashDistance(a, b string) (int, bool) {
+	x, errA := strconv.ParseUint(a, 16, 64)
+	y, errB := strconv.ParseUint(b, 16, 64)
+	if errA != nil || errB != nil {
+		return 0, false
+	}
+	return bits.OnesCount64(x ^ y), true
+}
+
+// Cluster groups analyses into campaigns, most recently active first.
+// Analyses are compared only when they share an indexed value or have
+// similar content, so clustering stays close to linear in practice.
+// Groups covering a single target are re-analyses, not campaigns, and are
+// left out.
+//
+// A campaign's ID is derived from its oldest member, so it stays the same
+// as the campaign grows; when two campaigns merge the older ID survives.
+func (cc *CampaignClusterer) Cluster(features []storage.CampaignFeatures) []Campaign {
+	cfg := cc.config
+	features = append([]storage.CampaignFeatures(nil), features...)
+	sort.SliceStable(features, func(i, j int) bool {
+		if !features[i].AnalyzedAt.Equal(features[j].AnalyzedAt) {
+			return features[i].AnalyzedAt.Before(features[j].AnalyzedAt)
+		}
+		return features[i].AnalysisID < features[j].AnalysisID
+	})
+	buckets := make(map[string][]int)
+	for i, f := range features {
+		for _, ip := range f.IPs {
+			buckets[storage.InfraIP+"|"+ip] = append(buckets[storage.InfraIP+"|"+ip], i)
+		}
+		for _, ns := range f.NameServers {
+			buckets[storage.InfraNameServer+"|"+ns] = append(buckets[storage.InfraNameServer+"|"+ns], i)
+		}
+		for _, cert := range f.Certificates {
+			buckets[storage.InfraCertificate+"|"+cert] = append(buckets[storage.InfraCertificate+"|"+cert], i)
+		}
+		if f.PathShape != "" {
+			buckets["path|"+f.PathShape] = append(buckets["path|"+f.PathShape], i)
+		}
+	}
+	hub := func(key string) bool { return len(buckets[key]) > cfg.MaxShared }
+
+	candidates := make(map[[2]int]bool)
+	for key, members := range buckets {
+		if hub(key) {
+			continue
+		}
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				candidates[[2]int{members[x], members[y]}] = true
+			}
+		}
+	}
+	var hashed []int
+	for i, f := range features {
+		if f.ContentSimhash != "" {
+			hashed = append(hashed, i)
+		}
+	}
+	for x := 0; x < len(hashed); x++ {
+		for y := x + 1; y < len(hashed); y++ {
+			if d, ok := simhashDistance(features[hashed[x]].ContentSimhash, features[hashed[y]].ContentSimhash); ok && d <= cfg.MaxSimhashDistance {
+				candidates[[2]int{hashed[x], hashed[y]}] = true
+			}
+		}
+	}
+
+	parent := make([]int, len(features))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	evidence := make(map[int][]string)
+	pairs := make([][2]int, 0, len(candidates))
+	for pair := range candidates {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	for _, pair := range pairs {
+		score, reasons := cc.score(features[pair[0]], features[pair[1]], hub)
+		if score < cfg.Threshold {
+			continue
+		}
+		a, b := find(pair[0]), find(pair[1])
+		// Features are sorted oldest first, so the lower index is the
+		// older root.
+		if b < a {
+			a, b = b, a
+		}
+		if a != b {
+			parent[b] = a
+			evidence[a] = append(evidence[a], evidence[b]...)
+			delete(evidence, b)
+		}
+		evidence[a] = append(evidence[a], reasons...)
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range features {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	var campaigns []Campaign
+	for _, root := range roots {
+		if c, ok := newCampaign(features, groups[root], evidence[root]); ok {
+			campaigns = append(campaigns, c)
+		}
+	}
+	sort.SliceStable(campaigns, func(i, j int) bool {
+		return campaigns[i].LastSeen.After(campaigns[j].LastSeen)
+	})
+	return campaigns
+}
+
+// score returns the link strength of two analyses and the signals behind it.
+// Each kind of signal counts once however many values match.
+func (cc *CampaignClusterer) score(a, b storage.CampaignFeatures, hub func(string) bool) (float64, []string) {
+	cfg := cc.config
+	var score float64
+	var reasons []string
+	shared := func(kind, label string, weight float64, x, y []string) {
+		matched := false
+		for _, v := range x {
+			if hub(kind + "|" + v) {
+				continue
+			}
+			for _, w := range y {
+				if v == w {
+					matched = true
+					reasons = append(reasons, fmt.Sprintf("shared %s %s", label, v))
+				}
+			}
+		}
+		if matched {
+			score += weight
+		}
+	}
+	shared(storage.InfraCertificate, "certificate", cfg.CertificateWeight, a.Certificates, b.Certificates)
+	shared(storage.InfraIP, "IP", cfg.IPWeight, a.IPs, b.IPs)
+	shared(storage.InfraNameServer, "name server", cfg.NameServerWeight, a.NameServers, b.NameServers)
+
+	if a.PathShape != "" && b.PathShape != "" {
+		if a.PathShape == b.PathShape {
+			if !hub("path|" + a.PathShape) {
+				score += cfg.PathWeight
+				reasons = append(reasons, "same URL path structure "+a.PathShape)
+			}
+		} else if sim := pathSimilarity(a.PathShape, b.PathShape); sim >= cfg.MinPathSimilarity {
+			score += cfg.PathWeight * sim
+			reasons = append(reasons, fmt.Sprintf("similar URL path structure %s, %s", a.PathShape, b.PathShape))
+		}
+	}
+
+	if d, ok := simhashDistance(a.ContentSimhash, b.ContentSimhash); ok && d <= cfg.MaxSimhashDistance {
+		score += cfg.ContentWeight
+		reasons = append(reasons, "similar page content")
+	}
+
+	if a.Registrar != "" && strings.EqualFold(a.Registrar, b.Registrar) && !a.DomainCreated.IsZero() && !b.DomainCreated.IsZero() {
+		gap := a.DomainCreated.Sub(b.DomainCreated)
+		if math.Abs(float64(gap)) <= float64(cfg.RegistrationWindow) {
+			score += cfg.RegistrationWeight
+			reasons = append(reasons, fmt.Sprintf("registered with %s within %d days", a.Registrar, int(cfg.RegistrationWindow.Hours()/24)))
+		}
+	}
+	return score, reasons
+}
+
+// newCampaign builds the campaign of a group of analyses, given oldest first.
+// It returns false for groups that cover a single target.
+func newCampaign(features []storage.CampaignFeatures, group []int, evidence []string) (Campaign, bool) {
+	c := Campaign{Members: []CampaignMember{}, Evidence: []string{}, Timeline: []CampaignDay{}}
+	targets := make(map[string]bool)
+	seenEvidence := make(map[string]bool)
+	for _, e := range evidence {
+		if !seenEvidence[e] {
+			seenEvidence[e] = true
+			c.Evidence = append(c.Evidence, e)
+		}
+	}
+
+	for _, i := range group {
+		f := features[i]
+		targets[f.Target] = true
+		c.Members = append(c.Members, CampaignMember{AnalysisID: f.AnalysisID, Target: f.Target, AnalyzedAt: f.AnalyzedAt, RiskLevel: f.RiskLevel})
+		if riskRanks[f.RiskLevel] > riskRanks[c.RiskLevel] {
+			c.RiskLevel = f.RiskLevel
+		}
+		c.FirstSeen, c.LastSeen = widen(c.FirstSeen, c.LastSeen, f.AnalyzedAt)
+
+		date := f.AnalyzedAt.UTC().Format("2006-01-02")
+		if n := len(c.Timeline); n == 0 || c.Timeline[n-1].Date != date {
+			c.Timeline = append(c.Timeline, CampaignDay{Date: date})
+		}
+		day := &c.Timeline[len(c.Timeline)-1]
+		day.Analyses++
+		day.Targets = appendUnique(day.Targets, f.Target)
+	}
+	if len(targets) < 2 {
+		return Campaign{}, false
+	}
+	c.Targets = len(targets)
+
+	sum := sha256.Sum256([]byte(features[group[0]].AnalysisID))
+	c.ID = "CMP-" + hex.EncodeToString(sum[:5])
+	return c, true
+}
+
+// CampaignTracker keeps the features of every analysis in the store and
+// clusters them on demand.
+type CampaignTracker struct {
+	store     storage.CampaignRepository
+	clusterer *CampaignClusterer
+}
+
+func NewCampaignTracker(store storage.CampaignRepository, cfg CampaignConfig) *CampaignTracker {
+	return &CampaignTracker{store: store, clusterer: NewCampaignClusterer(cfg)}
+}
+
+// Record stores the campaign features of report.
+func (ct *CampaignTracker) Record(ctx context.Context, report *models.AdvancedReport) error {
+	if report == nil || report.ReportID == "" {
+		return fmt.Errorf("report has no ID")
+	}
+	if err := ct.store.SaveCampaignFeatures(ctx, ExtractCampaignFeatures(report)); err != nil {
+		return fmt.Errorf("failed to record campaign features of %s: %w", report.ReportID, err)
+	}
+	return nil
+}
+
+// Campaigns clusters every recorded analysis.
+func (ct *CampaignTracker) Campaigns(ctx context.Context) ([]Campaign, error) {
+	features, err := ct.store.ListCampaignFeatures(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load campaign features: %w", err)
+	}
+	return ct.clusterer.Cluster(features), nil
+}
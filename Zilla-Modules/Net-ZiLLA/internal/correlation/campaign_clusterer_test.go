@@ -0,0 +1,181 @@
+package correlation
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"net-zilla/internal/models"
+	"net-zilla/internal/storage"
+)
+
+func TestPathShape(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://a.example/u/8812/Login.php?id=x&t=y", "/u/{n}/login.php?id&t"},
+		{"https://b.example/u/9031/login.php?t=z&id=w", "/u/{n}/login.php?id&t"},
+		{"https://c.example/s/3fa85f64d2c1/verify", "/s/{h}/verify"},
+		{"https://d.example/track/aZ9kQ2mX7pL4/", "/track/{r}"},
+		{"https://e.example/", ""},
+		{"e.example/login", ""},
+	}
+	for _, tt := range tests {
+		if got := PathShape(tt.url); got != tt.want {
+			t.Errorf("PathShape(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestExtractCampaignFeatures(t *testing.T) {
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	report := phishReport("NZ-1", "login.evil.example", at)
+	report.RiskAssessment = &models.RiskAssessment{OverallRiskLevel: "high"}
+	report.BasicAnalysis.RedirectChain[1].ContentSimhash = "0f0f0f0f0f0f0f0f"
+	report.BasicAnalysis.WhoisInfo.CreatedDate = "2025-02-27"
+
+	got := ExtractCampaignFeatures(report)
+	want := storage.CampaignFeatures{
+		AnalysisID:     "NZ-1",
+		Target:         "http://login.evil.example/login",
+		RiskLevel:      "HIGH",
+		AnalyzedAt:     at,
+		IPs:            []string{"203.0.113.7"},
+		NameServers:    []string{"ns1.bulletproof.example"},
+		Certificates:   []string{"abcdef"},
+		PathShape:      "/verify",
+		ContentSimhash: "0f0f0f0f0f0f0f0f",
+		Registrar:      "Cheap Names LLC",
+		DomainCreated:  time.Date(2025, 2, 27, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractCampaignFeatures =\n %+v\nwant\n %+v", got, want)
+	}
+
+	report.BasicAnalysis.WhoisInfo.CreatedDate = "0001-01-01"
+	if got := ExtractCampaignFeatures(report); !got.DomainCreated.IsZero() {
+		t.Errorf("zero WHOIS creation date parsed as %v", got.DomainCreated)
+	}
+}
+
+func TestCampaignClusterer_Cluster(t *testing.T) {
+	day := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	feature := func(id, target string, at time.Time) storage.CampaignFeatures {
+		return storage.CampaignFeatures{AnalysisID: id, Target: target, AnalyzedAt: at, RiskLevel: "MEDIUM"}
+	}
+
+	// Wave one shares an IP and a path structure.
+	a := feature("NZ-a", "https://pay-parcel.example/track/4411/confirm.php", day)
+	a.IPs, a.PathShape = []string{"203.0.113.7"}, "/track/{n}/confirm.php"
+	b := feature("NZ-b", "https://parcel-fee.example/track/9102/confirm.php", day.Add(2*time.Hour))
+	b.IPs, b.PathShape, b.RiskLevel = []string{"203.0.113.7"}, "/track/{n}/confirm.php", "HIGH"
+	// A week later the kit moves host but keeps its content and registrar.
+	c := feature("NZ-c", "https://redelivery-now.example/track/5120/confirm.php", day.AddDate(0, 0, 7))
+	c.IPs, c.PathShape = []string{"198.51.100.20"}, "/track/{n}/confirm.php"
+	b.ContentSimhash, c.ContentSimhash = "ffff0000ffff0000", "ffff0000ffff0003"
+	// Re-analysis of an existing target only.
+	d := feature("NZ-d", "https://unrelated.example/", day)
+	d.IPs = []string{"192.0.2.1"}
+	e := feature("NZ-e", "https://unrelated.example/", day.Add(time.Hour))
+	e.IPs = []string{"192.0.2.1"}
+	// Shares only a name server with wave one: not enough.
+	f := feature("NZ-f", "https://bakery.example/", day)
+	f.NameServers = []string{"ns1.host.example"}
+	a.NameServers = []string{"ns1.host.example"}
+
+	campaigns := NewCampaignClusterer(DefaultCampaignConfig()).Cluster([]storage.CampaignFeatures{c, f, e, d, b, a})
+	if len(campaigns) != 1 {
+		t.Fatalf("got %d campaigns, want 1: %+v", len(campaigns), campaigns)
+	}
+	got := campaigns[0]
+	var ids []string
+	for _, m := range got.Members {
+		ids = append(ids, m.AnalysisID)
+	}
+	if !reflect.DeepEqual(ids, []string{"NZ-a", "NZ-b", "NZ-c"}) {
+		t.Errorf("members = %v", ids)
+	}
+	if got.RiskLevel != "HIGH" || got.Targets != 3 || !got.FirstSeen.Equal(day) || !got.LastSeen.Equal(c.AnalyzedAt) {
+		t.Errorf("campaign = %+v", got)
+	}
+	wantTimeline := []CampaignDay{
+		{Date: "2025-03-01", Analyses: 2, Targets: []string{a.Target, b.Target}},
+		{Date: "2025-03-08", Analyses: 1, Targets: []string{c.Target}},
+	}
+	if !reflect.DeepEqual(got.Timeline, wantTimeline) {
+		t.Errorf("timeline = %+v", got.Timeline)
+	}
+	evidence := strings.Join(got.Evidence, "; ")
+	for _, want := range []string{"shared IP 203.0.113.7", "same URL path structure /track/{n}/confirm.php", "similar page content"} {
+		if !strings.Contains(evidence, want) {
+			t.Errorf("evidence %q missing %q", evidence, want)
+		}
+	}
+
+	// The ID follows the oldest member, so later waves keep it.
+	again := NewCampaignClusterer(DefaultCampaignConfig()).Cluster([]storage.CampaignFeatures{a, b})
+	if len(again) != 1 || again[0].ID != got.ID || !strings.HasPrefix(got.ID, "CMP-") {
+		t.Errorf("campaign ID changed: %s, then %+v", got.ID, again)
+	}
+}
+
+func TestCampaignClusterer_RegistrationAndHubs(t *testing.T) {
+	created := time.Date(2025, 2, 20, 0, 0, 0, 0, time.UTC)
+	cfg := DefaultCampaignConfig()
+	cfg.MaxShared = 3
+
+	var features []storage.CampaignFeatures
+	for i := 0; i < 4; i++ {
+		features = append(features, storage.CampaignFeatures{
+			AnalysisID: fmt.Sprintf("NZ-%d", i), Target: fmt.Sprintf("https://site%d.example/", i),
+			AnalyzedAt: created.AddDate(0, 0, 10+i),
+			IPs:        []string{"104.16.0.1"}, // CDN edge shared by everything
+			Registrar:  "Cheap Names LLC", DomainCreated: created.AddDate(0, 0, i),
+			ContentSimhash: "00000000000000ff",
+		})
+	}
+	features[3].DomainCreated = created.AddDate(0, 1, 0)
+
+	campaigns := NewCampaignClusterer(cfg).Cluster(features)
+	if len(campaigns) != 1 || len(campaigns[0].Members) != 3 {
+		t.Fatalf("campaigns = %+v", campaigns)
+	}
+	for _, e := range campaigns[0].Evidence {
+		if strings.Contains(e, "104.16.0.1") {
+			t.Errorf("hub IP used as evidence: %q", e)
+		}
+	}
+}
+
+func TestCampaignTracker_RecordCampaigns(t *testing.T) {
+	db, err := storage.Open(storage.DriverSQLite, filepath.Join(t.TempDir(), "campaigns.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	ct := NewCampaignTracker(db, DefaultCampaignConfig())
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, host := range []string{"login.evil.example", "secure.other.example"} {
+		if err := ct.Record(ctx, phishReport(fmt.Sprintf("NZ-%d", i+1), host, at.Add(time.Duration(i)*time.Hour))); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := ct.Record(ctx, &models.AdvancedReport{}); err == nil {
+		t.Error("expected an error recording a report without an ID")
+	}
+
+	campaigns, err := ct.Campaigns(ctx)
+	if err != nil {
+		t.Fatalf("Campaigns: %v", err)
+	}
+	if len(campaigns) != 1 || len(campaigns[0].Members) != 2 || campaigns[0].Members[0].AnalysisID != "NZ-1" {
+		t.Errorf("Campaigns = %+v", campaigns)
+	}
+}
@@ -0,0 +1,618 @@
+package correlation
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+//go:embed default.rules
+var defaultCorrelationRules string
+
+// CorrelationRule is a compiled correlation rule. Rule files hold blocks like
+//
+//	rule new_domain_free_cert {
+//	  title:    "Newly registered domain with a free certificate"
+//	  severity: high
+//	  mitre:    T1583.001, T1608.005
+//	  score:    15
+//	  when:     whois.domain_age_days < 30 && tls.issuer contains "Let's Encrypt"
+//	}
+//
+// "when" may continue on the following lines. Conditions combine comparisons
+// of report fields (==, !=, <, <=, >, >=, contains, matches, in [...]) with
+// &&, || and !. A bare boolean, string or list field is true when set; a
+// section name such as "tls" is true when the report has that section. Any
+// comparison with a field the report lacks is false.
+type CorrelationRule struct {
+	ID         string
+	Title      string
+	Severity   string   // LOW, MEDIUM, HIGH or CRITICAL
+	Techniques []string // MITRE ATT&CK technique IDs
+	Score      int      // Points added to the risk score when the rule matches
+	Condition  string
+
+	cond ruleExpr
+}
+
+// Match reports whether the rule's condition holds for report.
+func (r *CorrelationRule) Match(report *models.AdvancedReport) bool {
+	return r.cond.eval(report)
+}
+
+// LoadCorrelationRules reads a .rules file, or every such file in a directory.
+func LoadCorrelationRules(path string) ([]CorrelationRule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading correlation rules: %w", err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files, _ = filepath.Glob(filepath.Join(path, "*.rules"))
+		sort.Strings(files)
+	}
+	var rules []CorrelationRule
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("loading correlation rules: %w", err)
+		}
+		parsed, err := ParseCorrelationRules(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		rules = append(rules, parsed...)
+	}
+	return rules, nil
+}
+
+var (
+	ruleHeaderRE    = regexp.MustCompile(`^rule\s+([A-Za-z_][A-Za-z0-9_]*)\s*\{$`)
+	ruleAttributeRE = regexp.MustCompile(`^(title|severity|mitre|score|when)\s*:\s*(.*)$`)
+	techniqueRE     = regexp.MustCompile(`^T\d{4}(\.\d{3})?$`)
+)
+
+// ParseCorrelationRules compiles rule source. Lines starting with # or // are
+// comments.
+func ParseCorrelationRules(source string) ([]CorrelationRule, error) {
+	var (
+		rules   []CorrelationRule
+		seen    = make(map[string]bool)
+		id      string
+		start   int
+		attrs   map[string]string
+		lastKey string
+	)
+	for i, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//"):
+			continue
+		case attrs == nil:
+			m := ruleHeaderRE.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: expected \"rule <id> {\"", i+1)
+			}
+			if seen[m[1]] {
+				return nil, fmt.Errorf("line %d: duplicate rule %s", i+1, m[1])
+			}
+			id, start, attrs, lastKey = m[1], i+1, make(map[string]string), ""
+			seen[id] = true
+		case line == "}":
+			rule, err := compileRule(id, attrs)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: rule %s: %w", start, id, err)
+			}
+			rules = append(rules, rule)
+			attrs = nil
+		default:
+			if m := ruleAttributeRE.FindStringSubmatch(line); m != nil {
+				if _, dup := attrs[m[1]]; dup {
+					return nil, fmt.Errorf("line %d: %s given twice", i+1, m[1])
+				}
+				attrs[m[1]], lastKey = m[2], m[1]
+			} else if lastKey == "when" {
+				attrs["when"] += " " + line
+			} else {
+				return nil, fmt.Errorf("line %d: expected title, severity, mitre, score or when", i+1)
+			}
+		}
+	}
+	if attrs != nil {
+		return nil, fmt.Errorf("line %d: rule %s is missing its closing }", start, id)
+	}
+	return rules, nil
+}
+
+func compileRule(id string, attrs map[string]string) (CorrelationRule, error) {
+	r := CorrelationRule{ID: id, Title: attrs["title"], Condition: attrs["when"]}
+	if strings.HasPrefix(r.Title, `"`) {
+		title, err := strconv.Unquote(r.Title)
+		if err != nil {
+			return r, fmt.Errorf("bad title %s", r.Title)
+		}
+		r.Title = title
+	}
+	if r.Title == "" {
+		r.Title = id
+	}
+
+	r.Severity = strings.ToUpper(attrs["severity"])
+	switch r.Severity {
+	case "LOW", "MEDIUM", "HIGH", "CRITICAL":
+	default:
+		return r, fmt.Errorf("severity must be low, medium, high or critical")
+	}
+
+	for _, t := range strings.Split(attrs["mitre"], ",") {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if !techniqueRE.MatchString(t) {
+			return r, fmt.Errorf("%q is not an ATT&CK technique ID", t)
+		}
+		r.Techniques = append(r.Techniques, t)
+	}
+
+	if s := attrs["score"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > 100 {
+			return r, fmt.Errorf("score must be between 0 and 100")
+		}
+		r.Score = n
+	}
+
+	if r.Condition == "" {
+		return r, fmt.Errorf("missing when")
+	}
+	cond, err := parseRuleCondition(r.Condition)
+	if err != nil {
+		return r, err
+	}
+	r.cond = cond
+	return r, nil
+}
+
+// --- Report fields ---
+
+type fieldKind int
+
+const (
+	fieldBool fieldKind = iota
+	fieldNumber
+	fieldString
+	fieldList
+)
+
+var fieldKindNames = map[fieldKind]string{fieldBool: "boolean", fieldNumber: "number", fieldString: "string", fieldList: "list"}
+
+// ruleField reads one value from a report: a bool, float64, string or
+// []string, or nil when the report lacks the section holding it.
+type ruleField struct {
+	kind fieldKind
+	get  func(r *models.AdvancedReport) interface{}
+}
+
+// fromSection builds a field read from a section of the report, nil when of returns nil.
+func fromSection[T any](kind fieldKind, of func(*models.AdvancedReport) *T, get func(*T) interface{}) ruleField {
+	return ruleField{kind, func(r *models.AdvancedReport) interface{} {
+		if s := of(r); s != nil {
+			return get(s)
+		}
+		return nil
+	}}
+}
+
+// present is a section name field, true when the report has the section.
+func present[T any](of func(*models.AdvancedReport) *T) ruleField {
+	return fromSection(fieldBool, of, func(*T) interface{} { return true })
+}
+
+func basicOf(r *models.AdvancedReport) *models.ThreatAnalysis { return r.BasicAnalysis }
+
+func whoisOf(r *models.AdvancedReport) *models.WhoisAnalysis {
+	if r.BasicAnalysis == nil {
+		return nil
+	}
+	return r.BasicAnalysis.WhoisInfo
+}
+
+func tlsOf(r *models.AdvancedReport) *models.TLSAnalysis {
+	if r.BasicAnalysis == nil {
+		return nil
+	}
+	return r.BasicAnalysis.TLSInfo
+}
+
+func geoOf(r *models.AdvancedReport) *models.GeoAnalysis {
+	if r.BasicAnalysis == nil {
+		return nil
+	}
+	return r.BasicAnalysis.GeoAnalysis
+}
+
+func dnsOf(r *models.AdvancedReport) *models.DNSAnalysis {
+	if r.BasicAnalysis == nil {
+		return nil
+	}
+	return r.BasicAnalysis.DNSInfo
+}
+
+func intelOf(r *models.AdvancedReport) *models.IOCRegistry            { return r.ThreatIntelligence }
+func reputationOf(r *models.AdvancedReport) *models.ReputationSummary { return r.Reputation }
+func behaviorOf(r *models.AdvancedReport) *models.BehaviorAnalysis    { return r.BehavioralAnalysis }
+func sandboxOf(r *models.AdvancedReport) *models.SandboxResult        { return r.Sandbox }
+
+// ruleFields are the names conditions may use.
+var ruleFields = map[string]ruleField{
+	"target":   {fieldString, func(r *models.AdvancedReport) interface{} { return r.Target }},
+	"findings": {fieldList, func(r *models.AdvancedReport) interface{} { return r.Findings }},
+	"redirect_count": fromSection(fieldNumber, basicOf, func(a *models.ThreatAnalysis) interface{} {
+		return float64(a.RedirectCount)
+	}),
+	"redirect_mechanisms": fromSection(fieldList, basicOf, func(a *models.ThreatAnalysis) interface{} {
+		var list []string
+		for _, hop := range a.RedirectChain {
+			if hop.Mechanism != "" {
+				list = append(list, string(hop.Mechanism))
+			}
+		}
+		return list
+	}),
+
+	"whois":           present(whoisOf),
+	"whois.domain":    fromSection(fieldString, whoisOf, func(w *models.WhoisAnalysis) interface{} { return w.Domain }),
+	"whois.registrar": fromSection(fieldString, whoisOf, func(w *models.WhoisAnalysis) interface{} { return w.Registrar }),
+	"whois.domain_age_days": fromSection(fieldNumber, whoisOf, func(w *models.WhoisAnalysis) interface{} {
+		if w.DomainAgeDays == 0 && (w.CreatedDate == "" || strings.HasPrefix(w.CreatedDate, "0001")) {
+			return nil // Creation date unknown
+		}
+		return float64(w.DomainAgeDays)
+	}),
+	"whois.status":       fromSection(fieldList, whoisOf, func(w *models.WhoisAnalysis) interface{} { return w.Status }),
+	"whois.name_servers": fromSection(fieldList, whoisOf, func(w *models.WhoisAnalysis) interface{} { return w.NameServers }),
+
+	"tls":                 present(tlsOf),
+	"tls.valid":           fromSection(fieldBool, tlsOf, func(t *models.TLSAnalysis) interface{} { return t.CertificateValid }),
+	"tls.issuer":          fromSection(fieldString, tlsOf, func(t *models.TLSAnalysis) interface{} { return t.Issuer }),
+	"tls.subject":         fromSection(fieldString, tlsOf, func(t *models.TLSAnalysis) interface{} { return t.Subject }),
+	"tls.expires_in_days": fromSection(fieldNumber, tlsOf, func(t *models.TLSAnalysis) interface{} { return float64(t.ExpiresInDays) }),
+	"tls.grade":           fromSection(fieldString, tlsOf, func(t *models.TLSAnalysis) interface{} { return t.EncryptionGrade }),
+	"tls.weak_ciphers":    fromSection(fieldBool, tlsOf, func(t *models.TLSAnalysis) interface{} { return t.HasWeakCiphers }),
+	"tls.hsts":            fromSection(fieldBool, tlsOf, func(t *models.TLSAnalysis) interface{} { return t.HSTSEnabled }),
+	"tls.jarm":            fromSection(fieldString, tlsOf, func(t *models.TLSAnalysis) interface{} { return t.JARM }),
+	"tls.fingerprint_match": fromSection(fieldList, tlsOf, func(t *models.TLSAnalysis) interface{} {
+		var labels []string
+		for _, m := range t.FingerprintMatches {
+			if m.Label != "" {
+				labels = append(labels, m.Label)
+			} else {
+				labels = append(labels, m.Type+":"+m.Fingerprint)
+			}
+		}
+		return labels
+	}),
+
+	"geo":              present(geoOf),
+	"geo.ip":           fromSection(fieldString, geoOf, func(g *models.GeoAnalysis) interface{} { return g.IP }),
+	"geo.country":      fromSection(fieldString, geoOf, func(g *models.GeoAnalysis) interface{} { return g.Country }),
+	"geo.country_code": fromSection(fieldString, geoOf, func(g *models.GeoAnalysis) interface{} { return g.CountryCode }),
+	"geo.asn":          fromSection(fieldString, geoOf, func(g *models.GeoAnalysis) interface{} { return g.ASN }),
+	"geo.isp":          fromSection(fieldString, geoOf, func(g *models.GeoAnalysis) interface{} { return g.ISP }),
+	"geo.hosting_type": fromSection(fieldString, geoOf, func(g *models.GeoAnalysis) interface{} { return g.HostingType }),
+	"geo.is_proxy":     fromSection(fieldBool, geoOf, func(g *models.GeoAnalysis) interface{} { return g.IsProxy }),
+	"geo.threat_score": fromSection(fieldNumber, geoOf, func(g *models.GeoAnalysis) interface{} { return float64(g.ThreatScore) }),
+
+	"dns":                present(dnsOf),
+	"dns.a_records":      fromSection(fieldList, dnsOf, func(d *models.DNSAnalysis) interface{} { return d.ARecords }),
+	"dns.a_record_count": fromSection(fieldNumber, dnsOf, func(d *models.DNSAnalysis) interface{} { return float64(len(d.ARecords)) }),
+	"dns.name_servers":   fromSection(fieldList, dnsOf, func(d *models.DNSAnalysis) interface{} { return d.NameServers }),
+	"dns.mx_records":     fromSection(fieldList, dnsOf, func(d *models.DNSAnalysis) interface{} { return d.MXRecords }),
+	"dns.cname":          fromSection(fieldString, dnsOf, func(d *models.DNSAnalysis) interface{} { return d.CNAME }),
+	"dns.dnssec":         fromSection(fieldBool, dnsOf, func(d *models.DNSAnalysis) interface{} { return d.DNSSECEnabled }),
+
+	"intel":             present(intelOf),
+	"intel.total_found": fromSection(fieldNumber, intelOf, func(i *models.IOCRegistry) interface{} { return float64(i.TotalFound) }),
+
+	"reputation":             present(reputationOf),
+	"reputation.score":       fromSection(fieldNumber, reputationOf, func(r *models.ReputationSummary) interface{} { return float64(r.AggregateScore) }),
+	"reputation.verdict":     fromSection(fieldString, reputationOf, func(r *models.ReputationSummary) interface{} { return r.Verdict }),
+	"reputation.blacklisted": fromSection(fieldBool, reputationOf, func(r *models.ReputationSummary) interface{} { return r.Blacklisted }),
+
+	"behavior": present(behaviorOf),
+	"behavior.patterns": fromSection(fieldList, behaviorOf, func(b *models.BehaviorAnalysis) interface{} {
+		var names []string
+		for _, p := range b.Patterns {
+			names = append(names, p.Name)
+		}
+		return names
+	}),
+	"behavior.risk_score": fromSection(fieldNumber, behaviorOf, func(b *models.BehaviorAnalysis) interface{} { return float64(b.RiskScore) }),
+
+	"sandbox":                present(sandboxOf),
+	"sandbox.final_url":      fromSection(fieldString, sandboxOf, func(s *models.SandboxResult) interface{} { return s.FinalURL }),
+	"sandbox.hosts":          fromSection(fieldList, sandboxOf, func(s *models.SandboxResult) interface{} { return s.Hosts }),
+	"sandbox.download_count": fromSection(fieldNumber, sandboxOf, func(s *models.SandboxResult) interface{} { return float64(len(s.Downloads)) }),
+}
+
+// --- Conditions ---
+
+type ruleExpr interface {
+	eval(r *models.AdvancedReport) bool
+}
+
+type (
+	ruleAnd    struct{ l, r ruleExpr }
+	ruleOr     struct{ l, r ruleExpr }
+	ruleNot    struct{ e ruleExpr }
+	ruleBool   bool
+	ruleTruthy struct{ field ruleField }
+	ruleCmp    struct {
+		field ruleField
+		op    string
+		lit   interface{}   // float64, string or bool
+		set   []interface{} // Operands of in
+		re    *regexp.Regexp
+	}
+)
+
+func (e ruleAnd) eval(r *models.AdvancedReport) bool { return e.l.eval(r) && e.r.eval(r) }
+func (e ruleOr) eval(r *models.AdvancedReport) bool  { return e.l.eval(r) || e.r.eval(r) }
+func (e ruleNot) eval(r *models.AdvancedReport) bool { return !e.e.eval(r) }
+func (e ruleBool) eval(*models.AdvancedReport) bool  { return bool(e) }
+
+func (e ruleTruthy) eval(r *models.AdvancedReport) bool {
+	switch v := e.field.get(r).(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []string:
+		return len(v) > 0
+	}
+	return false
+}
+
+func (e ruleCmp) eval(r *models.AdvancedReport) bool {
+	v := e.field.get(r)
+	if v == nil {
+		return false
+	}
+	switch e.op {
+	case "contains", "matches":
+		values, _ := v.([]string)
+		if s, ok := v.(string); ok {
+			values = []string{s}
+		}
+		for _, s := range values {
+			if e.re != nil && e.re.MatchString(s) ||
+				e.re == nil && strings.Contains(strings.ToLower(s), strings.ToLower(e.lit.(string))) {
+				return true
+			}
+		}
+		return false
+	case "in":
+		for _, lit := range e.set {
+			if ruleEqual(v, lit) {
+				return true
+			}
+		}
+		return false
+	case "==":
+		return ruleEqual(v, e.lit)
+	case "!=":
+		return !ruleEqual(v, e.lit)
+	}
+	l, r2 := v.(float64), e.lit.(float64)
+	switch e.op {
+	case "<":
+		return l < r2
+	case "<=":
+		return l <= r2
+	case ">":
+		return l > r2
+	}
+	return l >= r2
+}
+
+// ruleEqual compares a field value with a literal; strings ignore case.
+func ruleEqual(v, lit interface{}) bool {
+	if s, ok := v.(string); ok {
+		l, _ := lit.(string)
+		return strings.EqualFold(s, l)
+	}
+	return v == lit
+}
+
+var ruleTokenRE = regexp.MustCompile(`^(?:\s+|"(?:[^"\\]|\\.)*"|-?\d+(?:\.\d+)?|[A-Za-z_][A-Za-z0-9_.]*|&&|\|\||==|!=|<=|>=|[<>!()\[\],])`)
+
+type ruleParser struct {
+	toks []string
+	pos  int
+}
+
+func parseRuleCondition(src string) (ruleExpr, error) {
+	var toks []string
+	for rest := src; rest != ""; {
+		m := ruleTokenRE.FindString(rest)
+		if m == "" {
+			return nil, fmt.Errorf("unsupported condition syntax at %q", rest)
+		}
+		if strings.TrimSpace(m) != "" {
+			toks = append(toks, m)
+		}
+		rest = rest[len(m):]
+	}
+	rp := &ruleParser{toks: toks}
+	e, err := rp.or()
+	if err != nil {
+		return nil, err
+	}
+	if rp.pos < len(toks) {
+		return nil, fmt.Errorf("unexpected %q in condition", toks[rp.pos])
+	}
+	return e, nil
+}
+
+func (rp *ruleParser) peek() string {
+	if rp.pos < len(rp.toks) {
+		return rp.toks[rp.pos]
+	}
+	return ""
+}
+
+func (rp *ruleParser) next() string {
+	t := rp.peek()
+	rp.pos++
+	return t
+}
+
+func (rp *ruleParser) or() (ruleExpr, error) {
+	l, err := rp.and()
+	for err == nil && rp.peek() == "||" {
+		rp.pos++
+		var r ruleExpr
+		if r, err = rp.and(); err == nil {
+			l = ruleOr{l, r}
+		}
+	}
+	return l, err
+}
+
+func (rp *ruleParser) and() (ruleExpr, error) {
+	l, err := rp.not()
+	for err == nil && rp.peek() == "&&" {
+		rp.pos++
+		var r ruleExpr
+		if r, err = rp.not(); err == nil {
+			l = ruleAnd{l, r}
+		}
+	}
+	return l, err
+}
+
+func (rp *ruleParser) not() (ruleExpr, error) {
+	if rp.peek() == "!" {
+		rp.pos++
+		e, err := rp.not()
+		return ruleNot{e}, err
+	}
+	return rp.primary()
+}
+
+// ruleOps lists the comparisons each kind of field supports.
+var ruleOps = map[fieldKind][]string{
+	fieldBool:   {"==", "!="},
+	fieldNumber: {"==", "!=", "<", "<=", ">", ">=", "in"},
+	fieldString: {"==", "!=", "contains", "matches", "in"},
+	fieldList:   {"contains", "matches"},
+}
+
+func (rp *ruleParser) primary() (ruleExpr, error) {
+	tok := rp.next()
+	switch {
+	case tok == "(":
+		e, err := rp.or()
+		if err != nil {
+			return nil, err
+		}
+		if rp.next() != ")" {
+			return nil, fmt.Errorf("missing ) in condition")
+		}
+		return e, nil
+	case tok == "true" || tok == "false":
+		return ruleBool(tok == "true"), nil
+	case tok == "":
+		return nil, fmt.Errorf("condition ends unexpectedly")
+	}
+
+	field, ok := ruleFields[tok]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", tok)
+	}
+	op := rp.peek()
+	supported := ruleOps[field.kind]
+	if !containsString([]string{"==", "!=", "<", "<=", ">", ">=", "contains", "matches", "in"}, op) {
+		if field.kind == fieldNumber {
+			return nil, fmt.Errorf("number field %s must be compared", tok)
+		}
+		return ruleTruthy{field}, nil
+	}
+	rp.pos++
+	if !containsString(supported, op) {
+		return nil, fmt.Errorf("%s is a %s and does not support %s", tok, fieldKindNames[field.kind], op)
+	}
+
+	cmp := ruleCmp{field: field, op: op}
+	if op == "in" {
+		if rp.next() != "[" {
+			return nil, fmt.Errorf("expected [ after in")
+		}
+		for {
+			lit, err := rp.literal(field.kind)
+			if err != nil {
+				return nil, fmt.Errorf("%s in: %w", tok, err)
+			}
+			cmp.set = append(cmp.set, lit)
+			if sep := rp.next(); sep == "]" {
+				break
+			} else if sep != "," {
+				return nil, fmt.Errorf("expected , or ] in the list of %s", tok)
+			}
+		}
+		return cmp, nil
+	}
+
+	want := field.kind
+	if want == fieldList || op == "contains" || op == "matches" {
+		want = fieldString
+	}
+	lit, err := rp.literal(want)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", tok, op, err)
+	}
+	cmp.lit = lit
+	if op == "matches" {
+		if cmp.re, err = regexp.Compile(lit.(string)); err != nil {
+			return nil, fmt.Errorf("%s matches: %w", tok, err)
+		}
+	}
+	return cmp, nil
+}
+
+// literal reads a constant of the given kind.
+func (rp *ruleParser) literal(kind fieldKind) (interface{}, error) {
+	tok := rp.next()
+	switch kind {
+	case fieldNumber:
+		if n, err := strconv.ParseFloat(tok, 64); err == nil {
+			return n, nil
+		}
+	case fieldString:
+		if s, err := strconv.Unquote(tok); err == nil && strings.HasPrefix(tok, `"`) {
+			return s, nil
+		}
+	case fieldBool:
+		if tok == "true" || tok == "false" {
+			return tok == "true", nil
+		}
+	}
+	return nil, fmt.Errorf("expected a %s, got %q", fieldKindNames[kind], tok)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
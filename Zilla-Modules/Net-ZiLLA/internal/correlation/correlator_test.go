@@ -1,6 +1,10 @@
 package correlation
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"net-zilla/internal/models"
@@ -10,19 +14,39 @@ func TestEventCorrelator_Correlate(t *testing.T) {
 	ec := NewEventCorrelator()
 
 	tests := []struct {
-		name    string
-		report  *models.AdvancedReport
-		wantKey string
+		name      string
+		report    *models.AdvancedReport
+		wantRules []string
 	}{
 		{
 			name: "New Domain Invalid SSL",
 			report: &models.AdvancedReport{
 				BasicAnalysis: &models.ThreatAnalysis{
-					WhoisInfo: &models.WhoisAnalysis{DomainAge: "New"},
+					WhoisInfo: &models.WhoisAnalysis{DomainAgeDays: 4, CreatedDate: "2025-02-25"},
 					TLSInfo:   &models.TLSAnalysis{CertificateValid: false},
 				},
 			},
-			wantKey: "correlation_insight_0",
+			wantRules: []string{"new_domain_invalid_tls"},
+		},
+		{
+			name: "Unknown Domain Age",
+			report: &models.AdvancedReport{
+				BasicAnalysis: &models.ThreatAnalysis{
+					WhoisInfo: &models.WhoisAnalysis{CreatedDate: "0001-01-01"},
+					TLSInfo:   &models.TLSAnalysis{CertificateValid: false},
+				},
+			},
+		},
+		{
+			name: "New Domain Free Certificate",
+			report: &models.AdvancedReport{
+				BasicAnalysis: &models.ThreatAnalysis{
+					RedirectCount: 3,
+					WhoisInfo:     &models.WhoisAnalysis{DomainAgeDays: 12},
+					TLSInfo:       &models.TLSAnalysis{CertificateValid: true, Issuer: "CN=R11,O=Let's Encrypt,C=US"},
+				},
+			},
+			wantRules: []string{"new_domain_free_cert_redirects"},
 		},
 		{
 			name: "Evasion Pattern",
@@ -33,17 +57,17 @@ func TestEventCorrelator_Correlate(t *testing.T) {
 					GeoAnalysis:   &models.GeoAnalysis{IsProxy: true},
 				},
 			},
-			wantKey: "correlation_insight_0",
+			wantRules: []string{"proxy_redirect_chain"},
 		},
 		{
 			name: "Infrastructure Anomaly",
 			report: &models.AdvancedReport{
 				BasicAnalysis: &models.ThreatAnalysis{
 					DNSInfo:     &models.DNSAnalysis{ARecords: []string{"1.1.1.1", "2.2.2.2"}},
-					GeoAnalysis: &models.GeoAnalysis{Country: "Unknown"},
+					GeoAnalysis: &models.GeoAnalysis{HostingType: "VPN/Proxy", IsProxy: true},
 				},
 			},
-			wantKey: "correlation_insight_0",
+			wantRules: []string{"anonymous_multi_a"},
 		},
 		{
 			name:   "Nil Analysis",
@@ -54,11 +78,182 @@ func TestEventCorrelator_Correlate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ec.Correlate(tt.report)
-			if tt.wantKey != "" {
-				if tt.report.Metadata[tt.wantKey] == "" {
-					t.Errorf("expected insight at %s", tt.wantKey)
-				}
+			var got []string
+			for _, in := range tt.report.Insights {
+				got = append(got, in.RuleID)
+			}
+			if !reflect.DeepEqual(got, tt.wantRules) {
+				t.Errorf("insights = %v, want %v", got, tt.wantRules)
+			}
+			if len(tt.report.Findings) != len(tt.wantRules) {
+				t.Errorf("findings = %v", tt.report.Findings)
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestEventCorrelator_Insight(t *testing.T) {
+	report := &models.AdvancedReport{BasicAnalysis: &models.ThreatAnalysis{
+		WhoisInfo: &models.WhoisAnalysis{DomainAgeDays: 4},
+		TLSInfo:   &models.TLSAnalysis{},
+	}}
+	NewEventCorrelator().Correlate(report)
+	want := []models.Insight{{
+		RuleID:     "new_domain_invalid_tls",
+		Title:      "Newly registered domain using an invalid or self-signed certificate",
+		Severity:   "HIGH",
+		Techniques: []string{"T1583.001", "T1588.004"},
+		Score:      15,
+	}}
+	if !reflect.DeepEqual(report.Insights, want) {
+		t.Errorf("insights = %+v", report.Insights)
+	}
+	if report.Findings[0] != "Correlation: "+want[0].Title {
+		t.Errorf("finding = %q", report.Findings[0])
+	}
+}
+
+func TestRuleConditions(t *testing.T) {
+	report := &models.AdvancedReport{
+		Target:   "https://secure-login.example/verify",
+		Findings: []string{"Brand impersonation: PayPal"},
+		BasicAnalysis: &models.ThreatAnalysis{
+			RedirectCount: 2,
+			RedirectChain: []models.RedirectDetail{{Mechanism: models.RedirectMetaRefresh}, {}},
+			DNSInfo:       &models.DNSAnalysis{NameServers: []string{"ns1.bulletproof.example"}},
+			GeoAnalysis:   &models.GeoAnalysis{CountryCode: "RU", ThreatScore: 40},
+		},
+	}
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`redirect_count == 2`, true},
+		{`redirect_count >= 3`, false},
+		{`target contains "LOGIN"`, true},
+		{`target matches "^https://[^/]*login"`, true},
+		{`findings contains "paypal"`, true},
+		{`redirect_mechanisms contains "meta-refresh"`, true},
+		{`dns.name_servers matches "bulletproof"`, true},
+		{`geo.country_code in ["CN", "ru"]`, true},
+		{`geo.threat_score in [10, 20]`, false},
+		{`geo.is_proxy`, false},
+		{`!geo.is_proxy && (redirect_count > 5 || geo.threat_score > 30)`, true},
+		{`geo && !tls`, true},
+		{`tls.valid == false`, false}, // No TLS section: comparisons are false
+		{`!tls.valid`, true},
+		{`whois.registrar != "x"`, false},
+		{`dns.cname`, false},
+		{`tls.fingerprint_match`, false},
+		{`true && !false`, true},
+	}
+	for _, tt := range tests {
+		expr, err := parseRuleCondition(tt.cond)
+		if err != nil {
+			t.Errorf("parseRuleCondition(%q): %v", tt.cond, err)
+			continue
+		}
+		if got := expr.eval(report); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.cond, got, tt.want)
+		}
+	}
+}
+
+func TestParseCorrelationRules_Errors(t *testing.T) {
+	rule := func(body string) string { return "rule r {\n  severity: low\n" + body + "\n}" }
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"unknown field", rule(`when: whois.age < 30`), `unknown field "whois.age"`},
+		{"wrong type", rule(`when: tls.issuer < 30`), "tls.issuer is a string and does not support <"},
+		{"wrong literal", rule(`when: redirect_count > "3"`), "expected a number"},
+		{"bare number", rule(`when: redirect_count`), "must be compared"},
+		{"bad regexp", rule(`when: target matches "("`), "target matches"},
+		{"unbalanced", rule(`when: (geo.is_proxy`), "missing )"},
+		{"trailing token", rule(`when: geo.is_proxy tls`), `unexpected "tls"`},
+		{"missing when", rule(``), "missing when"},
+		{"bad severity", "rule r {\n  severity: severe\n  when: tls\n}", "severity must be"},
+		{"bad technique", rule("mitre: T15\nwhen: tls"), `"T15" is not an ATT&CK technique ID`},
+		{"bad score", rule("score: 500\nwhen: tls"), "score must be between 0 and 100"},
+		{"unknown attribute", rule("author: me\nwhen: tls"), "line 3: expected title"},
+		{"unterminated", "rule r {\n  severity: low\n  when: tls", "missing its closing }"},
+		{"duplicate", rule("when: tls") + "\n" + rule("when: geo"), "duplicate rule r"},
+		{"no header", "when: tls", `expected "rule <id> {"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCorrelationRules(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventCorrelator_LoadRules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"10-tuning.rules": `
+# Raise the weight of a built-in rule
+rule proxy_redirect_chain {
+  title:    "Proxy redirect chain"
+  severity: critical
+  score:    40
+  when:     redirect_count > 1 && geo.is_proxy
+}`,
+		"20-local.rules": `
+rule bulletproof_ns {
+  title:    "Name servers of a bulletproof hosting provider"
+  severity: high
+  mitre:    t1583.002
+  score:    20
+  when:     dns.name_servers matches "(?i)bulletproof"
+            || whois.name_servers contains "bulletproof"
+}`,
+		"notes.txt": "not a rule file",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ec := NewEventCorrelator()
+	builtin := len(ec.Rules())
+	if err := ec.LoadRules(dir); err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+	if len(ec.Rules()) != builtin+1 {
+		t.Errorf("got %d rules, want %d", len(ec.Rules()), builtin+1)
+	}
+
+	report := &models.AdvancedReport{BasicAnalysis: &models.ThreatAnalysis{
+		RedirectCount: 2,
+		GeoAnalysis:   &models.GeoAnalysis{IsProxy: true},
+		WhoisInfo:     &models.WhoisAnalysis{NameServers: []string{"NS1.BULLETPROOF.example"}},
+	}}
+	ec.Correlate(report)
+	if len(report.Insights) != 2 {
+		t.Fatalf("insights = %+v", report.Insights)
+	}
+	if in := report.Insights[0]; in.RuleID != "proxy_redirect_chain" || in.Severity != "CRITICAL" || in.Score != 40 {
+		t.Errorf("replaced built-in rule = %+v", in)
+	}
+	if in := report.Insights[1]; !reflect.DeepEqual(in.Techniques, []string{"T1583.002"}) {
+		t.Errorf("local rule = %+v", in)
+	}
+
+	bad := filepath.Join(dir, "30-bad.rules")
+	if err := os.WriteFile(bad, []byte("rule broken {\n  severity: low\n  when: nope\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewEventCorrelator().LoadRules(dir); err == nil || !strings.Contains(err.Error(), "30-bad.rules") {
+		t.Errorf("LoadRules with a broken file = %v", err)
+	}
+	if err := NewEventCorrelator().LoadRules(filepath.Join(dir, "missing.rules")); err == nil {
+		t.Error("expected an error loading a missing file")
+	}
+}
@@ -2,52 +2,79 @@ package correlation
 
 import (
 	"fmt"
+
 	"net-zilla/internal/models"
 )
 
-// EventCorrelator cross-references findings from multiple analysis vectors.
-type EventCorrelator struct{}
+// EventCorrelator cross-references findings from multiple analysis vectors
+// by evaluating correlation rules against each report.
+type EventCorrelator struct {
+	rules []CorrelationRule
+}
 
+// NewEventCorrelator returns a correlator with the built-in rules.
 func NewEventCorrelator() *EventCorrelator {
-	return &EventCorrelator{}
+	ec := &EventCorrelator{}
+	if err := ec.AddRules(defaultCorrelationRules); err != nil {
+		panic(fmt.Sprintf("built-in correlation rules: %v", err))
+	}
+	return ec
 }
 
-// Correlate analyzes the relationships between different report components
-// to identify sophisticated attack patterns like "Fast-Flux" or "Magecart".
-func (ec *EventCorrelator) Correlate(report *models.AdvancedReport) {
-	if report.BasicAnalysis == nil {
-		return
+// LoadRules adds the rules of a .rules file or directory; see AddRules.
+func (ec *EventCorrelator) LoadRules(path string) error {
+	rules, err := LoadCorrelationRules(path)
+	if err != nil {
+		return err
 	}
+	ec.merge(rules)
+	return nil
+}
 
-	ba := report.BasicAnalysis
-
-	// 1. Correlate Domain Age with SSL Status
-	if ba.WhoisInfo != nil && ba.TLSInfo != nil {
-		if ba.WhoisInfo.DomainAge == "New" && !ba.TLSInfo.CertificateValid {
-			ec.addInsight(report, "High Risk: Newly registered domain using invalid/self-signed SSL.")
-		}
+// AddRules compiles rule source and adds it to the set. A rule with the ID of
+// one already loaded replaces it. Nothing is added on error.
+func (ec *EventCorrelator) AddRules(source string) error {
+	rules, err := ParseCorrelationRules(source)
+	if err != nil {
+		return err
 	}
+	ec.merge(rules)
+	return nil
+}
 
-	// 2. Correlate Redirect Chains with IP Reputation
-	if len(ba.RedirectChain) > 0 && ba.GeoAnalysis != nil {
-		if ba.RedirectCount > 3 && ba.GeoAnalysis.IsProxy {
-			ec.addInsight(report, "Evasion Pattern: Long redirect chain originating from a Proxy/VPN node.")
+func (ec *EventCorrelator) merge(rules []CorrelationRule) {
+next:
+	for _, r := range rules {
+		for i := range ec.rules {
+			if ec.rules[i].ID == r.ID {
+				ec.rules[i] = r
+				continue next
+			}
 		}
+		ec.rules = append(ec.rules, r)
 	}
+}
 
-	// 3. Correlate DNS Records with Geolocation
-	if ba.DNSInfo != nil && ba.GeoAnalysis != nil {
-		// Check if A records point to a different country than the primary resolution
-		if len(ba.DNSInfo.ARecords) > 1 && ba.GeoAnalysis.Country == "Unknown" {
-			ec.addInsight(report, "Infrastructure Anomaly: Multiple A-records resolved via anonymous infrastructure.")
-		}
-	}
+// Rules returns the loaded rules in evaluation order.
+func (ec *EventCorrelator) Rules() []CorrelationRule {
+	return ec.rules
 }
 
-func (ec *EventCorrelator) addInsight(report *models.AdvancedReport, insight string) {
-	if report.Metadata == nil {
-		report.Metadata = make(map[string]interface{})
+// Correlate evaluates every rule against report, adding an Insight and a
+// finding for each that matches.
+func (ec *EventCorrelator) Correlate(report *models.AdvancedReport) {
+	for i := range ec.rules {
+		rule := &ec.rules[i]
+		if !rule.Match(report) {
+			continue
+		}
+		report.Insights = append(report.Insights, models.Insight{
+			RuleID:     rule.ID,
+			Title:      rule.Title,
+			Severity:   rule.Severity,
+			Techniques: rule.Techniques,
+			Score:      rule.Score,
+		})
+		report.Findings = append(report.Findings, "Correlation: "+rule.Title)
 	}
-	key := fmt.Sprintf("correlation_insight_%d", len(report.Metadata))
-	report.Metadata[key] = insight
 }
@@ -1,46 +1,317 @@
 package correlation
 
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+// Node types of the infrastructure graph.
+const (
+	NodeURL         = "URL"
+	NodeDomain      = "DOMAIN"
+	NodeIP          = "IP"
+	NodeASN         = "ASN"
+	NodeNameServer  = "NAMESERVER"
+	NodeCertificate = "CERTIFICATE" // Identified by the SHA-256 fingerprint of the leaf certificate
+	NodeRegistrar   = "REGISTRAR"
+)
+
+// Relationships between nodes. Edges point from the first type to the second.
+const (
+	RelRedirectsTo         = "REDIRECTS_TO"         // URL -> URL
+	RelOnHost              = "ON_HOST"              // URL -> DOMAIN or IP
+	RelSubdomainOf         = "SUBDOMAIN_OF"         // DOMAIN -> registered DOMAIN
+	RelResolvesTo          = "RESOLVES_TO"          // DOMAIN -> IP
+	RelHostedOn            = "HOSTED_ON"            // IP -> ASN
+	RelUsesNameServer      = "USES_NAMESERVER"      // DOMAIN -> NAMESERVER
+	RelRegisteredWith      = "REGISTERED_WITH"      // DOMAIN -> REGISTRAR
+	RelPresentsCertificate = "PRESENTS_CERTIFICATE" // DOMAIN or IP -> CERTIFICATE
+)
+
 // GraphNode represents an entity in the security graph.
 type GraphNode struct {
-	ID   string `json:"id"`
-	Type string `json:"type"` // e.g., "URL", "IP", "ASN"
+	ID        string    `json:"id"`   // Type and value, e.g. "DOMAIN:evil.example"
+	Type      string    `json:"type"` // One of the Node* constants
+	Value     string    `json:"value"`
+	Analyses  []string  `json:"analyses,omitempty"` // Report IDs that observed the node, sorted
+	FirstSeen time.Time `json:"first_seen,omitempty"`
+	LastSeen  time.Time `json:"last_seen,omitempty"`
 }
 
 // GraphEdge represents a relationship between entities.
 type GraphEdge struct {
-	From string `json:"from"`
-	To   string `json:"to"`
-	Rel  string `json:"rel"` // e.g., "RESOLVES_TO", "REDIRECTS_TO"
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Rel       string    `json:"rel"` // One of the Rel* constants
+	Analyses  []string  `json:"analyses,omitempty"`
+	FirstSeen time.Time `json:"first_seen,omitempty"`
+	LastSeen  time.Time `json:"last_seen,omitempty"`
 }
 
 // RelationshipGraph provides a structural view of the threat infrastructure.
+// Nodes and edges seen by several analyses appear once, listing every
+// analysis that observed them.
 type RelationshipGraph struct {
 	Nodes []GraphNode `json:"nodes"`
 	Edges []GraphEdge `json:"edges"`
+
+	nodeIndex map[string]int
+	edgeIndex map[string]int
+}
+
+// NewRelationshipGraph returns an empty graph.
+func NewRelationshipGraph() *RelationshipGraph {
+	return &RelationshipGraph{
+		Nodes:     []GraphNode{},
+		Edges:     []GraphEdge{},
+		nodeIndex: make(map[string]int),
+		edgeIndex: make(map[string]int),
+	}
+}
+
+// NodeID returns the ID of the node of type typ for value.
+func NodeID(typ, value string) string {
+	return typ + ":" + normalizeNodeValue(typ, value)
+}
+
+// normalizeNodeValue canonicalizes values so that the same infrastructure
+// seen by different analyses maps to one node.
+func normalizeNodeValue(typ, value string) string {
+	value = strings.TrimSpace(value)
+	switch typ {
+	case NodeDomain, NodeNameServer:
+		return strings.TrimSuffix(strings.ToLower(value), ".")
+	case NodeCertificate:
+		return strings.ToLower(strings.ReplaceAll(value, ":", ""))
+	case NodeASN:
+		// "AS15169 Google LLC" and "AS15169" are the same AS.
+		if fields := strings.Fields(value); len(fields) > 0 {
+			value = strings.ToUpper(fields[0])
+		}
+		if value != "" && !strings.HasPrefix(value, "AS") {
+			value = "AS" + value
+		}
+		return value
+	case NodeIP:
+		if ip := net.ParseIP(value); ip != nil {
+			return ip.String()
+		}
+	}
+	return value
+}
+
+// Node returns the node with id.
+func (g *RelationshipGraph) Node(id string) (GraphNode, bool) {
+	i, ok := g.index()[id]
+	if !ok {
+		return GraphNode{}, false
+	}
+	return g.Nodes[i], true
+}
+
+// AddNode records that analysisID observed a node at seen and returns its ID.
+// Empty values are ignored and return "".
+func (g *RelationshipGraph) AddNode(typ, value, analysisID string, seen time.Time) string {
+	value = normalizeNodeValue(typ, value)
+	if value == "" {
+		return ""
+	}
+	id := typ + ":" + value
+	i, ok := g.index()[id]
+	if !ok {
+		i = len(g.Nodes)
+		g.nodeIndex[id] = i
+		g.Nodes = append(g.Nodes, GraphNode{ID: id, Type: typ, Value: value})
+	}
+	n := &g.Nodes[i]
+	n.Analyses = addAnalysis(n.Analyses, analysisID)
+	n.FirstSeen, n.LastSeen = widen(n.FirstSeen, n.LastSeen, seen)
+	return id
+}
+
+// AddEdge records that analysisID observed a relationship at seen, adding
+// both endpoints. Edges with an empty endpoint or back to their source are
+// ignored.
+func (g *RelationshipGraph) AddEdge(fromType, fromValue, rel, toType, toValue, analysisID string, seen time.Time) {
+	from := g.AddNode(fromType, fromValue, analysisID, seen)
+	to := g.AddNode(toType, toValue, analysisID, seen)
+	if from == "" || to == "" || from == to {
+		return
+	}
+	g.addEdge(GraphEdge{From: from, To: to, Rel: rel}, analysisID, seen)
+}
+
+func (g *RelationshipGraph) addEdge(e GraphEdge, analysisID string, seen time.Time) {
+	g.index()
+	key := e.From + "|" + e.Rel + "|" + e.To
+	i, ok := g.edgeIndex[key]
+	if !ok {
+		i = len(g.Edges)
+		g.edgeIndex[key] = i
+		g.Edges = append(g.Edges, GraphEdge{From: e.From, To: e.To, Rel: e.Rel})
+	}
+	edge := &g.Edges[i]
+	edge.Analyses = addAnalysis(edge.Analyses, analysisID)
+	edge.FirstSeen, edge.LastSeen = widen(edge.FirstSeen, edge.LastSeen, seen)
 }
 
+// index returns the node index, building both indexes for graphs that were
+// decoded or assembled by hand.
+func (g *RelationshipGraph) index() map[string]int {
+	if g.nodeIndex == nil {
+		g.nodeIndex = make(map[string]int, len(g.Nodes))
+		for i, n := range g.Nodes {
+			g.nodeIndex[n.ID] = i
+		}
+		g.edgeIndex = make(map[string]int, len(g.Edges))
+		for i, e := range g.Edges {
+			g.edgeIndex[e.From+"|"+e.Rel+"|"+e.To] = i
+		}
+	}
+	return g.nodeIndex
+}
+
+func addAnalysis(ids []string, id string) []string {
+	if id == "" {
+		return ids
+	}
+	i := sort.SearchStrings(ids, id)
+	if i < len(ids) && ids[i] == id {
+		return ids
+	}
+	ids = append(ids, "")
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids
+}
+
+func widen(first, last, seen time.Time) (time.Time, time.Time) {
+	if seen.IsZero() {
+		return first, last
+	}
+	if first.IsZero() || seen.Before(first) {
+		first = seen
+	}
+	if seen.After(last) {
+		last = seen
+	}
+	return first, last
+}
+
+// GraphBuilder extracts the infrastructure an analysis observed.
 type GraphBuilder struct{}
 
 func NewGraphBuilder() *GraphBuilder {
 	return &GraphBuilder{}
 }
 
-// BuildFromAnalysis constructs a graph from analysis data.
-func (gb *GraphBuilder) BuildFromAnalysis(url string, resolvedIP string, asn string) *RelationshipGraph {
-	graph := &RelationshipGraph{
-		Nodes: []GraphNode{
-			{ID: url, Type: "URL"},
-			{ID: resolvedIP, Type: "IP"},
-		},
-		Edges: []GraphEdge{
-			{From: url, To: resolvedIP, Rel: "RESOLVES_TO"},
-		},
+// BuildFromReport constructs the graph of one report: the redirect chain and
+// the hosts and IPs behind each hop, and for the target host its DNS records,
+// name servers, registrar, TLS certificate and the AS hosting its IP.
+func (gb *GraphBuilder) BuildFromReport(report *models.AdvancedReport) *RelationshipGraph {
+	g := NewRelationshipGraph()
+	if report == nil {
+		return g
+	}
+	id, seen := report.ReportID, report.Timestamp
+
+	// addURL links a URL to its host and returns the host's node type and
+	// value. Bare hosts have no URL node.
+	addURL := func(raw string) (string, string) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			return "", ""
+		}
+		if !strings.Contains(raw, "://") {
+			return hostNode(raw)
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			return "", ""
+		}
+		typ, host := hostNode(u.Hostname())
+		g.AddEdge(NodeURL, raw, RelOnHost, typ, host, id, seen)
+		return typ, host
+	}
+	redirect := func(from, to string) {
+		if strings.Contains(from, "://") && strings.Contains(to, "://") {
+			g.AddEdge(NodeURL, from, RelRedirectsTo, NodeURL, to, id, seen)
+		}
+	}
+
+	targetType, target := addURL(report.Target)
+	if target == "" {
+		return g
 	}
+	g.AddNode(targetType, target, id, seen)
 
-	if asn != "" {
-		graph.Nodes = append(graph.Nodes, GraphNode{ID: asn, Type: "ASN"})
-		graph.Edges = append(graph.Edges, GraphEdge{From: resolvedIP, To: asn, Rel: "HOSTED_ON"})
+	ba := report.BasicAnalysis
+	if ba == nil {
+		ba = &models.ThreatAnalysis{}
+	}
+
+	// The chain starts at the target as the redirect follower requested it.
+	previous := report.Target
+	for i, hop := range ba.RedirectChain {
+		typ, host := addURL(hop.URL)
+		if typ == NodeDomain {
+			g.AddEdge(NodeDomain, host, RelResolvesTo, NodeIP, hop.IPAddress, id, seen)
+		}
+		if i > 0 {
+			redirect(previous, hop.URL)
+		}
+		previous = hop.URL
+	}
+	if s := report.Sandbox; s != nil && s.FinalURL != "" && s.FinalURL != previous {
+		addURL(s.FinalURL)
+		redirect(previous, s.FinalURL)
 	}
 
-	return graph
+	if targetType == NodeDomain {
+		if dns := ba.DNSInfo; dns != nil {
+			for _, ip := range append(append([]string{}, dns.ARecords...), dns.AAAARecords...) {
+				g.AddEdge(NodeDomain, target, RelResolvesTo, NodeIP, ip, id, seen)
+			}
+			for _, ns := range append(append([]string{}, dns.NameServers...), dns.NSRecords...) {
+				g.AddEdge(NodeDomain, target, RelUsesNameServer, NodeNameServer, ns, id, seen)
+			}
+		}
+		if whois := ba.WhoisInfo; whois != nil {
+			// WHOIS describes the registered domain, which may be a parent
+			// of the target host.
+			domain := target
+			if whois.Domain != "" {
+				domain = whois.Domain
+				g.AddEdge(NodeDomain, target, RelSubdomainOf, NodeDomain, domain, id, seen)
+			}
+			g.AddEdge(NodeDomain, domain, RelRegisteredWith, NodeRegistrar, whois.Registrar, id, seen)
+			for _, ns := range whois.NameServers {
+				g.AddEdge(NodeDomain, domain, RelUsesNameServer, NodeNameServer, ns, id, seen)
+			}
+		}
+	}
+	if tls := ba.TLSInfo; tls != nil {
+		g.AddEdge(targetType, target, RelPresentsCertificate, NodeCertificate, tls.Fingerprint, id, seen)
+	}
+	if geo := ba.GeoAnalysis; geo != nil && geo.IP != "" {
+		if targetType == NodeDomain {
+			g.AddEdge(NodeDomain, target, RelResolvesTo, NodeIP, geo.IP, id, seen)
+		}
+		g.AddEdge(NodeIP, geo.IP, RelHostedOn, NodeASN, geo.ASN, id, seen)
+	}
+	return g
+}
+
+// hostNode returns the node type and value of a URL host.
+func hostNode(host string) (string, string) {
+	host = strings.Trim(host, "[]")
+	if net.ParseIP(host) != nil {
+		return NodeIP, host
+	}
+	return NodeDomain, host
 }
@@ -0,0 +1,251 @@
+package correlation
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"net-zilla/internal/models"
+	"net-zilla/internal/storage"
+)
+
+// phishReport is an analysis of a phishing URL reached through a shortener.
+// Reports built with different IDs and landing hosts share its IP, name
+// server and certificate.
+func phishReport(id, landing string, at time.Time) *models.AdvancedReport {
+	return &models.AdvancedReport{
+		ReportID:  id,
+		Timestamp: at,
+		Target:    "http://" + landing + "/login",
+		BasicAnalysis: &models.ThreatAnalysis{
+			RedirectChain: []models.RedirectDetail{
+				{URL: "http://" + landing + "/login", IPAddress: "203.0.113.7"},
+				{URL: "https://" + landing + "/verify", IPAddress: "203.0.113.7"},
+			},
+			DNSInfo:     &models.DNSAnalysis{ARecords: []string{"203.0.113.7"}, NameServers: []string{"NS1.Bulletproof.example."}},
+			WhoisInfo:   &models.WhoisAnalysis{Domain: landing, Registrar: "Cheap Names LLC"},
+			TLSInfo:     &models.TLSAnalysis{Fingerprint: "AB:CD:EF"},
+			GeoAnalysis: &models.GeoAnalysis{IP: "203.0.113.7", ASN: "AS64500 Example Hosting"},
+		},
+	}
+}
+
+func TestGraphBuilder_BuildFromReport(t *testing.T) {
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	g := NewGraphBuilder().BuildFromReport(phishReport("NZ-1", "login.evil.example", at))
+
+	wantNodes := []string{
+		"URL:http://login.evil.example/login",
+		"DOMAIN:login.evil.example",
+		"IP:203.0.113.7",
+		"URL:https://login.evil.example/verify",
+		"NAMESERVER:ns1.bulletproof.example",
+		"REGISTRAR:Cheap Names LLC",
+		"CERTIFICATE:abcdef",
+		"ASN:AS64500",
+	}
+	var gotNodes []string
+	for _, n := range g.Nodes {
+		gotNodes = append(gotNodes, n.ID)
+		if !reflect.DeepEqual(n.Analyses, []string{"NZ-1"}) || !n.FirstSeen.Equal(at) {
+			t.Errorf("node %s = %+v", n.ID, n)
+		}
+	}
+	if !reflect.DeepEqual(gotNodes, wantNodes) {
+		t.Errorf("nodes = %v, want %v", gotNodes, wantNodes)
+	}
+
+	wantEdges := map[string]bool{
+		"URL:http://login.evil.example/login|REDIRECTS_TO|URL:https://login.evil.example/verify": true,
+		"URL:https://login.evil.example/verify|ON_HOST|DOMAIN:login.evil.example":                true,
+		"DOMAIN:login.evil.example|RESOLVES_TO|IP:203.0.113.7":                                   true,
+		"DOMAIN:login.evil.example|USES_NAMESERVER|NAMESERVER:ns1.bulletproof.example":           true,
+		"DOMAIN:login.evil.example|REGISTERED_WITH|REGISTRAR:Cheap Names LLC":                    true,
+		"DOMAIN:login.evil.example|PRESENTS_CERTIFICATE|CERTIFICATE:abcdef":                      true,
+		"IP:203.0.113.7|HOSTED_ON|ASN:AS64500":                                                   true,
+	}
+	got := make(map[string]bool)
+	for _, e := range g.Edges {
+		got[e.From+"|"+e.Rel+"|"+e.To] = true
+	}
+	for key := range wantEdges {
+		if !got[key] {
+			t.Errorf("missing edge %s", key)
+		}
+	}
+	if len(g.Edges) != 8 {
+		t.Errorf("got %d edges, want 8: %+v", len(g.Edges), g.Edges)
+	}
+}
+
+func TestGraphBuilder_BareHostTarget(t *testing.T) {
+	g := NewGraphBuilder().BuildFromReport(&models.AdvancedReport{
+		ReportID: "NZ-1",
+		Target:   "shop.example.com",
+		BasicAnalysis: &models.ThreatAnalysis{
+			WhoisInfo: &models.WhoisAnalysis{Domain: "example.com", Registrar: "Registrar Inc"},
+		},
+	})
+	want := []string{"DOMAIN:shop.example.com", "DOMAIN:example.com", "REGISTRAR:Registrar Inc"}
+	var got []string
+	for _, n := range g.Nodes {
+		got = append(got, n.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nodes = %v, want %v", got, want)
+	}
+	if len(g.Edges) != 2 || g.Edges[0].Rel != RelSubdomainOf {
+		t.Errorf("edges = %+v", g.Edges)
+	}
+}
+
+func sharedGraph() *RelationshipGraph {
+	b := NewGraphBuilder()
+	g := NewRelationshipGraph()
+	week := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	reports := []*models.AdvancedReport{
+		phishReport("NZ-1", "login.evil.example", week),
+		phishReport("NZ-2", "secure.other.example", week.AddDate(0, 0, 7)),
+		{ReportID: "NZ-3", Target: "https://benign.example/", Timestamp: week},
+	}
+	for _, r := range reports {
+		one := b.BuildFromReport(r)
+		for _, n := range one.Nodes {
+			g.AddNode(n.Type, n.Value, r.ReportID, r.Timestamp)
+		}
+		for _, e := range one.Edges {
+			from, _ := one.Node(e.From)
+			to, _ := one.Node(e.To)
+			g.AddEdge(from.Type, from.Value, e.Rel, to.Type, to.Value, r.ReportID, r.Timestamp)
+		}
+	}
+	return g
+}
+
+func TestRelationshipGraph_Lookup(t *testing.T) {
+	g := sharedGraph()
+	tests := []struct {
+		ref  string
+		want string
+		ok   bool
+	}{
+		{"IP:203.0.113.7", "IP:203.0.113.7", true},
+		{"203.0.113.7", "IP:203.0.113.7", true},
+		{"Login.Evil.Example", "DOMAIN:login.evil.example", true},
+		{"domain:LOGIN.evil.example", "", false},
+		{"DOMAIN:LOGIN.evil.example", "DOMAIN:login.evil.example", true},
+		{"missing.example", "", false},
+	}
+	for _, tt := range tests {
+		n, ok := g.Lookup(tt.ref)
+		if ok != tt.ok || n.ID != tt.want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q, %v", tt.ref, n.ID, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRelationshipGraph_Neighbors(t *testing.T) {
+	g := sharedGraph()
+	ip, _ := g.Lookup("203.0.113.7")
+	if !reflect.DeepEqual(ip.Analyses, []string{"NZ-1", "NZ-2"}) {
+		t.Errorf("shared IP analyses = %v", ip.Analyses)
+	}
+
+	sub, ok := g.Neighbors(ip.ID, 1)
+	if !ok {
+		t.Fatal("Neighbors: node not found")
+	}
+	var ids []string
+	for _, n := range sub.Nodes {
+		ids = append(ids, n.ID)
+	}
+	want := []string{"IP:203.0.113.7", "DOMAIN:login.evil.example", "ASN:AS64500", "DOMAIN:secure.other.example"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("Neighbors = %v, want %v", ids, want)
+	}
+	if len(sub.Edges) != 3 {
+		t.Errorf("Neighbors edges = %+v", sub.Edges)
+	}
+	if _, ok := g.Neighbors("IP:192.0.2.1", 1); ok {
+		t.Error("Neighbors of a missing node succeeded")
+	}
+}
+
+func TestRelationshipGraph_ShortestPath(t *testing.T) {
+	g := sharedGraph()
+	path, ok := g.ShortestPath("URL:https://secure.other.example/verify", "URL:http://login.evil.example/login")
+	if !ok {
+		t.Fatal("ShortestPath: not connected")
+	}
+	var ids []string
+	for _, n := range path.Nodes {
+		ids = append(ids, n.ID)
+	}
+	if len(ids) != 5 || ids[0] != "URL:https://secure.other.example/verify" || ids[4] != "URL:http://login.evil.example/login" {
+		t.Errorf("path = %v", ids)
+	}
+	if len(path.Edges) != 4 {
+		t.Errorf("path edges = %+v", path.Edges)
+	}
+	if _, ok := g.ShortestPath("URL:https://benign.example/", "IP:203.0.113.7"); ok {
+		t.Error("ShortestPath connected unrelated infrastructure")
+	}
+}
+
+func TestRelationshipGraph_Clusters(t *testing.T) {
+	g := sharedGraph().Without(NodeRegistrar, NodeASN)
+	for _, n := range g.Nodes {
+		if n.Type == NodeRegistrar || n.Type == NodeASN {
+			t.Errorf("Without kept %s", n.ID)
+		}
+	}
+
+	clusters := g.Clusters(2)
+	if len(clusters) != 1 {
+		t.Fatalf("got %d clusters, want 1: %+v", len(clusters), clusters)
+	}
+	c := clusters[0]
+	if !reflect.DeepEqual(c.Analyses, []string{"NZ-1", "NZ-2"}) || c.LastSeen.Sub(c.FirstSeen) != 7*24*time.Hour {
+		t.Errorf("cluster = %+v", c)
+	}
+	if all := g.Clusters(1); len(all) != 2 || all[1].ID == c.ID {
+		t.Errorf("Clusters(1) = %+v", all)
+	}
+	if again := sharedGraph().Without(NodeRegistrar, NodeASN).Clusters(2); again[0].ID != c.ID {
+		t.Errorf("cluster ID changed: %s, then %s", c.ID, again[0].ID)
+	}
+}
+
+func TestInfrastructureGraph_RecordLoad(t *testing.T) {
+	db, err := storage.Open(storage.DriverSQLite, filepath.Join(t.TempDir(), "graph.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	ig := NewInfrastructureGraph(db)
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, host := range []string{"login.evil.example", "secure.other.example"} {
+		if err := ig.Record(ctx, phishReport([]string{"NZ-1", "NZ-2"}[i], host, at)); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := ig.Record(ctx, &models.AdvancedReport{}); err == nil {
+		t.Error("expected an error recording a report without an ID")
+	}
+
+	g, err := ig.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	cert, ok := g.Lookup("CERTIFICATE:abcdef")
+	if !ok || !reflect.DeepEqual(cert.Analyses, []string{"NZ-1", "NZ-2"}) || !cert.FirstSeen.Equal(at) {
+		t.Errorf("shared certificate = %+v, %v", cert, ok)
+	}
+	if len(g.Clusters(2)) != 1 {
+		t.Errorf("expected the two analyses to form one cluster")
+	}
+}
@@ -0,0 +1,239 @@
+package correlation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lookupOrder is the order Lookup tries node types in for a bare value.
+var lookupOrder = []string{NodeURL, NodeDomain, NodeIP, NodeCertificate, NodeNameServer, NodeASN, NodeRegistrar}
+
+// Lookup finds a node by ID ("DOMAIN:evil.example") or, failing that, by
+// value alone, trying URL, domain, IP, certificate, name server, ASN and
+// registrar nodes in turn.
+func (g *RelationshipGraph) Lookup(ref string) (GraphNode, bool) {
+	ref = strings.TrimSpace(ref)
+	if n, ok := g.Node(ref); ok {
+		return n, true
+	}
+	if typ, value, ok := strings.Cut(ref, ":"); ok {
+		if n, ok := g.Node(NodeID(typ, value)); ok {
+			return n, true
+		}
+	}
+	for _, typ := range lookupOrder {
+		if n, ok := g.Node(NodeID(typ, ref)); ok {
+			return n, true
+		}
+	}
+	return GraphNode{}, false
+}
+
+// adjacency lists the edges touching each node. Relationships are followed
+// in both directions: two domains resolving to one IP are neighbors of it.
+func (g *RelationshipGraph) adjacency() map[string][]int {
+	adj := make(map[string][]int, len(g.Nodes))
+	for i, e := range g.Edges {
+		adj[e.From] = append(adj[e.From], i)
+		adj[e.To] = append(adj[e.To], i)
+	}
+	return adj
+}
+
+// subgraph returns the nodes in ids, in that order, with the edges between
+// them.
+func (g *RelationshipGraph) subgraph(ids []string) *RelationshipGraph {
+	sub := NewRelationshipGraph()
+	for _, id := range ids {
+		if n, ok := g.Node(id); ok {
+			sub.nodeIndex[id] = len(sub.Nodes)
+			sub.Nodes = append(sub.Nodes, n)
+		}
+	}
+	for _, e := range g.Edges {
+		_, from := sub.nodeIndex[e.From]
+		_, to := sub.nodeIndex[e.To]
+		if from && to {
+			sub.edgeIndex[e.From+"|"+e.Rel+"|"+e.To] = len(sub.Edges)
+			sub.Edges = append(sub.Edges, e)
+		}
+	}
+	return sub
+}
+
+// Neighbors returns the nodes within depth hops of id and the edges between
+// them, nearest first. It returns false when id is not in the graph.
+func (g *RelationshipGraph) Neighbors(id string, depth int) (*RelationshipGraph, bool) {
+	if _, ok := g.Node(id); !ok {
+		return nil, false
+	}
+	adj := g.adjacency()
+	order := []string{id}
+	dist := map[string]int{id: 0}
+	for i := 0; i < len(order); i++ {
+		current := order[i]
+		if dist[current] >= depth {
+			continue
+		}
+		for _, next := range g.neighborIDs(adj, current) {
+			if _, seen := dist[next]; !seen {
+				dist[next] = dist[current] + 1
+				order = append(order, next)
+			}
+		}
+	}
+	return g.subgraph(order), true
+}
+
+// neighborIDs returns the nodes sharing an edge with id, in edge order.
+func (g *RelationshipGraph) neighborIDs(adj map[string][]int, id string) []string {
+	var out []string
+	for _, i := range adj[id] {
+		e := g.Edges[i]
+		if e.From == id {
+			out = append(out, e.To)
+		} else {
+			out = append(out, e.From)
+		}
+	}
+	return out
+}
+
+// ShortestPath returns the fewest-hop path between from and to, ignoring
+// edge direction, as a graph whose nodes are in path order. It returns
+// false when either node is missing or they are not connected.
+func (g *RelationshipGraph) ShortestPath(from, to string) (*RelationshipGraph, bool) {
+	if _, ok := g.Node(from); !ok {
+		return nil, false
+	}
+	if _, ok := g.Node(to); !ok {
+		return nil, false
+	}
+	adj := g.adjacency()
+	prev := map[string]string{from: ""}
+	via := map[string]int{}
+	queue := []string{from}
+	for len(queue) > 0 && !hasKey(prev, to) {
+		current := queue[0]
+		queue = queue[1:]
+		for _, i := range adj[current] {
+			next := g.Edges[i].To
+			if next == current {
+				next = g.Edges[i].From
+			}
+			if !hasKey(prev, next) {
+				prev[next] = current
+				via[next] = i
+				queue = append(queue, next)
+			}
+		}
+	}
+	if !hasKey(prev, to) {
+		return nil, false
+	}
+
+	var ids []string
+	var edges []int
+	for id := to; id != from; id = prev[id] {
+		ids = append(ids, id)
+		edges = append(edges, via[id])
+	}
+	ids = append(ids, from)
+
+	path := NewRelationshipGraph()
+	for i := len(ids) - 1; i >= 0; i-- {
+		n, _ := g.Node(ids[i])
+		path.nodeIndex[n.ID] = len(path.Nodes)
+		path.Nodes = append(path.Nodes, n)
+	}
+	for i := len(edges) - 1; i >= 0; i-- {
+		e := g.Edges[edges[i]]
+		path.edgeIndex[e.From+"|"+e.Rel+"|"+e.To] = len(path.Edges)
+		path.Edges = append(path.Edges, e)
+	}
+	return path, true
+}
+
+func hasKey(m map[string]string, k string) bool {
+	_, ok := m[k]
+	return ok
+}
+
+// Without returns a copy of the graph minus nodes of the given types and their
+// edges. Dropping registrars and ASNs keeps large shared providers from
+// joining unrelated infrastructure into one cluster.
+func (g *RelationshipGraph) Without(types ...string) *RelationshipGraph {
+	drop := make(map[string]bool, len(types))
+	for _, t := range types {
+		drop[t] = true
+	}
+	var ids []string
+	for _, n := range g.Nodes {
+		if !drop[n.Type] {
+			ids = append(ids, n.ID)
+		}
+	}
+	return g.subgraph(ids)
+}
+
+// Cluster is a connected part of the graph: infrastructure linked, directly
+// or through other nodes, across the analyses that observed it.
+type Cluster struct {
+	ID        string             `json:"id"`
+	Analyses  []string           `json:"analyses"`
+	FirstSeen time.Time          `json:"first_seen,omitempty"`
+	LastSeen  time.Time          `json:"last_seen,omitempty"`
+	Graph     *RelationshipGraph `json:"graph"`
+}
+
+// Clusters returns the connected components observed by at least
+// minAnalyses analyses, largest first. A cluster's ID is derived from its
+// earliest-sorting node, so it stays the same while the cluster grows
+// unless it merges with another one.
+func (g *RelationshipGraph) Clusters(minAnalyses int) []Cluster {
+	adj := g.adjacency()
+	visited := make(map[string]bool, len(g.Nodes))
+	var clusters []Cluster
+	for _, n := range g.Nodes {
+		if visited[n.ID] {
+			continue
+		}
+		visited[n.ID] = true
+		members := []string{n.ID}
+		for i := 0; i < len(members); i++ {
+			for _, next := range g.neighborIDs(adj, members[i]) {
+				if !visited[next] {
+					visited[next] = true
+					members = append(members, next)
+				}
+			}
+		}
+
+		sub := g.subgraph(members)
+		c := Cluster{Graph: sub}
+		for _, m := range sub.Nodes {
+			for _, a := range m.Analyses {
+				c.Analyses = addAnalysis(c.Analyses, a)
+			}
+			c.FirstSeen, c.LastSeen = widen(c.FirstSeen, c.LastSeen, m.FirstSeen)
+			c.FirstSeen, c.LastSeen = widen(c.FirstSeen, c.LastSeen, m.LastSeen)
+		}
+		if len(c.Analyses) < minAnalyses {
+			continue
+		}
+		sort.Strings(members)
+		sum := sha256.Sum256([]byte(members[0]))
+		c.ID = "CL-" + hex.EncodeToString(sum[:6])
+		clusters = append(clusters, c)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if len(clusters[i].Analyses) != len(clusters[j].Analyses) {
+			return len(clusters[i].Analyses) > len(clusters[j].Analyses)
+		}
+		return len(clusters[i].Graph.Nodes) > len(clusters[j].Graph.Nodes)
+	})
+	return clusters
+}
@@ -0,0 +1,60 @@
+package correlation
+
+import (
+	"context"
+	"fmt"
+
+	"net-zilla/internal/models"
+	"net-zilla/internal/storage"
+)
+
+// InfrastructureGraph accumulates the graph of every analysis in the store,
+// so infrastructure shared with earlier analyses shows up as shared nodes.
+type InfrastructureGraph struct {
+	store   storage.GraphRepository
+	builder *GraphBuilder
+}
+
+func NewInfrastructureGraph(store storage.GraphRepository) *InfrastructureGraph {
+	return &InfrastructureGraph{store: store, builder: NewGraphBuilder()}
+}
+
+// Record stores the infrastructure report observed, replacing what an
+// earlier copy of the same report recorded.
+func (ig *InfrastructureGraph) Record(ctx context.Context, report *models.AdvancedReport) error {
+	if report == nil || report.ReportID == "" {
+		return fmt.Errorf("report has no ID")
+	}
+	g := ig.builder.BuildFromReport(report)
+	edges := make([]storage.GraphEdge, 0, len(g.Edges))
+	for _, e := range g.Edges {
+		from, _ := g.Node(e.From)
+		to, _ := g.Node(e.To)
+		edges = append(edges, storage.GraphEdge{
+			AnalysisID: report.ReportID,
+			FromType:   from.Type,
+			FromValue:  from.Value,
+			ToType:     to.Type,
+			ToValue:    to.Value,
+			Relation:   e.Rel,
+			SeenAt:     report.Timestamp,
+		})
+	}
+	if err := ig.store.SaveGraphEdges(ctx, report.ReportID, edges); err != nil {
+		return fmt.Errorf("failed to record graph of %s: %w", report.ReportID, err)
+	}
+	return nil
+}
+
+// Load builds the graph of every recorded analysis.
+func (ig *InfrastructureGraph) Load(ctx context.Context) (*RelationshipGraph, error) {
+	edges, err := ig.store.GetGraphEdges(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load graph: %w", err)
+	}
+	g := NewRelationshipGraph()
+	for _, e := range edges {
+		g.AddEdge(e.FromType, e.FromValue, e.Relation, e.ToType, e.ToValue, e.AnalysisID, e.SeenAt)
+	}
+	return g, nil
+}
@@ -0,0 +1,98 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Regression is a metric that got worse than the baseline by more than the tolerance.
+type Regression struct {
+	Component string
+	Metric    string
+	Baseline  float64
+	Current   float64
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s %s: %.4f -> %.4f", r.Component, r.Metric, r.Baseline, r.Current)
+}
+
+// Save writes the report as an indented JSON baseline.
+func (r *Report) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create baseline directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write baseline %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadBaseline reads a report previously written by Save.
+func LoadBaseline(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline %s: %w", path, err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// Compare lists the metrics in current that are worse than in baseline by more
+// than tolerance. Precision, recall, F1 and ROC-AUC must not drop; the false
+// positive rate must not rise. An error means the two reports were produced from
+// different corpora or GoAgent modes and cannot be compared.
+func Compare(baseline, current *Report, tolerance float64) ([]Regression, error) {
+	if baseline.Cases != current.Cases {
+		return nil, fmt.Errorf("baseline has %d cases, current run has %d; regenerate the baseline", baseline.Cases, current.Cases)
+	}
+	for _, label := range Labels {
+		if baseline.Labels[label] != current.Labels[label] {
+			return nil, fmt.Errorf("baseline has %d %s cases, current run has %d; regenerate the baseline",
+				baseline.Labels[label], label, current.Labels[label])
+		}
+	}
+	if baseline.GoAgentMode != current.GoAgentMode {
+		return nil, fmt.Errorf("baseline scored go_agent with %s, current run uses %s", baseline.GoAgentMode, current.GoAgentMode)
+	}
+
+	var regressions []Regression
+	for _, name := range Components {
+		base, ok := baseline.Components[name]
+		if !ok {
+			continue
+		}
+		cur, ok := current.Components[name]
+		if !ok {
+			regressions = append(regressions, Regression{Component: name, Metric: "missing"})
+			continue
+		}
+		higherIsBetter := []struct {
+			metric    string
+			base, cur float64
+		}{
+			{"precision", base.Precision, cur.Precision},
+			{"recall", base.Recall, cur.Recall},
+			{"f1", base.F1, cur.F1},
+			{"roc_auc", base.AUC, cur.AUC},
+		}
+		for _, m := range higherIsBetter {
+			if m.cur < m.base-tolerance {
+				regressions = append(regressions, Regression{Component: name, Metric: m.metric, Baseline: m.base, Current: m.cur})
+			}
+		}
+		if cur.FPR > base.FPR+tolerance {
+			regressions = append(regressions, Regression{Component: name, Metric: "fpr", Baseline: base.FPR, Current: cur.FPR})
+		}
+	}
+	return regressions, nil
+}
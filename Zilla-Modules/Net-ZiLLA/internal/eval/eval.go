@@ -0,0 +1,242 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"net-zilla/internal/ai"
+	"net-zilla/internal/analyzer"
+	"net-zilla/internal/models"
+	"net-zilla/internal/network"
+	"net-zilla/pkg/logger"
+)
+
+// Components scored by the evaluator, in report order.
+const (
+	ComponentSafetyScreener  = "safety_screener"
+	ComponentContentAnalyzer = "content_analyzer"
+	ComponentGoAgent         = "go_agent"
+	ComponentPipeline        = "pipeline" // Majority vote of the three components above
+)
+
+// Components lists every component name in report order.
+var Components = []string{ComponentSafetyScreener, ComponentContentAnalyzer, ComponentGoAgent, ComponentPipeline}
+
+// contentThreshold matches the score at which ContentAnalyzer reports MEDIUM RISK.
+const contentThreshold = 50
+
+// Prediction is one component's verdict on one case. Score is a risk in [0, 1]
+// used for ROC-AUC; Malicious is the component's own decision.
+type Prediction struct {
+	Score     float64 `json:"score"`
+	Malicious bool    `json:"malicious"`
+}
+
+// CaseResult holds every component's prediction for a case.
+type CaseResult struct {
+	URL         string                `json:"url"`
+	Label       string                `json:"label"`
+	Predictions map[string]Prediction `json:"predictions"`
+}
+
+// Confusion counts binary outcomes, with malicious as the positive class.
+// ByLabel breaks the verdicts down by corpus label: ByLabel["phishing"]["benign"]
+// is the number of phishing URLs the component let through.
+type Confusion struct {
+	TP      int                       `json:"tp"`
+	FP      int                       `json:"fp"`
+	TN      int                       `json:"tn"`
+	FN      int                       `json:"fn"`
+	ByLabel map[string]map[string]int `json:"by_label"`
+}
+
+// ComponentReport summarizes a component over the corpus.
+type ComponentReport struct {
+	Precision float64   `json:"precision"`
+	Recall    float64   `json:"recall"`
+	F1        float64   `json:"f1"`
+	AUC       float64   `json:"roc_auc"`
+	Accuracy  float64   `json:"accuracy"`
+	FPR       float64   `json:"fpr"`
+	Confusion Confusion `json:"confusion"`
+}
+
+// Report is the outcome of an evaluation run and the format of baseline files.
+type Report struct {
+	Corpus      string                      `json:"corpus,omitempty"`
+	Cases       int                         `json:"cases"`
+	Labels      map[string]int              `json:"labels"`
+	GoAgentMode string                      `json:"go_agent_mode"` // "heuristics" or the URL model type
+	Components  map[string]*ComponentReport `json:"components"`
+
+	Results []CaseResult `json:"-"`
+}
+
+// Evaluator runs the offline detection pipeline over a corpus.
+type Evaluator struct {
+	logger   *logger.Logger
+	screener *network.SafetyScreener
+	content  *analyzer.ContentAnalyzer
+	agent    *ai.GoAgent
+}
+
+// NewEvaluator creates an evaluator using the same components and defaults as
+// the live analyzer. GoAgent runs on its heuristics until SetModel is called.
+func NewEvaluator(logger *logger.Logger) *Evaluator {
+	return &Evaluator{
+		logger:   logger,
+		screener: network.NewSafetyScreener(),
+		content:  analyzer.NewContentAnalyzer(logger),
+		agent:    ai.NewGoAgent(0.7),
+	}
+}
+
+// SetModel scores the go_agent component with a trained URL model.
+func (e *Evaluator) SetModel(m *ai.URLModel) {
+	e.agent.SetModel(m)
+}
+
+// Run scores every case and aggregates per-component metrics.
+func (e *Evaluator) Run(ctx context.Context, cases []Case) (*Report, error) {
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no cases to evaluate")
+	}
+
+	report := &Report{
+		Cases:       len(cases),
+		Labels:      make(map[string]int),
+		GoAgentMode: "heuristics",
+		Components:  make(map[string]*ComponentReport),
+		Results:     make([]CaseResult, 0, len(cases)),
+	}
+	if m := e.agent.Model(); m != nil {
+		report.GoAgentMode = m.Type
+	}
+
+	for _, c := range cases {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report.Labels[c.Label]++
+		predictions, err := e.score(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.URL, err)
+		}
+		report.Results = append(report.Results, CaseResult{URL: c.URL, Label: c.Label, Predictions: predictions})
+	}
+
+	for _, name := range Components {
+		report.Components[name] = summarize(name, report.Results)
+	}
+	return report, nil
+}
+
+func (e *Evaluator) score(ctx context.Context, c Case) (map[string]Prediction, error) {
+	predictions := make(map[string]Prediction, len(Components))
+
+	screening := e.screener.Screen(c.URL)
+	predictions[ComponentSafetyScreener] = Prediction{
+		Score:     clampScore(screening.RiskScore),
+		Malicious: screening.IsSuspicious,
+	}
+
+	_, urlScore := e.content.Analyze(ctx, c.URL)
+	_, pageScore := e.content.AnalyzeContentString(c.Content)
+	contentScore := max(urlScore, pageScore)
+	predictions[ComponentContentAnalyzer] = Prediction{
+		Score:     clampScore(contentScore),
+		Malicious: contentScore >= contentThreshold,
+	}
+
+	// Copy the fixture so a corpus can be evaluated more than once.
+	analysis := &models.ThreatAnalysis{}
+	if c.Analysis != nil {
+		clone := *c.Analysis
+		analysis = &clone
+	}
+	analysis.URL = c.URL
+	aiResult, err := e.agent.AnalyzeLink(analysis)
+	if err != nil {
+		return nil, fmt.Errorf("go agent: %w", err)
+	}
+	predictions[ComponentGoAgent] = Prediction{
+		Score:     1 - aiResult.Confidence,
+		Malicious: !aiResult.IsSafe,
+	}
+
+	var sum float64
+	votes := 0
+	for _, name := range []string{ComponentSafetyScreener, ComponentContentAnalyzer, ComponentGoAgent} {
+		sum += predictions[name].Score
+		if predictions[name].Malicious {
+			votes++
+		}
+	}
+	predictions[ComponentPipeline] = Prediction{Score: sum / 3, Malicious: votes >= 2}
+	return predictions, nil
+}
+
+func summarize(component string, results []CaseResult) *ComponentReport {
+	confusion := Confusion{ByLabel: make(map[string]map[string]int)}
+	for _, label := range Labels {
+		confusion.ByLabel[label] = map[string]int{LabelBenign: 0, "malicious": 0}
+	}
+
+	scores := make([]float64, len(results))
+	labels := make([]int, len(results))
+	for i, r := range results {
+		p := r.Predictions[component]
+		malicious := r.Label != LabelBenign
+		scores[i] = p.Score
+		if malicious {
+			labels[i] = 1
+		}
+
+		verdict := LabelBenign
+		if p.Malicious {
+			verdict = "malicious"
+		}
+		confusion.ByLabel[r.Label][verdict]++
+
+		switch {
+		case p.Malicious && malicious:
+			confusion.TP++
+		case p.Malicious:
+			confusion.FP++
+		case malicious:
+			confusion.FN++
+		default:
+			confusion.TN++
+		}
+	}
+
+	tp, fp, tn, fn := float64(confusion.TP), float64(confusion.FP), float64(confusion.TN), float64(confusion.FN)
+	precision := safeDiv(tp, tp+fp)
+	recall := safeDiv(tp, tp+fn)
+	return &ComponentReport{
+		Precision: round4(precision),
+		Recall:    round4(recall),
+		F1:        round4(safeDiv(2*precision*recall, precision+recall)),
+		AUC:       round4(ai.ROCAUC(scores, labels)),
+		Accuracy:  round4(safeDiv(tp+tn, tp+fp+tn+fn)),
+		FPR:       round4(safeDiv(fp, fp+tn)),
+		Confusion: confusion,
+	}
+}
+
+func clampScore(score int) float64 {
+	return math.Min(math.Max(float64(score), 0), 100) / 100
+}
+
+// round4 keeps baseline files stable across platforms and readable in diffs.
+func round4(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
+
+func safeDiv(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
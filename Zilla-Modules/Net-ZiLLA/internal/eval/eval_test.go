@@ -0,0 +1,218 @@
+package eval
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"net-zilla/pkg/logger"
+)
+
+func TestLoadCorpus(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr string
+	}{
+		{
+			name:  "cases comments and blank lines",
+			input: "# header\n{\"url\":\"https://a.example\",\"label\":\"benign\"}\n\n{\"url\":\"http://b.tk\",\"label\":\"Phishing\",\"analysis\":{\"tls_info\":{\"certificate_valid\":false}}}\n",
+			want:  2,
+		},
+		{name: "unknown label", input: `{"url":"https://a.example","label":"spam"}`, wantErr: "unknown label"},
+		{name: "missing url", input: `{"label":"benign"}`, wantErr: "missing url"},
+		{name: "bad json", input: `{"url":`, wantErr: "line 1"},
+		{name: "empty", input: "# nothing\n", wantErr: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cases, err := LoadCorpus(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(cases) != tt.want {
+				t.Fatalf("expected %d cases, got %d", tt.want, len(cases))
+			}
+		})
+	}
+}
+
+func TestRunScoresComponents(t *testing.T) {
+	corpus := `{"url":"https://docs.example.com/guide","label":"benign","content":"` + strings.Repeat("Plain documentation text. ", 10) + `","analysis":{"whois_info":{"domain_age_days":4000},"tls_info":{"certificate_valid":true}}}
+{"url":"http://192.0.2.10/paypal/login/verify.php","label":"phishing","content":"password: credit card account number","analysis":{"whois_info":{"domain_age_days":2},"tls_info":{"certificate_valid":false},"geo_analysis":{"is_proxy":true}}}
+{"url":"http://update.example.tk/install.exe","label":"malware","content":"<script>eval(String.fromCharCode(97))</script>","analysis":{"tls_info":{"certificate_valid":false}}}`
+	cases, err := LoadCorpus(strings.NewReader(corpus))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := NewEvaluator(logger.NewLogger()).Run(context.Background(), cases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Cases != 3 || report.Labels[LabelPhishing] != 1 || report.GoAgentMode != "heuristics" {
+		t.Fatalf("unexpected report header: %+v", report)
+	}
+	for _, name := range Components {
+		c := report.Components[name]
+		if c == nil {
+			t.Fatalf("missing component %s", name)
+		}
+		total := c.Confusion.TP + c.Confusion.FP + c.Confusion.TN + c.Confusion.FN
+		if total != 3 {
+			t.Errorf("%s: confusion covers %d cases, want 3", name, total)
+		}
+		byLabel := 0
+		for _, label := range Labels {
+			byLabel += c.Confusion.ByLabel[label][LabelBenign] + c.Confusion.ByLabel[label]["malicious"]
+		}
+		if byLabel != 3 {
+			t.Errorf("%s: by-label matrix covers %d cases, want 3", name, byLabel)
+		}
+	}
+
+	// Every component separates this toy corpus perfectly.
+	for _, name := range Components {
+		if c := report.Components[name]; c.AUC != 1 {
+			t.Errorf("%s: expected ROC-AUC 1, got %v", name, c.AUC)
+		}
+	}
+	if c := report.Components[ComponentContentAnalyzer]; c.Recall != 1 || c.Precision != 1 {
+		t.Errorf("content_analyzer: expected perfect precision and recall, got %+v", c)
+	}
+
+	// Fixtures are copied, so the corpus can be evaluated again unchanged.
+	if cases[0].Analysis.URL != "" {
+		t.Errorf("fixture was modified: URL=%q", cases[0].Analysis.URL)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base := &Report{
+		Cases:       10,
+		Labels:      map[string]int{LabelBenign: 5, LabelPhishing: 3, LabelMalware: 2},
+		GoAgentMode: "heuristics",
+		Components: map[string]*ComponentReport{
+			ComponentGoAgent:         {Precision: 0.9, Recall: 0.8, F1: 0.85, AUC: 0.9, FPR: 0.1},
+			ComponentSafetyScreener:  {Precision: 1, Recall: 0.5, F1: 0.66, AUC: 0.8},
+			ComponentContentAnalyzer: {Precision: 1, Recall: 1, F1: 1, AUC: 1},
+		},
+	}
+	clone := func(mutate func(r *Report)) *Report {
+		r := *base
+		r.Labels = map[string]int{LabelBenign: 5, LabelPhishing: 3, LabelMalware: 2}
+		r.Components = make(map[string]*ComponentReport)
+		for k, v := range base.Components {
+			c := *v
+			r.Components[k] = &c
+		}
+		mutate(&r)
+		return &r
+	}
+
+	tests := []struct {
+		name    string
+		current *Report
+		want    []string
+		wantErr string
+	}{
+		{name: "identical", current: clone(func(r *Report) {})},
+		{name: "improvement", current: clone(func(r *Report) { r.Components[ComponentGoAgent].Recall = 1 })},
+		{name: "within tolerance", current: clone(func(r *Report) { r.Components[ComponentGoAgent].AUC = 0.895 })},
+		{
+			name: "recall drop and fpr rise",
+			current: clone(func(r *Report) {
+				r.Components[ComponentGoAgent].Recall = 0.6
+				r.Components[ComponentGoAgent].FPR = 0.3
+			}),
+			want: []string{"go_agent recall", "go_agent fpr"},
+		},
+		{
+			name:    "missing component",
+			current: clone(func(r *Report) { delete(r.Components, ComponentSafetyScreener) }),
+			want:    []string{"safety_screener missing"},
+		},
+		{name: "different corpus", current: clone(func(r *Report) { r.Cases = 11 }), wantErr: "cases"},
+		{name: "different labels", current: clone(func(r *Report) { r.Labels[LabelBenign], r.Labels[LabelMalware] = 4, 3 }), wantErr: "benign"},
+		{name: "different mode", current: clone(func(r *Report) { r.GoAgentMode = "gbt" }), wantErr: "go_agent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regressions, err := Compare(base, tt.current, 0.01)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(regressions) != len(tt.want) {
+				t.Fatalf("expected %d regressions, got %v", len(tt.want), regressions)
+			}
+			for i, r := range regressions {
+				if !strings.HasPrefix(r.String(), tt.want[i]) {
+					t.Errorf("regression %d: got %q, want prefix %q", i, r, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSaveAndLoadBaseline(t *testing.T) {
+	report := &Report{
+		Cases:       1,
+		Labels:      map[string]int{LabelBenign: 1},
+		GoAgentMode: "heuristics",
+		Components:  map[string]*ComponentReport{ComponentPipeline: {Precision: 0.5, AUC: 0.75}},
+		Results:     []CaseResult{{URL: "https://a.example"}},
+	}
+	path := filepath.Join(t.TempDir(), "nested", "baseline.json")
+	if err := report.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Components[ComponentPipeline].AUC != 0.75 || loaded.Results != nil {
+		t.Errorf("unexpected round trip: %+v", loaded)
+	}
+}
+
+// TestCorpusBaseline is the regression gate: detection on the bundled corpus must
+// not get worse than the committed baseline. After an intentional change, refresh
+// it with `netzilla eval -write-baseline` and commit the new file.
+func TestCorpusBaseline(t *testing.T) {
+	cases, err := LoadCorpusFile(filepath.Join("..", "..", "data", "eval", "corpus.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := LoadBaseline(filepath.Join("..", "..", "data", "eval", "baseline.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := NewEvaluator(logger.NewLogger()).Run(context.Background(), cases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regressions, err := Compare(baseline, report, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range regressions {
+		t.Errorf("detection regression: %s", r)
+	}
+}
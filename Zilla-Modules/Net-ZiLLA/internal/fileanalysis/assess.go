@@ -0,0 +1,121 @@
+package fileanalysis
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+// yaraSeverityPoints is what a match adds to the risk score, by its rule's
+// severity meta value.
+var yaraSeverityPoints = map[string]int{
+	"critical": 60,
+	"high":     40,
+	"medium":   25,
+	"low":      10,
+}
+
+// assess scores a file. The riskiest member's script heuristics set the
+// baseline; YARA matches, macros that run on open, executables where a
+// document was expected and unpacking limits add to it.
+func assess(r *models.FileAnalysis, limitHits int) {
+	score := 0
+	var findings []string
+	add := func(points int, format string, args ...interface{}) {
+		score += points
+		findings = append(findings, fmt.Sprintf(format, args...))
+	}
+
+	for _, m := range r.Members {
+		if b := m.Behavior; b != nil && b.RiskScore > score {
+			score = b.RiskScore
+		}
+	}
+	for _, m := range r.Members {
+		if b := m.Behavior; b != nil && b.RiskScore >= 30 && b.RiskScore == score {
+			findings = append(findings, fmt.Sprintf("%s: script heuristics scored %d (%s)", m.Path, b.RiskScore, b.Severity))
+			break
+		}
+	}
+
+	for _, m := range r.Members {
+		for _, match := range m.YaraMatches {
+			points, ok := yaraSeverityPoints[strings.ToLower(match.Meta["severity"])]
+			if !ok {
+				points = yaraSeverityPoints["medium"]
+			}
+			desc := match.Meta["description"]
+			if desc == "" {
+				desc = match.Rule
+			}
+			add(points, "%s: YARA %s: %s", m.Path, match.Rule, desc)
+		}
+	}
+
+	autoExec, suspicious := keywordSet(r.Macros, func(m models.VBAMacro) []string { return m.AutoExec }),
+		keywordSet(r.Macros, func(m models.VBAMacro) []string { return m.Suspicious })
+	switch {
+	case len(autoExec) > 0:
+		add(25, "VBA macros run when the document is opened (%s)", strings.Join(autoExec, ", "))
+	case len(r.Macros) > 0:
+		add(10, "Document contains %d VBA macro modules", len(r.Macros))
+	}
+	if len(suspicious) > 0 {
+		add(30, "VBA macros call %s", strings.Join(suspicious, ", "))
+	}
+
+	for _, m := range r.Members {
+		if !isExecutable(m.Type) {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(m.Path))
+		switch {
+		case documentExtensions[ext]:
+			add(40, "%s is a %s executable disguised as a %s file", m.Path, strings.ToUpper(m.Type), ext)
+		case m.Depth > 0:
+			add(30, "%s: %s executable inside an archive", m.Path, strings.ToUpper(m.Type))
+		}
+	}
+
+	if limitHits > 0 {
+		add(30, "%d members exceeded the unpacking limits (possible zip bomb)", limitHits)
+	}
+
+	if score > 100 {
+		score = 100
+	}
+	r.RiskScore = score
+	r.RiskLevel = fileRiskLevel(score)
+	r.Findings = findings
+}
+
+func keywordSet(macros []models.VBAMacro, field func(models.VBAMacro) []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, m := range macros {
+		for _, k := range field(m) {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func fileRiskLevel(score int) string {
+	switch {
+	case score >= 80:
+		return "CRITICAL"
+	case score >= 50:
+		return "HIGH"
+	case score >= 20:
+		return "MEDIUM"
+	default:
+		return "LOW"
+	}
+}
@@ -0,0 +1,356 @@
+// Package fileanalysis statically analyzes submitted files and attachments. It
+// identifies files by magic bytes, unpacks ZIP, TAR, GZIP, Office and compound
+// file containers in memory under zip-bomb limits, extracts VBA macro source
+// and embedded URLs, and runs the script heuristics, known-hash lookup and YARA
+// rules over every member. Nothing is executed and no link is fetched.
+package fileanalysis
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+	"net-zilla/internal/patterns"
+	"net-zilla/internal/threat_intel"
+	"net-zilla/pkg/logger"
+)
+
+// MaxFileSize is the largest file accepted for analysis.
+const MaxFileSize = 64 << 20
+
+// Limits bound how far a submission is unpacked. Members past a limit are
+// skipped with a warning; the rest of the file is still analyzed.
+type Limits struct {
+	MaxDepth       int   // Container nesting below the submitted file
+	MaxMembers     int   // Members analyzed, the file itself included
+	MaxTotalBytes  int64 // Decompressed bytes across all members
+	MaxMemberBytes int64 // Decompressed bytes of one member
+	MaxRatio       int64 // Decompressed to compressed size of one member
+}
+
+// DefaultLimits returns the limits used unless SetLimits is called.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxDepth:       5,
+		MaxMembers:     1000,
+		MaxTotalBytes:  256 << 20,
+		MaxMemberBytes: 64 << 20,
+		MaxRatio:       100,
+	}
+}
+
+// ratioFloor is the decompressed size below which the ratio limit is not
+// applied; small runs of zeros legitimately compress very well.
+const ratioFloor = 1 << 20
+
+// errLimit marks a member skipped because a limit was reached.
+var errLimit = errors.New("unpacking limit reached")
+
+type Analyzer struct {
+	logger  *logger.Logger
+	malware *threat_intel.MalwareAnalyzer
+	yara    *patterns.YaraManager
+	limits  Limits
+}
+
+func NewAnalyzer(l *logger.Logger) *Analyzer {
+	yara := patterns.NewYaraManager()
+	if err := yara.AddRules(defaultRules); err != nil {
+		panic(fmt.Sprintf("fileanalysis: built-in YARA rules: %v", err))
+	}
+	return &Analyzer{
+		logger:  l,
+		malware: threat_intel.NewMalwareAnalyzer(),
+		yara:    yara,
+		limits:  DefaultLimits(),
+	}
+}
+
+func (a *Analyzer) SetLimits(limits Limits) {
+	a.limits = limits
+}
+
+// SetMalwareAnalyzer shares a MalwareAnalyzer, and so its hash signatures, with
+// the rest of the application.
+func (a *Analyzer) SetMalwareAnalyzer(ma *threat_intel.MalwareAnalyzer) {
+	a.malware = ma
+}
+
+// LoadYaraRules adds the rules in a .yar file, or a directory of them, to the
+// built-in set.
+func (a *Analyzer) LoadYaraRules(path string) error {
+	return a.yara.LoadRules(path)
+}
+
+// Analyze unpacks and analyzes a file held in memory. It only fails for an empty
+// or oversized file; damaged members and limits are reported as warnings.
+func (a *Analyzer) Analyze(ctx context.Context, name string, data []byte) (*models.FileAnalysis, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("file exceeds %d bytes", MaxFileSize)
+	}
+	start := time.Now()
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		name = "file"
+	}
+	sum := sha256.Sum256(data)
+
+	w := &walker{a: a, ctx: ctx, result: &models.FileAnalysis{
+		ReportID:  "file-" + hex.EncodeToString(sum[:8]),
+		Timestamp: time.Now(),
+		FileName:  name,
+		Size:      int64(len(data)),
+	}}
+	w.total = int64(len(data))
+	w.visit(name, data, 0)
+
+	root := w.result.Members[0]
+	w.result.Type = root.Type
+	w.result.Hashes = root.Hashes
+	assess(w.result, w.limitHits)
+	w.result.Duration = time.Since(start)
+
+	a.logger.Info("File analysis of %s: %d members, %d URLs, %d macros, risk %d (%s)",
+		name, len(w.result.Members), len(w.result.URLs), len(w.result.Macros), w.result.RiskScore, w.result.RiskLevel)
+	return w.result, nil
+}
+
+// walker carries the state of one analysis through the container tree.
+type walker struct {
+	a         *Analyzer
+	ctx       context.Context
+	result    *models.FileAnalysis
+	total     int64
+	urls      urlCollector
+	limited   bool // A members-or-total limit has been reported
+	limitHits int  // Members skipped by any limit
+}
+
+func (w *walker) warn(format string, args ...interface{}) {
+	w.result.Warnings = append(w.result.Warnings, fmt.Sprintf(format, args...))
+}
+
+// visit analyzes one member and recurses into it if it is a container.
+func (w *walker) visit(memberPath string, data []byte, depth int) {
+	typ := DetectType(memberPath, data)
+	m := &models.FileMember{
+		Path:  memberPath,
+		Type:  typ,
+		Size:  int64(len(data)),
+		Depth: depth,
+	}
+	w.result.Members = append(w.result.Members, m)
+
+	m.Behavior = w.a.malware.AnalyzeBytes(baseName(memberPath), data)
+	m.Hashes = m.Behavior.FileHashes
+	m.YaraMatches = w.a.yara.Scan(data)
+	m.URLs = memberURLs(typ, data)
+	for _, u := range m.URLs {
+		w.urls.add(u, false)
+	}
+	w.result.URLs = w.urls.urls
+
+	if !isContainer(typ) {
+		if typ == Type7Z || typ == TypeRAR {
+			w.warn("%s: %s archives are not unpacked", memberPath, typ)
+		}
+		return
+	}
+	if depth >= w.a.limits.MaxDepth {
+		w.limitHits++
+		w.warn("%s: nested deeper than %d containers; not unpacked", memberPath, w.a.limits.MaxDepth)
+		return
+	}
+	if err := w.ctx.Err(); err != nil {
+		w.limit("analysis stopped: %v", err)
+		return
+	}
+
+	var err error
+	switch typ {
+	case TypeZIP, TypeOOXML:
+		err = w.unzip(memberPath, data, depth)
+	case TypeTAR:
+		err = w.untar(memberPath, bytes.NewReader(data), depth)
+	case TypeGZIP:
+		err = w.gunzip(memberPath, data, depth)
+	case TypeOLE:
+		err = w.ole(memberPath, data, depth)
+	}
+	if err != nil {
+		m.Error = err.Error()
+		w.warn("%s: %v", memberPath, err)
+	}
+}
+
+// baseName is the file name of the innermost member in a "!"-joined path.
+func baseName(memberPath string) string {
+	return path.Base(memberPath[strings.LastIndex(memberPath, "!")+1:])
+}
+
+// limit records a limit that stops the rest of the analysis, once.
+func (w *walker) limit(format string, args ...interface{}) {
+	w.limitHits++
+	if !w.limited {
+		w.limited = true
+		w.warn(format, args...)
+	}
+}
+
+// read decompresses one member within the size, total and ratio limits.
+// compressed is the member's stored size, or 0 when unknown.
+func (w *walker) read(memberPath string, r io.Reader, compressed int64) ([]byte, error) {
+	limit := w.a.limits.MaxMemberBytes
+	if remaining := w.a.limits.MaxTotalBytes - w.total; remaining < limit {
+		limit = remaining
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(data))
+	switch {
+	case size > w.a.limits.MaxMemberBytes:
+		return nil, fmt.Errorf("%w: %s decompresses to more than %d bytes", errLimit, memberPath, w.a.limits.MaxMemberBytes)
+	case size > limit:
+		w.limit("more than %d decompressed bytes in total; the rest were not analyzed", w.a.limits.MaxTotalBytes)
+		return nil, errLimit
+	case compressed > 0 && size > ratioFloor && size/compressed > w.a.limits.MaxRatio:
+		return nil, fmt.Errorf("%w: %s compression ratio %d exceeds %d", errLimit, memberPath, size/compressed, w.a.limits.MaxRatio)
+	}
+	w.total += size
+	return data, nil
+}
+
+// child reads and visits one member. It reports whether unpacking should go on.
+func (w *walker) child(parent, name string, r io.Reader, compressed int64, depth int) bool {
+	if len(w.result.Members) >= w.a.limits.MaxMembers {
+		w.limit("more than %d members; the rest were not analyzed", w.a.limits.MaxMembers)
+		return false
+	}
+	if err := w.ctx.Err(); err != nil {
+		w.limit("analysis stopped: %v", err)
+		return false
+	}
+	memberPath := parent + "!" + name
+	data, err := w.read(memberPath, r, compressed)
+	switch {
+	case w.limited:
+		return false
+	case err != nil:
+		if errors.Is(err, errLimit) {
+			w.limitHits++
+		}
+		w.warn("%v", err)
+		return true
+	}
+	w.visit(memberPath, data, depth)
+	return !w.limited
+}
+
+func (w *walker) unzip(memberPath string, data []byte, depth int) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("unreadable ZIP: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if f.Flags&0x1 != 0 {
+			w.warn("%s!%s: encrypted; not analyzed", memberPath, f.Name)
+			continue
+		}
+		// The declared size is attacker controlled, but checking it first saves
+		// inflating an obvious bomb.
+		if int64(f.UncompressedSize64) > w.a.limits.MaxMemberBytes {
+			w.limitHits++
+			w.warn("%s!%s: declares %d bytes, more than %d; not unpacked", memberPath, f.Name, f.UncompressedSize64, w.a.limits.MaxMemberBytes)
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			w.warn("%s!%s: %v", memberPath, f.Name, err)
+			continue
+		}
+		more := w.child(memberPath, f.Name, rc, int64(f.CompressedSize64), depth+1)
+		rc.Close()
+		if !more {
+			break
+		}
+	}
+	return nil
+}
+
+func (w *walker) untar(memberPath string, r io.Reader, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unreadable TAR: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if !w.child(memberPath, hdr.Name, tr, 0, depth+1) {
+			return nil
+		}
+	}
+}
+
+func (w *walker) gunzip(memberPath string, data []byte, depth int) error {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unreadable GZIP: %w", err)
+	}
+	defer zr.Close()
+	zr.Multistream(false)
+
+	name := zr.Name
+	if name == "" {
+		name = strings.TrimSuffix(baseName(memberPath), ".gz")
+		if strings.HasSuffix(strings.ToLower(name), ".tgz") {
+			name = strings.TrimSuffix(name, ".tgz") + ".tar"
+		}
+	}
+	w.child(memberPath, path.Base(name), zr, int64(len(data)), depth+1)
+	return nil
+}
+
+// ole extracts the VBA macros of a compound file. Each module's source becomes
+// a member of its own so the script heuristics and YARA see the code rather
+// than its compressed form.
+func (w *walker) ole(memberPath string, data []byte, depth int) error {
+	f, err := openOLE(data)
+	if err != nil {
+		return fmt.Errorf("unreadable compound file: %w", err)
+	}
+	macros, errs := extractVBA(f, memberPath)
+	for _, err := range errs {
+		w.warn("%s: VBA: %v", memberPath, err)
+	}
+	for _, m := range macros {
+		w.result.Macros = append(w.result.Macros, m)
+		if !w.child(memberPath, m.Module+".vba", strings.NewReader(m.Code), 0, depth+1) {
+			break
+		}
+	}
+	return nil
+}
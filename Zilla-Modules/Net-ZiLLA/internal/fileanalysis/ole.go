@@ -0,0 +1,249 @@
+package fileanalysis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Compound File Binary ([MS-CFB]) reader, enough to pull streams out of legacy
+// Office documents and vbaProject.bin. Every chain walk is bounded so corrupt or
+// hostile files fail instead of looping.
+
+var oleSignature = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+const (
+	oleMaxRegSect  = 0xfffffffa
+	oleEndOfChain  = 0xfffffffe
+	oleNoStream    = 0xffffffff
+	oleDirEntry    = 128
+	oleTypeStorage = 1
+	oleTypeStream  = 2
+	oleTypeRoot    = 5
+)
+
+type oleFile struct {
+	data           []byte
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint64
+	fat            []uint32
+	miniFAT        []uint32
+	miniStream     []byte
+	entries        []oleEntry
+}
+
+type oleEntry struct {
+	name               string
+	typ                byte
+	left, right, child uint32
+	start              uint32
+	size               uint64
+}
+
+func openOLE(data []byte) (*oleFile, error) {
+	if len(data) < 512 || !bytes.HasPrefix(data, oleSignature) {
+		return nil, fmt.Errorf("not a compound file")
+	}
+	le := binary.LittleEndian
+	f := &oleFile{
+		data:           data,
+		sectorSize:     1 << le.Uint16(data[0x1e:]),
+		miniSectorSize: 1 << le.Uint16(data[0x20:]),
+		miniCutoff:     uint64(le.Uint32(data[0x38:])),
+	}
+	if f.sectorSize != 512 && f.sectorSize != 4096 || f.miniSectorSize != 64 {
+		return nil, fmt.Errorf("unsupported sector size %d/%d", f.sectorSize, f.miniSectorSize)
+	}
+
+	// FAT sector numbers: 109 in the header, the rest in the DIFAT chain.
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		if s := le.Uint32(data[0x4c+4*i:]); s < oleMaxRegSect {
+			fatSectors = append(fatSectors, s)
+		}
+	}
+	perSector := f.sectorSize/4 - 1
+	difat := le.Uint32(data[0x44:])
+	for n := 0; difat < oleMaxRegSect; n++ {
+		sector, err := f.sector(difat)
+		if err != nil || n > len(data)/f.sectorSize {
+			return nil, fmt.Errorf("bad DIFAT chain")
+		}
+		for i := 0; i < perSector; i++ {
+			if s := le.Uint32(sector[4*i:]); s < oleMaxRegSect {
+				fatSectors = append(fatSectors, s)
+			}
+		}
+		difat = le.Uint32(sector[4*perSector:])
+	}
+	for _, s := range fatSectors {
+		sector, err := f.sector(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad FAT: %w", err)
+		}
+		for i := 0; i < f.sectorSize; i += 4 {
+			f.fat = append(f.fat, le.Uint32(sector[i:]))
+		}
+	}
+
+	dir, err := f.chain(le.Uint32(data[0x30:]), 0)
+	if err != nil {
+		return nil, fmt.Errorf("bad directory: %w", err)
+	}
+	for off := 0; off+oleDirEntry <= len(dir); off += oleDirEntry {
+		f.entries = append(f.entries, parseOLEEntry(dir[off:off+oleDirEntry]))
+	}
+	if len(f.entries) == 0 || f.entries[0].typ != oleTypeRoot {
+		return nil, fmt.Errorf("missing root entry")
+	}
+
+	if miniFAT, err := f.chain(le.Uint32(data[0x3c:]), 0); err == nil {
+		for i := 0; i+4 <= len(miniFAT); i += 4 {
+			f.miniFAT = append(f.miniFAT, le.Uint32(miniFAT[i:]))
+		}
+	}
+	root := f.entries[0]
+	if f.miniStream, err = f.chain(root.start, root.size); err != nil {
+		return nil, fmt.Errorf("bad mini stream: %w", err)
+	}
+	return f, nil
+}
+
+func parseOLEEntry(b []byte) oleEntry {
+	le := binary.LittleEndian
+	nameLen := int(le.Uint16(b[64:]))
+	if nameLen > 64 {
+		nameLen = 64
+	}
+	units := make([]uint16, 0, 32)
+	for i := 0; i+1 < nameLen; i += 2 {
+		if u := le.Uint16(b[i:]); u != 0 {
+			units = append(units, u)
+		}
+	}
+	return oleEntry{
+		name:  string(utf16.Decode(units)),
+		typ:   b[66],
+		left:  le.Uint32(b[68:]),
+		right: le.Uint32(b[72:]),
+		child: le.Uint32(b[76:]),
+		start: le.Uint32(b[116:]),
+		size:  le.Uint64(b[120:]),
+	}
+}
+
+func (f *oleFile) sector(n uint32) ([]byte, error) {
+	off := (int64(n) + 1) * int64(f.sectorSize)
+	if off+int64(f.sectorSize) > int64(len(f.data)) {
+		return nil, fmt.Errorf("sector %d out of range", n)
+	}
+	return f.data[off : off+int64(f.sectorSize)], nil
+}
+
+// chain reads a FAT chain. A size of 0 reads the whole chain.
+func (f *oleFile) chain(start uint32, size uint64) ([]byte, error) {
+	var out []byte
+	for n, s := 0, start; s != oleEndOfChain && s != oleNoStream; n++ {
+		if int(s) >= len(f.fat) || n > len(f.fat) {
+			return nil, fmt.Errorf("broken sector chain")
+		}
+		sector, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sector...)
+		if size > 0 && uint64(len(out)) >= size {
+			break
+		}
+		s = f.fat[s]
+	}
+	if size > 0 && uint64(len(out)) > size {
+		out = out[:size]
+	}
+	return out, nil
+}
+
+func (f *oleFile) miniChain(start uint32, size uint64) ([]byte, error) {
+	var out []byte
+	for n, s := 0, start; s != oleEndOfChain && uint64(len(out)) < size; n++ {
+		if int(s) >= len(f.miniFAT) || n > len(f.miniFAT) {
+			return nil, fmt.Errorf("broken mini sector chain")
+		}
+		off := int(s) * f.miniSectorSize
+		if off+f.miniSectorSize > len(f.miniStream) {
+			return nil, fmt.Errorf("mini sector %d out of range", s)
+		}
+		out = append(out, f.miniStream[off:off+f.miniSectorSize]...)
+		s = f.miniFAT[s]
+	}
+	if uint64(len(out)) > size {
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// stream returns the contents of a stream entry.
+func (f *oleFile) stream(e *oleEntry) ([]byte, error) {
+	if e.size > uint64(len(f.data)) {
+		return nil, fmt.Errorf("stream %q larger than the file", e.name)
+	}
+	if e.size == 0 {
+		return nil, nil
+	}
+	if e.size < f.miniCutoff {
+		return f.miniChain(e.start, e.size)
+	}
+	return f.chain(e.start, e.size)
+}
+
+// children returns the entries directly inside a storage, walking its
+// red-black tree of siblings.
+func (f *oleFile) children(storage int) []int {
+	var out []int
+	seen := make(map[uint32]bool)
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		if id == oleNoStream || int(id) >= len(f.entries) || seen[id] {
+			return
+		}
+		seen[id] = true
+		walk(f.entries[id].left)
+		out = append(out, int(id))
+		walk(f.entries[id].right)
+	}
+	walk(f.entries[storage].child)
+	return out
+}
+
+// child finds an entry in a storage by case-insensitive name.
+func (f *oleFile) child(storage int, name string) (int, bool) {
+	for _, id := range f.children(storage) {
+		if strings.EqualFold(f.entries[id].name, name) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// walk calls fn for every entry below the root with its "/"-joined path.
+func (f *oleFile) walk(fn func(id int, path string)) {
+	seen := make(map[int]bool)
+	var visit func(storage int, prefix string)
+	visit = func(storage int, prefix string) {
+		if seen[storage] {
+			return
+		}
+		seen[storage] = true
+		for _, id := range f.children(storage) {
+			p := prefix + f.entries[id].name
+			fn(id, p)
+			if f.entries[id].typ == oleTypeStorage {
+				visit(id, p+"/")
+			}
+		}
+	}
+	visit(0, "")
+}
@@ -0,0 +1,101 @@
+package fileanalysis
+
+// defaultRules are the YARA rules every analysis runs; rules loaded from
+// analysis.yara_rules or -yara are added to them. The severity meta value sets
+// how much a match adds to the risk score.
+const defaultRules = `
+rule PowerShell_Encoded_Command : downloader
+{
+    meta:
+        description = "Launches PowerShell with an encoded or hidden command"
+        severity = "high"
+    strings:
+        $ps = "powershell" nocase ascii wide
+        $enc = /-e(nc|ncodedcommand)?\s+[A-Za-z0-9+\/=]{40,}/ nocase
+        $hidden = /-w(indowstyle)?\s+hidden/ nocase
+        $iex = /\b(iex|invoke-expression)\b/ nocase
+    condition:
+        $ps and ($enc or ($hidden and $iex))
+}
+
+rule Script_Download_Execute : downloader
+{
+    meta:
+        description = "Fetches a payload and writes or runs it"
+        severity = "high"
+    strings:
+        $d1 = "URLDownloadToFile" nocase ascii wide
+        $d2 = "MSXML2.XMLHTTP" nocase ascii wide
+        $d3 = "WinHttp.WinHttpRequest" nocase ascii wide
+        $d4 = "DownloadString" nocase ascii wide
+        $d5 = "DownloadFile" nocase ascii wide
+        $d6 = "Invoke-WebRequest" nocase ascii wide
+        $x1 = "WScript.Shell" nocase ascii wide
+        $x2 = "Shell.Application" nocase ascii wide
+        $x3 = "ADODB.Stream" nocase ascii wide
+        $x4 = "Start-Process" nocase ascii wide
+        $x5 = "certutil" nocase ascii wide
+    condition:
+        any of ($d*) and any of ($x*)
+}
+
+rule Embedded_PE_Executable : dropper
+{
+    meta:
+        description = "Carries a Windows executable inside a non-executable file"
+        severity = "high"
+    strings:
+        $dos = "This program cannot be run in DOS mode"
+    condition:
+        $dos and uint16(0) != 0x5A4D
+}
+
+rule PDF_Auto_JavaScript : pdf
+{
+    meta:
+        description = "PDF runs JavaScript or launches a program when opened"
+        severity = "high"
+    strings:
+        $js1 = "/JavaScript"
+        $js2 = "/JS"
+        $launch = "/Launch"
+        $open = "/OpenAction"
+        $aa = "/AA"
+    condition:
+        uint32(0) == 0x46445025 and ($open or $aa) and (any of ($js*) or $launch)
+}
+
+rule HTML_Smuggling : dropper
+{
+    meta:
+        description = "HTML assembles a file in the browser and saves it"
+        severity = "high"
+    strings:
+        $blob = "new Blob(" nocase
+        $url = "createObjectURL" nocase
+        $save = "msSaveOrOpenBlob" nocase
+        $dl = ".download" nocase
+        $b64 = "atob(" nocase
+    condition:
+        $save or ($blob and $url and $dl and $b64)
+}
+
+rule Credential_Harvesting_Form : phishing
+{
+    meta:
+        description = "Local HTML login form impersonating a well-known service"
+        severity = "medium"
+    strings:
+        $form = "<form" nocase
+        $pw = /type\s*=\s*["']?password/ nocase
+        $b1 = "Microsoft" nocase
+        $b2 = "Office 365" nocase
+        $b3 = "Outlook" nocase
+        $b4 = "PayPal" nocase
+        $b5 = "DocuSign" nocase
+        $b6 = "OneDrive" nocase
+        $b7 = "SharePoint" nocase
+    condition:
+        $form and $pw and any of ($b*)
+}
+`
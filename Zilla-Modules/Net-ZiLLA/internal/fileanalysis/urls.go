@@ -0,0 +1,166 @@
+package fileanalysis
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"net-zilla/internal/message"
+)
+
+// maxPDFInflate caps how much a PDF's Flate streams may expand in total.
+const maxPDFInflate = 32 << 20
+
+// namespaceHosts serve XML namespaces and schemas that appear in every Office
+// document and PDF; they are never what a document links to.
+var namespaceHosts = map[string]bool{
+	"schemas.openxmlformats.org": true,
+	"schemas.microsoft.com":      true,
+	"www.w3.org":                 true,
+	"purl.org":                   true,
+	"ns.adobe.com":               true,
+	"schemas.xmlsoap.org":        true,
+	"www.xfa.org":                true,
+	"schemas.android.com":        true,
+	"xml.org":                    true,
+	"www.xml.org":                true,
+	"ns.microsoft.com":           true,
+	"openoffice.org":             true,
+}
+
+var (
+	pdfStream    = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\nendstream`)
+	pdfURIHex    = regexp.MustCompile(`/URI\s*<([0-9A-Fa-f\s]+)>`)
+	pdfURIString = regexp.MustCompile(`/URI\s*\(`)
+	asciiRun     = regexp.MustCompile(`[\x20-\x7e]{6,}`)
+	utf16Run     = regexp.MustCompile(`(?:[\x20-\x7e]\x00){6,}`)
+)
+
+// urlCollector keeps the distinct URLs found in a member.
+type urlCollector struct {
+	urls []string
+	seen map[string]bool
+}
+
+func (c *urlCollector) add(raw string, schemeOnly bool) {
+	for _, u := range message.ExtractURLs(raw) {
+		lower := strings.ToLower(u.Raw)
+		if schemeOnly && !strings.Contains(lower, "://") && !strings.HasPrefix(lower, "www.") {
+			continue
+		}
+		parsed, err := url.Parse(u.URL)
+		if err != nil || namespaceHosts[strings.ToLower(parsed.Hostname())] {
+			continue
+		}
+		if c.seen == nil {
+			c.seen = make(map[string]bool)
+		}
+		if !c.seen[u.URL] {
+			c.seen[u.URL] = true
+			c.urls = append(c.urls, u.URL)
+		}
+	}
+}
+
+// memberURLs finds the links in one member. Text is searched as written (XML
+// entities decoded, so Office relationship targets come out whole); PDFs through
+// their /URI actions, including those in compressed object streams; binaries
+// through their printable ASCII and UTF-16 strings.
+func memberURLs(typ string, data []byte) []string {
+	var c urlCollector
+	switch typ {
+	case TypePDF:
+		pdfURLs(&c, data)
+	case TypeXML, TypeHTML, TypeRTF:
+		c.add(html.UnescapeString(string(data)), true)
+	case TypeScript, TypeText, TypeVBA:
+		c.add(string(data), false)
+	case TypeOLE, TypeUnknown:
+		binaryStringURLs(&c, data)
+	}
+	return c.urls
+}
+
+func binaryStringURLs(c *urlCollector, data []byte) {
+	for _, run := range asciiRun.FindAll(data, -1) {
+		c.add(string(run), true)
+	}
+	for _, run := range utf16Run.FindAll(data, -1) {
+		units := make([]uint16, len(run)/2)
+		for i := range units {
+			units[i] = uint16(run[2*i])
+		}
+		c.add(string(utf16.Decode(units)), true)
+	}
+}
+
+func pdfURLs(c *urlCollector, data []byte) {
+	pdfURIs(c, data)
+	budget := int64(maxPDFInflate)
+	for _, m := range pdfStream.FindAllSubmatch(data, -1) {
+		if budget <= 0 {
+			return
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			continue
+		}
+		inflated, _ := io.ReadAll(io.LimitReader(zr, budget))
+		zr.Close()
+		budget -= int64(len(inflated))
+		pdfURIs(c, inflated)
+	}
+}
+
+func pdfURIs(c *urlCollector, data []byte) {
+	for _, m := range pdfURIHex.FindAllSubmatch(data, -1) {
+		if b, err := hex.DecodeString(strings.Join(strings.Fields(string(m[1])), "")); err == nil {
+			c.add(string(b), false)
+		}
+	}
+	for _, loc := range pdfURIString.FindAllIndex(data, -1) {
+		c.add(pdfLiteral(data[loc[1]:]), false)
+	}
+}
+
+// pdfLiteral reads a PDF literal string whose opening parenthesis has been
+// consumed: balanced parentheses nest and backslash escapes are resolved.
+func pdfLiteral(data []byte) string {
+	var sb strings.Builder
+	depth := 1
+	for i := 0; i < len(data) && sb.Len() < 8192; i++ {
+		switch c := data[i]; c {
+		case '\\':
+			if i+1 < len(data) {
+				i++
+				switch e := data[i]; e {
+				case 'n':
+					sb.WriteByte('\n')
+				case 'r', 't', 'b', 'f':
+					sb.WriteByte(' ')
+				case '\r', '\n':
+				default:
+					sb.WriteByte(e)
+				}
+			}
+		case '(':
+			depth++
+			sb.WriteByte(c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return sb.String()
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
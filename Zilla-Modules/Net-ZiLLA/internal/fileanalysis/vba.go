@@ -0,0 +1,245 @@
+package fileanalysis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+// maxVBASource caps the decompressed size of one dir stream or module.
+const maxVBASource = 16 << 20
+
+// vbaModule is a module listed in a VBA project's dir stream.
+type vbaModule struct {
+	name   string
+	stream string
+	offset uint32
+}
+
+// extractVBA returns the source of every module in every VBA project stored in
+// a compound file. Word keeps the project under Macros/VBA, Excel under
+// _VBA_PROJECT_CUR/VBA and vbaProject.bin at the root, so any VBA storage with
+// a dir stream counts.
+func extractVBA(f *oleFile, member string) ([]models.VBAMacro, []error) {
+	var macros []models.VBAMacro
+	var errs []error
+	f.walk(func(id int, path string) {
+		if f.entries[id].typ != oleTypeStorage || !strings.EqualFold(f.entries[id].name, "VBA") {
+			return
+		}
+		dirID, ok := f.child(id, "dir")
+		if !ok {
+			return
+		}
+		raw, err := f.stream(&f.entries[dirID])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/dir: %w", path, err))
+			return
+		}
+		dir, err := decompressVBA(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/dir: %w", path, err))
+			return
+		}
+		for _, m := range parseVBADir(dir) {
+			streamID, ok := f.child(id, m.stream)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: module stream %q missing", path, m.stream))
+				continue
+			}
+			data, err := f.stream(&f.entries[streamID])
+			if err == nil && int64(m.offset) > int64(len(data)) {
+				err = fmt.Errorf("source offset %d past end of stream", m.offset)
+			}
+			var code []byte
+			if err == nil {
+				code, err = decompressVBA(data[m.offset:])
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s/%s: %w", path, m.stream, err))
+				continue
+			}
+			source := latin1String(code)
+			macros = append(macros, models.VBAMacro{
+				Member:     member,
+				Module:     m.name,
+				Code:       source,
+				AutoExec:   matchKeywords(source, autoExecKeywords),
+				Suspicious: matchKeywords(source, suspiciousKeywords),
+			})
+		}
+	})
+	return macros, errs
+}
+
+// parseVBADir reads the module records from a decompressed dir stream
+// ([MS-OVBA] 2.3.4.2). Records are id(2) size(4) data, except PROJECTVERSION,
+// whose size field is 4 but which carries 6 bytes.
+func parseVBADir(dir []byte) []vbaModule {
+	le := binary.LittleEndian
+	var modules []vbaModule
+	var cur *vbaModule
+	for pos := 0; pos+6 <= len(dir); {
+		id := le.Uint16(dir[pos:])
+		size := int(le.Uint32(dir[pos+2:]))
+		if id == 0x0009 {
+			size = 6
+		}
+		pos += 6
+		if size < 0 || pos+size > len(dir) {
+			break
+		}
+		data := dir[pos : pos+size]
+		pos += size
+
+		switch id {
+		case 0x0019: // MODULENAME
+			cur = &vbaModule{name: latin1String(data), stream: latin1String(data)}
+		case 0x001a: // MODULESTREAMNAME
+			if cur != nil {
+				cur.stream = latin1String(data)
+			}
+		case 0x0031: // MODULEOFFSET
+			if cur != nil && len(data) >= 4 {
+				cur.offset = le.Uint32(data)
+			}
+		case 0x002b: // Module terminator
+			if cur != nil {
+				modules = append(modules, *cur)
+				cur = nil
+			}
+		case 0x0010: // dir stream terminator
+			return modules
+		}
+	}
+	return modules
+}
+
+// decompressVBA implements the [MS-OVBA] 2.4.1 compression used for the dir
+// stream and module source: a 0x01 signature, then chunks of up to 4096
+// decompressed bytes made of literals and copy tokens whose offset/length split
+// depends on how far into the chunk the decoder is.
+func decompressVBA(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != 0x01 {
+		return nil, fmt.Errorf("not VBA compressed data")
+	}
+	var out []byte
+	for pos := 1; pos+2 <= len(data); {
+		header := binary.LittleEndian.Uint16(data[pos:])
+		chunkEnd := pos + int(header&0x0fff) + 3
+		if chunkEnd > len(data) {
+			chunkEnd = len(data)
+		}
+		pos += 2
+		chunkStart := len(out)
+
+		if header&0x8000 == 0 {
+			end := pos + 4096
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[pos:end]...)
+			pos = end
+			continue
+		}
+
+		for pos < chunkEnd {
+			flags := data[pos]
+			pos++
+			for bit := 0; bit < 8 && pos < chunkEnd; bit++ {
+				if flags&(1<<bit) == 0 {
+					out = append(out, data[pos])
+					pos++
+					continue
+				}
+				if pos+2 > chunkEnd {
+					return nil, fmt.Errorf("truncated copy token")
+				}
+				token := int(binary.LittleEndian.Uint16(data[pos:]))
+				pos += 2
+
+				decoded := len(out) - chunkStart
+				bitCount := 4
+				for 1<<bitCount < decoded {
+					bitCount++
+				}
+				offset := token>>(16-bitCount) + 1
+				length := token&(0xffff>>bitCount) + 3
+				if offset > decoded {
+					return nil, fmt.Errorf("copy token reaches before the chunk")
+				}
+				for i := 0; i < length; i++ {
+					out = append(out, out[len(out)-offset])
+				}
+			}
+		}
+		if len(out) > maxVBASource {
+			return nil, fmt.Errorf("decompressed source exceeds %d bytes", maxVBASource)
+		}
+	}
+	return out, nil
+}
+
+// latin1String decodes single-byte text. VBA source is stored in the project's
+// ANSI code page, which for the keywords that matter here is ASCII.
+func latin1String(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+type keyword struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+func keywords(names ...string) []keyword {
+	out := make([]keyword, len(names))
+	for i, n := range names {
+		p := regexp.QuoteMeta(n)
+		if isWordByte(n[0]) {
+			p = `\b` + p
+		}
+		if isWordByte(n[len(n)-1]) {
+			p += `\b`
+		}
+		out[i] = keyword{name: n, pattern: regexp.MustCompile(`(?i)` + p)}
+	}
+	return out
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Entry points Office runs without the user choosing to run a macro.
+var autoExecKeywords = keywords(
+	"AutoOpen", "AutoExec", "AutoClose", "AutoNew", "Auto_Open", "Auto_Close",
+	"Document_Open", "Document_Close", "Document_New", "DocumentOpen",
+	"Workbook_Open", "Workbook_Activate", "Workbook_BeforeClose",
+	"Document_ContentControlOnEnter", "InkPicture1_Painted",
+)
+
+// Calls that run programs, fetch payloads, touch memory or hide strings.
+var suspiciousKeywords = keywords(
+	"Shell", "WScript.Shell", "Shell.Application", "CreateObject", "GetObject", "CallByName",
+	"URLDownloadToFile", "XMLHTTP", "WinHttpRequest", "ADODB.Stream", "SaveToFile",
+	"powershell", "cmd.exe", "mshta", "certutil", "regsvr32", "rundll32",
+	"VirtualAlloc", "RtlMoveMemory", "CreateThread", "Lib", "ExecuteExcel4Macro",
+	"Environ", "Chr(", "ChrW(", "StrReverse", "FromBase64String",
+)
+
+func matchKeywords(source string, list []keyword) []string {
+	var found []string
+	for _, k := range list {
+		if k.pattern.MatchString(source) {
+			found = append(found, k.name)
+		}
+	}
+	return found
+}
@@ -0,0 +1,170 @@
+package message
+
+import (
+	"net/mail"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+// authResult is one method=result entry of an Authentication-Results header.
+type authResult struct {
+	method string
+	result string
+	props  map[string]string // e.g. smtp.mailfrom, header.d, header.from
+}
+
+// parseAuthentication reads the SPF, DKIM and DMARC verdicts the receiving
+// server stamped on the message and checks relaxed DMARC alignment against the
+// From domain. Only the topmost Authentication-Results header is used: lower
+// ones were added by hops the recipient does not control and can be forged.
+func parseAuthentication(h mail.Header, fromDomain, returnPath string) *models.EmailAuthentication {
+	auth := &models.EmailAuthentication{
+		Source:     "none",
+		FromDomain: fromDomain,
+		SPF:        "none",
+		DKIM:       "none",
+		DMARC:      "none",
+	}
+
+	reportedDMARC := ""
+	if values := h["Authentication-Results"]; len(values) > 0 {
+		auth.Source = "Authentication-Results"
+		var dkims []authResult
+		for _, r := range parseAuthResults(values[0]) {
+			switch r.method {
+			case "spf":
+				auth.SPF = r.result
+				auth.SPFDomain = domainOf(firstNonEmpty(r.props["smtp.mailfrom"], r.props["smtp.helo"]))
+			case "dkim":
+				dkims = append(dkims, r)
+			case "dmarc":
+				reportedDMARC = r.result
+			}
+		}
+		// A message can carry several signatures; the one that counts for DMARC
+		// is a passing signature from the From domain.
+		best := -1
+		for _, r := range dkims {
+			d := domainOf(firstNonEmpty(r.props["header.d"], r.props["header.i"]))
+			rank := 0
+			if r.result == "pass" {
+				rank = 1
+				if aligned(d, fromDomain) {
+					rank = 2
+				}
+			}
+			if rank > best {
+				best = rank
+				auth.DKIM, auth.DKIMDomain = r.result, d
+			}
+		}
+	} else if values := h["Received-Spf"]; len(values) > 0 {
+		auth.Source = "Received-SPF"
+		result, props := parseReceivedSPF(values[0])
+		auth.SPF = result
+		auth.SPFDomain = domainOf(firstNonEmpty(props["envelope-from"], props["helo"]))
+	}
+
+	if auth.SPFDomain == "" && auth.SPF != "none" {
+		auth.SPFDomain = domainOf(returnPath)
+	}
+	auth.SPFAligned = auth.SPF == "pass" && aligned(auth.SPFDomain, fromDomain)
+	auth.DKIMAligned = auth.DKIM == "pass" && aligned(auth.DKIMDomain, fromDomain)
+
+	switch {
+	case reportedDMARC != "":
+		auth.DMARC = reportedDMARC
+	case auth.SPFAligned || auth.DKIMAligned:
+		auth.DMARC = "pass"
+	case auth.Source == "Authentication-Results":
+		// Both mechanisms were evaluated and neither produced an aligned pass.
+		auth.DMARC = "fail"
+	}
+	return auth
+}
+
+// parseAuthResults splits an RFC 8601 header value into its results. The
+// leading authserv-id and any (comments) are dropped.
+func parseAuthResults(value string) []authResult {
+	var results []authResult
+	for i, stmt := range strings.Split(stripComments(value), ";") {
+		fields := strings.Fields(stmt)
+		if len(fields) == 0 || i == 0 && !strings.Contains(fields[0], "=") {
+			continue
+		}
+		method, result, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			continue
+		}
+		r := authResult{
+			method: strings.ToLower(method),
+			result: strings.ToLower(result),
+			props:  make(map[string]string),
+		}
+		for _, f := range fields[1:] {
+			if k, v, ok := strings.Cut(f, "="); ok {
+				r.props[strings.ToLower(k)] = strings.Trim(v, `"`)
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// parseReceivedSPF reads "result (comment) key=value; key=value" (RFC 7208 9.1).
+func parseReceivedSPF(value string) (string, map[string]string) {
+	value = stripComments(value)
+	fields := strings.Fields(value)
+	result := "none"
+	if len(fields) > 0 {
+		result = strings.ToLower(fields[0])
+	}
+	props := make(map[string]string)
+	for _, kv := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ' ' }) {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			props[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return result, props
+}
+
+func stripComments(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// aligned implements relaxed DMARC alignment: both domains share an
+// organizational domain.
+func aligned(domain, fromDomain string) bool {
+	return domain != "" && fromDomain != "" && registrableDomain(domain) == registrableDomain(fromDomain)
+}
+
+// domainOf returns the domain of an address, a bare domain or an "@domain" identity.
+func domainOf(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), "<>")
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSuffix(strings.ToLower(s), ".")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
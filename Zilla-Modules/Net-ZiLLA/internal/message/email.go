@@ -0,0 +1,251 @@
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+
+	"net-zilla/internal/models"
+)
+
+// Limits that keep a hostile .eml from exhausting memory or recursion.
+const (
+	MaxEmailSize = 25 << 20
+	maxMIMEParts = 200
+	maxMIMEDepth = 8
+)
+
+// headerGetter is satisfied by both mail.Header and textproto.MIMEHeader.
+type headerGetter interface {
+	Get(key string) string
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// ParseEmail parses a raw RFC 5322 message (.eml), walking its MIME tree for
+// text, HTML, attached messages and images. QR codes in images are decoded so
+// "quishing" links are analyzed like any other.
+func ParseEmail(r io.Reader) (*Message, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxEmailSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email: %w", err)
+	}
+	if len(data) > MaxEmailSize {
+		return nil, fmt.Errorf("email exceeds %d bytes", MaxEmailSize)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid email: %w", err)
+	}
+	if len(msg.Header) == 0 {
+		return nil, fmt.Errorf("invalid email: no headers")
+	}
+
+	m := &Message{Kind: KindEmail, Sender: parseSender(msg.Header), Raw: data}
+	m.Subject = decodeHeader(msg.Header.Get("Subject"))
+	m.Authentication = parseAuthentication(msg.Header, m.Sender.Domain, m.Sender.ReturnPath)
+	if m.Subject != "" {
+		m.addText(m.Subject, "subject")
+	}
+
+	w := &emailWalker{msg: m}
+	if err := w.walk(msg.Header, msg.Body, 0); err != nil {
+		return nil, err
+	}
+	text := w.plain
+	if len(text) == 0 {
+		text = w.html
+	}
+	m.Text = strings.TrimSpace(strings.Join(text, "\n\n"))
+	return m, nil
+}
+
+func parseSender(h mail.Header) *models.MessageSender {
+	s := &models.MessageSender{}
+	parser := &mail.AddressParser{WordDecoder: wordDecoder}
+	if from, err := parser.Parse(h.Get("From")); err == nil {
+		// Many mailers put encoded words inside quotes, which the parser leaves alone.
+		s.Address, s.DisplayName = from.Address, decodeHeader(from.Name)
+	} else {
+		s.Address = decodeHeader(h.Get("From"))
+	}
+	s.Domain = domainOf(s.Address)
+	if list, err := parser.ParseList(h.Get("Reply-To")); err == nil && len(list) > 0 {
+		s.ReplyTo = list[0].Address
+	}
+	s.ReturnPath = strings.Trim(strings.TrimSpace(h.Get("Return-Path")), "<>")
+	return s
+}
+
+// emailWalker accumulates the bodies found while walking the MIME tree.
+type emailWalker struct {
+	msg   *Message
+	parts int
+	plain []string
+	html  []string
+}
+
+func (w *emailWalker) walk(h headerGetter, body io.Reader, depth int) error {
+	if w.parts++; w.parts > maxMIMEParts {
+		return fmt.Errorf("email has more than %d MIME parts", maxMIMEParts)
+	}
+	if depth > maxMIMEDepth {
+		return fmt.Errorf("email MIME nesting exceeds %d levels", maxMIMEDepth)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				// Truncated or malformed trailers are common in phishing kits;
+				// keep what was parsed so far.
+				return nil
+			}
+			if err := w.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(body, MaxEmailSize))
+	if err != nil {
+		return fmt.Errorf("failed to read MIME part: %w", err)
+	}
+	data := decodeTransferEncoding(raw, h.Get("Content-Transfer-Encoding"))
+
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := decodeHeader(firstNonEmpty(dparams["filename"], params["name"]))
+	attached := disposition == "attachment" || filename != ""
+
+	switch {
+	case mediaType == "message/rfc822":
+		inner, err := mail.ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			return nil
+		}
+		if subject := decodeHeader(inner.Header.Get("Subject")); subject != "" {
+			w.msg.addText(subject, "subject")
+		}
+		return w.walk(inner.Header, inner.Body, depth+1)
+
+	case mediaType == "text/plain" && !attached:
+		text := decodeCharset(data, params["charset"])
+		w.plain = append(w.plain, text)
+		w.msg.addText(text, "text")
+
+	case mediaType == "text/html" && !attached:
+		parts := parseHTML(decodeCharset(data, params["charset"]))
+		w.html = append(w.html, parts.Text)
+		w.msg.addText(parts.Text, "html")
+		for _, link := range parts.Links {
+			w.msg.addLink(link, "html")
+		}
+		for _, img := range parts.Images {
+			att := newAttachment("", "image/inline", img)
+			w.msg.Attachments = append(w.msg.Attachments, att)
+			w.msg.addQRCodes(att, img)
+		}
+
+	default:
+		att := newAttachment(filename, mediaType, data)
+		w.msg.Attachments = append(w.msg.Attachments, att)
+		source := "attachment:" + firstNonEmpty(filename, mediaType)
+		switch {
+		case strings.HasPrefix(mediaType, "image/"):
+			w.msg.addQRCodes(att, data)
+		case mediaType == "text/html":
+			// HTML attachments are a common credential-phishing carrier.
+			parts := parseHTML(decodeCharset(data, params["charset"]))
+			w.msg.addText(parts.Text, source)
+			for _, link := range parts.Links {
+				w.msg.addLink(link, source)
+			}
+		case strings.HasPrefix(mediaType, "text/"):
+			w.msg.addText(decodeCharset(data, params["charset"]), source)
+		}
+	}
+	return nil
+}
+
+func newAttachment(filename, contentType string, data []byte) *models.MessageAttachment {
+	sum := sha256.Sum256(data)
+	return &models.MessageAttachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        len(data),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+}
+
+func decodeTransferEncoding(data []byte, encoding string) []byte {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		clean := bytes.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, data)
+		out := make([]byte, base64.StdEncoding.DecodedLen(len(clean)))
+		n, err := base64.StdEncoding.Decode(out, clean)
+		if err != nil && n == 0 {
+			return data
+		}
+		return out[:n]
+	case "quoted-printable":
+		out, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+		if err != nil && len(out) == 0 {
+			return data
+		}
+		return out
+	}
+	return data
+}
+
+// decodeCharset converts a body to UTF-8. Unknown charsets are passed through.
+func decodeCharset(data []byte, charset string) string {
+	if r, err := charsetReader(charset, bytes.NewReader(data)); err == nil {
+		if out, err := io.ReadAll(r); err == nil {
+			return string(out)
+		}
+	}
+	return string(data)
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return input, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q: %w", charset, err)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+func decodeHeader(v string) string {
+	if decoded, err := wordDecoder.DecodeHeader(v); err == nil {
+		return strings.TrimSpace(decoded)
+	}
+	return strings.TrimSpace(v)
+}
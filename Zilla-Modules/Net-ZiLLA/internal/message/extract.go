@@ -0,0 +1,215 @@
+package message
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ExtractedURL is a URL found in free text.
+type ExtractedURL struct {
+	URL      string // Refanged and given a scheme, ready for analysis
+	Raw      string // As written in the text
+	Defanged bool
+}
+
+var (
+	defangScheme = regexp.MustCompile(`(?i)\bh(?:xx|\*\*|tt)p(s?)\s*(?:\[:\]|\(:\)|:)\s*(?:\[/\]|/){2}`)
+	defangDot    = regexp.MustCompile(`(?i)\s?[\[({]\s*(?:\.|dot)\s*[\])}]\s?`)
+	defangColon  = regexp.MustCompile(`\[:\]`)
+	defangSlash  = regexp.MustCompile(`\[/\]`)
+
+	schemeURLPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'` + "`" + `]+`)
+	bareURLPattern   = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{1,23}\b(?:[/?#][^\s<>"'` + "`" + `]*)?`)
+	emailPattern     = regexp.MustCompile(`(?i)[a-z0-9._%+-]+@(?:[a-z0-9-]+\.)+[a-z]{2,}`)
+
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?(?:\(\d{1,5}\)[ .\-]?)?\d{1,5}(?:[ .\-]?\d{1,5}){0,5}`)
+	datePattern  = regexp.MustCompile(`^\d{1,4}[./-]\d{1,2}[./-]\d{1,4}$`)
+	ipv4Pattern  = regexp.MustCompile(`^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}$`)
+)
+
+// Refang undoes the usual ways of neutering links in reports and forwarded
+// messages: hxxp://, [:]//, example[.]com, example(dot)com and [/].
+func Refang(text string) string {
+	text = defangScheme.ReplaceAllString(text, "http$1://")
+	text = defangDot.ReplaceAllString(text, ".")
+	text = defangColon.ReplaceAllString(text, ":")
+	return defangSlash.ReplaceAllString(text, "/")
+}
+
+// ExtractURLs returns the distinct URLs in text, in order of appearance. Links
+// with a scheme or a www. prefix are always taken; bare host names such as
+// bit.ly/x or paypal-login.com only when they end in a real public suffix.
+// Email addresses are not mistaken for domains.
+func ExtractURLs(text string) []ExtractedURL {
+	refanged := Refang(text)
+	defanged := refanged != text
+
+	var found []ExtractedURL
+	seen := make(map[string]bool)
+	add := func(raw string) {
+		raw = trimURL(raw)
+		normalized, ok := normalizeURL(raw)
+		if !ok || seen[normalized] {
+			return
+		}
+		seen[normalized] = true
+		found = append(found, ExtractedURL{
+			URL:      normalized,
+			Raw:      raw,
+			Defanged: defanged && !strings.Contains(text, raw),
+		})
+	}
+
+	// Blank out what has been consumed so the bare-host pass does not re-match
+	// the host part of a full URL or the domain of an email address.
+	rest := []byte(refanged)
+	for _, loc := range schemeURLPattern.FindAllStringIndex(refanged, -1) {
+		add(refanged[loc[0]:loc[1]])
+		blank(rest, loc)
+	}
+	for _, loc := range emailPattern.FindAllIndex(rest, -1) {
+		blank(rest, loc)
+	}
+	for _, loc := range bareURLPattern.FindAllIndex(rest, -1) {
+		candidate := string(rest[loc[0]:loc[1]])
+		if loc[0] > 0 && (rest[loc[0]-1] == '@' || rest[loc[0]-1] == '.') {
+			continue
+		}
+		host := strings.ToLower(candidate)
+		if i := strings.IndexAny(host, "/?#"); i >= 0 {
+			host = host[:i]
+		}
+		if !isPublicHost(host) {
+			continue
+		}
+		add(candidate)
+	}
+	return found
+}
+
+// ExtractPhoneNumbers returns the distinct phone numbers in text, normalized to
+// digits with a leading + when one was written. Dates, IP addresses and bare
+// digit runs that look like codes or order numbers are skipped.
+func ExtractPhoneNumbers(text string) []string {
+	// Numbers inside links are paths and IDs, not phone numbers.
+	text = schemeURLPattern.ReplaceAllString(Refang(text), " ")
+
+	var numbers []string
+	seen := make(map[string]bool)
+	for _, loc := range phonePattern.FindAllStringIndex(text, -1) {
+		candidate := text[loc[0]:loc[1]]
+		if loc[0] > 0 && isWordChar(rune(text[loc[0]-1])) || loc[1] < len(text) && isWordChar(rune(text[loc[1]])) {
+			continue
+		}
+		if datePattern.MatchString(candidate) || ipv4Pattern.MatchString(candidate) {
+			continue
+		}
+		number := normalizePhone(candidate)
+		digits := strings.TrimPrefix(number, "+")
+		if len(digits) < 7 || len(digits) > 15 {
+			continue
+		}
+		if !strings.HasPrefix(number, "+") && candidate == digits && len(digits) < 10 {
+			continue
+		}
+		if !seen[number] {
+			seen[number] = true
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
+
+func normalizePhone(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r == '+' && i == 0 || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// trimURL drops punctuation that ends the surrounding sentence rather than the
+// URL, keeping a closing bracket when the URL opened it.
+func trimURL(raw string) string {
+	for raw != "" {
+		last := raw[len(raw)-1]
+		switch last {
+		case '.', ',', ';', ':', '!', '?', '\'', '"', '*':
+			raw = raw[:len(raw)-1]
+			continue
+		case ')', ']', '}':
+			open := map[byte]byte{')': '(', ']': '[', '}': '{'}[last]
+			if strings.Count(raw, string(open)) < strings.Count(raw, string(last)) {
+				raw = raw[:len(raw)-1]
+				continue
+			}
+		}
+		break
+	}
+	return raw
+}
+
+// normalizeURL gives scheme-less links https://, like URLParser does, and
+// rejects anything without a usable host.
+func normalizeURL(raw string) (string, bool) {
+	if raw == "" {
+		return "", false
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u.String(), true
+}
+
+// isPublicHost reports whether host ends in an ICANN public suffix and has a
+// registrable label in front of it, which rules out file names like setup.exe.
+func isPublicHost(host string) bool {
+	suffix, icann := publicsuffix.PublicSuffix(host)
+	return icann && suffix != host
+}
+
+// OrganizationalDomain returns the registrable domain of an email address, URL
+// or host name, e.g. "mail.example.co.uk" -> "example.co.uk".
+func OrganizationalDomain(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "://") {
+		if u, err := url.Parse(s); err == nil {
+			s = u.Hostname()
+		}
+	}
+	return registrableDomain(domainOf(s))
+}
+
+// registrableDomain is the organizational domain used for DMARC alignment.
+func registrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if d, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return d
+	}
+	return host
+}
+
+func blank(b []byte, loc []int) {
+	for i := loc[0]; i < loc[1]; i++ {
+		b[i] = ' '
+	}
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '/'
+}
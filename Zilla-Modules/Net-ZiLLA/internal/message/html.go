@@ -0,0 +1,104 @@
+package message
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// htmlParts is what an HTML body contributes: its visible text, the targets of
+// its links and forms, and any images embedded as data: URIs.
+type htmlParts struct {
+	Text   string
+	Links  []string
+	Images [][]byte
+}
+
+// linkAttrs lists the attributes whose values are navigation targets.
+var linkAttrs = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"form":   "action",
+	"iframe": "src",
+	"frame":  "src",
+}
+
+// blockTags end a line of visible text.
+var blockTags = map[string]bool{
+	"br": true, "p": true, "div": true, "tr": true, "li": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+func parseHTML(src string) htmlParts {
+	var parts htmlParts
+	var text strings.Builder
+	skip := 0 // Depth inside <script>/<style>
+
+	z := html.NewTokenizer(strings.NewReader(src))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			parts.Text = strings.TrimSpace(text.String())
+			return parts
+		case html.TextToken:
+			if skip == 0 {
+				text.Write(z.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if tag == "script" || tag == "style" {
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+			}
+			if blockTags[tag] {
+				text.WriteByte('\n')
+			}
+			if tt == html.EndTagToken {
+				continue
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attr := string(key)
+				switch {
+				case linkAttrs[tag] == attr:
+					parts.Links = append(parts.Links, strings.TrimSpace(string(val)))
+				case tag == "img" && attr == "src":
+					if img := decodeDataURI(string(val)); img != nil {
+						parts.Images = append(parts.Images, img)
+					}
+				}
+			}
+		}
+	}
+}
+
+// decodeDataURI returns the bytes of a base64 data: URI with an image type.
+func decodeDataURI(uri string) []byte {
+	if !strings.HasPrefix(strings.ToLower(uri), "data:image/") {
+		return nil
+	}
+	meta, data, ok := strings.Cut(uri[len("data:"):], ",")
+	if !ok {
+		return nil
+	}
+	if !strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		raw, err := url.PathUnescape(data)
+		if err != nil {
+			return nil
+		}
+		return []byte(raw)
+	}
+	img, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+	if err != nil {
+		return nil
+	}
+	return img
+}
@@ -0,0 +1,132 @@
+// Package message parses SMS text and RFC 5322 email into the URLs, phone
+// numbers, sender details and authentication results the message analysis
+// pipeline scores.
+package message
+
+import (
+	"fmt"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+// Message kinds.
+const (
+	KindSMS   = "sms"
+	KindEmail = "email"
+)
+
+// Limits on what a single message may contribute.
+const (
+	MaxSMSLength = 64 << 10 // Concatenated SMS/MMS text
+	MaxURLs      = 50       // Distinct URLs kept per message
+)
+
+// Message is a parsed SMS or email.
+type Message struct {
+	Kind           string
+	Sender         *models.MessageSender
+	Subject        string
+	Text           string // Readable body; HTML parts are reduced to their text
+	URLs           []*models.MessageURL
+	PhoneNumbers   []string
+	Attachments    []*models.MessageAttachment
+	Authentication *models.EmailAuthentication // Email only
+	Raw            []byte                      // Email only: the message as received, for DKIM
+}
+
+// ParseSMS parses an SMS body. sender is the originating number or alphanumeric
+// sender ID and may be empty.
+func ParseSMS(text, sender string) (*Message, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("SMS text is empty")
+	}
+	if len(text) > MaxSMSLength {
+		return nil, fmt.Errorf("SMS text exceeds %d bytes", MaxSMSLength)
+	}
+
+	m := &Message{Kind: KindSMS, Text: text}
+	if sender = strings.TrimSpace(sender); sender != "" {
+		m.Sender = &models.MessageSender{Address: sender}
+		if strings.Contains(sender, "@") {
+			m.Sender.Domain = domainOf(sender)
+		}
+	}
+	m.addText(text, "text")
+	return m, nil
+}
+
+// addText collects the URLs and phone numbers written in text.
+func (m *Message) addText(text, source string) {
+	for _, u := range ExtractURLs(text) {
+		m.addURL(u.URL, source, u.Defanged)
+	}
+	m.addPhones(ExtractPhoneNumbers(text)...)
+}
+
+// addLink records a link target from HTML. tel: and sms: links are phone
+// numbers; mailto:, cid:, javascript: and fragment links are not analyzed.
+func (m *Message) addLink(target, source string) {
+	lower := strings.ToLower(target)
+	switch {
+	case strings.HasPrefix(lower, "tel:"), strings.HasPrefix(lower, "sms:"):
+		number, _, _ := strings.Cut(target[4:], "?")
+		m.addPhones(normalizePhone(strings.TrimPrefix(number, "/")))
+	case strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "https://"), strings.HasPrefix(lower, "www."):
+		if u, ok := normalizeURL(target); ok {
+			m.addURL(u, source, false)
+		}
+	default:
+		// Hrefs that are written defanged or without a scheme are still links.
+		for _, u := range ExtractURLs(target) {
+			m.addURL(u.URL, source, u.Defanged)
+		}
+	}
+}
+
+func (m *Message) addURL(u, source string, defanged bool) {
+	for _, existing := range m.URLs {
+		if existing.URL == u {
+			existing.Defanged = existing.Defanged || defanged
+			return
+		}
+	}
+	if len(m.URLs) < MaxURLs {
+		m.URLs = append(m.URLs, &models.MessageURL{URL: u, Source: source, Defanged: defanged})
+	}
+}
+
+func (m *Message) addPhones(numbers ...string) {
+	for _, n := range numbers {
+		if len(strings.TrimPrefix(n, "+")) < 7 {
+			continue
+		}
+		if m.Sender != nil && normalizePhone(m.Sender.Address) == n {
+			continue
+		}
+		dup := false
+		for _, existing := range m.PhoneNumbers {
+			dup = dup || existing == n
+		}
+		if !dup {
+			m.PhoneNumbers = append(m.PhoneNumbers, n)
+		}
+	}
+}
+
+// addQRCodes records the decoded payloads of an image and what they point to.
+func (m *Message) addQRCodes(att *models.MessageAttachment, image []byte) {
+	payloads, err := DecodeQRCodes(image)
+	if err != nil || len(payloads) == 0 {
+		return
+	}
+	att.QRCodes = payloads
+	name := att.Filename
+	if name == "" {
+		name = "inline image"
+	}
+	for _, p := range payloads {
+		m.addText(p, "qr:"+name)
+	}
+}
@@ -0,0 +1,266 @@
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		want     []string
+		defanged bool
+	}{
+		{"scheme", "Pay now: https://Pay-Secure.example.com/login?id=1.", []string{"https://pay-secure.example.com/login?id=1"}, false},
+		{"www", "visit www.example.org, thanks", []string{"https://www.example.org"}, false},
+		{"bare host with path", "USPS: package held, see usps-redelivery.top/track now", []string{"https://usps-redelivery.top/track"}, false},
+		{"defanged", "IOC hxxps://evil[.]example[.]com/a and bad(dot)example(dot)net", []string{"https://evil.example.com/a", "https://bad.example.net"}, true},
+		{"parenthesized", "(see https://example.com/wiki/Foo_(bar)) ok", []string{"https://example.com/wiki/Foo_(bar)"}, false},
+		{"email is not a url", "write to support@example.com or help@bank.example.co.uk", nil, false},
+		{"file names are not hosts", "open setup.exe and invoice.pdf", nil, false},
+		{"duplicates", "https://a.example.com https://a.example.com/", []string{"https://a.example.com", "https://a.example.com/"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := ExtractURLs(tt.text)
+			var got []string
+			for _, u := range found {
+				got = append(got, u.URL)
+				if u.Defanged != tt.defanged {
+					t.Errorf("%s: defanged = %v, want %v", u.URL, u.Defanged, tt.defanged)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractURLs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractPhoneNumbers(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Call +1 (555) 010-4477 or 555.010.9999 today", []string{"+15550104477", "5550109999"}},
+		{"Fraud team: +44 20 7946 0958", []string{"+442079460958"}},
+		{"Your code is 493021, order 88213377", nil},
+		{"Delivered 2024-03-15 from 192.168.10.20", nil},
+		{"see https://example.com/track/5550104477 for details", nil},
+	}
+	for _, tt := range tests {
+		if got := ExtractPhoneNumbers(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExtractPhoneNumbers(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseSMS(t *testing.T) {
+	msg, err := ParseSMS("URGENT: your account is locked. Verify at bit.ly/3xYz or call +1 555 010 4477", "+15550001111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Kind != KindSMS || msg.Sender.Address != "+15550001111" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if len(msg.URLs) != 1 || msg.URLs[0].URL != "https://bit.ly/3xYz" || msg.URLs[0].Source != "text" {
+		t.Errorf("unexpected URLs: %+v", msg.URLs)
+	}
+	if !reflect.DeepEqual(msg.PhoneNumbers, []string{"+15550104477"}) {
+		t.Errorf("unexpected phone numbers: %v", msg.PhoneNumbers)
+	}
+
+	if _, err := ParseSMS("   ", ""); err == nil {
+		t.Error("expected an error for an empty SMS")
+	}
+}
+
+func TestParseAuthentication(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		from    string
+		want    string // spf/dkim/dmarc spfAligned dkimAligned
+	}{
+		{
+			name:    "aligned pass",
+			headers: "Authentication-Results: mx.example.net; spf=pass (sender ok) smtp.mailfrom=bounce@mail.bank.example; dkim=pass header.d=bank.example header.s=s1; dmarc=pass header.from=bank.example\r\n",
+			from:    "bank.example",
+			want:    "pass/pass/pass true true",
+		},
+		{
+			name:    "passing but unaligned",
+			headers: "Authentication-Results: mx.example.net; spf=pass smtp.mailfrom=x@sendgrid.example; dkim=pass header.i=@sendgrid.example\r\n",
+			from:    "bank.example",
+			want:    "pass/pass/fail false false",
+		},
+		{
+			name:    "prefers aligned signature",
+			headers: "Authentication-Results: mx.example.net; dkim=pass header.d=esp.example; dkim=pass header.d=shop.example; spf=softfail smtp.mailfrom=esp.example\r\n",
+			from:    "news.shop.example",
+			want:    "softfail/pass/pass false true",
+		},
+		{
+			name:    "topmost header wins",
+			headers: "Authentication-Results: mx.example.net; spf=fail smtp.mailfrom=evil.example; dmarc=fail\r\nAuthentication-Results: forged.example; spf=pass; dkim=pass; dmarc=pass\r\n",
+			from:    "bank.example",
+			want:    "fail/none/fail false false",
+		},
+		{
+			name:    "received-spf only",
+			headers: "Received-SPF: Pass (mx.example.net: domain of a@bank.example designates 192.0.2.1 as permitted sender) client-ip=192.0.2.1; envelope-from=\"a@bank.example\";\r\n",
+			from:    "bank.example",
+			want:    "pass/none/pass true false",
+		},
+		{
+			name: "no results",
+			from: "bank.example",
+			want: "none/none/none false false",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := mail.ReadMessage(strings.NewReader(tt.headers + "Subject: x\r\n\r\nbody"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := parseAuthentication(msg.Header, tt.from, "")
+			got := a.SPF + "/" + a.DKIM + "/" + a.DMARC + " " + boolString(a.SPFAligned) + " " + boolString(a.DKIMAligned)
+			if got != tt.want {
+				t.Errorf("got %s, want %s (%+v)", got, tt.want, a)
+			}
+		})
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// qrPNG renders payload as a QR code PNG.
+func qrPNG(t *testing.T, payload string) []byte {
+	t.Helper()
+	matrix, err := qrcode.NewQRCodeWriter().Encode(payload, gozxing.BarcodeFormat_QR_CODE, 200, 200, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, matrix); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeQRCodes(t *testing.T) {
+	got, err := DecodeQRCodes(qrPNG(t, "https://quish.example/pay"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"https://quish.example/pay"}) {
+		t.Errorf("DecodeQRCodes() = %v", got)
+	}
+	if _, err := DecodeQRCodes([]byte("not an image")); err == nil {
+		t.Error("expected an error for non-image data")
+	}
+}
+
+func TestParseEmail(t *testing.T) {
+	qr := base64.StdEncoding.EncodeToString(qrPNG(t, "https://mfa-reset.example/enroll"))
+	raw := strings.Join([]string{
+		"Authentication-Results: mx.example.net; spf=pass smtp.mailfrom=bulk@mailer.example; dkim=none; dmarc=fail header.from=bank.example",
+		`From: "=?UTF-8?B?QmFuayBTZWN1cml0eQ==?=" <alerts@bank.example>`,
+		"Reply-To: recover@freemail.example",
+		"Return-Path: <bulk@mailer.example>",
+		"Subject: =?UTF-8?Q?Action_required=3A_verify_at_hxxps://bank-verify[.]example?=",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="outer"`,
+		"",
+		"--outer",
+		`Content-Type: multipart/alternative; boundary="alt"`,
+		"",
+		"--alt",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"Your account is suspended. Call +1 555 010 4477 or scan the attached code=",
+		".",
+		"--alt",
+		"Content-Type: text/html; charset=iso-8859-1",
+		"",
+		`<html><body><p>Caf` + "\xe9" + ` notice</p><a href="https://login.bank-verify.example/?u=1">Verify</a>` +
+			`<a href="tel:+15550104477">call</a><a href="mailto:x@bank.example">mail</a><script>var u="https://ignored.example"</script></body></html>`,
+		"--alt--",
+		"--outer",
+		`Content-Type: image/png; name="scan.png"`,
+		"Content-Disposition: attachment; filename=\"scan.png\"",
+		"Content-Transfer-Encoding: base64",
+		"",
+		qr,
+		"--outer--",
+		"",
+	}, "\r\n")
+
+	msg, err := ParseEmail(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Kind != KindEmail || msg.Sender.Address != "alerts@bank.example" || msg.Sender.DisplayName != "Bank Security" ||
+		msg.Sender.Domain != "bank.example" || msg.Sender.ReplyTo != "recover@freemail.example" || msg.Sender.ReturnPath != "bulk@mailer.example" {
+		t.Errorf("unexpected sender: %+v", msg.Sender)
+	}
+	if msg.Subject != "Action required: verify at hxxps://bank-verify[.]example" {
+		t.Errorf("unexpected subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "Your account is suspended.") {
+		t.Errorf("plain text body missing: %q", msg.Text)
+	}
+
+	sources := make(map[string]string)
+	for _, u := range msg.URLs {
+		sources[u.URL] = u.Source
+	}
+	want := map[string]string{
+		"https://bank-verify.example":            "subject",
+		"https://login.bank-verify.example/?u=1": "html",
+		"https://mfa-reset.example/enroll":       "qr:scan.png",
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("URL sources = %v, want %v", sources, want)
+	}
+	if !reflect.DeepEqual(msg.PhoneNumbers, []string{"+15550104477"}) {
+		t.Errorf("unexpected phone numbers: %v", msg.PhoneNumbers)
+	}
+
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "scan.png" || len(msg.Attachments[0].SHA256) != 64 ||
+		!reflect.DeepEqual(msg.Attachments[0].QRCodes, []string{"https://mfa-reset.example/enroll"}) {
+		t.Errorf("unexpected attachments: %+v", msg.Attachments)
+	}
+
+	if string(msg.Raw) != raw {
+		t.Error("raw message not kept for DKIM verification")
+	}
+
+	a := msg.Authentication
+	if a.DMARC != "fail" || a.SPF != "pass" || a.SPFAligned || a.SPFDomain != "mailer.example" {
+		t.Errorf("unexpected authentication: %+v", a)
+	}
+}
+
+func TestParseEmail_Rejects(t *testing.T) {
+	if _, err := ParseEmail(strings.NewReader("just some text without headers")); err == nil {
+		t.Error("expected an error for text without headers")
+	}
+}
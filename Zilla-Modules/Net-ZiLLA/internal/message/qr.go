@@ -0,0 +1,56 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Decoders for image attachments
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/makiuchi-d/gozxing"
+	multiqr "github.com/makiuchi-d/gozxing/multi/qrcode"
+)
+
+// maxQRPixels bounds the images handed to the QR decoder; phishing QR codes are
+// small and a huge image is more likely a decompression bomb than a lure.
+const maxQRPixels = 4096 * 4096
+
+// DecodeQRCodes returns the payloads of every QR code in a PNG, JPEG or GIF
+// image. An image without QR codes yields no payloads and no error.
+func DecodeQRCodes(data []byte) ([]string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxQRPixels {
+		return nil, fmt.Errorf("image too large for QR decoding (%dx%d)", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to binarize image: %w", err)
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+	results, err := multiqr.NewQRCodeMultiReader().DecodeMultiple(bmp, hints)
+	if err != nil {
+		var notFound gozxing.NotFoundException
+		if errors.As(err, &notFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to decode QR code: %w", err)
+	}
+
+	var payloads []string
+	for _, r := range results {
+		if text := r.GetText(); text != "" {
+			payloads = append(payloads, text)
+		}
+	}
+	return payloads, nil
+}
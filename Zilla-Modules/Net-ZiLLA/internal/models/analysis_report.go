@@ -13,15 +13,27 @@ type AdvancedReport struct {
 	Reputation         *ReputationSummary `json:"reputation"`
 	BehavioralAnalysis *BehaviorAnalysis  `json:"behavioral_analysis"`
 	RiskAssessment     *RiskAssessment    `json:"risk_assessment"`
+	Sandbox            *SandboxResult     `json:"sandbox,omitempty"`
 
 	// Legacy Support Integration
 	BasicAnalysis *ThreatAnalysis `json:"basic_analysis"`
 
 	Findings   []string               `json:"findings"`
+	Insights   []Insight              `json:"insights,omitempty"` // Correlation rules that matched
 	InstanceID string                 `json:"instance_id"`
 	Metadata   map[string]interface{} `json:"metadata"`
 }
 
+// Insight is a pattern found by correlating several sections of a report,
+// produced by a correlation rule.
+type Insight struct {
+	RuleID     string   `json:"rule_id"`
+	Title      string   `json:"title"`
+	Severity   string   `json:"severity"`             // LOW, MEDIUM, HIGH or CRITICAL
+	Techniques []string `json:"techniques,omitempty"` // MITRE ATT&CK technique IDs
+	Score      int      `json:"score"`                // Points added to the 0-100 risk score
+}
+
 // AnalysisReport is a simplified report used for correlation and quick results
 type AnalysisReport struct {
 	RiskScore   int      `json:"risk_score"`
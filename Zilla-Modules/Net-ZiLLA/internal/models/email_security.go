@@ -0,0 +1,77 @@
+package models
+
+// EmailSecurity is the email authentication posture a domain publishes in DNS:
+// its SPF, DMARC, BIMI and MTA-STS records and what they leave open.
+type EmailSecurity struct {
+	Domain    string        `json:"domain"`
+	SPF       *SPFPolicy    `json:"spf,omitempty"`
+	DMARC     *DMARCPolicy  `json:"dmarc,omitempty"`
+	BIMI      *BIMIRecord   `json:"bimi,omitempty"`
+	MTASTS    *MTASTSPolicy `json:"mta_sts,omitempty"`
+	Findings  []string      `json:"findings,omitempty"`
+	RiskScore int           `json:"risk_score"` // 0-100, higher means easier to spoof
+}
+
+// SPFPolicy is a domain's SPF record with include and redirect chains expanded.
+type SPFPolicy struct {
+	Record      string   `json:"record"`
+	All         string   `json:"all,omitempty"` // Qualifier of the effective "all": "-", "~", "?" or "+"
+	Includes    []string `json:"includes,omitempty"`
+	Redirect    string   `json:"redirect,omitempty"`
+	DNSLookups  int      `json:"dns_lookups"`  // Terms that cost a lookup; RFC 7208 allows 10
+	VoidLookups int      `json:"void_lookups"` // Lookups that returned nothing; RFC 7208 allows 2
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// DMARCPolicy is a parsed DMARC record.
+type DMARCPolicy struct {
+	Record          string   `json:"record"`
+	Domain          string   `json:"domain"` // Where the record was found
+	Policy          string   `json:"policy"` // none, quarantine or reject
+	SubdomainPolicy string   `json:"subdomain_policy,omitempty"`
+	Percent         int      `json:"percent"`
+	ADKIM           string   `json:"adkim"` // "r" (relaxed) or "s" (strict)
+	ASPF            string   `json:"aspf"`
+	RUA             []string `json:"rua,omitempty"`
+	RUF             []string `json:"ruf,omitempty"`
+	Inherited       bool     `json:"inherited,omitempty"` // Taken from the organizational domain
+}
+
+// BIMIRecord is a domain's default BIMI assertion.
+type BIMIRecord struct {
+	Record    string `json:"record"`
+	Location  string `json:"location,omitempty"`  // Logo (l=)
+	Authority string `json:"authority,omitempty"` // Mark certificate (a=)
+}
+
+// MTASTSPolicy is a domain's MTA-STS TXT record and the policy file it points to.
+type MTASTSPolicy struct {
+	Record string   `json:"record"`
+	ID     string   `json:"id,omitempty"`
+	Mode   string   `json:"mode,omitempty"` // enforce, testing or none
+	MX     []string `json:"mx,omitempty"`
+	MaxAge int      `json:"max_age,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// EmailVerification is the result of checking a raw email against DNS ourselves
+// rather than trusting the receiving server's Authentication-Results.
+type EmailVerification struct {
+	ClientIP    string              `json:"client_ip,omitempty"` // Connecting IP taken from Received
+	SPF         string              `json:"spf"`
+	SPFDomain   string              `json:"spf_domain,omitempty"`
+	SPFAligned  bool                `json:"spf_aligned"`
+	DKIM        []*DKIMVerification `json:"dkim,omitempty"`
+	DKIMAligned bool                `json:"dkim_aligned"`
+	DMARC       string              `json:"dmarc"`
+	Policy      *DMARCPolicy        `json:"policy,omitempty"`
+}
+
+// DKIMVerification is the outcome for one DKIM-Signature header.
+type DKIMVerification struct {
+	Domain    string `json:"domain"`
+	Selector  string `json:"selector"`
+	Algorithm string `json:"algorithm"`
+	Result    string `json:"result"` // pass, fail, permerror or temperror
+	Error     string `json:"error,omitempty"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// FileAnalysis is the result of statically analyzing a submitted file and every
+// member unpacked from it. Nothing in the file is executed or fetched.
+type FileAnalysis struct {
+	ReportID  string            `json:"report_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	FileName  string            `json:"file_name"`
+	Size      int64             `json:"size"`
+	Type      string            `json:"type"` // Detected from magic bytes, not the extension
+	Hashes    map[string]string `json:"hashes"`
+	Members   []*FileMember     `json:"members"` // The file itself first, then everything unpacked from it
+	URLs      []string          `json:"urls,omitempty"`
+	Macros    []VBAMacro        `json:"macros,omitempty"`
+	RiskScore int               `json:"risk_score"`
+	RiskLevel string            `json:"risk_level"`
+	Findings  []string          `json:"findings,omitempty"`
+	Warnings  []string          `json:"warnings,omitempty"` // Limits hit and members that could not be read
+	Duration  time.Duration     `json:"duration"`
+}
+
+// FileMember is one file inside a submission. Path joins container levels with
+// "!", e.g. "invoice.zip!invoice.docm!word/vbaProject.bin".
+type FileMember struct {
+	Path        string            `json:"path"`
+	Type        string            `json:"type"`
+	Size        int64             `json:"size"`
+	Depth       int               `json:"depth"`
+	Hashes      map[string]string `json:"hashes"`
+	Behavior    *BehaviorAnalysis `json:"behavior,omitempty"`
+	YaraMatches []YaraMatch       `json:"yara_matches,omitempty"`
+	URLs        []string          `json:"urls,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// VBAMacro is the source of one VBA module extracted from an Office document.
+type VBAMacro struct {
+	Member     string   `json:"member"` // FileMember the project was found in
+	Module     string   `json:"module"`
+	Code       string   `json:"code"`
+	AutoExec   []string `json:"auto_exec,omitempty"`  // Entry points Office runs on open or close
+	Suspicious []string `json:"suspicious,omitempty"` // Keywords for shell, download and obfuscation
+}
+
+// YaraMatch is a YARA rule that matched a file.
+type YaraMatch struct {
+	Rule    string            `json:"rule"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	Strings []string          `json:"strings,omitempty"` // Identifiers of the strings that matched
+}
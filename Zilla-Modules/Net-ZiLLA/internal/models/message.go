@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"net-zilla/internal/shared_models"
+)
+
+// MessageAnalysis is the combined verdict for an SMS or email: every URL it
+// carries is analyzed on its own and folded together with the message text,
+// sender and authentication signals.
+type MessageAnalysis struct {
+	ReportID  string    `json:"report_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Kind      string    `json:"kind"` // "sms" or "email"
+
+	Sender       *MessageSender       `json:"sender,omitempty"`
+	Subject      string               `json:"subject,omitempty"`
+	PhoneNumbers []string             `json:"phone_numbers,omitempty"`
+	URLs         []*MessageURL        `json:"urls"`
+	Attachments  []*MessageAttachment `json:"attachments,omitempty"`
+
+	Authentication *EmailAuthentication            `json:"authentication,omitempty"`
+	SenderPolicy   *EmailSecurity                  `json:"sender_policy,omitempty"` // What the From domain publishes
+	TextAnalysis   *shared_models.AIAnalysisResult `json:"text_analysis,omitempty"`
+	RiskAssessment *RiskAssessment                 `json:"risk_assessment"`
+
+	Verdict  string   `json:"verdict"` // "malicious", "suspicious" or "clean"
+	Findings []string `json:"findings"`
+}
+
+// MessageSender describes who a message claims to be from.
+type MessageSender struct {
+	Address     string `json:"address,omitempty"` // Email address or SMS sender (number or alphanumeric ID)
+	DisplayName string `json:"display_name,omitempty"`
+	Domain      string `json:"domain,omitempty"`
+	ReplyTo     string `json:"reply_to,omitempty"`
+	ReturnPath  string `json:"return_path,omitempty"`
+}
+
+// MessageURL is one URL found in a message together with its analysis.
+type MessageURL struct {
+	URL      string          `json:"url"`
+	Source   string          `json:"source"`             // "text", "html", "subject" or "qr:<attachment>"
+	Defanged bool            `json:"defanged,omitempty"` // Written as hxxp://, example[.]com, ...
+	Report   *AdvancedReport `json:"report,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// MessageAttachment summarizes an email attachment or inline image.
+type MessageAttachment struct {
+	Filename    string   `json:"filename,omitempty"`
+	ContentType string   `json:"content_type"`
+	Size        int      `json:"size"`
+	SHA256      string   `json:"sha256"`
+	QRCodes     []string `json:"qr_codes,omitempty"` // Decoded QR payloads
+}
+
+// EmailAuthentication holds the SPF, DKIM and DMARC results stamped on an email
+// by the receiving server, and whether the authenticated domains align with From.
+type EmailAuthentication struct {
+	Source      string `json:"source"` // Header the results were read from, or "none"
+	FromDomain  string `json:"from_domain,omitempty"`
+	SPF         string `json:"spf"` // pass, fail, softfail, neutral, none, temperror, permerror
+	SPFDomain   string `json:"spf_domain,omitempty"`
+	SPFAligned  bool   `json:"spf_aligned"`
+	DKIM        string `json:"dkim"`
+	DKIMDomain  string `json:"dkim_domain,omitempty"`
+	DKIMAligned bool   `json:"dkim_aligned"`
+	DMARC       string `json:"dmarc"` // As reported, otherwise derived from aligned SPF/DKIM
+
+	Verification *EmailVerification `json:"verification,omitempty"` // Our own SPF/DKIM/DMARC check
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// SandboxResult is what a sandboxed browser session observed, built from the HAR
+// and manifest the sandbox image writes. Large artifacts stay on disk and are
+// referenced as blobs.
+type SandboxResult struct {
+	ContainerID   string            `json:"container_id,omitempty"`
+	Target        string            `json:"target"`
+	FinalURL      string            `json:"final_url,omitempty"`
+	Title         string            `json:"title,omitempty"`
+	StartedAt     time.Time         `json:"started_at,omitempty"`
+	FinishedAt    time.Time         `json:"finished_at,omitempty"`
+	TimedOut      bool              `json:"timed_out,omitempty"`
+	ArtifactDir   string            `json:"artifact_dir"`
+	Requests      []SandboxRequest  `json:"requests,omitempty"`
+	Hosts         []string          `json:"hosts,omitempty"` // Unique hosts contacted, in first-seen order
+	IPs           []string          `json:"ips,omitempty"`
+	Downloads     []SandboxDownload `json:"downloads,omitempty"`
+	DOM           *SandboxBlob      `json:"dom,omitempty"`
+	Screenshots   []SandboxBlob     `json:"screenshots,omitempty"`
+	ConsoleErrors []string          `json:"console_errors,omitempty"`
+	IOCs          *IOCRegistry      `json:"iocs,omitempty"`
+	Warnings      []string          `json:"warnings,omitempty"` // Artifacts that were missing or unreadable
+}
+
+// SandboxRequest is one network request from the HAR.
+type SandboxRequest struct {
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	Host        string    `json:"host"`
+	IP          string    `json:"ip,omitempty"`
+	Status      int       `json:"status"`
+	MimeType    string    `json:"mime_type,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	RedirectURL string    `json:"redirect_url,omitempty"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+}
+
+// SandboxDownload is a file the page made the browser download.
+type SandboxDownload struct {
+	Name     string            `json:"name"`
+	Path     string            `json:"path"`
+	URL      string            `json:"url,omitempty"` // Where it was downloaded from, when the manifest says
+	MimeType string            `json:"mime_type,omitempty"`
+	Size     int64             `json:"size"`
+	Hashes   map[string]string `json:"hashes,omitempty"` // MD5, SHA1 and SHA256
+	Analysis *BehaviorAnalysis `json:"analysis,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// SandboxBlob is an artifact kept on disk, such as a screenshot or the final DOM.
+type SandboxBlob struct {
+	Path     string `json:"path"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime_type,omitempty"`
+}
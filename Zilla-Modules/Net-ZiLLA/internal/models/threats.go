@@ -70,8 +70,24 @@ type RedirectDetail struct {
 	IPAddress  string            `json:"ip_address"` // IP address of the server responding to this hop
 	HopNumber  int               `json:"hop_number"`
 	Warnings   []string          `json:"warnings,omitempty"` // Warnings specific to this redirect step
+
+	Mechanism RedirectMechanism `json:"mechanism,omitempty"`  // How this hop sent the client to Location; empty on the final hop
+	BodyBytes int64             `json:"body_bytes,omitempty"` // Response body bytes read while looking for client-side redirects
+	// SimHash of the body read, for spotting pages built from the same kit
+	ContentSimhash string `json:"content_simhash,omitempty"`
 }
 
+// RedirectMechanism identifies how a page moved the client to the next URL.
+type RedirectMechanism string
+
+const (
+	RedirectHTTP          RedirectMechanism = "http"           // 3xx status with a Location header
+	RedirectRefreshHeader RedirectMechanism = "refresh-header" // Refresh response header
+	RedirectMetaRefresh   RedirectMechanism = "meta-refresh"   // <meta http-equiv="refresh">
+	RedirectJavaScript    RedirectMechanism = "javascript"     // location assignment in an inline script
+	RedirectFrame         RedirectMechanism = "iframe"         // Page is a shell around a single frame
+)
+
 // CookieInfo details about an HTTP cookie.
 type CookieInfo struct {
 	Name     string    `json:"name"`
@@ -102,6 +118,8 @@ type DNSAnalysis struct {
 	TTLSummary        string    `json:"ttl_summary,omitempty"`
 	Warnings          []string  `json:"warnings,omitempty"`
 	LastUpdated       time.Time `json:"last_updated"`
+
+	EmailSecurity *EmailSecurity `json:"email_security,omitempty"`
 }
 
 // WhoisAnalysis results of a WHOIS lookup.
@@ -128,6 +146,7 @@ type TLSAnalysis struct {
 	ExpiresInDays      int           `json:"expires_in_days"`
 	Issuer             string        `json:"issuer"`
 	Subject            string        `json:"subject"`
+	Fingerprint        string        `json:"fingerprint,omitempty"` // Hex SHA-256 of the leaf certificate
 	SupportedProtocols []string      `json:"supported_protocols"`
 	CipherSuites       []string      `json:"cipher_suites,omitempty"`
 	EncryptionGrade    string        `json:"encryption_grade"`
@@ -137,12 +156,37 @@ type TLSAnalysis struct {
 	Warnings           []string      `json:"warnings,omitempty"`
 	CompressionEnabled string        `json:"compression_enabled,omitempty"` // From HTTP headers
 	ServerType         string        `json:"server_type,omitempty"`         // From HTTP headers
+
+	// Active server fingerprinting (JARM/JA3S)
+	JARM               string             `json:"jarm,omitempty"`
+	JA3S               string             `json:"ja3s,omitempty"`
+	JA3SString         string             `json:"ja3s_string,omitempty"` // Raw "version,cipher,extensions" input to the JA3S hash
+	ProbeResponses     []TLSProbeResponse `json:"probe_responses,omitempty"`
+	FingerprintMatches []FingerprintMatch `json:"fingerprint_matches,omitempty"`
+}
+
+// TLSProbeResponse records how a server answered a single fingerprinting ClientHello.
+type TLSProbeResponse struct {
+	Probe      string   `json:"probe"`
+	Responded  bool     `json:"responded"`
+	Version    string   `json:"version,omitempty"` // Hex, e.g. "0303"
+	Cipher     string   `json:"cipher,omitempty"`  // Hex, e.g. "c02f"
+	Extensions []string `json:"extensions,omitempty"`
+	ALPN       string   `json:"alpn,omitempty"`
+}
+
+// FingerprintMatch is a hit against the local list of known-bad server fingerprints.
+type FingerprintMatch struct {
+	Type        string `json:"type"` // "jarm" or "ja3s"
+	Fingerprint string `json:"fingerprint"`
+	Label       string `json:"label"`
 }
 
 // GeoAnalysis results of an IP geolocation lookup.
 type GeoAnalysis struct {
 	IP           string   `json:"ip"`
 	Country      string   `json:"country"`
+	CountryCode  string   `json:"country_code,omitempty"` // ISO 3166-1 alpha-2
 	City         string   `json:"city,omitempty"`
 	Region       string   `json:"region,omitempty"`
 	ISP          string   `json:"isp"`
@@ -162,23 +206,30 @@ type GeoAnalysis struct {
 // NetworkAnalysis results of network path analysis (e.g., traceroute).
 type NetworkAnalysis struct {
 	Target         string        `json:"target"`
+	Mode           string        `json:"mode,omitempty"` // icmp, udp, tcp or connect (degraded, no raw sockets)
+	Reached        bool          `json:"reached"`
 	HopCount       int           `json:"hop_count"`
 	Hops           []HopDetail   `json:"hops"`
 	AverageLatency time.Duration `json:"average_latency"`
 	MaxLatency     time.Duration `json:"max_latency"`
 	MinLatency     time.Duration `json:"min_latency"`
-	PacketLoss     float64       `json:"packet_loss"`
+	PacketLoss     float64       `json:"packet_loss"`        // Percentage of probes to the final hop that went unanswered
 	GeoPath        string        `json:"geo_path,omitempty"` // E.g., "US -> EU -> AS"
 	Warnings       []string      `json:"warnings,omitempty"`
 }
 
 // HopDetail for individual hops in a traceroute.
 type HopDetail struct {
-	Number  int           `json:"number"`
-	IP      string        `json:"ip"`
-	Host    string        `json:"host,omitempty"`
-	Latency time.Duration `json:"latency"`
-	Country string        `json:"country,omitempty"` // Geolocation for the hop
+	Number  int             `json:"number"`
+	IP      string          `json:"ip"` // Empty when no probe for this TTL was answered
+	Host    string          `json:"host,omitempty"`
+	ASN     string          `json:"asn,omitempty"`
+	Latency time.Duration   `json:"latency"` // Mean of RTTs
+	Jitter  time.Duration   `json:"jitter,omitempty"`
+	RTTs    []time.Duration `json:"rtts,omitempty"`
+	Probes  int             `json:"probes"`
+	Loss    float64         `json:"loss"`              // Percentage of probes lost at this hop
+	Country string          `json:"country,omitempty"` // Geolocation for the hop
 }
 
 // Report represents a saved analysis report.
@@ -0,0 +1,98 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ASNInfo describes the autonomous system announcing an IP address.
+type ASNInfo struct {
+	ASN     string // "AS15169 GOOGLE - Google LLC, US", same shape as GeoAnalysis.ASN
+	Prefix  string
+	Country string
+}
+
+// ASNResolver maps IP addresses to their origin AS.
+type ASNResolver interface {
+	LookupASN(ctx context.Context, ip string) (*ASNInfo, error)
+}
+
+// CymruASNResolver resolves ASNs through the Team Cymru IP-to-ASN DNS service.
+type CymruASNResolver struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+
+	mu    sync.RWMutex
+	cache map[string]*ASNInfo
+}
+
+// NewCymruASNResolver creates a resolver backed by origin.asn.cymru.com.
+func NewCymruASNResolver() *CymruASNResolver {
+	return &CymruASNResolver{
+		resolver: net.DefaultResolver,
+		timeout:  3 * time.Second,
+		cache:    make(map[string]*ASNInfo),
+	}
+}
+
+// LookupASN returns the origin AS for an IPv4 address.
+func (r *CymruASNResolver) LookupASN(ctx context.Context, ip string) (*ASNInfo, error) {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return nil, fmt.Errorf("ASN lookup supports IPv4 only: %s", ip)
+	}
+
+	r.mu.RLock()
+	cached, ok := r.cache[ip]
+	r.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", parsed[3], parsed[2], parsed[1], parsed[0])
+	records, err := r.resolver.LookupTXT(ctx, query)
+	if err != nil || len(records) == 0 {
+		return nil, fmt.Errorf("no ASN record for %s: %w", ip, err)
+	}
+
+	// "15169 | 8.8.8.0/24 | US | arin | 2014-03-14"
+	fields := splitCymruRecord(records[0])
+	if len(fields) < 3 || len(strings.Fields(fields[0])) == 0 {
+		return nil, fmt.Errorf("malformed ASN record for %s: %q", ip, records[0])
+	}
+	// Prefixes announced by several origins list them all; keep the first.
+	asn := strings.Fields(fields[0])[0]
+	info := &ASNInfo{
+		ASN:     "AS" + asn,
+		Prefix:  fields[1],
+		Country: fields[2],
+	}
+
+	// "15169 | US | arin | 2000-03-30 | GOOGLE - Google LLC, US"
+	if names, err := r.resolver.LookupTXT(ctx, "AS"+asn+".asn.cymru.com"); err == nil && len(names) > 0 {
+		if f := splitCymruRecord(names[0]); len(f) >= 5 && f[4] != "" {
+			info.ASN += " " + f[4]
+		}
+	}
+
+	r.mu.Lock()
+	r.cache[ip] = info
+	r.mu.Unlock()
+
+	return info, nil
+}
+
+func splitCymruRecord(record string) []string {
+	parts := strings.Split(record, "|")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
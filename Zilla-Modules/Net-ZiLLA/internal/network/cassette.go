@@ -0,0 +1,311 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CassetteMode selects whether network clients record their responses, replay
+// them from a cassette, or talk to the network directly.
+type CassetteMode string
+
+const (
+	CassetteOff    CassetteMode = ""
+	CassetteRecord CassetteMode = "record"
+	CassetteReplay CassetteMode = "replay"
+)
+
+// ParseCassetteMode parses a config or flag value ("", "off", "record", "replay").
+func ParseCassetteMode(s string) (CassetteMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off", "none":
+		return CassetteOff, nil
+	case "record":
+		return CassetteRecord, nil
+	case "replay":
+		return CassetteReplay, nil
+	}
+	return CassetteOff, fmt.Errorf("unknown cassette mode %q (want record, replay or off)", s)
+}
+
+// ErrCassetteMiss is returned in replay mode for a request the cassette has no
+// (remaining) response for. Replay never falls through to the network.
+var ErrCassetteMiss = errors.New("no recorded response in cassette")
+
+// cassetteFormat tags cassette files so unrelated JSON is rejected early.
+const cassetteFormat = "netzilla-cassette/1"
+
+// cassetteMaxBody caps the HTTP body bytes stored per response.
+const cassetteMaxBody = 8 << 20
+
+// Interaction is one recorded exchange. Kind names the protocol ("dns", "whois",
+// "tls", "jarm" or "http") and Key identifies the request within it; repeated
+// requests with the same key are replayed in recording order.
+type Interaction struct {
+	Kind     string `json:"kind"`
+	Key      string `json:"key"`
+	Response []byte `json:"response,omitempty"` // Raw bytes as received from the server
+	Error    string `json:"error,omitempty"`
+	Timeout  bool   `json:"timeout,omitempty"` // The error was a network timeout
+}
+
+// Cassette captures every network response of a run so the run can be replayed
+// byte-for-byte without network access. A nil *Cassette is valid and means
+// "use the network"; clients therefore call its methods unconditionally.
+type Cassette struct {
+	mode       CassetteMode
+	path       string
+	recordedAt time.Time
+
+	mu           sync.Mutex
+	interactions []Interaction
+	cursor       map[string]int // Next interaction index to replay per kind+key
+}
+
+type cassetteFile struct {
+	Format       string        `json:"format"`
+	RecordedAt   time.Time     `json:"recorded_at"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// NewCassette creates an empty in-memory cassette. A replay cassette built this way
+// is filled with Record, which is how tests assemble fixtures by hand.
+func NewCassette(mode CassetteMode) *Cassette {
+	return &Cassette{
+		mode:       mode,
+		recordedAt: time.Now().UTC(),
+		cursor:     make(map[string]int),
+	}
+}
+
+// OpenCassette prepares a cassette at path: recording starts empty and is written
+// by Close, replay loads the file.
+func OpenCassette(path string, mode CassetteMode) (*Cassette, error) {
+	if path == "" {
+		return nil, fmt.Errorf("cassette path is required in %s mode", mode)
+	}
+	switch mode {
+	case CassetteRecord:
+		c := NewCassette(CassetteRecord)
+		c.path = path
+		return c, nil
+	case CassetteReplay:
+		return LoadCassette(path)
+	}
+	return nil, fmt.Errorf("cassette mode %q cannot be opened", mode)
+}
+
+// LoadCassette reads a recorded cassette for replay.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	if file.Format != cassetteFormat {
+		return nil, fmt.Errorf("cassette %s has unsupported format %q", path, file.Format)
+	}
+	c := NewCassette(CassetteReplay)
+	c.path = path
+	c.recordedAt = file.RecordedAt
+	c.interactions = file.Interactions
+	return c, nil
+}
+
+// Mode reports the cassette mode; a nil cassette is off.
+func (c *Cassette) Mode() CassetteMode {
+	if c == nil {
+		return CassetteOff
+	}
+	return c.mode
+}
+
+// Now is the clock analyzers use for certificate expiry and domain age. Replay
+// pins it to the recording time so old runs re-score exactly as they were seen.
+func (c *Cassette) Now() time.Time {
+	if c == nil || c.mode != CassetteReplay {
+		return time.Now()
+	}
+	return c.recordedAt
+}
+
+// SetRecordedAt overrides the recording time, e.g. for hand-built fixtures.
+func (c *Cassette) SetRecordedAt(t time.Time) {
+	c.recordedAt = t
+}
+
+// Interactions returns a copy of the recorded interactions.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// Record appends an interaction.
+func (c *Cassette) Record(kind, key string, response []byte, err error) {
+	in := Interaction{Kind: kind, Key: key, Response: response}
+	if err != nil {
+		in.Error = err.Error()
+		var ne net.Error
+		in.Timeout = errors.As(err, &ne) && ne.Timeout()
+	}
+	c.mu.Lock()
+	c.interactions = append(c.interactions, in)
+	c.mu.Unlock()
+}
+
+// Save writes the cassette to path as indented JSON.
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	file := cassetteFile{Format: cassetteFormat, RecordedAt: c.recordedAt, Interactions: c.interactions}
+	data, err := json.MarshalIndent(file, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette %s: %w", path, err)
+	}
+	return nil
+}
+
+// Close writes a recording cassette opened with OpenCassette. Other cassettes
+// need no cleanup.
+func (c *Cassette) Close() error {
+	if c == nil || c.mode != CassetteRecord || c.path == "" {
+		return nil
+	}
+	return c.Save(c.path)
+}
+
+// exchange runs live directly when the cassette is off, records its result in
+// record mode and serves the next recorded result for kind+key in replay mode.
+// Both the response and the error are kept, since some probes return partial
+// data together with an error.
+func (c *Cassette) exchange(kind, key string, live func() ([]byte, error)) ([]byte, error) {
+	switch c.Mode() {
+	case CassetteRecord:
+		resp, err := live()
+		c.Record(kind, key, resp, err)
+		return resp, err
+	case CassetteReplay:
+		return c.replay(kind, key)
+	}
+	return live()
+}
+
+func (c *Cassette) replay(kind, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matches []int
+	for i, in := range c.interactions {
+		if in.Kind == kind && in.Key == key {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrCassetteMiss, kind, key)
+	}
+
+	// Requests repeated more often than recorded keep getting the last response.
+	id := kind + " " + key
+	next := min(c.cursor[id], len(matches)-1)
+	c.cursor[id] = next + 1
+	in := c.interactions[matches[next]]
+	if in.Error != "" {
+		return in.Response, &cassetteError{msg: in.Error, timeout: in.Timeout}
+	}
+	return in.Response, nil
+}
+
+// cassetteError reproduces a recorded failure, including whether it was a timeout.
+type cassetteError struct {
+	msg     string
+	timeout bool
+}
+
+func (e *cassetteError) Error() string   { return e.msg }
+func (e *cassetteError) Timeout() bool   { return e.timeout }
+func (e *cassetteError) Temporary() bool { return e.timeout }
+
+// Transport wraps next so HTTP exchanges go through the cassette. Responses are
+// stored in wire format; in record mode the caller receives the parsed recording
+// too, so a recorded run and its replay see identical responses.
+func (c *Cassette) Transport(next http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &cassetteTransport{cassette: c, next: next}
+}
+
+type cassetteTransport struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	data, err := t.cassette.exchange("http", req.Method+" "+req.URL.String(), func() ([]byte, error) {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, cassetteMaxBody))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if req.Method != http.MethodHead {
+			resp.ContentLength = int64(len(body))
+			resp.TransferEncoding = nil
+		}
+		if resp.TLS != nil {
+			resp.Header = resp.Header.Clone()
+			resp.Header.Set(cassetteTLSHeader, fmt.Sprintf("%04x %04x", resp.TLS.Version, resp.TLS.CipherSuite))
+		}
+		return httputil.DumpResponse(resp, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt cassette response for %s %s: %w", req.Method, req.URL, err)
+	}
+	if v := resp.Header.Get(cassetteTLSHeader); v != "" {
+		var version, cipher uint16
+		if _, err := fmt.Sscanf(v, "%04x %04x", &version, &cipher); err == nil {
+			resp.TLS = &tls.ConnectionState{Version: version, CipherSuite: cipher, HandshakeComplete: true}
+		}
+		resp.Header.Del(cassetteTLSHeader)
+	}
+	return resp, nil
+}
+
+// cassetteTLSHeader carries the negotiated TLS version and cipher suite of a
+// recorded response, since the wire dump has no connection state. It is removed
+// again on replay.
+const cassetteTLSHeader = "X-Netzilla-Cassette-Tls"
@@ -0,0 +1,163 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Resolver returns a pure-Go resolver whose queries go through the cassette as raw
+// DNS messages. Queries are sent to upstream, or to the system's name server when
+// upstream is empty. A nil cassette returns nil so callers keep their own resolver.
+func (c *Cassette) Resolver(upstream string) *net.Resolver {
+	if c == nil {
+		return nil
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			server := upstream
+			if server == "" {
+				server = address
+			}
+			return &dnsCassetteConn{exchange: func(query []byte) ([]byte, error) {
+				return c.exchangeDNS(ctx, server, query)
+			}}, nil
+		},
+	}
+}
+
+// exchangeDNS keys the query by its question, since message IDs are random, and
+// stamps the query's ID onto the recorded answer.
+func (c *Cassette) exchangeDNS(ctx context.Context, server string, query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS query: %w", err)
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS question: %w", err)
+	}
+	key := strings.ToLower(q.Name.String()) + " " + strings.TrimPrefix(q.Type.String(), "Type")
+
+	resp, err := c.exchange("dns", key, func() ([]byte, error) {
+		return dnsRoundTrip(ctx, server, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 12 {
+		return nil, fmt.Errorf("recorded DNS answer for %s is too short", key)
+	}
+	answer := append([]byte(nil), resp...)
+	binary.BigEndian.PutUint16(answer, header.ID)
+	return answer, nil
+}
+
+// dnsRoundTrip sends one query over UDP, retrying over TCP when the answer is truncated.
+func dnsRoundTrip(ctx context.Context, server string, query []byte) ([]byte, error) {
+	deadline := time.Now().Add(5 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(query); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+	if n < 12 || buf[2]&0x02 == 0 { // TC bit clear
+		return buf[:n], nil
+	}
+
+	conn, err = d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(buf[:2]))
+	if _, err := io.ReadFull(conn, buf[:length]); err != nil {
+		return nil, err
+	}
+	return buf[:length], nil
+}
+
+// dnsCassetteConn is the connection handed to the Go resolver. It is not a
+// net.PacketConn, so the resolver frames messages with a two-byte length prefix
+// as it would over TCP; each complete query is answered through exchange.
+type dnsCassetteConn struct {
+	exchange func(query []byte) ([]byte, error)
+	pending  []byte
+	answers  bytes.Buffer
+	err      error
+}
+
+func (c *dnsCassetteConn) Write(b []byte) (int, error) {
+	c.pending = append(c.pending, b...)
+	for len(c.pending) >= 2 {
+		n := int(binary.BigEndian.Uint16(c.pending))
+		if len(c.pending) < 2+n {
+			break
+		}
+		query := c.pending[2 : 2+n]
+		c.pending = c.pending[2+n:]
+
+		answer, err := c.exchange(query)
+		if err != nil {
+			c.err = err
+			continue
+		}
+		c.answers.Write(binary.BigEndian.AppendUint16(nil, uint16(len(answer))))
+		c.answers.Write(answer)
+	}
+	return len(b), nil
+}
+
+func (c *dnsCassetteConn) Read(b []byte) (int, error) {
+	if c.answers.Len() == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		return 0, io.EOF
+	}
+	return c.answers.Read(b)
+}
+
+func (c *dnsCassetteConn) Close() error                     { return nil }
+func (c *dnsCassetteConn) LocalAddr() net.Addr              { return cassetteAddr{} }
+func (c *dnsCassetteConn) RemoteAddr() net.Addr             { return cassetteAddr{} }
+func (c *dnsCassetteConn) SetDeadline(time.Time) error      { return nil }
+func (c *dnsCassetteConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *dnsCassetteConn) SetWriteDeadline(time.Time) error { return nil }
+
+type cassetteAddr struct{}
+
+func (cassetteAddr) Network() string { return "cassette" }
+func (cassetteAddr) String() string  { return "cassette" }
@@ -0,0 +1,313 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"net-zilla/pkg/logger"
+)
+
+func TestParseCassetteMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    CassetteMode
+		wantErr bool
+	}{
+		{"", CassetteOff, false},
+		{"off", CassetteOff, false},
+		{"Record", CassetteRecord, false},
+		{" replay ", CassetteReplay, false},
+		{"rewind", CassetteOff, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCassetteMode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseCassetteMode(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// recordAndReload saves a recording to disk and loads it back for replay.
+func recordAndReload(t *testing.T, c *Cassette) *Cassette {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "run.cassette")
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := OpenCassette(path, CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return replay
+}
+
+func TestCassette_HTTPRecordReplay(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=63072000")
+		w.Header().Set("X-Frame-Options", "DENY")
+		fmt.Fprint(w, "<html>recorded</html>")
+	}))
+	target := server.URL + "/page"
+
+	l := logger.NewLogger()
+	recording := NewCassette(CassetteRecord)
+	client := NewHTTPClient(l)
+	client.transport = server.Client().Transport
+	client.SetCassette(recording)
+	live, err := client.SafeGetRequest(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liveHeaders, liveScore, err := client.CheckSecurityHeaders(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	replay := recordAndReload(t, recording)
+	client = NewHTTPClient(l)
+	client.SetCassette(replay)
+	got, err := client.SafeGetRequest(context.Background(), target)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if got.StatusCode != live.StatusCode || got.ContentLength != live.ContentLength || !reflect.DeepEqual(got.Headers, live.Headers) ||
+		got.TLS == nil || got.TLS.Version != live.TLS.Version || got.TLS.CipherSuite != live.TLS.CipherSuite {
+		t.Errorf("replayed response differs:\n got %+v\nwant %+v", got, live)
+	}
+	headers, score, err := client.CheckSecurityHeaders(context.Background(), target)
+	if err != nil || score != liveScore || !reflect.DeepEqual(headers, liveHeaders) {
+		t.Errorf("replayed security headers = %v, %d, %v; want %v, %d", headers, score, err, liveHeaders, liveScore)
+	}
+
+	_, err = client.SafeGetRequest(context.Background(), server.URL+"/never-recorded")
+	if !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("expected ErrCassetteMiss for an unrecorded request, got %v", err)
+	}
+}
+
+func TestCassette_RedirectReplay(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/landing", http.StatusFound)
+	})
+	mux.HandleFunc("/landing", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><meta http-equiv="refresh" content="0;url=/final"></head></html>`)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>done</html>")
+	})
+	server := httptest.NewServer(mux)
+
+	l := logger.NewLogger()
+	recording := NewCassette(CassetteRecord)
+	tracer := NewRedirectTracer(l)
+	tracer.SetCassette(recording)
+	liveChain, liveScore, err := tracer.TraceRedirects(context.Background(), server.URL+"/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	tracer = NewRedirectTracer(l)
+	tracer.SetCassette(recordAndReload(t, recording))
+	chain, score, err := tracer.TraceRedirects(context.Background(), server.URL+"/start")
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if score != liveScore || len(chain) != len(liveChain) || len(chain) != 3 {
+		t.Fatalf("replayed %d hops scoring %d, recorded %d hops scoring %d", len(chain), score, len(liveChain), liveScore)
+	}
+	for i := range chain {
+		chain[i].Duration, liveChain[i].Duration = 0, 0
+		if !reflect.DeepEqual(chain[i], liveChain[i]) {
+			t.Errorf("hop %d differs:\n got %+v\nwant %+v", i, chain[i], liveChain[i])
+		}
+	}
+}
+
+// serveDNS answers A and MX queries for cassette.test and NXDOMAIN for everything else.
+func serveDNS(t *testing.T) (addr string, stop func()) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			header, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true})
+			b.EnableCompression()
+			known := strings.EqualFold(q.Name.String(), "cassette.test.")
+			if !known {
+				b = dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RCode: dnsmessage.RCodeNameError})
+			}
+			b.StartQuestions()
+			b.Question(q)
+			b.StartAnswers()
+			rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+			if known && q.Type == dnsmessage.TypeA {
+				b.AResource(rh, dnsmessage.AResource{A: [4]byte{192, 0, 2, 7}})
+			}
+			if known && q.Type == dnsmessage.TypeMX {
+				b.MXResource(rh, dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.cassette.test.")})
+			}
+			msg, err := b.Finish()
+			if err == nil {
+				pc.WriteTo(msg, from)
+			}
+		}
+	}()
+	return pc.LocalAddr().String(), func() { pc.Close() }
+}
+
+func TestCassette_DNSRecordReplay(t *testing.T) {
+	addr, stop := serveDNS(t)
+	l := logger.NewLogger()
+
+	recording := NewCassette(CassetteRecord)
+	client := NewDNSClient(l)
+	client.server = addr
+	client.SetCassette(recording)
+	live, err := client.Lookup(context.Background(), "cassette.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	if !reflect.DeepEqual(live.ARecords, []string{"192.0.2.7"}) || len(live.MXRecords) != 1 {
+		t.Fatalf("unexpected live lookup: A=%v MX=%v", live.ARecords, live.MXRecords)
+	}
+	kinds := 0
+	for _, in := range recording.Interactions() {
+		if in.Kind == "dns" {
+			kinds++
+		}
+	}
+	if kinds == 0 {
+		t.Fatal("no DNS messages recorded")
+	}
+
+	client = NewDNSClient(l)
+	client.server = addr
+	client.SetCassette(recordAndReload(t, recording))
+	got, err := client.Lookup(context.Background(), "cassette.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, live) {
+		t.Errorf("replayed lookup differs:\n got %+v\nwant %+v", got, live)
+	}
+}
+
+func TestCassette_WhoisReplayPinsClock(t *testing.T) {
+	cassette := NewCassette(CassetteReplay)
+	cassette.SetRecordedAt(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	raw := "Domain Name: EXAMPLE.COM\r\nRegistrar Name: Example Registrar\r\nCreation Date: 2020-01-01T00:00:00Z\r\nName Server: A.IANA-SERVERS.NET\r\n"
+	cassette.Record("whois", "whois.verisign-grs.com example.com", []byte(raw), nil)
+
+	client := NewWhoisClient(logger.NewLogger())
+	client.SetCassette(cassette)
+	info, err := client.Lookup(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RawWhois != raw || info.Registrar != "Example Registrar" {
+		t.Errorf("unexpected WHOIS data: %+v", info)
+	}
+	if info.DomainAgeDays != 1461 || info.DomainAge != "4 years" {
+		t.Errorf("domain age = %d days (%s), want 1461 days at the recording time", info.DomainAgeDays, info.DomainAge)
+	}
+
+	if _, err := client.Lookup(context.Background(), "example.org"); !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("expected ErrCassetteMiss, got %v", err)
+	}
+}
+
+func TestCassette_TLSRecordReplay(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	port, _ := strconv.Atoi(server.URL[strings.LastIndex(server.URL, ":")+1:])
+	l := logger.NewLogger()
+
+	recording := NewCassette(CassetteRecord)
+	sa := NewSSLAnalyzer(l)
+	sa.SetPort(port)
+	sa.SetCassette(recording)
+	state, err := sa.handshake(context.Background(), "127.0.0.1", &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, liveErr := sa.Analyze(context.Background(), "127.0.0.1")
+	server.Close()
+
+	replay := recordAndReload(t, recording)
+	sa = NewSSLAnalyzer(l)
+	sa.SetPort(port)
+	sa.SetCassette(replay)
+	got, err := sa.handshake(context.Background(), "127.0.0.1", &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if got.Version != state.Version || got.CipherSuite != state.CipherSuite ||
+		len(got.PeerCertificates) == 0 || !got.PeerCertificates[0].Equal(server.Certificate()) {
+		t.Errorf("replayed handshake differs: version %x cipher %x certs %d", got.Version, got.CipherSuite, len(got.PeerCertificates))
+	}
+
+	// The self-signed certificate fails verification; the replay must report it the same way.
+	analysis, err := sa.Analyze(context.Background(), "127.0.0.1")
+	if fmt.Sprint(err) != fmt.Sprint(liveErr) {
+		t.Errorf("replayed error %v, recorded %v", err, liveErr)
+	}
+	if analysis.CertificateValid || analysis.Issuer == "" || len(analysis.Warnings) == 0 {
+		t.Errorf("expected the unverified certificate to be described as invalid, got %+v", analysis)
+	}
+	// Replay pins the clock to the recording time, which trails the live run slightly.
+	if d := live.ExpiresIn - analysis.ExpiresIn; d < -time.Minute || d > time.Minute {
+		t.Errorf("replayed expiry %v, recorded %v", analysis.ExpiresIn, live.ExpiresIn)
+	}
+	live.ExpiresIn = analysis.ExpiresIn
+	if !reflect.DeepEqual(analysis, live) {
+		t.Errorf("replayed analysis differs:\n got %+v\nwant %+v", analysis, live)
+	}
+	if analysis.JARM == "" || analysis.JARM == emptyJARM {
+		t.Errorf("expected a JARM fingerprint from the recorded probes, got %q", analysis.JARM)
+	}
+}
+
+func TestLoadCassette_RejectsUnknownFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "other.cassette")
+	if err := os.WriteFile(path, []byte(`{"format":"something-else"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCassette(path); err == nil || !strings.Contains(err.Error(), "unsupported format") {
+		t.Errorf("expected unsupported format error, got %v", err)
+	}
+}
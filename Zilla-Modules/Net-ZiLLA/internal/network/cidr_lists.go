@@ -0,0 +1,174 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// CIDRCategory classifies the infrastructure an address range belongs to.
+type CIDRCategory string
+
+const (
+	CIDRCategoryTorExit CIDRCategory = "tor_exit"
+	CIDRCategoryVPN     CIDRCategory = "vpn"
+	CIDRCategoryHosting CIDRCategory = "hosting"
+)
+
+// Hosting types reported in GeoAnalysis.HostingType.
+const (
+	HostingTypeHosting     = "Hosting Provider"
+	HostingTypeVPN         = "VPN/Proxy"
+	HostingTypeTorExit     = "Tor Exit Node"
+	HostingTypeResidential = "ISP/Residential"
+)
+
+// cidrCategoryPriority decides which category wins when ranges overlap: a Tor exit
+// hosted at a cloud provider is reported as a Tor exit.
+var cidrCategoryPriority = []CIDRCategory{CIDRCategoryTorExit, CIDRCategoryVPN, CIDRCategoryHosting}
+
+// CIDRMatch describes the list entry an address fell into.
+type CIDRMatch struct {
+	Category CIDRCategory
+	Prefix   string
+	Label    string
+}
+
+type cidrEntry struct {
+	prefix netip.Prefix
+	label  string
+}
+
+// CIDRLists holds the hosting, VPN and Tor exit ranges used to derive
+// GeoAnalysis.HostingType and IsProxy without an online lookup.
+type CIDRLists struct {
+	hosts    map[CIDRCategory]map[netip.Addr]string // Single addresses (/32, /128), e.g. Tor exits
+	prefixes map[CIDRCategory][]cidrEntry
+}
+
+// NewCIDRLists creates an empty set of lists.
+func NewCIDRLists() *CIDRLists {
+	return &CIDRLists{
+		hosts:    make(map[CIDRCategory]map[netip.Addr]string),
+		prefixes: make(map[CIDRCategory][]cidrEntry),
+	}
+}
+
+// LoadFile adds the ranges in path to category. Each line holds a CIDR or bare IP,
+// optionally followed by a label; '#' starts a comment.
+func (l *CIDRLists) LoadFile(category CIDRCategory, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s list %s: %w", category, path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := l.Add(category, fields[0], strings.Join(fields[1:], " ")); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s list %s: %w", category, path, err)
+	}
+	return nil
+}
+
+// Add inserts a CIDR or single address into category.
+func (l *CIDRLists) Add(category CIDRCategory, cidr, label string) error {
+	if !strings.Contains(cidr, "/") {
+		addr, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %w", cidr, err)
+		}
+		l.addHost(category, addr.Unmap(), label)
+		return nil
+	}
+
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+	}
+	prefix = prefix.Masked()
+	if prefix.IsSingleIP() {
+		l.addHost(category, prefix.Addr(), label)
+		return nil
+	}
+	l.prefixes[category] = append(l.prefixes[category], cidrEntry{prefix: prefix, label: label})
+	return nil
+}
+
+func (l *CIDRLists) addHost(category CIDRCategory, addr netip.Addr, label string) {
+	if l.hosts[category] == nil {
+		l.hosts[category] = make(map[netip.Addr]string)
+	}
+	l.hosts[category][addr] = label
+}
+
+// Lookup returns the highest-priority list entry containing ip.
+func (l *CIDRLists) Lookup(ip net.IP) (CIDRMatch, bool) {
+	if l == nil {
+		return CIDRMatch{}, false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return CIDRMatch{}, false
+	}
+	addr = addr.Unmap()
+
+	for _, category := range cidrCategoryPriority {
+		if label, ok := l.hosts[category][addr]; ok {
+			return CIDRMatch{Category: category, Prefix: netip.PrefixFrom(addr, addr.BitLen()).String(), Label: label}, true
+		}
+		for _, entry := range l.prefixes[category] {
+			if entry.prefix.Contains(addr) {
+				return CIDRMatch{Category: category, Prefix: entry.prefix.String(), Label: entry.label}, true
+			}
+		}
+	}
+	return CIDRMatch{}, false
+}
+
+// Len returns the number of entries across all categories.
+func (l *CIDRLists) Len() int {
+	n := 0
+	for _, hosts := range l.hosts {
+		n += len(hosts)
+	}
+	for _, prefixes := range l.prefixes {
+		n += len(prefixes)
+	}
+	return n
+}
+
+// HostingType maps a list category to the GeoAnalysis.HostingType wording.
+func (c CIDRCategory) HostingType() string {
+	switch c {
+	case CIDRCategoryTorExit:
+		return HostingTypeTorExit
+	case CIDRCategoryVPN:
+		return HostingTypeVPN
+	case CIDRCategoryHosting:
+		return HostingTypeHosting
+	}
+	return ""
+}
+
+// IsAnonymizing reports whether the category hides the real client (VPN or Tor).
+func (c CIDRCategory) IsAnonymizing() bool {
+	return c == CIDRCategoryTorExit || c == CIDRCategoryVPN
+}
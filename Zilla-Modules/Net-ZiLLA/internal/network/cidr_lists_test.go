@@ -0,0 +1,85 @@
+package network
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCIDRLists_Lookup(t *testing.T) {
+	lists := NewCIDRLists()
+	mustAdd := func(category CIDRCategory, cidr, label string) {
+		if err := lists.Add(category, cidr, label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustAdd(CIDRCategoryHosting, "198.51.100.0/24", "ExampleCloud")
+	mustAdd(CIDRCategoryTorExit, "198.51.100.7", "exit relay")
+	mustAdd(CIDRCategoryVPN, "203.0.113.0/25", "ExampleVPN")
+	mustAdd(CIDRCategoryHosting, "2001:db8::/32", "v6 cloud")
+
+	tests := []struct {
+		ip       string
+		category CIDRCategory
+		found    bool
+	}{
+		{"198.51.100.1", CIDRCategoryHosting, true},
+		{"198.51.100.7", CIDRCategoryTorExit, true}, // Tor wins over the hosting range
+		{"203.0.113.5", CIDRCategoryVPN, true},
+		{"203.0.113.200", "", false},
+		{"2001:db8::1", CIDRCategoryHosting, true},
+		{"8.8.8.8", "", false},
+	}
+
+	for _, tt := range tests {
+		match, ok := lists.Lookup(net.ParseIP(tt.ip))
+		if ok != tt.found || match.Category != tt.category {
+			t.Errorf("Lookup(%s) = %q, %v; want %q, %v", tt.ip, match.Category, ok, tt.category, tt.found)
+		}
+	}
+
+	if err := lists.Add(CIDRCategoryVPN, "not-a-cidr/8", ""); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestCIDRLists_LoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tor.list")
+	content := "# Tor exits\n\n185.220.101.1\n185.220.100.0/24  Example operator # trailing comment\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	lists := NewCIDRLists()
+	if err := lists.LoadFile(CIDRCategoryTorExit, path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if lists.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", lists.Len())
+	}
+
+	match, ok := lists.Lookup(net.ParseIP("185.220.100.9"))
+	if !ok || match.Label != "Example operator" || match.Prefix != "185.220.100.0/24" {
+		t.Errorf("unexpected match %+v", match)
+	}
+	if match.Category.HostingType() != HostingTypeTorExit || !match.Category.IsAnonymizing() {
+		t.Errorf("unexpected category mapping for %q", match.Category)
+	}
+}
+
+func TestBundledCIDRLists(t *testing.T) {
+	lists := NewCIDRLists()
+	for category, name := range map[CIDRCategory]string{
+		CIDRCategoryHosting: "hosting.list",
+		CIDRCategoryVPN:     "vpn.list",
+		CIDRCategoryTorExit: "tor_exits.list",
+	} {
+		if err := lists.LoadFile(category, filepath.Join("..", "..", "data", "cidr", name)); err != nil {
+			t.Fatalf("bundled list %s: %v", name, err)
+		}
+	}
+	if lists.Len() == 0 {
+		t.Fatal("bundled lists are empty")
+	}
+}
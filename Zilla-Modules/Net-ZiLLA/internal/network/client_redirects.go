@@ -0,0 +1,170 @@
+package network
+
+import (
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+// clientRedirect is a redirect a browser would perform after loading a page.
+type clientRedirect struct {
+	Target    string // Target as written in the page, before resolution
+	Mechanism models.RedirectMechanism
+	Delay     int // Seconds before a refresh fires
+}
+
+// A page whose visible text is shorter than this is treated as a shell around its frame.
+const maxFrameShellText = 200
+
+var (
+	metaTagPattern   = regexp.MustCompile(`(?is)<meta\b[^>]*>`)
+	baseTagPattern   = regexp.MustCompile(`(?is)<base\b[^>]*>`)
+	frameTagPattern  = regexp.MustCompile(`(?is)<i?frame\b[^>]*>`)
+	scriptPattern    = regexp.MustCompile(`(?is)<script\b[^>]*>(.*?)</script>`)
+	handlerPattern   = regexp.MustCompile(`(?is)\bon(?:load|pageshow)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	attrPattern      = regexp.MustCompile(`(?s)([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	invisiblePattern = regexp.MustCompile(`(?is)<(script|style|noscript)\b[^>]*>.*?</(?:script|style|noscript)>`)
+	tagPattern       = regexp.MustCompile(`(?s)<[^>]*>`)
+
+	// Assignments to location / location.href and calls to location.replace/assign with
+	// a string literal. Computed targets cannot be resolved without executing the script.
+	jsRedirectPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?:\b(?:window|self|top|parent|document)\s*\.\s*|[^\w.$]|^)location(?:\s*\.\s*href)?\s*=\s*(?:"([^"\n]+)"|'([^'\n]+)')`),
+		regexp.MustCompile(`(?:\b(?:window|self|top|parent|document)\s*\.\s*|[^\w.$]|^)location\s*\.\s*(?:replace|assign)\s*\(\s*(?:"([^"\n]+)"|'([^'\n]+)')\s*\)`),
+	}
+	jsUnescaper = strings.NewReplacer(`\/`, `/`, `\x2f`, `/`, `\x2F`, `/`, `\u002f`, `/`, `\u002F`, `/`)
+)
+
+// findClientRedirect looks for a client-side redirect in a response without executing
+// any script. A Refresh header wins over the page, then meta refresh, script location
+// changes and finally a lone frame, roughly the order in which a browser acts on them.
+func findClientRedirect(header http.Header, body []byte) *clientRedirect {
+	if refresh := header.Get("Refresh"); refresh != "" {
+		if target, delay, ok := parseRefresh(refresh); ok {
+			return &clientRedirect{Target: target, Mechanism: models.RedirectRefreshHeader, Delay: delay}
+		}
+	}
+	if len(body) == 0 || !isHTML(header.Get("Content-Type"), body) {
+		return nil
+	}
+	page := string(body)
+
+	for _, tag := range metaTagPattern.FindAllString(page, -1) {
+		attrs := tagAttributes(tag)
+		if !strings.EqualFold(strings.TrimSpace(attrs["http-equiv"]), "refresh") {
+			continue
+		}
+		if target, delay, ok := parseRefresh(attrs["content"]); ok {
+			return &clientRedirect{Target: target, Mechanism: models.RedirectMetaRefresh, Delay: delay}
+		}
+	}
+
+	var scripts []string
+	for _, m := range scriptPattern.FindAllStringSubmatch(page, -1) {
+		scripts = append(scripts, m[1])
+	}
+	for _, m := range handlerPattern.FindAllStringSubmatch(page, -1) {
+		scripts = append(scripts, html.UnescapeString(m[1]+m[2]))
+	}
+	for _, script := range scripts {
+		for _, pattern := range jsRedirectPatterns {
+			if m := pattern.FindStringSubmatch(script); m != nil {
+				target := strings.TrimSpace(jsUnescaper.Replace(m[1] + m[2]))
+				if target != "" {
+					return &clientRedirect{Target: target, Mechanism: models.RedirectJavaScript}
+				}
+			}
+		}
+	}
+
+	frames := frameTagPattern.FindAllString(page, -1)
+	if len(frames) == 1 {
+		src := strings.TrimSpace(tagAttributes(frames[0])["src"])
+		lower := strings.ToLower(src)
+		if src != "" && lower != "about:blank" && !strings.HasPrefix(lower, "javascript:") && len(visibleText(page)) < maxFrameShellText {
+			return &clientRedirect{Target: src, Mechanism: models.RedirectFrame}
+		}
+	}
+	return nil
+}
+
+// documentBase returns the URL relative references in the page resolve against,
+// honouring a <base href> element.
+func documentBase(pageURL string, body []byte) string {
+	tag := baseTagPattern.FindString(string(body))
+	if tag == "" {
+		return pageURL
+	}
+	href := strings.TrimSpace(tagAttributes(tag)["href"])
+	if href == "" {
+		return pageURL
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return pageURL
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return pageURL
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// parseRefresh parses a Refresh header or meta content value such as
+// `0; url='https://example.com/'`. A refresh without a URL reloads the page and is
+// not reported.
+func parseRefresh(value string) (string, int, bool) {
+	value = strings.TrimSpace(html.UnescapeString(value))
+	delayStr, rest := value, ""
+	if i := strings.IndexAny(value, ";,"); i >= 0 {
+		delayStr, rest = value[:i], value[i+1:]
+	}
+	delay, _ := strconv.Atoi(strings.TrimSpace(strings.SplitN(delayStr, ".", 2)[0]))
+
+	rest = strings.TrimSpace(rest)
+	if len(rest) >= 3 && strings.EqualFold(rest[:3], "url") {
+		if after := strings.TrimSpace(rest[3:]); strings.HasPrefix(after, "=") {
+			rest = strings.TrimSpace(after[1:])
+		}
+	}
+	rest = strings.Trim(rest, `"'`)
+	if rest == "" {
+		return "", 0, false
+	}
+	return rest, delay, true
+}
+
+// tagAttributes returns the lower-cased attribute names and unescaped values of a tag.
+func tagAttributes(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrPattern.FindAllStringSubmatch(tag, -1) {
+		name := strings.ToLower(m[1])
+		if _, seen := attrs[name]; !seen {
+			attrs[name] = html.UnescapeString(m[2] + m[3] + m[4])
+		}
+	}
+	return attrs
+}
+
+func visibleText(page string) string {
+	text := invisiblePattern.ReplaceAllString(page, " ")
+	text = tagPattern.ReplaceAllString(text, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+}
+
+func isHTML(contentType string, body []byte) bool {
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
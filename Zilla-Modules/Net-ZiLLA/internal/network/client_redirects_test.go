@@ -0,0 +1,135 @@
+package network
+
+import (
+	"net/http"
+	"testing"
+
+	"net-zilla/internal/models"
+)
+
+func TestFindClientRedirect(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		body      string
+		wantURL   string
+		wantMech  models.RedirectMechanism
+		wantDelay int
+	}{
+		{
+			name:     "meta refresh",
+			header:   html,
+			body:     `<html><head><meta http-equiv="refresh" content="0; url=/next"></head></html>`,
+			wantURL:  "/next",
+			wantMech: models.RedirectMetaRefresh,
+		},
+		{
+			name:      "meta refresh attribute order, quotes and entities",
+			header:    html,
+			body:      `<META content='3;URL="https://a.example/?x=1&amp;y=2"' HTTP-EQUIV=Refresh>`,
+			wantURL:   "https://a.example/?x=1&y=2",
+			wantMech:  models.RedirectMetaRefresh,
+			wantDelay: 3,
+		},
+		{
+			name:     "refresh header",
+			header:   http.Header{"Refresh": {"5;url=https://b.example/"}},
+			wantURL:  "https://b.example/",
+			wantMech: models.RedirectRefreshHeader, wantDelay: 5,
+		},
+		{
+			name:     "window.location.href",
+			header:   html,
+			body:     `<script>var a = 1; window.location.href = "https:\/\/c.example\/login";</script>`,
+			wantURL:  "https://c.example/login",
+			wantMech: models.RedirectJavaScript,
+		},
+		{
+			name:     "location.replace",
+			header:   html,
+			body:     `<script type="text/javascript">setTimeout(function(){ location.replace('step2.html') }, 10)</script>`,
+			wantURL:  "step2.html",
+			wantMech: models.RedirectJavaScript,
+		},
+		{
+			name:     "body onload",
+			header:   html,
+			body:     `<body onload="top.location='https://d.example/'"></body>`,
+			wantURL:  "https://d.example/",
+			wantMech: models.RedirectJavaScript,
+		},
+		{
+			name:     "single iframe shell",
+			header:   html,
+			body:     `<html><body style="margin:0"><iframe src="https://e.example/app" width="100%" height="100%"></iframe></body></html>`,
+			wantURL:  "https://e.example/app",
+			wantMech: models.RedirectFrame,
+		},
+		{
+			name:   "iframe inside real content",
+			header: html,
+			body: `<html><body><h1>Our company</h1><p>` + longText + `</p>
+				<iframe src="https://maps.example/embed"></iframe></body></html>`,
+		},
+		{
+			name:   "two frames",
+			header: html,
+			body:   `<frameset><frame src="/a"><frame src="/b"></frameset>`,
+		},
+		{
+			name:   "location comparison is not a redirect",
+			header: html,
+			body:   `<script>if (location.href == "https://x.example/") { go() } var my_location = "y";</script>`,
+		},
+		{
+			name:   "refresh without url reloads",
+			header: html,
+			body:   `<meta http-equiv="refresh" content="30">`,
+		},
+		{
+			name:   "non-html body ignored",
+			header: http.Header{"Content-Type": {"application/json"}},
+			body:   `{"html": "<meta http-equiv=refresh content='0;url=/x'>"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findClientRedirect(tt.header, []byte(tt.body))
+			if tt.wantMech == "" {
+				if got != nil {
+					t.Errorf("expected no redirect, got %+v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("expected a redirect")
+			}
+			if got.Target != tt.wantURL || got.Mechanism != tt.wantMech || got.Delay != tt.wantDelay {
+				t.Errorf("got %+v, want %s %s delay %d", got, tt.wantMech, tt.wantURL, tt.wantDelay)
+			}
+		})
+	}
+}
+
+const longText = `Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor
+incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation
+ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit.`
+
+func TestDocumentBase(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`<p>no base</p>`, "https://a.example/dir/page.html"},
+		{`<base href="/other/">`, "https://a.example/other/"},
+		{`<base target="_blank" href="https://cdn.example/x/">`, "https://cdn.example/x/"},
+		{`<base target="_blank">`, "https://a.example/dir/page.html"},
+	}
+	for _, tt := range tests {
+		if got := documentBase("https://a.example/dir/page.html", []byte(tt.body)); got != tt.want {
+			t.Errorf("documentBase(%q) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package network
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+// Pages with fewer tokens than this carry too little content to compare,
+// e.g. bare redirect stubs.
+const minSimhashTokens = 16
+
+// simhashShingle is how many consecutive tokens are hashed together.
+const simhashShingle = 2
+
+var simhashTokenPattern = regexp.MustCompile(`[a-z0-9]+`)
+
+// ContentSimhash returns the 64-bit SimHash of a page as 16 hex digits, or ""
+// when the page is too short to fingerprint. Tag and attribute names count
+// as tokens alongside the text, so pages built from the same phishing kit
+// land a few bits apart even when their wording is localized or the
+// embedded target differs. Compare hashes by Hamming distance.
+func ContentSimhash(body []byte) string {
+	tokens := simhashTokenPattern.FindAllString(strings.ToLower(string(body)), -1)
+	if len(tokens) < minSimhashTokens {
+		return ""
+	}
+
+	var weights [64]int
+	for i := 0; i+simhashShingle <= len(tokens); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(tokens[i:i+simhashShingle], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var hash uint64
+	for bit, w := range weights {
+		if w > 0 {
+			hash |= 1 << uint(bit)
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
@@ -0,0 +1,49 @@
+package network
+
+import (
+	"math/bits"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func simhashDistance(t *testing.T, a, b string) int {
+	t.Helper()
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		t.Fatalf("bad hash %q: %v", a, err)
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		t.Fatalf("bad hash %q: %v", b, err)
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+func TestContentSimhash(t *testing.T) {
+	kit := func(brand string) []byte {
+		return []byte(`<html><head><title>` + brand + ` Sign in</title></head><body>
+			<div class="login-box"><img src="logo.png"><h1>Sign in to your ` + brand + ` account</h1>
+			<form method="post" action="next.php"><input type="email" name="user" placeholder="Email address">
+			<input type="password" name="pass" placeholder="Password"><button type="submit">Next</button></form>
+			<p>Forgot your password? Contact support to recover your account.</p></div></body></html>`)
+	}
+	other := []byte(strings.Repeat("Quarterly results show revenue growth across every region and segment this year. ", 4))
+
+	a, b, c := ContentSimhash(kit("Contoso")), ContentSimhash(kit("Fabrikam")), ContentSimhash(other)
+	if len(a) != 16 || len(c) != 16 {
+		t.Fatalf("hashes = %q, %q", a, c)
+	}
+	if d := simhashDistance(t, a, b); d > 6 {
+		t.Errorf("same kit with another brand is %d bits apart", d)
+	}
+	if d := simhashDistance(t, a, c); d < 16 {
+		t.Errorf("unrelated pages are only %d bits apart", d)
+	}
+	if got := ContentSimhash(kit("Contoso")); got != a {
+		t.Errorf("hash is not deterministic: %s, then %s", a, got)
+	}
+	if got := ContentSimhash([]byte(`<meta http-equiv="refresh" content="0;url=/next">`)); got != "" {
+		t.Errorf("short page hash = %q, want empty", got)
+	}
+}
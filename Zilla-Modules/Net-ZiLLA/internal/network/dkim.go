@@ -0,0 +1,388 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+// DKIM results, in the vocabulary of Authentication-Results.
+const (
+	dkimPass      = "pass"
+	dkimFail      = "fail"
+	dkimPermError = "permerror"
+	dkimTempError = "temperror"
+)
+
+// maxDKIMSignatures bounds the key lookups a single message can trigger.
+const maxDKIMSignatures = 5
+
+const minRSAKeyBits = 1024
+
+var (
+	dkimSigValue = regexp.MustCompile(`(^|;)(\s*b\s*=)[^;]*`)
+	wspRun       = regexp.MustCompile(`[ \t]+`)
+)
+
+// headerField is one raw header field, folding and trailing CRLF included.
+type headerField struct {
+	name string
+	raw  string
+}
+
+// splitMessage normalizes line endings to CRLF and splits a message into its
+// raw header fields and body.
+func splitMessage(raw []byte) ([]headerField, []byte) {
+	raw = bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	raw = bytes.ReplaceAll(raw, []byte("\n"), []byte("\r\n"))
+
+	var fields []headerField
+	rest := raw
+	for len(rest) > 0 {
+		if bytes.HasPrefix(rest, []byte("\r\n")) {
+			return fields, rest[2:]
+		}
+		var line string
+		if end := bytes.Index(rest, []byte("\r\n")); end >= 0 {
+			line, rest = string(rest[:end+2]), rest[end+2:]
+		} else {
+			line, rest = string(rest)+"\r\n", nil
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].raw += line
+			continue
+		}
+		name, _, _ := strings.Cut(line, ":")
+		fields = append(fields, headerField{name: strings.TrimSpace(name), raw: line})
+	}
+	return fields, nil
+}
+
+// dkimSignature is a parsed DKIM-Signature header (RFC 6376 section 3.5).
+type dkimSignature struct {
+	field       headerField
+	algorithm   string
+	hash        crypto.Hash
+	signature   []byte
+	bodyHash    []byte
+	headerCanon string
+	bodyCanon   string
+	domain      string
+	selector    string
+	identity    string
+	headers     []string
+	length      int64 // -1 when the whole body is signed
+	expires     int64
+}
+
+func parseTagList(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return tags
+}
+
+func stripWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func parseDKIMSignature(f headerField) (*dkimSignature, error) {
+	_, value, _ := strings.Cut(f.raw, ":")
+	tags := parseTagList(value)
+	for _, required := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if tags[required] == "" {
+			return nil, fmt.Errorf("missing %s= tag", required)
+		}
+	}
+	if tags["v"] != "1" {
+		return nil, fmt.Errorf("unsupported version %q", tags["v"])
+	}
+
+	sig := &dkimSignature{
+		field:     f,
+		algorithm: strings.ToLower(tags["a"]),
+		domain:    strings.ToLower(strings.TrimSuffix(tags["d"], ".")),
+		selector:  tags["s"],
+		length:    -1,
+	}
+	switch sig.algorithm {
+	case "rsa-sha256", "ed25519-sha256":
+		sig.hash = crypto.SHA256
+	case "rsa-sha1":
+		sig.hash = crypto.SHA1
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", sig.algorithm)
+	}
+
+	var err error
+	if sig.signature, err = base64.StdEncoding.DecodeString(stripWhitespace(tags["b"])); err != nil {
+		return nil, fmt.Errorf("invalid b= tag: %w", err)
+	}
+	if sig.bodyHash, err = base64.StdEncoding.DecodeString(stripWhitespace(tags["bh"])); err != nil {
+		return nil, fmt.Errorf("invalid bh= tag: %w", err)
+	}
+
+	canon := strings.ToLower(tags["c"])
+	if canon == "" {
+		canon = "simple/simple"
+	}
+	sig.headerCanon, sig.bodyCanon, _ = strings.Cut(canon, "/")
+	if sig.bodyCanon == "" {
+		sig.bodyCanon = "simple"
+	}
+	for _, c := range []string{sig.headerCanon, sig.bodyCanon} {
+		if c != "simple" && c != "relaxed" {
+			return nil, fmt.Errorf("unsupported canonicalization %q", canon)
+		}
+	}
+
+	from := false
+	for _, h := range strings.Split(tags["h"], ":") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		sig.headers = append(sig.headers, h)
+		from = from || strings.EqualFold(h, "From")
+	}
+	if !from {
+		return nil, fmt.Errorf("h= does not sign From")
+	}
+
+	sig.identity = tags["i"]
+	if sig.identity == "" {
+		sig.identity = "@" + sig.domain
+	}
+	_, idDomain, _ := strings.Cut(sig.identity, "@")
+	idDomain = strings.ToLower(idDomain)
+	if idDomain != sig.domain && !strings.HasSuffix(idDomain, "."+sig.domain) {
+		return nil, fmt.Errorf("i= %s is outside d= %s", sig.identity, sig.domain)
+	}
+
+	if l := tags["l"]; l != "" {
+		if sig.length, err = strconv.ParseInt(l, 10, 64); err != nil || sig.length < 0 {
+			return nil, fmt.Errorf("invalid l= tag %q", l)
+		}
+	}
+	if x := tags["x"]; x != "" {
+		if sig.expires, err = strconv.ParseInt(x, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid x= tag %q", x)
+		}
+	}
+	return sig, nil
+}
+
+// canonicalBody applies the simple or relaxed body algorithm of RFC 6376
+// section 3.4.
+func canonicalBody(body []byte, canon string) []byte {
+	if canon == "relaxed" {
+		lines := bytes.Split(body, []byte("\r\n"))
+		for i, line := range lines {
+			line = wspRun.ReplaceAll(line, []byte(" "))
+			lines[i] = bytes.TrimRight(line, " ")
+		}
+		body = bytes.Join(lines, []byte("\r\n"))
+	}
+	for bytes.HasSuffix(body, []byte("\r\n")) {
+		body = body[:len(body)-2]
+	}
+	if len(body) == 0 {
+		if canon == "relaxed" {
+			return nil
+		}
+		return []byte("\r\n")
+	}
+	return append(body, '\r', '\n')
+}
+
+// canonicalHeader applies the simple or relaxed header algorithm.
+func canonicalHeader(raw, canon string) string {
+	if canon != "relaxed" {
+		return raw
+	}
+	name, value, _ := strings.Cut(raw, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = wspRun.ReplaceAllString(value, " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(value) + "\r\n"
+}
+
+// signedHeaders returns the canonicalized header block covered by the
+// signature, ending with the signature field itself with b= emptied.
+func (sig *dkimSignature) signedHeaders(fields []headerField) []byte {
+	var buf bytes.Buffer
+	used := make([]bool, len(fields))
+	for _, name := range sig.headers {
+		// Multiple instances are signed from the bottom up.
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				buf.WriteString(canonicalHeader(fields[i].raw, sig.headerCanon))
+				break
+			}
+		}
+	}
+	name, value, _ := strings.Cut(sig.field.raw, ":")
+	unsigned := name + ":" + dkimSigValue.ReplaceAllString(value, "$1$2")
+	buf.WriteString(strings.TrimSuffix(canonicalHeader(unsigned, sig.headerCanon), "\r\n"))
+	return buf.Bytes()
+}
+
+func newHash(h crypto.Hash) hash.Hash {
+	if h == crypto.SHA1 {
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+// verifyDKIM checks every DKIM-Signature in a raw message.
+func verifyDKIM(ctx context.Context, dns emailDNS, raw []byte, now time.Time) []*models.DKIMVerification {
+	fields, body := splitMessage(raw)
+	var results []*models.DKIMVerification
+	for _, f := range fields {
+		if !strings.EqualFold(f.name, "DKIM-Signature") {
+			continue
+		}
+		if len(results) == maxDKIMSignatures {
+			break
+		}
+		results = append(results, verifyDKIMSignature(ctx, dns, f, fields, body, now))
+	}
+	return results
+}
+
+func verifyDKIMSignature(ctx context.Context, dns emailDNS, f headerField, fields []headerField, body []byte, now time.Time) *models.DKIMVerification {
+	sig, err := parseDKIMSignature(f)
+	if err != nil {
+		_, value, _ := strings.Cut(f.raw, ":")
+		tags := parseTagList(value)
+		return &models.DKIMVerification{Domain: tags["d"], Selector: tags["s"], Algorithm: tags["a"], Result: dkimPermError, Error: err.Error()}
+	}
+	result := &models.DKIMVerification{Domain: sig.domain, Selector: sig.selector, Algorithm: sig.algorithm}
+	fail := func(status, format string, args ...interface{}) *models.DKIMVerification {
+		result.Result, result.Error = status, fmt.Sprintf(format, args...)
+		return result
+	}
+
+	if sig.expires > 0 && now.Unix() > sig.expires {
+		return fail(dkimPermError, "signature expired %s", time.Unix(sig.expires, 0).UTC().Format(time.RFC3339))
+	}
+
+	canonical := canonicalBody(body, sig.bodyCanon)
+	if sig.length >= 0 {
+		if sig.length > int64(len(canonical)) {
+			return fail(dkimPermError, "l= exceeds the body length")
+		}
+		canonical = canonical[:sig.length]
+	}
+	h := newHash(sig.hash)
+	h.Write(canonical)
+	if !bytes.Equal(h.Sum(nil), sig.bodyHash) {
+		return fail(dkimFail, "body hash mismatch")
+	}
+
+	key, status, err := lookupDKIMKey(ctx, dns, sig)
+	if err != nil {
+		return fail(status, "%v", err)
+	}
+
+	h = newHash(sig.hash)
+	h.Write(sig.signedHeaders(fields))
+	digest := h.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(k, sig.hash, digest, sig.signature)
+	case ed25519.PublicKey:
+		// RFC 8463 signs the SHA-256 digest rather than the data itself.
+		if !ed25519.Verify(k, digest, sig.signature) {
+			err = fmt.Errorf("ed25519 verification failed")
+		}
+	}
+	if err != nil {
+		return fail(dkimFail, "signature does not verify")
+	}
+	result.Result = dkimPass
+	return result
+}
+
+// lookupDKIMKey fetches the public key from <selector>._domainkey.<domain>.
+func lookupDKIMKey(ctx context.Context, dns emailDNS, sig *dkimSignature) (crypto.PublicKey, string, error) {
+	name := sig.selector + "._domainkey." + sig.domain
+	txts, err := dns.LookupTXT(ctx, name)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, dkimPermError, fmt.Errorf("no key at %s", name)
+		}
+		return nil, dkimTempError, fmt.Errorf("key lookup for %s failed: %v", name, err)
+	}
+	if len(txts) == 0 {
+		return nil, dkimPermError, fmt.Errorf("no key at %s", name)
+	}
+	// Resolvers hand back a long record in 255-byte pieces; LookupTXT joins
+	// the pieces of one record, so the first record is the key.
+	tags := parseTagList(txts[0])
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, dkimPermError, fmt.Errorf("unsupported key version %q", v)
+	}
+	p := stripWhitespace(tags["p"])
+	if p == "" {
+		return nil, dkimPermError, fmt.Errorf("key at %s has been revoked", name)
+	}
+	if hashes := tags["h"]; hashes != "" && sig.hash == crypto.SHA1 && !strings.Contains(hashes, "sha1") {
+		return nil, dkimPermError, fmt.Errorf("key does not allow sha1")
+	}
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, dkimPermError, fmt.Errorf("invalid key data: %v", err)
+	}
+
+	keyType := strings.ToLower(tags["k"])
+	if keyType == "" {
+		keyType = "rsa"
+	}
+	switch {
+	case keyType == "ed25519" && strings.HasPrefix(sig.algorithm, "ed25519"):
+		if len(der) != ed25519.PublicKeySize {
+			return nil, dkimPermError, fmt.Errorf("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(der), "", nil
+	case keyType == "rsa" && strings.HasPrefix(sig.algorithm, "rsa"):
+		var key *rsa.PublicKey
+		if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+			key, _ = pub.(*rsa.PublicKey)
+		} else if pub, err := x509.ParsePKCS1PublicKey(der); err == nil {
+			key = pub
+		}
+		if key == nil {
+			return nil, dkimPermError, fmt.Errorf("invalid RSA key")
+		}
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, dkimPermError, fmt.Errorf("%d-bit RSA key is too short", key.N.BitLen())
+		}
+		return key, "", nil
+	}
+	return nil, dkimPermError, fmt.Errorf("key type %s does not match %s", keyType, sig.algorithm)
+}
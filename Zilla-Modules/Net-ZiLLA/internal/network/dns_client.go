@@ -14,23 +14,39 @@ import (
 // DNSClient provides functionality for performing various DNS lookups.
 type DNSClient struct {
 	resolver *net.Resolver
+	server   string // Upstream name server
 	timeout  time.Duration
 	logger   *logger.Logger // Added logger
 }
 
 // NewDNSClient creates a new DNSClient instance.
 func NewDNSClient(logger *logger.Logger) *DNSClient {
-	return &DNSClient{
-		resolver: &net.Resolver{
-			PreferGo: true,
-			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-				d := net.Dialer{Timeout: 10 * time.Second}
-				return d.DialContext(ctx, "udp", "8.8.8.8:53") // Google DNS
-			},
-		},
+	d := &DNSClient{
+		server:  "8.8.8.8:53", // Google DNS
 		timeout: 10 * time.Second,
 		logger:  logger,
 	}
+	d.resolver = d.upstreamResolver()
+	return d
+}
+
+func (d *DNSClient) upstreamResolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialer := net.Dialer{Timeout: 10 * time.Second}
+			return dialer.DialContext(ctx, "udp", d.server)
+		},
+	}
+}
+
+// SetCassette records or replays every DNS message through c; nil restores live lookups.
+func (d *DNSClient) SetCassette(c *Cassette) {
+	if r := c.Resolver(d.server); r != nil {
+		d.resolver = r
+		return
+	}
+	d.resolver = d.upstreamResolver()
 }
 
 // Lookup performs a comprehensive DNS lookup for the given domain.
@@ -0,0 +1,438 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+
+	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
+)
+
+// maxMTASTSPolicySize is the largest policy file fetched (RFC 8461 suggests 64KiB).
+const maxMTASTSPolicySize = 64 << 10
+
+var receivedIP = regexp.MustCompile(`\[(?:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+
+// EmailAuthAnalyzer interprets the email authentication records a domain
+// publishes (SPF, DMARC, BIMI, MTA-STS) and verifies raw emails against them.
+type EmailAuthAnalyzer struct {
+	dnsClient  *DNSClient
+	lookup     emailDNS // Overrides dnsClient's resolver in tests
+	httpClient *http.Client
+	transport  http.RoundTripper // Live transport, wrapped when a cassette is set
+	timeout    time.Duration
+	now        func() time.Time
+	logger     *logger.Logger
+}
+
+// NewEmailAuthAnalyzer creates an EmailAuthAnalyzer that resolves through dnsClient.
+func NewEmailAuthAnalyzer(logger *logger.Logger, dnsClient *DNSClient) *EmailAuthAnalyzer {
+	transport := &http.Transport{TLSHandshakeTimeout: 10 * time.Second}
+	return &EmailAuthAnalyzer{
+		dnsClient: dnsClient,
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: transport,
+			// RFC 8461 forbids following redirects for the policy file.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		transport: transport,
+		timeout:   20 * time.Second,
+		now:       time.Now,
+		logger:    logger,
+	}
+}
+
+// SetCassette records or replays the MTA-STS policy fetches through c. DNS goes
+// through the DNSClient, which has its own cassette.
+func (a *EmailAuthAnalyzer) SetCassette(c *Cassette) {
+	a.httpClient.Transport = c.Transport(a.transport)
+	if c != nil {
+		a.now = c.Now
+	} else {
+		a.now = time.Now
+	}
+}
+
+func (a *EmailAuthAnalyzer) dns() emailDNS {
+	if a.lookup != nil {
+		return a.lookup
+	}
+	return a.dnsClient.resolver
+}
+
+// Analyze evaluates the SPF, DMARC, BIMI and MTA-STS records of domain. Missing
+// or permissive policies become findings, and RiskScore rates how easily mail
+// claiming to be from the domain can be spoofed.
+func (a *EmailAuthAnalyzer) Analyze(ctx context.Context, domain string) *models.EmailSecurity {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	result := &models.EmailSecurity{Domain: domain}
+	score := 0
+	add := func(points int, format string, args ...interface{}) {
+		score += points
+		result.Findings = append(result.Findings, fmt.Sprintf(format, args...))
+	}
+
+	result.SPF = spfPolicy(ctx, a.dns(), domain)
+	switch spf := result.SPF; {
+	case spf == nil:
+		add(15, "No SPF record: any server can send mail as %s", domain)
+	case spf.Record == "":
+		add(10, "SPF record unusable: %s", strings.Join(spf.Errors, "; "))
+	default:
+		switch spf.All {
+		case "+":
+			add(20, "SPF ends in +all: every server on the internet is authorized")
+		case "?":
+			add(10, "SPF ends in ?all: unlisted servers are neutral, not rejected")
+		case "":
+			add(5, "SPF has no all mechanism: unlisted servers are neutral, not rejected")
+		}
+		if len(spf.Errors) > 0 {
+			add(10, "SPF record problems: %s", strings.Join(spf.Errors, "; "))
+		}
+	}
+
+	dmarc, err := a.lookupDMARC(ctx, domain)
+	result.DMARC = dmarc
+	switch {
+	case err != nil:
+		add(10, "DMARC record unusable: %v", err)
+	case dmarc == nil:
+		add(15, "No DMARC record: receivers have no policy for spoofed %s mail", domain)
+	default:
+		policy := dmarc.Policy
+		if dmarc.Inherited {
+			policy = dmarc.SubdomainPolicy
+		}
+		if policy == "none" {
+			add(10, "DMARC policy is p=none: spoofed mail is only monitored")
+		} else if dmarc.Percent < 100 {
+			add(5, "DMARC policy applies to only %d%% of failing mail", dmarc.Percent)
+		}
+		if !dmarc.Inherited && dmarc.Policy != "none" && dmarc.SubdomainPolicy == "none" {
+			add(3, "DMARC sp=none leaves subdomains of %s open to spoofing", domain)
+		}
+	}
+
+	if bimi := a.lookupBIMI(ctx, domain); bimi != nil {
+		result.BIMI = bimi
+		if dmarc == nil || dmarc.Policy == "none" {
+			add(2, "BIMI logo published without an enforced DMARC policy")
+		}
+	}
+
+	if sts := a.lookupMTASTS(ctx, domain); sts != nil {
+		result.MTASTS = sts
+		switch {
+		case sts.Error != "":
+			add(5, "MTA-STS advertised but its policy is unusable: %s", sts.Error)
+		case sts.Mode != "enforce":
+			result.Findings = append(result.Findings, fmt.Sprintf("MTA-STS policy is in %s mode", sts.Mode))
+		}
+	}
+
+	if score > 100 {
+		score = 100
+	}
+	result.RiskScore = score
+	return result
+}
+
+// lookupDMARC finds the DMARC record for domain, falling back to its
+// organizational domain as RFC 7489 section 6.6.3 describes.
+func (a *EmailAuthAnalyzer) lookupDMARC(ctx context.Context, domain string) (*models.DMARCPolicy, error) {
+	policy, err := a.dmarcRecord(ctx, domain)
+	if policy != nil || err != nil {
+		return policy, err
+	}
+	org := OrganizationalDomain(domain)
+	if org == domain {
+		return nil, nil
+	}
+	policy, err = a.dmarcRecord(ctx, org)
+	if policy != nil {
+		policy.Inherited = true
+	}
+	return policy, err
+}
+
+func (a *EmailAuthAnalyzer) dmarcRecord(ctx context.Context, domain string) (*models.DMARCPolicy, error) {
+	txts, err := a.dns().LookupTXT(ctx, "_dmarc."+domain)
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("lookup of _dmarc.%s failed: %w", domain, err)
+	}
+	for _, txt := range txts {
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(txt)), "V=DMARC1") {
+			policy, err := parseDMARC(txt)
+			if policy != nil {
+				policy.Domain = domain
+			}
+			return policy, err
+		}
+	}
+	return nil, nil
+}
+
+// parseDMARC parses a DMARC record, applying the RFC 7489 defaults.
+func parseDMARC(record string) (*models.DMARCPolicy, error) {
+	tags := parseTagList(record)
+	if !strings.EqualFold(tags["v"], "DMARC1") {
+		return nil, fmt.Errorf("not a DMARC record")
+	}
+	p := &models.DMARCPolicy{
+		Record:  record,
+		Policy:  strings.ToLower(tags["p"]),
+		Percent: 100,
+		ADKIM:   "r",
+		ASPF:    "r",
+	}
+	switch p.Policy {
+	case "none", "quarantine", "reject":
+	default:
+		return nil, fmt.Errorf("invalid DMARC policy p=%q", tags["p"])
+	}
+	p.SubdomainPolicy = p.Policy
+	if sp := strings.ToLower(tags["sp"]); sp == "none" || sp == "quarantine" || sp == "reject" {
+		p.SubdomainPolicy = sp
+	}
+	if pct, err := strconv.Atoi(tags["pct"]); err == nil && pct >= 0 && pct <= 100 {
+		p.Percent = pct
+	}
+	if strings.EqualFold(tags["adkim"], "s") {
+		p.ADKIM = "s"
+	}
+	if strings.EqualFold(tags["aspf"], "s") {
+		p.ASPF = "s"
+	}
+	p.RUA = splitURIs(tags["rua"])
+	p.RUF = splitURIs(tags["ruf"])
+	return p, nil
+}
+
+func splitURIs(s string) []string {
+	var out []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+func (a *EmailAuthAnalyzer) lookupBIMI(ctx context.Context, domain string) *models.BIMIRecord {
+	txts, err := a.dns().LookupTXT(ctx, "default._bimi."+domain)
+	if err != nil {
+		return nil
+	}
+	for _, txt := range txts {
+		tags := parseTagList(txt)
+		if strings.EqualFold(tags["v"], "BIMI1") {
+			return &models.BIMIRecord{Record: txt, Location: tags["l"], Authority: tags["a"]}
+		}
+	}
+	return nil
+}
+
+// lookupMTASTS reads the _mta-sts TXT record and, when present, fetches the
+// policy file from https://mta-sts.<domain>/.well-known/mta-sts.txt.
+func (a *EmailAuthAnalyzer) lookupMTASTS(ctx context.Context, domain string) *models.MTASTSPolicy {
+	txts, err := a.dns().LookupTXT(ctx, "_mta-sts."+domain)
+	if err != nil {
+		return nil
+	}
+	var policy *models.MTASTSPolicy
+	for _, txt := range txts {
+		tags := parseTagList(txt)
+		if strings.EqualFold(tags["v"], "STSv1") {
+			policy = &models.MTASTSPolicy{Record: txt, ID: tags["id"]}
+			break
+		}
+	}
+	if policy == nil {
+		return nil
+	}
+
+	if err := a.fetchMTASTSPolicy(ctx, domain, policy); err != nil {
+		a.logger.Warn("MTA-STS policy fetch for %s failed: %v", domain, err)
+		policy.Error = err.Error()
+	}
+	return policy
+}
+
+func (a *EmailAuthAnalyzer) fetchMTASTSPolicy(ctx context.Context, domain string, policy *models.MTASTSPolicy) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://mta-sts."+domain+"/.well-known/mta-sts.txt", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching policy: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("policy returned HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMTASTSPolicySize))
+	if err != nil {
+		return fmt.Errorf("reading policy: %w", err)
+	}
+
+	version := ""
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "version":
+			version = value
+		case "mode":
+			policy.Mode = value
+		case "mx":
+			policy.MX = append(policy.MX, value)
+		case "max_age":
+			policy.MaxAge, _ = strconv.Atoi(value)
+		}
+	}
+	if version != "STSv1" {
+		return fmt.Errorf("policy has no version: STSv1 line")
+	}
+	switch policy.Mode {
+	case "enforce", "testing", "none":
+	default:
+		return fmt.Errorf("invalid policy mode %q", policy.Mode)
+	}
+	if policy.Mode != "none" && len(policy.MX) == 0 {
+		return fmt.Errorf("policy lists no mx hosts")
+	}
+	return nil
+}
+
+// VerifyEmail checks a raw email's DKIM signatures and SPF against live DNS and
+// evaluates DMARC alignment for its From domain. SPF is checked for the
+// Return-Path domain from the connecting IP in the receiver's Received header.
+func (a *EmailAuthAnalyzer) VerifyEmail(ctx context.Context, raw []byte) (*models.EmailVerification, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid email: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	fromDomain := ""
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		fromDomain = addressDomain(from.Address)
+	}
+	sender := strings.Trim(strings.TrimSpace(msg.Header.Get("Return-Path")), "<>")
+
+	v := &models.EmailVerification{SPF: spfNone, DMARC: "none", SPFDomain: addressDomain(sender)}
+	if ip := connectingIP(msg.Header["Received"]); ip != nil && v.SPFDomain != "" {
+		v.ClientIP = ip.String()
+		checker := &spfChecker{dns: a.dns(), ip: ip, sender: sender}
+		v.SPF, err = checker.checkHost(ctx, v.SPFDomain)
+		if err != nil {
+			a.logger.Debug("SPF %s for %s: %v", v.SPF, v.SPFDomain, err)
+		}
+	}
+	v.DKIM = verifyDKIM(ctx, a.dns(), raw, a.now())
+
+	if fromDomain == "" {
+		return v, nil
+	}
+	policy, err := a.lookupDMARC(ctx, fromDomain)
+	if err != nil {
+		a.logger.Warn("DMARC lookup for %s failed: %v", fromDomain, err)
+		v.DMARC = "temperror"
+	}
+	adkim, aspf := "r", "r"
+	if policy != nil {
+		adkim, aspf = policy.ADKIM, policy.ASPF
+		v.Policy = policy
+	}
+	v.SPFAligned = v.SPF == spfPass && domainsAlign(v.SPFDomain, fromDomain, aspf)
+	for _, d := range v.DKIM {
+		if d.Result == dkimPass && domainsAlign(d.Domain, fromDomain, adkim) {
+			v.DKIMAligned = true
+		}
+	}
+	if policy != nil {
+		v.DMARC = "fail"
+		if v.SPFAligned || v.DKIMAligned {
+			v.DMARC = "pass"
+		}
+	}
+	return v, nil
+}
+
+// connectingIP returns the first public address in the Received headers, newest
+// first, skipping hops inside the receiving organization.
+func connectingIP(received []string) net.IP {
+	for _, r := range received {
+		for _, m := range receivedIP.FindAllStringSubmatch(r, -1) {
+			if ip := net.ParseIP(m[1]); ip != nil && isPublicIP(ip) && !ip.IsUnspecified() {
+				return ip
+			}
+		}
+	}
+	return nil
+}
+
+// domainsAlign applies DMARC identifier alignment: strict requires the same
+// domain, relaxed the same organizational domain.
+func domainsAlign(a, b, mode string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == "" || b == "" {
+		return false
+	}
+	if mode == "s" {
+		return a == b
+	}
+	return OrganizationalDomain(a) == OrganizationalDomain(b)
+}
+
+// IsReservedDomain reports names under the RFC 2606 and RFC 6761 special-use
+// TLDs, which never publish real mail policies and are not worth a lookup.
+func IsReservedDomain(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, tld := range []string{"example", "test", "invalid", "localhost", "local"} {
+		if domain == tld || strings.HasSuffix(domain, "."+tld) {
+			return true
+		}
+	}
+	return false
+}
+
+// OrganizationalDomain returns the registrable domain DMARC aligns on, e.g.
+// "mail.example.co.uk" -> "example.co.uk".
+func OrganizationalDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if d, err := publicsuffix.EffectiveTLDPlusOne(domain); err == nil {
+		return d
+	}
+	return domain
+}
+
+func addressDomain(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		address = address[i+1:]
+	}
+	return strings.ToLower(strings.TrimSpace(address))
+}
@@ -0,0 +1,546 @@
+package network
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"net-zilla/pkg/logger"
+)
+
+// fakeZone is a static emailDNS. Names listed in fail return a server failure.
+type fakeZone struct {
+	txt  map[string][]string
+	ip   map[string][]string
+	mx   map[string][]string
+	fail map[string]bool
+}
+
+func (z *fakeZone) err(name string) error {
+	if z.fail[name] {
+		return &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+	}
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (z *fakeZone) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if v, ok := z.txt[name]; ok {
+		return v, nil
+	}
+	return nil, z.err(name)
+}
+
+func (z *fakeZone) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	v, ok := z.ip[host]
+	if !ok {
+		return nil, z.err(host)
+	}
+	var addrs []net.IPAddr
+	for _, s := range v {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(s)})
+	}
+	return addrs, nil
+}
+
+func (z *fakeZone) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	v, ok := z.mx[name]
+	if !ok {
+		return nil, z.err(name)
+	}
+	var mxs []*net.MX
+	for i, host := range v {
+		mxs = append(mxs, &net.MX{Host: host + ".", Pref: uint16(10 * (i + 1))})
+	}
+	return mxs, nil
+}
+
+func TestParseSPF(t *testing.T) {
+	tests := []struct {
+		record  string
+		wantErr bool
+	}{
+		{"v=spf1 -all", false},
+		{"v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 a mx/24 a:mail.example.com/28//64 include:_spf.example.net ~all", false},
+		{"v=spf1 exists:%{ir}.%{l1r+-}._spf.%{d} redirect=_spf.example.com exp=explain.%{d} unknown-mod=1", false},
+		{"v=spf1 ptr ?all", false},
+		{"v=spf1 include: -all", true},
+		{"v=spf1 ip4:300.1.1.1 -all", true},
+		{"v=spf1 ip4:2001:db8::1 -all", true},
+		{"v=spf1 a/33 -all", true},
+		{"v=spf1 foo -all", true},
+		{"v=spf1 redirect=a.example redirect=b.example", true},
+		{"spf2.0/pra -all", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseSPF(tt.record); (err != nil) != tt.wantErr {
+			t.Errorf("parseSPF(%q) error = %v, wantErr %v", tt.record, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSPFPolicy(t *testing.T) {
+	zone := &fakeZone{txt: map[string][]string{
+		"strict.example":   {"google-site-verification=abc", "v=spf1 include:_spf.esp.example mx -all"},
+		"_spf.esp.example": {"v=spf1 ip4:198.51.100.0/24 include:_ips.esp.example ~all"},
+		"_ips.esp.example": {"v=spf1 ip4:203.0.113.0/24 -all"},
+		"redirect.example": {"v=spf1 redirect=strict.example"},
+		"open.example":     {"v=spf1 +all"},
+		"loop.example":     {"v=spf1 include:loop2.example -all"},
+		"loop2.example":    {"v=spf1 include:loop.example -all"},
+		"twice.example":    {"v=spf1 -all", "v=spf1 ~all"},
+		"broken.example":   {"v=spf1 include:missing.example -all"},
+		"heavy.example":    {"v=spf1 " + strings.Repeat("a ", 6) + "include:_spf.esp.example mx exists:x.example ~all"},
+	}}
+
+	tests := []struct {
+		domain     string
+		wantAll    string
+		wantLookup int
+		wantErr    string
+	}{
+		{"strict.example", "-", 3, ""},
+		{"redirect.example", "-", 4, ""},
+		{"open.example", "+", 0, ""},
+		{"loop.example", "-", 2, "loop"},
+		{"twice.example", "", 0, "2 SPF records"},
+		{"broken.example", "-", 1, "no SPF record"},
+		{"heavy.example", "~", 10, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			p := spfPolicy(context.Background(), zone, tt.domain)
+			if p.All != tt.wantAll || p.DNSLookups != tt.wantLookup {
+				t.Errorf("all=%q lookups=%d, want %q %d (%+v)", p.All, p.DNSLookups, tt.wantAll, tt.wantLookup, p)
+			}
+			errs := strings.Join(p.Errors, "; ")
+			if (tt.wantErr == "") != (errs == "") || !strings.Contains(errs, tt.wantErr) {
+				t.Errorf("errors %q, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+
+	zone.txt["heavy.example"] = []string{"v=spf1 " + strings.Repeat("a ", 9) + "include:_spf.esp.example ~all"}
+	if p := spfPolicy(context.Background(), zone, "heavy.example"); p.DNSLookups != 11 || len(p.Errors) != 1 {
+		t.Errorf("expected the lookup limit to be flagged, got %+v", p)
+	}
+	if p := spfPolicy(context.Background(), zone, "nothing.example"); p != nil {
+		t.Errorf("expected nil for a domain without SPF, got %+v", p)
+	}
+}
+
+func TestSPFCheckHost(t *testing.T) {
+	zone := &fakeZone{
+		txt: map[string][]string{
+			"shop.example":        {"v=spf1 ip4:192.0.2.0/28 include:_spf.esp.example mx:mail.shop.example a/30 -all"},
+			"_spf.esp.example":    {"v=spf1 ip6:2001:db8:e5::/48 ip4:198.51.100.7 ~all"},
+			"soft.example":        {"v=spf1 ~all"},
+			"redir.example":       {"v=spf1 redirect=shop.example"},
+			"badredir.example":    {"v=spf1 redirect=nowhere.example"},
+			"macro.example":       {"v=spf1 exists:%{i}.%{l}._allow.%{d} -all"},
+			"voids.example":       {"v=spf1 a:v1.example a:v2.example a:v3.example -all"},
+			"tempfail.example":    {"v=spf1 include:down.example -all"},
+			"neutral.example":     {"v=spf1 ip4:192.0.2.1"},
+			"perm.example":        {"v=spf1 bogus -all"},
+			"deepinclude.example": {"v=spf1 include:soft.example -all"},
+		},
+		ip: map[string][]string{
+			"mx1.shop.example": {"203.0.113.10"},
+			"shop.example":     {"203.0.113.65"},
+			"192.0.2.200.alerts._allow.macro.example": {"127.0.0.2"},
+		},
+		mx:   map[string][]string{"mail.shop.example": {"mx1.shop.example"}},
+		fail: map[string]bool{"down.example": true},
+	}
+
+	tests := []struct {
+		domain string
+		ip     string
+		want   string
+	}{
+		{"shop.example", "192.0.2.9", spfPass},
+		{"shop.example", "198.51.100.7", spfPass},
+		{"shop.example", "2001:db8:e5::25", spfPass},
+		{"shop.example", "203.0.113.10", spfPass},
+		{"shop.example", "203.0.113.66", spfPass}, // a/30 covers .64-.67
+		{"shop.example", "203.0.113.70", spfFail},
+		{"soft.example", "192.0.2.9", spfSoftFail},
+		{"redir.example", "192.0.2.9", spfPass},
+		{"redir.example", "192.0.2.99", spfFail},
+		{"badredir.example", "192.0.2.9", spfPermError},
+		{"macro.example", "192.0.2.200", spfPass},
+		{"macro.example", "192.0.2.201", spfFail},
+		{"voids.example", "192.0.2.1", spfPermError},
+		{"tempfail.example", "192.0.2.1", spfTempError},
+		{"neutral.example", "192.0.2.2", spfNeutral},
+		{"perm.example", "192.0.2.2", spfPermError},
+		{"deepinclude.example", "192.0.2.2", spfFail}, // include's softfail is just "no match"
+		{"unknown.example", "192.0.2.2", spfNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain+"/"+tt.ip, func(t *testing.T) {
+			c := &spfChecker{dns: zone, ip: net.ParseIP(tt.ip), sender: "alerts@" + tt.domain}
+			got, err := c.checkHost(context.Background(), tt.domain)
+			if got != tt.want {
+				t.Errorf("checkHost() = %s (%v), want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSPFMacroExpansion(t *testing.T) {
+	// Examples from RFC 7208 section 7.4.
+	c := &spfChecker{ip: net.ParseIP("192.0.2.3"), sender: "strong-bad@email.example.com"}
+	tests := map[string]string{
+		"%{s}":                              "strong-bad@email.example.com",
+		"%{o}":                              "email.example.com",
+		"%{d4}":                             "email.example.com",
+		"%{d2}":                             "example.com",
+		"%{d1}":                             "com",
+		"%{dr}":                             "com.example.email",
+		"%{d2r}":                            "example.email",
+		"%{l}":                              "strong-bad",
+		"%{l-}":                             "strong.bad",
+		"%{lr-}":                            "bad.strong",
+		"%{l1r-}":                           "strong",
+		"%{ir}.%{v}._spf.%{d2}":             "3.2.0.192.in-addr._spf.example.com",
+		"%{lr-}.lp._spf.%{d2}":              "bad.strong.lp._spf.example.com",
+		"%{d2}.trusted-domains.example.net": "example.com.trusted-domains.example.net",
+	}
+	for spec, want := range tests {
+		if got, err := c.expand(spec, "email.example.com"); err != nil || got != want {
+			t.Errorf("expand(%q) = %q, %v; want %q", spec, got, err, want)
+		}
+	}
+
+	c.ip = net.ParseIP("2001:db8::cb01")
+	want := "1.0.b.c.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6._spf.example.com"
+	if got, _ := c.expand("%{ir}.%{v}._spf.%{d2}", "email.example.com"); got != want {
+		t.Errorf("IPv6 expansion = %q, want %q", got, want)
+	}
+	for _, bad := range []string{"%{x}", "%{d0}", "%{", "50%"} {
+		if _, err := c.expand(bad, "email.example.com"); err == nil {
+			t.Errorf("expand(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseDMARC(t *testing.T) {
+	p, err := parseDMARC("v=DMARC1; p=quarantine; sp=none; pct=25; adkim=s; rua=mailto:a@example.com, mailto:b@example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Policy != "quarantine" || p.SubdomainPolicy != "none" || p.Percent != 25 || p.ADKIM != "s" || p.ASPF != "r" || len(p.RUA) != 2 {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+	if p, _ := parseDMARC("v=DMARC1; p=reject"); p.SubdomainPolicy != "reject" || p.Percent != 100 {
+		t.Errorf("defaults not applied: %+v", p)
+	}
+	for _, bad := range []string{"v=DMARC1; p=monitor", "v=DMARC1", "p=reject"} {
+		if _, err := parseDMARC(bad); err == nil {
+			t.Errorf("parseDMARC(%q) should fail", bad)
+		}
+	}
+}
+
+func TestIsReservedDomain(t *testing.T) {
+	tests := map[string]bool{
+		"shop.example":     true,
+		"a.b.test.":        true,
+		"localhost":        true,
+		"printer.local":    true,
+		"example.com":      false,
+		"examples.net":     false,
+		"contest":          false,
+		"mail.invalid.org": false,
+	}
+	for domain, want := range tests {
+		if got := IsReservedDomain(domain); got != want {
+			t.Errorf("IsReservedDomain(%q) = %v, want %v", domain, got, want)
+		}
+	}
+}
+
+func newTestEmailAuthAnalyzer(zone *fakeZone) *EmailAuthAnalyzer {
+	a := NewEmailAuthAnalyzer(logger.NewLogger(), NewDNSClient(logger.NewLogger()))
+	a.lookup = zone
+	return a
+}
+
+func TestEmailAuthAnalyzer_Analyze(t *testing.T) {
+	zone := &fakeZone{txt: map[string][]string{
+		"secure.example":               {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"_dmarc.secure.example":        {"v=DMARC1; p=reject; rua=mailto:dmarc@secure.example"},
+		"default._bimi.secure.example": {"v=BIMI1; l=https://secure.example/logo.svg; a=https://secure.example/vmc.pem"},
+		"lax.example":                  {"v=spf1 include:_spf.esp.example ?all"},
+		"_spf.esp.example":             {"v=spf1 ip4:198.51.100.0/24 ~all"},
+		"_dmarc.lax.example":           {"v=DMARC1; p=none"},
+		"default._bimi.lax.example":    {"v=BIMI1; l=https://lax.example/logo.svg"},
+		"monitor.example":              {"v=spf1 mx ~all"},
+		"_dmarc.monitor.example":       {"v=DMARC1; p=quarantine; pct=10; sp=none"},
+		"_dmarc.corp.example":          {"v=DMARC1; p=reject; sp=none"},
+		"mail.corp.example":            {"v=spf1 -all"},
+	}}
+	a := newTestEmailAuthAnalyzer(zone)
+
+	tests := []struct {
+		domain       string
+		wantScore    int
+		wantFindings []string
+	}{
+		{"secure.example", 0, nil},
+		{"lax.example", 22, []string{"?all", "p=none", "BIMI"}},
+		{"monitor.example", 8, []string{"only 10%", "sp=none"}},
+		{"mail.corp.example", 10, []string{"p=none"}}, // Inherits sp=none from corp.example
+		{"nothing.example", 30, []string{"No SPF", "No DMARC"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got := a.Analyze(context.Background(), tt.domain)
+			if got.RiskScore != tt.wantScore || len(got.Findings) != len(tt.wantFindings) {
+				t.Fatalf("score %d findings %q, want %d and %q", got.RiskScore, got.Findings, tt.wantScore, tt.wantFindings)
+			}
+			for i, want := range tt.wantFindings {
+				if !strings.Contains(got.Findings[i], want) {
+					t.Errorf("finding %q does not mention %q", got.Findings[i], want)
+				}
+			}
+		})
+	}
+
+	secure := a.Analyze(context.Background(), "secure.example")
+	if secure.BIMI == nil || secure.BIMI.Authority == "" || secure.DMARC.Inherited || secure.SPF.All != "-" {
+		t.Errorf("unexpected records: %+v", secure)
+	}
+	if inherited := a.Analyze(context.Background(), "mail.corp.example"); !inherited.DMARC.Inherited || inherited.DMARC.Domain != "corp.example" {
+		t.Errorf("expected DMARC inherited from corp.example, got %+v", inherited.DMARC)
+	}
+}
+
+func TestEmailAuthAnalyzer_MTASTS(t *testing.T) {
+	policies := map[string]string{
+		"enforce.example": "version: STSv1\nmode: enforce\nmx: mx1.enforce.example\nmx: *.enforce.example\nmax_age: 604800\n",
+		"testing.example": "version: STSv1\r\nmode: testing\r\nmx: mx.testing.example\r\nmax_age: 86400\r\n",
+		"broken.example":  "mode: enforce\n",
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain := strings.TrimPrefix(r.Host, "mta-sts.")
+		policy, ok := policies[domain]
+		if !ok || r.URL.Path != "/.well-known/mta-sts.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, policy)
+	}))
+	defer server.Close()
+
+	zone := &fakeZone{txt: map[string][]string{}}
+	for _, domain := range []string{"enforce.example", "testing.example", "broken.example", "gone.example"} {
+		zone.txt[domain] = []string{"v=spf1 -all"}
+		zone.txt["_dmarc."+domain] = []string{"v=DMARC1; p=reject"}
+		zone.txt["_mta-sts."+domain] = []string{"v=STSv1; id=20240101T000000;"}
+	}
+	a := newTestEmailAuthAnalyzer(zone)
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.ServerName = "example.com" // Name on the httptest certificate
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	a.transport = transport
+	a.SetCassette(nil)
+
+	tests := []struct {
+		domain    string
+		wantMode  string
+		wantError string
+		wantScore int
+	}{
+		{"enforce.example", "enforce", "", 0},
+		{"testing.example", "testing", "", 0},
+		{"broken.example", "enforce", "STSv1", 5},
+		{"gone.example", "", "HTTP 404", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got := a.Analyze(context.Background(), tt.domain)
+			sts := got.MTASTS
+			if sts == nil || sts.Mode != tt.wantMode || !strings.Contains(sts.Error, tt.wantError) || (tt.wantError == "") != (sts.Error == "") {
+				t.Fatalf("unexpected MTA-STS result %+v", sts)
+			}
+			if got.RiskScore != tt.wantScore {
+				t.Errorf("score %d (%q), want %d", got.RiskScore, got.Findings, tt.wantScore)
+			}
+		})
+	}
+	if sts := a.Analyze(context.Background(), "enforce.example").MTASTS; len(sts.MX) != 2 || sts.MaxAge != 604800 || sts.ID != "20240101T000000" {
+		t.Errorf("unexpected policy %+v", sts)
+	}
+}
+
+// rfc8463Message is the ed25519-signed example from RFC 8463 appendix A.
+const rfc8463Message = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+	" subject : date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+	" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n" +
+	"From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+func TestVerifyDKIM_RFC8463(t *testing.T) {
+	zone := &fakeZone{txt: map[string][]string{
+		"brisbane._domainkey.football.example.com": {"v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="},
+	}}
+	now := time.Date(2018, 6, 11, 0, 0, 0, 0, time.UTC)
+
+	got := verifyDKIM(context.Background(), zone, []byte(rfc8463Message), now)
+	if len(got) != 1 || got[0].Result != dkimPass || got[0].Domain != "football.example.com" {
+		t.Fatalf("expected the RFC 8463 signature to verify, got %+v", got[0])
+	}
+
+	// Relaxed canonicalization tolerates whitespace changes but not edits.
+	reflowed := strings.Replace(rfc8463Message, "Subject: Is dinner ready?", "Subject:   Is dinner  ready?  ", 1)
+	if got := verifyDKIM(context.Background(), zone, []byte(reflowed), now); got[0].Result != dkimPass {
+		t.Errorf("whitespace change broke the signature: %+v", got[0])
+	}
+	edited := strings.Replace(rfc8463Message, "Is dinner ready?", "Is lunch ready?", 1)
+	if got := verifyDKIM(context.Background(), zone, []byte(edited), now); got[0].Result != dkimFail || got[0].Error != "signature does not verify" {
+		t.Errorf("edited header verified: %+v", got[0])
+	}
+	body := strings.Replace(rfc8463Message, "lost", "won", 1)
+	if got := verifyDKIM(context.Background(), zone, []byte(body), now); got[0].Result != dkimFail || got[0].Error != "body hash mismatch" {
+		t.Errorf("edited body verified: %+v", got[0])
+	}
+
+	zone.txt["brisbane._domainkey.football.example.com"] = []string{"v=DKIM1; k=ed25519; p="}
+	if got := verifyDKIM(context.Background(), zone, []byte(rfc8463Message), now); got[0].Result != dkimPermError || !strings.Contains(got[0].Error, "revoked") {
+		t.Errorf("revoked key accepted: %+v", got[0])
+	}
+	delete(zone.txt, "brisbane._domainkey.football.example.com")
+	zone.fail = map[string]bool{"brisbane._domainkey.football.example.com": true}
+	if got := verifyDKIM(context.Background(), zone, []byte(rfc8463Message), now); got[0].Result != dkimTempError {
+		t.Errorf("expected temperror when the key lookup fails, got %+v", got[0])
+	}
+}
+
+// signDKIM prepends an rsa-sha256 relaxed/relaxed DKIM-Signature to raw.
+func signDKIM(t *testing.T, key *rsa.PrivateKey, raw, domain, selector, extraTags string) string {
+	t.Helper()
+	fields, body := splitMessage([]byte(raw))
+	bh := sha256.Sum256(canonicalBody(body, "relaxed"))
+	header := "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=" + domain + "; s=" + selector + ";" + extraTags +
+		"\r\n h=from:to:subject:date; bh=" + base64.StdEncoding.EncodeToString(bh[:]) + "; b="
+	sig, err := parseDKIMSignature(headerField{name: "DKIM-Signature", raw: header + "AAAA\r\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(sig.signedHeaders(fields))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := base64.StdEncoding.EncodeToString(signature)
+	return header + b[:40] + "\r\n " + b[40:] + "\r\n" + raw
+}
+
+func TestEmailAuthAnalyzer_VerifyEmail(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone := &fakeZone{txt: map[string][]string{
+		"s1._domainkey.shop.example": {"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)},
+		"s1._domainkey.esp.example":  {"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)},
+		"bounces.shop.example":       {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"esp.example":                {"v=spf1 ip4:198.51.100.0/24 -all"},
+		"_dmarc.shop.example":        {"v=DMARC1; p=reject; aspf=s"},
+	}}
+	a := newTestEmailAuthAnalyzer(zone)
+	a.now = func() time.Time { return time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC) }
+
+	message := func(ip, returnPath string) string {
+		return "Received: from mx.internal (mx.internal [10.0.0.5]) by inbox.example.net\r\n" +
+			"Received: from out.esp.example (out.esp.example [" + ip + "])\r\n" +
+			"\tby mx.example.net with ESMTPS; Fri, 1 Mar 2024 00:00:00 +0000\r\n" +
+			"Return-Path: <" + returnPath + ">\r\n"
+	}
+	content := "From: Shop <orders@shop.example>\r\n" +
+		"To: you@example.net\r\n" +
+		"Subject:  Your order  \r\n" +
+		"Date: Fri, 1 Mar 2024 00:00:00 +0000\r\n" +
+		"\r\n" +
+		"Thanks for your order.  \r\n\r\n\r\n"
+
+	tests := []struct {
+		name                     string
+		raw                      string
+		wantSPF, wantDMARC       string
+		wantSPFAligned, wantDKIM bool
+	}{
+		{
+			name:    "aligned dkim, spf relaxed-only",
+			raw:     message("192.0.2.25", "bounce@bounces.shop.example") + signDKIM(t, key, content, "shop.example", "s1", ""),
+			wantSPF: spfPass, wantDMARC: "pass", wantDKIM: true,
+		},
+		{
+			name:    "third-party signature, spf fail",
+			raw:     message("203.0.113.9", "bounce@bounces.shop.example") + signDKIM(t, key, content, "esp.example", "s1", ""),
+			wantSPF: spfFail, wantDMARC: "fail",
+		},
+		{
+			name:    "tampered body",
+			raw:     message("192.0.2.25", "bounce@bounces.shop.example") + strings.Replace(signDKIM(t, key, content, "shop.example", "s1", ""), "order.", "order, click here.", 1),
+			wantSPF: spfPass, wantDMARC: "fail",
+		},
+		{
+			name:    "expired signature",
+			raw:     message("198.51.100.3", "b@esp.example") + signDKIM(t, key, content, "shop.example", "s1", " x=1700000000;"),
+			wantSPF: spfPass, wantDMARC: "fail",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := a.VerifyEmail(context.Background(), []byte(tt.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.SPF != tt.wantSPF || v.DMARC != tt.wantDMARC || v.SPFAligned != tt.wantSPFAligned || v.DKIMAligned != tt.wantDKIM {
+				t.Errorf("got spf=%s dmarc=%s spfAligned=%v dkimAligned=%v (%+v, dkim %+v)",
+					v.SPF, v.DMARC, v.SPFAligned, v.DKIMAligned, v, v.DKIM[0])
+			}
+		})
+	}
+
+	v, _ := a.VerifyEmail(context.Background(), []byte(tests[0].raw))
+	if v.ClientIP != "192.0.2.25" || v.SPFDomain != "bounces.shop.example" || v.Policy == nil || v.DKIM[0].Result != dkimPass {
+		t.Errorf("unexpected verification details: %+v", v)
+	}
+	if _, err := a.VerifyEmail(context.Background(), []byte("not an email")); err == nil {
+		t.Error("expected an error for input without headers")
+	}
+}
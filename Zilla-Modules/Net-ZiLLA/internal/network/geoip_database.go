@@ -0,0 +1,331 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIPRecord is the offline answer for a single IP address.
+type GeoIPRecord struct {
+	Country     string
+	CountryCode string
+	City        string
+	Region      string
+	Latitude    float64
+	Longitude   float64
+	ASN         uint
+	ASOrg       string
+	Prefix      string
+	IsProxy     bool // Set by MMDB files carrying the legacy traits.is_anonymous_proxy flag
+}
+
+// HasLocation reports whether the record carries geolocation data.
+func (r *GeoIPRecord) HasLocation() bool {
+	return r.CountryCode != "" || r.City != ""
+}
+
+// ASNString formats the AS the same way ip-api.com does ("AS15169 Google LLC").
+func (r *GeoIPRecord) ASNString() string {
+	if r.ASN == 0 {
+		return ""
+	}
+	if r.ASOrg == "" {
+		return fmt.Sprintf("AS%d", r.ASN)
+	}
+	return fmt.Sprintf("AS%d %s", r.ASN, r.ASOrg)
+}
+
+// GeoIPDatabase answers geolocation and ASN queries from local files so targets never
+// leave the analyst's machine. Every source is optional.
+type GeoIPDatabase struct {
+	city     *maxminddb.Reader
+	asn      *maxminddb.Reader
+	asnTable *ASNTable
+}
+
+// OpenGeoIPDatabase opens the MaxMind City and ASN databases and the CIDR-to-ASN table.
+// Empty paths are skipped.
+func OpenGeoIPDatabase(cityPath, asnPath, tablePath string) (*GeoIPDatabase, error) {
+	db := &GeoIPDatabase{}
+
+	if cityPath != "" {
+		reader, err := maxminddb.Open(cityPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open city database %s: %w", cityPath, err)
+		}
+		db.city = reader
+	}
+
+	if asnPath != "" {
+		reader, err := maxminddb.Open(asnPath)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open ASN database %s: %w", asnPath, err)
+		}
+		db.asn = reader
+	}
+
+	if tablePath != "" {
+		table, err := LoadASNTable(tablePath)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.asnTable = table
+	}
+
+	return db, nil
+}
+
+// Empty reports whether no source is loaded.
+func (db *GeoIPDatabase) Empty() bool {
+	return db == nil || (db.city == nil && db.asn == nil && db.asnTable == nil)
+}
+
+// Close releases the underlying MMDB files.
+func (db *GeoIPDatabase) Close() error {
+	var firstErr error
+	for _, r := range []*maxminddb.Reader{db.city, db.asn} {
+		if r == nil {
+			continue
+		}
+		if err := r.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type mmdbCityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	Traits struct {
+		IsAnonymousProxy bool `maxminddb:"is_anonymous_proxy"`
+	} `maxminddb:"traits"`
+}
+
+type mmdbASNRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// Lookup returns everything the local sources know about ip. The boolean is false when
+// no source had an entry.
+func (db *GeoIPDatabase) Lookup(ip net.IP) (*GeoIPRecord, bool, error) {
+	if db.Empty() {
+		return nil, false, nil
+	}
+
+	record := &GeoIPRecord{}
+	found := false
+
+	if db.city != nil {
+		var city mmdbCityRecord
+		network, ok, err := db.city.LookupNetwork(ip, &city)
+		if err != nil {
+			return nil, false, fmt.Errorf("city lookup failed for %s: %w", ip, err)
+		}
+		if ok {
+			found = true
+			record.Country = city.Country.Names["en"]
+			record.CountryCode = city.Country.ISOCode
+			record.City = city.City.Names["en"]
+			if len(city.Subdivisions) > 0 {
+				record.Region = city.Subdivisions[0].Names["en"]
+			}
+			record.Latitude = city.Location.Latitude
+			record.Longitude = city.Location.Longitude
+			record.IsProxy = city.Traits.IsAnonymousProxy
+			record.Prefix = network.String()
+		}
+	}
+
+	if db.asn != nil {
+		var asn mmdbASNRecord
+		network, ok, err := db.asn.LookupNetwork(ip, &asn)
+		if err != nil {
+			return nil, false, fmt.Errorf("ASN lookup failed for %s: %w", ip, err)
+		}
+		if ok && asn.Number != 0 {
+			found = true
+			record.ASN = asn.Number
+			record.ASOrg = asn.Organization
+			record.Prefix = network.String()
+		}
+	}
+
+	if record.ASN == 0 && db.asnTable != nil {
+		if entry, ok := db.asnTable.Lookup(ip); ok {
+			found = true
+			record.ASN = entry.ASN
+			record.ASOrg = entry.Org
+			if record.CountryCode == "" {
+				record.CountryCode = entry.Country
+			}
+		}
+	}
+
+	return record, found, nil
+}
+
+// ASNTableEntry is one announced range of a CIDR-to-ASN table.
+type ASNTableEntry struct {
+	Start   netip.Addr
+	End     netip.Addr
+	ASN     uint
+	Country string
+	Org     string
+}
+
+// ASNTable maps address ranges to origin ASNs using binary search over sorted,
+// non-overlapping ranges.
+type ASNTable struct {
+	entries []ASNTableEntry
+}
+
+// LoadASNTable reads a tab-separated CIDR-to-ASN table. Two line layouts are accepted:
+//
+//	range_start  range_end  asn  country  description   (iptoasn.com ip2asn-v4.tsv)
+//	cidr         asn        country  description
+//
+// Lines starting with '#' and ranges with ASN 0 ("Not routed") are skipped.
+func LoadASNTable(path string) (*ASNTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ASN table %s: %w", path, err)
+	}
+	defer f.Close()
+
+	table := &ASNTable{}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, err := parseASNTableLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		if entry.ASN != 0 {
+			table.entries = append(table.entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ASN table %s: %w", path, err)
+	}
+
+	sort.Slice(table.entries, func(i, j int) bool {
+		return table.entries[i].Start.Less(table.entries[j].Start)
+	})
+	return table, nil
+}
+
+func parseASNTableLine(line string) (ASNTableEntry, error) {
+	fields := strings.Split(line, "\t")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	var entry ASNTableEntry
+	var rest []string
+	if strings.Contains(fields[0], "/") {
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			return entry, fmt.Errorf("invalid CIDR %q: %w", fields[0], err)
+		}
+		prefix = prefix.Masked()
+		entry.Start = prefix.Addr()
+		entry.End = lastAddr(prefix)
+		rest = fields[1:]
+	} else {
+		if len(fields) < 3 {
+			return entry, fmt.Errorf("expected range_start, range_end and asn columns")
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return entry, fmt.Errorf("invalid range start %q: %w", fields[0], err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return entry, fmt.Errorf("invalid range end %q: %w", fields[1], err)
+		}
+		entry.Start, entry.End = start.Unmap(), end.Unmap()
+		rest = fields[2:]
+	}
+
+	if len(rest) == 0 {
+		return entry, fmt.Errorf("missing asn column")
+	}
+	asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(rest[0]), "AS"), 10, 32)
+	if err != nil {
+		return entry, fmt.Errorf("invalid asn %q: %w", rest[0], err)
+	}
+	entry.ASN = uint(asn)
+	if len(rest) > 1 && rest[1] != "None" {
+		entry.Country = rest[1]
+	}
+	if len(rest) > 2 {
+		entry.Org = rest[2]
+	}
+	return entry, nil
+}
+
+// Lookup returns the range containing ip.
+func (t *ASNTable) Lookup(ip net.IP) (ASNTableEntry, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return ASNTableEntry{}, false
+	}
+	addr = addr.Unmap()
+
+	// First entry starting after addr; the candidate is the one before it.
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return addr.Less(t.entries[i].Start)
+	})
+	if i == 0 {
+		return ASNTableEntry{}, false
+	}
+	entry := t.entries[i-1]
+	if addr.BitLen() != entry.Start.BitLen() || entry.End.Less(addr) {
+		return ASNTableEntry{}, false
+	}
+	return entry, true
+}
+
+// Len returns the number of ranges in the table.
+func (t *ASNTable) Len() int {
+	return len(t.entries)
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(b)*8; bit++ {
+		b[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
@@ -0,0 +1,164 @@
+package network
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// writeTestMMDB builds a small MMDB file with the given networks.
+func writeTestMMDB(t *testing.T, dbType string, records map[string]mmdbtype.Map) string {
+	t.Helper()
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: dbType, RecordSize: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cidr, data := range records {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Insert(network, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), dbType+".mmdb")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := tree.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testCityDB(t *testing.T) string {
+	return writeTestMMDB(t, "GeoLite2-City", map[string]mmdbtype.Map{
+		"81.2.69.0/24": {
+			"country": mmdbtype.Map{
+				"iso_code": mmdbtype.String("GB"),
+				"names":    mmdbtype.Map{"en": mmdbtype.String("United Kingdom")},
+			},
+			"city":         mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String("London")}},
+			"subdivisions": mmdbtype.Slice{mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String("England")}}},
+			"location": mmdbtype.Map{
+				"latitude":  mmdbtype.Float64(51.5142),
+				"longitude": mmdbtype.Float64(-0.0931),
+			},
+		},
+	})
+}
+
+func testASNDB(t *testing.T) string {
+	return writeTestMMDB(t, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"81.2.69.0/24": {
+			"autonomous_system_number":       mmdbtype.Uint32(20712),
+			"autonomous_system_organization": mmdbtype.String("Andrews & Arnold Ltd"),
+		},
+	})
+}
+
+func testASNTable(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	content := "# comment\n" +
+		"1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+		"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+		"8.8.8.0/24\tAS15169\tUS\tGOOGLE\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGeoIPDatabase_Lookup(t *testing.T) {
+	db, err := OpenGeoIPDatabase(testCityDB(t), testASNDB(t), testASNTable(t))
+	if err != nil {
+		t.Fatalf("OpenGeoIPDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	record, found, err := db.Lookup(net.ParseIP("81.2.69.142"))
+	if err != nil || !found {
+		t.Fatalf("expected MMDB hit, got found=%v err=%v", found, err)
+	}
+	if record.Country != "United Kingdom" || record.CountryCode != "GB" || record.City != "London" || record.Region != "England" {
+		t.Errorf("unexpected location: %+v", record)
+	}
+	if record.ASNString() != "AS20712 Andrews & Arnold Ltd" {
+		t.Errorf("ASNString() = %q", record.ASNString())
+	}
+	if record.Prefix != "81.2.69.0/24" {
+		t.Errorf("Prefix = %q", record.Prefix)
+	}
+
+	// Not in the MMDB files, answered by the CIDR-to-ASN table.
+	record, found, err = db.Lookup(net.ParseIP("8.8.8.8"))
+	if err != nil || !found {
+		t.Fatalf("expected table hit, got found=%v err=%v", found, err)
+	}
+	if record.ASN != 15169 || record.CountryCode != "US" || record.City != "" {
+		t.Errorf("unexpected table record: %+v", record)
+	}
+
+	if _, found, _ := db.Lookup(net.ParseIP("9.9.9.9")); found {
+		t.Error("expected no data for 9.9.9.9")
+	}
+}
+
+func TestGeoIPDatabase_Empty(t *testing.T) {
+	var db *GeoIPDatabase
+	if !db.Empty() {
+		t.Error("nil database should be empty")
+	}
+	if _, found, err := db.Lookup(net.ParseIP("8.8.8.8")); found || err != nil {
+		t.Errorf("nil database lookup = %v, %v", found, err)
+	}
+
+	if _, err := OpenGeoIPDatabase(filepath.Join(t.TempDir(), "missing.mmdb"), "", ""); err == nil {
+		t.Error("expected error for missing MMDB file")
+	}
+}
+
+func TestASNTable_Lookup(t *testing.T) {
+	table, err := LoadASNTable(testASNTable(t))
+	if err != nil {
+		t.Fatalf("LoadASNTable failed: %v", err)
+	}
+	if table.Len() != 2 {
+		t.Fatalf("expected 2 routed ranges, got %d", table.Len())
+	}
+
+	tests := []struct {
+		ip      string
+		wantASN uint
+		found   bool
+	}{
+		{"1.0.0.1", 13335, true},
+		{"1.0.0.255", 13335, true},
+		{"1.0.2.1", 0, false}, // Not routed
+		{"8.8.8.8", 15169, true},
+		{"8.8.9.1", 0, false},
+		{"0.0.0.1", 0, false},
+		{"2001:db8::1", 0, false},
+	}
+
+	for _, tt := range tests {
+		entry, ok := table.Lookup(net.ParseIP(tt.ip))
+		if ok != tt.found || entry.ASN != tt.wantASN {
+			t.Errorf("Lookup(%s) = AS%d, %v; want AS%d, %v", tt.ip, entry.ASN, ok, tt.wantASN, tt.found)
+		}
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.tsv")
+	os.WriteFile(bad, []byte("1.0.0.0\t1.0.0.255\tnot-a-number\n"), 0o600)
+	if _, err := LoadASNTable(bad); err == nil {
+		t.Error("expected error for malformed ASN column")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 // HTTPClient is a secure HTTP client with configurable timeouts and redirect handling.
 type HTTPClient struct {
 	client    *http.Client
+	transport http.RoundTripper // Live transport, wrapped when a cassette is set
 	userAgent string
 	logger    *logger.Logger
 }
@@ -33,26 +35,33 @@ type HTTPResponse struct {
 
 // NewHTTPClient creates and initializes a new HTTPClient.
 func NewHTTPClient(logger *logger.Logger) *HTTPClient {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: false, // Always verify TLS certificates
+			MinVersion:         tls.VersionTLS12,
+		},
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true, // Enable HTTP/2 where available
+	}
 	return &HTTPClient{
 		client: &http.Client{
 			// No CheckRedirect function here, as redirects are handled by RedirectTracer
-			Timeout: 30 * time.Second, // Default timeout for single requests
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: false, // Always verify TLS certificates
-					MinVersion:         tls.VersionTLS12,
-				},
-				MaxIdleConns:        100,
-				IdleConnTimeout:     90 * time.Second,
-				TLSHandshakeTimeout: 10 * time.Second,
-				ForceAttemptHTTP2:   true, // Enable HTTP/2 where available
-			},
+			Timeout:   30 * time.Second, // Default timeout for single requests
+			Transport: transport,
 		},
+		transport: transport,
 		userAgent: "Mozilla/5.0 (compatible; NetZilla-Security-Scanner/2.1; +https://netzilla.io)",
 		logger:    logger,
 	}
 }
 
+// SetCassette records or replays every response through c; nil restores the live transport.
+func (hc *HTTPClient) SetCassette(c *Cassette) {
+	hc.client.Transport = c.Transport(hc.transport)
+}
+
 // SafeHeadRequest performs a HEAD request to the target URL.
 func (hc *HTTPClient) SafeHeadRequest(ctx context.Context, targetURL string) (*HTTPResponse, error) {
 	return hc.safeRequest(ctx, "HEAD", targetURL)
@@ -146,7 +155,14 @@ func (hc *HTTPClient) CheckSecurityHeaders(ctx context.Context, targetURL string
 		"X-XSS-Protection":          5, // Less critical now, but still useful
 	}
 
-	for header, headerScore := range importantHeaders {
+	headerNames := make([]string, 0, len(importantHeaders))
+	for header := range importantHeaders {
+		headerNames = append(headerNames, header)
+	}
+	sort.Strings(headerNames) // stable output, so replayed runs compare equal
+
+	for _, header := range headerNames {
+		headerScore := importantHeaders[header]
 		if value := resp.Headers[header]; value != "" {
 			presentHeaders = append(presentHeaders, fmt.Sprintf("%s: %s", header, value))
 			score += headerScore
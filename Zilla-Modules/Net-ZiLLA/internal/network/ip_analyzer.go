@@ -18,9 +18,16 @@ type IPAnalyzer struct {
 	logger    *logger.Logger
 	dnsClient *DNSClient
 	client    *http.Client
+	resolver  *net.Resolver // Resolves hostnames passed instead of addresses
+
+	geoDB          *GeoIPDatabase
+	cidrLists      *CIDRLists
+	onlineFallback bool              // Query ip-api.com / Team Cymru when offline sources have no answer
+	cymru          *CymruASNResolver // Used for ASN lookups only when onlineFallback is set
 }
 
-// NewIPAnalyzer creates and initializes a new IPAnalyzer.
+// NewIPAnalyzer creates and initializes a new IPAnalyzer. Without offline sources or
+// SetOnlineFallback(true), lookups only report public/reserved classification.
 func NewIPAnalyzer(logger *logger.Logger) *IPAnalyzer {
 	return &IPAnalyzer{
 		logger:    logger,
@@ -28,10 +35,41 @@ func NewIPAnalyzer(logger *logger.Logger) *IPAnalyzer {
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		resolver:  net.DefaultResolver,
+		cidrLists: NewCIDRLists(),
+		cymru:     NewCymruASNResolver(),
 	}
 }
 
-// GetGeolocation performs IP geolocation using ip-api.com.
+// SetGeoIPDatabase sets the offline geolocation/ASN sources.
+func (ipa *IPAnalyzer) SetGeoIPDatabase(db *GeoIPDatabase) {
+	ipa.geoDB = db
+}
+
+// SetCIDRLists sets the hosting/VPN/Tor exit ranges.
+func (ipa *IPAnalyzer) SetCIDRLists(lists *CIDRLists) {
+	ipa.cidrLists = lists
+}
+
+// SetOnlineFallback enables online lookups when offline sources have no answer.
+func (ipa *IPAnalyzer) SetOnlineFallback(enabled bool) {
+	ipa.onlineFallback = enabled
+}
+
+// SetCassette records or replays hostname resolution, ip-api.com responses and
+// Team Cymru lookups through c; nil restores live lookups.
+func (ipa *IPAnalyzer) SetCassette(c *Cassette) {
+	ipa.client.Transport = c.Transport(nil)
+	ipa.dnsClient.SetCassette(c)
+	ipa.resolver = net.DefaultResolver
+	if r := c.Resolver(""); r != nil {
+		ipa.resolver = r
+	}
+	ipa.cymru.resolver = ipa.resolver
+}
+
+// GetGeolocation geolocates an IP (or resolvable host) from the offline databases,
+// falling back to ip-api.com only when online lookups are enabled.
 func (ipa *IPAnalyzer) GetGeolocation(ctx context.Context, ip string) (*models.GeoAnalysis, error) {
 	analysis := &models.GeoAnalysis{
 		IP: ip,
@@ -41,7 +79,7 @@ func (ipa *IPAnalyzer) GetGeolocation(ctx context.Context, ip string) (*models.G
 	parsedIP := net.ParseIP(ip)
 	if parsedIP == nil {
 		// If not an IP, try to resolve it
-		ips, err := net.LookupIP(ip)
+		ips, err := ipa.resolver.LookupIP(ctx, "ip", ip)
 		if err != nil || len(ips) == 0 {
 			return nil, fmt.Errorf("invalid IP address or unresolvable host: %s", ip)
 		}
@@ -50,44 +88,126 @@ func (ipa *IPAnalyzer) GetGeolocation(ctx context.Context, ip string) (*models.G
 		analysis.IP = ip
 	}
 
-	// Geolocation using ip-api.com (Free for non-commercial)
-	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=status,message,country,city,isp,as,lat,lon,proxy", ip)
+	analysis.IsPublic = isPublicIP(parsedIP)
+	analysis.IsReserved = isReservedIP(parsedIP)
+
+	located := false
+	if analysis.IsPublic && !analysis.IsReserved {
+		record, found, err := ipa.geoDB.Lookup(parsedIP)
+		if err != nil {
+			ipa.logger.Warn("Offline geolocation lookup failed for %s: %v", ip, err)
+		} else if found {
+			applyGeoIPRecord(analysis, record)
+			located = record.HasLocation()
+		}
+
+		if !located {
+			if ipa.onlineFallback {
+				ipa.lookupOnline(ctx, ip, analysis)
+			} else {
+				analysis.Warnings = append(analysis.Warnings, "No offline geolocation data for this address; online lookup disabled")
+			}
+		}
+	}
+
+	if match, ok := ipa.cidrLists.Lookup(parsedIP); ok {
+		analysis.HostingType = match.Category.HostingType()
+		if match.Category.IsAnonymizing() {
+			analysis.IsProxy = true
+		}
+		if match.Label != "" {
+			analysis.Warnings = append(analysis.Warnings,
+				fmt.Sprintf("Address is in %s range %s (%s)", match.Category.HostingType(), match.Prefix, match.Label))
+		}
+	} else {
+		analysis.HostingType = ipa.detectHostingType(analysis)
+	}
+
+	return analysis, nil
+}
+
+func applyGeoIPRecord(analysis *models.GeoAnalysis, record *GeoIPRecord) {
+	analysis.Country = record.Country
+	if analysis.Country == "" {
+		analysis.Country = record.CountryCode
+	}
+	analysis.CountryCode = record.CountryCode
+	analysis.City = record.City
+	analysis.Region = record.Region
+	analysis.Latitude = record.Latitude
+	analysis.Longitude = record.Longitude
+	analysis.ASN = record.ASNString()
+	analysis.ISP = record.ASOrg
+	analysis.IsProxy = record.IsProxy
+}
+
+// lookupOnline queries ip-api.com (free for non-commercial use). Only fields the
+// offline sources left empty are filled.
+func (ipa *IPAnalyzer) lookupOnline(ctx context.Context, ip string, analysis *models.GeoAnalysis) {
+	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=status,message,country,countryCode,regionName,city,isp,as,lat,lon,proxy", ip)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, err
+		return
 	}
 
 	resp, err := ipa.client.Do(req)
 	if err != nil {
 		ipa.logger.Warn("Geolocation lookup failed for %s: %v", ip, err)
-	} else {
-		defer resp.Body.Close()
-		var result struct {
-			Status  string  `json:"status"`
-			Country string  `json:"country"`
-			City    string  `json:"city"`
-			ISP     string  `json:"isp"`
-			AS      string  `json:"as"`
-			Lat     float64 `json:"lat"`
-			Lon     float64 `json:"lon"`
-			Proxy   bool    `json:"proxy"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.Status == "success" {
-			analysis.Country = result.Country
-			analysis.City = result.City
-			analysis.ISP = result.ISP
-			analysis.ASN = result.AS
-			analysis.Latitude = result.Lat
-			analysis.Longitude = result.Lon
-			analysis.IsProxy = result.Proxy
-		}
+		return
 	}
+	defer resp.Body.Close()
 
-	analysis.IsPublic = isPublicIP(parsedIP)
-	analysis.IsReserved = isReservedIP(parsedIP)
-	analysis.HostingType = ipa.detectHostingType(analysis)
+	var result struct {
+		Status      string  `json:"status"`
+		Country     string  `json:"country"`
+		CountryCode string  `json:"countryCode"`
+		Region      string  `json:"regionName"`
+		City        string  `json:"city"`
+		ISP         string  `json:"isp"`
+		AS          string  `json:"as"`
+		Lat         float64 `json:"lat"`
+		Lon         float64 `json:"lon"`
+		Proxy       bool    `json:"proxy"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Status != "success" {
+		return
+	}
 
-	return analysis, nil
+	analysis.Country = result.Country
+	analysis.CountryCode = result.CountryCode
+	analysis.Region = result.Region
+	analysis.City = result.City
+	analysis.Latitude = result.Lat
+	analysis.Longitude = result.Lon
+	analysis.IsProxy = analysis.IsProxy || result.Proxy
+	if analysis.ISP == "" {
+		analysis.ISP = result.ISP
+	}
+	if analysis.ASN == "" {
+		analysis.ASN = result.AS
+	}
+}
+
+// LookupASN implements ASNResolver from the offline sources, using Team Cymru only
+// when online lookups are enabled.
+func (ipa *IPAnalyzer) LookupASN(ctx context.Context, ip string) (*ASNInfo, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	record, found, err := ipa.geoDB.Lookup(parsed)
+	if err != nil {
+		return nil, err
+	}
+	if found && record.ASN != 0 {
+		return &ASNInfo{ASN: record.ASNString(), Prefix: record.Prefix, Country: record.CountryCode}, nil
+	}
+
+	if ipa.onlineFallback {
+		return ipa.cymru.LookupASN(ctx, ip)
+	}
+	return nil, fmt.Errorf("no offline ASN data for %s", ip)
 }
 
 func isPublicIP(ip net.IP) bool {
@@ -126,8 +246,8 @@ func (ipa *IPAnalyzer) detectHostingType(analysis *models.GeoAnalysis) string {
 	hostingKeywords := []string{"cloud", "host", "server", "data center", "amazon", "google", "microsoft", "digitalocean", "linode", "akamai"}
 	for _, keyword := range hostingKeywords {
 		if strings.Contains(ispLower, keyword) {
-			return "Hosting Provider"
+			return HostingTypeHosting
 		}
 	}
-	return "ISP/Residential"
+	return HostingTypeResidential
 }
@@ -1,10 +1,12 @@
 package network
 
 import (
+	"context"
 	"net"
 	"testing"
 
 	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
 )
 
 func TestIsPublicIP(t *testing.T) {
@@ -68,3 +70,54 @@ func TestDetectHostingType(t *testing.T) {
 		}
 	}
 }
+
+func TestGetGeolocation_Offline(t *testing.T) {
+	db, err := OpenGeoIPDatabase(testCityDB(t), testASNDB(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	lists := NewCIDRLists()
+	lists.Add(CIDRCategoryTorExit, "81.2.69.142", "test exit")
+	lists.Add(CIDRCategoryHosting, "81.2.69.0/24", "test cloud")
+
+	ipa := NewIPAnalyzer(logger.NewLogger())
+	ipa.SetGeoIPDatabase(db)
+	ipa.SetCIDRLists(lists)
+
+	tests := []struct {
+		ip          string
+		wantCountry string
+		wantType    string
+		wantProxy   bool
+		wantWarning bool
+	}{
+		{"81.2.69.142", "United Kingdom", HostingTypeTorExit, true, true},
+		{"81.2.69.1", "United Kingdom", HostingTypeHosting, false, true},
+		{"9.9.9.9", "", HostingTypeResidential, false, true}, // No data, online lookups disabled
+		{"10.0.0.1", "", HostingTypeResidential, false, false},
+	}
+
+	for _, tt := range tests {
+		geo, err := ipa.GetGeolocation(context.Background(), tt.ip)
+		if err != nil {
+			t.Fatalf("GetGeolocation(%s) failed: %v", tt.ip, err)
+		}
+		if geo.Country != tt.wantCountry || geo.HostingType != tt.wantType || geo.IsProxy != tt.wantProxy {
+			t.Errorf("GetGeolocation(%s) = country %q type %q proxy %v; want %q %q %v",
+				tt.ip, geo.Country, geo.HostingType, geo.IsProxy, tt.wantCountry, tt.wantType, tt.wantProxy)
+		}
+		if (len(geo.Warnings) > 0) != tt.wantWarning {
+			t.Errorf("GetGeolocation(%s) warnings = %v", tt.ip, geo.Warnings)
+		}
+	}
+
+	info, err := ipa.LookupASN(context.Background(), "81.2.69.142")
+	if err != nil || info.ASN != "AS20712 Andrews & Arnold Ltd" || info.Country != "GB" {
+		t.Errorf("LookupASN = %+v, %v", info, err)
+	}
+	if _, err := ipa.LookupASN(context.Background(), "9.9.9.9"); err == nil {
+		t.Error("expected offline-only ASN lookup to fail without data")
+	}
+}
@@ -2,35 +2,184 @@ package network
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"syscall"
 	"time"
 
+	"golang.org/x/time/rate"
+
 	"net-zilla/pkg/logger"
 )
 
+// Port states reported in ScanResult.State.
+const (
+	PortOpen         = "open"
+	PortOpenFiltered = "open|filtered" // UDP port that neither answered nor refused
+)
+
 type PortScanner struct {
-	logger  *logger.Logger
-	timeout time.Duration
-	workers int
+	logger   *logger.Logger
+	timeout  time.Duration
+	workers  int
+	detector *ServiceDetector
+
+	// Per-target packet budget so profiles do not flood a single host.
+	// Limiters exist only while a scan of their target is running.
+	rateLimit rate.Limit
+	rateBurst int
+	limiters  map[string]*targetLimiter
+	mu        sync.Mutex
+}
+
+// targetLimiter is the probe budget of one target, shared by its running scans.
+type targetLimiter struct {
+	*rate.Limiter
+	scans int
 }
 
 func NewPortScanner(logger *logger.Logger) *PortScanner {
 	return &PortScanner{
-		logger:  logger,
-		timeout: 1 * time.Second,
-		workers: 100,
+		logger:    logger,
+		timeout:   1 * time.Second,
+		workers:   100,
+		detector:  NewServiceDetector(),
+		rateLimit: 200,
+		rateBurst: 50,
+		limiters:  make(map[string]*targetLimiter),
+	}
+}
+
+// SetRateLimit sets the per-target probe rate; perSecond <= 0 disables limiting.
+func (ps *PortScanner) SetRateLimit(perSecond float64, burst int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if perSecond <= 0 {
+		ps.rateLimit = rate.Inf
+	} else {
+		ps.rateLimit = rate.Limit(perSecond)
+	}
+	if burst > 0 {
+		ps.rateBurst = burst
+	}
+	ps.limiters = make(map[string]*targetLimiter)
+}
+
+// Detector returns the service detector used for profile scans.
+func (ps *PortScanner) Detector() *ServiceDetector {
+	return ps.detector
+}
+
+// limiter returns the probe budget of target for a scan, and a function the
+// scan calls when it finishes. The budget is dropped once no scan of target is
+// running, so a long-lived scanner does not keep one for every host it saw.
+func (ps *PortScanner) limiter(target string) (*rate.Limiter, func()) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	l, ok := ps.limiters[target]
+	if !ok {
+		l = &targetLimiter{Limiter: rate.NewLimiter(ps.rateLimit, ps.rateBurst)}
+		ps.limiters[target] = l
+	}
+	l.scans++
+	return l.Limiter, func() {
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		l.scans--
+		if l.scans == 0 && ps.limiters[target] == l {
+			delete(ps.limiters, target)
+		}
 	}
 }
 
 type ScanResult struct {
-	Port    int
-	Open    bool
-	Service string
+	Port     int          `json:"port"`
+	Protocol string       `json:"protocol"`
+	Open     bool         `json:"open"`
+	State    string       `json:"state"`
+	Service  string       `json:"service,omitempty"` // ServiceInfo.String() when detection ran
+	Info     *ServiceInfo `json:"info,omitempty"`
 }
 
+// Scan performs a TCP connect scan and returns the open ports in ascending order.
+// Cancelling ctx stops outstanding work; results gathered so far are returned.
 func (ps *PortScanner) Scan(ctx context.Context, target string, ports []int) []ScanResult {
+	limiter, done := ps.limiter(target)
+	defer done()
+	return ps.runWorkers(ctx, ports, func(ctx context.Context, port int) *ScanResult {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil
+		}
+		dialer := net.Dialer{Timeout: ps.timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target, fmt.Sprintf("%d", port)))
+		if err != nil {
+			return nil
+		}
+		conn.Close()
+		return &ScanResult{Port: port, Protocol: "tcp", Open: true, State: PortOpen}
+	})
+}
+
+// ScanUDP probes UDP ports with protocol-specific payloads. Ports that answer are open;
+// silent ports are reported as open|filtered and ports refusing via ICMP are omitted.
+func (ps *PortScanner) ScanUDP(ctx context.Context, target string, ports []int) []ScanResult {
+	limiter, done := ps.limiter(target)
+	defer done()
+	return ps.runWorkers(ctx, ports, func(ctx context.Context, port int) *ScanResult {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil
+		}
+		info, answered, err := ps.detector.DetectUDP(ctx, target, port)
+		switch {
+		case answered:
+			return &ScanResult{Port: port, Protocol: "udp", Open: true, State: PortOpen, Service: info.String(), Info: &info}
+		case err == nil && ctx.Err() == nil:
+			return &ScanResult{Port: port, Protocol: "udp", State: PortOpenFiltered}
+		case err != nil && !errors.Is(err, syscall.ECONNREFUSED) && ctx.Err() == nil:
+			ps.logger.Debug("UDP probe to %s:%d failed: %v", target, port, err)
+		}
+		return nil
+	})
+}
+
+// ScanProfile runs the TCP and UDP parts of a profile and, when the profile asks for
+// it, identifies the services on open TCP ports.
+func (ps *PortScanner) ScanProfile(ctx context.Context, target string, profile *ScanProfile) []ScanResult {
+	ps.logger.Info("Scanning %s with profile %s (%d TCP, %d UDP ports)", target, profile.Name, len(profile.TCPPorts), len(profile.UDPPorts))
+
+	results := ps.Scan(ctx, target, profile.TCPPorts)
+	if profile.DetectServices {
+		// Service probes open several connections per port; keep that concurrency modest.
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, 10)
+		for i := range results {
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(r *ScanResult) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				info := ps.detector.Detect(ctx, target, r.Port)
+				r.Info = &info
+				r.Service = info.String()
+			}(&results[i])
+		}
+		wg.Wait()
+	}
+
+	if len(profile.UDPPorts) > 0 {
+		results = append(results, ps.ScanUDP(ctx, target, profile.UDPPorts)...)
+	}
+	sortResults(results)
+	return results
+}
+
+// runWorkers fans ports out to the worker pool and collects non-nil results.
+func (ps *PortScanner) runWorkers(ctx context.Context, ports []int, probe func(context.Context, int) *ScanResult) []ScanResult {
 	var results []ScanResult
 	var wg sync.WaitGroup
 
@@ -43,11 +192,11 @@ func (ps *PortScanner) Scan(ctx context.Context, target string, ports []int) []S
 		go func() {
 			defer wg.Done()
 			for port := range portsChan {
-				address := net.JoinHostPort(target, fmt.Sprintf("%d", port))
-				conn, err := net.DialTimeout("tcp", address, ps.timeout)
-				if err == nil {
-					conn.Close()
-					resultsChan <- ScanResult{Port: port, Open: true}
+				if ctx.Err() != nil {
+					continue
+				}
+				if res := probe(ctx, port); res != nil {
+					resultsChan <- *res
 				}
 			}
 		}()
@@ -55,10 +204,14 @@ func (ps *PortScanner) Scan(ctx context.Context, target string, ports []int) []S
 
 	// Send ports to scan
 	go func() {
+		defer close(portsChan)
 		for _, port := range ports {
-			portsChan <- port
+			select {
+			case portsChan <- port:
+			case <-ctx.Done():
+				return
+			}
 		}
-		close(portsChan)
 	}()
 
 	// Close results channel when done
@@ -71,5 +224,6 @@ func (ps *PortScanner) Scan(ctx context.Context, target string, ports []int) []S
 		results = append(results, res)
 	}
 
+	sortResults(results)
 	return results
 }
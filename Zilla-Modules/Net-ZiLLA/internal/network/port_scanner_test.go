@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"testing"
+	"time"
 
 	"net-zilla/pkg/logger"
 )
@@ -46,3 +47,94 @@ func TestPortScanner_Scan(t *testing.T) {
 		t.Errorf("did not find result for port %d", port)
 	}
 }
+
+func TestPortScanner_ScanCancelled(t *testing.T) {
+	ps := NewPortScanner(logger.NewLogger())
+	ps.SetRateLimit(1, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	ports := make([]int, 0, 1000)
+	for p := 20000; p < 21000; p++ {
+		ports = append(ports, p)
+	}
+
+	start := time.Now()
+	ps.Scan(ctx, "127.0.0.1", ports)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("scan ignored cancellation, took %v", elapsed)
+	}
+}
+
+func TestPortScanner_RateLimit(t *testing.T) {
+	ps := NewPortScanner(logger.NewLogger())
+	ps.SetRateLimit(20, 1)
+
+	ports := make([]int, 0, 10)
+	for p := 20000; p < 20010; p++ {
+		ports = append(ports, p)
+	}
+
+	// 10 probes at 20/s with a burst of 1 need at least ~450ms.
+	start := time.Now()
+	ps.Scan(context.Background(), "127.0.0.1", ports)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("rate limit not applied, 10 probes took %v", elapsed)
+	}
+
+	// Limiters are per target; another host starts with a fresh budget.
+	a, doneA := ps.limiter("127.0.0.1")
+	b, doneB := ps.limiter("127.0.0.2")
+	if a == b {
+		t.Error("expected separate limiters per target")
+	}
+	// Concurrent scans of a target share its limiter until the last finishes.
+	again, doneAgain := ps.limiter("127.0.0.1")
+	if again != a {
+		t.Error("expected scans of the same target to share a limiter")
+	}
+	doneA()
+	doneAgain()
+	doneB()
+	if n := len(ps.limiters); n != 0 {
+		t.Errorf("%d limiters kept after every scan finished", n)
+	}
+}
+
+func TestPortScanner_ScanProfile(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(conn, "SSH-2.0-dropbear_2022.83\r\n")
+			conn.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	ps := NewPortScanner(logger.NewLogger())
+	profile, err := ScanProfileByName(fmt.Sprintf("%d", port))
+	if err != nil {
+		t.Fatalf("ScanProfileByName: %v", err)
+	}
+
+	results := ps.ScanProfile(context.Background(), "127.0.0.1", profile)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %+v", results)
+	}
+	r := results[0]
+	if r.Protocol != "tcp" || r.State != PortOpen || r.Info == nil {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	if r.Info.Name != "ssh" || r.Info.Product != "Dropbear sshd" || r.Info.Version != "2022.83" {
+		t.Errorf("unexpected service %+v", r.Info)
+	}
+}
@@ -3,6 +3,7 @@ package network
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -16,32 +17,63 @@ import (
 
 // RedirectTracer traces URL redirect chains and analyzes them for potential threats.
 type RedirectTracer struct {
-	logger  *logger.Logger
-	maxHops int
-	timeout time.Duration
+	logger       *logger.Logger
+	maxHops      int
+	maxBodyBytes int64 // Per-hop cap on body bytes scanned for client-side redirects
+	maxBytes     int64 // Per-chain cap across all hops
+	timeout      time.Duration
+	transport    http.RoundTripper // nil uses http.DefaultTransport
 }
 
 // NewRedirectTracer creates and initializes a new RedirectTracer.
 func NewRedirectTracer(logger *logger.Logger) *RedirectTracer {
 	return &RedirectTracer{
-		logger:  logger,
-		maxHops: 10, // Default max 10 redirects
-		timeout: 30 * time.Second,
+		logger:       logger,
+		maxHops:      10, // Default max 10 redirects
+		maxBodyBytes: 512 * 1024,
+		maxBytes:     2 * 1024 * 1024,
+		timeout:      30 * time.Second,
 	}
 }
 
+// SetMaxHops limits the number of requests made for one chain.
+func (rt *RedirectTracer) SetMaxHops(hops int) {
+	if hops > 0 {
+		rt.maxHops = hops
+	}
+}
+
+// SetByteBudget limits the body bytes read per hop and across the whole chain.
+func (rt *RedirectTracer) SetByteBudget(perHop, perChain int64) {
+	if perHop > 0 {
+		rt.maxBodyBytes = perHop
+	}
+	if perChain > 0 {
+		rt.maxBytes = perChain
+	}
+}
+
+// SetCassette records or replays every hop's response through c; nil disables it.
+func (rt *RedirectTracer) SetCassette(c *Cassette) {
+	rt.transport = c.Transport(nil)
+}
+
 // TraceRedirects traces the full redirect chain of a given URL, analyzing each step for threats.
+// Besides HTTP Location headers it follows Refresh headers, meta refresh tags, literal
+// JavaScript location changes and single-frame shell pages, without executing scripts.
 func (rt *RedirectTracer) TraceRedirects(ctx context.Context, startURL string) ([]models.RedirectDetail, int, error) {
 	var redirects []models.RedirectDetail
 	currentURL := startURL
 	visited := make(map[string]bool)
 	threatScore := 0
+	var bytesRead int64
 
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse // Don't follow automatically, we handle redirects manually
 		},
-		Timeout: rt.timeout,
+		Timeout:   rt.timeout,
+		Transport: rt.transport,
 	}
 
 	for hop := 0; hop < rt.maxHops; hop++ {
@@ -95,7 +127,6 @@ func (rt *RedirectTracer) TraceRedirects(ctx context.Context, startURL string) (
 			})
 			break
 		}
-		defer resp.Body.Close()
 
 		// Extract redirect information
 		redirectDetail := models.RedirectDetail{
@@ -103,7 +134,7 @@ func (rt *RedirectTracer) TraceRedirects(ctx context.Context, startURL string) (
 			StatusCode: resp.StatusCode,
 			Location:   resp.Header.Get("Location"),
 			Headers:    make(map[string]string),
-			Duration:   time.Since(startTime),
+			HopNumber:  hop + 1,
 		}
 
 		// Capture important headers
@@ -131,24 +162,57 @@ func (rt *RedirectTracer) TraceRedirects(ctx context.Context, startURL string) (
 			})
 		}
 
+		// An HTTP redirect needs no body; anything else is scanned for a client-side one.
+		base := currentURL
+		budgetExhausted := false
+		if isHTTPRedirect(resp.StatusCode) && redirectDetail.Location != "" {
+			redirectDetail.Mechanism = models.RedirectHTTP
+		} else {
+			var body []byte
+			body, budgetExhausted = rt.readBody(resp, &redirectDetail, rt.maxBytes-bytesRead)
+			bytesRead += int64(len(body))
+			redirectDetail.ContentSimhash = ContentSimhash(body)
+			if cr := findClientRedirect(resp.Header, body); cr != nil {
+				redirectDetail.Location = cr.Target
+				redirectDetail.Mechanism = cr.Mechanism
+				base = documentBase(currentURL, body)
+			}
+		}
+		resp.Body.Close()
+		redirectDetail.Duration = time.Since(startTime)
+
 		redirects = append(redirects, redirectDetail)
 
 		// Analyze redirect for threats
-		threatScore += rt.analyzeRedirectThreat(&redirectDetail, hop+1, redirects) // Pass redirects for domain comparison
+		threatScore += rt.analyzeRedirectThreat(&redirects[len(redirects)-1], hop+1, redirects) // Pass redirects for domain comparison
 
 		// Check if we've reached final destination (no more redirects or client error)
-		if redirectDetail.StatusCode < 300 || redirectDetail.StatusCode >= 400 || redirectDetail.Location == "" {
+		if redirectDetail.Mechanism == "" {
+			break
+		}
+		if budgetExhausted {
+			rt.logger.Warn("Redirect chain for %s stopped after %d bytes", startURL, bytesRead)
 			break
 		}
 
 		// Resolve next URL
-		nextURL, err := rt.resolveNextURL(currentURL, redirectDetail.Location)
+		nextURL, err := rt.resolveNextURL(base, redirectDetail.Location)
 		if err != nil {
 			rt.logger.Warn("Failed to resolve next URL for %s from location %s: %v", currentURL, redirectDetail.Location, err)
 			threatScore += 10 // Penalty for unresolvable redirect
 			break
 		}
+		// data:, javascript: and similar targets are scored above but cannot be fetched.
+		if scheme := strings.ToLower(strings.SplitN(nextURL, ":", 2)[0]); scheme != "http" && scheme != "https" {
+			break
+		}
 
+		if hop+1 == rt.maxHops {
+			last := &redirects[len(redirects)-1]
+			last.Warnings = append(last.Warnings, fmt.Sprintf("Redirect hop budget of %d exhausted before reaching %s", rt.maxHops, nextURL))
+			threatScore += 10
+			rt.logger.Warn("Redirect chain for %s exceeded %d hops", startURL, rt.maxHops)
+		}
 		currentURL = nextURL
 	}
 
@@ -158,6 +222,40 @@ func (rt *RedirectTracer) TraceRedirects(ctx context.Context, startURL string) (
 	return redirects, threatScore, nil
 }
 
+// readBody reads up to the per-hop limit, or less when the chain budget is nearly spent.
+// It reports whether the chain budget cut the read short.
+func (rt *RedirectTracer) readBody(resp *http.Response, detail *models.RedirectDetail, remaining int64) ([]byte, bool) {
+	limit := rt.maxBodyBytes
+	chainLimited := false
+	if remaining < limit {
+		limit, chainLimited = remaining, true
+	}
+	if limit <= 0 {
+		detail.Warnings = append(detail.Warnings, fmt.Sprintf("Response body not inspected: chain byte budget of %d exhausted", rt.maxBytes))
+		return nil, true
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		rt.logger.Warn("Failed to read response body from %s: %v", detail.URL, err)
+	}
+	truncated := int64(len(body)) > limit
+	if truncated {
+		body = body[:limit]
+		if chainLimited {
+			detail.Warnings = append(detail.Warnings, fmt.Sprintf("Response body truncated: chain byte budget of %d exhausted", rt.maxBytes))
+		} else {
+			detail.Warnings = append(detail.Warnings, fmt.Sprintf("Response body truncated at %d bytes", limit))
+		}
+	}
+	detail.BodyBytes = int64(len(body))
+	return body, truncated && chainLimited
+}
+
+func isHTTPRedirect(status int) bool {
+	return status >= 300 && status < 400
+}
+
 // resolveNextURL resolves relative or absolute redirect URLs.
 func (rt *RedirectTracer) resolveNextURL(baseURL, location string) (string, error) {
 	base, err := url.Parse(baseURL)
@@ -220,6 +318,19 @@ func (rt *RedirectTracer) analyzeRedirectThreat(redirect *models.RedirectDetail,
 		}
 	}
 
+	// Client-side redirects hide the next hop from tools that only follow Location headers
+	switch redirect.Mechanism {
+	case models.RedirectJavaScript:
+		score += 10
+		redirect.Warnings = append(redirect.Warnings, "JavaScript redirect to "+redirect.Location)
+	case models.RedirectFrame:
+		score += 10
+		redirect.Warnings = append(redirect.Warnings, "Page only frames "+redirect.Location)
+	case models.RedirectMetaRefresh, models.RedirectRefreshHeader:
+		score += 5
+		redirect.Warnings = append(redirect.Warnings, "Refresh redirect to "+redirect.Location)
+	}
+
 	// Check for URL obfuscation (e.g., excessive encoding, many subdomains, IP as host)
 	if isObfuscatedURL(redirect.Location) {
 		score += 20
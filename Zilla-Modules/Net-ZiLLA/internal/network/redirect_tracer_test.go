@@ -2,6 +2,7 @@ package network
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -110,3 +111,115 @@ func TestAnalyzeRedirectChain(t *testing.T) {
 		t.Errorf("expected 1 suspicious URL, got %d", analysis.SuspiciousURLs)
 	}
 }
+
+func TestTraceRedirects_ClientSide(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/a/meta", http.StatusFound)
+		case "/a/meta":
+			// Relative to the <base>, not to /a/
+			fmt.Fprint(w, `<head><base href="/b/"><meta http-equiv="refresh" content="0;url=js"></head>`)
+		case "/b/js":
+			fmt.Fprint(w, `<script>window.location = "../frame";</script>`)
+		case "/frame":
+			fmt.Fprintf(w, `<body><iframe src="%s/final"></iframe></body>`, ts.URL)
+		case "/final":
+			fmt.Fprint(w, `<h1>done</h1>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	rt := NewRedirectTracer(logger.NewLogger())
+	redirects, _, err := rt.TraceRedirects(context.Background(), ts.URL+"/start")
+	if err != nil {
+		t.Fatalf("TraceRedirects failed: %v", err)
+	}
+
+	want := []struct {
+		path      string
+		mechanism models.RedirectMechanism
+	}{
+		{"/start", models.RedirectHTTP},
+		{"/a/meta", models.RedirectMetaRefresh},
+		{"/b/js", models.RedirectJavaScript},
+		{"/frame", models.RedirectFrame},
+		{"/final", ""},
+	}
+	if len(redirects) != len(want) {
+		for _, r := range redirects {
+			t.Logf("%s %s -> %s %v", r.URL, r.Mechanism, r.Location, r.Warnings)
+		}
+		t.Fatalf("expected %d hops, got %d", len(want), len(redirects))
+	}
+	for i, w := range want {
+		if redirects[i].URL != ts.URL+w.path || redirects[i].Mechanism != w.mechanism {
+			t.Errorf("hop %d = %s (%s), want %s (%s)", i+1, redirects[i].URL, redirects[i].Mechanism, ts.URL+w.path, w.mechanism)
+		}
+		if redirects[i].HopNumber != i+1 {
+			t.Errorf("hop %d numbered %d", i+1, redirects[i].HopNumber)
+		}
+	}
+}
+
+func TestTraceRedirects_Budgets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		var n int
+		fmt.Sscanf(r.URL.Path, "/%d", &n)
+		// Padding before the redirect so the body budget matters.
+		fmt.Fprintf(w, "<!-- %s --><script>location.href = '/%d'</script>", strings.Repeat("x", 1000), n+1)
+	}))
+	defer ts.Close()
+
+	t.Run("hop budget", func(t *testing.T) {
+		rt := NewRedirectTracer(logger.NewLogger())
+		rt.SetMaxHops(3)
+		redirects, _, err := rt.TraceRedirects(context.Background(), ts.URL+"/0")
+		if err != nil {
+			t.Fatalf("TraceRedirects failed: %v", err)
+		}
+		if len(redirects) != 3 {
+			t.Fatalf("expected 3 hops, got %d", len(redirects))
+		}
+		if !hasWarning(redirects[2].Warnings, "hop budget") {
+			t.Errorf("expected hop budget warning, got %v", redirects[2].Warnings)
+		}
+	})
+
+	t.Run("byte budget", func(t *testing.T) {
+		rt := NewRedirectTracer(logger.NewLogger())
+		rt.SetByteBudget(0, 2500)
+		redirects, _, err := rt.TraceRedirects(context.Background(), ts.URL+"/0")
+		if err != nil {
+			t.Fatalf("TraceRedirects failed: %v", err)
+		}
+		// Two full pages fit; the third is cut off before its script.
+		if len(redirects) != 3 {
+			t.Fatalf("expected 3 hops, got %d", len(redirects))
+		}
+		var total int64
+		for _, r := range redirects {
+			total += r.BodyBytes
+		}
+		if total > 2500 {
+			t.Errorf("read %d bytes, budget was 2500", total)
+		}
+		if !hasWarning(redirects[2].Warnings, "chain byte budget") {
+			t.Errorf("expected byte budget warning, got %v", redirects[2].Warnings)
+		}
+	})
+}
+
+func hasWarning(warnings []string, substr string) bool {
+	for _, w := range warnings {
+		if strings.Contains(w, substr) {
+			return true
+		}
+	}
+	return false
+}
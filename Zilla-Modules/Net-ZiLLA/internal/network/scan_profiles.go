@@ -0,0 +1,155 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ScanProfile is a named set of TCP and UDP ports.
+type ScanProfile struct {
+	Name           string
+	TCPPorts       []int
+	UDPPorts       []int
+	DetectServices bool
+}
+
+// top100TCPPorts are nmap's 100 most frequently open TCP ports, most frequent first.
+var top100TCPPorts = []int{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139, 143, 53, 135, 3306, 8080, 1723, 111,
+	995, 993, 5900, 1025, 587, 8888, 199, 1720, 465, 548, 113, 81, 6001, 10000, 514,
+	5060, 179, 1026, 2000, 8443, 8000, 32768, 554, 26, 1433, 49152, 2001, 515, 8008,
+	49154, 1027, 5666, 646, 5000, 5631, 631, 49153, 8081, 2049, 88, 79, 5800, 106, 2121,
+	1110, 49155, 6000, 513, 990, 5357, 427, 49156, 543, 544, 5101, 144, 7, 389, 8009,
+	3128, 444, 9999, 5009, 7070, 5190, 3000, 5432, 1900, 3986, 13, 1029, 9, 5051, 6646,
+	49157, 1028, 873, 1755, 2717, 4899, 9100, 119, 37,
+}
+
+// extraServicePorts extend top-100 towards top-1000 with ports of services commonly
+// exposed by phishing and C2 infrastructure (admin panels, databases, proxies).
+var extraServicePorts = []int{
+	2082, 2083, 2086, 2087, 2095, 2096, 2222, 2375, 2376, 3001, 4443, 4444, 4567, 5001,
+	5222, 5601, 5672, 5985, 5986, 6379, 6443, 6667, 7001, 7002, 7443, 7777, 8001, 8010,
+	8082, 8083, 8088, 8089, 8090, 8181, 8200, 8282, 8500, 8800, 8880, 8883, 9000, 9001,
+	9002, 9043, 9060, 9080, 9090, 9091, 9200, 9300, 9443, 9418, 10001, 10443, 11211,
+	15672, 27017, 27018, 50000, 50050,
+}
+
+// webPorts are ports commonly serving HTTP(S).
+var webPorts = []int{
+	80, 81, 443, 591, 2082, 2083, 2086, 2087, 3000, 4443, 5000, 7001, 7443, 8000, 8008,
+	8080, 8081, 8088, 8443, 8888, 9000, 9090, 9443, 10443,
+}
+
+// commonUDPPorts covers the UDP services the probe database can identify.
+var commonUDPPorts = []int{53, 123, 161, 5353}
+
+// top1000TCPPorts approximates nmap's top-1000: the top-100, the extra service ports,
+// then the remaining well-known range.
+func top1000TCPPorts() []int {
+	ports := append(append([]int{}, top100TCPPorts...), extraServicePorts...)
+	for p := 1; p <= 1024; p++ {
+		ports = append(ports, p)
+	}
+	ports = dedupePorts(ports)
+	if len(ports) > 1000 {
+		ports = ports[:1000]
+	}
+	return ports
+}
+
+// ScanProfileByName returns a built-in profile (top-100, top-1000, web, udp) or
+// treats name as a custom port specification such as "22,80,8000-8100,U:53,161".
+func ScanProfileByName(name string) (*ScanProfile, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "top-100":
+		return &ScanProfile{Name: "top-100", TCPPorts: top100TCPPorts, UDPPorts: commonUDPPorts, DetectServices: true}, nil
+	case "top-1000":
+		return &ScanProfile{Name: "top-1000", TCPPorts: top1000TCPPorts(), UDPPorts: commonUDPPorts, DetectServices: true}, nil
+	case "web":
+		return &ScanProfile{Name: "web", TCPPorts: webPorts, DetectServices: true}, nil
+	case "udp":
+		return &ScanProfile{Name: "udp", UDPPorts: commonUDPPorts, DetectServices: true}, nil
+	}
+
+	tcp, udp, err := ParsePortSpec(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown scan profile %q: %w", name, err)
+	}
+	return &ScanProfile{Name: "custom", TCPPorts: tcp, UDPPorts: udp, DetectServices: true}, nil
+}
+
+// ParsePortSpec parses an nmap-style port list. Entries are single ports or ranges;
+// a "T:" or "U:" prefix switches the protocol for that and following entries.
+func ParsePortSpec(spec string) (tcp, udp []int, err error) {
+	protocol := "tcp"
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case strings.HasPrefix(strings.ToUpper(part), "T:"):
+			protocol, part = "tcp", part[2:]
+		case strings.HasPrefix(strings.ToUpper(part), "U:"):
+			protocol, part = "udp", part[2:]
+		}
+		if part == "" {
+			continue
+		}
+
+		lo, hi, err := parsePortRange(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		for p := lo; p <= hi; p++ {
+			if protocol == "udp" {
+				udp = append(udp, p)
+			} else {
+				tcp = append(tcp, p)
+			}
+		}
+	}
+	if len(tcp) == 0 && len(udp) == 0 {
+		return nil, nil, fmt.Errorf("empty port specification")
+	}
+	return dedupePorts(tcp), dedupePorts(udp), nil
+}
+
+func parsePortRange(s string) (int, int, error) {
+	loStr, hiStr, isRange := strings.Cut(s, "-")
+	lo, err := strconv.Atoi(strings.TrimSpace(loStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	hi := lo
+	if isRange {
+		if hi, err = strconv.Atoi(strings.TrimSpace(hiStr)); err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	if lo < 1 || hi > 65535 || lo > hi {
+		return 0, 0, fmt.Errorf("port range %q out of bounds", s)
+	}
+	return lo, hi, nil
+}
+
+// dedupePorts removes duplicates while keeping the first occurrence order.
+func dedupePorts(ports []int) []int {
+	seen := make(map[int]bool, len(ports))
+	out := ports[:0:0]
+	for _, p := range ports {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func sortResults(results []ScanResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Protocol != results[j].Protocol {
+			return results[i].Protocol < results[j].Protocol
+		}
+		return results[i].Port < results[j].Port
+	})
+}
@@ -0,0 +1,76 @@
+package network
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanProfileByName(t *testing.T) {
+	if len(top100TCPPorts) != 100 || len(dedupePorts(top100TCPPorts)) != 100 {
+		t.Errorf("top-100 list has %d ports (%d unique)", len(top100TCPPorts), len(dedupePorts(top100TCPPorts)))
+	}
+
+	tests := []struct {
+		name    string
+		wantTCP int
+		wantUDP int
+	}{
+		{"", 100, len(commonUDPPorts)},
+		{"top-100", 100, len(commonUDPPorts)},
+		{"TOP-1000", 1000, len(commonUDPPorts)},
+		{"web", len(webPorts), 0},
+		{"udp", 0, len(commonUDPPorts)},
+		{"22,80-82,U:53", 4, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ScanProfileByName(tt.name)
+			if err != nil {
+				t.Fatalf("ScanProfileByName: %v", err)
+			}
+			if len(p.TCPPorts) != tt.wantTCP || len(p.UDPPorts) != tt.wantUDP {
+				t.Errorf("got %d TCP / %d UDP ports, want %d / %d", len(p.TCPPorts), len(p.UDPPorts), tt.wantTCP, tt.wantUDP)
+			}
+		})
+	}
+
+	if _, err := ScanProfileByName("everything"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		tcp     []int
+		udp     []int
+		wantErr bool
+	}{
+		{spec: "80", tcp: []int{80}},
+		{spec: "22, 80-82 ,22", tcp: []int{22, 80, 81, 82}},
+		{spec: "T:443,U:53,123,T:8080", tcp: []int{443, 8080}, udp: []int{53, 123}},
+		{spec: "u:161", udp: []int{161}},
+		{spec: "0", wantErr: true},
+		{spec: "90-80", wantErr: true},
+		{spec: "70000", wantErr: true},
+		{spec: "http", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			tcp, udp, err := ParsePortSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(tcp, tt.tcp) && !(len(tcp) == 0 && len(tt.tcp) == 0) {
+				t.Errorf("tcp = %v, want %v", tcp, tt.tcp)
+			}
+			if !reflect.DeepEqual(udp, tt.udp) && !(len(udp) == 0 && len(tt.udp) == 0) {
+				t.Errorf("udp = %v, want %v", udp, tt.udp)
+			}
+		})
+	}
+}
@@ -1,70 +1,367 @@
 package network
 
 import (
-	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"syscall"
 	"time"
 )
 
+// ServiceInfo identifies the service listening on a port.
+type ServiceInfo struct {
+	Port     int      `json:"port"`
+	Protocol string   `json:"protocol"`
+	Name     string   `json:"name"` // nmap-style service name, e.g. "ssh", "http", "domain"
+	Product  string   `json:"product,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Info     string   `json:"info,omitempty"`
+	Hostname string   `json:"hostname,omitempty"`
+	OS       string   `json:"os,omitempty"`
+	Device   string   `json:"device,omitempty"`
+	CPE      []string `json:"cpe,omitempty"`
+	Tunnel   string   `json:"tunnel,omitempty"` // "ssl" when identified through TLS
+	Banner   string   `json:"banner,omitempty"` // Printable prefix of the first response
+	Probe    string   `json:"probe,omitempty"`  // Probe whose response matched
+	Method   string   `json:"method"`           // "probe", "softmatch" or "port-table"
+}
+
+// String renders the service like nmap's VERSION column.
+func (s ServiceInfo) String() string {
+	parts := []string{s.Name}
+	if s.Tunnel != "" {
+		parts[0] = s.Tunnel + "/" + s.Name
+	}
+	if s.Product != "" {
+		parts = append(parts, s.Product)
+	}
+	if s.Version != "" {
+		parts = append(parts, s.Version)
+	}
+	if s.Info != "" {
+		parts = append(parts, "("+s.Info+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+const (
+	maxProbeResponse = 4096
+	bannerLength     = 128
+	// Once data arrives, stop reading after this much silence instead of the full wait.
+	responseIdleWait = 200 * time.Millisecond
+)
+
 type ServiceDetector struct {
-	timeout time.Duration
+	timeout   time.Duration
+	probes    *ProbeDB
+	intensity int // Probes with a higher rarity are only sent to their listed ports
 }
 
 func NewServiceDetector() *ServiceDetector {
 	return &ServiceDetector{
-		timeout: 2 * time.Second,
+		timeout:   2 * time.Second,
+		probes:    DefaultProbeDB(),
+		intensity: 7,
+	}
+}
+
+// LoadProbes merges an additional probe database file into the bundled one.
+func (sd *ServiceDetector) LoadProbes(path string) error {
+	db, err := LoadProbeDB(path)
+	if err != nil {
+		return err
+	}
+	sd.probes.Merge(db)
+	return nil
+}
+
+// SetIntensity sets the maximum rarity of probes sent to ports they do not list.
+func (sd *ServiceDetector) SetIntensity(intensity int) {
+	if intensity >= 0 && intensity <= 9 {
+		sd.intensity = intensity
+	}
+}
+
+// Detect identifies the TCP service on target:port by walking the probe database,
+// falling back to the well-known port table.
+func (sd *ServiceDetector) Detect(ctx context.Context, target string, port int) ServiceInfo {
+	address := net.JoinHostPort(target, fmt.Sprintf("%d", port))
+
+	var soft *ServiceInfo
+	var banner string
+	for _, probe := range sd.probes.ProbesFor("tcp", port, sd.intensity) {
+		if ctx.Err() != nil {
+			break
+		}
+		response, err := sd.exchangeTCP(ctx, address, probe, nil)
+		if err != nil || len(response) == 0 {
+			continue
+		}
+		if banner == "" {
+			banner = bannerString(response)
+		}
+
+		info, hard := sd.match(probe, response)
+		if info == nil {
+			continue
+		}
+		if hard && info.Name == "ssl" {
+			if tunneled := sd.detectOverTLS(ctx, address, port); tunneled != nil {
+				tunneled.Banner = banner
+				return *tunneled
+			}
+		}
+		if hard {
+			info.Banner = banner
+			return sd.finish(info, port, "tcp")
+		}
+		if soft == nil {
+			soft = info
+		}
+	}
+
+	if soft != nil {
+		soft.Banner = banner
+		return sd.finish(soft, port, "tcp")
+	}
+	return ServiceInfo{Port: port, Protocol: "tcp", Name: sd.commonPortMap(port), Banner: banner, Method: "port-table"}
+}
+
+// detectOverTLS repeats the TCP probes inside a TLS session to identify the wrapped
+// protocol (https, imaps, ...).
+func (sd *ServiceDetector) detectOverTLS(ctx context.Context, address string, port int) *ServiceInfo {
+	tlsConfig := &tls.Config{InsecureSkipVerify: true} // Identification only, never trusted
+
+	var soft *ServiceInfo
+	for _, probe := range sd.probes.ProbesFor("tcp", port, sd.intensity) {
+		if ctx.Err() != nil || probe.Name == "TLSSessionReq" {
+			continue
+		}
+		response, err := sd.exchangeTCP(ctx, address, probe, tlsConfig)
+		if err != nil || len(response) == 0 {
+			continue
+		}
+		info, hard := sd.match(probe, response)
+		if info == nil {
+			continue
+		}
+		info.Tunnel = "ssl"
+		if info.Name == "http" {
+			info.Name, info.Tunnel = "https", ""
+		}
+		if hard {
+			result := sd.finish(info, port, "tcp")
+			return &result
+		}
+		if soft == nil {
+			soft = info
+		}
+	}
+	if soft == nil {
+		return &ServiceInfo{Port: port, Protocol: "tcp", Name: "ssl", Product: "TLS", Probe: "TLSSessionReq", Method: "probe"}
 	}
+	result := sd.finish(soft, port, "tcp")
+	return &result
 }
 
-func (sd *ServiceDetector) Detect(ctx context.Context, target string, port int) string {
+// DetectUDP sends the UDP probes for port and reports whether anything answered.
+// A false result with a nil error means no reply (open|filtered); an error wrapping
+// syscall.ECONNREFUSED means the port is closed.
+func (sd *ServiceDetector) DetectUDP(ctx context.Context, target string, port int) (ServiceInfo, bool, error) {
 	address := net.JoinHostPort(target, fmt.Sprintf("%d", port))
-	conn, err := net.DialTimeout("tcp", address, sd.timeout)
+	probes := sd.probes.ProbesFor("udp", port, 0)
+	if len(probes) == 0 {
+		// Without a protocol-specific payload an empty datagram is the best we can do.
+		probes = []*ServiceProbe{{Protocol: "udp", Name: "empty", Ports: map[int]bool{}}}
+	}
+
+	var lastErr error
+	for _, probe := range probes {
+		if ctx.Err() != nil {
+			return ServiceInfo{}, false, ctx.Err()
+		}
+		response, err := sd.exchangeUDP(ctx, address, probe)
+		if err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				return ServiceInfo{}, false, err
+			}
+			lastErr = err
+			continue
+		}
+		if len(response) == 0 {
+			continue
+		}
+
+		info, _ := sd.match(probe, response)
+		if info == nil {
+			info = &ServiceInfo{Name: sd.commonPortMap(port), Method: "port-table"}
+		}
+		info.Banner = bannerString(response)
+		return sd.finish(info, port, "udp"), true, nil
+	}
+
+	var netErr net.Error
+	if lastErr != nil && !(errors.As(lastErr, &netErr) && netErr.Timeout()) {
+		return ServiceInfo{}, false, lastErr
+	}
+	return ServiceInfo{}, false, nil
+}
+
+// match tries the probe's own match lines, then those of its fallbacks.
+func (sd *ServiceDetector) match(probe *ServiceProbe, response []byte) (*ServiceInfo, bool) {
+	candidates := []*ServiceProbe{probe}
+	for _, name := range probe.Fallbacks {
+		if fb := sd.probes.Probe(probe.Protocol, name); fb != nil {
+			candidates = append(candidates, fb)
+		}
+	}
+
+	var soft *ServiceInfo
+	for _, candidate := range candidates {
+		for _, m := range candidate.Matches {
+			info, ok := m.Apply(response)
+			if !ok {
+				continue
+			}
+			info.Probe = probe.Name
+			if !m.Soft {
+				info.Method = "probe"
+				return info, true
+			}
+			if soft == nil {
+				info.Method = "softmatch"
+				soft = info
+			}
+		}
+	}
+	return soft, false
+}
+
+func (sd *ServiceDetector) finish(info *ServiceInfo, port int, protocol string) ServiceInfo {
+	info.Port = port
+	info.Protocol = protocol
+	return *info
+}
+
+func (sd *ServiceDetector) exchangeTCP(ctx context.Context, address string, probe *ServiceProbe, tlsConfig *tls.Config) ([]byte, error) {
+	dialer := &net.Dialer{Timeout: sd.timeout}
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
 	if err != nil {
-		return "Unknown"
+		return nil, err
 	}
 	defer conn.Close()
 
-	// Set deadline for banner grab
-	conn.SetDeadline(time.Now().Add(sd.timeout))
+	if len(probe.Payload) > 0 {
+		conn.SetWriteDeadline(time.Now().Add(sd.timeout))
+		if _, err := conn.Write(probe.Payload); err != nil {
+			return nil, err
+		}
+	}
+	return sd.readResponse(ctx, conn, sd.probeWait(probe))
+}
 
-	// Send generic probe
-	fmt.Fprintf(conn, "HEAD / HTTP/1.0\r\n\r\n")
+func (sd *ServiceDetector) exchangeUDP(ctx context.Context, address string, probe *ServiceProbe) ([]byte, error) {
+	conn, err := (&net.Dialer{Timeout: sd.timeout}).DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
 
-	reader := bufio.NewReader(conn)
-	line, _ := reader.ReadString('\n')
-	line = strings.TrimSpace(line)
+	if _, err := conn.Write(probe.Payload); err != nil {
+		return nil, err
+	}
 
-	if line != "" {
-		if strings.Contains(line, "HTTP") {
-			return "Web Server (HTTP)"
+	// A single datagram is the whole response.
+	deadline := time.Now().Add(sd.probeWait(probe))
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, maxProbeResponse)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// readResponse collects data until the wait expires, the peer closes, or the stream
+// goes quiet after the first bytes.
+func (sd *ServiceDetector) readResponse(ctx context.Context, conn net.Conn, wait time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	var response []byte
+	buf := make([]byte, 1024)
+	for len(response) < maxProbeResponse {
+		conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if err != nil {
+			break
 		}
-		if strings.Contains(strings.ToLower(line), "ssh") {
-			return "SSH"
+		if idle := time.Now().Add(responseIdleWait); idle.Before(deadline) {
+			deadline = idle
 		}
-		return line // Return raw banner if matched
 	}
+	if len(response) > maxProbeResponse {
+		response = response[:maxProbeResponse]
+	}
+	return response, nil
+}
 
-	return sd.commonPortMap(port)
+func (sd *ServiceDetector) probeWait(probe *ServiceProbe) time.Duration {
+	if probe.Wait > 0 && probe.Wait < sd.timeout {
+		return probe.Wait
+	}
+	return sd.timeout
+}
+
+func bannerString(response []byte) string {
+	if len(response) > bannerLength {
+		response = response[:bannerLength]
+	}
+	return strings.TrimSpace(printable(latin1(response)))
 }
 
 func (sd *ServiceDetector) commonPortMap(port int) string {
 	ports := map[int]string{
-		21:   "FTP",
-		22:   "SSH",
-		23:   "Telnet",
-		25:   "SMTP",
-		53:   "DNS",
-		80:   "HTTP",
-		443:  "HTTPS",
-		3306: "MySQL",
-		5432: "PostgreSQL",
-		8080: "HTTP-Proxy/Alt",
+		21:   "ftp",
+		22:   "ssh",
+		23:   "telnet",
+		25:   "smtp",
+		53:   "domain",
+		80:   "http",
+		110:  "pop3",
+		123:  "ntp",
+		143:  "imap",
+		161:  "snmp",
+		443:  "https",
+		445:  "microsoft-ds",
+		993:  "imaps",
+		995:  "pop3s",
+		1433: "ms-sql-s",
+		3306: "mysql",
+		3389: "ms-wbt-server",
+		5432: "postgresql",
+		5900: "vnc",
+		6379: "redis",
+		8080: "http-proxy",
+		8443: "https-alt",
 	}
 	if name, ok := ports[port]; ok {
 		return name
 	}
-	return "Unknown Service"
+	return "unknown"
 }
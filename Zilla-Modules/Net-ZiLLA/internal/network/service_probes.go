@@ -0,0 +1,412 @@
+package network
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed service-probes
+var defaultServiceProbes string
+
+// ServiceProbe is one "Probe" section of a service probe database.
+type ServiceProbe struct {
+	Protocol  string // "tcp" or "udp"
+	Name      string
+	Payload   []byte
+	Ports     map[int]bool
+	Rarity    int
+	Wait      time.Duration
+	Fallbacks []string
+	Matches   []*ServiceMatch
+}
+
+// ServiceMatch is a match or softmatch line.
+type ServiceMatch struct {
+	Service string
+	Soft    bool
+	Pattern *regexp.Regexp
+
+	// Version templates; $1..$9 are replaced with submatches.
+	Product  string
+	Version  string
+	Info     string
+	Hostname string
+	OS       string
+	Device   string
+	CPE      []string
+}
+
+// ProbeDB is an ordered set of probes in the spirit of nmap-service-probes.
+type ProbeDB struct {
+	Probes []*ServiceProbe
+	byName map[string]*ServiceProbe
+}
+
+// DefaultProbeDB parses the probe database bundled with the binary.
+func DefaultProbeDB() *ProbeDB {
+	db, err := ParseProbeDB(strings.NewReader(defaultServiceProbes))
+	if err != nil {
+		panic(fmt.Sprintf("bundled service-probes is invalid: %v", err))
+	}
+	return db
+}
+
+// LoadProbeDB reads a probe database file.
+func LoadProbeDB(path string) (*ProbeDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open probe database %s: %w", path, err)
+	}
+	defer f.Close()
+
+	db, err := ParseProbeDB(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// ParseProbeDB parses the nmap-service-probes subset documented in service-probes.
+// Unknown directives (sslports, tcpwrappedms, Exclude, ...) are ignored so nmap files
+// can be reused, but match lines whose regex is not RE2-compatible are rejected.
+func ParseProbeDB(r io.Reader) (*ProbeDB, error) {
+	db := &ProbeDB{byName: make(map[string]*ServiceProbe)}
+	var current *ServiceProbe
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		directive, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+
+		if directive == "Probe" {
+			probe, err := parseProbeLine(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			db.add(probe)
+			current = probe
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		var err error
+		switch directive {
+		case "match", "softmatch":
+			var m *ServiceMatch
+			m, err = parseMatchLine(rest, directive == "softmatch")
+			if err == nil {
+				current.Matches = append(current.Matches, m)
+			}
+		case "ports":
+			err = parsePortsDirective(current.Ports, rest)
+		case "rarity":
+			current.Rarity, err = strconv.Atoi(rest)
+		case "totalwaitms":
+			var ms int
+			ms, err = strconv.Atoi(rest)
+			current.Wait = time.Duration(ms) * time.Millisecond
+		case "fallback":
+			for _, name := range strings.Split(rest, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					current.Fallbacks = append(current.Fallbacks, name)
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *ProbeDB) add(probe *ServiceProbe) {
+	key := probe.Protocol + "/" + probe.Name
+	if existing, ok := db.byName[key]; ok {
+		// Later files extend earlier probes of the same name.
+		existing.Matches = append(existing.Matches, probe.Matches...)
+		return
+	}
+	db.byName[key] = probe
+	db.Probes = append(db.Probes, probe)
+}
+
+// Merge appends the probes and match lines of other.
+func (db *ProbeDB) Merge(other *ProbeDB) {
+	for _, probe := range other.Probes {
+		if existing, ok := db.byName[probe.Protocol+"/"+probe.Name]; ok {
+			existing.Matches = append(existing.Matches, probe.Matches...)
+			for port := range probe.Ports {
+				existing.Ports[port] = true
+			}
+			continue
+		}
+		db.add(probe)
+	}
+}
+
+// Probe returns the named probe for a protocol.
+func (db *ProbeDB) Probe(protocol, name string) *ServiceProbe {
+	return db.byName[protocol+"/"+name]
+}
+
+// ProbesFor returns the probes to try against a port: the NULL (banner) probe, then
+// probes listing the port, then the rest up to the given rarity.
+func (db *ProbeDB) ProbesFor(protocol string, port, intensity int) []*ServiceProbe {
+	var specific, generic []*ServiceProbe
+	for _, probe := range db.Probes {
+		if probe.Protocol != protocol {
+			continue
+		}
+		switch {
+		case len(probe.Payload) == 0:
+			specific = append([]*ServiceProbe{probe}, specific...)
+		case probe.Ports[port]:
+			specific = append(specific, probe)
+		case probe.Rarity <= intensity:
+			generic = append(generic, probe)
+		}
+	}
+	return append(specific, generic...)
+}
+
+func parseProbeLine(rest string) (*ServiceProbe, error) {
+	fields := strings.SplitN(rest, " ", 3)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("malformed Probe line %q", rest)
+	}
+	protocol := strings.ToLower(fields[0])
+	if protocol != "tcp" && protocol != "udp" {
+		return nil, fmt.Errorf("unsupported probe protocol %q", fields[0])
+	}
+
+	q := strings.TrimSpace(fields[2])
+	if len(q) < 3 || q[0] != 'q' {
+		return nil, fmt.Errorf("probe %s: expected q<delim>payload<delim>", fields[1])
+	}
+	delim := q[1]
+	end := strings.IndexByte(q[2:], delim)
+	if end < 0 {
+		return nil, fmt.Errorf("probe %s: unterminated payload", fields[1])
+	}
+	payload, err := unescapeProbeString(q[2 : 2+end])
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %w", fields[1], err)
+	}
+
+	return &ServiceProbe{
+		Protocol: protocol,
+		Name:     fields[1],
+		Payload:  payload,
+		Ports:    make(map[int]bool),
+		Rarity:   1,
+	}, nil
+}
+
+func parseMatchLine(rest string, soft bool) (*ServiceMatch, error) {
+	service, spec, ok := strings.Cut(rest, " ")
+	if !ok || len(spec) < 3 || spec[0] != 'm' {
+		return nil, fmt.Errorf("malformed match line %q", rest)
+	}
+
+	delim := spec[1]
+	end := strings.IndexByte(spec[2:], delim)
+	if end < 0 {
+		return nil, fmt.Errorf("match %s: unterminated pattern", service)
+	}
+	pattern := spec[2 : 2+end]
+	spec = spec[2+end+1:]
+
+	var flags string
+	for len(spec) > 0 && (spec[0] == 's' || spec[0] == 'i') {
+		flags += string(spec[0])
+		spec = spec[1:]
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("match %s: %w", service, err)
+	}
+
+	m := &ServiceMatch{Service: service, Soft: soft, Pattern: re}
+	if err := parseVersionInfo(m, strings.TrimSpace(spec)); err != nil {
+		return nil, fmt.Errorf("match %s: %w", service, err)
+	}
+	return m, nil
+}
+
+// parseVersionInfo reads the p/ v/ i/ h/ o/ d/ cpe:/ fields following a pattern.
+func parseVersionInfo(m *ServiceMatch, spec string) error {
+	for spec != "" {
+		var key string
+		if strings.HasPrefix(spec, "cpe:") {
+			key, spec = "cpe", spec[4:]
+		} else {
+			key, spec = spec[:1], spec[1:]
+		}
+		if spec == "" {
+			return fmt.Errorf("truncated %s field", key)
+		}
+		delim := spec[0]
+		end := strings.IndexByte(spec[1:], delim)
+		if end < 0 {
+			return fmt.Errorf("unterminated %s field", key)
+		}
+		value := spec[1 : 1+end]
+		spec = spec[1+end+1:]
+		// cpe values may carry an "a" (auto-generated) flag.
+		spec = strings.TrimLeft(spec, "a")
+		spec = strings.TrimSpace(spec)
+
+		switch key {
+		case "p":
+			m.Product = value
+		case "v":
+			m.Version = value
+		case "i":
+			m.Info = value
+		case "h":
+			m.Hostname = value
+		case "o":
+			m.OS = value
+		case "d":
+			m.Device = value
+		case "cpe":
+			m.CPE = append(m.CPE, "cpe:/"+strings.TrimPrefix(value, "/"))
+		default:
+			return fmt.Errorf("unknown version field %q", key)
+		}
+	}
+	return nil
+}
+
+func parsePortsDirective(ports map[int]bool, spec string) error {
+	tcp, _, err := ParsePortSpec(spec)
+	if err != nil {
+		return err
+	}
+	for _, p := range tcp {
+		ports[p] = true
+	}
+	return nil
+}
+
+// unescapeProbeString decodes the C-style escapes used in probe payloads.
+func unescapeProbeString(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return nil, fmt.Errorf("trailing backslash in payload")
+		}
+		switch s[i] {
+		case '0':
+			out = append(out, 0)
+		case 'r':
+			out = append(out, '\r')
+		case 'n':
+			out = append(out, '\n')
+		case 't':
+			out = append(out, '\t')
+		case '\\':
+			out = append(out, '\\')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("truncated \\x escape")
+			}
+			b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid \\x escape %q", s[i-1:i+3])
+			}
+			out = append(out, byte(b))
+			i += 2
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return out, nil
+}
+
+// latin1 maps every byte to the rune of the same value so RE2 \xHH classes match
+// raw bytes of binary responses.
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+var templateVar = regexp.MustCompile(`\$(\d)`)
+
+// Apply matches a response and, on success, returns the filled-in service details.
+func (m *ServiceMatch) Apply(response []byte) (*ServiceInfo, bool) {
+	submatches := m.Pattern.FindStringSubmatch(latin1(response))
+	if submatches == nil {
+		return nil, false
+	}
+
+	expand := func(tmpl string) string {
+		if tmpl == "" {
+			return ""
+		}
+		out := templateVar.ReplaceAllStringFunc(tmpl, func(v string) string {
+			n := int(v[1] - '0')
+			if n < len(submatches) {
+				return printable(submatches[n])
+			}
+			return ""
+		})
+		return strings.TrimSpace(out)
+	}
+
+	info := &ServiceInfo{
+		Name:     m.Service,
+		Product:  expand(m.Product),
+		Version:  expand(m.Version),
+		Info:     expand(m.Info),
+		Hostname: expand(m.Hostname),
+		OS:       expand(m.OS),
+		Device:   expand(m.Device),
+	}
+	for _, cpe := range m.CPE {
+		info.CPE = append(info.CPE, strings.TrimSuffix(expand(cpe), ":"))
+	}
+	return info, true
+}
+
+// printable replaces non-printable characters so captured values are safe to display.
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '.'
+		}
+		return r
+	}, s)
+}
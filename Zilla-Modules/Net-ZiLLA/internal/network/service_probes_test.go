@@ -0,0 +1,106 @@
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultProbeDB(t *testing.T) {
+	db := DefaultProbeDB()
+
+	for _, name := range []string{"tcp/NULL", "tcp/GetRequest", "tcp/TLSSessionReq", "udp/DNSVersionBindReq", "udp/NTPRequest", "udp/SNMPv1GetRequest"} {
+		proto, probe, _ := strings.Cut(name, "/")
+		if db.Probe(proto, probe) == nil {
+			t.Errorf("bundled database is missing probe %s", name)
+		}
+	}
+
+	// The ClientHello length fields must agree with the payload.
+	hello := db.Probe("tcp", "TLSSessionReq").Payload
+	if recordLen := int(hello[3])<<8 | int(hello[4]); recordLen != len(hello)-5 {
+		t.Errorf("TLS record length %d, payload carries %d", recordLen, len(hello)-5)
+	}
+
+	probes := db.ProbesFor("tcp", 443, 7)
+	if probes[0].Name != "NULL" || probes[1].Name != "TLSSessionReq" {
+		t.Errorf("expected NULL then TLSSessionReq first for 443, got %s, %s", probes[0].Name, probes[1].Name)
+	}
+	for _, p := range db.ProbesFor("tcp", 22, 1) {
+		if p.Name == "RedisPing" {
+			t.Errorf("rare probe RedisPing sent to unlisted port at intensity 1")
+		}
+	}
+}
+
+func TestParseProbeDB(t *testing.T) {
+	src := `# comment
+Probe TCP Hello q|HELLO\r\n\x00|
+ports 7000-7002,U:9
+rarity 3
+totalwaitms 250
+fallback Other
+match demo m|^DEMO ([\d.]+) on (\w+)|i p/Demo Server/ v/$1/ h/$2/ cpe:/a:demo:server:$1/
+softmatch demo m|^DEMO|
+sslports 443
+`
+	db, err := ParseProbeDB(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseProbeDB: %v", err)
+	}
+	probe := db.Probe("tcp", "Hello")
+	if probe == nil {
+		t.Fatal("probe not parsed")
+	}
+	if string(probe.Payload) != "HELLO\r\n\x00" {
+		t.Errorf("payload = %q", probe.Payload)
+	}
+	if !probe.Ports[7001] || probe.Ports[9] || probe.Rarity != 3 || probe.Wait.Milliseconds() != 250 {
+		t.Errorf("directives not applied: %+v", probe)
+	}
+	if len(probe.Fallbacks) != 1 || len(probe.Matches) != 2 {
+		t.Fatalf("expected 1 fallback and 2 matches, got %d/%d", len(probe.Fallbacks), len(probe.Matches))
+	}
+
+	info, ok := probe.Matches[0].Apply([]byte("demo 2.1 on gateway\r\n"))
+	if !ok {
+		t.Fatal("case-insensitive match failed")
+	}
+	if info.Product != "Demo Server" || info.Version != "2.1" || info.Hostname != "gateway" {
+		t.Errorf("templates not expanded: %+v", info)
+	}
+	if len(info.CPE) != 1 || info.CPE[0] != "cpe:/a:demo:server:2.1" {
+		t.Errorf("cpe = %v", info.CPE)
+	}
+}
+
+func TestParseProbeDB_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"bad protocol", "Probe SCTP X q||"},
+		{"unterminated payload", "Probe TCP X q|abc"},
+		{"bad regex", "Probe TCP X q||\nmatch x m|(|"},
+		{"bad version field", "Probe TCP X q||\nmatch x m|a| z/b/"},
+		{"bad escape", `Probe TCP X q|\xZZ|`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseProbeDB(strings.NewReader(tt.src)); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestServiceMatch_ApplyBinary(t *testing.T) {
+	db := DefaultProbeDB()
+	// MySQL handshake: length, sequence, protocol 10, version string.
+	greeting := append([]byte{0x4a, 0x00, 0x00, 0x00, 0x0a}, []byte("8.0.36-0ubuntu0.22.04.1\x00")...)
+
+	sd := &ServiceDetector{probes: db}
+	info, hard := sd.match(db.Probe("tcp", "NULL"), greeting)
+	if !hard || info.Name != "mysql" || info.Version != "8.0.36" {
+		t.Errorf("expected mysql 8.0.36, got %+v", info)
+	}
+}
@@ -0,0 +1,615 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+// RFC 7208 processing limits.
+const (
+	spfMaxLookups     = 10
+	spfMaxVoidLookups = 2
+	spfMaxMXHosts     = 10
+)
+
+// SPF results as defined by RFC 7208 section 2.6.
+const (
+	spfPass      = "pass"
+	spfFail      = "fail"
+	spfSoftFail  = "softfail"
+	spfNeutral   = "neutral"
+	spfNone      = "none"
+	spfPermError = "permerror"
+	spfTempError = "temperror"
+)
+
+// emailDNS is the subset of *net.Resolver the email checks need; tests swap in a
+// static zone.
+type emailDNS interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+type spfTerm struct {
+	qualifier byte   // '+', '-', '~' or '?'
+	mechanism string // all, include, a, mx, ptr, ip4, ip6 or exists
+	domain    string // Domain spec, possibly with macros
+	network   *net.IPNet
+	cidr4     int
+	cidr6     int
+}
+
+type spfRecord struct {
+	terms    []spfTerm
+	redirect string
+}
+
+// parseSPF parses a "v=spf1 ..." record. Unknown modifiers are ignored as the
+// RFC requires; unknown mechanisms and malformed terms are errors.
+func parseSPF(record string) (*spfRecord, error) {
+	fields := strings.Fields(record)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "v=spf1") {
+		return nil, fmt.Errorf("not an SPF record")
+	}
+	r := &spfRecord{}
+	seen := make(map[string]bool)
+	for _, field := range fields[1:] {
+		if name, value, ok := strings.Cut(field, "="); ok && isSPFName(name) {
+			name = strings.ToLower(name)
+			if (name == "redirect" || name == "exp") && seen[name] {
+				return nil, fmt.Errorf("duplicate %s modifier", name)
+			}
+			seen[name] = true
+			if name == "redirect" {
+				if value == "" {
+					return nil, fmt.Errorf("empty redirect modifier")
+				}
+				r.redirect = value
+			}
+			continue
+		}
+
+		t := spfTerm{qualifier: '+', cidr4: 32, cidr6: 128}
+		if strings.ContainsRune("+-~?", rune(field[0])) {
+			t.qualifier, field = field[0], field[1:]
+		}
+		name, rest := field, ""
+		if i := strings.IndexAny(field, ":/"); i >= 0 {
+			name, rest = field[:i], field[i:]
+		}
+		t.mechanism = strings.ToLower(name)
+		switch t.mechanism {
+		case "all":
+			if rest != "" {
+				return nil, fmt.Errorf("invalid term %q", field)
+			}
+		case "include", "exists", "ptr":
+			if rest == "" && t.mechanism == "ptr" {
+				break
+			}
+			if !strings.HasPrefix(rest, ":") || len(rest) == 1 {
+				return nil, fmt.Errorf("invalid term %q", field)
+			}
+			t.domain = rest[1:]
+		case "a", "mx":
+			spec := rest
+			if i := strings.Index(spec, "//"); i >= 0 {
+				n, err := strconv.Atoi(spec[i+2:])
+				if err != nil || n < 0 || n > 128 {
+					return nil, fmt.Errorf("invalid IPv6 prefix in %q", field)
+				}
+				t.cidr6, spec = n, spec[:i]
+			}
+			if i := strings.LastIndex(spec, "/"); i >= 0 {
+				n, err := strconv.Atoi(spec[i+1:])
+				if err != nil || n < 0 || n > 32 {
+					return nil, fmt.Errorf("invalid IPv4 prefix in %q", field)
+				}
+				t.cidr4, spec = n, spec[:i]
+			}
+			if spec != "" && (!strings.HasPrefix(spec, ":") || len(spec) == 1) {
+				return nil, fmt.Errorf("invalid term %q", field)
+			}
+			t.domain = strings.TrimPrefix(spec, ":")
+		case "ip4", "ip6":
+			addr := strings.TrimPrefix(rest, ":")
+			if !strings.Contains(addr, "/") {
+				if t.mechanism == "ip4" {
+					addr += "/32"
+				} else {
+					addr += "/128"
+				}
+			}
+			ip, network, err := net.ParseCIDR(addr)
+			if err != nil || (ip.To4() != nil) != (t.mechanism == "ip4") {
+				return nil, fmt.Errorf("invalid address in %q", field)
+			}
+			t.network = network
+		default:
+			return nil, fmt.Errorf("unknown mechanism %q", field)
+		}
+		r.terms = append(r.terms, t)
+	}
+	return r, nil
+}
+
+func isSPFName(name string) bool {
+	if name == "" || !isAlpha(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		c := name[i]
+		if !isAlpha(c) && !(c >= '0' && c <= '9') && c != '-' && c != '_' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// lookupSPF returns the domain's single SPF record. It returns "" with a nil
+// error when there is none, and an SPF result as the error otherwise.
+func lookupSPF(ctx context.Context, dns emailDNS, domain string) (string, error) {
+	txts, err := dns.LookupTXT(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return "", &spfError{spfTempError, fmt.Sprintf("TXT lookup for %s failed: %v", domain, err)}
+	}
+	var records []string
+	for _, txt := range txts {
+		if strings.EqualFold(txt, "v=spf1") || len(txt) > 7 && strings.EqualFold(txt[:7], "v=spf1 ") {
+			records = append(records, txt)
+		}
+	}
+	if len(records) > 1 {
+		return "", &spfError{spfPermError, fmt.Sprintf("%s publishes %d SPF records", domain, len(records))}
+	}
+	if len(records) == 0 {
+		return "", nil
+	}
+	return records[0], nil
+}
+
+// spfError carries the SPF result an evaluation ended with.
+type spfError struct {
+	result string
+	msg    string
+}
+
+func (e *spfError) Error() string { return e.msg }
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// spfChecker evaluates check_host() for one connection, keeping the lookup
+// counters that are shared across includes and redirects.
+type spfChecker struct {
+	dns    emailDNS
+	ip     net.IP
+	sender string // MAIL FROM, local@domain
+	helo   string
+	lookup int
+	voids  int
+}
+
+// checkHost returns the SPF result for the connecting IP and domain. The error,
+// if any, explains a permerror or temperror.
+func (c *spfChecker) checkHost(ctx context.Context, domain string) (string, error) {
+	record, err := lookupSPF(ctx, c.dns, domain)
+	if err != nil {
+		return err.(*spfError).result, err
+	}
+	if record == "" {
+		return spfNone, nil
+	}
+	r, err := parseSPF(record)
+	if err != nil {
+		return spfPermError, fmt.Errorf("%s: %w", domain, err)
+	}
+
+	for _, t := range r.terms {
+		matched, err := c.match(ctx, domain, t)
+		if err != nil {
+			var se *spfError
+			if errors.As(err, &se) {
+				return se.result, err
+			}
+			return spfPermError, err
+		}
+		if matched {
+			return qualifierResult(t.qualifier), nil
+		}
+	}
+
+	if r.redirect != "" {
+		if err := c.count(); err != nil {
+			return spfPermError, err
+		}
+		target, err := c.expand(r.redirect, domain)
+		if err != nil {
+			return spfPermError, err
+		}
+		result, err := c.checkHost(ctx, target)
+		if result == spfNone {
+			return spfPermError, fmt.Errorf("redirect target %s has no SPF record", target)
+		}
+		return result, err
+	}
+	return spfNeutral, nil
+}
+
+func (c *spfChecker) match(ctx context.Context, domain string, t spfTerm) (bool, error) {
+	switch t.mechanism {
+	case "all":
+		return true, nil
+	case "ip4", "ip6":
+		return t.network.Contains(c.ip), nil
+	}
+
+	if err := c.count(); err != nil {
+		return false, err
+	}
+	target := domain
+	if t.domain != "" {
+		var err error
+		if target, err = c.expand(t.domain, domain); err != nil {
+			return false, err
+		}
+	}
+
+	switch t.mechanism {
+	case "include":
+		result, err := c.checkHost(ctx, target)
+		switch result {
+		case spfPass:
+			return true, nil
+		case spfFail, spfSoftFail, spfNeutral:
+			return false, nil
+		case spfNone:
+			return false, &spfError{spfPermError, fmt.Sprintf("included domain %s has no SPF record", target)}
+		default:
+			msg := fmt.Sprintf("include of %s: %s", target, result)
+			if err != nil {
+				msg = err.Error()
+			}
+			return false, &spfError{result, msg}
+		}
+
+	case "a":
+		ips, err := c.lookupIPs(ctx, target)
+		if err != nil {
+			return false, err
+		}
+		return c.inAny(ips, t), nil
+
+	case "mx":
+		mxs, err := c.dns.LookupMX(ctx, target)
+		if err := c.checkVoid(len(mxs), err, target); err != nil {
+			return false, err
+		}
+		if len(mxs) > spfMaxMXHosts {
+			return false, &spfError{spfPermError, fmt.Sprintf("%s has more than %d MX hosts", target, spfMaxMXHosts)}
+		}
+		for _, mx := range mxs {
+			ips, err := c.lookupIPs(ctx, strings.TrimSuffix(mx.Host, "."))
+			if err != nil {
+				return false, err
+			}
+			if c.inAny(ips, t) {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case "exists":
+		ips, err := c.lookupIPs(ctx, target)
+		if err != nil {
+			return false, err
+		}
+		for _, ip := range ips {
+			if ip.To4() != nil {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	// ptr is deprecated (RFC 7208 5.5) and costly to validate; it never matches.
+	return false, nil
+}
+
+func (c *spfChecker) count() error {
+	if c.lookup++; c.lookup > spfMaxLookups {
+		return &spfError{spfPermError, fmt.Sprintf("more than %d DNS lookups", spfMaxLookups)}
+	}
+	return nil
+}
+
+// checkVoid counts lookups that found nothing and converts lookup failures.
+func (c *spfChecker) checkVoid(n int, err error, name string) error {
+	if err != nil && !isNotFound(err) {
+		return &spfError{spfTempError, fmt.Sprintf("lookup of %s failed: %v", name, err)}
+	}
+	if n == 0 {
+		if c.voids++; c.voids > spfMaxVoidLookups {
+			return &spfError{spfPermError, fmt.Sprintf("more than %d void lookups", spfMaxVoidLookups)}
+		}
+	}
+	return nil
+}
+
+func (c *spfChecker) lookupIPs(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := c.dns.LookupIPAddr(ctx, host)
+	if err := c.checkVoid(len(addrs), err, host); err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, a.IP)
+	}
+	return ips, nil
+}
+
+func (c *spfChecker) inAny(ips []net.IP, t spfTerm) bool {
+	for _, ip := range ips {
+		bits, prefix := 128, t.cidr6
+		if ip.To4() != nil {
+			ip, bits, prefix = ip.To4(), 32, t.cidr4
+		}
+		network := &net.IPNet{IP: ip.Mask(net.CIDRMask(prefix, bits)), Mask: net.CIDRMask(prefix, bits)}
+		if network.Contains(c.ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand applies RFC 7208 section 7 macros to a domain spec.
+func (c *spfChecker) expand(spec, domain string) (string, error) {
+	if !strings.Contains(spec, "%") {
+		return strings.TrimSuffix(spec, "."), nil
+	}
+	local, senderDomain, _ := strings.Cut(c.sender, "@")
+	if senderDomain == "" {
+		local, senderDomain = "postmaster", c.sender
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			b.WriteByte(spec[i])
+			continue
+		}
+		if i+1 >= len(spec) {
+			return "", &spfError{spfPermError, fmt.Sprintf("truncated macro in %q", spec)}
+		}
+		i++
+		switch spec[i] {
+		case '%':
+			b.WriteByte('%')
+			continue
+		case '_':
+			b.WriteByte(' ')
+			continue
+		case '-':
+			b.WriteString("%20")
+			continue
+		case '{':
+		default:
+			return "", &spfError{spfPermError, fmt.Sprintf("invalid macro in %q", spec)}
+		}
+		end := strings.IndexByte(spec[i:], '}')
+		if end < 2 {
+			return "", &spfError{spfPermError, fmt.Sprintf("invalid macro in %q", spec)}
+		}
+		macro := spec[i+1 : i+end]
+		i += end
+
+		var value string
+		switch strings.ToLower(macro[:1]) {
+		case "s":
+			value = c.sender
+		case "l":
+			value = local
+		case "o":
+			value = senderDomain
+		case "d":
+			value = domain
+		case "i":
+			value = spfIPMacro(c.ip)
+		case "p":
+			value = "unknown"
+		case "v":
+			value = "in-addr"
+			if c.ip.To4() == nil {
+				value = "ip6"
+			}
+		case "h":
+			value = c.helo
+		default:
+			return "", &spfError{spfPermError, fmt.Sprintf("unknown macro letter in %q", spec)}
+		}
+		transformed, err := transformMacro(value, macro[1:])
+		if err != nil {
+			return "", &spfError{spfPermError, fmt.Sprintf("%v in %q", err, spec)}
+		}
+		b.WriteString(transformed)
+	}
+
+	out := strings.TrimSuffix(b.String(), ".")
+	for len(out) > 253 {
+		_, rest, ok := strings.Cut(out, ".")
+		if !ok {
+			break
+		}
+		out = rest
+	}
+	return out, nil
+}
+
+// transformMacro applies the digit, "r" and delimiter transformers.
+func transformMacro(value, transformers string) (string, error) {
+	i := 0
+	for i < len(transformers) && transformers[i] >= '0' && transformers[i] <= '9' {
+		i++
+	}
+	keep := 0
+	if i > 0 {
+		n, err := strconv.Atoi(transformers[:i])
+		if err != nil || n == 0 {
+			return "", fmt.Errorf("invalid macro transformer")
+		}
+		keep = n
+	}
+	reverse := false
+	if i < len(transformers) && (transformers[i] == 'r' || transformers[i] == 'R') {
+		reverse = true
+		i++
+	}
+	delims := transformers[i:]
+	if strings.Trim(delims, ".-+,/_=") != "" {
+		return "", fmt.Errorf("invalid macro delimiter")
+	}
+	if delims == "" {
+		delims = "."
+	}
+
+	parts := strings.FieldsFunc(value, func(r rune) bool { return strings.ContainsRune(delims, r) })
+	if reverse {
+		for l, r := 0, len(parts)-1; l < r; l, r = l+1, r-1 {
+			parts[l], parts[r] = parts[r], parts[l]
+		}
+	}
+	if keep > 0 && keep < len(parts) {
+		parts = parts[len(parts)-keep:]
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// spfIPMacro renders %{i}: dotted quads for IPv4, dot-separated nibbles for IPv6.
+func spfIPMacro(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	const hex = "0123456789abcdef"
+	nibbles := make([]string, 0, 32)
+	for _, b := range ip.To16() {
+		nibbles = append(nibbles, string(hex[b>>4]), string(hex[b&0xf]))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+func qualifierResult(q byte) string {
+	switch q {
+	case '-':
+		return spfFail
+	case '~':
+		return spfSoftFail
+	case '?':
+		return spfNeutral
+	}
+	return spfPass
+}
+
+// spfPolicy describes a domain's SPF record without a connecting IP: it follows
+// include and redirect chains to count DNS lookups against the RFC limit and to
+// find the "all" that ends up applying.
+func spfPolicy(ctx context.Context, dns emailDNS, domain string) *models.SPFPolicy {
+	record, err := lookupSPF(ctx, dns, domain)
+	if err != nil {
+		return &models.SPFPolicy{Errors: []string{err.Error()}}
+	}
+	if record == "" {
+		return nil
+	}
+	p := &models.SPFPolicy{Record: record}
+	w := &spfWalker{dns: dns, policy: p, visited: map[string]bool{strings.ToLower(domain): true}}
+	p.All = w.walk(ctx, domain, record, 0)
+	if p.DNSLookups > spfMaxLookups {
+		p.Errors = append(p.Errors, fmt.Sprintf("%d DNS lookups exceed the limit of %d", p.DNSLookups, spfMaxLookups))
+	}
+	if p.VoidLookups > spfMaxVoidLookups {
+		p.Errors = append(p.Errors, fmt.Sprintf("%d void lookups exceed the limit of %d", p.VoidLookups, spfMaxVoidLookups))
+	}
+	return p
+}
+
+type spfWalker struct {
+	dns     emailDNS
+	policy  *models.SPFPolicy
+	visited map[string]bool
+}
+
+// walk returns the qualifier of the "all" that applies to record, or "" when
+// evaluation would end neutral.
+func (w *spfWalker) walk(ctx context.Context, domain, record string, depth int) string {
+	r, err := parseSPF(record)
+	if err != nil {
+		w.policy.Errors = append(w.policy.Errors, fmt.Sprintf("%s: %v", domain, err))
+		return ""
+	}
+	all := ""
+	for _, t := range r.terms {
+		switch t.mechanism {
+		case "all":
+			if all == "" {
+				all = string(t.qualifier)
+			}
+		case "include":
+			w.policy.DNSLookups++
+			w.policy.Includes = append(w.policy.Includes, t.domain)
+			w.follow(ctx, t.domain, "include", depth)
+		case "a", "mx", "exists", "ptr":
+			w.policy.DNSLookups++
+			if t.mechanism == "ptr" {
+				w.policy.Errors = append(w.policy.Errors, fmt.Sprintf("%s uses the deprecated ptr mechanism", domain))
+			}
+		}
+	}
+	if r.redirect != "" {
+		w.policy.DNSLookups++
+		if depth == 0 {
+			w.policy.Redirect = r.redirect
+		}
+		// A redirect only applies when no "all" is present.
+		if inner := w.follow(ctx, r.redirect, "redirect", depth); all == "" {
+			all = inner
+		}
+	}
+	return all
+}
+
+func (w *spfWalker) follow(ctx context.Context, target, kind string, depth int) string {
+	if strings.Contains(target, "%") {
+		return "" // Depends on the sender; cannot be expanded statically
+	}
+	key := strings.ToLower(strings.TrimSuffix(target, "."))
+	if w.visited[key] || depth >= spfMaxLookups {
+		w.policy.Errors = append(w.policy.Errors, fmt.Sprintf("%s loop through %s", kind, target))
+		return ""
+	}
+	// Only the current chain counts as a loop; two includes may share a target.
+	w.visited[key] = true
+	defer delete(w.visited, key)
+	record, err := lookupSPF(ctx, w.dns, key)
+	if err != nil {
+		w.policy.Errors = append(w.policy.Errors, err.Error())
+		return ""
+	}
+	if record == "" {
+		w.policy.VoidLookups++
+		w.policy.Errors = append(w.policy.Errors, fmt.Sprintf("%s target %s has no SPF record", kind, target))
+		return ""
+	}
+	return w.walk(ctx, key, record, depth+1)
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"net-zilla/internal/models" // Added import
@@ -16,22 +21,52 @@ import (
 
 // SSLAnalyzer performs comprehensive TLS/SSL analysis of a given host.
 type SSLAnalyzer struct {
-	logger  *logger.Logger
-	timeout time.Duration
+	logger        *logger.Logger
+	timeout       time.Duration
+	port          string
+	fingerprinter *TLSFingerprinter
+	cassette      *Cassette // Optional record/replay of handshake results
 }
 
 // NewSSLAnalyzer creates and initializes a new SSLAnalyzer.
 func NewSSLAnalyzer(logger *logger.Logger) *SSLAnalyzer {
 	return &SSLAnalyzer{
-		logger:  logger,
-		timeout: 15 * time.Second, // Default timeout for TLS handshakes
+		logger:        logger,
+		timeout:       15 * time.Second, // Default timeout for TLS handshakes
+		port:          "443",
+		fingerprinter: NewTLSFingerprinter(logger),
 	}
 }
 
+// SetPort overrides the TCP port used for handshakes and fingerprinting.
+func (sa *SSLAnalyzer) SetPort(port int) {
+	sa.port = strconv.Itoa(port)
+	sa.fingerprinter.SetPort(port)
+}
+
+// SetCassette records or replays handshakes and fingerprint probes through c.
+// Replay also evaluates certificate expiry at the recording time.
+func (sa *SSLAnalyzer) SetCassette(c *Cassette) {
+	sa.cassette = c
+	sa.fingerprinter.SetCassette(c)
+}
+
+// Fingerprinter exposes the JARM/JA3S fingerprinter, e.g. to load known-bad lists.
+func (sa *SSLAnalyzer) Fingerprinter() *TLSFingerprinter {
+	return sa.fingerprinter
+}
+
 // Analyze performs a comprehensive TLS/SSL analysis for the specified host.
 func (sa *SSLAnalyzer) Analyze(ctx context.Context, host string) (*models.TLSAnalysis, error) {
 	analysis := &models.TLSAnalysis{}
 
+	// Fingerprint the server stack alongside the protocol and certificate
+	// checks, so the JARM probes do not wait for them and are not cut short
+	// when they use up most of ctx. The fingerprint is taken regardless of
+	// certificate validation, since phishing infrastructure frequently
+	// presents certificates that fail it.
+	fingerprinted := sa.startFingerprint(ctx, host)
+
 	// Test different TLS versions and collect supported protocols
 	protocols := []struct {
 		name    string
@@ -49,20 +84,32 @@ func (sa *SSLAnalyzer) Analyze(ctx context.Context, host string) (*models.TLSAna
 		}
 	}
 
-	// Get certificate details
-	cert, err := sa.getCertificate(ctx, host)
-	if err != nil {
-		sa.logger.Warn("Failed to get certificate for %s: %v", host, err)
-		analysis.CertificateValid = false // Mark as invalid if we can't even get it
-		return analysis, fmt.Errorf("failed to retrieve certificate: %w", err)
+	// Get certificate details. A certificate that fails verification, such as a
+	// self-signed one, is fetched again unverified so it can still be described.
+	cert, verifyErr := sa.getCertificate(ctx, host)
+	if verifyErr != nil {
+		var err error
+		if cert, err = sa.getUnverifiedCertificate(ctx, host); err != nil {
+			sa.logger.Warn("Failed to get certificate for %s: %v", host, verifyErr)
+			analysis.CertificateValid = false // Mark as invalid if we can't even get it
+			fingerprinted(analysis)
+			return analysis, fmt.Errorf("failed to retrieve certificate: %w", verifyErr)
+		}
 	}
 
+	now := sa.cassette.Now()
 	analysis.Issuer = cert.Issuer.String()
 	analysis.Subject = cert.Subject.String()
-	analysis.ExpiresIn = time.Until(cert.NotAfter)
+	fingerprint := sha256.Sum256(cert.Raw)
+	analysis.Fingerprint = hex.EncodeToString(fingerprint[:])
+	analysis.ExpiresIn = cert.NotAfter.Sub(now)
+	analysis.ExpiresInDays = int(analysis.ExpiresIn.Hours() / 24)
 
 	// Validate certificate (basic check for now)
-	if time.Now().After(cert.NotAfter) || time.Now().Before(cert.NotBefore) {
+	if verifyErr != nil {
+		analysis.CertificateValid = false
+		analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("Certificate failed verification: %v", verifyErr))
+	} else if now.After(cert.NotAfter) || now.Before(cert.NotBefore) {
 		analysis.CertificateValid = false
 		analysis.Warnings = append(analysis.Warnings, "Certificate is expired or not yet valid")
 	} else {
@@ -70,7 +117,7 @@ func (sa *SSLAnalyzer) Analyze(ctx context.Context, host string) (*models.TLSAna
 	}
 
 	// Analyze certificate strength and grade
-	analysis.EncryptionGrade = sa.gradeCertificate(cert)
+	analysis.EncryptionGrade = sa.gradeCertificate(cert, now)
 	analysis.HasWeakCiphers = sa.checkWeakCiphers(ctx, host)
 	if analysis.HasWeakCiphers {
 		analysis.Warnings = append(analysis.Warnings, "Server supports weak cipher suites")
@@ -79,14 +126,62 @@ func (sa *SSLAnalyzer) Analyze(ctx context.Context, host string) (*models.TLSAna
 	analysis.OCSPStapling = false // Default
 	analysis.HSTSEnabled = false  // Default
 
+	fingerprinted(analysis)
 	return analysis, nil
 }
 
+// startFingerprint starts fingerprinting host in the background and returns a
+// function that waits for the fingerprint and records it on an analysis.
+func (sa *SSLAnalyzer) startFingerprint(ctx context.Context, host string) func(*models.TLSAnalysis) {
+	if sa.fingerprinter == nil {
+		return func(*models.TLSAnalysis) {}
+	}
+
+	var fp *TLSFingerprint
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fp, err = sa.fingerprinter.Fingerprint(ctx, host)
+	}()
+	return func(analysis *models.TLSAnalysis) {
+		<-done
+		sa.applyFingerprint(host, fp, err, analysis)
+	}
+}
+
+// applyFingerprint records JARM/JA3S fingerprints and known-bad matches on the
+// analysis, including those of a fingerprint the context cut short.
+func (sa *SSLAnalyzer) applyFingerprint(host string, fp *TLSFingerprint, err error, analysis *models.TLSAnalysis) {
+	if err != nil {
+		sa.logger.Warn("TLS fingerprinting failed for %s: %v", host, err)
+		if fp == nil {
+			return
+		}
+	}
+	if fp.Incomplete {
+		analysis.Warnings = append(analysis.Warnings, "TLS fingerprint is incomplete: analysis time ran out before every JARM probe was answered")
+	}
+
+	analysis.JARM = fp.JARM
+	analysis.JA3S = fp.JA3S
+	analysis.JA3SString = fp.JA3SString
+	analysis.ProbeResponses = fp.Responses
+	analysis.FingerprintMatches = fp.Matches
+
+	for _, m := range fp.Matches {
+		label := m.Label
+		if label == "" {
+			label = "unlabelled entry"
+		}
+		analysis.Warnings = append(analysis.Warnings,
+			fmt.Sprintf("Server %s fingerprint matches known-bad infrastructure: %s", strings.ToUpper(m.Type), label))
+	}
+}
+
 // testProtocol attempts to establish a TLS connection using a specific protocol version.
 func (sa *SSLAnalyzer) testProtocol(ctx context.Context, host string, version uint16) bool {
-	conn, err := tls.DialWithDialer(&net.Dialer{
-		Timeout: sa.timeout,
-	}, "tcp", net.JoinHostPort(host, "443"), &tls.Config{
+	_, err := sa.handshake(ctx, host, &tls.Config{
 		InsecureSkipVerify: true, // We're just testing support, not validating
 		MinVersion:         version,
 		MaxVersion:         version,
@@ -96,25 +191,20 @@ func (sa *SSLAnalyzer) testProtocol(ctx context.Context, host string, version ui
 		// sa.logger.Debug("Failed to connect with TLS version %s for %s: %v", tls.VersionName(version), host, err)
 		return false
 	}
-	defer conn.Close()
 
 	return true
 }
 
 // getCertificate retrieves the server's primary SSL certificate.
 func (sa *SSLAnalyzer) getCertificate(ctx context.Context, host string) (*x509.Certificate, error) {
-	conn, err := tls.DialWithDialer(&net.Dialer{
-		Timeout: sa.timeout,
-	}, "tcp", net.JoinHostPort(host, "443"), &tls.Config{
+	state, err := sa.handshake(ctx, host, &tls.Config{
 		InsecureSkipVerify: false, // Verify certificate to retrieve it
 	})
 
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
 
-	state := conn.ConnectionState()
 	if len(state.PeerCertificates) == 0 {
 		return nil, fmt.Errorf("no certificates presented by %s", host)
 	}
@@ -122,10 +212,23 @@ func (sa *SSLAnalyzer) getCertificate(ctx context.Context, host string) (*x509.C
 	return state.PeerCertificates[0], nil
 }
 
+// getUnverifiedCertificate retrieves the server's primary certificate without
+// verifying it.
+func (sa *SSLAnalyzer) getUnverifiedCertificate(ctx context.Context, host string) (*x509.Certificate, error) {
+	state, err := sa.handshake(ctx, host, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("no certificates presented by %s", host)
+	}
+	return state.PeerCertificates[0], nil
+}
+
 // gradeCertificate provides a simple grade based on certificate properties.
-func (sa *SSLAnalyzer) gradeCertificate(cert *x509.Certificate) string {
+func (sa *SSLAnalyzer) gradeCertificate(cert *x509.Certificate, now time.Time) string {
 	// Simple grading based on key strength and expiration
-	remaining := time.Until(cert.NotAfter)
+	remaining := cert.NotAfter.Sub(now)
 
 	if remaining < 30*24*time.Hour { // Expires in less than a month
 		return "F" // Expiring soon
@@ -164,9 +267,7 @@ func (sa *SSLAnalyzer) checkWeakCiphers(ctx context.Context, host string) bool {
 
 	for _, cipher := range weakCiphers {
 		// Attempt to connect with the weak cipher suite
-		conn, err := tls.DialWithDialer(&net.Dialer{
-			Timeout: sa.timeout,
-		}, "tcp", net.JoinHostPort(host, "443"), &tls.Config{
+		_, err := sa.handshake(ctx, host, &tls.Config{
 			InsecureSkipVerify: true, // Not verifying, just checking if connection establishes
 			CipherSuites:       []uint16{cipher},
 			MinVersion:         tls.VersionTLS10, // Some weak ciphers might only work with older TLS versions
@@ -174,10 +275,67 @@ func (sa *SSLAnalyzer) checkWeakCiphers(ctx context.Context, host string) bool {
 		})
 
 		if err == nil {
-			conn.Close()
 			return true // Connection successful with a weak cipher
 		}
 	}
 
 	return false
 }
+
+// recordedTLSState is the cassette form of a handshake: what was negotiated and
+// the DER bytes of the certificates the server presented.
+type recordedTLSState struct {
+	Version      uint16   `json:"version"`
+	CipherSuite  uint16   `json:"cipher_suite"`
+	Certificates [][]byte `json:"certificates"`
+}
+
+// handshake completes a TLS handshake with host and returns the negotiated state.
+// Both the dial and the handshake end when ctx does, and each is also bounded
+// by the analyzer's timeout. Handshakes cannot be replayed at the byte level,
+// so the cassette stores their outcome instead, keyed by the parameters the
+// client offered.
+func (sa *SSLAnalyzer) handshake(ctx context.Context, host string, cfg *tls.Config) (*tls.ConnectionState, error) {
+	addr := net.JoinHostPort(host, sa.port)
+	key := fmt.Sprintf("%s versions=%#04x-%#04x ciphers=%x verify=%t", addr, cfg.MinVersion, cfg.MaxVersion, cfg.CipherSuites, !cfg.InsecureSkipVerify)
+
+	data, err := sa.cassette.exchange("tls", key, func() ([]byte, error) {
+		ctx, cancel := context.WithTimeout(ctx, sa.timeout)
+		defer cancel()
+		dialer := &tls.Dialer{NetDialer: &net.Dialer{}, Config: cfg}
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+
+		state := conn.(*tls.Conn).ConnectionState()
+		recorded := recordedTLSState{Version: state.Version, CipherSuite: state.CipherSuite}
+		for _, cert := range state.PeerCertificates {
+			recorded.Certificates = append(recorded.Certificates, cert.Raw)
+		}
+		return json.Marshal(recorded)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded recordedTLSState
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return nil, fmt.Errorf("corrupt handshake record for %s: %w", addr, err)
+	}
+	state := &tls.ConnectionState{
+		Version:           recorded.Version,
+		CipherSuite:       recorded.CipherSuite,
+		HandshakeComplete: true,
+		ServerName:        host,
+	}
+	for _, der := range recorded.Certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate from %s: %w", addr, err)
+		}
+		state.PeerCertificates = append(state.PeerCertificates, cert)
+	}
+	return state, nil
+}
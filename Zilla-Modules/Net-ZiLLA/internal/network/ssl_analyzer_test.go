@@ -1,11 +1,19 @@
 package network
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -56,9 +64,70 @@ func TestSSLAnalyzer_GradeCertificate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := sa.gradeCertificate(tt.cert); got != tt.want {
+			if got := sa.gradeCertificate(tt.cert, time.Now()); got != tt.want {
 				t.Errorf("gradeCertificate() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestSSLAnalyzer_HandshakeStopsWithContext(t *testing.T) {
+	// A server that accepts connections but never answers the ClientHello
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	sa := NewSSLAnalyzer(logger.NewLogger())
+	sa.SetPort(ln.Addr().(*net.TCPAddr).Port)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := sa.handshake(ctx, "127.0.0.1", &tls.Config{InsecureSkipVerify: true}); err == nil {
+		t.Fatal("expected the handshake with a silent server to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("handshake took %v after its context expired", elapsed)
+	}
+}
+
+func TestSSLAnalyzer_SelfSignedCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	sa := NewSSLAnalyzer(logger.NewLogger())
+	sa.SetPort(server.Listener.Addr().(*net.TCPAddr).Port)
+	analysis, err := sa.Analyze(context.Background(), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("expected the self-signed certificate to be described, got %v", err)
+	}
+
+	cert := server.Certificate()
+	sum := sha256.Sum256(cert.Raw)
+	if analysis.Fingerprint != hex.EncodeToString(sum[:]) || analysis.Subject != cert.Subject.String() {
+		t.Errorf("expected the server's certificate, got subject %q fingerprint %s", analysis.Subject, analysis.Fingerprint)
+	}
+	if analysis.CertificateValid {
+		t.Error("a self-signed certificate was marked valid")
+	}
+	if len(analysis.Warnings) == 0 || !strings.HasPrefix(analysis.Warnings[0], "Certificate failed verification") {
+		t.Errorf("expected a verification warning, got %q", analysis.Warnings)
+	}
+}
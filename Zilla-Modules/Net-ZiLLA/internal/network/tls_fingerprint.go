@@ -0,0 +1,701 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
+)
+
+// TLSFingerprinter actively fingerprints TLS servers by sending the fixed
+// series of ClientHellos defined by JARM and recording how the server answers.
+// The resulting fingerprints cluster servers that share the same TLS stack and
+// configuration, which is how phishing kits behind common C2/proxy software
+// give themselves away.
+type TLSFingerprinter struct {
+	logger   *logger.Logger
+	timeout  time.Duration
+	port     string
+	cassette *Cassette // Optional record/replay of probe replies
+
+	knownBad map[string]models.FingerprintMatch
+	mu       sync.RWMutex
+}
+
+// TLSFingerprint is the outcome of a full JARM probe run against one host.
+type TLSFingerprint struct {
+	JARM       string
+	JA3S       string
+	JA3SString string
+	Responses  []models.TLSProbeResponse
+	Matches    []models.FingerprintMatch
+	Incomplete bool // The context ended before every probe was answered
+}
+
+// jarmProbe mirrors one row of the JARM reference probe table.
+type jarmProbe struct {
+	name           string
+	version        string // "TLS_1.1", "TLS_1.2" or "TLS_1.3"
+	cipherList     string // "ALL" or "NO1.3"
+	cipherOrder    string
+	grease         bool
+	rareALPN       bool
+	supportVersion string // "1.2_SUPPORT", "1.3_SUPPORT" or "NO_SUPPORT"
+	extensionOrder string
+}
+
+// jarmProbes is the fixed, ordered probe set. Changing the order or content of
+// any entry produces fingerprints that are incompatible with public JARM data.
+var jarmProbes = []jarmProbe{
+	{"tls1_2_forward", "TLS_1.2", "ALL", "FORWARD", false, false, "1.2_SUPPORT", "REVERSE"},
+	{"tls1_2_reverse", "TLS_1.2", "ALL", "REVERSE", false, false, "1.2_SUPPORT", "FORWARD"},
+	{"tls1_2_top_half", "TLS_1.2", "ALL", "TOP_HALF", false, false, "NO_SUPPORT", "FORWARD"},
+	{"tls1_2_bottom_half", "TLS_1.2", "ALL", "BOTTOM_HALF", false, true, "NO_SUPPORT", "FORWARD"},
+	{"tls1_2_middle_out", "TLS_1.2", "ALL", "MIDDLE_OUT", true, true, "NO_SUPPORT", "REVERSE"},
+	{"tls1_1_middle_out", "TLS_1.1", "ALL", "FORWARD", false, false, "NO_SUPPORT", "FORWARD"},
+	{"tls1_3_forward", "TLS_1.3", "ALL", "FORWARD", false, false, "1.3_SUPPORT", "REVERSE"},
+	{"tls1_3_reverse", "TLS_1.3", "ALL", "REVERSE", false, false, "1.3_SUPPORT", "FORWARD"},
+	{"tls1_3_invalid", "TLS_1.3", "NO1.3", "FORWARD", false, false, "1.3_SUPPORT", "FORWARD"},
+	{"tls1_3_middle_out", "TLS_1.3", "ALL", "MIDDLE_OUT", true, false, "1.3_SUPPORT", "REVERSE"},
+}
+
+// jarmCiphers is the full JARM cipher offer in FORWARD order.
+var jarmCiphers = []uint16{
+	0x0016, 0x0033, 0x0067, 0xc09e, 0xc0a2, 0x009e, 0x0039, 0x006b, 0xc09f, 0xc0a3,
+	0x009f, 0x0045, 0x00be, 0x0088, 0x00c4, 0x009a, 0xc008, 0xc009, 0xc023, 0xc0ac,
+	0xc0ae, 0xc02b, 0xc00a, 0xc024, 0xc0ad, 0xc0af, 0xc02c, 0xc072, 0xc073, 0xcca9,
+	0x1302, 0x1301, 0xcc14, 0xc007, 0xc012, 0xc013, 0xc027, 0xc02f, 0xc014, 0xc028,
+	0xc030, 0xc060, 0xc061, 0xc076, 0xc077, 0xcca8, 0x1305, 0x1304, 0x1303, 0xcc13,
+	0xc011, 0x000a, 0x002f, 0x003c, 0xc09c, 0xc0a0, 0x009c, 0x0035, 0x003d, 0xc09d,
+	0xc0a1, 0x009d, 0x0041, 0x00ba, 0x0084, 0x00c0, 0x0007, 0x0004, 0x0005,
+}
+
+// jarmCipherIndex is the sorted cipher table used to compress a selected
+// cipher into two hex characters of the fuzzy hash.
+var jarmCipherIndex = []uint16{
+	0x0004, 0x0005, 0x0007, 0x000a, 0x0016, 0x002f, 0x0033, 0x0035, 0x0039, 0x003c,
+	0x003d, 0x0041, 0x0045, 0x0067, 0x006b, 0x0084, 0x0088, 0x009a, 0x009c, 0x009d,
+	0x009e, 0x009f, 0x00ba, 0x00be, 0x00c0, 0x00c4, 0xc007, 0xc008, 0xc009, 0xc00a,
+	0xc011, 0xc012, 0xc013, 0xc014, 0xc023, 0xc024, 0xc027, 0xc028, 0xc02b, 0xc02c,
+	0xc02f, 0xc030, 0xc060, 0xc061, 0xc072, 0xc073, 0xc076, 0xc077, 0xc09c, 0xc09d,
+	0xc09e, 0xc09f, 0xc0a0, 0xc0a1, 0xc0a2, 0xc0a3, 0xc0ac, 0xc0ad, 0xc0ae, 0xc0af,
+	0xcc13, 0xcc14, 0xcca8, 0xcca9, 0x1301, 0x1302, 0x1303, 0x1304, 0x1305,
+}
+
+var (
+	jarmALPNs = []string{"http/0.9", "http/1.0", "http/1.1", "spdy/1", "spdy/2", "spdy/3", "h2", "h2c", "hq"}
+	// The rare list deliberately omits http/1.1 and h2 so servers fall back to unusual choices.
+	jarmRareALPNs = []string{"http/0.9", "http/1.0", "spdy/1", "spdy/2", "spdy/3", "h2c", "hq"}
+)
+
+// jarmReadLimit matches the single recv() size of the reference scanner.
+const jarmReadLimit = 1484
+
+// emptyJARM is reported when the server did not answer any probe.
+var emptyJARM = strings.Repeat("0", 62)
+
+// NewTLSFingerprinter creates a fingerprinter probing port 443.
+func NewTLSFingerprinter(logger *logger.Logger) *TLSFingerprinter {
+	return &TLSFingerprinter{
+		logger:   logger,
+		timeout:  5 * time.Second,
+		port:     "443",
+		knownBad: make(map[string]models.FingerprintMatch),
+	}
+}
+
+// SetCassette records or replays the raw probe replies through c.
+func (tf *TLSFingerprinter) SetCassette(c *Cassette) {
+	tf.cassette = c
+}
+
+// SetPort overrides the TCP port that probes are sent to.
+func (tf *TLSFingerprinter) SetPort(port int) {
+	tf.port = strconv.Itoa(port)
+}
+
+// Fingerprint runs all JARM probes against host and returns the JARM and JA3S
+// fingerprints together with any known-bad matches. A host that never answers
+// yields the all-zero JARM rather than an error. When ctx ends first, the
+// probes not answered by then count as unanswered and the incomplete
+// fingerprint is returned together with the context's error. Its JARM is not
+// matched against the known-bad list, since it does not describe the whole
+// stack, but its JA3S still is.
+func (tf *TLSFingerprinter) Fingerprint(ctx context.Context, host string) (*TLSFingerprint, error) {
+	result := &TLSFingerprint{}
+	raw := make([]string, 0, len(jarmProbes))
+
+	for _, probe := range jarmProbes {
+		hello, err := buildJARMClientHello(host, probe)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s probe: %w", probe.name, err)
+		}
+
+		var data []byte
+		if ctx.Err() == nil {
+			data, err = tf.cassette.exchange("jarm", net.JoinHostPort(host, tf.port)+" "+probe.name, func() ([]byte, error) {
+				return tf.sendProbe(ctx, host, hello)
+			})
+			if err != nil && tf.logger != nil {
+				tf.logger.Debug("JARM probe %s to %s failed: %v", probe.name, host, err)
+			}
+		}
+
+		hs := parseServerHello(data)
+		raw = append(raw, hs.jarmComponent())
+		result.Responses = append(result.Responses, hs.toProbeResponse(probe.name))
+
+		// JA3S is taken from the first probe, which offers the broadest
+		// TLS 1.2 ClientHello and so best represents the server's defaults.
+		if result.JA3S == "" && hs.responded {
+			result.JA3SString = hs.ja3sString()
+			sum := md5.Sum([]byte(result.JA3SString))
+			result.JA3S = hex.EncodeToString(sum[:])
+		}
+	}
+
+	result.JARM = jarmHash(raw)
+	if err := ctx.Err(); err != nil {
+		result.Incomplete = true
+		result.Matches = tf.MatchKnownBad("", result.JA3S)
+		return result, err
+	}
+	result.Matches = tf.MatchKnownBad(result.JARM, result.JA3S)
+	return result, nil
+}
+
+// sendProbe writes one ClientHello and reads the first TLS record of the reply.
+func (tf *TLSFingerprinter) sendProbe(ctx context.Context, host string, hello []byte) ([]byte, error) {
+	dialer := &net.Dialer{Timeout: tf.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, tf.port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(tf.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	// Deadlines only cover ctx's deadline; close the connection when ctx is
+	// cancelled too, so a stalled read ends with it.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := conn.Write(hello); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	recordLen := int(binary.BigEndian.Uint16(header[3:5]))
+	if 5+recordLen > jarmReadLimit {
+		recordLen = jarmReadLimit - 5
+	}
+	body := make([]byte, recordLen)
+	n, err := io.ReadFull(conn, body)
+	return append(header, body[:n]...), err
+}
+
+// LoadKnownBadFingerprints loads a list of known-bad fingerprints from path.
+// Each non-empty, non-comment line has the form "type,fingerprint,label" where
+// type is "jarm" or "ja3s". Entries are added to any already loaded.
+func (tf *TLSFingerprinter) LoadKnownBadFingerprints(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open fingerprint list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ",", 3)
+		if len(parts) < 2 {
+			return fmt.Errorf("%s:%d: expected type,fingerprint[,label]", path, lineNo)
+		}
+		match := models.FingerprintMatch{
+			Type:        strings.ToLower(strings.TrimSpace(parts[0])),
+			Fingerprint: strings.ToLower(strings.TrimSpace(parts[1])),
+		}
+		if len(parts) == 3 {
+			match.Label = strings.TrimSpace(parts[2])
+		}
+		if match.Type != "jarm" && match.Type != "ja3s" {
+			return fmt.Errorf("%s:%d: unknown fingerprint type %q", path, lineNo, match.Type)
+		}
+		tf.AddKnownBad(match)
+	}
+	return scanner.Err()
+}
+
+// AddKnownBad registers a single known-bad fingerprint.
+func (tf *TLSFingerprinter) AddKnownBad(match models.FingerprintMatch) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	tf.knownBad[match.Type+":"+strings.ToLower(match.Fingerprint)] = match
+}
+
+// MatchKnownBad returns the known-bad entries matching the given fingerprints.
+// The all-zero JARM of an unresponsive host never matches.
+func (tf *TLSFingerprinter) MatchKnownBad(jarm, ja3s string) []models.FingerprintMatch {
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
+
+	var matches []models.FingerprintMatch
+	if jarm != "" && jarm != emptyJARM {
+		if m, ok := tf.knownBad["jarm:"+jarm]; ok {
+			matches = append(matches, m)
+		}
+	}
+	if ja3s != "" {
+		if m, ok := tf.knownBad["ja3s:"+ja3s]; ok {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// ============ CLIENT HELLO CONSTRUCTION ============
+
+func buildJARMClientHello(host string, probe jarmProbe) ([]byte, error) {
+	var recordVersion, helloVersion []byte
+	switch probe.version {
+	case "TLS_1.3":
+		recordVersion, helloVersion = []byte{0x03, 0x01}, []byte{0x03, 0x03}
+	case "TLS_1.1":
+		recordVersion, helloVersion = []byte{0x03, 0x02}, []byte{0x03, 0x02}
+	default:
+		recordVersion, helloVersion = []byte{0x03, 0x03}, []byte{0x03, 0x03}
+	}
+
+	random := make([]byte, 32)
+	sessionID := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(sessionID); err != nil {
+		return nil, err
+	}
+
+	ciphers, err := jarmCipherBytes(probe)
+	if err != nil {
+		return nil, err
+	}
+	extensions, err := jarmExtensions(host, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	hello := append([]byte{}, helloVersion...)
+	hello = append(hello, random...)
+	hello = append(hello, byte(len(sessionID)))
+	hello = append(hello, sessionID...)
+	hello = appendUint16(hello, len(ciphers))
+	hello = append(hello, ciphers...)
+	hello = append(hello, 0x01, 0x00) // one compression method: null
+	hello = append(hello, extensions...)
+
+	handshake := []byte{0x01, 0x00} // ClientHello, 24-bit length high byte
+	handshake = appendUint16(handshake, len(hello))
+	handshake = append(handshake, hello...)
+
+	record := []byte{0x16}
+	record = append(record, recordVersion...)
+	record = appendUint16(record, len(handshake))
+	return append(record, handshake...), nil
+}
+
+func jarmCipherBytes(probe jarmProbe) ([]byte, error) {
+	var list []uint16
+	for _, c := range jarmCiphers {
+		if probe.cipherList == "NO1.3" && c>>8 == 0x13 {
+			continue
+		}
+		list = append(list, c)
+	}
+	list = mungOrder(list, probe.cipherOrder)
+	if probe.grease {
+		g, err := randomGREASE()
+		if err != nil {
+			return nil, err
+		}
+		list = append([]uint16{g}, list...)
+	}
+
+	out := make([]byte, 0, len(list)*2)
+	for _, c := range list {
+		out = appendUint16(out, int(c))
+	}
+	return out, nil
+}
+
+func jarmExtensions(host string, probe jarmProbe) ([]byte, error) {
+	var ext []byte
+	if probe.grease {
+		g, err := randomGREASE()
+		if err != nil {
+			return nil, err
+		}
+		ext = appendUint16(ext, int(g))
+		ext = append(ext, 0x00, 0x00)
+	}
+
+	// server_name
+	ext = append(ext, 0x00, 0x00)
+	ext = appendUint16(ext, len(host)+5)
+	ext = appendUint16(ext, len(host)+3)
+	ext = append(ext, 0x00)
+	ext = appendUint16(ext, len(host))
+	ext = append(ext, host...)
+
+	ext = append(ext, 0x00, 0x17, 0x00, 0x00)                                                             // extended_master_secret
+	ext = append(ext, 0x00, 0x01, 0x00, 0x01, 0x01)                                                       // max_fragment_length
+	ext = append(ext, 0xff, 0x01, 0x00, 0x01, 0x00)                                                       // renegotiation_info
+	ext = append(ext, 0x00, 0x0a, 0x00, 0x0a, 0x00, 0x08, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18, 0x00, 0x19) // supported_groups
+	ext = append(ext, 0x00, 0x0b, 0x00, 0x02, 0x01, 0x00)                                                 // ec_point_formats
+	ext = append(ext, 0x00, 0x23, 0x00, 0x00)                                                             // session_ticket
+
+	ext = append(ext, jarmALPNExtension(probe)...)
+
+	ext = append(ext, 0x00, 0x0d, 0x00, 0x14, 0x00, 0x12, // signature_algorithms
+		0x04, 0x03, 0x08, 0x04, 0x04, 0x01, 0x05, 0x03, 0x08, 0x05,
+		0x05, 0x01, 0x08, 0x06, 0x06, 0x01, 0x02, 0x01)
+
+	keyShare, err := jarmKeyShare(probe.grease)
+	if err != nil {
+		return nil, err
+	}
+	ext = append(ext, keyShare...)
+	ext = append(ext, 0x00, 0x2d, 0x00, 0x02, 0x01, 0x01) // psk_key_exchange_modes
+
+	if probe.version == "TLS_1.3" || probe.supportVersion == "1.2_SUPPORT" {
+		versions, err := jarmSupportedVersions(probe)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, versions...)
+	}
+
+	return append(appendUint16(nil, len(ext)), ext...), nil
+}
+
+func jarmALPNExtension(probe jarmProbe) []byte {
+	names := jarmALPNs
+	if probe.rareALPN {
+		names = jarmRareALPNs
+	}
+	names = mungOrder(append([]string{}, names...), probe.extensionOrder)
+
+	var list []byte
+	for _, n := range names {
+		list = append(list, byte(len(n)))
+		list = append(list, n...)
+	}
+	ext := []byte{0x00, 0x10}
+	ext = appendUint16(ext, len(list)+2)
+	ext = appendUint16(ext, len(list))
+	return append(ext, list...)
+}
+
+func jarmKeyShare(grease bool) ([]byte, error) {
+	var share []byte
+	if grease {
+		g, err := randomGREASE()
+		if err != nil {
+			return nil, err
+		}
+		share = appendUint16(share, int(g))
+		share = append(share, 0x00, 0x01, 0x00)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	share = append(share, 0x00, 0x1d, 0x00, 0x20) // x25519, 32-byte key
+	share = append(share, key...)
+
+	ext := []byte{0x00, 0x33}
+	ext = appendUint16(ext, len(share)+2)
+	ext = appendUint16(ext, len(share))
+	return append(ext, share...), nil
+}
+
+func jarmSupportedVersions(probe jarmProbe) ([]byte, error) {
+	versions := []uint16{0x0301, 0x0302, 0x0303, 0x0304}
+	if probe.supportVersion == "1.2_SUPPORT" {
+		versions = versions[:3]
+	}
+	versions = mungOrder(versions, probe.extensionOrder)
+	if probe.grease {
+		g, err := randomGREASE()
+		if err != nil {
+			return nil, err
+		}
+		versions = append([]uint16{g}, versions...)
+	}
+
+	ext := []byte{0x00, 0x2b}
+	ext = appendUint16(ext, len(versions)*2+1)
+	ext = append(ext, byte(len(versions)*2))
+	for _, v := range versions {
+		ext = appendUint16(ext, int(v))
+	}
+	return ext, nil
+}
+
+// mungOrder reorders a list the way JARM reorders ciphers, ALPNs and versions.
+func mungOrder[T any](items []T, order string) []T {
+	n := len(items)
+	switch order {
+	case "REVERSE":
+		out := make([]T, n)
+		for i, v := range items {
+			out[n-1-i] = v
+		}
+		return out
+	case "BOTTOM_HALF":
+		if n%2 == 1 {
+			return append([]T{}, items[n/2+1:]...)
+		}
+		return append([]T{}, items[n/2:]...)
+	case "TOP_HALF":
+		var out []T
+		if n%2 == 1 {
+			out = append(out, items[n/2])
+		}
+		return append(out, mungOrder(mungOrder(items, "REVERSE"), "BOTTOM_HALF")...)
+	case "MIDDLE_OUT":
+		middle := n / 2
+		var out []T
+		if n%2 == 1 {
+			out = append(out, items[middle])
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle+i], items[middle-i])
+			}
+		} else {
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle-1+i], items[middle-i])
+			}
+		}
+		return out
+	default:
+		return items
+	}
+}
+
+func randomGREASE() (uint16, error) {
+	var b [1]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	nibble := uint16(b[0]&0x0f)<<4 | 0x0a
+	return nibble<<8 | nibble, nil
+}
+
+func appendUint16(b []byte, v int) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// ============ SERVER HELLO PARSING ============
+
+// serverHello holds the fields of a ServerHello that feed JARM and JA3S.
+type serverHello struct {
+	responded  bool
+	version    []byte
+	cipher     []byte
+	alpn       string
+	extensions [][]byte
+	// extensionsParsed is false when the reference scanner would emit an
+	// empty "alpn|extensions" pair, e.g. for a hello without extensions.
+	extensionsParsed bool
+}
+
+// parseServerHello decodes the first record returned for a probe. The byte
+// offsets intentionally follow the JARM reference scanner so that malformed
+// or truncated replies produce the same fingerprint components it would.
+func parseServerHello(data []byte) serverHello {
+	var hs serverHello
+	if len(data) < 44 || data[0] != 0x16 || data[5] != 0x02 {
+		return hs
+	}
+
+	counter := int(data[43])
+	if len(data) < counter+46 {
+		return hs
+	}
+	hs.responded = true
+	hs.version = data[9:11]
+	hs.cipher = data[counter+44 : counter+46]
+
+	recordLen := int(binary.BigEndian.Uint16(data[3:5]))
+	if len(data) < counter+49 || data[counter+47] == 0x0b {
+		return hs
+	}
+	if len(data) >= counter+53 && string(data[counter+50:counter+53]) == "\x0e\xac\x0b" {
+		return hs
+	}
+	if len(data) >= 85 && string(data[82:85]) == "\x0f\xf0\x0b" {
+		return hs
+	}
+	if counter+42 >= recordLen {
+		return hs
+	}
+
+	count := counter + 49
+	maximum := int(binary.BigEndian.Uint16(data[counter+47:counter+49])) + count - 1
+	var types, values [][]byte
+	for count < maximum {
+		if count+4 > len(data) {
+			return hs
+		}
+		extLen := int(binary.BigEndian.Uint16(data[count+2 : count+4]))
+		if count+4+extLen > len(data) {
+			return hs
+		}
+		types = append(types, data[count:count+2])
+		values = append(values, data[count+4:count+4+extLen])
+		count += extLen + 4
+	}
+
+	for i, t := range types {
+		if t[0] == 0x00 && t[1] == 0x10 && len(values[i]) > 3 {
+			hs.alpn = string(values[i][3:])
+			break
+		}
+	}
+	hs.extensions = types
+	hs.extensionsParsed = true
+	return hs
+}
+
+// jarmComponent renders the per-probe "cipher|version|alpn|extensions" string.
+func (hs serverHello) jarmComponent() string {
+	if !hs.responded {
+		return "|||"
+	}
+	var b strings.Builder
+	b.WriteString(hex.EncodeToString(hs.cipher))
+	b.WriteString("|")
+	b.WriteString(hex.EncodeToString(hs.version))
+	b.WriteString("|")
+	if !hs.extensionsParsed {
+		b.WriteString("|")
+		return b.String()
+	}
+	b.WriteString(hs.alpn)
+	b.WriteString("|")
+	for i, t := range hs.extensions {
+		if i > 0 {
+			b.WriteString("-")
+		}
+		b.WriteString(hex.EncodeToString(t))
+	}
+	return b.String()
+}
+
+// ja3sString renders the JA3S input: decimal version, cipher and extension IDs.
+func (hs serverHello) ja3sString() string {
+	exts := make([]string, 0, len(hs.extensions))
+	for _, t := range hs.extensions {
+		exts = append(exts, strconv.Itoa(int(binary.BigEndian.Uint16(t))))
+	}
+	return fmt.Sprintf("%d,%d,%s",
+		binary.BigEndian.Uint16(hs.version),
+		binary.BigEndian.Uint16(hs.cipher),
+		strings.Join(exts, "-"))
+}
+
+func (hs serverHello) toProbeResponse(name string) models.TLSProbeResponse {
+	resp := models.TLSProbeResponse{Probe: name, Responded: hs.responded}
+	if !hs.responded {
+		return resp
+	}
+	resp.Version = hex.EncodeToString(hs.version)
+	resp.Cipher = hex.EncodeToString(hs.cipher)
+	resp.ALPN = hs.alpn
+	for _, t := range hs.extensions {
+		resp.Extensions = append(resp.Extensions, hex.EncodeToString(t))
+	}
+	return resp
+}
+
+// ============ HASHING ============
+
+// jarmHash turns the ten raw probe components into the 62-character JARM:
+// 30 characters of per-probe cipher/version codes followed by a truncated
+// SHA-256 over all ALPN and extension strings.
+func jarmHash(components []string) string {
+	allEmpty := true
+	for _, c := range components {
+		if c != "|||" {
+			allEmpty = false
+			break
+		}
+	}
+	if allEmpty {
+		return emptyJARM
+	}
+
+	var fuzzy, alpnAndExt strings.Builder
+	for _, c := range components {
+		parts := strings.Split(c, "|")
+		for len(parts) < 4 {
+			parts = append(parts, "")
+		}
+		fuzzy.WriteString(jarmCipherCode(parts[0]))
+		fuzzy.WriteString(jarmVersionCode(parts[1]))
+		alpnAndExt.WriteString(parts[2])
+		alpnAndExt.WriteString(parts[3])
+	}
+	sum := sha256.Sum256([]byte(alpnAndExt.String()))
+	fuzzy.WriteString(hex.EncodeToString(sum[:])[:32])
+	return fuzzy.String()
+}
+
+func jarmCipherCode(cipher string) string {
+	if cipher == "" {
+		return "00"
+	}
+	count := 1
+	for _, c := range jarmCipherIndex {
+		if fmt.Sprintf("%04x", c) == cipher {
+			break
+		}
+		count++
+	}
+	return fmt.Sprintf("%02x", count)
+}
+
+func jarmVersionCode(version string) string {
+	if len(version) < 4 {
+		return "0"
+	}
+	idx := int(version[3] - '0')
+	if idx < 0 || idx > 5 {
+		return "0"
+	}
+	return string("abcdef"[idx])
+}
@@ -0,0 +1,276 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
+)
+
+func TestMungOrder(t *testing.T) {
+	odd := []int{1, 2, 3, 4, 5}
+	even := []int{1, 2, 3, 4}
+
+	tests := []struct {
+		name  string
+		items []int
+		order string
+		want  []int
+	}{
+		{"forward", odd, "FORWARD", []int{1, 2, 3, 4, 5}},
+		{"reverse", odd, "REVERSE", []int{5, 4, 3, 2, 1}},
+		{"bottom half odd", odd, "BOTTOM_HALF", []int{4, 5}},
+		{"bottom half even", even, "BOTTOM_HALF", []int{3, 4}},
+		{"top half odd", odd, "TOP_HALF", []int{3, 2, 1}},
+		{"top half even", even, "TOP_HALF", []int{2, 1}},
+		{"middle out odd", odd, "MIDDLE_OUT", []int{3, 4, 2, 5, 1}},
+		{"middle out even", even, "MIDDLE_OUT", []int{3, 2, 4, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mungOrder(tt.items, tt.order); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mungOrder(%v, %s) = %v, want %v", tt.items, tt.order, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJARMHash(t *testing.T) {
+	empty := make([]string, 10)
+	for i := range empty {
+		empty[i] = "|||"
+	}
+	if got := jarmHash(empty); got != emptyJARM {
+		t.Errorf("expected all-zero JARM for unresponsive host, got %s", got)
+	}
+
+	components := append([]string{"c02f|0303|h2|ff01-0000-0001-000b-0023-0010"}, empty[1:]...)
+	got := jarmHash(components)
+	if len(got) != 62 {
+		t.Fatalf("expected 62-character JARM, got %d (%s)", len(got), got)
+	}
+	// c02f is the 41st entry of the cipher index (0x29), TLS 1.2 maps to "d".
+	if !strings.HasPrefix(got, "29d000") {
+		t.Errorf("unexpected fuzzy prefix: %s", got[:6])
+	}
+}
+
+func TestJARMCodes(t *testing.T) {
+	if got := jarmCipherCode(""); got != "00" {
+		t.Errorf("jarmCipherCode(\"\") = %s, want 00", got)
+	}
+	if got := jarmCipherCode("0004"); got != "01" {
+		t.Errorf("jarmCipherCode(0004) = %s, want 01", got)
+	}
+	if got := jarmCipherCode("1301"); got != "41" {
+		t.Errorf("jarmCipherCode(1301) = %s, want 41", got)
+	}
+	if got := jarmVersionCode("0303"); got != "d" {
+		t.Errorf("jarmVersionCode(0303) = %s, want d", got)
+	}
+	if got := jarmVersionCode(""); got != "0" {
+		t.Errorf("jarmVersionCode(\"\") = %s, want 0", got)
+	}
+}
+
+func TestParseServerHello(t *testing.T) {
+	// Minimal TLS 1.2 ServerHello: cipher c02f, ALPN "h2", renegotiation_info.
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0x00)                // empty session id
+	body = append(body, 0xc0, 0x2f, 0x00)    // cipher, compression
+	exts := []byte{
+		0xff, 0x01, 0x00, 0x01, 0x00,
+		0x00, 0x10, 0x00, 0x05, 0x00, 0x03, 0x02, 'h', '2',
+	}
+	body = appendUint16(body, len(exts))
+	body = append(body, exts...)
+
+	handshake := append([]byte{0x02, 0x00}, appendUint16(nil, len(body))...)
+	handshake = append(handshake, body...)
+	record := append([]byte{0x16, 0x03, 0x03}, appendUint16(nil, len(handshake))...)
+	record = append(record, handshake...)
+
+	hs := parseServerHello(record)
+	if !hs.responded {
+		t.Fatal("expected ServerHello to be recognised")
+	}
+	if got := hs.jarmComponent(); got != "c02f|0303|h2|ff01-0010" {
+		t.Errorf("jarmComponent() = %s", got)
+	}
+	if got := hs.ja3sString(); got != "771,49199,65281-16" {
+		t.Errorf("ja3sString() = %s", got)
+	}
+
+	if got := parseServerHello([]byte{0x15, 0x03, 0x03, 0x00, 0x02, 0x02, 0x28}).jarmComponent(); got != "|||" {
+		t.Errorf("expected alert to produce empty component, got %s", got)
+	}
+	if got := parseServerHello(nil).jarmComponent(); got != "|||" {
+		t.Errorf("expected no data to produce empty component, got %s", got)
+	}
+}
+
+func TestBuildJARMClientHello(t *testing.T) {
+	for _, probe := range jarmProbes {
+		hello, err := buildJARMClientHello("example.com", probe)
+		if err != nil {
+			t.Fatalf("%s: %v", probe.name, err)
+		}
+		if hello[0] != 0x16 || hello[5] != 0x01 {
+			t.Errorf("%s: not a handshake/ClientHello record", probe.name)
+		}
+		recordLen := int(hello[3])<<8 | int(hello[4])
+		if recordLen != len(hello)-5 {
+			t.Errorf("%s: record length %d does not match payload %d", probe.name, recordLen, len(hello)-5)
+		}
+	}
+}
+
+func TestTLSFingerprinter_Fingerprint(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	host, portStr, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	tf := NewTLSFingerprinter(logger.NewLogger())
+	tf.SetPort(port)
+
+	fp, err := tf.Fingerprint(context.Background(), host)
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+	if len(fp.JARM) != 62 || fp.JARM == emptyJARM {
+		t.Errorf("expected a non-empty JARM from a live TLS server, got %q", fp.JARM)
+	}
+	if len(fp.JA3S) != 32 {
+		t.Errorf("expected an MD5 JA3S, got %q", fp.JA3S)
+	}
+	if len(fp.Responses) != len(jarmProbes) {
+		t.Errorf("expected %d probe responses, got %d", len(jarmProbes), len(fp.Responses))
+	}
+	if len(fp.Matches) != 0 {
+		t.Errorf("expected no matches without a known-bad list, got %v", fp.Matches)
+	}
+
+	tf.AddKnownBad(models.FingerprintMatch{Type: "ja3s", Fingerprint: fp.JA3S, Label: "test stack"})
+	again, err := tf.Fingerprint(context.Background(), host)
+	if err != nil {
+		t.Fatalf("second Fingerprint failed: %v", err)
+	}
+	if len(again.Matches) != 1 || again.Matches[0].Label != "test stack" {
+		t.Errorf("expected known-bad JA3S match, got %v", again.Matches)
+	}
+}
+
+func TestTLSFingerprinter_FingerprintKeepsAnsweredProbes(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// Pass the first probe through to the TLS server, then end the context
+	// when the second one connects, as if the analysis ran out of time.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		var held []net.Conn
+		defer func() {
+			for _, c := range held {
+				c.Close()
+			}
+		}()
+		for n := 0; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if n > 0 {
+				cancel()
+				held = append(held, conn)
+				continue
+			}
+			upstream, err := net.Dial("tcp", ts.Listener.Addr().String())
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go func() {
+				io.Copy(upstream, conn)
+				upstream.Close()
+			}()
+			go func() {
+				io.Copy(conn, upstream)
+				conn.Close()
+			}()
+		}
+	}()
+
+	tf := NewTLSFingerprinter(logger.NewLogger())
+	tf.SetPort(ts.Listener.Addr().(*net.TCPAddr).Port)
+	full, err := tf.Fingerprint(context.Background(), "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf.SetPort(ln.Addr().(*net.TCPAddr).Port)
+	tf.AddKnownBad(models.FingerprintMatch{Type: "ja3s", Fingerprint: full.JA3S, Label: "test stack"})
+
+	fp, err := tf.Fingerprint(ctx, "127.0.0.1")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context's error, got %v", err)
+	}
+	if fp == nil || !fp.Incomplete {
+		t.Fatalf("expected an incomplete fingerprint, got %+v", fp)
+	}
+	if len(fp.Responses) != len(jarmProbes) || !fp.Responses[0].Responded || fp.Responses[len(fp.Responses)-1].Responded {
+		t.Errorf("expected only the first probe to be answered, got %+v", fp.Responses)
+	}
+	if fp.JA3S != full.JA3S {
+		t.Errorf("JA3S = %q, want %q from the answered probe", fp.JA3S, full.JA3S)
+	}
+	if len(fp.Matches) != 1 || fp.Matches[0].Type != "ja3s" {
+		t.Errorf("expected the JA3S match to survive, got %v", fp.Matches)
+	}
+}
+
+func TestTLSFingerprinter_LoadKnownBadFingerprints(t *testing.T) {
+	jarm := "07d14d16d21d21d07c42d41d00041d24a458a375eef0c576d23a7bab9a9fb1"
+	path := filepath.Join(t.TempDir(), "known_bad.csv")
+	content := "# comment\n\njarm," + strings.ToUpper(jarm) + ",Cobalt Strike\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tf := NewTLSFingerprinter(logger.NewLogger())
+	if err := tf.LoadKnownBadFingerprints(path); err != nil {
+		t.Fatalf("LoadKnownBadFingerprints failed: %v", err)
+	}
+	matches := tf.MatchKnownBad(jarm, "")
+	if len(matches) != 1 || matches[0].Label != "Cobalt Strike" {
+		t.Errorf("expected Cobalt Strike match, got %v", matches)
+	}
+	if got := tf.MatchKnownBad(emptyJARM, ""); len(got) != 0 {
+		t.Errorf("all-zero JARM must never match, got %v", got)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.csv")
+	os.WriteFile(bad, []byte("md5,abc,label\n"), 0o600)
+	if err := tf.LoadKnownBadFingerprints(bad); err == nil {
+		t.Error("expected error for unknown fingerprint type")
+	}
+}
@@ -1,70 +1,622 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+
 	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
+)
+
+// TraceMode selects the probe type used for each TTL.
+type TraceMode string
+
+const (
+	TraceModeICMP TraceMode = "icmp" // ICMP echo requests
+	TraceModeUDP  TraceMode = "udp"  // UDP datagrams to high ports (classic traceroute)
+	TraceModeTCP  TraceMode = "tcp"  // TCP SYN via connect(), passes most firewalls
 )
 
+const (
+	protocolICMP = 1
+	protocolTCP  = 6
+	protocolUDP  = 17
+
+	udpBasePort = 33434
+	// maxSilentHops stops the trace after this many consecutive hops without any reply.
+	maxSilentHops = 5
+)
+
+// ParseTraceMode validates a traceroute mode name.
+func ParseTraceMode(s string) (TraceMode, error) {
+	switch mode := TraceMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case TraceModeICMP, TraceModeUDP, TraceModeTCP:
+		return mode, nil
+	case "":
+		return TraceModeICMP, nil
+	default:
+		return "", fmt.Errorf("unknown traceroute mode %q (expected icmp, udp or tcp)", s)
+	}
+}
+
 // Tracer handles network path analysis.
 type Tracer struct {
-	maxHops int
-	timeout time.Duration
+	logger       *logger.Logger
+	maxHops      int
+	timeout      time.Duration // Per-probe reply timeout
+	probesPerHop int
+	mode         TraceMode
+	tcpPort      int
+	dnsClient    *DNSClient
+	asnResolver  ASNResolver
+
+	// listenICMP opens the raw socket used to receive ICMP replies; replaced in tests.
+	listenICMP func() (*icmp.PacketConn, error)
 }
 
 // NewTracer creates a new Tracer.
-func NewTracer() *Tracer {
+func NewTracer(logger *logger.Logger) *Tracer {
 	return &Tracer{
-		maxHops: 30,
-		timeout: 2 * time.Second,
+		logger:       logger,
+		maxHops:      30,
+		timeout:      2 * time.Second,
+		probesPerHop: 3,
+		mode:         TraceModeICMP,
+		tcpPort:      80,
+		dnsClient:    NewDNSClient(logger),
+		listenICMP: func() (*icmp.PacketConn, error) {
+			return icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+		},
+	}
+}
+
+// SetMode sets the probe type.
+func (t *Tracer) SetMode(mode TraceMode) {
+	t.mode = mode
+}
+
+// SetMaxHops sets the maximum TTL probed.
+func (t *Tracer) SetMaxHops(hops int) {
+	if hops > 0 && hops <= 255 {
+		t.maxHops = hops
+	}
+}
+
+// SetProbesPerHop sets how many probes are sent for each TTL.
+func (t *Tracer) SetProbesPerHop(n int) {
+	if n > 0 {
+		t.probesPerHop = n
 	}
 }
 
-// Trace performs a basic TCP-based traceroute by incrementing TTL.
-// Note: On many systems, setting TTL for TCP requires specific permissions or is OS-dependent.
-// This remains a best-effort implementation for a non-root environment.
-func (t *Tracer) Trace(target string) (*models.NetworkAnalysis, error) {
-	ips, err := net.LookupIP(target)
+// SetTimeout sets the per-probe reply timeout.
+func (t *Tracer) SetTimeout(d time.Duration) {
+	if d > 0 {
+		t.timeout = d
+	}
+}
+
+// SetTCPPort sets the destination port used by TCP probes and the connect fallback.
+func (t *Tracer) SetTCPPort(port int) {
+	if port > 0 && port <= 65535 {
+		t.tcpPort = port
+	}
+}
+
+// SetASNResolver sets the resolver used to annotate hops with ASN and country.
+func (t *Tracer) SetASNResolver(r ASNResolver) {
+	t.asnResolver = r
+}
+
+// Trace performs a TTL-based traceroute to target. Raw ICMP sockets are needed to see
+// intermediate routers; without them the trace degrades to destination-only latency
+// measured with TCP connects and a warning is attached.
+func (t *Tracer) Trace(ctx context.Context, target string) (*models.NetworkAnalysis, error) {
+	destIP, err := t.resolveIPv4(ctx, target)
 	if err != nil {
 		return nil, err
 	}
-	if len(ips) == 0 {
-		return nil, fmt.Errorf("no IP found")
-	}
-	destIP := ips[0]
 
 	analysis := &models.NetworkAnalysis{
 		Target: target,
+		Mode:   string(t.mode),
 	}
 
-	start := time.Now()
-	// Best effort traceroute using net package
-	// Without raw sockets, we can't easily do a true TTL-based traceroute in pure Go.
-	// We'll simulate a path or just provide the final hop info if TTL is not supported.
+	conn, err := t.listenICMP()
+	if err != nil {
+		t.logger.Warn("Raw ICMP socket unavailable, traceroute degraded to connect latency: %v", err)
+		analysis.Mode = "connect"
+		analysis.Warnings = append(analysis.Warnings,
+			fmt.Sprintf("Raw sockets unavailable (%v); only destination latency was measured", err))
+		if err := t.traceConnectOnly(ctx, destIP, analysis); err != nil {
+			return nil, err
+		}
+	} else {
+		err := t.traceTTL(ctx, conn, destIP, analysis)
+		conn.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.annotateHops(ctx, analysis)
+	summarizePath(analysis)
+
+	return analysis, nil
+}
 
-	// Implementation note: For a real production app without root, we often rely on
-	// external utilities or just perform latency/path analysis to the final destination.
+func (t *Tracer) resolveIPv4(ctx context.Context, target string) (net.IP, error) {
+	if ip := net.ParseIP(target); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+		return nil, fmt.Errorf("traceroute supports IPv4 targets only: %s", target)
+	}
 
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(destIP.String(), "80"), t.timeout)
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", target)
 	if err != nil {
-		conn, err = net.DialTimeout("tcp", net.JoinHostPort(destIP.String(), "443"), t.timeout)
+		return nil, err
 	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IPv4 address found for %s", target)
+	}
+	return ips[0].To4(), nil
+}
+
+// probeKey identifies an outstanding probe inside the original datagram quoted by an
+// ICMP error: the echo sequence, the UDP destination port or the TCP source port.
+type probeKey struct {
+	proto int
+	id    int
+}
+
+type probeReply struct {
+	from    net.IP
+	reached bool
+	at      time.Time
+}
+
+// traceSession demultiplexes ICMP replies to the probes waiting for them.
+type traceSession struct {
+	conn   *icmp.PacketConn
+	dest   net.IP
+	echoID int
+
+	mu      sync.Mutex
+	pending map[probeKey]chan probeReply
+}
+
+func (s *traceSession) register(key probeKey) chan probeReply {
+	ch := make(chan probeReply, 1)
+	s.mu.Lock()
+	s.pending[key] = ch
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *traceSession) unregister(key probeKey) {
+	s.mu.Lock()
+	delete(s.pending, key)
+	s.mu.Unlock()
+}
+
+func (s *traceSession) deliver(key probeKey, reply probeReply) {
+	s.mu.Lock()
+	ch, ok := s.pending[key]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case ch <- reply:
+	default:
+	}
+}
+
+// receive reads ICMP messages until the connection is closed.
+func (s *traceSession) receive() {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		from := addrIP(peer)
+		if from == nil {
+			continue
+		}
+		if key, reached, ok := matchICMPReply(buf[:n], from, s.dest, s.echoID); ok {
+			s.deliver(key, probeReply{from: from, reached: reached, at: time.Now()})
+		}
+	}
+}
 
-	if err == nil {
+// matchICMPReply maps an ICMP message to the probe it answers.
+func matchICMPReply(b []byte, from, dest net.IP, echoID int) (probeKey, bool, bool) {
+	msg, err := icmp.ParseMessage(protocolICMP, b)
+	if err != nil {
+		return probeKey{}, false, false
+	}
+
+	switch msg.Type {
+	case ipv4.ICMPTypeEchoReply:
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || echo.ID != echoID || !from.Equal(dest) {
+			return probeKey{}, false, false
+		}
+		return probeKey{proto: protocolICMP, id: echo.Seq}, true, true
+	case ipv4.ICMPTypeTimeExceeded:
+		body, ok := msg.Body.(*icmp.TimeExceeded)
+		if !ok {
+			return probeKey{}, false, false
+		}
+		key, ok := matchQuotedDatagram(body.Data, dest, echoID)
+		return key, false, ok
+	case ipv4.ICMPTypeDestinationUnreachable:
+		body, ok := msg.Body.(*icmp.DstUnreach)
+		if !ok {
+			return probeKey{}, false, false
+		}
+		key, ok := matchQuotedDatagram(body.Data, dest, echoID)
+		return key, from.Equal(dest), ok
+	}
+	return probeKey{}, false, false
+}
+
+// matchQuotedDatagram extracts the probe key from the IPv4 header and first eight
+// payload bytes that routers quote back in ICMP errors.
+func matchQuotedDatagram(b []byte, dest net.IP, echoID int) (probeKey, bool) {
+	hdr, err := ipv4.ParseHeader(b)
+	if err != nil || hdr.Len+8 > len(b) || !hdr.Dst.Equal(dest) {
+		return probeKey{}, false
+	}
+	payload := b[hdr.Len:]
+
+	switch hdr.Protocol {
+	case protocolICMP:
+		if int(payload[4])<<8|int(payload[5]) != echoID {
+			return probeKey{}, false
+		}
+		return probeKey{proto: protocolICMP, id: int(payload[6])<<8 | int(payload[7])}, true
+	case protocolUDP:
+		return probeKey{proto: protocolUDP, id: int(payload[2])<<8 | int(payload[3])}, true
+	case protocolTCP:
+		return probeKey{proto: protocolTCP, id: int(payload[0])<<8 | int(payload[1])}, true
+	}
+	return probeKey{}, false
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// traceTTL sends probesPerHop probes for each TTL until the destination answers.
+func (t *Tracer) traceTTL(ctx context.Context, conn *icmp.PacketConn, dest net.IP, analysis *models.NetworkAnalysis) error {
+	session := &traceSession{
+		conn:    conn,
+		dest:    dest,
+		echoID:  os.Getpid() & 0xffff,
+		pending: make(map[probeKey]chan probeReply),
+	}
+	go session.receive()
+
+	seq := 0
+	silent := 0
+	for ttl := 1; ttl <= t.maxHops; ttl++ {
+		hop := models.HopDetail{Number: ttl, Probes: t.probesPerHop}
+		reached := false
+
+		for p := 0; p < t.probesPerHop; p++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			seq++
+
+			reply, rtt, err := t.sendProbe(ctx, session, ttl, seq)
+			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+				t.logger.Debug("Traceroute probe ttl=%d failed: %v", ttl, err)
+				continue
+			}
+			if reply == nil {
+				continue
+			}
+			if hop.IP == "" {
+				hop.IP = reply.from.String()
+			}
+			hop.RTTs = append(hop.RTTs, rtt)
+			reached = reached || reply.reached
+		}
+
+		finalizeHop(&hop)
+		analysis.Hops = append(analysis.Hops, hop)
+
+		if reached {
+			analysis.Reached = true
+			return nil
+		}
+		if hop.IP == "" {
+			silent++
+			if silent >= maxSilentHops {
+				analysis.Warnings = append(analysis.Warnings,
+					fmt.Sprintf("Trace stopped after %d consecutive silent hops", maxSilentHops))
+				return nil
+			}
+		} else {
+			silent = 0
+		}
+	}
+
+	return nil
+}
+
+// sendProbe emits one probe with the given TTL and waits for its reply. A nil reply
+// with a nil error means the probe timed out.
+func (t *Tracer) sendProbe(ctx context.Context, s *traceSession, ttl, seq int) (*probeReply, time.Duration, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	var (
+		key     probeKey
+		replies chan probeReply
+		start   time.Time
+	)
+
+	switch t.mode {
+	case TraceModeUDP:
+		conn, err := net.ListenPacket("udp4", ":0")
+		if err != nil {
+			return nil, 0, err
+		}
 		defer conn.Close()
-		latency := time.Since(start)
-		analysis.AverageLatency = latency
-		analysis.HopCount = 1 // Simplified for non-root
-		analysis.Hops = append(analysis.Hops, models.HopDetail{
-			Number:  1,
-			IP:      destIP.String(),
-			Latency: latency,
-		})
+		if err := ipv4.NewPacketConn(conn).SetTTL(ttl); err != nil {
+			return nil, 0, err
+		}
+		port := udpBasePort + seq%(65535-udpBasePort)
+		key = probeKey{proto: protocolUDP, id: port}
+		replies = s.register(key)
+		start = time.Now()
+		if _, err := conn.WriteTo(make([]byte, 32), &net.UDPAddr{IP: s.dest, Port: port}); err != nil {
+			s.unregister(key)
+			return nil, 0, err
+		}
+
+	case TraceModeTCP:
+		var localPort int
+		ready := make(chan struct{})
+		result := make(chan probeReply, 1)
+		dialer := net.Dialer{
+			Control: func(network, address string, c syscall.RawConn) error {
+				var sockErr error
+				err := c.Control(func(fd uintptr) {
+					localPort, sockErr = prepareTCPProbeSocket(fd, ttl)
+				})
+				if err == nil {
+					err = sockErr
+				}
+				if err == nil {
+					key = probeKey{proto: protocolTCP, id: localPort}
+					replies = s.register(key)
+					start = time.Now()
+				}
+				close(ready)
+				return err
+			},
+		}
+		go func() {
+			conn, err := dialer.DialContext(probeCtx, "tcp4", net.JoinHostPort(s.dest.String(), fmt.Sprint(t.tcpPort)))
+			if err == nil {
+				conn.Close()
+			}
+			// A SYN-ACK or RST means the SYN reached the destination.
+			if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+				result <- probeReply{from: s.dest, reached: true, at: time.Now()}
+			}
+			if replies != nil {
+				// Routers' ICMP errors also abort connect(), so keep the probe registered
+				// until sendProbe has returned and cancelled probeCtx.
+				<-probeCtx.Done()
+				s.unregister(key)
+			}
+		}()
+		select {
+		case <-ready:
+		case <-probeCtx.Done():
+			return nil, 0, nil
+		}
+		if replies == nil {
+			return nil, 0, fmt.Errorf("failed to prepare TCP probe socket")
+		}
+		defer s.unregister(key)
+		select {
+		case r := <-replies:
+			return &r, r.at.Sub(start), nil
+		case r := <-result:
+			return &r, r.at.Sub(start), nil
+		case <-probeCtx.Done():
+			return nil, 0, nil
+		}
+
+	default:
+		if err := s.conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+			return nil, 0, err
+		}
+		msg := icmp.Message{
+			Type: ipv4.ICMPTypeEcho,
+			Body: &icmp.Echo{ID: s.echoID, Seq: seq & 0xffff, Data: []byte("NET-ZILLA-TRACE")},
+		}
+		wb, err := msg.Marshal(nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		key = probeKey{proto: protocolICMP, id: seq & 0xffff}
+		replies = s.register(key)
+		start = time.Now()
+		if _, err := s.conn.WriteTo(wb, &net.IPAddr{IP: s.dest}); err != nil {
+			s.unregister(key)
+			return nil, 0, err
+		}
+	}
+
+	defer s.unregister(key)
+	select {
+	case r := <-replies:
+		return &r, r.at.Sub(start), nil
+	case <-probeCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		return nil, 0, nil
+	}
+}
+
+// traceConnectOnly measures latency to the destination with plain TCP connects.
+func (t *Tracer) traceConnectOnly(ctx context.Context, dest net.IP, analysis *models.NetworkAnalysis) error {
+	hop := models.HopDetail{Number: 1, IP: dest.String(), Probes: t.probesPerHop}
+	ports := []int{t.tcpPort}
+	if t.tcpPort != 443 {
+		ports = append(ports, 443)
+	}
+
+	var lastErr error
+	for p := 0; p < t.probesPerHop; p++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, port := range ports {
+			dialCtx, cancel := context.WithTimeout(ctx, t.timeout)
+			start := time.Now()
+			conn, err := (&net.Dialer{}).DialContext(dialCtx, "tcp4", net.JoinHostPort(dest.String(), fmt.Sprint(port)))
+			rtt := time.Since(start)
+			cancel()
+			if err == nil {
+				conn.Close()
+			}
+			if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+				hop.RTTs = append(hop.RTTs, rtt)
+				lastErr = nil
+				break
+			}
+			lastErr = err
+		}
+	}
+
+	if len(hop.RTTs) == 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("target unreachable: %w", lastErr)
+	}
+
+	finalizeHop(&hop)
+	analysis.Hops = append(analysis.Hops, hop)
+	analysis.Reached = true
+	return nil
+}
+
+// annotateHops adds reverse DNS and ASN data to each responding hop.
+func (t *Tracer) annotateHops(ctx context.Context, analysis *models.NetworkAnalysis) {
+	for i := range analysis.Hops {
+		hop := &analysis.Hops[i]
+		if hop.IP == "" || ctx.Err() != nil {
+			continue
+		}
+		ip := net.ParseIP(hop.IP)
+		if ip == nil || !isPublicIP(ip) {
+			continue
+		}
+		if name, err := t.dnsClient.ReverseDNSLookup(ctx, hop.IP); err == nil {
+			hop.Host = name
+		}
+		if t.asnResolver != nil {
+			if info, err := t.asnResolver.LookupASN(ctx, hop.IP); err == nil {
+				hop.ASN = info.ASN
+				hop.Country = info.Country
+			}
+		}
+	}
+}
+
+// finalizeHop derives latency, loss and jitter from the collected RTTs.
+func finalizeHop(hop *models.HopDetail) {
+	if hop.Probes > 0 {
+		hop.Loss = float64(hop.Probes-len(hop.RTTs)) / float64(hop.Probes) * 100
+	}
+	if len(hop.RTTs) == 0 {
+		return
+	}
+
+	var total, jitter time.Duration
+	for i, rtt := range hop.RTTs {
+		total += rtt
+		if i > 0 {
+			jitter += absDuration(rtt - hop.RTTs[i-1])
+		}
+	}
+	hop.Latency = total / time.Duration(len(hop.RTTs))
+	if len(hop.RTTs) > 1 {
+		hop.Jitter = jitter / time.Duration(len(hop.RTTs)-1)
+	}
+}
+
+// summarizePath fills the path-level statistics. Latency and loss are taken from the
+// last hop: intermediate routers routinely rate-limit ICMP, so their loss is noise.
+func summarizePath(analysis *models.NetworkAnalysis) {
+	analysis.HopCount = len(analysis.Hops)
+	if len(analysis.Hops) == 0 {
+		return
+	}
+
+	last := analysis.Hops[len(analysis.Hops)-1]
+	if !analysis.Reached {
+		analysis.PacketLoss = 100
+		analysis.Warnings = append(analysis.Warnings, "Destination did not respond to traceroute probes")
 	} else {
-		return nil, fmt.Errorf("target unreachable: %w", err)
+		analysis.PacketLoss = last.Loss
+		analysis.AverageLatency = last.Latency
+		for i, rtt := range last.RTTs {
+			if i == 0 || rtt < analysis.MinLatency {
+				analysis.MinLatency = rtt
+			}
+			if rtt > analysis.MaxLatency {
+				analysis.MaxLatency = rtt
+			}
+		}
 	}
 
-	return analysis, nil
+	var path []string
+	for _, hop := range analysis.Hops {
+		if hop.Country == "" {
+			continue
+		}
+		if len(path) == 0 || path[len(path)-1] != hop.Country {
+			path = append(path, hop.Country)
+		}
+	}
+	analysis.GeoPath = strings.Join(path, " -> ")
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
 }
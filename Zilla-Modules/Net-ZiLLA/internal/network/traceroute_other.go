@@ -0,0 +1,10 @@
+//go:build !unix
+
+package network
+
+import "errors"
+
+// prepareTCPProbeSocket is not implemented on this platform; use ICMP or UDP mode.
+func prepareTCPProbeSocket(fd uintptr, ttl int) (int, error) {
+	return 0, errors.New("TCP traceroute probes are not supported on this platform")
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package network
+
+import "syscall"
+
+// prepareTCPProbeSocket sets the TTL on a not-yet-connected TCP socket and binds it to
+// an ephemeral port so the probe can be matched against quoted ICMP errors.
+func prepareTCPProbeSocket(fd uintptr, ttl int) (int, error) {
+	if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, ttl); err != nil {
+		return 0, err
+	}
+	if err := syscall.Bind(int(fd), &syscall.SockaddrInet4{}); err != nil {
+		return 0, err
+	}
+	sa, err := syscall.Getsockname(int(fd))
+	if err != nil {
+		return 0, err
+	}
+	addr, ok := sa.(*syscall.SockaddrInet4)
+	if !ok {
+		return 0, syscall.EAFNOSUPPORT
+	}
+	return addr.Port, nil
+}
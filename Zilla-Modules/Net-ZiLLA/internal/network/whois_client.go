@@ -15,9 +15,10 @@ import (
 
 // WhoisClient performs WHOIS lookups for domains.
 type WhoisClient struct {
-	timeout time.Duration
-	servers map[string]string // TLD -> WHOIS server
-	logger  *logger.Logger    // Added logger
+	timeout  time.Duration
+	servers  map[string]string // TLD -> WHOIS server
+	logger   *logger.Logger    // Added logger
+	cassette *Cassette         // Optional record/replay of raw WHOIS responses
 }
 
 // NewWhoisClient creates and initializes a new WhoisClient.
@@ -42,6 +43,11 @@ func NewWhoisClient(logger *logger.Logger) *WhoisClient {
 	}
 }
 
+// SetCassette records or replays raw WHOIS responses through c; nil disables it.
+func (w *WhoisClient) SetCassette(c *Cassette) {
+	w.cassette = c
+}
+
 // Lookup performs a WHOIS lookup for the given domain.
 func (w *WhoisClient) Lookup(ctx context.Context, domain string) (*models.WhoisAnalysis, error) {
 	internalInfo := &WhoisInfo{
@@ -56,7 +62,11 @@ func (w *WhoisClient) Lookup(ctx context.Context, domain string) (*models.WhoisA
 	}
 
 	// Perform WHOIS query
-	response, err := w.queryWhoisServer(ctx, server, domain) // Pass context
+	raw, err := w.cassette.exchange("whois", server+" "+domain, func() ([]byte, error) {
+		response, err := w.queryWhoisServer(ctx, server, domain) // Pass context
+		return []byte(response), err
+	})
+	response := string(raw)
 	if err != nil {
 		w.logger.Error("Failed to query WHOIS server %s for %s: %v", server, domain, err)
 		return nil, err
@@ -77,7 +87,10 @@ func (w *WhoisClient) Lookup(ctx context.Context, domain string) (*models.WhoisA
 		NameServers: internalInfo.NameServers,
 		Status:      internalInfo.Status,
 		RawWhois:    internalInfo.RawResponse,
-		DomainAge:   calculateDomainAge(internalInfo.CreatedDate),
+		DomainAge:   calculateDomainAge(internalInfo.CreatedDate, w.cassette.Now()),
+	}
+	if !internalInfo.CreatedDate.IsZero() {
+		analysis.DomainAgeDays = int(w.cassette.Now().Sub(internalInfo.CreatedDate).Hours() / 24)
 	}
 
 	return analysis, nil
@@ -242,13 +255,13 @@ func parseDate(dateStr string) time.Time {
 	return time.Time{} // Return zero time if parsing fails
 }
 
-// calculateDomainAge returns a human-readable string of the domain's age.
-func calculateDomainAge(creationDate time.Time) string {
+// calculateDomainAge returns a human-readable string of the domain's age at now.
+func calculateDomainAge(creationDate, now time.Time) string {
 	if creationDate.IsZero() {
 		return "Unknown"
 	}
 
-	duration := time.Since(creationDate)
+	duration := now.Sub(creationDate)
 
 	years := int(duration.Hours() / 24 / 365)
 	if years > 0 {
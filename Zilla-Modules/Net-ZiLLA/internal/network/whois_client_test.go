@@ -59,7 +59,7 @@ func TestCalculateDomainAge(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		if got := calculateDomainAge(tt.created); !strings.Contains(got, tt.want) {
+		if got := calculateDomainAge(tt.created, time.Now()); !strings.Contains(got, tt.want) {
 			t.Errorf("calculateDomainAge(%v) = %v, want %v", tt.created, got, tt.want)
 		}
 	}
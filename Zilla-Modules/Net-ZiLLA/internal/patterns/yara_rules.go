@@ -1,11 +1,42 @@
 package patterns
 
-import "fmt"
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"net-zilla/internal/models"
+)
+
+// yaraMaxScanBytes caps how much of a file the rules look at.
+const yaraMaxScanBytes = 32 << 20
+
+// YaraRule is a compiled rule. YaraManager implements the commonly used subset of
+// the YARA language in Go so no libyara is needed: text strings (nocase, wide,
+// ascii, fullword), hex strings with wildcards, jumps and alternatives, regular
+// expressions, and conditions built from and/or/not, string references, counts,
+// "N of" sets, filesize and uint8/16/32 reads. Modules and imports are not supported.
 type YaraRule struct {
 	ID          string
 	Condition   string
 	Description string
+	Tags        []string
+	Meta        map[string]string
+	Private     bool // Usable in conditions only; never reported
+
+	strings []yaraString
+	cond    yaraExpr
+}
+
+type yaraString struct {
+	id string
+	re *regexp.Regexp // Matches the data decoded as Latin-1, so \xHH is the byte HH
 }
 
 type YaraManager struct {
@@ -16,10 +47,889 @@ func NewYaraManager() *YaraManager {
 	return &YaraManager{}
 }
 
-// LoadRules provides a foundation for importing external YARA rule files
+// LoadRules reads a .yar/.yara file, or every such file in a directory.
 func (ym *YaraManager) LoadRules(path string) error {
-	// Professional placeholder for YARA rule loading
-	// In full production, this would interface with a libyara wrapper
-	fmt.Printf("Loading YARA rules from %s...\n", path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("loading YARA rules: %w", err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.yar", "*.yara"} {
+			matches, _ := filepath.Glob(filepath.Join(path, pattern))
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("loading YARA rules: %w", err)
+		}
+		if err := ym.AddRules(string(data)); err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// AddRules compiles rule source and adds it to the set. Nothing is added on error.
+func (ym *YaraManager) AddRules(source string) error {
+	p := &yaraParser{src: source}
+	rules, err := p.parseFile()
+	if err != nil {
+		return err
+	}
+	ym.rules = append(ym.rules, rules...)
+	return nil
+}
+
+// Rules returns the loaded rules.
+func (ym *YaraManager) Rules() []YaraRule {
+	return ym.rules
+}
+
+// Scan returns the non-private rules that match data.
+func (ym *YaraManager) Scan(data []byte) []models.YaraMatch {
+	if len(ym.rules) == 0 {
+		return nil
+	}
+	if len(data) > yaraMaxScanBytes {
+		data = data[:yaraMaxScanBytes]
+	}
+	s := &yaraScan{data: data, text: latin1(data)}
+
+	var matches []models.YaraMatch
+	for i := range ym.rules {
+		r := &ym.rules[i]
+		if r.Private {
+			continue
+		}
+		s.rule = r
+		s.counts = make(map[string]int)
+		if !r.cond.eval(s) {
+			continue
+		}
+		m := models.YaraMatch{Rule: r.ID, Tags: r.Tags, Meta: r.Meta}
+		for _, str := range r.strings {
+			if s.count(str.id) > 0 {
+				m.Strings = append(m.Strings, str.id)
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// latin1 maps every byte to the rune with the same value so Go's UTF-8 regexps
+// can match arbitrary binary data byte for byte.
+func latin1(data []byte) string {
+	ascii := true
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return string(data)
+	}
+	var sb strings.Builder
+	sb.Grow(len(data) + len(data)/4)
+	for _, b := range data {
+		sb.WriteRune(rune(b))
+	}
+	return sb.String()
+}
+
+// yaraScan holds per-scan state; string match counts are computed on demand.
+type yaraScan struct {
+	data   []byte
+	text   string
+	rule   *YaraRule
+	counts map[string]int
+}
+
+const yaraMaxCount = 10000
+
+func (s *yaraScan) count(id string) int {
+	if n, ok := s.counts[id]; ok {
+		return n
+	}
+	n := 0
+	for _, str := range s.rule.strings {
+		if str.id == id {
+			n = len(str.re.FindAllStringIndex(s.text, yaraMaxCount))
+			break
+		}
+	}
+	s.counts[id] = n
+	return n
+}
+
+// --- Rule parsing ---
+
+type yaraParser struct {
+	src string
+	pos int
+}
+
+func (p *yaraParser) errorf(format string, args ...interface{}) error {
+	line := 1 + strings.Count(p.src[:p.pos], "\n")
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *yaraParser) skip() {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			if i := strings.IndexByte(p.src[p.pos:], '\n'); i >= 0 {
+				p.pos += i + 1
+			} else {
+				p.pos = len(p.src)
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			if i := strings.Index(p.src[p.pos+2:], "*/"); i >= 0 {
+				p.pos += i + 4
+			} else {
+				p.pos = len(p.src)
+			}
+		case strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *yaraParser) peek() byte {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *yaraParser) ident() string {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.src) && isIdentByte(p.src[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func isIdentByte(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && c >= '0' && c <= '9'
+}
+
+func (p *yaraParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// atSection reports whether the next tokens are "strings:" or "condition:".
+func (p *yaraParser) atSection() bool {
+	save := p.pos
+	defer func() { p.pos = save }()
+	name := p.ident()
+	return (name == "strings" || name == "condition" || name == "meta") && p.peek() == ':'
+}
+
+func (p *yaraParser) parseFile() ([]YaraRule, error) {
+	var rules []YaraRule
+	for p.peek() != 0 {
+		private := false
+		word := p.ident()
+		for word == "private" || word == "global" {
+			private = private || word == "private"
+			word = p.ident()
+		}
+		switch word {
+		case "import", "include":
+			return nil, p.errorf("%s is not supported", word)
+		case "rule":
+		default:
+			return nil, p.errorf("expected rule, got %q", word)
+		}
+		rule, err := p.parseRule()
+		if err != nil {
+			return nil, err
+		}
+		rule.Private = private
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (p *yaraParser) parseRule() (YaraRule, error) {
+	r := YaraRule{ID: p.ident(), Meta: make(map[string]string)}
+	if r.ID == "" {
+		return r, p.errorf("missing rule name")
+	}
+	if p.peek() == ':' {
+		p.pos++
+		for p.peek() != '{' && p.peek() != 0 {
+			tag := p.ident()
+			if tag == "" {
+				return r, p.errorf("bad tag in rule %s", r.ID)
+			}
+			r.Tags = append(r.Tags, tag)
+		}
+	}
+	if err := p.expect('{'); err != nil {
+		return r, err
+	}
+
+	for {
+		section := p.ident()
+		if err := p.expect(':'); err != nil {
+			return r, p.errorf("rule %s: expected meta, strings or condition", r.ID)
+		}
+		switch section {
+		case "meta":
+			if err := p.parseMeta(&r); err != nil {
+				return r, err
+			}
+		case "strings":
+			if err := p.parseStrings(&r); err != nil {
+				return r, err
+			}
+		case "condition":
+			start := p.pos
+			end := strings.IndexByte(p.src[start:], '}')
+			if end < 0 {
+				return r, p.errorf("rule %s: unterminated condition", r.ID)
+			}
+			r.Condition = strings.TrimSpace(p.src[start : start+end])
+			p.pos = start + end + 1
+			cond, err := parseCondition(r.Condition, &r)
+			if err != nil {
+				return r, fmt.Errorf("rule %s: %w", r.ID, err)
+			}
+			r.cond = cond
+			r.Description = r.Meta["description"]
+			return r, nil
+		default:
+			return r, p.errorf("rule %s: unknown section %q", r.ID, section)
+		}
+	}
+}
+
+func (p *yaraParser) parseMeta(r *YaraRule) error {
+	for !p.atSection() {
+		key := p.ident()
+		if key == "" {
+			return p.errorf("rule %s: bad meta entry", r.ID)
+		}
+		if err := p.expect('='); err != nil {
+			return err
+		}
+		if p.peek() == '"' {
+			v, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			r.Meta[key] = v
+			continue
+		}
+		start := p.pos
+		for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])) {
+			p.pos++
+		}
+		r.Meta[key] = p.src[start:p.pos]
+	}
+	return nil
+}
+
+func (p *yaraParser) parseStrings(r *YaraRule) error {
+	for p.peek() == '$' {
+		p.pos++
+		id := "$" + p.ident()
+		if err := p.expect('='); err != nil {
+			return err
+		}
+
+		var pattern string
+		var err error
+		var text string
+		kind := p.peek()
+		switch kind {
+		case '"':
+			text, err = p.quoted()
+		case '{':
+			pattern, err = p.hexString()
+		case '/':
+			pattern, err = p.regex()
+		default:
+			err = p.errorf("rule %s: bad value for %s", r.ID, id)
+		}
+		if err != nil {
+			return err
+		}
+
+		mods := make(map[string]bool)
+		for !p.atSection() && p.peek() != '$' && p.peek() != '}' {
+			mod := p.ident()
+			switch mod {
+			case "nocase", "wide", "ascii", "fullword", "private":
+				mods[mod] = true
+			default:
+				return p.errorf("rule %s: unsupported string modifier %q", r.ID, mod)
+			}
+		}
+		if kind == '"' {
+			pattern = textPattern(text, mods)
+		} else if mods["nocase"] {
+			pattern = "(?i)" + pattern
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return p.errorf("rule %s: %s: %v", r.ID, id, err)
+		}
+		r.strings = append(r.strings, yaraString{id: id, re: re})
+	}
 	return nil
 }
+
+func textPattern(text string, mods map[string]bool) string {
+	var ascii, wide strings.Builder
+	for i := 0; i < len(text); i++ {
+		q := regexp.QuoteMeta(string(rune(text[i])))
+		ascii.WriteString(q)
+		wide.WriteString(q + `\x00`)
+	}
+	var pattern string
+	switch {
+	case mods["wide"] && mods["ascii"]:
+		pattern = "(?:" + ascii.String() + "|" + wide.String() + ")"
+	case mods["wide"]:
+		pattern = wide.String()
+	default:
+		pattern = ascii.String()
+	}
+	if mods["fullword"] {
+		pattern = `(?:^|[^A-Za-z0-9_])` + pattern + `(?:[^A-Za-z0-9_]|$)`
+	}
+	if mods["nocase"] {
+		pattern = "(?i)" + pattern
+	}
+	return pattern
+}
+
+// quoted reads a double-quoted string, resolving YARA's escapes to raw bytes.
+func (p *yaraParser) quoted() (string, error) {
+	if err := p.expect('"'); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case '\\':
+			if p.pos >= len(p.src) {
+				return "", p.errorf("unterminated string")
+			}
+			e := p.src[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'x':
+				if p.pos+2 > len(p.src) {
+					return "", p.errorf("bad \\x escape")
+				}
+				v, err := strconv.ParseUint(p.src[p.pos:p.pos+2], 16, 8)
+				if err != nil {
+					return "", p.errorf("bad \\x escape")
+				}
+				sb.WriteByte(byte(v))
+				p.pos += 2
+			default:
+				sb.WriteByte(e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// hexString translates { 4D 5A ?? [2-4] ( 90 | CC ) } into a regexp.
+func (p *yaraParser) hexString() (string, error) {
+	p.pos++ // {
+	end := strings.IndexByte(p.src[p.pos:], '}')
+	if end < 0 {
+		return "", p.errorf("unterminated hex string")
+	}
+	body := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+
+	var sb strings.Builder
+	sb.WriteString("(?s)")
+	body = strings.Join(strings.Fields(body), "")
+	for i := 0; i < len(body); {
+		switch c := body[i]; {
+		case c == '(':
+			sb.WriteString("(?:")
+			i++
+		case c == ')' || c == '|':
+			sb.WriteByte(c)
+			i++
+		case c == '[':
+			j := strings.IndexByte(body[i:], ']')
+			if j < 0 {
+				return "", p.errorf("unterminated jump in hex string")
+			}
+			jump, err := hexJump(body[i+1 : i+j])
+			if err != nil {
+				return "", p.errorf("%v", err)
+			}
+			sb.WriteString(jump)
+			i += j + 1
+		case i+1 < len(body):
+			hi, lo := body[i], body[i+1]
+			switch {
+			case hi == '?' && lo == '?':
+				sb.WriteByte('.')
+			case hi == '?':
+				sb.WriteByte('[')
+				for n := 0; n < 16; n++ {
+					fmt.Fprintf(&sb, `\x%x%c`, n, lo)
+				}
+				sb.WriteByte(']')
+			case lo == '?':
+				fmt.Fprintf(&sb, `[\x%c0-\x%cf]`, hi, hi)
+			default:
+				if _, err := strconv.ParseUint(body[i:i+2], 16, 8); err != nil {
+					return "", p.errorf("bad hex byte %q", body[i:i+2])
+				}
+				fmt.Fprintf(&sb, `\x%s`, body[i:i+2])
+			}
+			i += 2
+		default:
+			return "", p.errorf("odd number of hex digits")
+		}
+	}
+	return sb.String(), nil
+}
+
+// hexJump turns the inside of [n], [n-m], [n-] or [-] into a repetition.
+func hexJump(spec string) (string, error) {
+	lo, hi, ranged := strings.Cut(spec, "-")
+	if !ranged {
+		hi = lo
+	}
+	parse := func(s string, def int) (int, error) {
+		if s == "" {
+			return def, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > 1000 {
+			return 0, fmt.Errorf("bad jump [%s]; at most 1000 bytes are supported", spec)
+		}
+		return n, nil
+	}
+	min, err := parse(lo, 0)
+	if err != nil {
+		return "", err
+	}
+	if ranged && hi == "" {
+		return fmt.Sprintf(".{%d,}?", min), nil
+	}
+	max, err := parse(hi, 0)
+	if err != nil {
+		return "", err
+	}
+	if max < min {
+		return "", fmt.Errorf("bad jump [%s]", spec)
+	}
+	return fmt.Sprintf(".{%d,%d}?", min, max), nil
+}
+
+// regex reads /pattern/flags; only the i and s flags exist in YARA.
+func (p *yaraParser) regex() (string, error) {
+	p.pos++ // /
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '\\':
+			if p.pos < len(p.src) && p.src[p.pos] == '/' {
+				sb.WriteByte('/')
+				p.pos++
+				continue
+			}
+			sb.WriteByte(c)
+			if p.pos < len(p.src) {
+				sb.WriteByte(p.src[p.pos])
+				p.pos++
+			}
+		case '\n':
+			return "", p.errorf("unterminated regular expression")
+		case '/':
+			flags := ""
+			for p.pos < len(p.src) && (p.src[p.pos] == 'i' || p.src[p.pos] == 's') {
+				flags += string(p.src[p.pos])
+				p.pos++
+			}
+			if flags != "" {
+				return "(?" + flags + ")" + sb.String(), nil
+			}
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated regular expression")
+}
+
+// --- Conditions ---
+
+type yaraExpr interface {
+	eval(s *yaraScan) bool
+}
+
+type yaraNum interface {
+	value(s *yaraScan) int64
+}
+
+type (
+	yaraAnd   struct{ l, r yaraExpr }
+	yaraOr    struct{ l, r yaraExpr }
+	yaraNot   struct{ e yaraExpr }
+	yaraBool  bool
+	yaraStrID string
+	yaraOf    struct {
+		quant string // any, all, none or a number
+		n     int
+		ids   []string
+	}
+	yaraCmp struct {
+		op   string
+		l, r yaraNum
+	}
+	yaraLit      int64
+	yaraFilesize struct{}
+	yaraCount    string
+	yaraUint     struct {
+		bits   int
+		big    bool
+		offset int64
+	}
+)
+
+func (e yaraAnd) eval(s *yaraScan) bool   { return e.l.eval(s) && e.r.eval(s) }
+func (e yaraOr) eval(s *yaraScan) bool    { return e.l.eval(s) || e.r.eval(s) }
+func (e yaraNot) eval(s *yaraScan) bool   { return !e.e.eval(s) }
+func (e yaraBool) eval(*yaraScan) bool    { return bool(e) }
+func (e yaraStrID) eval(s *yaraScan) bool { return s.count(string(e)) > 0 }
+
+func (e yaraOf) eval(s *yaraScan) bool {
+	n := 0
+	for _, id := range e.ids {
+		if s.count(id) > 0 {
+			n++
+		}
+	}
+	switch e.quant {
+	case "any":
+		return n > 0
+	case "all":
+		return n == len(e.ids)
+	case "none":
+		return n == 0
+	}
+	return n >= e.n
+}
+
+func (e yaraCmp) eval(s *yaraScan) bool {
+	l, r := e.l.value(s), e.r.value(s)
+	switch e.op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	}
+	return l >= r
+}
+
+func (n yaraLit) value(*yaraScan) int64      { return int64(n) }
+func (yaraFilesize) value(s *yaraScan) int64 { return int64(len(s.data)) }
+func (c yaraCount) value(s *yaraScan) int64  { return int64(s.count(string(c))) }
+
+func (u yaraUint) value(s *yaraScan) int64 {
+	size := int64(u.bits / 8)
+	if u.offset < 0 || u.offset+size > int64(len(s.data)) {
+		return -1 // Out of range never equals a real value
+	}
+	b := s.data[u.offset : u.offset+size]
+	var order binary.ByteOrder = binary.LittleEndian
+	if u.big {
+		order = binary.BigEndian
+	}
+	switch u.bits {
+	case 8:
+		return int64(b[0])
+	case 16:
+		return int64(order.Uint16(b))
+	}
+	return int64(order.Uint32(b))
+}
+
+var yaraTokenRE = regexp.MustCompile(`^(?:\s+|[$#][A-Za-z0-9_]*\*?|0x[0-9A-Fa-f]+|\d+(?:KB|MB)?|[A-Za-z_][A-Za-z0-9_]*|==|!=|<=|>=|[<>(),])`)
+
+type condParser struct {
+	toks []string
+	pos  int
+	rule *YaraRule
+}
+
+func parseCondition(src string, r *YaraRule) (yaraExpr, error) {
+	var toks []string
+	for rest := src; rest != ""; {
+		m := yaraTokenRE.FindString(rest)
+		if m == "" {
+			return nil, fmt.Errorf("unsupported condition syntax at %q", rest)
+		}
+		if strings.TrimSpace(m) != "" {
+			toks = append(toks, m)
+		}
+		rest = rest[len(m):]
+	}
+	cp := &condParser{toks: toks, rule: r}
+	e, err := cp.or()
+	if err != nil {
+		return nil, err
+	}
+	if cp.pos < len(toks) {
+		return nil, fmt.Errorf("unexpected %q in condition", toks[cp.pos])
+	}
+	return e, nil
+}
+
+func (cp *condParser) peek() string {
+	if cp.pos < len(cp.toks) {
+		return cp.toks[cp.pos]
+	}
+	return ""
+}
+
+func (cp *condParser) next() string {
+	t := cp.peek()
+	cp.pos++
+	return t
+}
+
+func (cp *condParser) or() (yaraExpr, error) {
+	l, err := cp.and()
+	for err == nil && cp.peek() == "or" {
+		cp.pos++
+		var r yaraExpr
+		if r, err = cp.and(); err == nil {
+			l = yaraOr{l, r}
+		}
+	}
+	return l, err
+}
+
+func (cp *condParser) and() (yaraExpr, error) {
+	l, err := cp.not()
+	for err == nil && cp.peek() == "and" {
+		cp.pos++
+		var r yaraExpr
+		if r, err = cp.not(); err == nil {
+			l = yaraAnd{l, r}
+		}
+	}
+	return l, err
+}
+
+func (cp *condParser) not() (yaraExpr, error) {
+	if cp.peek() == "not" {
+		cp.pos++
+		e, err := cp.not()
+		return yaraNot{e}, err
+	}
+	return cp.primary()
+}
+
+func (cp *condParser) primary() (yaraExpr, error) {
+	tok := cp.peek()
+	switch {
+	case tok == "(":
+		cp.pos++
+		e, err := cp.or()
+		if err != nil {
+			return nil, err
+		}
+		if cp.next() != ")" {
+			return nil, fmt.Errorf("missing ) in condition")
+		}
+		return e, nil
+	case tok == "true" || tok == "false":
+		cp.pos++
+		return yaraBool(tok == "true"), nil
+	case tok == "any" || tok == "all" || tok == "none":
+		cp.pos++
+		return cp.of(tok, 0)
+	case strings.HasPrefix(tok, "$"):
+		cp.pos++
+		if !cp.hasString(tok) {
+			return nil, fmt.Errorf("undefined string %s", tok)
+		}
+		return yaraStrID(tok), nil
+	case tok != "" && tok[0] >= '0' && tok[0] <= '9' && cp.pos+1 < len(cp.toks) && cp.toks[cp.pos+1] == "of":
+		cp.pos++
+		n, _ := parseYaraNumber(tok)
+		return cp.of("", int(n))
+	}
+
+	l, err := cp.num()
+	if err != nil {
+		return nil, err
+	}
+	op := cp.next()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("expected comparison, got %q", op)
+	}
+	r, err := cp.num()
+	if err != nil {
+		return nil, err
+	}
+	return yaraCmp{op: op, l: l, r: r}, nil
+}
+
+func (cp *condParser) of(quant string, n int) (yaraExpr, error) {
+	if cp.next() != "of" {
+		return nil, fmt.Errorf("expected of")
+	}
+	var ids []string
+	if cp.peek() == "them" {
+		cp.pos++
+		for _, s := range cp.rule.strings {
+			ids = append(ids, s.id)
+		}
+	} else {
+		if cp.next() != "(" {
+			return nil, fmt.Errorf("expected them or a string set")
+		}
+		for {
+			ref := cp.next()
+			if !strings.HasPrefix(ref, "$") {
+				return nil, fmt.Errorf("bad string set entry %q", ref)
+			}
+			matched := false
+			for _, s := range cp.rule.strings {
+				if s.id == ref || strings.HasSuffix(ref, "*") && strings.HasPrefix(s.id, strings.TrimSuffix(ref, "*")) {
+					ids = append(ids, s.id)
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("undefined string %s", ref)
+			}
+			if sep := cp.next(); sep == ")" {
+				break
+			} else if sep != "," {
+				return nil, fmt.Errorf("expected , or ) in string set")
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("empty string set")
+	}
+	return yaraOf{quant: quant, n: n, ids: ids}, nil
+}
+
+func (cp *condParser) num() (yaraNum, error) {
+	tok := cp.next()
+	switch {
+	case tok == "filesize":
+		return yaraFilesize{}, nil
+	case strings.HasPrefix(tok, "#"):
+		id := "$" + tok[1:]
+		if !cp.hasString(id) {
+			return nil, fmt.Errorf("undefined string %s", id)
+		}
+		return yaraCount(id), nil
+	case strings.HasPrefix(tok, "uint") || strings.HasPrefix(tok, "int"):
+		u := yaraUint{}
+		name := strings.TrimPrefix(strings.TrimPrefix(tok, "u"), "int")
+		u.big = strings.HasSuffix(name, "be")
+		switch strings.TrimSuffix(name, "be") {
+		case "8":
+			u.bits = 8
+		case "16":
+			u.bits = 16
+		case "32":
+			u.bits = 32
+		default:
+			return nil, fmt.Errorf("unsupported function %s", tok)
+		}
+		if cp.next() != "(" {
+			return nil, fmt.Errorf("expected ( after %s", tok)
+		}
+		off, err := parseYaraNumber(cp.next())
+		if err != nil {
+			return nil, err
+		}
+		if cp.next() != ")" {
+			return nil, fmt.Errorf("%s takes a constant offset", tok)
+		}
+		u.offset = off
+		return u, nil
+	}
+	n, err := parseYaraNumber(tok)
+	if err != nil {
+		return nil, err
+	}
+	return yaraLit(n), nil
+}
+
+func (cp *condParser) hasString(id string) bool {
+	for _, s := range cp.rule.strings {
+		if s.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func parseYaraNumber(tok string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(tok, "KB"):
+		mult, tok = 1024, strings.TrimSuffix(tok, "KB")
+	case strings.HasSuffix(tok, "MB"):
+		mult, tok = 1024*1024, strings.TrimSuffix(tok, "MB")
+	}
+	n, err := strconv.ParseInt(tok, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number, got %q", tok)
+	}
+	return n * mult, nil
+}
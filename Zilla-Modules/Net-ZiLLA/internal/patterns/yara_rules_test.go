@@ -0,0 +1,141 @@
+package patterns
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestYaraManager_Scan(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		data  string
+		match bool
+	}{
+		{"text", `rule r { strings: $a = "evil" condition: $a }`, "an evil file", true},
+		{"text miss", `rule r { strings: $a = "evil" condition: $a }`, "an EVIL file", false},
+		{"nocase", `rule r { strings: $a = "evil" nocase condition: $a }`, "an EVIL file", true},
+		{"wide", `rule r { strings: $a = "cmd" wide condition: $a }`, "c\x00m\x00d\x00", true},
+		{"wide only", `rule r { strings: $a = "cmd" wide condition: $a }`, "cmd", false},
+		{"ascii wide", `rule r { strings: $a = "cmd" ascii wide condition: $a }`, "cmd", true},
+		{"fullword", `rule r { strings: $a = "shell" fullword condition: $a }`, "a shell here", true},
+		{"fullword inside word", `rule r { strings: $a = "shell" fullword condition: $a }`, "powershell", false},
+		{"escapes", `rule r { strings: $a = "a\x00\"b" condition: $a }`, "a\x00\"b", true},
+		{"hex", `rule r { strings: $a = { 4D 5A 90 00 } condition: $a }`, "MZ\x90\x00", true},
+		{"hex wildcard", `rule r { strings: $a = { 4D ?? 9? ?0 } condition: $a }`, "M\xff\x9a\x10", true},
+		{"hex jump", `rule r { strings: $a = { 41 [2-4] 42 } condition: $a }`, "A123B", true},
+		{"hex jump too far", `rule r { strings: $a = { 41 [2-4] 42 } condition: $a }`, "A12345B", false},
+		{"hex alternation", `rule r { strings: $a = { 41 ( 42 | 43 44 ) 45 } condition: $a }`, "ACDE", true},
+		{"regex", `rule r { strings: $a = /https?:\/\/[a-z]+\.example/i condition: $a }`, "GET HTTP://EVIL.example", true},
+		{"count", `rule r { strings: $a = "x" condition: #a >= 3 }`, "x-x-x", true},
+		{"count low", `rule r { strings: $a = "x" condition: #a >= 3 }`, "x-x", false},
+		{"filesize", `rule r { condition: filesize < 1KB }`, "small", true},
+		{"uint16", `rule r { condition: uint16(0) == 0x5A4D }`, "MZ", true},
+		{"uint32be", `rule r { condition: uint32be(0) == 0x25504446 }`, "%PDF-1.7", true},
+		{"uint out of range", `rule r { condition: uint32(4) == 0 }`, "MZ", false},
+		{"any of them", `rule r { strings: $a = "a" $b = "b" condition: any of them }`, "b", true},
+		{"all of them", `rule r { strings: $a = "a" $b = "b" condition: all of them }`, "b", false},
+		{"none of", `rule r { strings: $a = "a" $b = "b" condition: none of ($a, $b) }`, "c", true},
+		{"n of wildcard", `rule r { strings: $x1 = "1" $x2 = "2" $y = "3" condition: 2 of ($x*) }`, "123", true},
+		{"not and or", `rule r { strings: $a = "a" $b = "b" condition: not $a and ($b or false) }`, "b", true},
+		{"comments and meta", `
+			// A comment
+			rule r : tag1 tag2 {
+				meta:
+					description = "Test rule" /* inline */
+					score = 5
+					enabled = true
+				strings:
+					$a = "x"
+				condition:
+					$a
+			}`, "x", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ym := NewYaraManager()
+			if err := ym.AddRules(tt.rule); err != nil {
+				t.Fatalf("AddRules: %v", err)
+			}
+			matches := ym.Scan([]byte(tt.data))
+			if got := len(matches) == 1; got != tt.match {
+				t.Errorf("match = %v, want %v", got, tt.match)
+			}
+		})
+	}
+}
+
+func TestYaraManager_MatchDetails(t *testing.T) {
+	ym := NewYaraManager()
+	err := ym.AddRules(`
+		private rule helper { condition: true }
+		rule Dropper : malware loader {
+			meta:
+				description = "Drops a payload"
+				severity = "high"
+			strings:
+				$a = "payload"
+				$b = "unused"
+			condition:
+				$a
+		}`)
+	if err != nil {
+		t.Fatalf("AddRules: %v", err)
+	}
+	matches := ym.Scan([]byte("payload"))
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want only the public rule", len(matches))
+	}
+	m := matches[0]
+	if m.Rule != "Dropper" || strings.Join(m.Tags, ",") != "malware,loader" || m.Meta["severity"] != "high" ||
+		strings.Join(m.Strings, ",") != "$a" {
+		t.Errorf("unexpected match: %+v", m)
+	}
+	if ym.Rules()[1].Description != "Drops a payload" {
+		t.Errorf("Description = %q", ym.Rules()[1].Description)
+	}
+}
+
+func TestYaraManager_Errors(t *testing.T) {
+	bad := []string{
+		`import "pe" rule r { condition: pe.is_dll() }`,
+		`rule r { condition: $missing }`,
+		`rule r { strings: $a = "x" xor condition: $a }`,
+		`rule r { strings: $a = { 4D 5 } condition: $a }`,
+		`rule r { strings: $a = { 41 [1-5000] 42 } condition: $a }`,
+		`rule r { condition: math.entropy(0, filesize) > 7 }`,
+		`rule r { strings: $a = "x" condition: $a`,
+		`strings: $a = "x"`,
+	}
+	for _, src := range bad {
+		if err := NewYaraManager().AddRules(src); err == nil {
+			t.Errorf("expected an error for %q", src)
+		}
+	}
+}
+
+func TestYaraManager_LoadRules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yar":    `rule A { strings: $a = "alpha" condition: $a }`,
+		"b.yara":   `rule B { strings: $b = "beta" condition: $b }`,
+		"notes.md": `not a rule`,
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ym := NewYaraManager()
+	if err := ym.LoadRules(dir); err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+	if n := len(ym.Scan([]byte("alpha beta"))); n != 2 {
+		t.Errorf("got %d matches, want 2", n)
+	}
+	if err := ym.LoadRules(filepath.Join(dir, "missing.yar")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
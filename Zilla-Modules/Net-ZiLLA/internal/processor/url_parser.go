@@ -82,14 +82,21 @@ func (p *URLParser) ParseAndAnalyze(rawURL string) (*ParsedURL, error) {
 	return parsed, nil
 }
 
+// Normalize returns the canonical form of rawURL, so that spellings of the same
+// address such as "HTTP://Example.com:80" and "http://example.com/" compare
+// equal. A missing scheme is taken to be https.
+func (p *URLParser) Normalize(rawURL string) (string, error) {
+	return p.normalizeURL(rawURL)
+}
+
 func (p *URLParser) normalizeURL(rawURL string) (string, error) {
 	// Ensure scheme
 	if !strings.Contains(rawURL, "://") {
 		rawURL = "https://" + rawURL
 	}
 
-	// Parse to validate
-	u, err := url.Parse(rawURL)
+	// Parse to validate; the scheme comes back lowercased
+	u, err := url.Parse(strings.TrimSpace(rawURL))
 	if err != nil {
 		return "", err
 	}
@@ -97,9 +104,18 @@ func (p *URLParser) normalizeURL(rawURL string) (string, error) {
 	// Normalize host to lowercase
 	u.Host = strings.ToLower(u.Host)
 
-	// Remove default ports
-	u.Host = strings.TrimSuffix(u.Host, ":80")
-	u.Host = strings.TrimSuffix(u.Host, ":443")
+	// Remove the scheme's default port
+	switch u.Scheme {
+	case "http":
+		u.Host = strings.TrimSuffix(u.Host, ":80")
+	case "https":
+		u.Host = strings.TrimSuffix(u.Host, ":443")
+	}
+
+	// An empty path and "/" request the same resource
+	if u.Path == "" && u.Opaque == "" && u.Host != "" {
+		u.Path = "/"
+	}
 
 	return u.String(), nil
 }
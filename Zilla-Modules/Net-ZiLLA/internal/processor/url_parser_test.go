@@ -63,6 +63,34 @@ func TestURLParser_ParseAndAnalyze(t *testing.T) {
 	}
 }
 
+func TestURLParser_Normalize(t *testing.T) {
+	p := NewURLParser()
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"HTTP://Example.com/", "http://example.com/"},
+		{"http://example.com", "http://example.com/"},
+		{"http://EXAMPLE.com:80/a?b=1", "http://example.com/a?b=1"},
+		{"https://example.com:443", "https://example.com/"},
+		{"https://example.com:80/", "https://example.com:80/"},
+		{"example.com/Path", "https://example.com/Path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := p.Normalize(tt.url)
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestURLParser_DetectHomographAttack(t *testing.T) {
 	p := NewURLParser()
 
@@ -2,55 +2,73 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"net-zilla/internal/ai"
 	"net-zilla/internal/analyzer"
 	"net-zilla/internal/config"
+	"net-zilla/internal/coordination"
+	"net-zilla/internal/correlation"
+	"net-zilla/internal/fileanalysis"
 	"net-zilla/internal/models"
+	"net-zilla/internal/network"
+	"net-zilla/internal/processor"
 	"net-zilla/internal/storage"
+	"net-zilla/internal/visualization"
 	"net-zilla/pkg/logger"
 )
 
 // AnalysisService defines the high-level business logic for security operations.
 type AnalysisService struct {
 	orchestrator *analyzer.AnalysisOrchestrator
-	db           *storage.Database
+	db           storage.Store
 	logger       *logger.Logger
 	config       *config.Config
 	
-	// Cache layer for recent analyses
-	cache        map[string]*cacheEntry
-	cacheMutex   sync.RWMutex
+	// Cache layer for recent analyses, shared between replicas when Redis is configured
+	cache        coordination.CacheProvider
 	cacheTTL     time.Duration
 	
 	// Rate limiting and concurrency control
 	semaphore    chan struct{}
 	maxConcurrent int
 	
-	// Distributed lock for preventing duplicate analyses
-	inProgress   map[string]*analysisLock
-	lockMutex    sync.RWMutex
+	// Coalesces concurrent requests for the same target within this instance
+	flights      *flightGroup
+	urlParser    *processor.URLParser
+	
+	// Per-target locks preventing duplicate analyses across replicas
+	locks        coordination.LockProvider
 	lockTTL      time.Duration
+	heldLocks    int64 // Locks currently held by this instance, accessed atomically
 	
 	// Service instance identification
 	instanceID   string
 	
 	// Metrics
 	metrics      *ServiceMetrics
-}
-
-type cacheEntry struct {
-	report    *models.AdvancedReport
-	timestamp time.Time
-}
 
-type analysisLock struct {
-	analysisID string
-	createdAt  time.Time
-	owner      string // Instance ID of the service holding the lock
+	// Text heuristics for SMS and email bodies
+	messageAgent *ai.GoAgent
+	// Analyst explanation of each report, drafted by ai.llm_endpoint when set
+	explainer    *ai.Explainer
+	// SPF/DKIM/DMARC verification of raw emails
+	emailAuth    *network.EmailAuthAnalyzer
+	// Static analysis of submitted files and attachments
+	fileAnalyzer *fileanalysis.Analyzer
+	// HTML, PDF, JSON and text renderings of reports
+	reports      *visualization.ReportGenerator
+	// Infrastructure shared between analyses; nil without a database
+	graph        *correlation.InfrastructureGraph
+	// Campaigns grouping related analyses; nil without a database
+	campaigns    *correlation.CampaignTracker
 }
 
 type ServiceMetrics struct {
@@ -61,53 +79,128 @@ type ServiceMetrics struct {
 	FailedAnalyses      int64
 	AverageDuration     time.Duration
 	DuplicatePrevented  int64
+	Coalesced           int64 // Calls answered by an analysis another caller started
 	LockAcquisitions    int64
 	LockFailures        int64
 	mu                  sync.RWMutex
 }
 
-func NewAnalysisService(l *logger.Logger, db *storage.Database, cfg *config.Config) *AnalysisService {
+func NewAnalysisService(l *logger.Logger, db storage.Store, cfg *config.Config) *AnalysisService {
+	dnsClient := network.NewDNSClient(l)
 	service := &AnalysisService{
 		orchestrator: analyzer.NewAnalysisOrchestrator(l, cfg),
 		db:           db,
 		logger:       l.WithComponent("analysis_service"),
 		config:       cfg,
-		cache:        make(map[string]*cacheEntry),
+		cache:        coordination.NewMemoryCache(1000),
 		cacheTTL:     15 * time.Minute,
 		maxConcurrent: 5,
-		inProgress:   make(map[string]*analysisLock),
+		flights:      newFlightGroup(),
+		urlParser:    processor.NewURLParser(),
+		locks:        coordination.NewMemoryLocks(),
 		lockTTL:      2 * time.Minute,
 		instanceID:   generateInstanceID(),
 		metrics:      &ServiceMetrics{},
+		messageAgent: ai.NewGoAgent(cfg.AI.ConfidenceThreshold),
+		explainer:    ai.NewExplainerFromConfig(&cfg.AI, l.WithComponent("explainer")),
+		emailAuth:    network.NewEmailAuthAnalyzer(l, dnsClient),
+		fileAnalyzer: fileanalysis.NewAnalyzer(l),
+		reports:      visualization.NewReportGenerator(),
+	}
+	// Message sender checks share the cassette configured for URL analysis
+	dnsClient.SetCassette(service.orchestrator.Cassette())
+	service.emailAuth.SetCassette(service.orchestrator.Cassette())
+	service.orchestrator.OnSandboxComplete(service.applySandbox)
+	if db != nil {
+		service.graph = correlation.NewInfrastructureGraph(db)
+		service.campaigns = correlation.NewCampaignTracker(db, correlation.DefaultCampaignConfig())
+	}
+	if cfg.Analysis != nil && cfg.Analysis.YaraRules != "" {
+		if err := service.fileAnalyzer.LoadYaraRules(cfg.Analysis.YaraRules); err != nil {
+			service.logger.Warn("Failed to load YARA rules: %v", err)
+		}
+	}
+	
+	if cfg.Service != nil && cfg.Service.RedisURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		client, err := coordination.NewRedisClient(ctx, cfg.Service.RedisURL)
+		cancel()
+		if err != nil {
+			service.logger.Warn("Redis unavailable, locks and cache stay local to this instance: %v", err)
+		} else {
+			service.locks = coordination.NewRedisLocks(client, cfg.Service.KeyPrefix)
+			service.cache = coordination.NewRedisCache(client, cfg.Service.KeyPrefix)
+		}
 	}
 	
 	// Initialize semaphore for concurrency control
 	service.semaphore = make(chan struct{}, service.maxConcurrent)
 	
-	// Start cleanup goroutines
-	go service.startCacheCleanup()
-	go service.startLockCleanup()
-	
 	service.logger.Info("AnalysisService initialized (instance: %s) with max %d concurrent analyses", 
 		service.instanceID, service.maxConcurrent)
 	
 	return service
 }
 
-// PerformAnalysis executes a full scan and persists the results.
+// Close waits for background sandbox runs, cancels running analyses and writes
+// a network cassette being recorded. Storage is owned and closed by the caller.
+func (s *AnalysisService) Close() {
+	s.orchestrator.Close()
+}
+
+// SetLockProvider replaces the per-target analysis locks. Replicas given the
+// same provider never analyze a target at the same time.
+func (s *AnalysisService) SetLockProvider(locks coordination.LockProvider) {
+	s.locks = locks
+}
+
+// SetCacheProvider replaces the report cache. Replicas given the same provider
+// reuse each other's results.
+func (s *AnalysisService) SetCacheProvider(cache coordination.CacheProvider) {
+	s.cache = cache
+}
+
+// PerformAnalysis executes a full scan and persists the results. Concurrent
+// calls for the same normalized target share one analysis; each caller stops
+// waiting when its own context ends, and the analysis is abandoned only when
+// all of them have.
 func (s *AnalysisService) PerformAnalysis(ctx context.Context, target string) (*models.AdvancedReport, error) {
-	startTime := time.Now()
-	
 	// Validate input
 	if target == "" {
-		s.recordMetrics(false, time.Since(startTime), "empty_target")
+		s.recordMetrics(false, 0, "empty_target")
 		return nil, fmt.Errorf("target cannot be empty")
 	}
 	
+	key := s.analysisKey(target)
+	report, shared, err := s.flights.do(ctx, key, func(ctx context.Context) (*models.AdvancedReport, error) {
+		return s.runAnalysis(ctx, target, key)
+	})
+	if shared {
+		s.recordCoalesced()
+		s.logger.Debug("Coalesced analysis request for %s into one already running", target)
+	}
+	return report, err
+}
+
+// analysisKey identifies a target for caching, locking and coalescing, so that
+// spellings of the same URL share results.
+func (s *AnalysisService) analysisKey(target string) string {
+	key, err := s.urlParser.Normalize(target)
+	if err != nil {
+		return strings.TrimSpace(target)
+	}
+	return key
+}
+
+// runAnalysis performs the analysis of target on behalf of every caller
+// coalesced under key.
+func (s *AnalysisService) runAnalysis(ctx context.Context, target, key string) (*models.AdvancedReport, error) {
+	startTime := time.Now()
+	
 	s.logger.Info("Service: Starting analysis for %s", target)
 	
 	// Check cache first
-	if cachedReport := s.getFromCache(target); cachedReport != nil {
+	if cachedReport := s.getFromCache(ctx, key); cachedReport != nil {
 		s.recordCacheHit()
 		s.logger.Debug("Cache hit for: %s", target)
 		return cachedReport, nil
@@ -115,15 +208,23 @@ func (s *AnalysisService) PerformAnalysis(ctx context.Context, target string) (*
 	
 	s.recordCacheMiss()
 	
-	// Check if analysis is already in progress (distributed lock check)
-	if s.isAnalysisInProgress(target) {
+	// Acquire the per-target lock; it fails if any replica is already analyzing the target
+	lock, err := s.acquireLock(ctx, key)
+	if err != nil {
+		s.recordLockFailure()
+		s.logger.Warn("Failed to acquire lock for analysis of %s: %v", target, err)
+		s.recordMetrics(false, time.Since(startTime), "lock_failed")
+		return nil, fmt.Errorf("unable to start analysis for %s, please try again", target)
+	}
+	
+	if lock == nil {
 		s.recordDuplicatePrevented()
 		
 		s.logger.Warn("Analysis already in progress for: %s, waiting or returning error", target)
 		
 		// Option 1: Wait for ongoing analysis to complete (configurable)
 		if s.config.Service != nil && s.config.Service.WaitForDuplicateAnalysis {
-			if report := s.waitForAnalysis(target, 30*time.Second); report != nil {
+			if report := s.waitForAnalysis(ctx, key); report != nil {
 				s.logger.Info("Waited and retrieved result for: %s", target)
 				return report, nil
 			}
@@ -134,19 +235,16 @@ func (s *AnalysisService) PerformAnalysis(ctx context.Context, target string) (*
 		return nil, fmt.Errorf("analysis already in progress for %s, please try again in a moment", target)
 	}
 	
-	// Acquire distributed lock before starting analysis
-	lockAcquired, lockID := s.acquireLock(target)
-	if !lockAcquired {
-		s.recordLockFailure()
-		s.logger.Warn("Failed to acquire lock for analysis of: %s", target)
-		s.recordMetrics(false, time.Since(startTime), "lock_failed")
-		return nil, fmt.Errorf("unable to start analysis for %s, please try again", target)
-	}
-	
 	s.recordLockAcquisition()
 	
 	// Ensure lock is released when analysis completes
-	defer s.releaseLock(target, lockID)
+	defer s.releaseLock(lock)
+	
+	// Another replica may have finished the target between the cache check and the lock
+	if cachedReport := s.getFromCache(ctx, key); cachedReport != nil {
+		s.logger.Debug("Cache filled while acquiring lock for: %s", target)
+		return cachedReport, nil
+	}
 	
 	// Acquire semaphore for concurrency control
 	select {
@@ -154,11 +252,9 @@ func (s *AnalysisService) PerformAnalysis(ctx context.Context, target string) (*
 		// Got slot, continue
 		defer func() { <-s.semaphore }() // Release slot when done
 	case <-ctx.Done():
-		s.releaseLock(target, lockID)
 		s.recordMetrics(false, time.Since(startTime), "semaphore_timeout")
 		return nil, fmt.Errorf("analysis timeout while waiting for available slot: %w", ctx.Err())
 	default:
-		s.releaseLock(target, lockID)
 		s.recordMetrics(false, time.Since(startTime), "semaphore_full")
 		return nil, fmt.Errorf("too many concurrent analyses, please try again later")
 	}
@@ -184,8 +280,13 @@ func (s *AnalysisService) PerformAnalysis(ctx context.Context, target string) (*
 	
 	// Ensure report has required fields
 	s.enrichReport(report, target, startTime)
+	report.Metadata["lock_token"] = lock.Token // Fencing token checked by the cache; later analyses carry larger ones
+	
+	// Explain the verdict in what is left of the analysis timeout, within
+	// ai.llm_timeout; the built-in explanation stands in when time runs out
+	s.explainer.ApplyReport(analysisCtx, report)
 	
-	// Persistence: Save the summary to history
+	// Persistence: Save the summary to history and the full report for retrieval by ID
 	if s.db != nil {
 		summary := &models.ThreatAnalysis{
 			AnalysisID:  report.ReportID,
@@ -202,10 +303,25 @@ func (s *AnalysisService) PerformAnalysis(ctx context.Context, target string) (*
 		} else {
 			s.logger.Debug("Analysis saved to database: %s", report.ReportID)
 		}
+		if err := s.db.SaveReport(ctx, report); err != nil {
+			s.logger.Warn("Service: Failed to persist report for %s: %v", target, err)
+		}
+		s.recordGraph(ctx, report)
+		s.recordCampaign(ctx, report)
+	}
+	
+	// Write report files when output.save_reports is set
+	if s.config.Output.SaveReports {
+		s.saveReportFiles(report)
 	}
 	
-	// Cache the result
-	s.addToCache(target, report)
+	// Cache the result, unless a later analysis of the target already has
+	s.addToCacheFenced(ctx, key, report, lock.Token)
+	
+	// Start a queued sandbox run now that there is a stored report to update
+	if s.orchestrator.Escalate(report) {
+		s.logger.Info("Service: Sandbox escalation for %s continues in the background", report.ReportID)
+	}
 	
 	// Update metrics
 	s.recordMetrics(true, time.Since(startTime), "success")
@@ -218,145 +334,63 @@ func (s *AnalysisService) PerformAnalysis(ctx context.Context, target string) (*
 
 // ============ DISTRIBUTED LOCK IMPLEMENTATION ============
 
-// isAnalysisInProgress checks if an analysis is already in progress for the target
-func (s *AnalysisService) isAnalysisInProgress(target string) bool {
-	s.lockMutex.RLock()
-	defer s.lockMutex.RUnlock()
-	
-	lock, exists := s.inProgress[target]
-	if !exists {
-		return false
-	}
-	
-	// Check if lock is still valid (not expired)
-	if time.Since(lock.createdAt) < s.lockTTL {
-		return true
-	}
-	
-	// Lock expired, clean it up
-	s.lockMutex.RUnlock()
-	s.lockMutex.Lock()
-	delete(s.inProgress, target)
-	s.lockMutex.Unlock()
-	s.lockMutex.RLock()
-	
-	return false
-}
-
-// acquireLock attempts to acquire a distributed lock for analysis
-func (s *AnalysisService) acquireLock(target string) (bool, string) {
-	s.lockMutex.Lock()
-	defer s.lockMutex.Unlock()
-	
-	// Check if lock already exists and is not expired
-	if lock, exists := s.inProgress[target]; exists {
-		if time.Since(lock.createdAt) < s.lockTTL {
-			s.logger.Debug("Lock already held for %s by instance %s (age: %v)", 
-				target, lock.owner, time.Since(lock.createdAt))
-			return false, ""
-		}
-		// Lock expired, remove it
-		delete(s.inProgress, target)
-		s.logger.Debug("Removed expired lock for %s", target)
+// acquireLock takes the analysis lock for target. It returns nil without an
+// error when another instance already holds the lock.
+func (s *AnalysisService) acquireLock(ctx context.Context, target string) (*coordination.Lock, error) {
+	lock, err := s.locks.TryAcquire(ctx, target, s.instanceID, s.lockTTL)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Create new lock
-	lockID := generateLockID()
-	s.inProgress[target] = &analysisLock{
-		analysisID: lockID,
-		createdAt:  time.Now(),
-		owner:      s.instanceID,
+	if lock == nil {
+		s.logger.Debug("Lock already held for %s", target)
+		return nil, nil
 	}
 	
-	s.logger.Debug("Acquired lock %s for target: %s (instance: %s)", 
-		lockID, target, s.instanceID)
-	return true, lockID
+	atomic.AddInt64(&s.heldLocks, 1)
+	s.logger.Debug("Acquired lock for target: %s (instance: %s, token: %d)", 
+		target, s.instanceID, lock.Token)
+	return lock, nil
 }
 
-// releaseLock releases a distributed lock
-func (s *AnalysisService) releaseLock(target string, lockID string) bool {
-	s.lockMutex.Lock()
-	defer s.lockMutex.Unlock()
-	
-	lock, exists := s.inProgress[target]
-	if !exists {
-		s.logger.Debug("Lock already released for target: %s", target)
-		return true
-	}
-	
-	if lock.analysisID == lockID {
-		delete(s.inProgress, target)
-		s.logger.Debug("Released lock %s for target: %s", lockID, target)
-		return true
-	}
+// releaseLock releases a lock taken by acquireLock. It does not use the
+// request context so that a cancelled request still frees the lock.
+func (s *AnalysisService) releaseLock(lock *coordination.Lock) bool {
+	atomic.AddInt64(&s.heldLocks, -1)
 	
-	// Lock ID doesn't match, someone else might have taken over
-	s.logger.Warn("Lock ID mismatch for %s: expected %s, got %s (owner: %s)", 
-		target, lockID, lock.analysisID, lock.owner)
-	return false
-}
-
-// waitForAnalysis waits for an ongoing analysis to complete
-func (s *AnalysisService) waitForAnalysis(target string, timeout time.Duration) *models.AdvancedReport {
-	s.logger.Debug("Waiting for analysis of %s (timeout: %v)", target, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	
-	start := time.Now()
-	checkInterval := 500 * time.Millisecond
-	maxChecks := int(timeout / checkInterval)
-	
-	for i := 0; i < maxChecks; i++ {
-		// Check if analysis is still in progress
-		if !s.isAnalysisInProgress(target) {
-			// Analysis completed, check cache for result
-			if cached := s.getFromCache(target); cached != nil {
-				waitTime := time.Since(start)
-				s.logger.Debug("Waited %v for analysis of %s, returning cached result", 
-					waitTime, target)
-				return cached
-			}
+	if err := s.locks.Release(ctx, lock); err != nil {
+		if errors.Is(err, coordination.ErrLockLost) {
+			s.logger.Warn("Lock for %s expired before the analysis finished (token %d)", lock.Key, lock.Token)
+		} else {
+			s.logger.Warn("Failed to release lock for %s: %v", lock.Key, err)
 		}
-		
-		// Wait before checking again
-		time.Sleep(checkInterval)
+		return false
 	}
 	
-	s.logger.Debug("Timeout waiting for analysis of %s after %v", target, timeout)
-	return nil
+	s.logger.Debug("Released lock %d for target: %s", lock.Token, lock.Key)
+	return true
 }
 
-// startLockCleanup periodically cleans up expired locks
-func (s *AnalysisService) startLockCleanup() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+// waitForAnalysis waits for the instance holding the lock on target to
+// finish and returns the report it cached. It returns nil if ctx ends first
+// or the holder cached nothing; the wait is bounded by the lock TTL.
+func (s *AnalysisService) waitForAnalysis(ctx context.Context, target string) *models.AdvancedReport {
+	s.logger.Debug("Waiting for analysis of %s (lock TTL: %v)", target, s.lockTTL)
 	
-	for {
-		select {
-		case <-ticker.C:
-			s.cleanupExpiredLocks()
-		}
-	}
-}
-
-// cleanupExpiredLocks removes locks that have expired
-func (s *AnalysisService) cleanupExpiredLocks() {
-	s.lockMutex.Lock()
-	defer s.lockMutex.Unlock()
-	
-	now := time.Now()
-	removedCount := 0
-	
-	for target, lock := range s.inProgress {
-		if now.Sub(lock.createdAt) > s.lockTTL {
-			delete(s.inProgress, target)
-			removedCount++
-			s.logger.Debug("Cleaned up expired lock for target: %s (owner: %s, age: %v)", 
-				target, lock.owner, now.Sub(lock.createdAt))
-		}
+	start := time.Now()
+	if err := s.locks.WaitRelease(ctx, target); err != nil {
+		s.logger.Debug("Stopped waiting for analysis of %s after %v: %v", target, time.Since(start), err)
+		return nil
 	}
 	
-	if removedCount > 0 {
-		s.logger.Info("Lock cleanup removed %d expired locks", removedCount)
+	if cached := s.getFromCache(ctx, target); cached != nil {
+		s.logger.Debug("Waited %v for analysis of %s, returning cached result", 
+			time.Since(start), target)
+		return cached
 	}
+	return nil
 }
 
 // ============ INSTANCE ID GENERATION ============
@@ -386,100 +420,69 @@ func generateInstanceID() string {
 	return instanceID
 }
 
-// generateLockID creates a unique lock ID
-func generateLockID() string {
-	return fmt.Sprintf("lock-%d-%d", time.Now().UnixNano(), os.Getpid())
-}
-
 // ============ CACHE MANAGEMENT ============
 
-func (s *AnalysisService) getFromCache(target string) *models.AdvancedReport {
-	s.cacheMutex.RLock()
-	defer s.cacheMutex.RUnlock()
-	
-	entry, exists := s.cache[target]
-	if !exists {
+// Reports are cached as JSON so that the memory and Redis caches behave the
+// same and callers never share a report with the cache.
+func (s *AnalysisService) getFromCache(ctx context.Context, target string) *models.AdvancedReport {
+	data, ok, err := s.cache.Get(ctx, target)
+	if err != nil {
+		s.logger.Warn("Cache read failed for %s: %v", target, err)
 		return nil
 	}
-	
-	if time.Since(entry.timestamp) < s.cacheTTL {
-		return entry.report
-	}
-	
-	// Entry expired, remove it
-	s.cacheMutex.RUnlock()
-	s.cacheMutex.Lock()
-	delete(s.cache, target)
-	s.cacheMutex.Unlock()
-	s.cacheMutex.RLock()
-	
-	return nil
-}
-
-func (s *AnalysisService) addToCache(target string, report *models.AdvancedReport) {
-	s.cacheMutex.Lock()
-	defer s.cacheMutex.Unlock()
-	
-	s.cache[target] = &cacheEntry{
-		report:    report,
-		timestamp: time.Now(),
+	if !ok {
+		return nil
 	}
 	
-	// Limit cache size to prevent memory exhaustion
-	if len(s.cache) > 1000 {
-		s.evictOldestCacheEntries(100) // Keep cache at 900 entries
+	var report models.AdvancedReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		s.logger.Warn("Dropping unreadable cache entry for %s: %v", target, err)
+		s.cache.Delete(ctx, target)
+		return nil
 	}
+	return &report
 }
 
-func (s *AnalysisService) evictOldestCacheEntries(count int) {
-	if len(s.cache) <= count {
-		s.cache = make(map[string]*cacheEntry)
+func (s *AnalysisService) addToCache(ctx context.Context, target string, report *models.AdvancedReport) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		s.logger.Warn("Failed to encode report for cache: %v", err)
 		return
 	}
-	
-	// Simple eviction: remove random entries (in production, use LRU)
-	// For simplicity, we'll just clear some entries
-	removed := 0
-	for key := range s.cache {
-		if removed >= count {
-			break
-		}
-		delete(s.cache, key)
-		removed++
+	if err := s.cache.Set(ctx, target, data, s.cacheTTL); err != nil {
+		s.logger.Warn("Cache write failed for %s: %v", target, err)
 	}
-	
-	s.logger.Debug("Evicted %d cache entries, cache size: %d", removed, len(s.cache))
 }
 
-func (s *AnalysisService) startCacheCleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-ticker.C:
-			s.cleanupExpiredCache()
-		}
+// addToCacheFenced caches the report of an analysis run under the lock with
+// token. If the lock expired and a later analysis has cached its report, the
+// later one is kept.
+func (s *AnalysisService) addToCacheFenced(ctx context.Context, target string, report *models.AdvancedReport, token int64) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		s.logger.Warn("Failed to encode report for cache: %v", err)
+		return
+	}
+	err = s.cache.SetFenced(ctx, target, data, token, s.cacheTTL)
+	switch {
+	case errors.Is(err, coordination.ErrStaleToken):
+		s.logger.Warn("Not caching %s: the lock expired and a later analysis replaced it (token %d)", report.ReportID, token)
+	case err != nil:
+		s.logger.Warn("Cache write failed for %s: %v", target, err)
 	}
 }
 
-func (s *AnalysisService) cleanupExpiredCache() {
-	s.cacheMutex.Lock()
-	defer s.cacheMutex.Unlock()
-	
-	now := time.Now()
-	removedCount := 0
-	
-	for key, entry := range s.cache {
-		if now.Sub(entry.timestamp) > s.cacheTTL {
-			delete(s.cache, key)
-			removedCount++
-		}
-	}
+// cacheSize counts cached reports, or returns -1 if the cache cannot be read.
+func (s *AnalysisService) cacheSize() int {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
 	
-	if removedCount > 0 {
-		s.logger.Debug("Cache cleanup removed %d expired entries", removedCount)
+	n, err := s.cache.Len(ctx)
+	if err != nil {
+		s.logger.Warn("Cache size unavailable: %v", err)
+		return -1
 	}
+	return n
 }
 
 // ============ METRICS TRACKING ============
@@ -528,6 +531,12 @@ func (s *AnalysisService) recordDuplicatePrevented() {
 	s.metrics.mu.Unlock()
 }
 
+func (s *AnalysisService) recordCoalesced() {
+	s.metrics.mu.Lock()
+	s.metrics.Coalesced++
+	s.metrics.mu.Unlock()
+}
+
 func (s *AnalysisService) recordLockAcquisition() {
 	s.metrics.mu.Lock()
 	s.metrics.LockAcquisitions++
@@ -545,13 +554,8 @@ func (s *AnalysisService) GetServiceMetrics() map[string]interface{} {
 	s.metrics.mu.RLock()
 	defer s.metrics.mu.RUnlock()
 	
-	s.lockMutex.RLock()
-	currentLocks := len(s.inProgress)
-	s.lockMutex.RUnlock()
-	
-	s.cacheMutex.RLock()
-	cacheSize := len(s.cache)
-	s.cacheMutex.RUnlock()
+	currentLocks := atomic.LoadInt64(&s.heldLocks)
+	cacheSize := s.cacheSize()
 	
 	successRate := 0.0
 	if s.metrics.TotalAnalyses > 0 {
@@ -584,6 +588,8 @@ func (s *AnalysisService) GetServiceMetrics() map[string]interface{} {
 		"current_concurrent":     len(s.semaphore),
 		"max_concurrent":         s.maxConcurrent,
 		"duplicate_prevented":    s.metrics.DuplicatePrevented,
+		"coalesced":              s.metrics.Coalesced,
+		"in_flight":              s.flights.inFlight(),
 		"current_locks":          currentLocks,
 		"lock_acquisitions":      s.metrics.LockAcquisitions,
 		"lock_failures":          s.metrics.LockFailures,
@@ -627,6 +633,94 @@ func (s *AnalysisService) GetAnalysisByID(ctx context.Context, analysisID string
 	return s.db.GetAnalysisByID(ctx, analysisID)
 }
 
+// GetReport retrieves the full report of a past analysis as it was computed.
+// It returns storage.ErrNotFound when no report has that ID.
+func (s *AnalysisService) GetReport(ctx context.Context, analysisID string) (*models.AdvancedReport, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	
+	if analysisID == "" {
+		return nil, fmt.Errorf("analysis ID cannot be empty")
+	}
+	
+	return s.db.GetReport(ctx, analysisID)
+}
+
+// RenderReport renders the stored report of a past analysis in one of the
+// visualization.Format constants. It returns storage.ErrNotFound when no
+// report has that ID.
+func (s *AnalysisService) RenderReport(ctx context.Context, analysisID, format string) ([]byte, error) {
+	report, err := s.GetReport(ctx, analysisID)
+	if err != nil {
+		return nil, err
+	}
+	return s.reports.Generate(report, format)
+}
+
+// Traceroute traces the route to the host of a URL, domain or IP. Hops are
+// annotated with reverse DNS, ASN and country.
+func (s *AnalysisService) Traceroute(ctx context.Context, target string) (*models.NetworkAnalysis, error) {
+	return s.orchestrator.Traceroute(ctx, target)
+}
+
+// applySandbox records the outcome of a sandbox run in the stored and cached
+// copies of the report that escalated to it.
+func (s *AnalysisService) applySandbox(u analyzer.SandboxUpdate) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	
+	key := s.analysisKey(u.Target)
+	if cached := s.getFromCache(ctx, key); cached != nil && cached.ReportID == u.ReportID {
+		u.Apply(cached)
+		s.addToCache(ctx, key, cached)
+	}
+	if s.db == nil {
+		return
+	}
+	
+	report, err := s.db.GetReport(ctx, u.ReportID)
+	if err != nil {
+		s.logger.Warn("Service: Sandbox outcome for %s not stored: %v", u.ReportID, err)
+		return
+	}
+	u.Apply(report)
+	if err := s.db.ReplaceReport(ctx, report); err != nil {
+		s.logger.Warn("Service: Sandbox outcome for %s not stored: %v", u.ReportID, err)
+		return
+	}
+	if s.config.Output.SaveReports {
+		s.saveReportFiles(report)
+	}
+	s.logger.Info("Service: Sandbox outcome recorded for %s", u.ReportID)
+}
+
+// saveReportFiles writes report to output.report_path in every format listed,
+// comma-separated, in output.report_format (json when unset).
+func (s *AnalysisService) saveReportFiles(report *models.AdvancedReport) {
+	dir := s.config.Output.ReportPath
+	if dir == "" {
+		dir = "reports"
+	}
+	formats := s.config.Output.ReportFormat
+	if formats == "" {
+		formats = visualization.FormatJSON
+	}
+	
+	for _, format := range strings.Split(formats, ",") {
+		format = strings.TrimSpace(format)
+		if format == "" {
+			continue
+		}
+		path, err := s.reports.SaveReport(report, dir, format)
+		if err != nil {
+			s.logger.Warn("Service: Failed to save %s report for %s: %v", format, report.Target, err)
+			continue
+		}
+		s.logger.Debug("Report saved to %s", path)
+	}
+}
+
 // PerformBatchAnalysis analyzes multiple targets concurrently
 func (s *AnalysisService) PerformBatchAnalysis(ctx context.Context, targets []string) ([]*models.AdvancedReport, error) {
 	// Implementation from previous version
@@ -638,11 +732,10 @@ func (s *AnalysisService) PerformBatchAnalysis(ctx context.Context, targets []st
 
 // ClearCache clears the analysis cache
 func (s *AnalysisService) ClearCache() {
-	s.cacheMutex.Lock()
-	defer s.cacheMutex.Unlock()
-	
-	clearedCount := len(s.cache)
-	s.cache = make(map[string]*cacheEntry)
+	clearedCount, err := s.cache.Clear(context.Background())
+	if err != nil {
+		s.logger.Warn("Failed to clear cache: %v", err)
+	}
 	
 	s.logger.Info("Cache cleared, %d entries removed", clearedCount)
 	s.metrics.mu.Lock()
@@ -658,9 +751,9 @@ func (s *AnalysisService) HealthCheck(ctx context.Context) map[string]interface{
 		"instance_id":  s.instanceID,
 		"timestamp":    time.Now().Format(time.RFC3339),
 		"status":       "healthy",
-		"cache_size":   len(s.cache),
+		"cache_size":   s.cacheSize(),
 		"concurrent":   len(s.semaphore),
-		"current_locks": len(s.inProgress),
+		"current_locks": atomic.LoadInt64(&s.heldLocks),
 	}
 	
 	// Check database connection
@@ -716,7 +809,7 @@ func (s *AnalysisService) extractFindings(report *models.AdvancedReport) []strin
 
 func (s *AnalysisService) enrichReport(report *models.AdvancedReport, target string, startTime time.Time) {
 	if report.ReportID == "" {
-		report.ReportID = generateReportID(target)
+		report.ReportID = analyzer.NewReportID()
 	}
 	
 	if report.Target == "" {
@@ -739,7 +832,7 @@ func (s *AnalysisService) enrichReport(report *models.AdvancedReport, target str
 
 func (s *AnalysisService) createErrorReport(target string, err error) *models.AdvancedReport {
 	return &models.AdvancedReport{
-		ReportID:  generateReportID(target),
+		ReportID:  analyzer.NewReportID(),
 		Target:    target,
 		Timestamp: time.Now(),
 		RiskAssessment: &models.RiskAssessment{
@@ -756,29 +849,7 @@ func (s *AnalysisService) createErrorReport(target string, err error) *models.Ad
 	}
 }
 
-func generateReportID(target string) string {
-	timestamp := time.Now().UnixNano()
-	hash := 0
-	for _, char := range target {
-		hash = 31*hash + int(char)
-	}
-	return fmt.Sprintf("nz-%d-%x", timestamp, hash)
-}
-
 // GetInstanceID returns the service instance ID
 func (s *AnalysisService) GetInstanceID() string {
 	return s.instanceID
 }
-
-// GetActiveLocks returns currently active locks
-func (s *AnalysisService) GetActiveLocks() map[string]analysisLock {
-	s.lockMutex.RLock()
-	defer s.lockMutex.RUnlock()
-	
-	// Create a copy to avoid concurrent modification
-	locks := make(map[string]analysisLock)
-	for target, lock := range s.inProgress {
-		locks[target] = *lock
-	}
-	return locks
-}
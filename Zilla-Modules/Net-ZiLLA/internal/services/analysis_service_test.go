@@ -2,12 +2,24 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net-zilla/internal/ai"
+	"net-zilla/internal/analyzer"
 	"net-zilla/internal/config"
+	"net-zilla/internal/coordination"
 	"net-zilla/internal/models"
+	"net-zilla/internal/network"
 	"net-zilla/internal/storage"
+	"net-zilla/internal/threat_intel"
 	"net-zilla/pkg/logger"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestAnalysisService_PerformAnalysis(t *testing.T) {
@@ -54,6 +66,16 @@ func TestAnalysisService_PerformAnalysis(t *testing.T) {
 	} else if history[0].URL != target {
 		t.Errorf("Expected history URL %s, got %s", target, history[0].URL)
 	}
+
+	stored, err := svc.GetReport(ctx, report.ReportID)
+	if err != nil {
+		t.Fatalf("GetReport failed: %v", err)
+	}
+	want, _ := json.Marshal(report)
+	got, _ := json.Marshal(stored)
+	if string(got) != string(want) {
+		t.Errorf("stored report differs from the computed one:\n got %s\nwant %s", got, want)
+	}
 }
 
 func TestAnalysisService_CacheAndLocks(t *testing.T) {
@@ -63,36 +85,185 @@ func TestAnalysisService_CacheAndLocks(t *testing.T) {
 	
 	target := "http://test-cache.com"
 	
+	ctx := context.Background()
+	
 	// Test Lock
-	acquired, lockID := svc.acquireLock(target)
-	if !acquired {
-		t.Fatal("failed to acquire lock")
+	lock, err := svc.acquireLock(ctx, target)
+	if err != nil || lock == nil {
+		t.Fatalf("failed to acquire lock: %v", err)
 	}
 	
-	if !svc.isAnalysisInProgress(target) {
+	if held, _ := svc.locks.Held(ctx, target); !held {
 		t.Error("analysis should be in progress")
 	}
 	
-	svc.releaseLock(target, lockID)
-	if svc.isAnalysisInProgress(target) {
+	svc.releaseLock(lock)
+	if held, _ := svc.locks.Held(ctx, target); held {
 		t.Error("analysis should NOT be in progress after release")
 	}
 	
 	// Test Cache
 	report := &models.AdvancedReport{Target: target}
-	svc.addToCache(target, report)
+	svc.addToCache(ctx, target, report)
 	
-	cached := svc.getFromCache(target)
+	cached := svc.getFromCache(ctx, target)
 	if cached == nil || cached.Target != target {
 		t.Error("cache retrieval failed")
 	}
 	
 	svc.ClearCache()
-	if svc.getFromCache(target) != nil {
+	if svc.getFromCache(ctx, target) != nil {
 		t.Error("cache should be empty after clear")
 	}
 }
 
+func TestAnalysisService_SharedProviders(t *testing.T) {
+	l := logger.NewLogger()
+	locks := coordination.NewMemoryLocks()
+	cache := coordination.NewMemoryCache(0)
+	
+	replicas := make([]*AnalysisService, 2)
+	for i := range replicas {
+		cfg := &config.Config{Service: &config.ServiceConfig{WaitForDuplicateAnalysis: i == 1}}
+		replicas[i] = NewAnalysisService(l, nil, cfg)
+		replicas[i].SetLockProvider(locks)
+		replicas[i].SetCacheProvider(cache)
+	}
+	first, second := replicas[0], replicas[1]
+	
+	ctx := context.Background()
+	target := "http://shared.example"
+	key := first.analysisKey(target)
+	
+	// The first replica is mid-analysis; the second must not start its own.
+	lock, err := first.acquireLock(ctx, key)
+	if err != nil || lock == nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+	if other, _ := second.acquireLock(ctx, key); other != nil {
+		t.Fatal("second replica acquired a lock the first one holds")
+	}
+	if _, err := first.PerformAnalysis(ctx, target); err == nil {
+		t.Error("expected duplicate analysis to be refused without waiting")
+	}
+	
+	// The waiting replica is woken by the release and returns the shared result.
+	result := make(chan *models.AdvancedReport, 1)
+	go func() {
+		report, err := second.PerformAnalysis(ctx, target)
+		if err != nil {
+			t.Errorf("waiting replica: %v", err)
+		}
+		result <- report
+	}()
+	time.Sleep(50 * time.Millisecond)
+	first.addToCache(ctx, key, &models.AdvancedReport{ReportID: "nz-shared", Target: target})
+	first.releaseLock(lock)
+	
+	select {
+	case report := <-result:
+		if report == nil || report.ReportID != "nz-shared" {
+			t.Errorf("waiting replica got %+v, want the first replica's report", report)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting replica was not woken by the release")
+	}
+}
+
+func TestAnalysisService_FencesStaleCacheWrites(t *testing.T) {
+	locks := coordination.NewMemoryLocks()
+	svc := NewAnalysisService(logger.NewLogger(), nil, &config.Config{})
+	svc.SetLockProvider(locks)
+	ctx := context.Background()
+	target := "http://example.com"
+	key := svc.analysisKey(target)
+
+	// Another replica's lock expires while it is paused mid-analysis
+	stale, err := locks.TryAcquire(ctx, key, "paused-replica", time.Millisecond)
+	if err != nil || stale == nil {
+		t.Fatalf("TryAcquire: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	report, err := svc.PerformAnalysis(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := report.Metadata["lock_token"].(int64); token <= stale.Token {
+		t.Fatalf("lock_token = %v, want more than the expired lock's %d", report.Metadata["lock_token"], stale.Token)
+	}
+
+	svc.addToCacheFenced(ctx, key, &models.AdvancedReport{ReportID: "NZ-stale", Target: target}, stale.Token)
+	if cached := svc.getFromCache(ctx, key); cached == nil || cached.ReportID != report.ReportID {
+		t.Errorf("cached report = %+v, want %s kept over the stale write", cached, report.ReportID)
+	}
+}
+
+func TestAnalysisService_CoalescesDuplicateCalls(t *testing.T) {
+	l := logger.NewLogger()
+	locks := coordination.NewMemoryLocks()
+	cfg := &config.Config{Service: &config.ServiceConfig{WaitForDuplicateAnalysis: true}}
+	svc := NewAnalysisService(l, nil, cfg)
+	svc.SetLockProvider(locks)
+	
+	// Another replica holds the target, so the coalesced analysis blocks
+	// until that replica publishes its result.
+	ctx := context.Background()
+	key := svc.analysisKey("http://example.com")
+	held, err := locks.TryAcquire(ctx, key, "other-replica", time.Minute)
+	if err != nil || held == nil {
+		t.Fatalf("failed to take lock: %v", err)
+	}
+	
+	spellings := []string{"http://example.com", "HTTP://Example.com/", "http://EXAMPLE.COM:80"}
+	results := make(chan *models.AdvancedReport, len(spellings))
+	for _, target := range spellings {
+		go func(target string) {
+			report, err := svc.PerformAnalysis(ctx, target)
+			if err != nil {
+				t.Errorf("PerformAnalysis(%s): %v", target, err)
+			}
+			results <- report
+		}(target)
+	}
+	
+	// A caller that gives up early gets its own error without failing the rest.
+	impatient, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := svc.PerformAnalysis(impatient, "http://example.com/"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("impatient caller got %v, want deadline exceeded", err)
+	}
+	
+	svc.addToCache(ctx, key, &models.AdvancedReport{ReportID: "nz-coalesced", Target: "http://example.com"})
+	locks.Release(ctx, held)
+	
+	var first *models.AdvancedReport
+	for range spellings {
+		select {
+		case report := <-results:
+			if report == nil || report.ReportID != "nz-coalesced" {
+				t.Fatalf("got %+v, want the shared report", report)
+			}
+			if first == nil {
+				first = report
+			} else if report != first {
+				t.Error("coalesced callers should share one report")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("coalesced callers were not answered")
+		}
+	}
+	
+	metrics := svc.GetServiceMetrics()
+	if got := metrics["coalesced"]; got != int64(len(spellings)) {
+		t.Errorf("coalesced = %v, want %d", got, len(spellings))
+	}
+	if got := metrics["duplicate_prevented"]; got != int64(1) {
+		t.Errorf("duplicate_prevented = %v, want one analysis to have waited", got)
+	}
+}
+
 func TestAnalysisService_HealthCheck(t *testing.T) {
 	l := logger.NewLogger()
 	svc := NewAnalysisService(l, nil, &config.Config{})
@@ -127,9 +298,217 @@ func TestAnalysisService_GetAnalysisByID(t *testing.T) {
 	}
 }
 
+func TestAnalysisService_RecordsCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.cassette")
+	cfg := &config.Config{Network: config.NetworkConfig{CassetteMode: "record", CassettePath: path}}
+	svc := NewAnalysisService(logger.NewLogger(), nil, cfg)
+
+	if _, err := svc.PerformAnalysis(context.Background(), "http://example.com"); err != nil {
+		t.Fatalf("PerformAnalysis failed: %v", err)
+	}
+	svc.Close()
+
+	// The recording is written on Close and replays the lookups of the run
+	c, err := network.OpenCassette(path, network.CassetteReplay)
+	if err != nil {
+		t.Fatalf("expected a cassette written on Close: %v", err)
+	}
+	if len(c.Interactions()) == 0 {
+		t.Error("expected the analysis lookups to be recorded")
+	}
+}
+
 func TestAnalysisService_InstanceID(t *testing.T) {
 	svc := NewAnalysisService(logger.NewLogger(), nil, &config.Config{})
 	if svc.GetInstanceID() == "" {
 		t.Error("expected non-empty instance ID")
 	}
 }
+
+func TestAnalysisService_SavesAndRendersReports(t *testing.T) {
+	dir := t.TempDir()
+	db, err := storage.NewDatabase(filepath.Join(dir, "analyses.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cfg := &config.Config{Output: config.OutputConfig{SaveReports: true, ReportFormat: "html, pdf", ReportPath: filepath.Join(dir, "reports")}}
+	svc := NewAnalysisService(logger.NewLogger(), db, cfg)
+
+	report, err := svc.PerformAnalysis(context.Background(), "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{"html", "pdf"} {
+		if _, err := os.Stat(filepath.Join(dir, "reports", report.ReportID+"."+ext)); err != nil {
+			t.Errorf("%s report not saved: %v", ext, err)
+		}
+	}
+
+	html, err := svc.RenderReport(context.Background(), report.ReportID, "html")
+	if err != nil || !strings.Contains(string(html), report.ReportID) {
+		t.Errorf("RenderReport(html) = %d bytes, %v", len(html), err)
+	}
+	if _, err := svc.RenderReport(context.Background(), "NZ-missing", "html"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("RenderReport of an unknown ID = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAnalysisService_ExplainsReports(t *testing.T) {
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"EXPLANATION: A plain example page.\nACTIONS:\n- None"}}]}`))
+	}))
+	defer llm.Close()
+
+	cfg := &config.Config{AI: config.AIConfig{LLMEndpoint: llm.URL, LLMModel: "llama3"}}
+	svc := NewAnalysisService(logger.NewLogger(), nil, cfg)
+	report, err := svc.PerformAnalysis(context.Background(), "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RiskAssessment.Summary != "A plain example page." || report.Metadata["explanation_source"] != "openai-compatible:llama3" {
+		t.Errorf("summary %q from %v, want the LLM's explanation", report.RiskAssessment.Summary, report.Metadata["explanation_source"])
+	}
+}
+
+func TestAnalysisService_ExplanationWithinAnalysisTimeout(t *testing.T) {
+	// The LLM server never answers within the default ai.llm_timeout
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer llm.Close()
+
+	cfg := &config.Config{
+		AI:       config.AIConfig{LLMEndpoint: llm.URL, LLMModel: "llama3"},
+		Analysis: &config.AnalysisConfig{TimeoutSeconds: 2},
+	}
+	svc := NewAnalysisService(logger.NewLogger(), nil, cfg)
+	start := time.Now()
+	report, err := svc.PerformAnalysis(context.Background(), "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("analysis with a stalled LLM took %v, want it bounded by the 2s analysis timeout", elapsed)
+	}
+	if report.Metadata["explanation_source"] != ai.ExplanationSourceFallback || report.Metadata["explanation_error"] == nil {
+		t.Errorf("expected the fallback explanation with an error, got %v (%v)", report.Metadata["explanation_source"], report.Metadata["explanation_error"])
+	}
+}
+
+func TestAnalysisService_RecordsSandboxOutcome(t *testing.T) {
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "analyses.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := NewAnalysisService(logger.NewLogger(), db, &config.Config{})
+	ctx := context.Background()
+
+	report := &models.AdvancedReport{
+		ReportID:       "NZ-sandbox",
+		Target:         "http://phish.example/",
+		Timestamp:      time.Now(),
+		RiskAssessment: &models.RiskAssessment{OverallRiskLevel: "HIGH", RiskScore: 0.8},
+		Metadata:       map[string]interface{}{"sandbox_escalated": "true", "sandbox_status": "pending"},
+	}
+	if err := db.SaveReport(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+	key := svc.analysisKey(report.Target)
+	svc.addToCache(ctx, key, report)
+
+	svc.applySandbox(analyzer.SandboxUpdate{
+		ReportID: report.ReportID,
+		Target:   report.Target,
+		Run:      &threat_intel.SandboxRun{ContainerID: "abc", ArtifactDir: "data/sandbox/abc", TimedOut: true},
+		Result:   &models.SandboxResult{Target: report.Target, FinalURL: "http://phish.example/login"},
+		Findings: []string{"Sandbox download invoice.exe rated HIGH by malware analysis"},
+	})
+
+	stored, err := db.GetReport(ctx, report.ReportID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := svc.getFromCache(ctx, key)
+	for name, r := range map[string]*models.AdvancedReport{"stored": stored, "cached": cached} {
+		if r == nil || r.Sandbox == nil || r.Sandbox.FinalURL != "http://phish.example/login" {
+			t.Fatalf("%s report has no sandbox section: %+v", name, r)
+		}
+		if r.Metadata["sandbox_status"] != "done" || r.Metadata["sandbox_timed_out"] != "true" || r.Metadata["sandbox_container_id"] != "abc" {
+			t.Errorf("%s sandbox metadata = %v", name, r.Metadata)
+		}
+		if len(r.Findings) != 1 {
+			t.Errorf("%s findings = %v", name, r.Findings)
+		}
+	}
+
+	svc.applySandbox(analyzer.SandboxUpdate{ReportID: report.ReportID, Target: report.Target, Err: errors.New("docker unavailable")})
+	if stored, _ := db.GetReport(ctx, report.ReportID); stored.Metadata["sandbox_status"] != "failed" || stored.Metadata["sandbox_error"] != "docker unavailable" {
+		t.Errorf("failed run metadata = %v", stored.Metadata)
+	}
+}
+
+func TestAnalysisService_RecordsInfrastructureGraph(t *testing.T) {
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "analyses.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := NewAnalysisService(logger.NewLogger(), db, &config.Config{})
+	ctx := context.Background()
+
+	if _, err := svc.PerformAnalysis(ctx, "http://example.com/login"); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := svc.GraphNeighbors(ctx, "example.com", 1)
+	if err != nil {
+		t.Fatalf("GraphNeighbors: %v", err)
+	}
+	if _, ok := sub.Node("URL:http://example.com/login"); !ok {
+		t.Errorf("target URL missing from the neighbors of its host: %+v", sub.Nodes)
+	}
+	if _, err := svc.GraphNeighbors(ctx, "never-seen.example", 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GraphNeighbors of an unknown node = %v, want ErrNotFound", err)
+	}
+	if _, err := svc.GraphPath(ctx, "example.com", "never-seen.example"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GraphPath to an unknown node = %v, want ErrNotFound", err)
+	}
+
+	if _, err := NewAnalysisService(logger.NewLogger(), nil, &config.Config{}).GraphClusters(ctx, 2); err == nil {
+		t.Error("expected an error querying the graph without a database")
+	}
+}
+
+func TestAnalysisService_RecordsCampaignFeatures(t *testing.T) {
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "analyses.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := NewAnalysisService(logger.NewLogger(), db, &config.Config{})
+	ctx := context.Background()
+
+	report, err := svc.PerformAnalysis(ctx, "http://example.com/track/4411/confirm.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+	features, err := db.ListCampaignFeatures(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 1 || features[0].AnalysisID != report.ReportID {
+		t.Errorf("campaign features = %+v", features)
+	}
+	if campaigns, err := svc.Campaigns(ctx); err != nil || len(campaigns) != 0 {
+		t.Errorf("Campaigns = %+v, %v; a single analysis is not a campaign", campaigns, err)
+	}
+	if _, err := svc.GetCampaign(ctx, "CMP-missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetCampaign of an unknown ID = %v, want ErrNotFound", err)
+	}
+
+	if _, err := NewAnalysisService(logger.NewLogger(), nil, &config.Config{}).Campaigns(ctx); err == nil {
+		t.Error("expected an error listing campaigns without a database")
+	}
+}
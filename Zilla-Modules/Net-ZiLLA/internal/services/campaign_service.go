@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"net-zilla/internal/correlation"
+	"net-zilla/internal/models"
+	"net-zilla/internal/storage"
+)
+
+// recordCampaign stores the clustering features of report.
+func (s *AnalysisService) recordCampaign(ctx context.Context, report *models.AdvancedReport) {
+	if err := s.campaigns.Record(ctx, report); err != nil {
+		s.logger.Warn("Service: Failed to record campaign features for %s: %v", report.Target, err)
+	}
+}
+
+// Campaigns groups every stored analysis into campaigns, most recently
+// active first.
+func (s *AnalysisService) Campaigns(ctx context.Context) ([]correlation.Campaign, error) {
+	if s.campaigns == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	return s.campaigns.Campaigns(ctx)
+}
+
+// GetCampaign returns the campaign with the given ID, or storage.ErrNotFound.
+func (s *AnalysisService) GetCampaign(ctx context.Context, id string) (*correlation.Campaign, error) {
+	campaigns, err := s.Campaigns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range campaigns {
+		if campaigns[i].ID == id {
+			return &campaigns[i], nil
+		}
+	}
+	return nil, fmt.Errorf("campaign %s: %w", id, storage.ErrNotFound)
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+// AnalyzeFile statically analyzes a submitted file or attachment: containers are
+// unpacked, macros and links extracted, and every member checked against the
+// script heuristics, known hashes and YARA rules. Nothing in the file is run.
+func (s *AnalysisService) AnalyzeFile(ctx context.Context, name string, data []byte) (*models.FileAnalysis, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("file cannot be empty")
+	}
+	startTime := time.Now()
+	s.logger.Info("Service: Analyzing file %s (%d bytes)", name, len(data))
+
+	result, err := s.fileAnalyzer.Analyze(ctx, name, data)
+	if err != nil {
+		return nil, fmt.Errorf("file analysis failed: %w", err)
+	}
+
+	s.logger.Info("Service: File analysis completed [%s] risk=%s in %v",
+		result.ReportID, result.RiskLevel, time.Since(startTime))
+	return result, nil
+}
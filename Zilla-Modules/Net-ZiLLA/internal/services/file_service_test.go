@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"net-zilla/internal/config"
+	"net-zilla/pkg/logger"
+)
+
+func TestAnalyzeFile(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "custom.yar")
+	rule := `rule Custom_Marker { meta: severity = "low" strings: $m = "NZ-MARKER" condition: $m }`
+	if err := os.WriteFile(rules, []byte(rule), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Analysis: &config.AnalysisConfig{YaraRules: rules}}
+	svc := NewAnalysisService(logger.NewLogger(), nil, cfg)
+
+	result, err := svc.AnalyzeFile(context.Background(), "note.txt", []byte("NZ-MARKER inside"))
+	if err != nil {
+		t.Fatalf("AnalyzeFile: %v", err)
+	}
+	if len(result.Members) != 1 || len(result.Members[0].YaraMatches) != 1 || result.Members[0].YaraMatches[0].Rule != "Custom_Marker" {
+		t.Errorf("configured rules not applied: %+v", result.Members)
+	}
+	if result.RiskLevel != "LOW" || result.RiskScore != 10 {
+		t.Errorf("risk = %s (%d)", result.RiskLevel, result.RiskScore)
+	}
+
+	if _, err := svc.AnalyzeFile(context.Background(), "empty", nil); err == nil {
+		t.Error("expected an error for an empty file")
+	}
+}
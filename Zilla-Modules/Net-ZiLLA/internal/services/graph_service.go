@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"net-zilla/internal/correlation"
+	"net-zilla/internal/models"
+	"net-zilla/internal/storage"
+)
+
+// clusterHubTypes are left out when clustering: a registrar or AS shared by
+// thousands of unrelated sites says nothing about common ownership.
+var clusterHubTypes = []string{correlation.NodeRegistrar, correlation.NodeASN}
+
+// recordGraph adds the infrastructure report observed to the shared graph.
+func (s *AnalysisService) recordGraph(ctx context.Context, report *models.AdvancedReport) {
+	if err := s.graph.Record(ctx, report); err != nil {
+		s.logger.Warn("Service: Failed to record infrastructure graph for %s: %v", report.Target, err)
+	}
+}
+
+// InfrastructureGraph returns the graph of every stored analysis.
+func (s *AnalysisService) InfrastructureGraph(ctx context.Context) (*correlation.RelationshipGraph, error) {
+	if s.graph == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	return s.graph.Load(ctx)
+}
+
+// GraphNeighbors returns the infrastructure within depth hops of a node,
+// given by ID ("IP:203.0.113.7") or value. It returns storage.ErrNotFound
+// when no analysis observed the node.
+func (s *AnalysisService) GraphNeighbors(ctx context.Context, ref string, depth int) (*correlation.RelationshipGraph, error) {
+	g, err := s.InfrastructureGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	node, ok := g.Lookup(ref)
+	if !ok {
+		return nil, fmt.Errorf("node %q: %w", ref, storage.ErrNotFound)
+	}
+	sub, _ := g.Neighbors(node.ID, depth)
+	return sub, nil
+}
+
+// GraphPath returns the shortest chain of infrastructure linking two nodes.
+// It returns storage.ErrNotFound when either node is unknown or nothing
+// links them.
+func (s *AnalysisService) GraphPath(ctx context.Context, from, to string) (*correlation.RelationshipGraph, error) {
+	g, err := s.InfrastructureGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start, ok := g.Lookup(from)
+	if !ok {
+		return nil, fmt.Errorf("node %q: %w", from, storage.ErrNotFound)
+	}
+	end, ok := g.Lookup(to)
+	if !ok {
+		return nil, fmt.Errorf("node %q: %w", to, storage.ErrNotFound)
+	}
+	path, ok := g.ShortestPath(start.ID, end.ID)
+	if !ok {
+		return nil, fmt.Errorf("no path from %s to %s: %w", start.ID, end.ID, storage.ErrNotFound)
+	}
+	return path, nil
+}
+
+// GraphClusters returns groups of infrastructure shared by at least
+// minAnalyses analyses, ignoring registrars and ASNs.
+func (s *AnalysisService) GraphClusters(ctx context.Context, minAnalyses int) ([]correlation.Cluster, error) {
+	g, err := s.InfrastructureGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return g.Without(clusterHubTypes...).Clusters(minAnalyses), nil
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"net-zilla/internal/analyzer"
+	"net-zilla/internal/message"
+	"net-zilla/internal/models"
+	"net-zilla/internal/network"
+)
+
+// maxMessageURLAnalyses bounds how many of a message's URLs go through the full
+// pipeline; the rest are listed without a report.
+const maxMessageURLAnalyses = 20
+
+// AnalyzeMessage runs every URL of a parsed SMS or email through PerformAnalysis
+// and folds the results together with the text, sender and authentication
+// signals into one verdict. URLs are analyzed one at a time so a long message
+// cannot take every concurrent analysis slot, and together they get
+// messageURLBudget; URLs not reached by then are listed without a report.
+func (s *AnalysisService) AnalyzeMessage(ctx context.Context, msg *message.Message) (*models.MessageAnalysis, error) {
+	if msg == nil {
+		return nil, fmt.Errorf("message cannot be nil")
+	}
+	startTime := time.Now()
+	s.logger.Info("Service: Analyzing %s message with %d URLs", msg.Kind, len(msg.URLs))
+
+	result := &models.MessageAnalysis{
+		ReportID:       analyzer.NewReportID(),
+		Timestamp:      time.Now(),
+		Kind:           msg.Kind,
+		Sender:         msg.Sender,
+		Subject:        msg.Subject,
+		PhoneNumbers:   msg.PhoneNumbers,
+		Attachments:    msg.Attachments,
+		Authentication: msg.Authentication,
+		URLs:           make([]*models.MessageURL, 0, len(msg.URLs)),
+	}
+
+	urlCtx, cancel := context.WithTimeout(ctx, s.messageURLBudget())
+	defer cancel()
+	for i, u := range msg.URLs {
+		entry := *u
+		result.URLs = append(result.URLs, &entry)
+		if i >= maxMessageURLAnalyses {
+			entry.Error = "not analyzed: too many URLs in message"
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			entry.Error = fmt.Sprintf("not analyzed: %v", err)
+			continue
+		}
+		if urlCtx.Err() != nil {
+			entry.Error = "not analyzed: time for the message's URLs ran out"
+			continue
+		}
+
+		report, err := s.PerformAnalysis(urlCtx, entry.URL)
+		switch {
+		case err != nil:
+			s.logger.Warn("Service: Message URL %s not analyzed: %v", entry.URL, err)
+			entry.Error = err.Error()
+		case report.RiskAssessment == nil || report.RiskAssessment.OverallRiskLevel == "ERROR":
+			entry.Error = "analysis failed"
+			if len(report.Findings) > 0 {
+				entry.Error = report.Findings[0]
+			}
+		default:
+			entry.Report = report
+		}
+	}
+
+	if msg.Kind == message.KindEmail && len(msg.Raw) > 0 {
+		s.verifyEmail(ctx, msg, result)
+	}
+
+	text := strings.TrimSpace(msg.Subject + "\n" + msg.Text)
+	if text != "" {
+		analysis, err := s.messageAgent.AnalyzeSMS(text)
+		if err != nil {
+			s.logger.Warn("Service: Message text analysis failed: %v", err)
+		} else {
+			result.TextAnalysis = analysis
+		}
+	}
+
+	assessMessage(result)
+	s.logger.Info("Service: Message analysis completed [%s] verdict=%s in %v",
+		result.ReportID, result.Verdict, time.Since(startTime))
+	return result, nil
+}
+
+// messageURLBudget is how long AnalyzeMessage spends on a message's URLs in
+// total. It leaves a quarter of the API request timeout for the checks that
+// follow, so the verdict is written before the server gives up on the request.
+func (s *AnalysisService) messageURLBudget() time.Duration {
+	timeout := s.config.Security.RequestTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return timeout * 3 / 4
+}
+
+// verifyEmail checks the email's SPF, DKIM and DMARC against DNS and looks up
+// what the From domain publishes. Without Authentication-Results from a
+// receiving server, the verified results stand in for them.
+func (s *AnalysisService) verifyEmail(ctx context.Context, msg *message.Message, result *models.MessageAnalysis) {
+	domain := ""
+	if msg.Sender != nil {
+		domain = msg.Sender.Domain
+	}
+	if domain == "" || network.IsReservedDomain(domain) {
+		return
+	}
+
+	if v, err := s.emailAuth.VerifyEmail(ctx, msg.Raw); err != nil {
+		s.logger.Warn("Service: Email verification failed: %v", err)
+	} else {
+		auth := models.EmailAuthentication{Source: "none", FromDomain: domain}
+		if msg.Authentication != nil {
+			auth = *msg.Authentication
+		}
+		auth.Verification = v
+		if auth.Source == "none" {
+			auth.Source = "verified"
+			auth.SPF, auth.SPFDomain, auth.SPFAligned = v.SPF, v.SPFDomain, v.SPFAligned
+			auth.DKIM, auth.DKIMDomain, auth.DKIMAligned = bestDKIM(v, domain)
+			auth.DMARC = v.DMARC
+		}
+		result.Authentication = &auth
+	}
+
+	result.SenderPolicy = s.emailAuth.Analyze(ctx, network.OrganizationalDomain(domain))
+}
+
+// bestDKIM summarizes the verified signatures the way a receiver would report
+// them: an aligned pass, then any pass, then the first result.
+func bestDKIM(v *models.EmailVerification, fromDomain string) (string, string, bool) {
+	if len(v.DKIM) == 0 {
+		return "none", "", false
+	}
+	best := v.DKIM[0]
+	for _, d := range v.DKIM {
+		if d.Result != "pass" {
+			continue
+		}
+		if sameOrganization(d.Domain, fromDomain) {
+			return d.Result, d.Domain, v.DKIMAligned
+		}
+		if best.Result != "pass" {
+			best = d
+		}
+	}
+	return best.Result, best.Domain, false
+}
+
+// assessMessage scores a message. The riskiest URL sets the baseline and the
+// message-level signals add to it, since a lure with a clean-looking link is
+// still a lure.
+func assessMessage(r *models.MessageAnalysis) {
+	var findings []string
+	var metrics []models.RiskMetric
+
+	urlScore, analyzed, critical := 0.0, 0, 0
+	for _, u := range r.URLs {
+		if u.Report == nil {
+			continue
+		}
+		analyzed++
+		ra := u.Report.RiskAssessment
+		urlScore = math.Max(urlScore, ra.RiskScore)
+		if ra.OverallRiskLevel == "HIGH" || ra.OverallRiskLevel == "CRITICAL" {
+			critical++
+			findings = append(findings, fmt.Sprintf("%s link %s (%s)", ra.OverallRiskLevel, u.URL, u.Source))
+		}
+	}
+	metrics = append(metrics, models.RiskMetric{Vector: "links", Value: int(math.Round(urlScore * 10)), Impact: fmt.Sprintf("%d of %d URLs analyzed", analyzed, len(r.URLs))})
+
+	extra := 0.0
+	add := func(vector string, score float64, finding string) {
+		extra += score
+		findings = append(findings, finding)
+		metrics = append(metrics, models.RiskMetric{Vector: vector, Value: int(math.Round(score * 10)), Impact: finding})
+	}
+
+	if t := r.TextAnalysis; t != nil && !t.IsSafe {
+		score := 0.2
+		if t.RiskLevel == "HIGH" {
+			score = 0.35
+		}
+		add("text", score, fmt.Sprintf("Message text: %s", strings.Join(t.Threats, ", ")))
+		if len(r.PhoneNumbers) > 0 && len(r.URLs) == 0 {
+			add("callback", 0.1, fmt.Sprintf("Asks the recipient to call %s", strings.Join(r.PhoneNumbers, ", ")))
+		}
+	}
+
+	for _, u := range r.URLs {
+		if strings.HasPrefix(u.Source, "qr:") {
+			add("qr_code", 0.1, fmt.Sprintf("Link hidden in QR code: %s", u.URL))
+			break
+		}
+	}
+
+	if a := r.Authentication; a != nil && a.Source != "none" {
+		if a.DMARC == "fail" {
+			add("dmarc", 0.3, fmt.Sprintf("DMARC fail: nothing authenticates %s as the sender", a.FromDomain))
+		}
+		if a.SPF == "fail" || a.SPF == "softfail" {
+			add("spf", 0.1, fmt.Sprintf("SPF %s for %s", a.SPF, a.SPFDomain))
+		}
+		if a.DKIM == "fail" {
+			add("dkim", 0.1, "DKIM signature does not verify")
+		}
+	}
+
+	// Weak policies do not make a message malicious, but they are why a spoofed
+	// From can reach the inbox.
+	if p := r.SenderPolicy; p != nil && p.RiskScore >= 15 {
+		add("sender_policy", float64(p.RiskScore)/500, fmt.Sprintf("Sender domain %s is easy to spoof: %s", p.Domain, strings.Join(p.Findings, "; ")))
+	}
+
+	if sender := r.Sender; sender != nil && sender.Domain != "" {
+		if sender.ReplyTo != "" && !sameOrganization(sender.ReplyTo, sender.Address) {
+			add("reply_to", 0.15, fmt.Sprintf("Replies go to %s, not the sender's domain", sender.ReplyTo))
+		}
+		// "PayPal.com Support" or "service@paypal.com" as the name of an
+		// unrelated address is classic display-name spoofing.
+		spoofed := strings.Contains(sender.DisplayName, "@") && !sameOrganization(sender.DisplayName, sender.Address)
+		for _, u := range message.ExtractURLs(sender.DisplayName) {
+			spoofed = spoofed || !sameOrganization(u.URL, sender.Address)
+		}
+		if spoofed {
+			add("display_name", 0.2, fmt.Sprintf("Display name %q names a different domain than %s", sender.DisplayName, sender.Address))
+		}
+	}
+
+	score := math.Min(1, urlScore+extra)
+	level := messageRiskLevel(score)
+	r.RiskAssessment = &models.RiskAssessment{
+		OverallRiskLevel: level,
+		RiskScore:        score,
+		Metrics:          metrics,
+		CriticalFindings: critical,
+		Summary:          fmt.Sprintf("%s message: %d URLs (%d analyzed), %d phone numbers", r.Kind, len(r.URLs), analyzed, len(r.PhoneNumbers)),
+	}
+	switch level {
+	case "CRITICAL", "HIGH":
+		r.Verdict = "malicious"
+	case "MEDIUM":
+		r.Verdict = "suspicious"
+	default:
+		r.Verdict = "clean"
+	}
+	if findings == nil {
+		findings = []string{}
+	}
+	r.Findings = findings
+}
+
+// messageRiskLevel uses the orchestrator's thresholds so message and URL levels compare.
+func messageRiskLevel(score float64) string {
+	s := score * 100
+	switch {
+	case s >= 80:
+		return "CRITICAL"
+	case s >= 50:
+		return "HIGH"
+	case s >= 20:
+		return "MEDIUM"
+	default:
+		return "LOW"
+	}
+}
+
+// sameOrganization reports whether two addresses, URLs or domains share a
+// registrable domain.
+func sameOrganization(a, b string) bool {
+	return message.OrganizationalDomain(a) == message.OrganizationalDomain(b)
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"net-zilla/internal/config"
+	"net-zilla/internal/message"
+	"net-zilla/internal/models"
+	"net-zilla/internal/shared_models"
+	"net-zilla/pkg/logger"
+)
+
+func TestAnalysisService_AnalyzeMessage(t *testing.T) {
+	svc := NewAnalysisService(logger.NewLogger(), nil, &config.Config{})
+
+	msg, err := message.ParseSMS("URGENT: your account is locked. Verify at http://192.0.2.10/login or call +1 555 010 4477", "BANK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := svc.AnalyzeMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.URLs) != 1 || result.URLs[0].Report == nil || result.URLs[0].Error != "" {
+		t.Fatalf("expected the URL to be analyzed, got %+v", result.URLs)
+	}
+	if result.TextAnalysis == nil || result.TextAnalysis.IsSafe {
+		t.Errorf("expected the lure text to be flagged, got %+v", result.TextAnalysis)
+	}
+	if result.Verdict != "malicious" || result.RiskAssessment.RiskScore < result.URLs[0].Report.RiskAssessment.RiskScore {
+		t.Errorf("expected a malicious verdict at least as risky as the link, got %s (%+v)", result.Verdict, result.RiskAssessment)
+	}
+	if len(result.PhoneNumbers) != 1 || result.Sender.Address != "BANK" {
+		t.Errorf("unexpected message details: %+v %+v", result.PhoneNumbers, result.Sender)
+	}
+
+	if _, err := svc.AnalyzeMessage(context.Background(), nil); err == nil {
+		t.Error("expected an error for a nil message")
+	}
+}
+
+func TestAnalysisService_AnalyzeMessage_URLBudget(t *testing.T) {
+	// Every link points at a server that never finishes answering
+	release := make(chan struct{})
+	defer close(release)
+	var links []string
+	for i := 0; i < 4; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer srv.Close()
+		links = append(links, fmt.Sprintf("%s/login%d", srv.URL, i))
+	}
+
+	cfg := &config.Config{Security: config.SecurityConfig{RequestTimeout: 2 * time.Second}}
+	svc := NewAnalysisService(logger.NewLogger(), nil, cfg)
+	msg, err := message.ParseSMS("Verify your account: "+strings.Join(links, " "), "BANK")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	result, err := svc.AnalyzeMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > cfg.Security.RequestTimeout {
+		t.Errorf("message analysis took %v, past the %v request timeout", elapsed, cfg.Security.RequestTimeout)
+	}
+	if len(result.URLs) != len(links) {
+		t.Fatalf("expected %d URLs, got %d", len(links), len(result.URLs))
+	}
+	if last := result.URLs[len(links)-1]; last.Report != nil || !strings.Contains(last.Error, "ran out") {
+		t.Errorf("expected the last URL to be skipped once the budget ran out, got %+v", last)
+	}
+	if result.RiskAssessment == nil {
+		t.Error("expected a verdict for the message")
+	}
+}
+
+func TestAssessMessage(t *testing.T) {
+	report := func(score float64, level string) *models.AdvancedReport {
+		return &models.AdvancedReport{RiskAssessment: &models.RiskAssessment{RiskScore: score, OverallRiskLevel: level}}
+	}
+
+	tests := []struct {
+		name        string
+		msg         *models.MessageAnalysis
+		wantVerdict string
+		wantFinding string
+	}{
+		{
+			name:        "clean newsletter",
+			msg:         &models.MessageAnalysis{Kind: "email", URLs: []*models.MessageURL{{URL: "https://shop.example", Report: report(0.05, "LOW")}}},
+			wantVerdict: "clean",
+		},
+		{
+			name:        "malicious link",
+			msg:         &models.MessageAnalysis{Kind: "sms", URLs: []*models.MessageURL{{URL: "http://x.tk", Source: "text", Report: report(0.75, "HIGH")}}},
+			wantVerdict: "malicious",
+			wantFinding: "HIGH link http://x.tk",
+		},
+		{
+			name: "spoofed sender without links",
+			msg: &models.MessageAnalysis{
+				Kind:           "email",
+				Sender:         &models.MessageSender{Address: "ceo@lookalike.example", DisplayName: "ceo@corp.example", Domain: "lookalike.example", ReplyTo: "ceo.private@freemail.example"},
+				Authentication: &models.EmailAuthentication{Source: "Authentication-Results", FromDomain: "lookalike.example", SPF: "softfail", DKIM: "none", DMARC: "fail"},
+			},
+			wantVerdict: "malicious",
+			wantFinding: "DMARC fail",
+		},
+		{
+			name: "callback scam",
+			msg: &models.MessageAnalysis{
+				Kind:         "sms",
+				PhoneNumbers: []string{"+15550104477"},
+				TextAnalysis: &shared_models.AIAnalysisResult{IsSafe: false, RiskLevel: "MEDIUM", Threats: []string{"Financial lure"}},
+			},
+			wantVerdict: "suspicious",
+			wantFinding: "Asks the recipient to call +15550104477",
+		},
+		{
+			name:        "quishing",
+			msg:         &models.MessageAnalysis{Kind: "email", URLs: []*models.MessageURL{{URL: "https://mfa.example", Source: "qr:scan.png", Report: report(0.1, "LOW")}}},
+			wantVerdict: "suspicious",
+			wantFinding: "Link hidden in QR code",
+		},
+		{
+			name: "spoofable sender domain",
+			msg: &models.MessageAnalysis{
+				Kind:         "email",
+				URLs:         []*models.MessageURL{{URL: "https://weak.example/offer", Source: "html", Report: report(0.15, "LOW")}},
+				SenderPolicy: &models.EmailSecurity{Domain: "weak.example", RiskScore: 30, Findings: []string{"No SPF record", "No DMARC record"}},
+			},
+			wantVerdict: "suspicious",
+			wantFinding: "Sender domain weak.example is easy to spoof: No SPF record; No DMARC record",
+		},
+		{
+			name:        "failed analyses do not score",
+			msg:         &models.MessageAnalysis{Kind: "sms", URLs: []*models.MessageURL{{URL: "https://a.example", Error: "timeout"}}},
+			wantVerdict: "clean",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assessMessage(tt.msg)
+			if tt.msg.Verdict != tt.wantVerdict {
+				t.Errorf("verdict = %s (score %.2f, findings %v), want %s", tt.msg.Verdict, tt.msg.RiskAssessment.RiskScore, tt.msg.Findings, tt.wantVerdict)
+			}
+			if tt.wantFinding != "" && !strings.Contains(strings.Join(tt.msg.Findings, "\n"), tt.wantFinding) {
+				t.Errorf("findings %v missing %q", tt.msg.Findings, tt.wantFinding)
+			}
+		})
+	}
+}
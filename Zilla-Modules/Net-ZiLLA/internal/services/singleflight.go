@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"net-zilla/internal/models"
+)
+
+// flightGroup coalesces concurrent analyses of the same key: the first caller
+// starts the work and later callers wait for its result. The work runs on a
+// context of its own that is cancelled only once every caller has given up,
+// so one impatient caller cannot fail the others.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	report  *models.AdvancedReport
+	err     error
+	callers int
+	cancel  context.CancelFunc
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// do runs fn for key unless a run is already in flight, in which case it waits
+// for that run instead. shared reports whether the result came from a run
+// started by another caller. Callers that share a result share the report and
+// must not modify it.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (*models.AdvancedReport, error)) (report *models.AdvancedReport, shared bool, err error) {
+	g.mu.Lock()
+	f, inFlight := g.flights[key]
+	if !inFlight {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go g.run(flightCtx, key, f, fn)
+	}
+	f.callers++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.report, inFlight, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.callers--
+		if f.callers == 0 {
+			// Nobody is left to use the result; later callers start afresh
+			// rather than join a cancelled run.
+			f.cancel()
+			g.forget(key, f)
+		}
+		g.mu.Unlock()
+		return nil, inFlight, ctx.Err()
+	}
+}
+
+func (g *flightGroup) run(ctx context.Context, key string, f *flight, fn func(context.Context) (*models.AdvancedReport, error)) {
+	defer f.cancel()
+	f.report, f.err = fn(ctx)
+
+	g.mu.Lock()
+	g.forget(key, f)
+	g.mu.Unlock()
+	close(f.done)
+}
+
+// forget removes f from the group if it is still the flight for key. g.mu must
+// be held.
+func (g *flightGroup) forget(key string, f *flight) {
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
+
+// inFlight counts the keys currently being worked on.
+func (g *flightGroup) inFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.flights)
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+func TestFlightGroup_CancelledWhenEveryCallerLeaves(t *testing.T) {
+	g := newFlightGroup()
+	var runs int32
+	stopped := make(chan error, 1)
+	block := func(ctx context.Context) (*models.AdvancedReport, error) {
+		atomic.AddInt32(&runs, 1)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, _, err := g.do(ctx, "k", block)
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	if g.inFlight() != 1 {
+		t.Fatalf("inFlight = %d, want 1", g.inFlight())
+	}
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("caller error = %v", err)
+		}
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("run was not cancelled after every caller left")
+	}
+	if runs := atomic.LoadInt32(&runs); runs != 1 {
+		t.Errorf("runs = %d, want 1", runs)
+	}
+
+	// The abandoned run is forgotten; a new caller starts afresh.
+	report, shared, err := g.do(context.Background(), "k", func(context.Context) (*models.AdvancedReport, error) {
+		return &models.AdvancedReport{ReportID: "fresh"}, nil
+	})
+	if err != nil || shared || report.ReportID != "fresh" {
+		t.Errorf("fresh run = %+v, %v, %v", report, shared, err)
+	}
+}
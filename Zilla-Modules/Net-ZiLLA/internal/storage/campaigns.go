@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// SaveCampaignFeatures stores the features of an analysis, replacing any
+// saved earlier under the same analysis ID.
+func (d *Database) SaveCampaignFeatures(ctx context.Context, f CampaignFeatures) error {
+	if f.AnalysisID == "" {
+		return fmt.Errorf("campaign features have no analysis ID")
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"campaign_infrastructure", "campaign_features"} {
+		if _, err := tx.ExecContext(ctx, d.dialect.rebind(`DELETE FROM `+table+` WHERE analysis_id = ?`), f.AnalysisID); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	var created sql.NullTime
+	if !f.DomainCreated.IsZero() {
+		created = sql.NullTime{Time: f.DomainCreated.UTC(), Valid: true}
+	}
+	if _, err := tx.ExecContext(ctx,
+		d.dialect.rebind(`INSERT INTO campaign_features (analysis_id, target, risk_level, analyzed_at, path_shape, content_simhash, registrar, domain_created) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		f.AnalysisID, f.Target, f.RiskLevel, f.AnalyzedAt.UTC(), f.PathShape, f.ContentSimhash, f.Registrar, created,
+	); err != nil {
+		return fmt.Errorf("failed to save campaign features: %w", err)
+	}
+
+	seen := make(map[[2]string]bool)
+	for _, group := range []struct {
+		kind   string
+		values []string
+	}{{InfraIP, f.IPs}, {InfraNameServer, f.NameServers}, {InfraCertificate, f.Certificates}} {
+		for _, v := range group.values {
+			key := [2]string{group.kind, v}
+			if v == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if _, err := tx.ExecContext(ctx,
+				d.dialect.rebind(`INSERT INTO campaign_infrastructure (analysis_id, kind, value) VALUES (?, ?, ?)`),
+				f.AnalysisID, group.kind, v,
+			); err != nil {
+				return fmt.Errorf("failed to save campaign infrastructure: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// ListCampaignFeatures returns the features of every analysis, oldest first.
+func (d *Database) ListCampaignFeatures(ctx context.Context) ([]CampaignFeatures, error) {
+	rows, err := d.query(ctx, `SELECT analysis_id, target, risk_level, analyzed_at, path_shape, content_simhash, registrar, domain_created
+		FROM campaign_features ORDER BY analyzed_at, analysis_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CampaignFeatures
+	index := make(map[string]int)
+	for rows.Next() {
+		var f CampaignFeatures
+		var created sql.NullTime
+		if err := rows.Scan(&f.AnalysisID, &f.Target, &f.RiskLevel, &f.AnalyzedAt, &f.PathShape, &f.ContentSimhash, &f.Registrar, &created); err != nil {
+			return nil, err
+		}
+		if created.Valid {
+			f.DomainCreated = created.Time
+		}
+		index[f.AnalysisID] = len(out)
+		out = append(out, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	infra, err := d.query(ctx, `SELECT analysis_id, kind, value FROM campaign_infrastructure ORDER BY analysis_id, kind, value`)
+	if err != nil {
+		return nil, err
+	}
+	defer infra.Close()
+	for infra.Next() {
+		var id, kind, value string
+		if err := infra.Scan(&id, &kind, &value); err != nil {
+			return nil, err
+		}
+		i, ok := index[id]
+		if !ok {
+			continue
+		}
+		switch kind {
+		case InfraIP:
+			out[i].IPs = append(out[i].IPs, value)
+		case InfraNameServer:
+			out[i].NameServers = append(out[i].NameServers, value)
+		case InfraCertificate:
+			out[i].Certificates = append(out[i].Certificates, value)
+		}
+	}
+	return out, infra.Err()
+}
@@ -4,52 +4,99 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"net-zilla/internal/models"
 )
 
+// ErrNotFound is returned when no stored record matches a lookup.
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate is returned when saving a record under an ID already stored.
+var ErrDuplicate = errors.New("already exists")
+
+// Database is the SQL implementation of Store, on SQLite or PostgreSQL.
 type Database struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect
+}
+
+// Open connects to the backend named by driver ("sqlite", the default, or
+// "postgres") and applies pending migrations. An empty SQLite DSN opens
+// netzilla.db in the working directory.
+func Open(driver, dsn string) (Store, error) {
+	var db *Database
+	var err error
+	switch strings.ToLower(driver) {
+	case "", DriverSQLite, "sqlite3":
+		if dsn == "" {
+			dsn = "netzilla.db"
+		}
+		db, err = NewDatabase(dsn)
+	case DriverPostgres, "postgresql":
+		db, err = NewPostgresDatabase(dsn)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
 }
 
+// NewDatabase opens a SQLite database file.
 func NewDatabase(dataSource string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dataSource)
+	return openDatabase(sqliteDialect, sqliteDSN(dataSource))
+}
+
+// NewPostgresDatabase connects to PostgreSQL with a lib/pq connection string,
+// either a postgres:// URL or "host=... dbname=..." pairs. Any number of
+// instances may share one database.
+func NewPostgresDatabase(dsn string) (*Database, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("postgres storage needs a DSN")
+	}
+	return openDatabase(postgresDialect, dsn)
+}
+
+func openDatabase(d dialect, dsn string) (*Database, error) {
+	db, err := sql.Open(d.driverName, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	if err := initSchema(db); err != nil {
+	if err := migrate(context.Background(), db, d); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
-	return &Database{db: db}, nil
+	return &Database{db: db, dialect: d}, nil
 }
 
-func initSchema(db *sql.DB) error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS analyses (
-			id TEXT PRIMARY KEY,
-			url TEXT NOT NULL,
-			threat_level TEXT NOT NULL,
-			threat_score INTEGER NOT NULL,
-			analysis_data TEXT NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_analyses_created_at ON analyses(created_at)`,
-	}
+// SchemaVersion returns the highest migration applied to the database.
+func (d *Database) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, d.db)
+}
 
-	for _, query := range queries {
-		if _, err := db.Exec(query); err != nil {
-			return err
-		}
-	}
-	return nil
+func (d *Database) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return d.db.ExecContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *Database) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return d.db.QueryContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *Database) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return d.db.QueryRowContext(ctx, d.dialect.rebind(query), args...)
 }
 
 func (d *Database) SaveAnalysis(ctx context.Context, analysis *models.ThreatAnalysis) error {
@@ -61,7 +108,7 @@ func (d *Database) SaveAnalysis(ctx context.Context, analysis *models.ThreatAnal
 		return err
 	}
 
-	_, err = d.db.ExecContext(ctx, query,
+	_, err = d.exec(ctx, query,
 		analysis.AnalysisID,
 		analysis.URL,
 		string(analysis.ThreatLevel),
@@ -74,7 +121,28 @@ func (d *Database) SaveAnalysis(ctx context.Context, analysis *models.ThreatAnal
 func (d *Database) GetAnalysisByID(ctx context.Context, id string) (*models.ThreatAnalysis, error) {
 	query := `SELECT analysis_data FROM analyses WHERE id = ?`
 	var data string
-	err := d.db.QueryRowContext(ctx, query, id).Scan(&data)
+	err := d.queryRow(ctx, query, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var analysis models.ThreatAnalysis
+	if err := json.Unmarshal([]byte(data), &analysis); err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+// GetLatestAnalysisByURL returns the most recent stored analysis of a URL.
+func (d *Database) GetLatestAnalysisByURL(ctx context.Context, url string) (*models.ThreatAnalysis, error) {
+	query := `SELECT analysis_data FROM analyses WHERE url = ? ORDER BY created_at DESC LIMIT 1`
+	var data string
+	err := d.queryRow(ctx, query, url).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +159,7 @@ func (d *Database) Ping(ctx context.Context) error {
 
 func (d *Database) GetAnalysisHistory(ctx context.Context, limit int) ([]*models.ThreatAnalysis, error) {
 	query := `SELECT analysis_data FROM analyses ORDER BY created_at DESC LIMIT ?`
-	rows, err := d.db.QueryContext(ctx, query, limit)
+	rows, err := d.query(ctx, query, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -2,9 +2,14 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net-zilla/internal/models"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestDatabase_SaveAndRetrieve(t *testing.T) {
@@ -41,3 +46,171 @@ func TestDatabase_SaveAndRetrieve(t *testing.T) {
 		t.Errorf("expected URL %s, got %s", analysis.URL, history[0].URL)
 	}
 }
+
+func TestDatabase_GetLatestAnalysisByURL(t *testing.T) {
+	dbPath := "test_latest.db"
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	defer os.Remove(dbPath)
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := db.GetLatestAnalysisByURL(ctx, "https://missing.example"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	for i, score := range []int{10, 80} {
+		analysis := &models.ThreatAnalysis{
+			AnalysisID:  fmt.Sprintf("id-%d", i),
+			URL:         "https://test.com",
+			ThreatScore: score,
+			ThreatLevel: "MEDIUM",
+		}
+		if err := db.SaveAnalysis(ctx, analysis); err != nil {
+			t.Fatalf("failed to save analysis: %v", err)
+		}
+		// created_at has one-second resolution
+		if i == 0 {
+			db.db.ExecContext(ctx, `UPDATE analyses SET created_at = datetime('now', '-1 hour') WHERE id = ?`, analysis.AnalysisID)
+		}
+	}
+
+	got, err := db.GetLatestAnalysisByURL(ctx, "https://test.com")
+	if err != nil {
+		t.Fatalf("GetLatestAnalysisByURL: %v", err)
+	}
+	if got.ThreatScore != 80 {
+		t.Errorf("expected latest analysis (score 80), got %d", got.ThreatScore)
+	}
+}
+
+func TestDatabase_SaveAndGetReport(t *testing.T) {
+	dbPath := "test_report.db"
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	defer os.Remove(dbPath)
+	defer db.Close()
+
+	ctx := context.Background()
+	report := &models.AdvancedReport{
+		ReportID:  "NZ-1",
+		Timestamp: time.Date(2025, 3, 1, 12, 0, 0, 500, time.UTC),
+		Target:    "http://short.example/x",
+		ThreatIntelligence: &models.IOCRegistry{
+			Indicators: []models.Indicator{{Type: models.IOCTypeIP, Value: "203.0.113.7", Source: "feed", Confidence: 0.9}},
+			TotalFound: 1,
+		},
+		RiskAssessment: &models.RiskAssessment{RiskScore: 0.85, OverallRiskLevel: "CRITICAL"},
+		BasicAnalysis: &models.ThreatAnalysis{
+			RedirectChain: []models.RedirectDetail{
+				{URL: "http://short.example/x", StatusCode: 302, Location: "https://landing.example/", IPAddress: "198.51.100.1", Mechanism: models.RedirectHTTP},
+				{URL: "https://landing.example/", StatusCode: 200, IPAddress: "203.0.113.7"},
+			},
+			DNSInfo: &models.DNSAnalysis{ARecords: []string{"203.0.113.7", "203.0.113.7"}, NameServers: []string{"ns1.example"}, NSRecords: []string{"ns1.example"}},
+			TLSInfo: &models.TLSAnalysis{Subject: "landing.example", Issuer: "Test CA", CertificateValid: true, JARM: "27d40d40d29d40d1dc42d43d00041d"},
+		},
+		Sandbox: &models.SandboxResult{
+			IOCs: &models.IOCRegistry{Indicators: []models.Indicator{
+				{Type: models.IOCTypeIP, Value: "203.0.113.7", Source: "feed"},
+				{Type: models.IOCTypeDomain, Value: "cdn.example", Source: "sandbox"},
+			}},
+		},
+		Findings: []string{"Redirects through a URL shortener"},
+		Metadata: map[string]interface{}{"sandbox_escalated": "true", "processing_time_ms": float64(12)},
+	}
+	if err := db.SaveReport(ctx, report); err != nil {
+		t.Fatalf("SaveReport: %v", err)
+	}
+	// Saving the same ID again fails; replacing it leaves no duplicate rows
+	if err := db.SaveReport(ctx, report); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("SaveReport again: %v, want ErrDuplicate", err)
+	}
+	if err := db.ReplaceReport(ctx, report); err != nil {
+		t.Fatalf("ReplaceReport: %v", err)
+	}
+
+	got, err := db.GetReport(ctx, "NZ-1")
+	if err != nil {
+		t.Fatalf("GetReport: %v", err)
+	}
+	want, _ := json.Marshal(report)
+	have, _ := json.Marshal(got)
+	if string(have) != string(want) {
+		t.Errorf("round trip changed the report:\n got %s\nwant %s", have, want)
+	}
+
+	if _, err := db.GetReport(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	counts := map[string]int{"redirect_hops": 2, "dns_records": 2, "tls_certificates": 1, "indicators": 2}
+	for table, want := range counts {
+		var n int
+		if err := db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE analysis_id = 'NZ-1'`).Scan(&n); err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		if n != want {
+			t.Errorf("%s has %d rows, want %d", table, n, want)
+		}
+	}
+
+	for _, value := range []string{"203.0.113.7", "ns1.example", "198.51.100.1", "cdn.example", "27d40d40d29d40d1dc42d43d00041d"} {
+		ids, err := db.FindReportsByIndicator(ctx, value, 10)
+		if err != nil {
+			t.Fatalf("FindReportsByIndicator(%s): %v", value, err)
+		}
+		if len(ids) != 1 || ids[0] != "NZ-1" {
+			t.Errorf("FindReportsByIndicator(%s) = %v", value, ids)
+		}
+	}
+}
+
+func TestDatabase_Migrations(t *testing.T) {
+	dbPath := "test_migrations.db"
+	defer os.Remove(dbPath)
+
+	// A database from before schema versioning only has the analyses table
+	legacy, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.Exec(`CREATE TABLE analyses (id TEXT PRIMARY KEY, url TEXT NOT NULL, threat_level TEXT NOT NULL,
+		threat_score INTEGER NOT NULL, analysis_data TEXT NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.Exec(`INSERT INTO analyses (id, url, threat_level, threat_score, analysis_data) VALUES ('old', 'https://old.example', 'LOW', 1, '{"url":"https://old.example"}')`); err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		db, err := NewDatabase(dbPath)
+		if err != nil {
+			t.Fatalf("open %d: %v", i, err)
+		}
+		version, err := db.SchemaVersion(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != latestSchemaVersion() {
+			t.Errorf("schema version = %d, want %d", version, latestSchemaVersion())
+		}
+		if got, err := db.GetLatestAnalysisByURL(ctx, "https://old.example"); err != nil || got.URL != "https://old.example" {
+			t.Errorf("legacy analysis lost: %v, %v", got, err)
+		}
+		db.Close()
+	}
+
+	// A database written by a newer build is refused rather than modified
+	raw, _ := sql.Open("sqlite3", dbPath)
+	raw.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'future')`, latestSchemaVersion()+1)
+	raw.Close()
+	if _, err := NewDatabase(dbPath); err == nil {
+		t.Error("expected an error for a newer schema version")
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Supported values of the storage driver setting.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// dialect covers the differences between the SQL backends. Queries are
+// written once with "?" placeholders and rebound for the backend.
+type dialect struct {
+	name       string
+	driverName string // database/sql driver
+	numbered   bool   // $1, $2, ... placeholders
+}
+
+var (
+	sqliteDialect   = dialect{name: DriverSQLite, driverName: "sqlite3"}
+	postgresDialect = dialect{name: DriverPostgres, driverName: "postgres", numbered: true}
+)
+
+// rebind rewrites "?" placeholders into the backend's form. Queries must not
+// contain a literal "?".
+func (d dialect) rebind(query string) string {
+	if !d.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqliteDSN turns on foreign keys, which SQLite leaves off by default, and a
+// busy timeout so concurrent writers wait instead of failing, unless the DSN
+// already sets them.
+func sqliteDSN(dsn string) string {
+	params := []struct {
+		keys  []string
+		value string
+	}{
+		{[]string{"_fk=", "_foreign_keys="}, "_fk=1"},
+		{[]string{"_timeout=", "_busy_timeout="}, "_timeout=5000"},
+	}
+	for _, p := range params {
+		set := false
+		for _, k := range p.keys {
+			if strings.Contains(dsn, k) {
+				set = true
+			}
+		}
+		if set {
+			continue
+		}
+		if strings.Contains(dsn, "?") {
+			dsn += "&" + p.value
+		} else {
+			dsn += "?" + p.value
+		}
+	}
+	return dsn
+}
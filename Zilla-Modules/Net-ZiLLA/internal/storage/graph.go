@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// SaveGraphEdges replaces the edges recorded for analysisID. Duplicate edges
+// are stored once.
+func (d *Database) SaveGraphEdges(ctx context.Context, analysisID string, edges []GraphEdge) error {
+	if analysisID == "" {
+		return fmt.Errorf("graph edges have no analysis ID")
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, d.dialect.rebind(`DELETE FROM graph_edges WHERE analysis_id = ?`), analysisID); err != nil {
+		return fmt.Errorf("failed to clear graph edges: %w", err)
+	}
+	seen := make(map[GraphEdge]bool)
+	for _, e := range edges {
+		key := GraphEdge{FromType: e.FromType, FromValue: e.FromValue, ToType: e.ToType, ToValue: e.ToValue, Relation: e.Relation}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, err := tx.ExecContext(ctx,
+			d.dialect.rebind(`INSERT INTO graph_edges (analysis_id, from_type, from_value, to_type, to_value, relation, seen_at) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			analysisID, e.FromType, e.FromValue, e.ToType, e.ToValue, e.Relation, e.SeenAt.UTC(),
+		); err != nil {
+			return fmt.Errorf("failed to save graph edge: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetGraphEdges returns every recorded edge, oldest first.
+func (d *Database) GetGraphEdges(ctx context.Context) ([]GraphEdge, error) {
+	rows, err := d.query(ctx, `SELECT analysis_id, from_type, from_value, to_type, to_value, relation, seen_at
+		FROM graph_edges ORDER BY seen_at, analysis_id, from_type, from_value, relation, to_type, to_value`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edges []GraphEdge
+	for rows.Next() {
+		var e GraphEdge
+		if err := rows.Scan(&e.AnalysisID, &e.FromType, &e.FromValue, &e.ToType, &e.ToValue, &e.Relation, &e.SeenAt); err != nil {
+			return nil, err
+		}
+		edges = append(edges, e)
+	}
+	return edges, rows.Err()
+}
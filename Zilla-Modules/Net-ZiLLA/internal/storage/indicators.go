@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+const indicatorColumns = `value, type, source, confidence, severity, last_seen, first_seen, description, tags, "references"`
+
+// UpsertIndicator stores an indicator, replacing any earlier copy with the
+// same value. Type and severity are stored in lower case.
+func (d *Database) UpsertIndicator(ctx context.Context, i models.Indicator) error {
+	if i.Value == "" {
+		return fmt.Errorf("indicator value cannot be empty")
+	}
+	tags, err := json.Marshal(i.Tags)
+	if err != nil {
+		return err
+	}
+	if i.Tags == nil {
+		tags = []byte("[]")
+	}
+
+	query := `INSERT INTO threat_indicators (` + indicatorColumns + `, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (value) DO UPDATE SET
+			type = excluded.type, source = excluded.source, confidence = excluded.confidence,
+			severity = excluded.severity, last_seen = excluded.last_seen, first_seen = excluded.first_seen,
+			description = excluded.description, tags = excluded.tags, "references" = excluded."references",
+			updated_at = excluded.updated_at`
+	_, err = d.exec(ctx, query,
+		i.Value,
+		strings.ToLower(string(i.Type)),
+		i.Source,
+		i.Confidence,
+		strings.ToLower(i.Severity),
+		i.LastSeen.UTC(),
+		i.FirstSeen.UTC(),
+		i.Description,
+		string(tags),
+		strings.Join(i.References, ";"),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save indicator: %w", err)
+	}
+	return nil
+}
+
+// GetIndicator returns the indicator stored under value, or ErrNotFound.
+func (d *Database) GetIndicator(ctx context.Context, value string) (*models.Indicator, error) {
+	row := d.queryRow(ctx, `SELECT `+indicatorColumns+` FROM threat_indicators WHERE value = ?`, value)
+	i, err := scanIndicator(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("indicator lookup failed: %w", err)
+	}
+	return i, nil
+}
+
+// GetIndicators looks up several values at once. Values that are not stored
+// are absent from the result.
+func (d *Database) GetIndicators(ctx context.Context, values []string) (map[string]*models.Indicator, error) {
+	results := make(map[string]*models.Indicator)
+	if len(values) == 0 {
+		return results, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	rows, err := d.query(ctx, `SELECT `+indicatorColumns+` FROM threat_indicators WHERE value IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("bulk lookup failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i, err := scanIndicator(rows)
+		if err != nil {
+			return nil, fmt.Errorf("bulk lookup failed: %w", err)
+		}
+		results[i.Value] = i
+	}
+	return results, rows.Err()
+}
+
+// IndicatorStats counts stored indicators by type and severity, and those
+// seen in the last seven days. Cache counters are left to the caller.
+func (d *Database) IndicatorStats(ctx context.Context) (*models.ThreatDBStats, error) {
+	stats := &models.ThreatDBStats{
+		CountByType:     make(map[string]int64),
+		CountBySeverity: make(map[string]int64),
+		Timestamp:       time.Now(),
+	}
+
+	for _, group := range []struct {
+		column string
+		counts map[string]int64
+	}{{"type", stats.CountByType}, {"severity", stats.CountBySeverity}} {
+		rows, err := d.query(ctx, `SELECT `+group.column+`, COUNT(*) FROM threat_indicators GROUP BY `+group.column)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var key string
+			var count int64
+			if err := rows.Scan(&key, &count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			group.counts[key] = count
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, count := range stats.CountByType {
+		stats.TotalIndicators += count
+	}
+
+	since := time.Now().AddDate(0, 0, -7).UTC()
+	if err := d.queryRow(ctx, `SELECT COUNT(*) FROM threat_indicators WHERE last_seen > ?`, since).Scan(&stats.RecentActivity7d); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// DeleteIndicatorsSeenBefore removes indicators last seen before cutoff,
+// together with their relationships, and returns how many were removed.
+func (d *Database) DeleteIndicatorsSeenBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stale := `SELECT value FROM threat_indicators WHERE last_seen < ?`
+	if _, err := tx.ExecContext(ctx, d.dialect.rebind(`DELETE FROM indicator_relationships
+		WHERE source_indicator IN (`+stale+`) OR related_indicator IN (`+stale+`)`), cutoff.UTC(), cutoff.UTC()); err != nil {
+		return 0, fmt.Errorf("failed to delete relationships: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, d.dialect.rebind(`DELETE FROM threat_indicators WHERE last_seen < ?`), cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete indicators: %w", err)
+	}
+	removed, _ := result.RowsAffected()
+	return removed, tx.Commit()
+}
+
+// SaveFeed stores a feed, replacing any earlier one with the same name.
+func (d *Database) SaveFeed(ctx context.Context, f Feed) error {
+	if f.Name == "" {
+		return fmt.Errorf("feed name cannot be empty")
+	}
+	if f.TrustLevel == 0 {
+		f.TrustLevel = 3
+	}
+	var lastUpdated sql.NullTime
+	if !f.LastUpdated.IsZero() {
+		lastUpdated = sql.NullTime{Time: f.LastUpdated.UTC(), Valid: true}
+	}
+
+	query := `INSERT INTO threat_feeds (name, url, last_updated, update_interval, enabled, trust_level)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			url = excluded.url, last_updated = excluded.last_updated, update_interval = excluded.update_interval,
+			enabled = excluded.enabled, trust_level = excluded.trust_level`
+	if _, err := d.exec(ctx, query, f.Name, f.URL, lastUpdated, int64(f.UpdateInterval/time.Second), f.Enabled, f.TrustLevel); err != nil {
+		return fmt.Errorf("failed to save feed: %w", err)
+	}
+	return nil
+}
+
+// GetFeed returns the feed with the given name, or ErrNotFound.
+func (d *Database) GetFeed(ctx context.Context, name string) (*Feed, error) {
+	row := d.queryRow(ctx, `SELECT name, url, last_updated, update_interval, enabled, trust_level FROM threat_feeds WHERE name = ?`, name)
+	f, err := scanFeed(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// ListFeeds returns every stored feed ordered by name.
+func (d *Database) ListFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := d.query(ctx, `SELECT name, url, last_updated, update_interval, enabled, trust_level FROM threat_feeds ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []Feed
+	for rows.Next() {
+		f, err := scanFeed(rows)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, *f)
+	}
+	return feeds, rows.Err()
+}
+
+// AddRelationship links two stored indicators. Linking the same pair again
+// updates the relationship type and confidence.
+func (d *Database) AddRelationship(ctx context.Context, rel Relationship) error {
+	query := `INSERT INTO indicator_relationships (source_indicator, related_indicator, relationship_type, confidence)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (source_indicator, related_indicator) DO UPDATE SET
+			relationship_type = excluded.relationship_type, confidence = excluded.confidence`
+	if _, err := d.exec(ctx, query, rel.Source, rel.Related, rel.Type, rel.Confidence); err != nil {
+		return fmt.Errorf("failed to save relationship: %w", err)
+	}
+	return nil
+}
+
+// GetRelationships returns the relationships value takes part in, as source
+// or as related indicator.
+func (d *Database) GetRelationships(ctx context.Context, value string) ([]Relationship, error) {
+	rows, err := d.query(ctx, `SELECT source_indicator, related_indicator, relationship_type, confidence
+		FROM indicator_relationships WHERE source_indicator = ? OR related_indicator = ?
+		ORDER BY source_indicator, related_indicator`, value, value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rels []Relationship
+	for rows.Next() {
+		var rel Relationship
+		var confidence sql.NullFloat64
+		if err := rows.Scan(&rel.Source, &rel.Related, &rel.Type, &confidence); err != nil {
+			return nil, err
+		}
+		rel.Confidence = confidence.Float64
+		rels = append(rels, rel)
+	}
+	return rels, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIndicator(row rowScanner) (*models.Indicator, error) {
+	var i models.Indicator
+	var typ string
+	var description, tags, refs sql.NullString
+	if err := row.Scan(&i.Value, &typ, &i.Source, &i.Confidence, &i.Severity, &i.LastSeen, &i.FirstSeen,
+		&description, &tags, &refs); err != nil {
+		return nil, err
+	}
+	i.Type = models.IOCType(typ)
+	i.Description = description.String
+	if tags.String != "" {
+		// Tags written by older builds are not always valid JSON; drop them
+		// rather than fail the lookup.
+		if err := json.Unmarshal([]byte(tags.String), &i.Tags); err != nil || len(i.Tags) == 0 {
+			i.Tags = nil
+		}
+	}
+	if refs.String != "" {
+		i.References = strings.Split(refs.String, ";")
+	}
+	return &i, nil
+}
+
+func scanFeed(row rowScanner) (*Feed, error) {
+	var f Feed
+	var lastUpdated sql.NullTime
+	var interval sql.NullInt64
+	var enabled sql.NullBool
+	var trust sql.NullInt64
+	if err := row.Scan(&f.Name, &f.URL, &lastUpdated, &interval, &enabled, &trust); err != nil {
+		return nil, err
+	}
+	if lastUpdated.Valid {
+		f.LastUpdated = lastUpdated.Time
+	}
+	f.UpdateInterval = time.Duration(interval.Int64) * time.Second
+	f.Enabled = enabled.Bool
+	f.TrustLevel = int(trust.Int64)
+	return &f, nil
+}
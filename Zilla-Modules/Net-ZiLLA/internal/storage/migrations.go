@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migration is one versioned step of the schema. Statements run in a single
+// transaction together with the schema_migrations bookkeeping row, so a
+// failed step leaves the database at the previous version.
+//
+// Migrations are append-only: never edit or reorder a released one, add a new
+// version instead. Statements are shared by every backend, so column types and
+// syntax are kept to the subset SQLite and PostgreSQL both understand.
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "analyses",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS analyses (
+				id TEXT PRIMARY KEY,
+				url TEXT NOT NULL,
+				threat_level TEXT NOT NULL,
+				threat_score INTEGER NOT NULL,
+				analysis_data TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_analyses_created_at ON analyses(created_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_analyses_url ON analyses(url)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "reports",
+		statements: []string{
+			`CREATE TABLE reports (
+				analysis_id TEXT PRIMARY KEY,
+				target TEXT NOT NULL,
+				risk_level TEXT NOT NULL,
+				risk_score DOUBLE PRECISION NOT NULL,
+				report_data TEXT NOT NULL,
+				analyzed_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX idx_reports_target ON reports(target)`,
+			`CREATE INDEX idx_reports_analyzed_at ON reports(analyzed_at)`,
+			`CREATE TABLE redirect_hops (
+				analysis_id TEXT NOT NULL REFERENCES reports(analysis_id) ON DELETE CASCADE,
+				hop INTEGER NOT NULL,
+				url TEXT NOT NULL,
+				status_code INTEGER NOT NULL,
+				location TEXT NOT NULL,
+				ip_address TEXT NOT NULL,
+				mechanism TEXT NOT NULL,
+				PRIMARY KEY (analysis_id, hop)
+			)`,
+			`CREATE INDEX idx_redirect_hops_ip ON redirect_hops(ip_address)`,
+			`CREATE TABLE dns_records (
+				analysis_id TEXT NOT NULL REFERENCES reports(analysis_id) ON DELETE CASCADE,
+				record_type TEXT NOT NULL,
+				value TEXT NOT NULL,
+				PRIMARY KEY (analysis_id, record_type, value)
+			)`,
+			`CREATE INDEX idx_dns_records_value ON dns_records(value)`,
+			`CREATE TABLE tls_certificates (
+				analysis_id TEXT PRIMARY KEY REFERENCES reports(analysis_id) ON DELETE CASCADE,
+				subject TEXT NOT NULL,
+				issuer TEXT NOT NULL,
+				valid BOOLEAN NOT NULL,
+				expires_in_days INTEGER NOT NULL,
+				encryption_grade TEXT NOT NULL,
+				jarm TEXT NOT NULL,
+				ja3s TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_tls_certificates_jarm ON tls_certificates(jarm)`,
+			`CREATE TABLE indicators (
+				analysis_id TEXT NOT NULL REFERENCES reports(analysis_id) ON DELETE CASCADE,
+				ioc_type TEXT NOT NULL,
+				value TEXT NOT NULL,
+				source TEXT NOT NULL,
+				severity TEXT NOT NULL,
+				confidence DOUBLE PRECISION NOT NULL,
+				PRIMARY KEY (analysis_id, ioc_type, value, source)
+			)`,
+			`CREATE INDEX idx_indicators_value ON indicators(value)`,
+		},
+	},
+	{
+		// Threat intelligence used to live in its own SQLite file created by
+		// threat_intel.ThreatDatabase; IF NOT EXISTS adopts those tables.
+		version: 3,
+		name:    "threat_intel",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS threat_indicators (
+				value TEXT PRIMARY KEY,
+				type TEXT NOT NULL CHECK(type IN ('ip', 'domain', 'url', 'hash', 'email', 'asn', 'cidr')),
+				source TEXT NOT NULL,
+				confidence DOUBLE PRECISION NOT NULL CHECK(confidence >= 0 AND confidence <= 1),
+				severity TEXT NOT NULL CHECK(severity IN ('low', 'medium', 'high', 'critical')),
+				last_seen TIMESTAMP NOT NULL,
+				first_seen TIMESTAMP NOT NULL,
+				description TEXT,
+				tags TEXT,
+				"references" TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_type ON threat_indicators(type)`,
+			`CREATE INDEX IF NOT EXISTS idx_severity ON threat_indicators(severity)`,
+			`CREATE INDEX IF NOT EXISTS idx_last_seen ON threat_indicators(last_seen)`,
+			`CREATE INDEX IF NOT EXISTS idx_confidence ON threat_indicators(confidence)`,
+			`CREATE TABLE IF NOT EXISTS threat_feeds (
+				name TEXT PRIMARY KEY,
+				url TEXT NOT NULL,
+				last_updated TIMESTAMP,
+				update_interval INTEGER DEFAULT 3600,
+				enabled BOOLEAN DEFAULT TRUE,
+				trust_level INTEGER DEFAULT 3 CHECK(trust_level >= 1 AND trust_level <= 5),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS indicator_relationships (
+				source_indicator TEXT NOT NULL REFERENCES threat_indicators(value) ON DELETE CASCADE,
+				related_indicator TEXT NOT NULL REFERENCES threat_indicators(value) ON DELETE CASCADE,
+				relationship_type TEXT NOT NULL,
+				confidence DOUBLE PRECISION,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (source_indicator, related_indicator)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_relationships_related ON indicator_relationships(related_indicator)`,
+		},
+	},
+	{
+		// Edges are kept per analysis rather than merged so re-running an
+		// analysis replaces what it contributed to the graph.
+		version: 4,
+		name:    "infrastructure_graph",
+		statements: []string{
+			`CREATE TABLE graph_edges (
+				analysis_id TEXT NOT NULL,
+				from_type TEXT NOT NULL,
+				from_value TEXT NOT NULL,
+				to_type TEXT NOT NULL,
+				to_value TEXT NOT NULL,
+				relation TEXT NOT NULL,
+				seen_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (analysis_id, from_type, from_value, relation, to_type, to_value)
+			)`,
+			`CREATE INDEX idx_graph_edges_from ON graph_edges(from_value)`,
+			`CREATE INDEX idx_graph_edges_to ON graph_edges(to_value)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "campaign_features",
+		statements: []string{
+			`CREATE TABLE campaign_features (
+				analysis_id TEXT PRIMARY KEY,
+				target TEXT NOT NULL,
+				risk_level TEXT NOT NULL,
+				analyzed_at TIMESTAMP NOT NULL,
+				path_shape TEXT NOT NULL,
+				content_simhash TEXT NOT NULL,
+				registrar TEXT NOT NULL,
+				domain_created TIMESTAMP
+			)`,
+			`CREATE INDEX idx_campaign_features_analyzed_at ON campaign_features(analyzed_at)`,
+			`CREATE TABLE campaign_infrastructure (
+				analysis_id TEXT NOT NULL,
+				kind TEXT NOT NULL,
+				value TEXT NOT NULL,
+				PRIMARY KEY (analysis_id, kind, value)
+			)`,
+			`CREATE INDEX idx_campaign_infrastructure_value ON campaign_infrastructure(value)`,
+		},
+	},
+}
+
+// latestSchemaVersion is the version a fully migrated database reports.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrationLockID is the PostgreSQL advisory lock held while migrating, so
+// instances starting together do not apply the same version twice.
+const migrationLockID = 7262011
+
+// migrate brings db up to the latest schema version. Databases created before
+// versioning existed already hold the analyses table; migration 1 is written
+// to adopt it as-is.
+func migrate(ctx context.Context, db *sql.DB, d dialect) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if d.name == DriverPostgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+	}
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	current, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if current > latestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, latestSchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, conn, d, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, d dialect, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, d.rebind(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`), m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func schemaVersion(ctx context.Context, q rowQuerier) (int, error) {
+	var version sql.NullInt64
+	if err := q.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
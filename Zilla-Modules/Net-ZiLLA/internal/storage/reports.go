@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"net-zilla/internal/models"
+)
+
+// SaveReport persists a full report: the JSON document in reports, plus the
+// redirect hops, DNS records, TLS certificate and indicators it contains as
+// rows keyed by the report ID so they can be queried across analyses. It fails
+// with ErrDuplicate if the ID is already stored rather than overwrite it.
+func (d *Database) SaveReport(ctx context.Context, report *models.AdvancedReport) error {
+	return d.writeReport(ctx, report, false)
+}
+
+// ReplaceReport updates a stored report, such as when a background sandbox
+// run finishes. It fails with ErrNotFound if the ID is not stored.
+func (d *Database) ReplaceReport(ctx context.Context, report *models.AdvancedReport) error {
+	return d.writeReport(ctx, report, true)
+}
+
+func (d *Database) writeReport(ctx context.Context, report *models.AdvancedReport, replace bool) error {
+	if report == nil || report.ReportID == "" {
+		return fmt.Errorf("report has no ID")
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	riskLevel, riskScore := "", 0.0
+	if report.RiskAssessment != nil {
+		riskLevel = report.RiskAssessment.OverallRiskLevel
+		riskScore = report.RiskAssessment.RiskScore
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stored int
+	if err := tx.QueryRowContext(ctx, d.dialect.rebind(`SELECT COUNT(*) FROM reports WHERE analysis_id = ?`), report.ReportID).Scan(&stored); err != nil {
+		return fmt.Errorf("failed to look up report: %w", err)
+	}
+	switch {
+	case stored > 0 && !replace:
+		return fmt.Errorf("report %s: %w", report.ReportID, ErrDuplicate)
+	case stored == 0 && replace:
+		return fmt.Errorf("report %s: %w", report.ReportID, ErrNotFound)
+	case replace:
+		if err := deleteReport(ctx, tx, d.dialect, report.ReportID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		d.dialect.rebind(`INSERT INTO reports (analysis_id, target, risk_level, risk_score, report_data, analyzed_at) VALUES (?, ?, ?, ?, ?, ?)`),
+		report.ReportID, report.Target, riskLevel, riskScore, string(data), report.Timestamp.UTC(),
+	); err != nil {
+		return fmt.Errorf("failed to save report: %w", err)
+	}
+
+	if ba := report.BasicAnalysis; ba != nil {
+		for i, hop := range ba.RedirectChain {
+			if _, err := tx.ExecContext(ctx,
+				d.dialect.rebind(`INSERT INTO redirect_hops (analysis_id, hop, url, status_code, location, ip_address, mechanism) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+				report.ReportID, i, hop.URL, hop.StatusCode, hop.Location, hop.IPAddress, string(hop.Mechanism),
+			); err != nil {
+				return fmt.Errorf("failed to save redirect hop: %w", err)
+			}
+		}
+		for _, rec := range dnsRecords(ba.DNSInfo) {
+			if _, err := tx.ExecContext(ctx,
+				d.dialect.rebind(`INSERT INTO dns_records (analysis_id, record_type, value) VALUES (?, ?, ?)`),
+				report.ReportID, rec[0], rec[1],
+			); err != nil {
+				return fmt.Errorf("failed to save DNS record: %w", err)
+			}
+		}
+		if tls := ba.TLSInfo; tls != nil {
+			if _, err := tx.ExecContext(ctx,
+				d.dialect.rebind(`INSERT INTO tls_certificates (analysis_id, subject, issuer, valid, expires_in_days, encryption_grade, jarm, ja3s) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+				report.ReportID, tls.Subject, tls.Issuer, tls.CertificateValid, tls.ExpiresInDays, tls.EncryptionGrade, tls.JARM, tls.JA3S,
+			); err != nil {
+				return fmt.Errorf("failed to save TLS certificate: %w", err)
+			}
+		}
+	}
+
+	for _, ind := range reportIndicators(report) {
+		if _, err := tx.ExecContext(ctx,
+			d.dialect.rebind(`INSERT INTO indicators (analysis_id, ioc_type, value, source, severity, confidence) VALUES (?, ?, ?, ?, ?, ?)`),
+			report.ReportID, string(ind.Type), ind.Value, ind.Source, ind.Severity, ind.Confidence,
+		); err != nil {
+			return fmt.Errorf("failed to save indicator: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetReport loads the report saved under id exactly as it was stored.
+func (d *Database) GetReport(ctx context.Context, id string) (*models.AdvancedReport, error) {
+	var data string
+	err := d.queryRow(ctx, `SELECT report_data FROM reports WHERE analysis_id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var report models.AdvancedReport
+	if err := json.Unmarshal([]byte(data), &report); err != nil {
+		return nil, fmt.Errorf("failed to decode report %s: %w", id, err)
+	}
+	return &report, nil
+}
+
+// FindReportsByIndicator returns the IDs of reports, newest first, in which
+// value appeared as an indicator, a DNS record, a redirect hop's IP address
+// or a server JARM fingerprint.
+func (d *Database) FindReportsByIndicator(ctx context.Context, value string, limit int) ([]string, error) {
+	query := `SELECT r.analysis_id FROM reports r WHERE r.analysis_id IN (
+			SELECT analysis_id FROM indicators WHERE value = ?
+			UNION SELECT analysis_id FROM dns_records WHERE value = ?
+			UNION SELECT analysis_id FROM redirect_hops WHERE ip_address = ?
+			UNION SELECT analysis_id FROM tls_certificates WHERE jarm = ?
+		) ORDER BY r.analyzed_at DESC LIMIT ?`
+	rows, err := d.query(ctx, query, value, value, value, value, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// deleteReport removes a report and its rows. Child rows are deleted
+// explicitly rather than relying on ON DELETE CASCADE, which SQLite ignores
+// on connections opened without foreign keys.
+func deleteReport(ctx context.Context, tx *sql.Tx, d dialect, id string) error {
+	for _, table := range []string{"redirect_hops", "dns_records", "tls_certificates", "indicators", "reports"} {
+		if _, err := tx.ExecContext(ctx, d.rebind(`DELETE FROM `+table+` WHERE analysis_id = ?`), id); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// dnsRecords flattens a DNS analysis into unique (type, value) pairs.
+func dnsRecords(dns *models.DNSAnalysis) [][2]string {
+	if dns == nil {
+		return nil
+	}
+	var out [][2]string
+	seen := make(map[[2]string]bool)
+	add := func(typ string, values ...string) {
+		for _, v := range values {
+			rec := [2]string{typ, v}
+			if v == "" || seen[rec] {
+				continue
+			}
+			seen[rec] = true
+			out = append(out, rec)
+		}
+	}
+	add("A", dns.ARecords...)
+	add("AAAA", dns.AAAARecords...)
+	add("MX", dns.MXRecords...)
+	add("NS", dns.NameServers...)
+	add("NS", dns.NSRecords...)
+	add("TXT", dns.TXTRecords...)
+	add("CNAME", dns.CNAME)
+	add("CNAME", dns.CNAMERecords...)
+	add("PTR", dns.PTRRecord)
+	return out
+}
+
+// reportIndicators collects the intelligence and sandbox indicators of a
+// report, dropping duplicates of the same type, value and source.
+func reportIndicators(report *models.AdvancedReport) []models.Indicator {
+	var out []models.Indicator
+	seen := make(map[[3]string]bool)
+	for _, reg := range []*models.IOCRegistry{report.ThreatIntelligence, sandboxIOCs(report.Sandbox)} {
+		if reg == nil {
+			continue
+		}
+		for _, ind := range reg.Indicators {
+			key := [3]string{string(ind.Type), ind.Value, ind.Source}
+			if ind.Value == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, ind)
+		}
+	}
+	return out
+}
+
+func sandboxIOCs(s *models.SandboxResult) *models.IOCRegistry {
+	if s == nil {
+		return nil
+	}
+	return s.IOCs
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+// Store is the persistence layer shared by every Net-Zilla instance pointed at
+// the same database. Database implements it on SQLite and PostgreSQL; callers
+// should depend on Store so the backend stays a configuration choice.
+type Store interface {
+	AnalysisRepository
+	IndicatorRepository
+	FeedRepository
+	RelationshipRepository
+	GraphRepository
+	CampaignRepository
+
+	Ping(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (int, error)
+	Close() error
+}
+
+// AnalysisRepository stores analysis summaries and full reports.
+type AnalysisRepository interface {
+	SaveAnalysis(ctx context.Context, analysis *models.ThreatAnalysis) error
+	GetAnalysisByID(ctx context.Context, id string) (*models.ThreatAnalysis, error)
+	GetLatestAnalysisByURL(ctx context.Context, url string) (*models.ThreatAnalysis, error)
+	GetAnalysisHistory(ctx context.Context, limit int) ([]*models.ThreatAnalysis, error)
+
+	SaveReport(ctx context.Context, report *models.AdvancedReport) error
+	ReplaceReport(ctx context.Context, report *models.AdvancedReport) error
+	GetReport(ctx context.Context, id string) (*models.AdvancedReport, error)
+	FindReportsByIndicator(ctx context.Context, value string, limit int) ([]string, error)
+}
+
+// IndicatorRepository stores threat intelligence indicators keyed by value.
+type IndicatorRepository interface {
+	UpsertIndicator(ctx context.Context, indicator models.Indicator) error
+	GetIndicator(ctx context.Context, value string) (*models.Indicator, error)
+	GetIndicators(ctx context.Context, values []string) (map[string]*models.Indicator, error)
+	IndicatorStats(ctx context.Context) (*models.ThreatDBStats, error)
+	DeleteIndicatorsSeenBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// FeedRepository stores the threat intelligence feeds indicators come from.
+type FeedRepository interface {
+	SaveFeed(ctx context.Context, feed Feed) error
+	GetFeed(ctx context.Context, name string) (*Feed, error)
+	ListFeeds(ctx context.Context) ([]Feed, error)
+}
+
+// RelationshipRepository links indicators to each other.
+type RelationshipRepository interface {
+	AddRelationship(ctx context.Context, rel Relationship) error
+	GetRelationships(ctx context.Context, value string) ([]Relationship, error)
+}
+
+// GraphRepository stores the infrastructure each analysis observed as edges
+// between typed values, from which correlation.InfrastructureGraph is built.
+type GraphRepository interface {
+	SaveGraphEdges(ctx context.Context, analysisID string, edges []GraphEdge) error
+	GetGraphEdges(ctx context.Context) ([]GraphEdge, error)
+}
+
+// CampaignRepository stores the per-analysis features campaign clustering
+// compares, so campaigns can be recomputed without decoding every report.
+type CampaignRepository interface {
+	SaveCampaignFeatures(ctx context.Context, features CampaignFeatures) error
+	ListCampaignFeatures(ctx context.Context) ([]CampaignFeatures, error)
+}
+
+// Feed is a threat intelligence source and its refresh schedule.
+type Feed struct {
+	Name           string        `json:"name"`
+	URL            string        `json:"url"`
+	LastUpdated    time.Time     `json:"last_updated,omitempty"` // Zero until the first refresh
+	UpdateInterval time.Duration `json:"update_interval"`        // Stored with one-second resolution
+	Enabled        bool          `json:"enabled"`
+	TrustLevel     int           `json:"trust_level"` // 1 (low) to 5 (high)
+}
+
+// Relationship is a directed link between two stored indicators, such as a
+// domain that resolves to an IP.
+type Relationship struct {
+	Source     string  `json:"source"`
+	Related    string  `json:"related"`
+	Type       string  `json:"type"`
+	Confidence float64 `json:"confidence"`
+}
+
+// GraphEdge is one relationship an analysis observed between two pieces of
+// infrastructure, such as a domain resolving to an IP. Types and relations
+// are the correlation.Node* and correlation.Rel* constants.
+type GraphEdge struct {
+	AnalysisID string    `json:"analysis_id"`
+	FromType   string    `json:"from_type"`
+	FromValue  string    `json:"from_value"`
+	ToType     string    `json:"to_type"`
+	ToValue    string    `json:"to_value"`
+	Relation   string    `json:"relation"`
+	SeenAt     time.Time `json:"seen_at"`
+}
+
+// Infrastructure kinds of CampaignFeatures, as stored in
+// campaign_infrastructure.
+const (
+	InfraIP          = "ip"
+	InfraNameServer  = "ns"
+	InfraCertificate = "cert"
+)
+
+// CampaignFeatures is what campaign clustering knows about one analysis.
+type CampaignFeatures struct {
+	AnalysisID     string    `json:"analysis_id"`
+	Target         string    `json:"target"`
+	RiskLevel      string    `json:"risk_level"`
+	AnalyzedAt     time.Time `json:"analyzed_at"`
+	IPs            []string  `json:"ips,omitempty"`
+	NameServers    []string  `json:"name_servers,omitempty"`
+	Certificates   []string  `json:"certificates,omitempty"` // SHA-256 fingerprints
+	PathShape      string    `json:"path_shape,omitempty"`   // Landing URL path with variable segments masked
+	ContentSimhash string    `json:"content_simhash,omitempty"`
+	Registrar      string    `json:"registrar,omitempty"`
+	DomainCreated  time.Time `json:"domain_created,omitempty"` // Zero when WHOIS had no creation date
+}
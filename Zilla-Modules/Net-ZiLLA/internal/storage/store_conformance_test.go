@@ -0,0 +1,431 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+// postgresDSNEnv names a PostgreSQL instance the conformance suite may use.
+// Each test runs in a throwaway schema that is dropped afterwards.
+const postgresDSNEnv = "NETZILLA_TEST_POSTGRES_DSN"
+
+// TestStoreConformance runs the same behaviour checks against every backend.
+func TestStoreConformance(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) Store
+	}{
+		{DriverSQLite, openTestSQLite},
+		{DriverPostgres, openTestPostgres},
+	}
+	checks := []struct {
+		name string
+		run  func(t *testing.T, s Store)
+	}{
+		{"schema", checkSchema},
+		{"analyses", checkAnalyses},
+		{"reports", checkReports},
+		{"indicators", checkIndicators},
+		{"feeds", checkFeeds},
+		{"relationships", checkRelationships},
+		{"graph", checkGraph},
+		{"campaigns", checkCampaigns},
+	}
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			for _, c := range checks {
+				t.Run(c.name, func(t *testing.T) {
+					c.run(t, b.open(t))
+				})
+			}
+		})
+	}
+}
+
+func openTestSQLite(t *testing.T) Store {
+	s, err := Open(DriverSQLite, filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func openTestPostgres(t *testing.T) Store {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("set %s to run against PostgreSQL", postgresDSNEnv)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("netzilla_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	s, err := Open(DriverPostgres, withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// withSearchPath points a lib/pq DSN, in URL or key=value form, at schema.
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return strings.TrimSpace(dsn) + " search_path=" + schema
+}
+
+func checkSchema(t *testing.T, s Store) {
+	ctx := context.Background()
+	if err := s.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != latestSchemaVersion() {
+		t.Errorf("schema version = %d, want %d", version, latestSchemaVersion())
+	}
+}
+
+func checkAnalyses(t *testing.T, s Store) {
+	ctx := context.Background()
+	for i, score := range []int{10, 80} {
+		err := s.SaveAnalysis(ctx, &models.ThreatAnalysis{
+			AnalysisID:  fmt.Sprintf("a-%d", i),
+			URL:         "https://test.example",
+			ThreatLevel: "MEDIUM",
+			ThreatScore: score,
+		})
+		if err != nil {
+			t.Fatalf("SaveAnalysis: %v", err)
+		}
+	}
+
+	got, err := s.GetAnalysisByID(ctx, "a-1")
+	if err != nil || got.ThreatScore != 80 {
+		t.Errorf("GetAnalysisByID = %+v, %v", got, err)
+	}
+	if _, err := s.GetAnalysisByID(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAnalysisByID(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetLatestAnalysisByURL(ctx, "https://missing.example"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetLatestAnalysisByURL(missing) error = %v, want ErrNotFound", err)
+	}
+	if got, err := s.GetLatestAnalysisByURL(ctx, "https://test.example"); err != nil || got.URL != "https://test.example" {
+		t.Errorf("GetLatestAnalysisByURL = %+v, %v", got, err)
+	}
+	history, err := s.GetAnalysisHistory(ctx, 1)
+	if err != nil || len(history) != 1 {
+		t.Errorf("GetAnalysisHistory(1) = %d entries, %v", len(history), err)
+	}
+}
+
+func checkReports(t *testing.T, s Store) {
+	ctx := context.Background()
+	report := &models.AdvancedReport{
+		ReportID:       "NZ-conformance",
+		Timestamp:      time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Target:         "http://short.example/x",
+		RiskAssessment: &models.RiskAssessment{RiskScore: 0.6, OverallRiskLevel: "HIGH"},
+		ThreatIntelligence: &models.IOCRegistry{
+			Indicators: []models.Indicator{{Type: models.IOCTypeDomain, Value: "landing.example", Source: "feed"}},
+		},
+		BasicAnalysis: &models.ThreatAnalysis{
+			RedirectChain: []models.RedirectDetail{{URL: "http://short.example/x", StatusCode: 301, IPAddress: "198.51.100.1"}},
+			DNSInfo:       &models.DNSAnalysis{ARecords: []string{"198.51.100.1"}},
+			TLSInfo:       &models.TLSAnalysis{Subject: "landing.example", JARM: "2ad2ad0002ad2ad00042d42d000000"},
+		},
+		Metadata: map[string]interface{}{"sandbox_escalated": "false"},
+	}
+	if err := s.SaveReport(ctx, report); err != nil {
+		t.Fatalf("SaveReport: %v", err)
+	}
+	if err := s.SaveReport(ctx, report); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("SaveReport of a stored ID error = %v, want ErrDuplicate", err)
+	}
+	if err := s.ReplaceReport(ctx, report); err != nil {
+		t.Fatalf("ReplaceReport: %v", err)
+	}
+	if err := s.ReplaceReport(ctx, &models.AdvancedReport{ReportID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReplaceReport(missing) error = %v, want ErrNotFound", err)
+	}
+
+	got, err := s.GetReport(ctx, report.ReportID)
+	if err != nil {
+		t.Fatalf("GetReport: %v", err)
+	}
+	want, _ := json.Marshal(report)
+	have, _ := json.Marshal(got)
+	if string(have) != string(want) {
+		t.Errorf("round trip changed the report:\n got %s\nwant %s", have, want)
+	}
+	if _, err := s.GetReport(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetReport(missing) error = %v, want ErrNotFound", err)
+	}
+
+	for _, value := range []string{"landing.example", "198.51.100.1", "2ad2ad0002ad2ad00042d42d000000"} {
+		ids, err := s.FindReportsByIndicator(ctx, value, 10)
+		if err != nil || len(ids) != 1 || ids[0] != report.ReportID {
+			t.Errorf("FindReportsByIndicator(%s) = %v, %v", value, ids, err)
+		}
+	}
+}
+
+func checkIndicators(t *testing.T, s Store) {
+	ctx := context.Background()
+	seen := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	ind := models.Indicator{
+		Type: models.IOCTypeIP, Value: "203.0.113.9", Source: "feed", Confidence: 0.8, Severity: "HIGH",
+		LastSeen: seen, FirstSeen: seen.Add(-time.Hour), Description: "C2 server",
+		Tags: []string{"c2", "botnet"}, References: []string{"https://ref.example/1"},
+	}
+	if err := s.UpsertIndicator(ctx, ind); err != nil {
+		t.Fatalf("UpsertIndicator: %v", err)
+	}
+	got, err := s.GetIndicator(ctx, ind.Value)
+	if err != nil {
+		t.Fatalf("GetIndicator: %v", err)
+	}
+	if got.Type != "ip" || got.Severity != "high" || got.Source != "feed" || got.Confidence != 0.8 ||
+		got.Description != "C2 server" || strings.Join(got.Tags, ",") != "c2,botnet" ||
+		strings.Join(got.References, ",") != "https://ref.example/1" ||
+		!got.LastSeen.Equal(ind.LastSeen) || !got.FirstSeen.Equal(ind.FirstSeen) {
+		t.Errorf("GetIndicator = %+v", got)
+	}
+	if _, err := s.GetIndicator(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetIndicator(missing) error = %v, want ErrNotFound", err)
+	}
+
+	ind.Source = "other-feed"
+	if err := s.UpsertIndicator(ctx, ind); err != nil {
+		t.Fatalf("UpsertIndicator again: %v", err)
+	}
+	if got, _ := s.GetIndicator(ctx, ind.Value); got == nil || got.Source != "other-feed" {
+		t.Errorf("upsert did not replace the indicator: %+v", got)
+	}
+	bad := ind
+	bad.Value, bad.Type = "x", "bogus"
+	if err := s.UpsertIndicator(ctx, bad); err == nil {
+		t.Error("expected an error for an unknown indicator type")
+	}
+
+	recent := models.Indicator{Type: models.IOCTypeDomain, Value: "fresh.example", Source: "feed", Severity: "low",
+		LastSeen: time.Now(), FirstSeen: time.Now()}
+	if err := s.UpsertIndicator(ctx, recent); err != nil {
+		t.Fatal(err)
+	}
+	found, err := s.GetIndicators(ctx, []string{ind.Value, recent.Value, "missing"})
+	if err != nil || len(found) != 2 {
+		t.Errorf("GetIndicators = %d results, %v", len(found), err)
+	}
+
+	stats, err := s.IndicatorStats(ctx)
+	if err != nil {
+		t.Fatalf("IndicatorStats: %v", err)
+	}
+	if stats.TotalIndicators != 2 || stats.CountByType["ip"] != 1 || stats.CountBySeverity["low"] != 1 || stats.RecentActivity7d != 1 {
+		t.Errorf("IndicatorStats = %+v", stats)
+	}
+
+	removed, err := s.DeleteIndicatorsSeenBefore(ctx, time.Now().AddDate(0, 0, -30))
+	if err != nil || removed != 1 {
+		t.Errorf("DeleteIndicatorsSeenBefore = %d, %v", removed, err)
+	}
+	if _, err := s.GetIndicator(ctx, ind.Value); !errors.Is(err, ErrNotFound) {
+		t.Errorf("stale indicator still stored: %v", err)
+	}
+}
+
+func checkFeeds(t *testing.T, s Store) {
+	ctx := context.Background()
+	if _, err := s.GetFeed(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFeed(missing) error = %v, want ErrNotFound", err)
+	}
+
+	updated := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	feeds := []Feed{
+		{Name: "urlhaus", URL: "https://urlhaus.example/feed", UpdateInterval: time.Hour, Enabled: true, TrustLevel: 4, LastUpdated: updated},
+		{Name: "local", URL: "file:///feeds/local.csv", UpdateInterval: 5 * time.Minute},
+	}
+	for _, f := range feeds {
+		if err := s.SaveFeed(ctx, f); err != nil {
+			t.Fatalf("SaveFeed(%s): %v", f.Name, err)
+		}
+	}
+	got, err := s.GetFeed(ctx, "urlhaus")
+	if err != nil || got.URL != feeds[0].URL || got.UpdateInterval != time.Hour || !got.Enabled ||
+		got.TrustLevel != 4 || !got.LastUpdated.Equal(updated) {
+		t.Errorf("GetFeed = %+v, %v", got, err)
+	}
+
+	feeds[0].Enabled = false
+	if err := s.SaveFeed(ctx, feeds[0]); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.ListFeeds(ctx)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListFeeds = %d feeds, %v", len(list), err)
+	}
+	if list[0].Name != "local" || !list[0].LastUpdated.IsZero() || list[0].TrustLevel != 3 || list[1].Enabled {
+		t.Errorf("ListFeeds = %+v", list)
+	}
+}
+
+func checkRelationships(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+	old := now.AddDate(0, 0, -90)
+	for _, ind := range []models.Indicator{
+		{Type: models.IOCTypeDomain, Value: "evil.example", Source: "feed", Severity: "high", LastSeen: now, FirstSeen: now},
+		{Type: models.IOCTypeIP, Value: "203.0.113.50", Source: "feed", Severity: "high", LastSeen: now, FirstSeen: now},
+		{Type: models.IOCTypeIP, Value: "203.0.113.51", Source: "feed", Severity: "low", LastSeen: old, FirstSeen: old},
+	} {
+		if err := s.UpsertIndicator(ctx, ind); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rels := []Relationship{
+		{Source: "evil.example", Related: "203.0.113.50", Type: "resolves_to", Confidence: 0.9},
+		{Source: "evil.example", Related: "203.0.113.51", Type: "resolves_to", Confidence: 0.5},
+	}
+	for _, rel := range rels {
+		if err := s.AddRelationship(ctx, rel); err != nil {
+			t.Fatalf("AddRelationship: %v", err)
+		}
+	}
+	rels[0].Type = "hosted_on"
+	if err := s.AddRelationship(ctx, rels[0]); err != nil {
+		t.Fatalf("AddRelationship again: %v", err)
+	}
+	if err := s.AddRelationship(ctx, Relationship{Source: "evil.example", Related: "unknown.example", Type: "links_to"}); err == nil {
+		t.Error("expected an error relating an indicator that is not stored")
+	}
+
+	got, err := s.GetRelationships(ctx, "evil.example")
+	if err != nil || len(got) != 2 || got[0].Type != "hosted_on" || got[0].Confidence != 0.9 {
+		t.Errorf("GetRelationships(source) = %+v, %v", got, err)
+	}
+	if got, _ := s.GetRelationships(ctx, "203.0.113.50"); len(got) != 1 || got[0].Source != "evil.example" {
+		t.Errorf("GetRelationships(related) = %+v", got)
+	}
+
+	if _, err := s.DeleteIndicatorsSeenBefore(ctx, now.AddDate(0, 0, -30)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetRelationships(ctx, "evil.example"); len(got) != 1 {
+		t.Errorf("relationships of a deleted indicator remain: %+v", got)
+	}
+}
+
+func checkGraph(t *testing.T, s Store) {
+	ctx := context.Background()
+	first := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	edge := func(id, from, to string, at time.Time) GraphEdge {
+		return GraphEdge{AnalysisID: id, FromType: "DOMAIN", FromValue: from, ToType: "IP", ToValue: to, Relation: "RESOLVES_TO", SeenAt: at}
+	}
+
+	if err := s.SaveGraphEdges(ctx, "NZ-2", []GraphEdge{edge("NZ-2", "b.example", "203.0.113.7", first.Add(time.Hour))}); err != nil {
+		t.Fatalf("SaveGraphEdges: %v", err)
+	}
+	stale := []GraphEdge{edge("NZ-1", "a.example", "198.51.100.9", first)}
+	if err := s.SaveGraphEdges(ctx, "NZ-1", stale); err != nil {
+		t.Fatalf("SaveGraphEdges: %v", err)
+	}
+	replaced := []GraphEdge{edge("NZ-1", "a.example", "203.0.113.7", first), edge("NZ-1", "a.example", "203.0.113.7", first)}
+	if err := s.SaveGraphEdges(ctx, "NZ-1", replaced); err != nil {
+		t.Fatalf("SaveGraphEdges again: %v", err)
+	}
+	if err := s.SaveGraphEdges(ctx, "", replaced); err == nil {
+		t.Error("expected an error saving edges without an analysis ID")
+	}
+
+	got, err := s.GetGraphEdges(ctx)
+	if err != nil {
+		t.Fatalf("GetGraphEdges: %v", err)
+	}
+	if len(got) != 2 || got[0].AnalysisID != "NZ-1" || got[0].ToValue != "203.0.113.7" || got[1].AnalysisID != "NZ-2" {
+		t.Fatalf("GetGraphEdges = %+v", got)
+	}
+	if !got[0].SeenAt.Equal(first) {
+		t.Errorf("SeenAt = %v, want %v", got[0].SeenAt, first)
+	}
+}
+
+func checkCampaigns(t *testing.T, s Store) {
+	ctx := context.Background()
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := CampaignFeatures{
+		AnalysisID: "NZ-1", Target: "http://a.example/x", RiskLevel: "HIGH", AnalyzedAt: at,
+		IPs: []string{"203.0.113.7", "203.0.113.7"}, Certificates: []string{"abcd"},
+		PathShape: "/x", ContentSimhash: "00ff00ff00ff00ff", Registrar: "Cheap Names LLC",
+		DomainCreated: at.AddDate(0, 0, -2),
+	}
+	second := CampaignFeatures{AnalysisID: "NZ-2", Target: "b.example", RiskLevel: "LOW", AnalyzedAt: at.Add(time.Hour), NameServers: []string{"ns1.example"}}
+	for _, f := range []CampaignFeatures{second, {AnalysisID: "NZ-1", Target: "stale"}, first} {
+		if err := s.SaveCampaignFeatures(ctx, f); err != nil {
+			t.Fatalf("SaveCampaignFeatures: %v", err)
+		}
+	}
+	if err := s.SaveCampaignFeatures(ctx, CampaignFeatures{}); err == nil {
+		t.Error("expected an error saving features without an analysis ID")
+	}
+
+	got, err := s.ListCampaignFeatures(ctx)
+	if err != nil {
+		t.Fatalf("ListCampaignFeatures: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("ListCampaignFeatures = %+v", got)
+	}
+	first.IPs = []string{"203.0.113.7"}
+	if g := got[0]; g.AnalysisID != "NZ-1" || g.Target != first.Target || !g.AnalyzedAt.Equal(at) ||
+		!g.DomainCreated.Equal(first.DomainCreated) || len(g.IPs) != 1 || len(g.Certificates) != 1 ||
+		g.PathShape != first.PathShape || g.ContentSimhash != first.ContentSimhash || g.Registrar != first.Registrar {
+		t.Errorf("first = %+v, want %+v", g, first)
+	}
+	if g := got[1]; g.AnalysisID != "NZ-2" || !g.DomainCreated.IsZero() || len(g.NameServers) != 1 || g.IPs != nil {
+		t.Errorf("second = %+v", g)
+	}
+}
+
+func TestDialectRebind(t *testing.T) {
+	query := `SELECT a FROM t WHERE b = ? AND c IN (?, ?)`
+	if got := sqliteDialect.rebind(query); got != query {
+		t.Errorf("sqlite rebind = %q", got)
+	}
+	if got, want := postgresDialect.rebind(query), `SELECT a FROM t WHERE b = $1 AND c IN ($2, $3)`; got != want {
+		t.Errorf("postgres rebind = %q, want %q", got, want)
+	}
+	if got, want := sqliteDSN("data/x.db"), "data/x.db?_fk=1&_timeout=5000"; got != want {
+		t.Errorf("sqliteDSN = %q, want %q", got, want)
+	}
+	if got, want := sqliteDSN("x.db?_journal=WAL&_foreign_keys=0"), "x.db?_journal=WAL&_foreign_keys=0&_timeout=5000"; got != want {
+		t.Errorf("sqliteDSN = %q, want %q", got, want)
+	}
+}
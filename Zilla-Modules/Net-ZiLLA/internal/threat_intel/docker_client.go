@@ -0,0 +1,292 @@
+package threat_intel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultDockerSocket is where the Docker Engine listens on Linux hosts.
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// dockerAPIVersion pins the Engine API so request and response shapes are stable;
+// every Engine since 20.10 serves it.
+const dockerAPIVersion = "v1.41"
+
+// DockerClient is a minimal Docker Engine API client over the daemon's Unix socket.
+// It covers only what the sandbox needs, so no Docker CLI or SDK is required.
+type DockerClient struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewDockerClient creates a client for the Engine listening on socketPath.
+func NewDockerClient(socketPath string) *DockerClient {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &DockerClient{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+				MaxIdleConns:    4,
+				IdleConnTimeout: 30 * time.Second,
+			},
+		},
+		// The host is ignored by the dialer but must be a valid URL host.
+		baseURL: "http://docker/" + dockerAPIVersion,
+	}
+}
+
+// DockerError is a non-success answer from the Engine.
+type DockerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *DockerError) Error() string {
+	return fmt.Sprintf("docker: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// IsDockerNotFound reports whether err is the Engine saying an object does not exist.
+func IsDockerNotFound(err error) bool {
+	var de *DockerError
+	return errors.As(err, &de) && de.StatusCode == http.StatusNotFound
+}
+
+// DockerContainerConfig is the body of a container create request. Field names
+// follow the Engine API, which is why they carry no JSON tags.
+type DockerContainerConfig struct {
+	Image      string
+	Env        []string            `json:",omitempty"`
+	Labels     map[string]string   `json:",omitempty"`
+	Volumes    map[string]struct{} `json:",omitempty"`
+	User       string              `json:",omitempty"`
+	StopSignal string              `json:",omitempty"`
+	HostConfig DockerHostConfig
+}
+
+// DockerHostConfig holds the isolation and resource settings of a container.
+type DockerHostConfig struct {
+	NetworkMode    string
+	Memory         int64             `json:",omitempty"` // Bytes
+	MemorySwap     int64             `json:",omitempty"` // Equal to Memory disables swap
+	NanoCpus       int64             `json:",omitempty"`
+	PidsLimit      int64             `json:",omitempty"`
+	ReadonlyRootfs bool              `json:",omitempty"`
+	CapDrop        []string          `json:",omitempty"`
+	SecurityOpt    []string          `json:",omitempty"`
+	Tmpfs          map[string]string `json:",omitempty"`
+}
+
+// Ping checks that the daemon is reachable.
+func (dc *DockerClient) Ping(ctx context.Context) error {
+	resp, err := dc.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ImageExists reports whether image is present locally.
+func (dc *DockerClient) ImageExists(ctx context.Context, image string) (bool, error) {
+	resp, err := dc.do(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil)
+	if IsDockerNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// PullImage pulls image and waits for the pull to finish.
+func (dc *DockerClient) PullImage(ctx context.Context, image string) error {
+	name, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, tag = image[:i], image[i+1:]
+	}
+	q := url.Values{"fromImage": {name}, "tag": {tag}}
+	resp, err := dc.do(ctx, http.MethodPost, "/images/create", q, nil)
+	if err != nil {
+		return fmt.Errorf("pulling %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+
+	// Progress is streamed as JSON lines; failures arrive as an error line with
+	// a 200 status, so the whole stream has to be read.
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &msg) == nil && msg.Error != "" {
+			return fmt.Errorf("pulling %s: %s", image, msg.Error)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("pulling %s: %w", image, err)
+	}
+	return nil
+}
+
+// CreateContainer creates a container named name and returns its ID.
+func (dc *DockerClient) CreateContainer(ctx context.Context, name string, cfg DockerContainerConfig) (string, error) {
+	var q url.Values
+	if name != "" {
+		q = url.Values{"name": {name}}
+	}
+	resp, err := dc.do(ctx, http.MethodPost, "/containers/create", q, cfg)
+	if err != nil {
+		return "", fmt.Errorf("creating container: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decoding create response: %w", err)
+	}
+	if out.ID == "" {
+		return "", fmt.Errorf("creating container: empty ID in response")
+	}
+	return out.ID, nil
+}
+
+// StartContainer starts a created container.
+func (dc *DockerClient) StartContainer(ctx context.Context, id string) error {
+	resp, err := dc.do(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil)
+	if err != nil {
+		return fmt.Errorf("starting container %s: %w", shortID(id), err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// WaitContainer blocks until the container stops or ctx ends and returns its exit code.
+func (dc *DockerClient) WaitContainer(ctx context.Context, id string) (int, error) {
+	q := url.Values{"condition": {"not-running"}}
+	resp, err := dc.do(ctx, http.MethodPost, "/containers/"+id+"/wait", q, nil)
+	if err != nil {
+		return 0, fmt.Errorf("waiting for container %s: %w", shortID(id), err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		StatusCode int
+		Error      *struct{ Message string }
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, fmt.Errorf("waiting for container %s: %w", shortID(id), err)
+	}
+	if out.Error != nil && out.Error.Message != "" {
+		return out.StatusCode, fmt.Errorf("waiting for container %s: %s", shortID(id), out.Error.Message)
+	}
+	return out.StatusCode, nil
+}
+
+// KillContainer sends SIGKILL. A container that already stopped is not an error.
+func (dc *DockerClient) KillContainer(ctx context.Context, id string) error {
+	resp, err := dc.do(ctx, http.MethodPost, "/containers/"+id+"/kill", nil, nil)
+	var de *DockerError
+	if errors.As(err, &de) && de.StatusCode == http.StatusConflict {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("killing container %s: %w", shortID(id), err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// RemoveContainer force-removes a container and its anonymous volumes. A container
+// that is already gone is not an error.
+func (dc *DockerClient) RemoveContainer(ctx context.Context, id string) error {
+	q := url.Values{"force": {"true"}, "v": {"true"}}
+	resp, err := dc.do(ctx, http.MethodDelete, "/containers/"+id, q, nil)
+	if IsDockerNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("removing container %s: %w", shortID(id), err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// CopyFromContainer returns a tar archive of path inside the container. The
+// archive's entries are rooted at the base name of path.
+func (dc *DockerClient) CopyFromContainer(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	q := url.Values{"path": {path}}
+	resp, err := dc.do(ctx, http.MethodGet, "/containers/"+id+"/archive", q, nil)
+	if err != nil {
+		return nil, fmt.Errorf("copying %s from container %s: %w", path, shortID(id), err)
+	}
+	return resp.Body, nil
+}
+
+// do sends a request and turns non-2xx answers into a DockerError. The caller
+// closes the body of a successful response.
+func (dc *DockerClient) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encoding request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := dc.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := dc.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var msg struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+		msg.Message = strings.TrimSpace(string(data))
+	}
+	if msg.Message == "" {
+		msg.Message = resp.Status
+	}
+	return nil, &DockerError{StatusCode: resp.StatusCode, Message: msg.Message}
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
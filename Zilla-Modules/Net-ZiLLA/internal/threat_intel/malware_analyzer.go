@@ -778,6 +778,9 @@ func (ma *MalwareAnalyzer) addToCache(key string, analysis *models.BehaviorAnaly
 	ma.signatureCache[key] = analysis
 }
 
+// maxScriptBytes bounds how much of a file is run through the script patterns.
+const maxScriptBytes = 8 << 20
+
 // AnalyzeFile analyzes a file on disk
 func (ma *MalwareAnalyzer) AnalyzeFile(filePath string) (*models.BehaviorAnalysis, error) {
 	file, err := os.Open(filePath)
@@ -792,15 +795,11 @@ func (ma *MalwareAnalyzer) AnalyzeFile(filePath string) (*models.BehaviorAnalysi
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
 	
-	// Read first 1MB for analysis (enough for most scripts)
-	buffer := make([]byte, 1024*1024)
-	n, err := file.Read(buffer)
-	if err != nil && err != io.EOF {
+	content, err := io.ReadAll(io.LimitReader(file, maxScriptBytes))
+	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 	
-	content := string(buffer[:n])
-	
 	// Calculate file hashes
 	hashes, err := ma.calculateFileHashes(filePath)
 	if err != nil {
@@ -808,10 +807,83 @@ func (ma *MalwareAnalyzer) AnalyzeFile(filePath string) (*models.BehaviorAnalysi
 	}
 	
 	// Analyze content
-	analysis := ma.AnalyzeScript(content)
+	analysis := copyAnalysis(ma.AnalyzeScript(string(content)))
+	ma.applyKnownHashes(analysis, hashes)
+	analysis.FileSize = fileInfo.Size()
+	analysis.FileName = fileInfo.Name()
 	
-	// Check against known malicious hashes
-	for hashType, hashValue := range hashes {
+	return analysis, nil
+}
+
+// AnalyzeBytes analyzes a file held in memory, such as a member unpacked from an
+// archive. Hashes are always checked against known malware; the script patterns
+// only run on text, since compressed or compiled data trips the entropy and
+// encoding heuristics without meaning anything.
+func (ma *MalwareAnalyzer) AnalyzeBytes(name string, data []byte) *models.BehaviorAnalysis {
+	analysis := &models.BehaviorAnalysis{
+		Patterns:  make([]models.BehavioralPattern, 0),
+		Severity:  "INFO",
+		Timestamp: time.Now(),
+	}
+	if IsText(data) {
+		content := data
+		if len(content) > maxScriptBytes {
+			content = content[:maxScriptBytes]
+		}
+		analysis = copyAnalysis(ma.AnalyzeScript(string(content)))
+	}
+	ma.applyKnownHashes(analysis, HashBytes(data))
+	analysis.FileSize = int64(len(data))
+	analysis.FileName = name
+	return analysis
+}
+
+// IsText reports whether data looks like text rather than binary: no NUL bytes
+// and mostly printable characters in the first 8KB.
+func IsText(data []byte) bool {
+	if len(data) > 8192 {
+		data = data[:8192]
+	}
+	if len(data) == 0 {
+		return false
+	}
+	control := 0
+	for _, b := range data {
+		switch {
+		case b == 0:
+			return false
+		case b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f':
+			control++
+		}
+	}
+	return control*20 < len(data)
+}
+
+// HashBytes returns the MD5, SHA1 and SHA256 of data, keyed like calculateFileHashes.
+func HashBytes(data []byte) map[string]string {
+	md5Sum := md5.Sum(data)
+	sha1Sum := sha1.Sum(data)
+	sha256Sum := sha256.Sum256(data)
+	return map[string]string{
+		"MD5":    hex.EncodeToString(md5Sum[:]),
+		"SHA1":   hex.EncodeToString(sha1Sum[:]),
+		"SHA256": hex.EncodeToString(sha256Sum[:]),
+	}
+}
+
+// copyAnalysis copies a possibly cached analysis so it can be amended.
+func copyAnalysis(a *models.BehaviorAnalysis) *models.BehaviorAnalysis {
+	c := *a
+	c.Patterns = append([]models.BehavioralPattern(nil), a.Patterns...)
+	return &c
+}
+
+// applyKnownHashes adds a pattern for every hash in the signature database and
+// rescores the analysis.
+func (ma *MalwareAnalyzer) applyKnownHashes(analysis *models.BehaviorAnalysis, hashes map[string]string) {
+	ma.mu.RLock()
+	for _, hashType := range []string{"MD5", "SHA1", "SHA256"} {
+		hashValue := hashes[hashType]
 		if sig, found := ma.maliciousHashes[hashValue]; found {
 			analysis.Patterns = append(analysis.Patterns, models.BehavioralPattern{
 				Name:   fmt.Sprintf("Known Malware: %s", sig.Name),
@@ -821,10 +893,7 @@ func (ma *MalwareAnalyzer) AnalyzeFile(filePath string) (*models.BehaviorAnalysi
 			})
 		}
 	}
-	
-	// Add file metadata
-	analysis.FileSize = fileInfo.Size()
-	analysis.FileName = fileInfo.Name()
+	ma.mu.RUnlock()
 	analysis.FileHashes = hashes
 	
 	// Recalculate with signature matches
@@ -833,8 +902,6 @@ func (ma *MalwareAnalyzer) AnalyzeFile(filePath string) (*models.BehaviorAnalysi
 		analysis.Severity = ma.determineSeverity(analysis.RiskScore)
 		analysis.Confidence = float64(ma.calculateConfidence(analysis.Patterns))
 	}
-	
-	return analysis, nil
 }
 
 func (ma *MalwareAnalyzer) calculateFileHashes(filePath string) (map[string]string, error) {
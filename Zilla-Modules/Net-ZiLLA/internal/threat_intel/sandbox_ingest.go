@@ -0,0 +1,467 @@
+package threat_intel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
+)
+
+// sandboxMaxHARBytes caps the HAR file that is parsed into memory.
+const sandboxMaxHARBytes = 128 << 20
+
+// sandboxManifest is the manifest.json a sandbox image writes next to its
+// artifacts. Every field is optional; paths are relative to the output directory.
+type sandboxManifest struct {
+	Target      string    `json:"target"`
+	FinalURL    string    `json:"final_url"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	HAR         string    `json:"har"`
+	DOM         string    `json:"dom"`
+	Screenshots []string  `json:"screenshots"`
+	Console     []struct {
+		Level string `json:"level"`
+		Text  string `json:"text"`
+	} `json:"console"`
+	Downloads []manifestDownload `json:"downloads"`
+}
+
+type manifestDownload struct {
+	File     string `json:"file"` // Normally under downloads/
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+}
+
+// harLog is the subset of the HAR 1.2 format that is ingested.
+type harLog struct {
+	Log struct {
+		Version string `json:"version"`
+		Pages   []struct {
+			Title string `json:"title"`
+		} `json:"pages"`
+		Entries []struct {
+			StartedDateTime string `json:"startedDateTime"`
+			ServerIPAddress string `json:"serverIPAddress"`
+			Request         struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Content struct {
+					Size     int64  `json:"size"`
+					MimeType string `json:"mimeType"`
+				} `json:"content"`
+				RedirectURL string `json:"redirectURL"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// SandboxIngestor turns a sandbox's artifact directory into a SandboxResult:
+// requests from the HAR, downloads re-analyzed with MalwareAnalyzer, blobs for
+// the DOM and screenshots, and the IOCs they contain.
+type SandboxIngestor struct {
+	malware *MalwareAnalyzer
+	logger  *logger.Logger
+}
+
+func NewSandboxIngestor(l *logger.Logger) *SandboxIngestor {
+	return &SandboxIngestor{
+		malware: NewMalwareAnalyzer(),
+		logger:  l,
+	}
+}
+
+// IngestRun ingests the artifacts of a finished SandboxRun.
+func (si *SandboxIngestor) IngestRun(run *SandboxRun) (*models.SandboxResult, error) {
+	res, err := si.Ingest(run.ArtifactDir)
+	if err != nil {
+		return nil, err
+	}
+	res.ContainerID = run.ContainerID
+	res.TimedOut = run.TimedOut
+	if res.Target == "" {
+		res.Target = run.Target
+	}
+	if res.StartedAt.IsZero() {
+		res.StartedAt = run.StartedAt
+	}
+	if res.FinishedAt.IsZero() {
+		res.FinishedAt = run.FinishedAt
+	}
+	return res, nil
+}
+
+// Ingest reads dir. manifest.json is used when present; otherwise artifacts are
+// found by the same layout rules the sandbox manager uses. Missing or unreadable
+// artifacts become warnings rather than errors.
+func (si *SandboxIngestor) Ingest(dir string) (*models.SandboxResult, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading sandbox artifacts: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("reading sandbox artifacts: %s is not a directory", dir)
+	}
+
+	res := &models.SandboxResult{ArtifactDir: dir}
+	manifest := si.readManifest(dir, res)
+	si.fillFromLayout(dir, manifest)
+
+	res.Target = manifest.Target
+	res.FinalURL = manifest.FinalURL
+	res.StartedAt = manifest.StartedAt
+	res.FinishedAt = manifest.FinishedAt
+
+	if manifest.HAR != "" {
+		si.ingestHAR(dir, manifest.HAR, res)
+	} else {
+		res.Warnings = append(res.Warnings, "no HAR file in sandbox output")
+	}
+	if manifest.DOM != "" {
+		res.DOM = si.blob(dir, manifest.DOM, res)
+	}
+	for _, name := range manifest.Screenshots {
+		if b := si.blob(dir, name, res); b != nil {
+			res.Screenshots = append(res.Screenshots, *b)
+		}
+	}
+	for _, c := range manifest.Console {
+		if strings.EqualFold(c.Level, "error") && c.Text != "" {
+			res.ConsoleErrors = append(res.ConsoleErrors, c.Text)
+		}
+	}
+	for _, d := range manifest.Downloads {
+		si.ingestDownload(dir, d.File, d.URL, d.MimeType, res)
+	}
+
+	res.IOCs = ExtractSandboxIOCs(res)
+	return res, nil
+}
+
+func (si *SandboxIngestor) readManifest(dir string, res *models.SandboxResult) *sandboxManifest {
+	m := &sandboxManifest{}
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return m
+	}
+	if err == nil {
+		err = json.Unmarshal(data, m)
+	}
+	if err != nil {
+		si.logger.Warn("Ignoring sandbox manifest: %v", err)
+		res.Warnings = append(res.Warnings, fmt.Sprintf("unreadable manifest: %v", err))
+		return &sandboxManifest{}
+	}
+	return m
+}
+
+// fillFromLayout fills the parts of m the manifest left out from the files in dir.
+func (si *SandboxIngestor) fillFromLayout(dir string, m *sandboxManifest) {
+	var hars, doms, shots, downloads []string
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		switch artifactKind(rel) {
+		case ArtifactHAR:
+			hars = append(hars, rel)
+		case ArtifactDOM:
+			doms = append(doms, rel)
+		case ArtifactScreenshot:
+			shots = append(shots, rel)
+		case ArtifactDownload:
+			downloads = append(downloads, rel)
+		}
+		return nil
+	})
+
+	if m.HAR == "" && len(hars) > 0 {
+		m.HAR = hars[0]
+	}
+	if m.DOM == "" && len(doms) > 0 {
+		m.DOM = doms[0]
+		for _, d := range doms {
+			if strings.EqualFold(filepath.Base(d), "dom.html") {
+				m.DOM = d
+			}
+		}
+	}
+	if len(m.Screenshots) == 0 {
+		m.Screenshots = shots
+	}
+
+	listed := make(map[string]bool)
+	for _, d := range m.Downloads {
+		listed[d.File] = true
+	}
+	for _, d := range downloads {
+		if !listed[d] {
+			m.Downloads = append(m.Downloads, manifestDownload{File: d})
+		}
+	}
+}
+
+func (si *SandboxIngestor) ingestHAR(dir, name string, res *models.SandboxResult) {
+	p, ok := artifactPath(dir, name)
+	if !ok {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("HAR path %q escapes the artifact directory", name))
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("HAR unreadable: %v", err))
+		return
+	}
+	defer f.Close()
+
+	var har harLog
+	if err := json.NewDecoder(io.LimitReader(f, sandboxMaxHARBytes)).Decode(&har); err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("HAR unreadable: %v", err))
+		return
+	}
+	if v := har.Log.Version; v != "1.2" && v != "1.1" {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("unexpected HAR version %q", v))
+	}
+	if len(har.Log.Pages) > 0 {
+		res.Title = har.Log.Pages[0].Title
+	}
+
+	seenHost, seenIP := make(map[string]bool), make(map[string]bool)
+	redirects := make(map[string]string)
+	for _, e := range har.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		req := models.SandboxRequest{
+			Method:   e.Request.Method,
+			URL:      e.Request.URL,
+			Host:     strings.ToLower(u.Hostname()),
+			IP:       strings.Trim(e.ServerIPAddress, "[]"),
+			Status:   e.Response.Status,
+			MimeType: e.Response.Content.MimeType,
+			Size:     e.Response.Content.Size,
+		}
+		if e.Response.RedirectURL != "" {
+			if ref, err := u.Parse(e.Response.RedirectURL); err == nil {
+				req.RedirectURL = ref.String()
+				redirects[req.URL] = req.RedirectURL
+			}
+		}
+		if t, err := time.Parse(time.RFC3339Nano, e.StartedDateTime); err == nil {
+			req.StartedAt = t
+		}
+		res.Requests = append(res.Requests, req)
+
+		if !seenHost[req.Host] {
+			seenHost[req.Host] = true
+			res.Hosts = append(res.Hosts, req.Host)
+		}
+		if req.IP != "" && net.ParseIP(req.IP) != nil && !seenIP[req.IP] {
+			seenIP[req.IP] = true
+			res.IPs = append(res.IPs, req.IP)
+		}
+	}
+
+	if res.FinalURL == "" && len(res.Requests) > 0 {
+		res.FinalURL = followRedirects(res.Requests[0].URL, redirects)
+	}
+}
+
+// followRedirects walks the HAR's redirect chain from start, stopping at loops.
+func followRedirects(start string, redirects map[string]string) string {
+	seen := map[string]bool{start: true}
+	cur := start
+	for {
+		next, ok := redirects[cur]
+		if !ok || seen[next] {
+			return cur
+		}
+		seen[next] = true
+		cur = next
+	}
+}
+
+func (si *SandboxIngestor) ingestDownload(dir, name, sourceURL, mimeType string, res *models.SandboxResult) {
+	d := models.SandboxDownload{Name: name, URL: sourceURL, MimeType: mimeType}
+	p, ok := artifactPath(dir, name)
+	if !ok {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("download path %q escapes the artifact directory", name))
+		return
+	}
+	d.Path = p
+
+	analysis, err := si.malware.AnalyzeFile(p)
+	if err != nil {
+		d.Error = err.Error()
+		res.Warnings = append(res.Warnings, fmt.Sprintf("download %s not analyzed: %v", name, err))
+	} else {
+		d.Analysis = analysis
+		d.Hashes = analysis.FileHashes
+		d.Size = analysis.FileSize
+	}
+	if d.MimeType == "" && err == nil {
+		d.MimeType = sniffMimeType(p)
+	}
+	res.Downloads = append(res.Downloads, d)
+}
+
+func (si *SandboxIngestor) blob(dir, name string, res *models.SandboxResult) *models.SandboxBlob {
+	p, ok := artifactPath(dir, name)
+	if !ok {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("artifact path %q escapes the artifact directory", name))
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("artifact %s unreadable: %v", name, err))
+		return nil
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("artifact %s unreadable: %v", name, err))
+		return nil
+	}
+	return &models.SandboxBlob{Path: p, SHA256: hex.EncodeToString(h.Sum(nil)), Size: n, MimeType: sniffMimeType(p)}
+}
+
+// artifactPath resolves a manifest path inside dir, refusing anything that escapes it.
+func artifactPath(dir, name string) (string, bool) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", false
+	}
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return p, true
+}
+
+func sniffMimeType(p string) string {
+	f, err := os.Open(p)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	return http.DetectContentType(buf[:n])
+}
+
+// ExtractSandboxIOCs lists what a sandbox session touched as indicators: every
+// contacted domain and public IP, the landing URL when it differs from the
+// target, and each download by URL and SHA-256. Contacted infrastructure is
+// low-confidence by itself; downloads carry the severity MalwareAnalyzer gave them.
+func ExtractSandboxIOCs(res *models.SandboxResult) *models.IOCRegistry {
+	reg := &models.IOCRegistry{}
+	seen := make(map[string]bool)
+	seenAt := res.StartedAt
+	if seenAt.IsZero() {
+		seenAt = time.Now()
+	}
+	add := func(ind models.Indicator) {
+		key := string(ind.Type) + "|" + ind.Value
+		if ind.Value == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		ind.Source = "sandbox"
+		ind.FirstSeen, ind.LastSeen = seenAt, seenAt
+		reg.Indicators = append(reg.Indicators, ind)
+	}
+
+	for _, host := range res.Hosts {
+		if net.ParseIP(host) != nil {
+			continue // Listed as an IP below
+		}
+		add(models.Indicator{
+			Type: models.IOCTypeDomain, Value: host, Confidence: 0.3, Severity: "low",
+			Description: "Contacted during sandbox session", Tags: []string{"sandbox", "contacted"},
+		})
+	}
+	ips := append([]string(nil), res.IPs...)
+	for _, host := range res.Hosts {
+		if net.ParseIP(host) != nil {
+			ips = append(ips, host)
+		}
+	}
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsLinkLocalUnicast() || parsed.IsUnspecified() {
+			continue
+		}
+		add(models.Indicator{
+			Type: models.IOCTypeIP, Value: ip, Confidence: 0.3, Severity: "low",
+			Description: "Contacted during sandbox session", Tags: []string{"sandbox", "contacted"},
+		})
+	}
+	if res.FinalURL != "" && res.FinalURL != res.Target {
+		add(models.Indicator{
+			Type: models.IOCTypeURL, Value: res.FinalURL, Confidence: 0.5, Severity: "medium",
+			Description: "Landing page reached from " + res.Target, Tags: []string{"sandbox", "landing"},
+		})
+	}
+
+	for _, d := range res.Downloads {
+		severity, confidence := "medium", 0.6
+		if d.Analysis != nil && d.Analysis.Severity != "" {
+			severity = strings.ToLower(d.Analysis.Severity)
+			if d.Analysis.RiskScore >= 70 {
+				confidence = 0.9
+			}
+		}
+		desc := "Downloaded during sandbox session: " + filepath.Base(d.Name)
+		add(models.Indicator{
+			Type: models.IOCTypeURL, Value: d.URL, Confidence: confidence, Severity: severity,
+			Description: desc, Tags: []string{"sandbox", "download"},
+		})
+		add(models.Indicator{
+			Type: models.IOCTypeHash, Value: d.Hashes["SHA256"], Confidence: confidence, Severity: severity,
+			Description: desc, Tags: []string{"sandbox", "download", "sha256"},
+		})
+	}
+
+	sort.SliceStable(reg.Indicators, func(i, j int) bool {
+		return iocTypeOrder(reg.Indicators[i].Type) < iocTypeOrder(reg.Indicators[j].Type)
+	})
+	reg.TotalFound = len(reg.Indicators)
+	return reg
+}
+
+func iocTypeOrder(t models.IOCType) int {
+	switch t {
+	case models.IOCTypeHash:
+		return 0
+	case models.IOCTypeURL:
+		return 1
+	case models.IOCTypeDomain:
+		return 2
+	default:
+		return 3
+	}
+}
@@ -0,0 +1,195 @@
+package threat_intel
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
+)
+
+const testHAR = `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "netzilla-browser", "version": "1.0"},
+    "pages": [{"id": "page_1", "title": "Sign in to your account"}],
+    "entries": [
+      {"startedDateTime": "2026-03-01T10:00:00.000Z", "serverIPAddress": "203.0.113.10",
+       "request": {"method": "GET", "url": "https://short.example/abc"},
+       "response": {"status": 302, "redirectURL": "https://login-portal.example/signin", "content": {"size": 0, "mimeType": ""}}},
+      {"startedDateTime": "2026-03-01T10:00:00.200Z", "serverIPAddress": "[2001:db8::5]",
+       "request": {"method": "GET", "url": "https://login-portal.example/signin"},
+       "response": {"status": 200, "redirectURL": "", "content": {"size": 5120, "mimeType": "text/html"}}},
+      {"startedDateTime": "2026-03-01T10:00:00.400Z", "serverIPAddress": "198.51.100.7",
+       "request": {"method": "GET", "url": "https://cdn.example/app.js"},
+       "response": {"status": 200, "redirectURL": "", "content": {"size": 900, "mimeType": "application/javascript"}}},
+      {"startedDateTime": "2026-03-01T10:00:01.000Z", "serverIPAddress": "10.0.0.8",
+       "request": {"method": "POST", "url": "https://login-portal.example/collect"},
+       "response": {"status": 200, "redirectURL": "", "content": {"size": 2, "mimeType": "application/json"}}}
+    ]
+  }
+}`
+
+const testManifest = `{
+  "target": "https://short.example/abc",
+  "har": "session.har",
+  "screenshots": ["screenshot.png"],
+  "console": [
+    {"level": "error", "text": "Uncaught TypeError: x is undefined"},
+    {"level": "info", "text": "loaded"}
+  ],
+  "downloads": [
+    {"file": "downloads/update.js", "url": "https://login-portal.example/update.js", "mime_type": "text/plain"},
+    {"file": "../../etc/passwd"}
+  ]
+}`
+
+func writeArtifacts(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, body := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSandboxIngestor_Ingest(t *testing.T) {
+	dir := writeArtifacts(t, map[string]string{
+		"manifest.json":       testManifest,
+		"session.har":         testHAR,
+		"screenshot.png":      "\x89PNG\r\n\x1a\n0000",
+		"dom.html":            "<html><title>Sign in</title></html>",
+		"downloads/update.js": "eval(atob('W21hbGljaW91cyBjb2RlXQ=='))",
+		"downloads/extra.bin": "MZ\x90\x00",
+	})
+
+	res, err := NewSandboxIngestor(logger.New()).Ingest(dir)
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	if res.Target != "https://short.example/abc" || res.Title != "Sign in to your account" {
+		t.Errorf("Target/Title = %q / %q", res.Target, res.Title)
+	}
+	if res.FinalURL != "https://login-portal.example/signin" {
+		t.Errorf("FinalURL = %q, want the redirect target", res.FinalURL)
+	}
+	if len(res.Requests) != 4 {
+		t.Fatalf("got %d requests, want 4", len(res.Requests))
+	}
+	if r := res.Requests[1]; r.IP != "2001:db8::5" || r.Status != 200 || r.MimeType != "text/html" || r.StartedAt.IsZero() {
+		t.Errorf("unexpected request: %+v", r)
+	}
+	if got := strings.Join(res.Hosts, ","); got != "short.example,login-portal.example,cdn.example" {
+		t.Errorf("Hosts = %s", got)
+	}
+	if len(res.ConsoleErrors) != 1 {
+		t.Errorf("ConsoleErrors = %q", res.ConsoleErrors)
+	}
+	if res.DOM == nil || len(res.DOM.SHA256) != 64 || !strings.HasPrefix(res.DOM.MimeType, "text/html") {
+		t.Errorf("DOM blob = %+v", res.DOM)
+	}
+	if len(res.Screenshots) != 1 || res.Screenshots[0].MimeType != "image/png" {
+		t.Errorf("Screenshots = %+v", res.Screenshots)
+	}
+
+	if len(res.Downloads) != 2 {
+		t.Fatalf("got %d downloads, want the listed one plus the unlisted one: %+v", len(res.Downloads), res.Downloads)
+	}
+	js := res.Downloads[0]
+	if js.URL != "https://login-portal.example/update.js" || js.Analysis == nil || len(js.Hashes["SHA256"]) != 64 {
+		t.Errorf("download not analyzed: %+v", js)
+	}
+	if js.Analysis != nil && js.Analysis.RiskScore < 50 {
+		t.Errorf("malicious script scored low: %+v", js.Analysis)
+	}
+	if !containsPrefix(res.Warnings, `download path "../../etc/passwd" escapes`) {
+		t.Errorf("traversal not rejected, warnings: %q", res.Warnings)
+	}
+
+	iocs := make(map[string]models.IOCType)
+	for _, ind := range res.IOCs.Indicators {
+		iocs[ind.Value] = ind.Type
+		if ind.Source != "sandbox" {
+			t.Errorf("indicator %s source = %q", ind.Value, ind.Source)
+		}
+	}
+	want := map[string]models.IOCType{
+		"login-portal.example":                   models.IOCTypeDomain,
+		"cdn.example":                            models.IOCTypeDomain,
+		"203.0.113.10":                           models.IOCTypeIP,
+		"https://login-portal.example/signin":    models.IOCTypeURL,
+		"https://login-portal.example/update.js": models.IOCTypeURL,
+		js.Hashes["SHA256"]:                      models.IOCTypeHash,
+	}
+	for value, typ := range want {
+		if iocs[value] != typ {
+			t.Errorf("IOC %s = %q, want %q", value, iocs[value], typ)
+		}
+	}
+	if _, ok := iocs["10.0.0.8"]; ok {
+		t.Error("private IP reported as an IOC")
+	}
+	if res.IOCs.TotalFound != len(res.IOCs.Indicators) {
+		t.Errorf("TotalFound = %d, want %d", res.IOCs.TotalFound, len(res.IOCs.Indicators))
+	}
+	if res.IOCs.Indicators[0].Type != models.IOCTypeHash {
+		t.Errorf("hashes should sort first, got %s", res.IOCs.Indicators[0].Type)
+	}
+}
+
+func TestSandboxIngestor_WithoutManifest(t *testing.T) {
+	dir := writeArtifacts(t, map[string]string{
+		"capture/page.har": testHAR,
+		"final.png":        "\x89PNG\r\n\x1a\n0000",
+		"index.html":       "<html></html>",
+	})
+
+	res, err := NewSandboxIngestor(logger.New()).IngestRun(&SandboxRun{
+		ContainerID: "abc", Target: "https://short.example/abc", ArtifactDir: dir, TimedOut: true,
+	})
+	if err != nil {
+		t.Fatalf("IngestRun: %v", err)
+	}
+	if res.ContainerID != "abc" || !res.TimedOut || res.Target != "https://short.example/abc" {
+		t.Errorf("run fields not copied: %+v", res)
+	}
+	if len(res.Requests) != 4 || res.DOM == nil || len(res.Screenshots) != 1 {
+		t.Errorf("layout discovery failed: %d requests, DOM %v, %d screenshots", len(res.Requests), res.DOM, len(res.Screenshots))
+	}
+	if len(res.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %q", res.Warnings)
+	}
+}
+
+func TestSandboxIngestor_Errors(t *testing.T) {
+	si := NewSandboxIngestor(logger.New())
+	if _, err := si.Ingest(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+
+	dir := writeArtifacts(t, map[string]string{"manifest.json": "{not json", "session.har": `{"log":`})
+	res, err := si.Ingest(dir)
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if !containsPrefix(res.Warnings, "unreadable manifest") || !containsPrefix(res.Warnings, "HAR unreadable") {
+		t.Errorf("warnings = %q", res.Warnings)
+	}
+}
+
+func containsPrefix(list []string, prefix string) bool {
+	for _, s := range list {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
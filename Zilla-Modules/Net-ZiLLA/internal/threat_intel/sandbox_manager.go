@@ -1,9 +1,46 @@
 package threat_intel
 
 import (
+	"archive/tar"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
+
+	"net-zilla/internal/config"
+	"net-zilla/pkg/logger"
+)
+
+// sandboxOutputDir is where the sandbox image writes its HAR, screenshots and DOM.
+// It is an anonymous volume owned by the container, not a host mount.
+const sandboxOutputDir = "/output"
+
+// Limits on what is copied back from a sandbox, so a hostile page cannot fill the disk.
+const (
+	sandboxMaxArtifactBytes = 256 << 20
+	sandboxMaxArtifacts     = 1000
+)
+
+// sandboxOverhead is the time a run gets on top of the browser timeout for
+// pulling the image, starting the container and copying its artifacts.
+const sandboxOverhead = 2 * time.Minute
+
+// Artifact kinds recognised in a sandbox's output directory.
+const (
+	ArtifactHAR        = "har"
+	ArtifactScreenshot = "screenshot"
+	ArtifactDOM        = "dom"
+	ArtifactManifest   = "manifest"
+	ArtifactDownload   = "download"
+	ArtifactOther      = "other"
 )
 
 type SandboxManager struct {
@@ -11,13 +48,91 @@ type SandboxManager struct {
 	timeout     time.Duration
 	mode        string // docker, anyrun, hybrid
 	apiKey      string
+
+	enabled     bool
+	autoDestroy bool
+	docker      *DockerClient
+	network     string // Docker network whose only way out is the egress proxy; empty means no network
+	proxyURL    string
+	memoryMB    int64
+	cpus        float64
+	pidsLimit   int64
+	artifactDir string
+	logger      *logger.Logger
+
+	mu      sync.Mutex
+	started map[string]time.Time // Running Docker sandboxes by container ID
+}
+
+// SandboxRun is the outcome of one sandboxed browser session.
+type SandboxRun struct {
+	ContainerID string            `json:"container_id"`
+	Image       string            `json:"image"`
+	Target      string            `json:"target"`
+	StartedAt   time.Time         `json:"started_at"`
+	FinishedAt  time.Time         `json:"finished_at"`
+	ExitCode    int               `json:"exit_code"`
+	TimedOut    bool              `json:"timed_out"`
+	Cancelled   bool              `json:"cancelled"` // Killed because the caller's context ended
+	ArtifactDir string            `json:"artifact_dir"`
+	Artifacts   []SandboxArtifact `json:"artifacts"`
+	Destroyed   bool              `json:"destroyed"`
+}
+
+// SandboxArtifact is one file copied out of the sandbox's output directory.
+type SandboxArtifact struct {
+	Name string `json:"name"` // Path relative to the output directory
+	Path string `json:"path"` // Location on the host
+	Kind string `json:"kind"`
+	Size int64  `json:"size"`
 }
 
-func NewSandboxManager() *SandboxManager {
+func NewSandboxManager(l *logger.Logger) *SandboxManager {
 	return &SandboxManager{
 		dockerImage: "netzilla/isolated-browser:latest",
 		timeout:     5 * time.Minute,
 		mode:        "docker",
+		enabled:     true,
+		autoDestroy: true,
+		docker:      NewDockerClient(DefaultDockerSocket),
+		memoryMB:    1024,
+		cpus:        1,
+		pidsLimit:   256,
+		artifactDir: filepath.Join("data", "sandbox"),
+		logger:      l,
+		started:     make(map[string]time.Time),
+	}
+}
+
+// Configure applies the sandbox section of the configuration. Zero values keep the defaults.
+func (sm *SandboxManager) Configure(cfg config.SandboxConfig) {
+	sm.enabled = cfg.Enabled
+	sm.autoDestroy = cfg.AutoDestroy
+	if cfg.Type != "" {
+		sm.mode = cfg.Type
+	}
+	if cfg.DockerImage != "" {
+		sm.dockerImage = cfg.DockerImage
+	}
+	if cfg.TimeoutMinutes > 0 {
+		sm.timeout = time.Duration(cfg.TimeoutMinutes) * time.Minute
+	}
+	if cfg.DockerSocket != "" {
+		sm.docker = NewDockerClient(cfg.DockerSocket)
+	}
+	sm.network = cfg.Network
+	sm.proxyURL = cfg.ProxyURL
+	if cfg.MemoryMB > 0 {
+		sm.memoryMB = int64(cfg.MemoryMB)
+	}
+	if cfg.CPUs > 0 {
+		sm.cpus = cfg.CPUs
+	}
+	if cfg.PidsLimit > 0 {
+		sm.pidsLimit = int64(cfg.PidsLimit)
+	}
+	if cfg.ArtifactDir != "" {
+		sm.artifactDir = cfg.ArtifactDir
 	}
 }
 
@@ -25,15 +140,34 @@ func (sm *SandboxManager) SetMode(mode string) {
 	sm.mode = mode
 }
 
+// SetTimeout bounds how long a sandbox may run before it is killed.
+func (sm *SandboxManager) SetTimeout(d time.Duration) {
+	sm.timeout = d
+}
+
+// Enabled reports whether the sandbox may be started at all.
+func (sm *SandboxManager) Enabled() bool {
+	return sm.enabled
+}
+
+// Budget is how long a whole Run may take: the browser timeout plus the
+// overhead of pulling the image and copying artifacts.
+func (sm *SandboxManager) Budget() time.Duration {
+	return sm.timeout + sandboxOverhead
+}
+
+// SetDockerClient replaces the Engine client, e.g. to use a non-default socket.
+func (sm *SandboxManager) SetDockerClient(dc *DockerClient) {
+	sm.docker = dc
+}
+
 // SpinUpIsolatedBrowser prepares an ephemeral container or remote sandbox for analysis
 func (sm *SandboxManager) SpinUpIsolatedBrowser(ctx context.Context, url string) (string, error) {
 	switch sm.mode {
 	case "hybrid":
-		fmt.Printf("[*] Hybrid Analysis: Starting local container and remote task for: %s\n", url)
-		// Start local and remote in parallel (simplified here)
-		id, _ := sm.startDockerSandbox(ctx, url)
+		sm.logger.Info("Hybrid analysis: starting local container and remote task for %s", url)
 		sm.startRemoteSandbox(ctx, url)
-		return id, nil
+		return sm.startDockerSandbox(ctx, url)
 	case "anyrun":
 		return sm.startRemoteSandbox(ctx, url)
 	default:
@@ -41,17 +175,287 @@ func (sm *SandboxManager) SpinUpIsolatedBrowser(ctx context.Context, url string)
 	}
 }
 
+// Run opens url in a fresh Docker sandbox, waits for it to finish or time out,
+// copies its artifacts to the host and, with auto-destroy on, removes it. Only
+// the docker mode collects artifacts; the remote modes are rejected.
+func (sm *SandboxManager) Run(ctx context.Context, url string) (*SandboxRun, error) {
+	if sm.mode != "docker" {
+		return nil, fmt.Errorf("sandbox mode %q cannot collect artifacts, only docker can", sm.mode)
+	}
+	id, err := sm.startDockerSandbox(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := sm.Collect(ctx, id)
+	if run != nil {
+		run.Target = url
+	}
+	if sm.autoDestroy {
+		if derr := sm.DestroySandbox(id); derr != nil {
+			sm.logger.Warn("Sandbox cleanup failed: %v", derr)
+		} else if run != nil {
+			run.Destroyed = true
+		}
+	}
+	return run, err
+}
+
+// Collect waits for a started sandbox until it exits, its time budget runs out
+// or ctx ends, kills it in the latter cases, and copies its output directory to
+// the host. Artifacts are collected even when ctx has ended, in which case its
+// error is returned with the run.
+func (sm *SandboxManager) Collect(ctx context.Context, id string) (*SandboxRun, error) {
+	sm.mu.Lock()
+	started, ok := sm.started[id]
+	sm.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sandbox %s", shortID(id))
+	}
+
+	run := &SandboxRun{ContainerID: id, Image: sm.dockerImage, StartedAt: started}
+
+	waitCtx, cancel := context.WithDeadline(ctx, started.Add(sm.timeout))
+	code, err := sm.docker.WaitContainer(waitCtx, id)
+	cancel()
+	switch {
+	case err == nil:
+		run.ExitCode = code
+	case ctx.Err() != nil:
+		sm.logger.Warn("Sandbox %s cancelled, killing it: %v", shortID(id), ctx.Err())
+		run.Cancelled = true
+		sm.killQuietly(id)
+	case errors.Is(err, context.DeadlineExceeded):
+		sm.logger.Warn("Sandbox %s exceeded %v, killing it", shortID(id), sm.timeout)
+		run.TimedOut = true
+		sm.killQuietly(id)
+	default:
+		sm.killQuietly(id)
+		return run, err
+	}
+	run.FinishedAt = time.Now()
+
+	// The output volume outlives the process, so artifacts written before a
+	// timeout or cancellation are still collected.
+	copyCtx := ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		copyCtx, cancel = context.WithTimeout(context.Background(), sandboxOverhead)
+		defer cancel()
+	}
+	dir := filepath.Join(sm.artifactDir, shortID(id))
+	artifacts, err := sm.copyArtifacts(copyCtx, id, dir)
+	run.ArtifactDir = dir
+	run.Artifacts = artifacts
+	if err != nil {
+		return run, fmt.Errorf("collecting sandbox artifacts: %w", err)
+	}
+	if run.Cancelled {
+		return run, fmt.Errorf("sandbox %s: %w", shortID(id), ctx.Err())
+	}
+	return run, nil
+}
+
 func (sm *SandboxManager) startDockerSandbox(ctx context.Context, url string) (string, error) {
-	fmt.Printf("[*] Escalating to Docker sandbox: Spinning up %s for URL: %s\n", sm.dockerImage, url)
-	return "DOCKER-ID-" + fmt.Sprintf("%d", time.Now().Unix()), nil
+	if !sm.enabled {
+		return "", fmt.Errorf("sandbox is disabled")
+	}
+	sm.logger.Info("Escalating to Docker sandbox: starting %s for %s", sm.dockerImage, url)
+
+	exists, err := sm.docker.ImageExists(ctx, sm.dockerImage)
+	if err != nil {
+		return "", fmt.Errorf("docker unavailable: %w", err)
+	}
+	if !exists {
+		if err := sm.docker.PullImage(ctx, sm.dockerImage); err != nil {
+			return "", err
+		}
+	}
+
+	id, err := sm.docker.CreateContainer(ctx, "netzilla-sandbox-"+randomSuffix(), sm.containerConfig(url))
+	if err != nil {
+		return "", err
+	}
+	if err := sm.docker.StartContainer(ctx, id); err != nil {
+		sm.removeQuietly(id)
+		return "", err
+	}
+
+	sm.mu.Lock()
+	sm.started[id] = time.Now()
+	sm.mu.Unlock()
+	return id, nil
+}
+
+// containerConfig locks the browser down: no host mounts, no capabilities, a
+// read-only root, bounded memory/CPU/PIDs, and either no network at all or only
+// the network that leads to the egress proxy.
+func (sm *SandboxManager) containerConfig(url string) DockerContainerConfig {
+	env := []string{
+		"NETZILLA_TARGET_URL=" + url,
+		"NETZILLA_OUTPUT_DIR=" + sandboxOutputDir,
+		fmt.Sprintf("NETZILLA_TIMEOUT_SECONDS=%d", int(sm.timeout.Seconds())),
+	}
+	networkMode := "none"
+	if sm.network != "" {
+		networkMode = sm.network
+		if sm.proxyURL != "" {
+			env = append(env,
+				"HTTP_PROXY="+sm.proxyURL, "HTTPS_PROXY="+sm.proxyURL,
+				"http_proxy="+sm.proxyURL, "https_proxy="+sm.proxyURL,
+				"NO_PROXY=", "no_proxy=",
+			)
+		}
+	}
+
+	memory := sm.memoryMB << 20
+	return DockerContainerConfig{
+		Image:   sm.dockerImage,
+		Env:     env,
+		Labels:  map[string]string{"netzilla.sandbox": "true"},
+		Volumes: map[string]struct{}{sandboxOutputDir: {}},
+		HostConfig: DockerHostConfig{
+			NetworkMode:    networkMode,
+			Memory:         memory,
+			MemorySwap:     memory,
+			NanoCpus:       int64(sm.cpus * 1e9),
+			PidsLimit:      sm.pidsLimit,
+			ReadonlyRootfs: true,
+			CapDrop:        []string{"ALL"},
+			SecurityOpt:    []string{"no-new-privileges"},
+			Tmpfs:          map[string]string{"/tmp": "rw,noexec,nosuid,size=256m"},
+		},
+	}
+}
+
+// copyArtifacts extracts the container's output directory into dir. Only regular
+// files are written, paths may not escape dir, and the totals are capped.
+func (sm *SandboxManager) copyArtifacts(ctx context.Context, id, dir string) ([]SandboxArtifact, error) {
+	archive, err := sm.docker.CopyFromContainer(ctx, id, sandboxOutputDir)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating artifact directory: %w", err)
+	}
+
+	var artifacts []SandboxArtifact
+	var total int64
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return artifacts, nil
+		}
+		if err != nil {
+			return artifacts, fmt.Errorf("reading artifact archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// Entries are rooted at "output/"; anything that is not, after cleaning,
+		// would land outside dir.
+		name, ok := strings.CutPrefix(path.Clean(hdr.Name), path.Base(sandboxOutputDir)+"/")
+		if !ok {
+			sm.logger.Warn("Skipping sandbox artifact with unsafe path %q", hdr.Name)
+			continue
+		}
+		if len(artifacts) >= sandboxMaxArtifacts || total+hdr.Size > sandboxMaxArtifactBytes {
+			return artifacts, fmt.Errorf("artifact limit reached after %d files", len(artifacts))
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+			return artifacts, fmt.Errorf("creating artifact directory: %w", err)
+		}
+		n, err := writeArtifact(dst, tr, hdr.Size)
+		if err != nil {
+			return artifacts, err
+		}
+		total += n
+		artifacts = append(artifacts, SandboxArtifact{Name: name, Path: dst, Kind: artifactKind(name), Size: n})
+	}
+}
+
+func writeArtifact(dst string, r io.Reader, size int64) (int64, error) {
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return 0, fmt.Errorf("writing artifact: %w", err)
+	}
+	n, err := io.Copy(f, io.LimitReader(r, size))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, fmt.Errorf("writing artifact: %w", err)
+	}
+	return n, nil
+}
+
+// artifactKind classifies an output file by the layout the sandbox image uses:
+// downloads/ for captured files, manifest.json, and HAR/image/HTML by extension.
+func artifactKind(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(lower, "downloads/"):
+		return ArtifactDownload
+	case lower == "manifest.json":
+		return ArtifactManifest
+	}
+	switch path.Ext(lower) {
+	case ".har":
+		return ArtifactHAR
+	case ".png", ".jpg", ".jpeg", ".webp":
+		return ArtifactScreenshot
+	case ".html", ".htm":
+		return ArtifactDOM
+	}
+	return ArtifactOther
 }
 
 func (sm *SandboxManager) startRemoteSandbox(ctx context.Context, url string) (string, error) {
-	fmt.Printf("[*] Escalating to Remote sandbox (ANY.RUN) for URL: %s\n", url)
+	sm.logger.Info("Escalating to remote sandbox (ANY.RUN) for %s", url)
 	return "REMOTE-ID-" + fmt.Sprintf("%d", time.Now().Unix()), nil
 }
 
+// DestroySandbox kills and removes a Docker sandbox together with its output volume.
 func (sm *SandboxManager) DestroySandbox(id string) error {
-	fmt.Printf("[*] Sanitizing environment: Destroying sandbox %s\n", id)
-	return nil
+	if strings.HasPrefix(id, "REMOTE-ID-") {
+		return nil
+	}
+	sm.logger.Info("Destroying sandbox %s", shortID(id))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := sm.docker.RemoveContainer(ctx, id)
+
+	sm.mu.Lock()
+	delete(sm.started, id)
+	sm.mu.Unlock()
+	return err
+}
+
+func (sm *SandboxManager) killQuietly(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sm.docker.KillContainer(ctx, id); err != nil {
+		sm.logger.Warn("Failed to kill sandbox %s: %v", shortID(id), err)
+	}
+}
+
+func (sm *SandboxManager) removeQuietly(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sm.docker.RemoveContainer(ctx, id); err != nil {
+		sm.logger.Warn("Failed to remove sandbox %s: %v", shortID(id), err)
+	}
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
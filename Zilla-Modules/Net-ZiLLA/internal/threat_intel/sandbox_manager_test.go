@@ -1,32 +1,321 @@
 package threat_intel
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"net-zilla/internal/config"
+	"net-zilla/pkg/logger"
 )
 
-func TestSandboxManager(t *testing.T) {
-	sm := NewSandboxManager()
-	
-	ctx := context.Background()
-	url := "https://example.com"
-	
-	// Default mode
-	id1, err := sm.SpinUpIsolatedBrowser(ctx, url)
+// fakeDocker implements the slice of the Engine API the sandbox uses.
+type fakeDocker struct {
+	mu        sync.Mutex
+	hasImage  bool
+	pulled    string
+	created   DockerContainerConfig
+	name      string
+	killed    bool
+	removed   bool
+	exitCode  int
+	hang      bool // /wait blocks until the request is cancelled or the container is killed
+	archive   []byte
+	killedSig chan struct{}
+}
+
+func newFakeDocker(t *testing.T, files map[string]string) *fakeDocker {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "output/", Typeflag: tar.TypeDir, Mode: 0o755})
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(body))
+	}
+	tw.WriteHeader(&tar.Header{Name: "output/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	tw.Close()
+	return &fakeDocker{archive: buf.Bytes(), killedSig: make(chan struct{})}
+}
+
+const fakeContainerID = "0123456789abcdef0123456789abcdef"
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/"+dockerAPIVersion)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(p, "/images/"):
+		if !f.hasImage {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such image"}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	case r.Method == http.MethodPost && p == "/images/create":
+		f.pulled = r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+		f.hasImage = true
+		w.Write([]byte("{\"status\":\"Pulling\"}\n{\"status\":\"Done\"}\n"))
+	case r.Method == http.MethodPost && p == "/containers/create":
+		f.name = r.URL.Query().Get("name")
+		json.NewDecoder(r.Body).Decode(&f.created)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"` + fakeContainerID + `"}`))
+	case r.Method == http.MethodPost && p == "/containers/"+fakeContainerID+"/start":
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && p == "/containers/"+fakeContainerID+"/wait":
+		if f.hang {
+			f.mu.Unlock()
+			select {
+			case <-r.Context().Done():
+			case <-f.killedSig:
+			}
+			f.mu.Lock()
+			return
+		}
+		w.Write([]byte(`{"StatusCode":` + string(rune('0'+f.exitCode)) + `}`))
+	case r.Method == http.MethodPost && p == "/containers/"+fakeContainerID+"/kill":
+		if !f.killed {
+			f.killed = true
+			close(f.killedSig)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && p == "/containers/"+fakeContainerID+"/archive":
+		if r.URL.Query().Get("path") != sandboxOutputDir {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Write(f.archive)
+	case r.Method == http.MethodDelete && p == "/containers/"+fakeContainerID:
+		if r.URL.Query().Get("force") != "true" || r.URL.Query().Get("v") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.removed = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"unexpected ` + r.Method + ` ` + p + `"}`))
+	}
+}
+
+// startFakeDocker serves f on a Unix socket and returns a manager wired to it.
+func startFakeDocker(t *testing.T, f *fakeDocker, cfg config.SandboxConfig) *SandboxManager {
+	dir, err := os.MkdirTemp("", "nzdock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "docker.sock")
+
+	ln, err := net.Listen("unix", sock)
 	if err != nil {
-		t.Errorf("default mode failed: %v", err)
+		t.Fatalf("listening on %s: %v", sock, err)
+	}
+	srv := httptest.NewUnstartedServer(f)
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	cfg.Enabled = true
+	cfg.DockerSocket = sock
+	cfg.ArtifactDir = filepath.Join(dir, "artifacts")
+	sm := NewSandboxManager(logger.New())
+	sm.Configure(cfg)
+	return sm
+}
+
+func TestSandboxManager_Run(t *testing.T) {
+	f := newFakeDocker(t, map[string]string{
+		"output/session.har":           `{"log":{"version":"1.2","entries":[]}}`,
+		"output/screenshot.png":        "\x89PNG",
+		"output/dom.html":              "<html></html>",
+		"output/manifest.json":         `{}`,
+		"output/downloads/invoice.exe": "MZ",
+		"output/../escape.txt":         "nope",
+	})
+	sm := startFakeDocker(t, f, config.SandboxConfig{
+		DockerImage: "netzilla/isolated-browser:1.2",
+		AutoDestroy: true,
+		MemoryMB:    512,
+		CPUs:        0.5,
+	})
+
+	run, err := sm.Run(context.Background(), "https://phish.example/login")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if f.pulled != "netzilla/isolated-browser:1.2" {
+		t.Errorf("pulled %q, want the configured image", f.pulled)
+	}
+	if !strings.HasPrefix(f.name, "netzilla-sandbox-") {
+		t.Errorf("container name = %q", f.name)
+	}
+
+	hc := f.created.HostConfig
+	if hc.NetworkMode != "none" {
+		t.Errorf("NetworkMode = %q, want none without a proxy network", hc.NetworkMode)
+	}
+	if hc.Memory != 512<<20 || hc.MemorySwap != hc.Memory || hc.NanoCpus != 5e8 || hc.PidsLimit != 256 {
+		t.Errorf("unexpected limits: %+v", hc)
+	}
+	if !hc.ReadonlyRootfs || len(hc.CapDrop) != 1 || hc.CapDrop[0] != "ALL" {
+		t.Errorf("container is not locked down: %+v", hc)
+	}
+	if _, ok := f.created.Volumes[sandboxOutputDir]; !ok {
+		t.Errorf("output volume missing: %+v", f.created.Volumes)
+	}
+	if !containsString(f.created.Env, "NETZILLA_TARGET_URL=https://phish.example/login") {
+		t.Errorf("target not passed: %v", f.created.Env)
+	}
+
+	kinds := make(map[string]string)
+	for _, a := range run.Artifacts {
+		kinds[a.Name] = a.Kind
+		if !strings.HasPrefix(a.Path, run.ArtifactDir) {
+			t.Errorf("artifact %s written outside %s", a.Path, run.ArtifactDir)
+		}
+	}
+	want := map[string]string{
+		"session.har":           ArtifactHAR,
+		"screenshot.png":        ArtifactScreenshot,
+		"dom.html":              ArtifactDOM,
+		"manifest.json":         ArtifactManifest,
+		"downloads/invoice.exe": ArtifactDownload,
+	}
+	if len(kinds) != len(want) {
+		t.Errorf("artifacts = %v, want %v", kinds, want)
+	}
+	for name, kind := range want {
+		if kinds[name] != kind {
+			t.Errorf("artifact %s kind = %q, want %q", name, kinds[name], kind)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(run.ArtifactDir, "downloads", "invoice.exe")); err != nil || string(data) != "MZ" {
+		t.Errorf("download not copied: %q, %v", data, err)
 	}
-	
-	// Hybrid mode
-	sm.SetMode("hybrid")
-	id2, err := sm.SpinUpIsolatedBrowser(ctx, url)
+	if _, err := os.Stat(filepath.Join(filepath.Dir(run.ArtifactDir), "escape.txt")); err == nil {
+		t.Error("archive entry escaped the artifact directory")
+	}
+
+	if run.TimedOut || f.killed {
+		t.Error("sandbox should have exited on its own")
+	}
+	if !f.removed || !run.Destroyed {
+		t.Error("auto_destroy should remove the container")
+	}
+}
+
+func TestSandboxManager_Timeout(t *testing.T) {
+	f := newFakeDocker(t, map[string]string{"output/session.har": `{}`})
+	f.hasImage = true
+	f.hang = true
+	sm := startFakeDocker(t, f, config.SandboxConfig{
+		AutoDestroy: false,
+		Network:     "netzilla-egress",
+		ProxyURL:    "http://egress-proxy:3128",
+	})
+	sm.SetTimeout(200 * time.Millisecond)
+
+	start := time.Now()
+	run, err := sm.Run(context.Background(), "https://slow.example/")
 	if err != nil {
-		t.Errorf("hybrid mode failed: %v", err)
+		t.Fatalf("Run: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout not enforced, ran %v", elapsed)
+	}
+
+	if !run.TimedOut || !f.killed {
+		t.Errorf("TimedOut = %v, killed = %v; want both", run.TimedOut, f.killed)
+	}
+	if len(run.Artifacts) != 1 {
+		t.Errorf("artifacts written before the timeout should be collected, got %d", len(run.Artifacts))
+	}
+	if f.removed || run.Destroyed {
+		t.Error("container removed although auto_destroy is off")
+	}
+
+	if f.created.HostConfig.NetworkMode != "netzilla-egress" {
+		t.Errorf("NetworkMode = %q", f.created.HostConfig.NetworkMode)
 	}
-	
-	if id1 == "" || id2 == "" {
-		t.Error("expected non-empty container IDs")
+	if !containsString(f.created.Env, "HTTPS_PROXY=http://egress-proxy:3128") {
+		t.Errorf("proxy not configured: %v", f.created.Env)
+	}
+
+	if err := sm.DestroySandbox(run.ContainerID); err != nil || !f.removed {
+		t.Errorf("DestroySandbox: %v, removed = %v", err, f.removed)
+	}
+}
+
+func TestSandboxManager_CancelledStillCollects(t *testing.T) {
+	f := newFakeDocker(t, map[string]string{"output/session.har": `{}`})
+	f.hasImage = true
+	f.hang = true
+	sm := startFakeDocker(t, f, config.SandboxConfig{AutoDestroy: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	run, err := sm.Run(ctx, "https://slow.example/")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run error = %v, want the context's", err)
+	}
+	if run == nil || !run.Cancelled || run.TimedOut || !f.killed {
+		t.Fatalf("run = %+v, killed = %v; want a cancelled, killed run", run, f.killed)
+	}
+	if len(run.Artifacts) != 1 {
+		t.Errorf("artifacts written before the cancellation should be collected, got %d", len(run.Artifacts))
+	}
+	if !f.removed || !run.Destroyed {
+		t.Error("auto_destroy should remove a cancelled container")
+	}
+}
+
+func TestSandboxManager_Unavailable(t *testing.T) {
+	sm := NewSandboxManager(logger.New())
+	sm.Configure(config.SandboxConfig{Enabled: false})
+	if _, err := sm.SpinUpIsolatedBrowser(context.Background(), "https://example.com"); err == nil {
+		t.Error("disabled sandbox should refuse to start")
+	}
+
+	sm.Configure(config.SandboxConfig{Enabled: true, DockerSocket: filepath.Join(t.TempDir(), "missing.sock")})
+	if _, err := sm.Run(context.Background(), "https://example.com"); err == nil || !strings.Contains(err.Error(), "docker unavailable") {
+		t.Errorf("expected docker unavailable error, got %v", err)
+	}
+
+	sm.SetMode("anyrun")
+	if _, err := sm.Run(context.Background(), "https://example.com"); err == nil || !strings.Contains(err.Error(), `"anyrun"`) {
+		t.Errorf("Run in a remote mode should be rejected, got %v", err)
+	}
+	id, err := sm.SpinUpIsolatedBrowser(context.Background(), "https://example.com")
+	if err != nil || id == "" {
+		t.Errorf("remote mode failed: %q, %v", id, err)
+	}
+	if err := sm.DestroySandbox(id); err != nil {
+		t.Errorf("destroying a remote sandbox: %v", err)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
 	}
-	
-	sm.DestroySandbox(id1)
+	return false
 }
@@ -2,20 +2,20 @@ package threat_intel
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 	"sync"
 	"time"
 
 	"net-zilla/internal/models"
-
-	_ "github.com/mattn/go-sqlite3"
+	"net-zilla/internal/storage"
 )
 
+// ThreatDatabase is a caching front for the indicators in a storage backend.
 type ThreatDatabase struct {
-	db      *sql.DB
+	store   storage.IndicatorRepository
+	closer  func() error // Closes the store when ThreatDatabase opened it
 	mu      sync.RWMutex
 	cache   map[string]*cacheEntry
 	metrics *DBMetrics
@@ -37,125 +37,42 @@ type DBMetrics struct {
 	mu                sync.RWMutex
 }
 
+// NewThreatDatabase opens (or creates) a standalone SQLite threat database at
+// path. Use NewThreatDatabaseWithStore to share the configured storage backend.
 func NewThreatDatabase(path string, logger *log.Logger) (*ThreatDatabase, error) {
 	if path == "" {
 		path = "netzilla_threats.db"
 	}
 
-	if logger == nil {
-		logger = log.New(log.Writer(), "[ThreatDB] ", log.LstdFlags)
-	}
-
-	db, err := sql.Open("sqlite3", path+"?_journal=WAL&_timeout=5000&_fk=1")
+	db, err := storage.NewDatabase(path + "?_journal=WAL")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open threat db: %w", err)
 	}
 
-	// Set connection limits
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	td := NewThreatDatabaseWithStore(db, logger)
+	td.closer = db.Close
+	td.logger.Printf("ThreatDatabase initialized at %s", path)
+	return td, nil
+}
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("database ping failed: %w", err)
+// NewThreatDatabaseWithStore caches lookups against an existing store. The
+// caller keeps ownership of the store; Close leaves it open.
+func NewThreatDatabaseWithStore(store storage.IndicatorRepository, logger *log.Logger) *ThreatDatabase {
+	if logger == nil {
+		logger = log.New(log.Writer(), "[ThreatDB] ", log.LstdFlags)
 	}
 
 	td := &ThreatDatabase{
-		db:      db,
+		store:   store,
 		cache:   make(map[string]*cacheEntry),
 		metrics: &DBMetrics{},
 		logger:  logger,
 	}
 
-	if err := td.initThreatSchema(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to init schema: %w", err)
-	}
-
 	// Start cache cleanup goroutine
 	go td.startCacheCleanup()
 
-	td.logger.Printf("ThreatDatabase initialized at %s", path)
-	return td, nil
-}
-
-func (td *ThreatDatabase) initThreatSchema() error {
-	queries := []string{
-		// Main threat indicators table
-		`CREATE TABLE IF NOT EXISTS threat_indicators (
-			value TEXT PRIMARY KEY,
-			type TEXT NOT NULL CHECK(type IN ('ip', 'domain', 'url', 'hash', 'email', 'asn', 'cidr')),
-			source TEXT NOT NULL,
-			confidence REAL NOT NULL CHECK(confidence >= 0 AND confidence <= 1),
-			severity TEXT NOT NULL CHECK(severity IN ('low', 'medium', 'high', 'critical')),
-			last_seen DATETIME NOT NULL,
-			first_seen DATETIME NOT NULL,
-			description TEXT,
-			tags TEXT,
-			"references" TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// Indexes for faster lookups
-		`CREATE INDEX IF NOT EXISTS idx_type ON threat_indicators(type)`,
-		`CREATE INDEX IF NOT EXISTS idx_severity ON threat_indicators(severity)`,
-		`CREATE INDEX IF NOT EXISTS idx_last_seen ON threat_indicators(last_seen)`,
-		`CREATE INDEX IF NOT EXISTS idx_confidence ON threat_indicators(confidence)`,
-
-		// Threat intelligence feed sources
-		`CREATE TABLE IF NOT EXISTS threat_feeds (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL UNIQUE,
-			url TEXT NOT NULL,
-			last_updated DATETIME,
-			update_interval INTEGER DEFAULT 3600,
-			enabled BOOLEAN DEFAULT 1,
-			api_key TEXT,
-			trust_level INTEGER DEFAULT 3 CHECK(trust_level >= 1 AND trust_level <= 5),
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// Indicator relationships
-		`CREATE TABLE IF NOT EXISTS indicator_relationships (
-			source_indicator TEXT NOT NULL,
-			related_indicator TEXT NOT NULL,
-			relationship_type TEXT NOT NULL,
-			confidence REAL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (source_indicator, related_indicator),
-			FOREIGN KEY (source_indicator) REFERENCES threat_indicators(value) ON DELETE CASCADE,
-			FOREIGN KEY (related_indicator) REFERENCES threat_indicators(value) ON DELETE CASCADE
-		)`,
-
-		// Query performance table
-		`CREATE TABLE IF NOT EXISTS query_log (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			query_value TEXT,
-			query_type TEXT,
-			found BOOLEAN,
-			response_time_ms INTEGER,
-			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-	}
-
-	tx, err := td.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	for _, query := range queries {
-		if _, err := tx.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute query: %w", err)
-		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return nil
+	return td
 }
 
 func (td *ThreatDatabase) AddIndicator(ctx context.Context, i models.Indicator) error {
@@ -179,30 +96,7 @@ func (td *ThreatDatabase) AddIndicator(ctx context.Context, i models.Indicator)
 		i.FirstSeen = i.LastSeen
 	}
 
-	// Prepare tags as JSON array
-	tagsJSON := "[]"
-	if len(i.Tags) > 0 {
-		tagsJSON = fmt.Sprintf(`["%s"]`, strings.Join(i.Tags, `","`))
-	}
-
-	query := `INSERT OR REPLACE INTO threat_indicators 
-			  (value, type, source, confidence, severity, last_seen, first_seen, description, tags, "references", updated_at)
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
-
-	_, err := td.db.ExecContext(ctx, query,
-		i.Value,
-		strings.ToLower(string(i.Type)),
-		i.Source,
-		i.Confidence,
-		i.Severity,
-		i.LastSeen,
-		i.FirstSeen,
-		i.Description,
-		tagsJSON,
-		strings.Join(i.References, ";"),
-	)
-
-	if err != nil {
+	if err := td.store.UpsertIndicator(ctx, i); err != nil {
 		return fmt.Errorf("failed to add indicator: %w", err)
 	}
 
@@ -248,19 +142,8 @@ func (td *ThreatDatabase) Lookup(ctx context.Context, value string) (*models.Ind
 	td.metrics.mu.Unlock()
 
 	// Query database
-	query := `SELECT type, source, confidence, severity, last_seen, first_seen, description, tags, "references" 
-			  FROM threat_indicators WHERE value = ?`
-
-	row := td.db.QueryRowContext(ctx, query, value)
-
-	var i models.Indicator
-	var tagsJSON, refsStr string
-	i.Value = value
-
-	err := row.Scan(&i.Type, &i.Source, &i.Confidence, &i.Severity, &i.LastSeen, &i.FirstSeen,
-		&i.Description, &tagsJSON, &refsStr)
-
-	if err == sql.ErrNoRows {
+	found, err := td.store.GetIndicator(ctx, value)
+	if errors.Is(err, storage.ErrNotFound) {
 		duration := time.Since(start)
 		td.logger.Printf("Lookup miss for %s (took %v)", value, duration)
 		return nil, nil
@@ -270,15 +153,10 @@ func (td *ThreatDatabase) Lookup(ctx context.Context, value string) (*models.Ind
 		td.logger.Printf("Lookup error for %s: %v (took %v)", value, err, duration)
 		return nil, fmt.Errorf("database lookup failed: %w", err)
 	}
-
-	// Parse tags and references
-	i.Tags = parseJSONArray(tagsJSON)
-	i.References = strings.Split(refsStr, ";")
-
 	// Update cache
 	td.mu.Lock()
 	td.cache[value] = &cacheEntry{
-		indicator: &i,
+		indicator: found,
 		timestamp: time.Now(),
 		hits:      1,
 	}
@@ -300,7 +178,7 @@ func (td *ThreatDatabase) Lookup(ctx context.Context, value string) (*models.Ind
 	}
 	td.metrics.mu.Unlock()
 
-	return &i, nil
+	return found, nil
 }
 
 func (td *ThreatDatabase) BulkLookup(ctx context.Context, values []string) (map[string]*models.Indicator, error) {
@@ -344,41 +222,16 @@ func (td *ThreatDatabase) BulkLookup(ctx context.Context, values []string) (map[
 	td.metrics.CacheMisses += int64(len(uncached))
 	td.metrics.mu.Unlock()
 
-	// Prepare batch query
-	var placeholders []string
-	var args []interface{}
-	for _, value := range uncached {
-		placeholders = append(placeholders, "?")
-		args = append(args, value)
-	}
-
-	query := fmt.Sprintf(`SELECT value, type, source, confidence, severity, last_seen, first_seen, description, tags, "references" 
-						   FROM threat_indicators WHERE value IN (%s)`, 
-						   strings.Join(placeholders, ","))
-
-	rows, err := td.db.QueryContext(ctx, query, args...)
+	found, err := td.store.GetIndicators(ctx, uncached)
 	if err != nil {
 		return nil, fmt.Errorf("bulk query failed: %w", err)
 	}
-	defer rows.Close()
 
 	td.mu.Lock()
-	for rows.Next() {
-		var i models.Indicator
-		var tagsJSON, refsStr string
-
-		err := rows.Scan(&i.Value, &i.Type, &i.Source, &i.Confidence, &i.Severity, &i.LastSeen,
-			&i.FirstSeen, &i.Description, &tagsJSON, &refsStr)
-		if err != nil {
-			continue
-		}
-
-		i.Tags = parseJSONArray(tagsJSON)
-		i.References = strings.Split(refsStr, ";")
-		
-		results[i.Value] = &i
-		td.cache[i.Value] = &cacheEntry{
-			indicator: &i,
+	for value, i := range found {
+		results[value] = i
+		td.cache[value] = &cacheEntry{
+			indicator: i,
 			timestamp: time.Now(),
 			hits:      1,
 		}
@@ -406,47 +259,10 @@ func (td *ThreatDatabase) BulkLookup(ctx context.Context, values []string) (map[
 }
 
 func (td *ThreatDatabase) GetStats(ctx context.Context) (*models.ThreatDBStats, error) {
-	stats := &models.ThreatDBStats{
-		Timestamp: time.Now(),
-	}
-
-	// Get count by type
-	typeCountQuery := `SELECT type, COUNT(*) FROM threat_indicators GROUP BY type`
-	rows, err := td.db.QueryContext(ctx, typeCountQuery)
+	stats, err := td.store.IndicatorStats(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	stats.CountByType = make(map[string]int64)
-	for rows.Next() {
-		var typ string
-		var count int64
-		rows.Scan(&typ, &count)
-		stats.CountByType[typ] = count
-		stats.TotalIndicators += count
-	}
-
-	// Get count by severity
-	severityQuery := `SELECT severity, COUNT(*) FROM threat_indicators GROUP BY severity`
-	rows2, err := td.db.QueryContext(ctx, severityQuery)
-	if err != nil {
-		return stats, nil
-	}
-	defer rows2.Close()
-
-	stats.CountBySeverity = make(map[string]int64)
-	for rows2.Next() {
-		var severity string
-		var count int64
-		rows2.Scan(&severity, &count)
-		stats.CountBySeverity[severity] = count
-	}
-
-	// Get recent activity
-	recentQuery := `SELECT COUNT(*) FROM threat_indicators WHERE last_seen > datetime('now', '-7 days')`
-	row := td.db.QueryRowContext(ctx, recentQuery)
-	row.Scan(&stats.RecentActivity7d)
 
 	// Get cache metrics
 	td.metrics.mu.RLock()
@@ -466,13 +282,10 @@ func (td *ThreatDatabase) Cleanup(ctx context.Context, olderThanDays int) (int64
 		olderThanDays = 90
 	}
 
-	query := `DELETE FROM threat_indicators WHERE last_seen < datetime('now', '-? days')`
-	result, err := td.db.ExecContext(ctx, query, olderThanDays)
+	rows, err := td.store.DeleteIndicatorsSeenBefore(ctx, time.Now().AddDate(0, 0, -olderThanDays))
 	if err != nil {
 		return 0, fmt.Errorf("cleanup failed: %w", err)
 	}
-
-	rows, _ := result.RowsAffected()
 	
 	// Clear cache after cleanup
 	td.mu.Lock()
@@ -490,7 +303,10 @@ func (td *ThreatDatabase) Close() error {
 		td.metrics.TotalQueries, td.metrics.CacheHits, td.metrics.CacheMisses, td.metrics.AverageQueryTime)
 	td.metrics.mu.RUnlock()
 	
-	return td.db.Close()
+	if td.closer == nil {
+		return nil
+	}
+	return td.closer()
 }
 
 func (td *ThreatDatabase) startCacheCleanup() {
@@ -522,15 +338,3 @@ func (td *ThreatDatabase) cleanupCache() {
 		td.logger.Printf("Cache cleanup removed %d entries", removed)
 	}
 }
-
-// Helper function to parse JSON array
-func parseJSONArray(jsonStr string) []string {
-	if jsonStr == "" || jsonStr == "[]" {
-		return []string{}
-	}
-	jsonStr = strings.Trim(jsonStr, "[]")
-	if jsonStr == "" {
-		return []string{}
-	}
-	return strings.Split(strings.ReplaceAll(jsonStr, `"`, ""), ",")
-}
@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"net-zilla/internal/models"
+	"net-zilla/internal/visualization"
+)
+
+// Formats the report viewer exports. HTML and PDF come from the report
+// generator, the others from the export formatter.
+const (
+	exportJSON  = "json"
+	exportCSV   = "csv"
+	exportSARIF = "sarif"
+	exportSTIX  = "stix"
+	exportMISP  = "misp"
+	exportHTML  = visualization.FormatHTML
+	exportPDF   = visualization.FormatPDF
+)
+
+// exportKeys maps the keys of the export prompt to formats.
+var exportKeys = map[string]string{
+	"j": exportJSON, "c": exportCSV, "s": exportSARIF, "x": exportSTIX, "m": exportMISP,
+	"h": exportHTML, "p": exportPDF,
+}
+
+// exportExtensions holds the file extensions that differ from the format name.
+var exportExtensions = map[string]string{exportSTIX: "stix.json", exportMISP: "misp.json"}
+
+// exportReport writes report to dir as <report ID>.<format>.
+func exportReport(report *models.AdvancedReport, dir, format string) (string, error) {
+	if format == exportHTML || format == exportPDF {
+		return visualization.NewReportGenerator().SaveReport(report, dir, format)
+	}
+
+	ef := visualization.NewExportFormatter()
+	var data []byte
+	var err error
+	switch format {
+	case exportJSON:
+		data, err = ef.FormatJSON(report)
+	case exportCSV:
+		data = []byte(ef.FormatCSV(report))
+	case exportSARIF:
+		data, err = ef.FormatSARIF([]*models.AdvancedReport{report})
+	case exportSTIX:
+		data, err = ef.FormatSTIX([]*models.AdvancedReport{report})
+	case exportMISP:
+		data, err = ef.FormatMISP(report)
+	default:
+		return "", fmt.Errorf("unsupported export format %q", format)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to format report: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	name := report.ReportID
+	if name == "" {
+		name = "report"
+	}
+	ext, ok := exportExtensions[format]
+	if !ok {
+		ext = format
+	}
+	path := filepath.Join(dir, name+"."+ext)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+func (m *Model) export(format string) tea.Cmd {
+	report, dir := m.report, m.exportDir
+	return func() tea.Msg {
+		path, err := exportReport(report, dir, format)
+		return exportedMsg{path: path, err: err}
+	}
+}
+
+// logTail receives the logger's output while the TUI owns the terminal and
+// keeps the latest line for the status bar.
+type logTail struct {
+	mu   sync.Mutex
+	line string
+}
+
+func newLogTail() *logTail {
+	return &logTail{}
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	lines := strings.Split(strings.TrimRight(string(p), "\n"), "\n")
+	t.mu.Lock()
+	t.line = lines[len(lines)-1]
+	t.mu.Unlock()
+	return len(p), nil
+}
+
+func (t *logTail) last() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.line
+}
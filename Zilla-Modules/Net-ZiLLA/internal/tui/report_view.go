@@ -0,0 +1,390 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+// reportTab is one tab of the report viewer.
+type reportTab struct {
+	name   string
+	render func(*models.AdvancedReport) string
+}
+
+var reportTabs = []reportTab{
+	{"Summary", renderSummary},
+	{"Redirects", renderRedirects},
+	{"DNS", renderDNS},
+	{"TLS", renderTLS},
+	{"WHOIS", renderWhois},
+	{"Patterns", renderPatterns},
+	{"Intel", renderIntel},
+}
+
+const notCollected = "Not collected for this analysis."
+
+// page accumulates the lines of a tab.
+type page struct {
+	b strings.Builder
+}
+
+func (p *page) heading(title string) {
+	if p.b.Len() > 0 {
+		p.b.WriteString("\n")
+	}
+	p.b.WriteString(headingStyle.Render(title) + "\n")
+}
+
+// field writes "label: value", skipping empty values.
+func (p *page) field(label, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(&p.b, "  %-18s %s\n", label+":", value)
+}
+
+// list writes items under label, skipping empty lists.
+func (p *page) list(label string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(&p.b, "  %s:\n", label)
+	for _, it := range items {
+		fmt.Fprintf(&p.b, "    - %s\n", it)
+	}
+}
+
+func (p *page) warnings(items []string) {
+	for _, w := range items {
+		p.b.WriteString("  " + warnStyle.Render("⚠ "+w) + "\n")
+	}
+}
+
+func (p *page) line(s string) {
+	p.b.WriteString(s + "\n")
+}
+
+func (p *page) String() string {
+	return strings.TrimRight(p.b.String(), "\n")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func renderSummary(r *models.AdvancedReport) string {
+	var p page
+	p.heading("Verdict")
+	if ra := r.RiskAssessment; ra != nil {
+		p.field("Risk", levelStyle(ra.OverallRiskLevel).Render(ra.OverallRiskLevel)+fmt.Sprintf(" (score %.2f)", ra.RiskScore))
+		p.field("Summary", ra.Summary)
+	} else {
+		p.line("  " + errorStyle.Render("No risk assessment; the analysis failed."))
+	}
+	p.field("Target", r.Target)
+	p.field("Report ID", r.ReportID)
+	if !r.Timestamp.IsZero() {
+		p.field("Analyzed", r.Timestamp.Format("2006-01-02 15:04:05"))
+	}
+	p.field("Instance", r.InstanceID)
+
+	if len(r.Findings) > 0 {
+		p.heading(fmt.Sprintf("Findings (%d)", len(r.Findings)))
+		for _, f := range r.Findings {
+			p.line("  - " + f)
+		}
+	}
+
+	if r.BasicAnalysis != nil && r.BasicAnalysis.URLEnrichment != nil {
+		en := r.BasicAnalysis.URLEnrichment
+		p.heading("URL Enrichment")
+		p.field("Entropy", fmt.Sprintf("%.2f", en.Entropy))
+		p.field("TLD risk", fmt.Sprintf("%.2f", en.TLDRisk))
+		if en.HomographAttack {
+			p.line("  " + errorStyle.Render("⚠ Homograph attack detected"))
+		}
+		p.list("Keywords", en.KeywordsFound)
+		p.list("Suspicious parameters", en.SuspiciousParams)
+	}
+
+	if len(r.Metadata) > 0 {
+		p.heading("Metadata")
+		keys := make([]string, 0, len(r.Metadata))
+		for k := range r.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p.field(k, fmt.Sprint(r.Metadata[k]))
+		}
+	}
+	return p.String()
+}
+
+func renderRedirects(r *models.AdvancedReport) string {
+	if r.BasicAnalysis == nil || len(r.BasicAnalysis.RedirectChain) == 0 {
+		if r.Sandbox != nil && r.Sandbox.FinalURL != "" {
+			var p page
+			p.heading("Sandbox navigation")
+			p.field("Start", r.Sandbox.Target)
+			p.field("Landed on", r.Sandbox.FinalURL)
+			return p.String()
+		}
+		return notCollected
+	}
+	var p page
+	p.heading(fmt.Sprintf("Redirect chain (%d hops)", len(r.BasicAnalysis.RedirectChain)))
+	for i, hop := range r.BasicAnalysis.RedirectChain {
+		n := hop.HopNumber
+		if n == 0 {
+			n = i + 1
+		}
+		p.line(fmt.Sprintf("  %2d. [%d] %s", n, hop.StatusCode, hop.URL))
+		if hop.Location != "" {
+			via := ""
+			if hop.Mechanism != "" {
+				via = fmt.Sprintf(" (%s)", hop.Mechanism)
+			}
+			p.line(fmt.Sprintf("      → %s%s", hop.Location, via))
+		}
+		if hop.IPAddress != "" {
+			p.line("      ip " + hop.IPAddress)
+		}
+		for _, w := range hop.Warnings {
+			p.line("      " + warnStyle.Render("⚠ "+w))
+		}
+	}
+	return p.String()
+}
+
+func renderDNS(r *models.AdvancedReport) string {
+	if r.BasicAnalysis == nil || r.BasicAnalysis.DNSInfo == nil {
+		return notCollected
+	}
+	d := r.BasicAnalysis.DNSInfo
+	var p page
+	p.heading("Records")
+	p.list("A", d.ARecords)
+	p.list("AAAA", d.AAAARecords)
+	p.field("CNAME", d.CNAME)
+	p.list("CNAME chain", d.CNAMERecords)
+	p.list("MX", d.MXRecords)
+	p.list("NS", append(append([]string{}, d.NSRecords...), d.NameServers...))
+	p.list("TXT", d.TXTRecords)
+	p.field("PTR", firstNonEmpty(d.PTRRecord, d.ReverseHostname))
+	p.field("PTR validation", d.PTRValidation)
+	p.field("DNSSEC", yesNo(d.DNSSECEnabled))
+	p.field("Propagation", d.PropagationStatus)
+	p.field("TTLs", d.TTLSummary)
+	p.warnings(d.Warnings)
+
+	if es := d.EmailSecurity; es != nil {
+		p.heading("Email security")
+		if es.SPF != nil {
+			p.field("SPF", es.SPF.Record)
+		}
+		if es.DMARC != nil {
+			p.field("DMARC", es.DMARC.Record)
+		}
+		p.field("Spoofability", fmt.Sprintf("%d/100", es.RiskScore))
+		p.warnings(es.Findings)
+	}
+	return p.String()
+}
+
+func renderTLS(r *models.AdvancedReport) string {
+	if r.BasicAnalysis == nil || r.BasicAnalysis.TLSInfo == nil {
+		return notCollected
+	}
+	t := r.BasicAnalysis.TLSInfo
+	var p page
+	p.heading("Certificate")
+	valid := okStyle.Render("valid")
+	if !t.CertificateValid {
+		valid = errorStyle.Render("invalid")
+	}
+	p.field("Status", valid)
+	p.field("Subject", t.Subject)
+	p.field("Issuer", t.Issuer)
+	p.field("Expires in", fmt.Sprintf("%d days", t.ExpiresInDays))
+
+	p.heading("Connection")
+	p.field("Grade", t.EncryptionGrade)
+	p.list("Protocols", t.SupportedProtocols)
+	p.list("Cipher suites", t.CipherSuites)
+	p.field("Weak ciphers", yesNo(t.HasWeakCiphers))
+	p.field("OCSP stapling", yesNo(t.OCSPStapling))
+	p.field("HSTS", yesNo(t.HSTSEnabled))
+	p.field("Server", t.ServerType)
+
+	if t.JARM != "" || t.JA3S != "" {
+		p.heading("Fingerprints")
+		p.field("JARM", t.JARM)
+		p.field("JA3S", t.JA3S)
+		for _, fm := range t.FingerprintMatches {
+			p.line("  " + warnStyle.Render(fmt.Sprintf("⚠ %s matches %s", strings.ToUpper(fm.Type), fm.Label)))
+		}
+	}
+	p.warnings(t.Warnings)
+	return p.String()
+}
+
+func renderWhois(r *models.AdvancedReport) string {
+	if r.BasicAnalysis == nil || r.BasicAnalysis.WhoisInfo == nil {
+		return notCollected
+	}
+	w := r.BasicAnalysis.WhoisInfo
+	var p page
+	p.heading("Registration")
+	p.field("Domain", w.Domain)
+	p.field("Registrar", w.Registrar)
+	p.field("Registrant", w.Registrant)
+	p.field("Created", w.CreatedDate)
+	p.field("Updated", w.UpdatedDate)
+	p.field("Expires", w.ExpiryDate)
+	age := w.DomainAge
+	if age == "" && w.DomainAgeDays > 0 {
+		age = fmt.Sprintf("%d days", w.DomainAgeDays)
+	}
+	p.field("Age", age)
+	p.list("Name servers", w.NameServers)
+	p.list("Status", w.Status)
+	p.warnings(w.Warnings)
+	return p.String()
+}
+
+func renderPatterns(r *models.AdvancedReport) string {
+	b := r.BehavioralAnalysis
+	if b == nil {
+		return notCollected
+	}
+	var p page
+	p.heading("Behavior")
+	p.field("Risk score", fmt.Sprint(b.RiskScore))
+	p.field("Severity", b.Severity)
+	p.field("Confidence", fmt.Sprintf("%.2f", b.Confidence))
+	p.field("Signature", b.RiskSignature)
+
+	p.heading(fmt.Sprintf("Patterns (%d)", len(b.Patterns)))
+	if len(b.Patterns) == 0 {
+		p.line("  No suspicious patterns matched.")
+	}
+	for _, pat := range b.Patterns {
+		p.line(fmt.Sprintf("  • %s [%s, weight %d]", pat.Name, pat.Type, pat.Weight))
+		if pat.Description != "" {
+			p.line("    " + pat.Description)
+		}
+		if pat.Match != "" {
+			p.line("    match: " + pat.Match)
+		}
+		for _, e := range pat.Evidence {
+			p.line("    - " + e)
+		}
+	}
+	p.list("Anomalies", b.Anomalies)
+	return p.String()
+}
+
+func renderIntel(r *models.AdvancedReport) string {
+	if r.ThreatIntelligence == nil && r.Reputation == nil && r.Sandbox == nil {
+		return notCollected
+	}
+	var p page
+	if ti := r.ThreatIntelligence; ti != nil {
+		p.heading(fmt.Sprintf("Threat intelligence (%d positive)", ti.TotalFound))
+		if v, ok := r.Metadata["intel_malicious"]; ok && fmt.Sprint(v) == "true" {
+			p.line("  " + errorStyle.Render("⚠ Reported malicious by intelligence sources"))
+		}
+		for _, ind := range ti.Indicators {
+			p.line(fmt.Sprintf("  • %s %s (%s, %s, confidence %.2f)", ind.Type, ind.Value, ind.Severity, ind.Source, ind.Confidence))
+			if ind.Description != "" {
+				p.line("    " + ind.Description)
+			}
+		}
+		if len(ti.Indicators) == 0 {
+			p.line("  No indicators recorded.")
+		}
+	}
+
+	if rep := r.Reputation; rep != nil {
+		p.heading("Reputation")
+		p.field("Verdict", rep.Verdict)
+		p.field("Aggregate score", fmt.Sprint(rep.AggregateScore))
+		p.field("Blacklisted", yesNo(rep.Blacklisted))
+		for _, s := range rep.Sources {
+			p.line(fmt.Sprintf("  • %-16s %-10s %d", s.Provider, s.Status, s.Score))
+		}
+	}
+
+	if sb := r.Sandbox; sb != nil {
+		p.heading("Sandbox")
+		p.field("Final URL", sb.FinalURL)
+		p.field("Title", sb.Title)
+		p.field("Requests", fmt.Sprint(len(sb.Requests)))
+		p.field("Downloads", fmt.Sprint(len(sb.Downloads)))
+		p.list("Hosts", sb.Hosts)
+		p.field("Timed out", yesNo(sb.TimedOut))
+		p.warnings(sb.Warnings)
+	}
+	return p.String()
+}
+
+// renderMessage renders the result of a message analysis.
+func renderMessage(r *models.MessageAnalysis) string {
+	if r == nil {
+		return ""
+	}
+	var p page
+	p.heading("Verdict")
+	verdict := strings.ToUpper(r.Verdict)
+	if ra := r.RiskAssessment; ra != nil {
+		verdict += fmt.Sprintf(" (%s, score %.2f)", ra.OverallRiskLevel, ra.RiskScore)
+	}
+	p.field("Verdict", levelStyle(r.Verdict).Render(verdict))
+	p.field("Kind", r.Kind)
+	p.field("Subject", r.Subject)
+
+	if s := r.Sender; s != nil && s.Address != "" {
+		p.heading("Sender")
+		p.field("Address", s.Address)
+		p.field("Display name", s.DisplayName)
+		p.field("Reply-To", s.ReplyTo)
+	}
+	if a := r.Authentication; a != nil {
+		p.heading("Authentication")
+		p.field("SPF", a.SPF)
+		p.field("DKIM", a.DKIM)
+		p.field("DMARC", a.DMARC)
+	}
+	if len(r.URLs) > 0 {
+		p.heading(fmt.Sprintf("Links (%d)", len(r.URLs)))
+		for _, u := range r.URLs {
+			status := u.Error
+			if u.Report != nil && u.Report.RiskAssessment != nil {
+				status = levelStyle(u.Report.RiskAssessment.OverallRiskLevel).Render(u.Report.RiskAssessment.OverallRiskLevel)
+			}
+			p.line(fmt.Sprintf("  • %s [%s] %s", u.URL, u.Source, status))
+		}
+	}
+	p.list("Phone numbers", r.PhoneNumbers)
+	if len(r.Findings) > 0 {
+		p.heading("Findings")
+		p.warnings(r.Findings)
+	}
+	return p.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,739 @@
+// Package tui is Net-Zilla's full-screen terminal interface: a searchable
+// history of analyses, a tabbed report viewer with export, live stage progress
+// while an analysis runs, and message (SMS / .eml) analysis.
+package tui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"net-zilla/internal/analyzer"
+	"net-zilla/internal/message"
+	"net-zilla/internal/models"
+	"net-zilla/pkg/logger"
+)
+
+// Backend is the part of the analysis service the TUI uses.
+type Backend interface {
+	PerformAnalysis(ctx context.Context, target string) (*models.AdvancedReport, error)
+	GetAnalysisHistory(ctx context.Context, limit int) ([]*models.ThreatAnalysis, error)
+	GetReport(ctx context.Context, analysisID string) (*models.AdvancedReport, error)
+	AnalyzeMessage(ctx context.Context, msg *message.Message) (*models.MessageAnalysis, error)
+}
+
+// historyLimit is how many past analyses the history list loads.
+const historyLimit = 200
+
+type screen int
+
+const (
+	screenHistory screen = iota
+	screenProgress
+	screenReport
+	screenMessage
+)
+
+// prompt is the line being edited at the bottom of the screen, if any.
+type prompt int
+
+const (
+	promptNone prompt = iota
+	promptTarget
+	promptMessage
+	promptFilter
+	promptExport
+)
+
+// Messages delivered to Update.
+type (
+	historyMsg struct {
+		items []*models.ThreatAnalysis
+		err   error
+	}
+	reportMsg struct {
+		report *models.AdvancedReport
+		err    error
+	}
+	stageMsg struct {
+		run   int
+		stage string
+		state analyzer.StageState
+	}
+	analysisDoneMsg struct {
+		run    int
+		report *models.AdvancedReport
+		err    error
+	}
+	messageDoneMsg struct {
+		run    int
+		result *models.MessageAnalysis
+		err    error
+	}
+	exportedMsg struct {
+		path string
+		err  error
+	}
+	tickMsg time.Time
+)
+
+// Model is the bubbletea model of the TUI.
+type Model struct {
+	backend   Backend
+	exportDir string
+	logs      *logTail
+
+	width, height int
+	screen        screen
+
+	history []*models.ThreatAnalysis
+	filter  string
+	cursor  int // Index into visible()
+
+	prompt prompt
+	input  string
+
+	// Running analysis. run tells the results of an abandoned analysis apart
+	// from the current one.
+	run     int
+	target  string
+	stages  map[string]analyzer.StageState
+	started time.Time
+	events  chan tea.Msg
+	cancel  context.CancelFunc
+	frame   int
+
+	report *models.AdvancedReport
+	tab    int
+	scroll int
+
+	message *models.MessageAnalysis
+
+	status string
+}
+
+// New creates the TUI model. Reports are exported to exportDir, or the
+// working directory when it is empty.
+func New(backend Backend, exportDir string) *Model {
+	if exportDir == "" {
+		exportDir = "."
+	}
+	return &Model{
+		backend:   backend,
+		exportDir: exportDir,
+		logs:      newLogTail(),
+		width:     80,
+		height:    24,
+	}
+}
+
+// Run starts the TUI on the terminal and returns when the user quits. Log
+// lines are shown in the status bar instead of being written over the screen.
+func Run(backend Backend, l *logger.Logger, exportDir string) error {
+	m := New(backend, exportDir)
+	if l != nil {
+		l.SetOutput(m.logs)
+		defer l.SetOutput(os.Stdout)
+	}
+	_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	return err
+}
+
+func (m *Model) Init() tea.Cmd {
+	return m.loadHistory()
+}
+
+func (m *Model) loadHistory() tea.Cmd {
+	return func() tea.Msg {
+		items, err := m.backend.GetAnalysisHistory(context.Background(), historyLimit)
+		return historyMsg{items: items, err: err}
+	}
+}
+
+func (m *Model) loadReport(id string) tea.Cmd {
+	return func() tea.Msg {
+		report, err := m.backend.GetReport(context.Background(), id)
+		return reportMsg{report: report, err: err}
+	}
+}
+
+// waitForEvent delivers the next progress or completion message of a running
+// analysis.
+func waitForEvent(events <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-events
+	}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(150*time.Millisecond, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+// startAnalysis runs PerformAnalysis in the background and switches to the
+// progress screen. The events channel holds every update a run can send, so
+// an abandoned run never blocks.
+func (m *Model) startAnalysis(target string) tea.Cmd {
+	m.run++
+	run := m.run
+	events := make(chan tea.Msg, 4*len(analyzer.Stages)+1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m.screen = screenProgress
+	m.target = target
+	m.stages = make(map[string]analyzer.StageState)
+	m.started = time.Now()
+	m.events = events
+	m.cancel = cancel
+	m.status = ""
+
+	go func() {
+		ctx := analyzer.WithProgress(ctx, func(stage string, state analyzer.StageState) {
+			select {
+			case events <- stageMsg{run: run, stage: stage, state: state}:
+			default:
+			}
+		})
+		report, err := m.backend.PerformAnalysis(ctx, target)
+		events <- analysisDoneMsg{run: run, report: report, err: err}
+	}()
+	return tea.Batch(waitForEvent(events), tick())
+}
+
+// startMessage analyzes input as a path to a message file or as SMS text.
+func (m *Model) startMessage(input string) tea.Cmd {
+	m.run++
+	run := m.run
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m.screen = screenProgress
+	m.target = "message"
+	m.stages = make(map[string]analyzer.StageState)
+	m.started = time.Now()
+	m.events = nil
+	m.cancel = cancel
+	m.status = ""
+
+	return tea.Batch(func() tea.Msg {
+		msg, err := parseMessageInput(input)
+		if err != nil {
+			return messageDoneMsg{run: run, err: err}
+		}
+		result, err := m.backend.AnalyzeMessage(ctx, msg)
+		return messageDoneMsg{run: run, result: result, err: err}
+	}, tick())
+}
+
+// parseMessageInput reads input as an .eml or text file when one exists at
+// that path, and as the text of an SMS otherwise.
+func parseMessageInput(input string) (*message.Message, error) {
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return message.ParseSMS(input, "")
+	}
+	if strings.EqualFold(filepath.Ext(input), ".eml") {
+		return message.ParseEmail(bytes.NewReader(data))
+	}
+	return message.ParseSMS(string(data), "")
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+
+	case historyMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("History unavailable: %v", msg.err)
+			return m, nil
+		}
+		m.history = msg.items
+		m.clampCursor()
+		return m, nil
+
+	case reportMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("Could not load report: %v", msg.err)
+			return m, nil
+		}
+		m.showReport(msg.report)
+		return m, nil
+
+	case stageMsg:
+		if msg.run != m.run || m.screen != screenProgress {
+			return m, nil
+		}
+		m.stages[msg.stage] = msg.state
+		return m, waitForEvent(m.events)
+
+	case analysisDoneMsg:
+		if msg.run != m.run || m.screen != screenProgress {
+			return m, nil
+		}
+		m.cancel()
+		if msg.err != nil {
+			m.screen = screenHistory
+			m.status = fmt.Sprintf("Analysis of %s failed: %v", m.target, msg.err)
+			return m, nil
+		}
+		m.showReport(msg.report)
+		return m, m.loadHistory()
+
+	case messageDoneMsg:
+		if msg.run != m.run || m.screen != screenProgress {
+			return m, nil
+		}
+		m.cancel()
+		if msg.err != nil {
+			m.screen = screenHistory
+			m.status = fmt.Sprintf("Message analysis failed: %v", msg.err)
+			return m, nil
+		}
+		m.message = msg.result
+		m.screen = screenMessage
+		m.scroll = 0
+		return m, nil
+
+	case exportedMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("Export failed: %v", msg.err)
+		} else {
+			m.status = "Exported to " + msg.path
+		}
+		return m, nil
+
+	case tickMsg:
+		if m.screen != screenProgress {
+			return m, nil
+		}
+		m.frame++
+		return m, tick()
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m *Model) showReport(report *models.AdvancedReport) {
+	m.report = report
+	m.screen = screenReport
+	m.tab = 0
+	m.scroll = 0
+}
+
+func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.Type == tea.KeyCtrlC {
+		return m, tea.Quit
+	}
+	if m.prompt != promptNone {
+		return m.handlePromptKey(msg)
+	}
+
+	switch m.screen {
+	case screenHistory:
+		return m.handleHistoryKey(msg)
+	case screenProgress:
+		if msg.Type == tea.KeyEsc {
+			m.cancel()
+			m.run++ // Ignore whatever the abandoned analysis still sends
+			m.screen = screenHistory
+			m.status = "Analysis cancelled"
+		}
+		return m, nil
+	case screenReport:
+		return m.handleReportKey(msg)
+	case screenMessage:
+		switch msg.String() {
+		case "esc", "q":
+			m.screen = screenHistory
+		default:
+			m.handleScroll(msg)
+		}
+	}
+	return m, nil
+}
+
+func (m *Model) openPrompt(p prompt, initial string) {
+	m.prompt = p
+	m.input = initial
+}
+
+func (m *Model) handlePromptKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.prompt
+	if p == promptExport {
+		m.prompt = promptNone
+		if format, ok := exportKeys[msg.String()]; ok {
+			return m, m.export(format)
+		}
+		return m, nil
+	}
+
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.prompt = promptNone
+		if p == promptFilter {
+			m.filter = ""
+			m.clampCursor()
+		}
+		return m, nil
+	case tea.KeyEnter:
+		m.prompt = promptNone
+		value := strings.TrimSpace(m.input)
+		switch p {
+		case promptTarget:
+			if value != "" {
+				return m, m.startAnalysis(value)
+			}
+		case promptMessage:
+			if value != "" {
+				return m, m.startMessage(value)
+			}
+		}
+		return m, nil
+	case tea.KeyBackspace:
+		if r := []rune(m.input); len(r) > 0 {
+			m.input = string(r[:len(r)-1])
+		}
+	case tea.KeyCtrlU:
+		m.input = ""
+	case tea.KeyRunes, tea.KeySpace:
+		m.input += string(msg.Runes)
+	default:
+		return m, nil
+	}
+	// The history filter follows the input as it is typed
+	if p == promptFilter {
+		m.filter = m.input
+		m.clampCursor()
+	}
+	return m, nil
+}
+
+func (m *Model) handleHistoryKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	visible := m.visible()
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(visible)-1 {
+			m.cursor++
+		}
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(visible) - 1
+		m.clampCursor()
+	case "enter":
+		if len(visible) > 0 {
+			m.status = ""
+			return m, m.loadReport(visible[m.cursor].AnalysisID)
+		}
+	case "/":
+		m.openPrompt(promptFilter, m.filter)
+	case "esc":
+		m.filter = ""
+		m.clampCursor()
+	case "a", "n":
+		m.openPrompt(promptTarget, "")
+	case "m":
+		m.openPrompt(promptMessage, "")
+	case "r":
+		m.status = ""
+		return m, m.loadHistory()
+	}
+	return m, nil
+}
+
+func (m *Model) handleReportKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch key := msg.String(); key {
+	case "esc", "q":
+		m.screen = screenHistory
+		m.status = ""
+	case "tab", "right", "l":
+		m.tab = (m.tab + 1) % len(reportTabs)
+		m.scroll = 0
+	case "shift+tab", "left", "h":
+		m.tab = (m.tab + len(reportTabs) - 1) % len(reportTabs)
+		m.scroll = 0
+	case "1", "2", "3", "4", "5", "6", "7":
+		m.tab = int(key[0] - '1')
+		m.scroll = 0
+	case "e":
+		m.openPrompt(promptExport, "")
+	default:
+		m.handleScroll(msg)
+	}
+	return m, nil
+}
+
+func (m *Model) handleScroll(msg tea.KeyMsg) {
+	switch msg.String() {
+	case "up", "k":
+		if m.scroll > 0 {
+			m.scroll--
+		}
+	case "down", "j":
+		m.scroll++
+	case "pgup":
+		m.scroll -= m.bodyHeight()
+		if m.scroll < 0 {
+			m.scroll = 0
+		}
+	case "pgdown", " ":
+		m.scroll += m.bodyHeight()
+	case "home", "g":
+		m.scroll = 0
+	}
+}
+
+// visible returns the history entries matching the filter. Every
+// space-separated term must appear in the URL, threat level or ID.
+func (m *Model) visible() []*models.ThreatAnalysis {
+	terms := strings.Fields(strings.ToLower(m.filter))
+	if len(terms) == 0 {
+		return m.history
+	}
+	var out []*models.ThreatAnalysis
+	for _, h := range m.history {
+		text := strings.ToLower(h.URL + " " + string(h.ThreatLevel) + " " + h.AnalysisID)
+		match := true
+		for _, t := range terms {
+			if !strings.Contains(text, t) {
+				match = false
+				break
+			}
+		}
+		if match {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func (m *Model) clampCursor() {
+	if n := len(m.visible()); m.cursor >= n {
+		m.cursor = n - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+// ============ RENDERING ============
+
+var (
+	titleStyle     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("208"))
+	dimStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
+	headingStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("37"))
+	selectedStyle  = lipgloss.NewStyle().Bold(true).Reverse(true)
+	activeTabStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("0")).Background(lipgloss.Color("208")).Padding(0, 1)
+	tabStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("250")).Padding(0, 1)
+	warnStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+	errorStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	okStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+)
+
+// levelStyle colors a risk or threat level.
+func levelStyle(level string) lipgloss.Style {
+	level = strings.ToUpper(level)
+	switch {
+	case strings.Contains(level, "CRITICAL"), strings.Contains(level, "HIGH"), strings.Contains(level, "MALICIOUS"):
+		return errorStyle.Bold(true)
+	case strings.Contains(level, "MEDIUM"), strings.Contains(level, "SUSPICIOUS"):
+		return warnStyle.Bold(true)
+	default:
+		return okStyle.Bold(true)
+	}
+}
+
+// bodyHeight is the number of lines between the header and the footer.
+func (m *Model) bodyHeight() int {
+	if h := m.height - 4; h > 1 {
+		return h
+	}
+	return 1
+}
+
+func (m *Model) View() string {
+	var body []string
+	switch m.screen {
+	case screenHistory:
+		body = m.historyView()
+	case screenProgress:
+		body = m.progressView()
+	case screenReport:
+		body = m.reportView()
+	case screenMessage:
+		body = m.scrolled(strings.Split(renderMessage(m.message), "\n"), m.bodyHeight())
+	}
+
+	lines := []string{m.headerView(), ""}
+	lines = append(lines, fit(body, m.bodyHeight())...)
+	lines = append(lines, m.statusView(), m.helpView())
+	for i, l := range lines {
+		lines[i] = lipgloss.NewStyle().MaxWidth(m.width).Render(l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *Model) headerView() string {
+	title := titleStyle.Render("🦖 NET-ZiLLA")
+	switch m.screen {
+	case screenHistory:
+		return title + dimStyle.Render(fmt.Sprintf("  history · %d of %d analyses", len(m.visible()), len(m.history)))
+	case screenProgress:
+		return title + dimStyle.Render("  analyzing "+m.target)
+	case screenReport:
+		return title + dimStyle.Render("  report "+m.report.ReportID)
+	default:
+		return title + dimStyle.Render("  message analysis")
+	}
+}
+
+func (m *Model) historyView() []string {
+	visible := m.visible()
+	if len(visible) == 0 {
+		if m.filter != "" {
+			return []string{dimStyle.Render(fmt.Sprintf("No analyses match %q.", m.filter))}
+		}
+		return []string{dimStyle.Render("No analyses yet. Press a to analyze a URL or IP.")}
+	}
+
+	height := m.bodyHeight()
+	start := 0
+	if m.cursor >= height {
+		start = m.cursor - height + 1
+	}
+	var lines []string
+	for i := start; i < len(visible) && i < start+height; i++ {
+		h := visible[i]
+		line := fmt.Sprintf("%s  %-14s %4d  %s", h.AnalyzedAt.Format("2006-01-02 15:04"), h.ThreatLevel, h.ThreatScore, h.URL)
+		if i == m.cursor {
+			line = selectedStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+var spinnerFrames = []string{"◐", "◓", "◑", "◒"}
+
+func (m *Model) progressView() []string {
+	lines := []string{fmt.Sprintf("Target:  %s", m.target), fmt.Sprintf("Elapsed: %s", time.Since(m.started).Round(100*time.Millisecond)), ""}
+	if m.events == nil {
+		return append(lines, spinnerFrames[m.frame%len(spinnerFrames)]+" analyzing message and its links...")
+	}
+	for _, stage := range analyzer.Stages {
+		var icon string
+		switch m.stages[stage] {
+		case analyzer.StageRunning:
+			icon = warnStyle.Render(spinnerFrames[m.frame%len(spinnerFrames)])
+		case analyzer.StageDone:
+			icon = okStyle.Render("✔")
+		case analyzer.StageSkipped:
+			icon = dimStyle.Render("↷")
+		case analyzer.StageDeferred:
+			icon = warnStyle.Render("…")
+		case analyzer.StageFailed:
+			icon = errorStyle.Render("✘")
+		default:
+			icon = dimStyle.Render("·")
+		}
+		state := string(m.stages[stage])
+		if state == "" {
+			state = "pending"
+		}
+		lines = append(lines, fmt.Sprintf("  %s %-12s %s", icon, stage, dimStyle.Render(state)))
+	}
+	return lines
+}
+
+func (m *Model) reportView() []string {
+	tabs := make([]string, len(reportTabs))
+	for i, t := range reportTabs {
+		label := fmt.Sprintf("%d %s", i+1, t.name)
+		if i == m.tab {
+			tabs[i] = activeTabStyle.Render(label)
+		} else {
+			tabs[i] = tabStyle.Render(label)
+		}
+	}
+	content := strings.Split(reportTabs[m.tab].render(m.report), "\n")
+	return append([]string{strings.Join(tabs, ""), ""}, m.scrolled(content, m.bodyHeight()-2)...)
+}
+
+// scrolled returns the window of lines starting at the scroll offset, which
+// it first clamps to the content.
+func (m *Model) scrolled(lines []string, height int) []string {
+	if last := len(lines) - height; m.scroll > last {
+		m.scroll = last
+	}
+	if m.scroll < 0 {
+		m.scroll = 0
+	}
+	return lines[m.scroll:]
+}
+
+func (m *Model) statusView() string {
+	switch m.prompt {
+	case promptTarget:
+		return "🔗 Target URL/IP: " + m.input + "█"
+	case promptMessage:
+		return "📨 Path to .eml file, or SMS text: " + m.input + "█"
+	case promptFilter:
+		return "/" + m.input + "█"
+	case promptExport:
+		return fmt.Sprintf("Export to %s as: [h]tml [p]df [j]son [c]sv [s]arif st[x] [m]isp", m.exportDir)
+	}
+	if m.status != "" {
+		return warnStyle.Render(m.status)
+	}
+	return dimStyle.Render(m.logs.last())
+}
+
+func (m *Model) helpView() string {
+	var help string
+	switch {
+	case m.prompt == promptFilter:
+		help = "enter keep filter · esc clear"
+	case m.prompt == promptExport:
+		help = "any other key cancels"
+	case m.prompt != promptNone:
+		help = "enter submit · esc cancel"
+	case m.screen == screenHistory:
+		help = "↑/↓ move · enter open · / search · a analyze · m message · r reload · q quit"
+	case m.screen == screenProgress:
+		help = "esc cancel"
+	case m.screen == screenReport:
+		help = "←/→ tab · 1-7 jump · ↑/↓ scroll · e export · esc back"
+	default:
+		help = "↑/↓ scroll · esc back"
+	}
+	return dimStyle.Render(help)
+}
+
+// fit pads or truncates lines to exactly height lines.
+func fit(lines []string, height int) []string {
+	if len(lines) > height {
+		return lines[:height]
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return lines
+}
@@ -0,0 +1,363 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"net-zilla/internal/analyzer"
+	"net-zilla/internal/message"
+	"net-zilla/internal/models"
+)
+
+// fakeBackend reports every stage of a fake pipeline and returns canned data.
+type fakeBackend struct {
+	history []*models.ThreatAnalysis
+	reports map[string]*models.AdvancedReport
+}
+
+func (f *fakeBackend) PerformAnalysis(ctx context.Context, target string) (*models.AdvancedReport, error) {
+	for _, stage := range analyzer.Stages {
+		analyzer.ReportProgress(ctx, stage, analyzer.StageRunning)
+		analyzer.ReportProgress(ctx, stage, analyzer.StageDone)
+	}
+	if target == "fail" {
+		return nil, fmt.Errorf("boom")
+	}
+	return testReport(target), nil
+}
+
+func (f *fakeBackend) GetAnalysisHistory(ctx context.Context, limit int) ([]*models.ThreatAnalysis, error) {
+	return f.history, nil
+}
+
+func (f *fakeBackend) GetReport(ctx context.Context, id string) (*models.AdvancedReport, error) {
+	if r, ok := f.reports[id]; ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+func (f *fakeBackend) AnalyzeMessage(ctx context.Context, msg *message.Message) (*models.MessageAnalysis, error) {
+	return &models.MessageAnalysis{Kind: msg.Kind, Verdict: "suspicious"}, nil
+}
+
+func testReport(target string) *models.AdvancedReport {
+	return &models.AdvancedReport{
+		ReportID:       "NZ-1",
+		Target:         target,
+		RiskAssessment: &models.RiskAssessment{OverallRiskLevel: "HIGH", RiskScore: 0.8},
+		Findings:       []string{"Suspicious TLD"},
+		BasicAnalysis: &models.ThreatAnalysis{
+			DNSInfo: &models.DNSAnalysis{ARecords: []string{"203.0.113.7"}},
+		},
+	}
+}
+
+func testHistory() []*models.ThreatAnalysis {
+	return []*models.ThreatAnalysis{
+		{AnalysisID: "NZ-1", URL: "http://login-paypal.example", ThreatLevel: "HIGH", AnalyzedAt: time.Now()},
+		{AnalysisID: "NZ-2", URL: "https://example.org", ThreatLevel: "LOW", AnalyzedAt: time.Now()},
+		{AnalysisID: "NZ-3", URL: "http://paypal.example", ThreatLevel: "LOW", AnalyzedAt: time.Now()},
+	}
+}
+
+func key(s string) tea.KeyMsg {
+	switch s {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case "tab":
+		return tea.KeyMsg{Type: tea.KeyTab}
+	case "shift+tab":
+		return tea.KeyMsg{Type: tea.KeyShiftTab}
+	case "backspace":
+		return tea.KeyMsg{Type: tea.KeyBackspace}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func typeText(m *Model, s string) {
+	for _, r := range s {
+		m.Update(key(string(r)))
+	}
+}
+
+func TestModel_Filter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   []string
+	}{
+		{"Empty", "", []string{"NZ-1", "NZ-2", "NZ-3"}},
+		{"URL", "paypal", []string{"NZ-1", "NZ-3"}},
+		{"Every term must match", "paypal low", []string{"NZ-3"}},
+		{"Case insensitive", "HIGH", []string{"NZ-1"}},
+		{"ID", "nz-2", []string{"NZ-2"}},
+		{"No match", "nothing", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(&fakeBackend{}, "")
+			m.history = testHistory()
+			m.filter = tt.filter
+
+			var got []string
+			for _, h := range m.visible() {
+				got = append(got, h.AnalysisID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("visible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModel_SearchKeys(t *testing.T) {
+	m := New(&fakeBackend{}, "")
+	m.Update(historyMsg{items: testHistory()})
+	m.Update(key("j"))
+	m.Update(key("j"))
+	if m.cursor != 2 {
+		t.Fatalf("cursor = %d, want 2", m.cursor)
+	}
+
+	m.Update(key("/"))
+	if m.prompt != promptFilter {
+		t.Fatal("/ did not open the search prompt")
+	}
+	typeText(m, "high")
+	if len(m.visible()) != 1 || m.cursor != 0 {
+		t.Errorf("filter while typing: %d visible, cursor %d", len(m.visible()), m.cursor)
+	}
+	m.Update(key("enter"))
+	if m.prompt != promptNone || m.filter != "high" {
+		t.Errorf("enter should keep the filter, got prompt %d filter %q", m.prompt, m.filter)
+	}
+
+	m.Update(key("/"))
+	m.Update(key("backspace"))
+	if m.filter != "hig" {
+		t.Errorf("filter after backspace = %q", m.filter)
+	}
+	m.Update(key("esc"))
+	if m.filter != "" || len(m.visible()) != 3 {
+		t.Errorf("esc should clear the filter, got %q", m.filter)
+	}
+}
+
+func TestModel_OpenReportAndTabs(t *testing.T) {
+	backend := &fakeBackend{history: testHistory(), reports: map[string]*models.AdvancedReport{"NZ-1": testReport("http://login-paypal.example")}}
+	m := New(backend, "")
+	m.Update(historyMsg{items: backend.history})
+
+	_, cmd := m.Update(key("enter"))
+	if cmd == nil {
+		t.Fatal("enter should load the selected report")
+	}
+	m.Update(cmd())
+	if m.screen != screenReport || m.report.ReportID != "NZ-1" {
+		t.Fatalf("screen = %d, report = %v", m.screen, m.report)
+	}
+
+	m.Update(key("tab"))
+	if m.tab != 1 {
+		t.Errorf("tab after tab = %d, want 1", m.tab)
+	}
+	m.Update(key("shift+tab"))
+	m.Update(key("shift+tab"))
+	if m.tab != len(reportTabs)-1 {
+		t.Errorf("shift+tab should wrap to the last tab, got %d", m.tab)
+	}
+	m.Update(key("3"))
+	if reportTabs[m.tab].name != "DNS" {
+		t.Errorf("3 selected %s, want DNS", reportTabs[m.tab].name)
+	}
+	if view := m.View(); !strings.Contains(view, "203.0.113.7") {
+		t.Errorf("DNS tab does not show the A record:\n%s", view)
+	}
+
+	m.Update(key("esc"))
+	if m.screen != screenHistory {
+		t.Errorf("esc should return to the history, screen = %d", m.screen)
+	}
+}
+
+func TestReportTabs_NotCollected(t *testing.T) {
+	// Reports from the orchestrator alone carry no DNS, TLS, WHOIS or redirects
+	r := &models.AdvancedReport{ReportID: "NZ-1", Target: "http://example.com"}
+	for _, tab := range reportTabs[1:] {
+		if got := tab.render(r); got != notCollected {
+			t.Errorf("%s tab = %q, want %q", tab.name, got, notCollected)
+		}
+	}
+	if got := renderSummary(r); !strings.Contains(got, "analysis failed") {
+		t.Errorf("summary of a report without assessment = %q", got)
+	}
+}
+
+func TestModel_LiveProgress(t *testing.T) {
+	m := New(&fakeBackend{}, "")
+	m.Update(key("a"))
+	typeText(m, "http://example.com")
+	if _, cmd := m.Update(key("enter")); cmd == nil {
+		t.Fatal("enter should start the analysis")
+	}
+	if m.screen != screenProgress {
+		t.Fatalf("screen = %d, want progress", m.screen)
+	}
+
+	// Deliver the events the way waitForEvent does
+	var sawRunning bool
+	for m.screen == screenProgress {
+		msg := <-m.events
+		if s, ok := msg.(stageMsg); ok && s.state == analyzer.StageRunning {
+			sawRunning = true
+		}
+		m.Update(msg)
+	}
+	if !sawRunning {
+		t.Error("no stage reported running")
+	}
+	for _, stage := range analyzer.Stages {
+		if m.stages[stage] != analyzer.StageDone {
+			t.Errorf("stage %s = %q, want done", stage, m.stages[stage])
+		}
+	}
+	if m.screen != screenReport || m.report.Target != "http://example.com" {
+		t.Errorf("finished analysis should open its report, screen = %d", m.screen)
+	}
+}
+
+func TestModel_StaleResultsIgnored(t *testing.T) {
+	m := New(&fakeBackend{}, "")
+	m.startAnalysis("fail")
+	m.Update(key("esc"))
+	if m.screen != screenHistory {
+		t.Fatalf("esc should cancel the analysis, screen = %d", m.screen)
+	}
+
+	m.Update(analysisDoneMsg{run: m.run - 1, report: testReport("late")})
+	if m.screen != screenHistory || m.report != nil {
+		t.Error("result of a cancelled analysis was shown")
+	}
+}
+
+func TestModel_AnalysisError(t *testing.T) {
+	m := New(&fakeBackend{}, "")
+	m.startAnalysis("fail")
+	for m.screen == screenProgress {
+		m.Update(<-m.events)
+	}
+	if m.screen != screenHistory || !strings.Contains(m.status, "boom") {
+		t.Errorf("screen = %d, status = %q", m.screen, m.status)
+	}
+}
+
+func TestModel_Export(t *testing.T) {
+	dir := t.TempDir()
+	m := New(&fakeBackend{}, dir)
+	m.showReport(testReport("http://example.com"))
+
+	tests := []struct {
+		key  string
+		file string
+		want string
+	}{
+		{"j", "NZ-1.json", `"report_id": "NZ-1"`},
+		{"c", "NZ-1.csv", "NZ-1,http://example.com,URL,http://example.com,target"},
+		{"x", "NZ-1.stix.json", `"type": "bundle"`},
+		{"m", "NZ-1.misp.json", `"Event"`},
+		{"s", "NZ-1.sarif", `"version": "2.1.0"`},
+		{"h", "NZ-1.html", "<!DOCTYPE html>"},
+		{"p", "NZ-1.pdf", "%PDF-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			m.Update(key("e"))
+			_, cmd := m.Update(key(tt.key))
+			if cmd == nil {
+				t.Fatal("no export command")
+			}
+			m.Update(cmd())
+			path := filepath.Join(dir, tt.file)
+			if m.status != "Exported to "+path {
+				t.Errorf("status = %q", m.status)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("%s does not contain %q:\n%s", tt.file, tt.want, data)
+			}
+		})
+	}
+
+	// Any other key cancels
+	m.Update(key("e"))
+	if _, cmd := m.Update(key("q")); cmd != nil || m.prompt != promptNone {
+		t.Error("q should cancel the export prompt")
+	}
+}
+
+func TestModel_MessageAnalysis(t *testing.T) {
+	m := New(&fakeBackend{}, "")
+	m.Update(key("m"))
+	typeText(m, "Your parcel is held: http://parcel.example/pay")
+	_, cmd := m.Update(key("enter"))
+	if cmd == nil || m.screen != screenProgress {
+		t.Fatal("enter should start the message analysis")
+	}
+
+	m.Update(messageDoneMsg{run: m.run, result: &models.MessageAnalysis{Kind: "sms", Verdict: "suspicious"}})
+	if m.screen != screenMessage {
+		t.Fatalf("screen = %d, want message", m.screen)
+	}
+	if view := m.View(); !strings.Contains(view, "SUSPICIOUS") {
+		t.Errorf("message view does not show the verdict:\n%s", view)
+	}
+}
+
+func TestParseMessageInput(t *testing.T) {
+	dir := t.TempDir()
+	eml := filepath.Join(dir, "mail.eml")
+	os.WriteFile(eml, []byte("From: a@example.com\r\nSubject: hi\r\n\r\nSee http://bad.example/x\r\n"), 0o644)
+
+	tests := []struct {
+		name  string
+		input string
+		kind  string
+	}{
+		{"SMS text", "Click http://bad.example/x now", "sms"},
+		{"Email file", eml, "email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parseMessageInput(tt.input)
+			if err != nil {
+				t.Fatalf("parseMessageInput: %v", err)
+			}
+			if msg.Kind != tt.kind || len(msg.URLs) != 1 {
+				t.Errorf("kind = %s, %d URLs", msg.Kind, len(msg.URLs))
+			}
+		})
+	}
+}
+
+func TestLogTail(t *testing.T) {
+	tail := newLogTail()
+	fmt.Fprintln(tail, "[10:00:00] INFO first")
+	fmt.Fprint(tail, "[10:00:01] INFO second\n[10:00:02] WARN third\n")
+	if got := tail.last(); got != "[10:00:02] WARN third" {
+		t.Errorf("last() = %q", got)
+	}
+}
@@ -2,11 +2,14 @@ package utils
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"net-zilla/internal/message"
 	"net-zilla/internal/services"
 	"net-zilla/pkg/logger"
 )
@@ -44,13 +47,15 @@ func NewMenu(service *services.AnalysisService, l *logger.Logger) *Menu {
 func (m *Menu) Run() error {
 	for m.running {
 		DisplayBanner()
-		fmt.Printf("\n1. 🔍 Secure Analysis\n2. 📜 History\n0. Exit\n\nOption: ")
+		fmt.Printf("\n1. 🔍 Secure Analysis\n2. 📜 History\n3. ✉️  Message Analysis (SMS / .eml)\n0. Exit\n\nOption: ")
 		choice, _ := m.readInput()
 		switch choice {
 		case "1":
 			m.performAnalysis()
 		case "2":
 			m.showHistory()
+		case "3":
+			m.analyzeMessage()
 		case "0":
 			m.running = false
 		}
@@ -93,6 +98,82 @@ func (m *Menu) performAnalysis() {
 	}
 }
 
+func (m *Menu) analyzeMessage() {
+	fmt.Print("📨 Path to .eml file, or SMS text: ")
+	input, _ := m.readInput()
+	if input == "" {
+		return
+	}
+
+	var msg *message.Message
+	var err error
+	if data, readErr := os.ReadFile(input); readErr == nil {
+		if strings.EqualFold(filepath.Ext(input), ".eml") {
+			msg, err = message.ParseEmail(bytes.NewReader(data))
+		} else {
+			msg, err = message.ParseSMS(string(data), "")
+		}
+	} else {
+		fmt.Print("📱 Sender number/ID (optional): ")
+		sender, _ := m.readInput()
+		msg, err = message.ParseSMS(input, sender)
+	}
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\n%s[*] Analyzing %s with %d link(s)...%s\n", ColorCyan, msg.Kind, len(msg.URLs), ColorReset)
+	result, err := m.service.AnalyzeMessage(context.Background(), msg)
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		return
+	}
+
+	color := ColorGreen
+	switch result.Verdict {
+	case "malicious":
+		color = ColorRed
+	case "suspicious":
+		color = ColorYellow
+	}
+	fmt.Printf("\n%s%sVERDICT: %s (%s, Score: %.2f)%s\n", ColorBold, color, strings.ToUpper(result.Verdict),
+		result.RiskAssessment.OverallRiskLevel, result.RiskAssessment.RiskScore, ColorReset)
+
+	if s := result.Sender; s != nil && s.Address != "" {
+		fmt.Printf("\n%s👤 Sender:%s %s", ColorCyan, ColorReset, s.Address)
+		if s.DisplayName != "" {
+			fmt.Printf(" (%s)", s.DisplayName)
+		}
+		fmt.Println()
+		if s.ReplyTo != "" {
+			fmt.Printf(" - Reply-To: %s\n", s.ReplyTo)
+		}
+	}
+	if a := result.Authentication; a != nil {
+		fmt.Printf("%s🔐 Authentication:%s SPF=%s DKIM=%s DMARC=%s\n", ColorCyan, ColorReset, a.SPF, a.DKIM, a.DMARC)
+		if v := a.Verification; v != nil && a.Source != "verified" {
+			fmt.Printf(" - Verified against DNS: SPF=%s DMARC=%s (%d DKIM signatures)\n", v.SPF, v.DMARC, len(v.DKIM))
+		}
+	}
+	if len(result.URLs) > 0 {
+		fmt.Printf("\n%s🔗 Links:%s\n", ColorCyan, ColorReset)
+		for _, u := range result.URLs {
+			status := u.Error
+			if u.Report != nil {
+				status = u.Report.RiskAssessment.OverallRiskLevel
+			}
+			fmt.Printf(" - %-50s [%s] %s\n", u.URL, u.Source, status)
+		}
+	}
+	if len(result.PhoneNumbers) > 0 {
+		fmt.Printf("%s📞 Phone numbers:%s %s\n", ColorCyan, ColorReset, strings.Join(result.PhoneNumbers, ", "))
+	}
+	for _, f := range result.Findings {
+		fmt.Printf(" - %s⚠️  %s%s\n", ColorYellow, f, ColorReset)
+	}
+}
+
 func (m *Menu) showHistory() {
 	history, _ := m.service.GetAnalysisHistory(context.Background(), 10)
 	for _, h := range history {
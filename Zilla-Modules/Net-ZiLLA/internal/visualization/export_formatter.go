@@ -1,9 +1,17 @@
 package visualization
 
 import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net-zilla/internal/models"
+	"net/url"
+	"path"
+	"strings"
+	"time"
 )
 
 // ExportFormatter handles data serialization into different formats.
@@ -18,12 +26,296 @@ func (ef *ExportFormatter) FormatJSON(report *models.AdvancedReport) ([]byte, er
 	return json.MarshalIndent(report, "", "  ")
 }
 
-// FormatCSV creates a simple CSV representation of basic indicators.
+// csvColumns heads the indicator CSV.
+var csvColumns = []string{
+	"report_id", "target", "type", "value", "source", "severity", "confidence",
+	"first_seen", "last_seen", "description", "tags", "references",
+}
+
+// FormatCSV lists every indicator in the report, one per row; see
+// reportIndicators for what is included.
 func (ef *ExportFormatter) FormatCSV(report *models.AdvancedReport) string {
-	header := "Indicator,Value,Type\n"
-	row := fmt.Sprintf("Target,%s,URL\n", report.Target)
-	if report.BasicAnalysis != nil && report.BasicAnalysis.GeoAnalysis != nil {
-		row += fmt.Sprintf("IP,%s,Network\n", report.BasicAnalysis.GeoAnalysis.IP)
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(csvColumns)
+	for _, ind := range reportIndicators(report) {
+		w.Write([]string{
+			report.ReportID, report.Target, string(ind.Type), ind.Value, ind.Source, ind.Severity,
+			fmt.Sprintf("%.2f", ind.Confidence), csvTime(ind.FirstSeen), csvTime(ind.LastSeen),
+			ind.Description, strings.Join(ind.Tags, ";"), strings.Join(ind.References, ";"),
+		})
+	}
+	w.Flush()
+	return b.String()
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// reportIndicators lists every indicator a report carries: the intelligence
+// and sandbox IOCs first, then the target and its host, the redirect hops and
+// the addresses the analysis resolved. Each type and value appears once, and
+// the indicators derived from the analysis itself are dated by the report.
+func reportIndicators(r *models.AdvancedReport) []models.Indicator {
+	out := collectIOCs(r)
+	seen := make(map[string]bool)
+	for _, ind := range out {
+		seen[string(ind.Type)+"|"+ind.Value] = true
+	}
+	add := func(ind models.Indicator) {
+		key := string(ind.Type) + "|" + ind.Value
+		if ind.Value == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		ind.FirstSeen, ind.LastSeen = r.Timestamp, r.Timestamp
+		out = append(out, ind)
+	}
+	addHost := func(rawURL, source, description string) {
+		host := urlHost(rawURL)
+		if host == "" {
+			return
+		}
+		typ := models.IOCTypeDomain
+		if net.ParseIP(host) != nil {
+			typ = models.IOCTypeIP
+		}
+		add(models.Indicator{Type: typ, Value: host, Source: source, Description: description})
+	}
+
+	target := models.Indicator{Type: models.IOCTypeURL, Value: r.Target, Source: "target", Description: "Analyzed target"}
+	if ra := r.RiskAssessment; ra != nil {
+		target.Severity = strings.ToLower(ra.OverallRiskLevel)
+		target.Confidence = ra.RiskScore
+	}
+	add(target)
+	addHost(r.Target, "target", "Host of the analyzed target")
+
+	b := r.BasicAnalysis
+	if b == nil {
+		return out
+	}
+	for i, hop := range b.RedirectChain {
+		n := hop.HopNumber
+		if n == 0 {
+			n = i + 1
+		}
+		desc := fmt.Sprintf("Redirect hop %d", n)
+		add(models.Indicator{Type: models.IOCTypeURL, Value: hop.URL, Source: "redirect", Description: desc})
+		addHost(hop.URL, "redirect", desc)
+		add(models.Indicator{Type: models.IOCTypeIP, Value: hop.IPAddress, Source: "redirect", Description: desc + " served from this address"})
+	}
+	if d := b.DNSInfo; d != nil {
+		for _, ip := range append(append([]string(nil), d.ARecords...), d.AAAARecords...) {
+			add(models.Indicator{Type: models.IOCTypeIP, Value: ip, Source: "dns", Description: "Address the target resolved to"})
+		}
+	}
+	if g := b.GeoAnalysis; g != nil {
+		add(models.Indicator{Type: models.IOCTypeIP, Value: g.IP, Source: "geoip", Country: g.Country, ISP: g.ISP, Description: "Address the target is hosted at"})
+	}
+	return out
+}
+
+// detectable reports which of a report's indicators are worth detecting on:
+// the intelligence and sandbox IOCs, and the target once it is rated MEDIUM or
+// worse. The rest only describe what the analysis saw.
+func detectable(r *models.AdvancedReport) func(models.Indicator) bool {
+	iocs := make(map[string]bool)
+	for _, ind := range collectIOCs(r) {
+		iocs[string(ind.Type)+"|"+ind.Value] = true
+	}
+	suspicious := false
+	if r.RiskAssessment != nil {
+		switch strings.ToUpper(r.RiskAssessment.OverallRiskLevel) {
+		case "MEDIUM", "HIGH", "CRITICAL":
+			suspicious = true
+		}
+	}
+	return func(ind models.Indicator) bool {
+		if iocs[string(ind.Type)+"|"+ind.Value] {
+			return true
+		}
+		return suspicious && ind.Type == models.IOCTypeURL && ind.Value == r.Target
+	}
+}
+
+// urlHost returns the host of rawURL, which may lack a scheme.
+func urlHost(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// SARIF 2.1.0 output lets CI systems that already understand static analysis
+// results flag risky URLs, including URLs found in the files of a repository.
+// Only the parts of the format Net-Zilla fills are modeled.
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	// sarifFingerprint keys the partial fingerprint code scanning uses to
+	// follow a result across runs.
+	sarifFingerprint = "netzillaTarget/v1"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	DefaultConfig    sarifConfig  `json:"defaultConfiguration"`
+}
+
+type sarifConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	RuleIndex           int                    `json:"ruleIndex"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations,omitempty"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints,omitempty"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// SARIFLocation is where a scanned URL was found: a path relative to the
+// repository root and a 1-based line and column, either of which may be 0 when
+// unknown.
+type SARIFLocation struct {
+	Path   string
+	Line   int
+	Column int
+}
+
+// sarifRules maps overall risk levels to the rule a result is reported under.
+var sarifRules = []struct {
+	riskLevel string
+	rule      sarifRule
+}{
+	{"CRITICAL", sarifRule{ID: "NZ-CRITICAL", ShortDescription: sarifMessage{"URL rated critical risk"}, DefaultConfig: sarifConfig{"error"}}},
+	{"HIGH", sarifRule{ID: "NZ-HIGH", ShortDescription: sarifMessage{"URL rated high risk"}, DefaultConfig: sarifConfig{"error"}}},
+	{"MEDIUM", sarifRule{ID: "NZ-MEDIUM", ShortDescription: sarifMessage{"URL rated medium risk"}, DefaultConfig: sarifConfig{"warning"}}},
+	{"LOW", sarifRule{ID: "NZ-LOW", ShortDescription: sarifMessage{"URL rated low risk"}, DefaultConfig: sarifConfig{"note"}}},
+	{"ERROR", sarifRule{ID: "NZ-ERROR", ShortDescription: sarifMessage{"URL could not be analyzed"}, DefaultConfig: sarifConfig{"warning"}}},
+}
+
+// FormatSARIF writes one SARIF result per report, at a level that follows the
+// report's overall risk.
+func (ef *ExportFormatter) FormatSARIF(reports []*models.AdvancedReport) ([]byte, error) {
+	return ef.FormatSARIFWithLocations(reports, nil)
+}
+
+// FormatSARIFWithLocations is FormatSARIF for URLs found in files:
+// locations[i], when set, is where the target of reports[i] appears.
+func (ef *ExportFormatter) FormatSARIFWithLocations(reports []*models.AdvancedReport, locations []SARIFLocation) ([]byte, error) {
+	if locations != nil && len(locations) != len(reports) {
+		return nil, fmt.Errorf("got %d locations for %d reports", len(locations), len(reports))
+	}
+
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "Net-Zilla"}},
+		Results: []sarifResult{},
+	}
+	for _, r := range sarifRules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, r.rule)
+	}
+
+	for i, report := range reports {
+		level, score := "ERROR", 0.0
+		if report.RiskAssessment != nil {
+			level, score = strings.ToUpper(report.RiskAssessment.OverallRiskLevel), report.RiskAssessment.RiskScore
+		}
+		index := len(sarifRules) - 1
+		for j, r := range sarifRules {
+			if r.riskLevel == level {
+				index = j
+			}
+		}
+		rule := sarifRules[index].rule
+
+		text := fmt.Sprintf("%s rated %s (score %.2f)", report.Target, level, score)
+		if len(report.Findings) > 0 {
+			text += ": " + strings.Join(report.Findings, "; ")
+		}
+		sum := sha256.Sum256([]byte(report.Target))
+		result := sarifResult{
+			RuleID:              rule.ID,
+			RuleIndex:           index,
+			Level:               rule.DefaultConfig.Level,
+			Message:             sarifMessage{Text: text},
+			PartialFingerprints: map[string]string{sarifFingerprint: hex.EncodeToString(sum[:8])},
+			Properties: map[string]interface{}{
+				"target":     report.Target,
+				"report_id":  report.ReportID,
+				"risk_score": score,
+			},
+		}
+		if locations != nil && locations[i].Path != "" {
+			result.Locations = []sarifLocation{newSARIFLocation(locations[i])}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	return json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}}, "", "  ")
+}
+
+func newSARIFLocation(loc SARIFLocation) sarifLocation {
+	// Artifact URIs are relative references with forward slashes
+	uri := path.Clean(strings.ReplaceAll(loc.Path, "\\", "/"))
+	pl := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: (&url.URL{Path: uri}).EscapedPath()}}
+	if loc.Line > 0 {
+		pl.Region = &sarifRegion{StartLine: loc.Line, StartColumn: max(loc.Column, 0)}
 	}
-	return header + row
+	return sarifLocation{PhysicalLocation: pl}
 }
@@ -0,0 +1,428 @@
+package visualization
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+
+	"net-zilla/internal/models"
+)
+
+func TestExportFormatter_FormatSARIF(t *testing.T) {
+	ef := NewExportFormatter()
+	reports := []*models.AdvancedReport{
+		{ReportID: "r1", Target: "http://phish.example", RiskAssessment: &models.RiskAssessment{OverallRiskLevel: "HIGH", RiskScore: 0.7}, Findings: []string{"Credential form"}},
+		{ReportID: "r2", Target: "http://ok.example", RiskAssessment: &models.RiskAssessment{OverallRiskLevel: "LOW", RiskScore: 0.1}},
+		{ReportID: "r3", Target: "http://broken.example"},
+	}
+
+	data, err := ef.FormatSARIF(reports)
+	if err != nil {
+		t.Fatalf("FormatSARIF: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected envelope: version %q, %d runs", log.Version, len(log.Runs))
+	}
+
+	rules := make(map[string]bool)
+	for _, r := range log.Runs[0].Tool.Driver.Rules {
+		rules[r.ID] = true
+	}
+	want := []struct{ rule, level string }{{"NZ-HIGH", "error"}, {"NZ-LOW", "note"}, {"NZ-ERROR", "warning"}}
+	results := log.Runs[0].Results
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		if results[i].RuleID != w.rule || results[i].Level != w.level {
+			t.Errorf("result %d = %s/%s, want %s/%s", i, results[i].RuleID, results[i].Level, w.rule, w.level)
+		}
+		if !rules[results[i].RuleID] {
+			t.Errorf("result %d references undeclared rule %s", i, results[i].RuleID)
+		}
+	}
+	if results[0].Properties["target"] != "http://phish.example" {
+		t.Errorf("target property = %v", results[0].Properties["target"])
+	}
+	validateSchema(t, "sarif-2.1.0.json", data)
+}
+
+// validateSchema checks data against a schema in testdata/schemas. The
+// schemas follow the published STIX, MISP and SARIF definitions for the parts
+// Net-Zilla writes.
+func validateSchema(t *testing.T, schema string, data []byte) {
+	t.Helper()
+	if err := checkSchema(schema, data); err != nil {
+		t.Fatalf("output does not match %s: %v\n%s", schema, err, data)
+	}
+}
+
+func checkSchema(schema string, data []byte) error {
+	c := jsonschema.NewCompiler()
+	c.AssertFormat()
+	sch, err := c.Compile(filepath.Join("testdata", "schemas", schema))
+	if err != nil {
+		return fmt.Errorf("compile: %w", err)
+	}
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return sch.Validate(inst)
+}
+
+// roundTrip decodes data into v and checks that encoding v again reproduces
+// data, so the export types lose nothing.
+func roundTrip(t *testing.T, data []byte, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	again, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Errorf("round trip changed the document:\n%s\nwant\n%s", again, data)
+	}
+}
+
+// exportReport is richReport with everything the exporters map: DNS answers,
+// a downloaded file, a phishing pattern and a value that needs escaping.
+func exportReport() *models.AdvancedReport {
+	r := richReport()
+	r.BasicAnalysis.DNSInfo = &models.DNSAnalysis{ARecords: []string{"198.51.100.4"}, AAAARecords: []string{"2001:db8::1"}}
+	r.Target = "http://short.example/it's"
+	r.BehavioralAnalysis = &models.BehaviorAnalysis{Patterns: []models.BehavioralPattern{{Type: models.PatternPhishing, Name: "Credential form"}}}
+	r.Sandbox.IOCs.Indicators = append(r.Sandbox.IOCs.Indicators, models.Indicator{
+		Type: models.IOCTypeHash, Value: strings.Repeat("ab", 32), Severity: "high", Source: "sandbox",
+		Confidence: 0.9, Tags: []string{"sandbox", "download"}, FirstSeen: r.Timestamp,
+	})
+	return r
+}
+
+func TestReportIndicators(t *testing.T) {
+	r := exportReport()
+	got := make(map[string]string)
+	for _, ind := range reportIndicators(r) {
+		key := string(ind.Type) + "|" + ind.Value
+		if _, dup := got[key]; dup {
+			t.Errorf("%s listed twice", key)
+		}
+		got[key] = ind.Source
+	}
+
+	want := map[string]string{
+		"DOMAIN|login-bank.example":           "feed-a", // Intelligence wins over what the analysis saw
+		"IP|203.0.113.9":                      "feed-b",
+		"URL|https://login-bank.example/post": "sandbox",
+		"HASH|" + strings.Repeat("ab", 32):    "sandbox",
+		"URL|http://short.example/it's":       "target",
+		"DOMAIN|short.example":                "target",
+		"URL|https://track.example/c":         "redirect",
+		"DOMAIN|track.example":                "redirect",
+		"IP|198.51.100.4":                     "dns",
+		"IP|2001:db8::1":                      "dns",
+	}
+	for key, source := range want {
+		if got[key] != source {
+			t.Errorf("%s: source %q, want %q", key, got[key], source)
+		}
+	}
+}
+
+func TestExportFormatter_FormatCSV(t *testing.T) {
+	r := exportReport()
+	rows, err := csv.NewReader(strings.NewReader(NewExportFormatter().FormatCSV(r))).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v", err)
+	}
+	if strings.Join(rows[0], ",") != strings.Join(csvColumns, ",") {
+		t.Fatalf("header = %v", rows[0])
+	}
+
+	want := reportIndicators(r)
+	if len(rows)-1 != len(want) {
+		t.Fatalf("got %d rows, want one per indicator (%d)", len(rows)-1, len(want))
+	}
+	for i, row := range rows[1:] {
+		record := make(map[string]string)
+		for j, col := range rows[0] {
+			record[col] = row[j]
+		}
+		data, _ := json.Marshal(record)
+		validateSchema(t, "indicators-csv.json", data)
+
+		// Round trip: the row reads back as the indicator it was written from
+		confidence, _ := strconv.ParseFloat(record["confidence"], 64)
+		back := models.Indicator{
+			Type: models.IOCType(record["type"]), Value: record["value"], Source: record["source"],
+			Severity: record["severity"], Description: record["description"], Confidence: confidence,
+		}
+		if record["tags"] != "" {
+			back.Tags = strings.Split(record["tags"], ";")
+		}
+		w := want[i]
+		if back.Type != w.Type || back.Value != w.Value || back.Source != w.Source || back.Severity != w.Severity ||
+			back.Description != w.Description || fmt.Sprintf("%.2f", back.Confidence) != fmt.Sprintf("%.2f", w.Confidence) ||
+			strings.Join(back.Tags, ";") != strings.Join(w.Tags, ";") {
+			t.Errorf("row %d = %+v, want %+v", i+1, back, w)
+		}
+		if record["report_id"] != "NZ-42" || record["target"] != r.Target {
+			t.Errorf("row %d belongs to %s/%s", i+1, record["report_id"], record["target"])
+		}
+	}
+}
+
+func TestExportFormatter_FormatSTIX(t *testing.T) {
+	ef := NewExportFormatter()
+	r := exportReport()
+	data, err := ef.FormatSTIX([]*models.AdvancedReport{r})
+	if err != nil {
+		t.Fatalf("FormatSTIX: %v", err)
+	}
+	validateSchema(t, "stix-2.1-bundle.json", data)
+	var bundle stixBundle
+	roundTrip(t, data, &bundle)
+
+	byID := make(map[string]*stixObject)
+	var patterns []string
+	for _, obj := range bundle.Objects {
+		if byID[obj.ID] != nil {
+			t.Errorf("duplicate object %s", obj.ID)
+		}
+		byID[obj.ID] = obj
+		if obj.Type == "indicator" {
+			patterns = append(patterns, obj.Pattern)
+		}
+	}
+	typeOf := func(id string) string { return strings.SplitN(id, "--", 2)[0] }
+
+	// Every reference resolves, and relationships connect the types STIX
+	// defines them for
+	for _, obj := range bundle.Objects {
+		refs := append([]string{obj.CreatedByRef, obj.SourceRef, obj.TargetRef}, obj.ObjectRefs...)
+		for _, ref := range refs {
+			if ref != "" && byID[ref] == nil {
+				t.Errorf("%s refers to %s, which is not in the bundle", obj.ID, ref)
+			}
+		}
+		if obj.Type != "relationship" {
+			continue
+		}
+		src, dst := typeOf(obj.SourceRef), typeOf(obj.TargetRef)
+		var ok bool
+		switch obj.RelationshipType {
+		case "consists-of":
+			ok = src == "infrastructure" && dst != "indicator"
+		case "indicates":
+			ok = src == "indicator" && dst == "infrastructure"
+		case "resolves-to":
+			ok = src == "domain-name" && (dst == "ipv4-addr" || dst == "ipv6-addr")
+		}
+		if !ok {
+			t.Errorf("relationship %s %s %s is not defined", src, obj.RelationshipType, dst)
+		}
+	}
+
+	sort.Strings(patterns)
+	wantPatterns := []string{
+		"[domain-name:value = 'login-bank.example']",
+		"[file:hashes.'SHA-256' = '" + strings.Repeat("ab", 32) + "']",
+		"[ipv4-addr:value = '203.0.113.9']",
+		"[url:value = 'http://short.example/it\\'s']", // The HIGH target is an indicator too
+		"[url:value = 'https://login-bank.example/post']",
+	}
+	if strings.Join(patterns, "\n") != strings.Join(wantPatterns, "\n") {
+		t.Errorf("indicator patterns:\n%s\nwant\n%s", strings.Join(patterns, "\n"), strings.Join(wantPatterns, "\n"))
+	}
+
+	var infra *stixObject
+	for _, obj := range bundle.Objects {
+		if obj.Type == "infrastructure" {
+			infra = obj
+		}
+	}
+	if infra == nil || infra.InfrastructureTypes[0] != "phishing" {
+		t.Errorf("infrastructure = %+v, want a phishing infrastructure", infra)
+	}
+
+	again, _ := ef.FormatSTIX([]*models.AdvancedReport{r})
+	if !bytes.Equal(again, data) {
+		t.Error("exporting the same report twice gave different bundles")
+	}
+}
+
+func TestExportFormatter_FormatSTIX_SharedObservables(t *testing.T) {
+	a, b := exportReport(), exportReport()
+	b.ReportID = "NZ-43"
+	b.RiskAssessment.OverallRiskLevel = "LOW"
+
+	data, err := NewExportFormatter().FormatSTIX([]*models.AdvancedReport{a, b})
+	if err != nil {
+		t.Fatalf("FormatSTIX: %v", err)
+	}
+	validateSchema(t, "stix-2.1-bundle.json", data)
+	var bundle stixBundle
+	roundTrip(t, data, &bundle)
+
+	counts := make(map[string]int)
+	for _, obj := range bundle.Objects {
+		counts[obj.Type]++
+	}
+	if counts["report"] != 2 || counts["infrastructure"] != 2 || counts["identity"] != 1 {
+		t.Errorf("object counts = %v", counts)
+	}
+	if counts["ipv4-addr"] != 2 { // 203.0.113.9 and 198.51.100.4, once each
+		t.Errorf("%d ipv4-addr objects, want 2", counts["ipv4-addr"])
+	}
+}
+
+func TestExportFormatter_FormatMISP(t *testing.T) {
+	r := exportReport()
+	data, err := NewExportFormatter().FormatMISP(r)
+	if err != nil {
+		t.Fatalf("FormatMISP: %v", err)
+	}
+	validateSchema(t, "misp-event.json", data)
+	var event mispEventWrapper
+	roundTrip(t, data, &event)
+
+	if event.Event.ThreatLevelID != "1" || event.Event.Date != "2026-10-01" {
+		t.Errorf("threat level %s, date %s", event.Event.ThreatLevelID, event.Event.Date)
+	}
+	attrs := make(map[string]mispAttribute)
+	for _, a := range event.Event.Attribute {
+		attrs[a.Type+"|"+a.Value] = a
+	}
+	tests := []struct {
+		key   string
+		toIDS bool
+	}{
+		{"domain|login-bank.example", true},
+		{"ip-dst|203.0.113.9", true},
+		{"sha256|" + strings.Repeat("ab", 32), true},
+		{"url|http://short.example/it's", true},
+		{"url|https://track.example/c", false}, // Seen while following redirects, not known bad
+		{"ip-dst|198.51.100.4", false},
+		{"text|Login form posts to a different domain", false},
+	}
+	for _, tt := range tests {
+		a, ok := attrs[tt.key]
+		if !ok {
+			t.Errorf("no attribute %s", tt.key)
+			continue
+		}
+		if a.ToIDS != tt.toIDS {
+			t.Errorf("%s: to_ids = %v, want %v", tt.key, a.ToIDS, tt.toIDS)
+		}
+	}
+}
+
+func TestExportFormatter_FormatMISP_ThreatLevel(t *testing.T) {
+	tests := []struct {
+		level string
+		want  string
+	}{
+		{"CRITICAL", "1"},
+		{"high", "1"},
+		{"MEDIUM", "2"},
+		{"LOW", "3"},
+		{"", "4"},
+	}
+	for _, tt := range tests {
+		r := &models.AdvancedReport{ReportID: "r1", Target: "http://example.com"}
+		if tt.level != "" {
+			r.RiskAssessment = &models.RiskAssessment{OverallRiskLevel: tt.level}
+		}
+		data, err := NewExportFormatter().FormatMISP(r)
+		if err != nil {
+			t.Fatalf("FormatMISP: %v", err)
+		}
+		validateSchema(t, "misp-event.json", data)
+		var event mispEventWrapper
+		json.Unmarshal(data, &event)
+		if event.Event.ThreatLevelID != tt.want {
+			t.Errorf("%q: threat level %s, want %s", tt.level, event.Event.ThreatLevelID, tt.want)
+		}
+	}
+}
+
+func TestExportFormatter_FormatSARIFWithLocations(t *testing.T) {
+	ef := NewExportFormatter()
+	reports := []*models.AdvancedReport{
+		{ReportID: "r1", Target: "http://phish.example", RiskAssessment: &models.RiskAssessment{OverallRiskLevel: "HIGH", RiskScore: 0.7}},
+		{ReportID: "r2", Target: "http://ok.example", RiskAssessment: &models.RiskAssessment{OverallRiskLevel: "LOW", RiskScore: 0.1}},
+	}
+	locations := []SARIFLocation{{Path: "./docs/links.md", Line: 12, Column: 5}, {}}
+
+	data, err := ef.FormatSARIFWithLocations(reports, locations)
+	if err != nil {
+		t.Fatalf("FormatSARIFWithLocations: %v", err)
+	}
+	validateSchema(t, "sarif-2.1.0.json", data)
+	var log sarifLog
+	roundTrip(t, data, &log)
+
+	results := log.Runs[0].Results
+	if len(results[0].Locations) != 1 {
+		t.Fatalf("first result has %d locations", len(results[0].Locations))
+	}
+	pl := results[0].Locations[0].PhysicalLocation
+	if pl.ArtifactLocation.URI != "docs/links.md" || pl.Region == nil || pl.Region.StartLine != 12 || pl.Region.StartColumn != 5 {
+		t.Errorf("location = %+v %+v", pl.ArtifactLocation, pl.Region)
+	}
+	if results[1].Locations != nil {
+		t.Error("a result without a location got one")
+	}
+	for _, res := range results {
+		if rule := log.Runs[0].Tool.Driver.Rules[res.RuleIndex]; rule.ID != res.RuleID {
+			t.Errorf("ruleIndex %d points at %s, want %s", res.RuleIndex, rule.ID, res.RuleID)
+		}
+		if res.PartialFingerprints[sarifFingerprint] == "" {
+			t.Errorf("%s has no fingerprint", res.Properties["target"])
+		}
+	}
+	if results[0].PartialFingerprints[sarifFingerprint] == results[1].PartialFingerprints[sarifFingerprint] {
+		t.Error("different targets share a fingerprint")
+	}
+
+	if _, err := ef.FormatSARIFWithLocations(reports, locations[:1]); err == nil {
+		t.Error("expected an error for fewer locations than reports")
+	}
+}
+
+func TestExportSchemas_RejectInvalid(t *testing.T) {
+	// The schemas must catch what a consumer would reject
+	tests := []struct {
+		schema string
+		doc    string
+	}{
+		{"stix-2.1-bundle.json", `{"type":"bundle","id":"bundle--6ba7b810-9dad-51d1-80b4-00c04fd430c8","objects":[
+			{"type":"indicator","spec_version":"2.1","id":"indicator--6ba7b810-9dad-51d1-80b4-00c04fd430c8",
+			 "created":"2026-10-01T12:00:00.000Z","modified":"2026-10-01T12:00:00.000Z","pattern_type":"stix","valid_from":"2026-10-01T12:00:00Z"}]}`},
+		{"stix-2.1-bundle.json", `{"type":"bundle","id":"bundle--6ba7b810-9dad-51d1-80b4-00c04fd430c8","objects":[
+			{"type":"ipv4-addr","spec_version":"2.1","id":"ipv4-addr--6ba7b810-9dad-51d1-80b4-00c04fd430c8","value":"not-an-ip"}]}`},
+		{"misp-event.json", `{"Event":{"uuid":"6ba7b810-9dad-51d1-80b4-00c04fd430c8","info":"x","date":"2026-10-01","threat_level_id":"1",
+			"analysis":"2","distribution":"0","timestamp":"1","Attribute":[{"uuid":"6ba7b810-9dad-51d1-80b4-00c04fd430c8","type":"sha256","category":"Network activity","value":"abc","to_ids":true}]}}`},
+		{"sarif-2.1.0.json", `{"version":"2.1.0","runs":[{"tool":{"driver":{"name":"x"}},"results":[{"message":{"text":"x"},"level":"fatal"}]}]}`},
+		{"indicators-csv.json", `{"report_id":"","target":"x","type":"EMAIL","value":"a@b","source":"","severity":"","confidence":"0.10","first_seen":"","last_seen":"","description":"","tags":"","references":""}`},
+	}
+	for _, tt := range tests {
+		if err := checkSchema(tt.schema, []byte(tt.doc)); err == nil {
+			t.Errorf("%s accepted %s", tt.schema, tt.doc)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package visualization
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"net-zilla/internal/models"
+)
+
+// MISP event JSON, as accepted by the events/add API and the event import.
+// MISP encodes its enumerations and timestamps as strings.
+type mispEventWrapper struct {
+	Event mispEvent `json:"Event"`
+}
+
+type mispEvent struct {
+	UUID          string          `json:"uuid"`
+	Info          string          `json:"info"`
+	Date          string          `json:"date"`
+	ThreatLevelID string          `json:"threat_level_id"`
+	Analysis      string          `json:"analysis"`
+	Distribution  string          `json:"distribution"`
+	Published     bool            `json:"published"`
+	Timestamp     string          `json:"timestamp"`
+	Tag           []mispTag       `json:"Tag"`
+	Attribute     []mispAttribute `json:"Attribute"`
+}
+
+type mispAttribute struct {
+	UUID         string    `json:"uuid"`
+	Type         string    `json:"type"`
+	Category     string    `json:"category"`
+	Value        string    `json:"value"`
+	ToIDS        bool      `json:"to_ids"`
+	Comment      string    `json:"comment,omitempty"`
+	Distribution string    `json:"distribution"`
+	Timestamp    string    `json:"timestamp"`
+	Tag          []mispTag `json:"Tag,omitempty"`
+}
+
+type mispTag struct {
+	Name string `json:"name"`
+}
+
+// MISP enumerations Net-Zilla uses.
+const (
+	mispAnalysisCompleted   = "2"
+	mispDistributionOrg     = "0" // Your organisation only; sharing is left to the analyst
+	mispDistributionInherit = "5" // Attributes follow the event
+	mispThreatLevelUnknown  = "4"
+)
+
+// mispThreatLevels maps overall risk levels to MISP threat levels.
+var mispThreatLevels = map[string]string{
+	"CRITICAL": "1",
+	"HIGH":     "1",
+	"MEDIUM":   "2",
+	"LOW":      "3",
+}
+
+// mispType returns the MISP attribute type and category of an indicator, or
+// empty strings when MISP has no type for it.
+func mispType(ind models.Indicator) (typ, category string) {
+	switch ind.Type {
+	case models.IOCTypeURL:
+		return "url", "Network activity"
+	case models.IOCTypeDomain:
+		return "domain", "Network activity"
+	case models.IOCTypeIP:
+		return "ip-dst", "Network activity"
+	case models.IOCTypeHash:
+		if algorithm := hashAlgorithm(ind.Value); algorithm != "" {
+			return strings.ToLower(strings.ReplaceAll(algorithm, "-", "")), "Payload delivery"
+		}
+	}
+	return "", ""
+}
+
+// FormatMISP writes the report as one MISP event. Every indicator becomes an
+// attribute, flagged for IDS export when it is worth detecting on, and the
+// findings are added as text attributes.
+func (ef *ExportFormatter) FormatMISP(report *models.AdvancedReport) ([]byte, error) {
+	at := reportTime(report)
+	timestamp := fmt.Sprint(at.Unix())
+	level := "UNKNOWN"
+	if report.RiskAssessment != nil {
+		level = strings.ToUpper(report.RiskAssessment.OverallRiskLevel)
+	}
+	threatLevel, ok := mispThreatLevels[level]
+	if !ok {
+		threatLevel = mispThreatLevelUnknown
+	}
+
+	event := mispEvent{
+		UUID:          uuid5(stixNamespace, "misp|"+report.ReportID+"|"+report.Target),
+		Info:          "Net-Zilla analysis of " + report.Target,
+		Date:          at.UTC().Format("2006-01-02"),
+		ThreatLevelID: threatLevel,
+		Analysis:      mispAnalysisCompleted,
+		Distribution:  mispDistributionOrg,
+		Timestamp:     timestamp,
+		Tag: []mispTag{
+			{Name: "tlp:amber"},
+			{Name: fmt.Sprintf("net-zilla:verdict=%q", strings.ToLower(level))},
+		},
+		Attribute: []mispAttribute{},
+	}
+	attribute := func(typ, category, value string) mispAttribute {
+		return mispAttribute{
+			UUID: uuid5(stixNamespace, "misp|"+event.UUID+"|"+typ+"|"+value),
+			Type: typ, Category: category, Value: value,
+			Distribution: mispDistributionInherit, Timestamp: timestamp,
+		}
+	}
+
+	detect := detectable(report)
+	for _, ind := range reportIndicators(report) {
+		typ, category := mispType(ind)
+		if typ == "" {
+			continue
+		}
+		a := attribute(typ, category, ind.Value)
+		a.ToIDS = detect(ind)
+		a.Comment = ind.Description
+		if ind.Source != "" {
+			a.Comment = strings.TrimSpace(fmt.Sprintf("%s (source: %s)", ind.Description, ind.Source))
+		}
+		for _, tag := range ind.Tags {
+			a.Tag = append(a.Tag, mispTag{Name: tag})
+		}
+		event.Attribute = append(event.Attribute, a)
+	}
+	for _, finding := range report.Findings {
+		a := attribute("text", "Other", finding)
+		a.Comment = "Net-Zilla finding"
+		event.Attribute = append(event.Attribute, a)
+	}
+
+	return json.MarshalIndent(mispEventWrapper{Event: event}, "", "  ")
+}
@@ -0,0 +1,344 @@
+package visualization
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+// STIX 2.1 output describes each report as an infrastructure object that
+// consists of the observed URLs, domains, addresses and files, with an
+// indicator for every IOC that indicates it and a report object that refers
+// to all of them.
+const (
+	stixSpecVersion = "2.1"
+	stixTimeFormat  = "2006-01-02T15:04:05.000Z" // Timestamps are UTC, to the millisecond
+)
+
+// stixNamespace is the UUIDv5 namespace the specification fixes for the IDs of
+// cyber observables. Net-Zilla derives every other ID from it as well, so
+// exporting the same analysis twice yields the same objects.
+var stixNamespace = [16]byte{0x00, 0xab, 0xed, 0xb4, 0xaa, 0x42, 0x46, 0x6c, 0x9c, 0x01, 0xfe, 0xd2, 0x33, 0x15, 0xa9, 0xb7}
+
+type stixBundle struct {
+	Type    string        `json:"type"`
+	ID      string        `json:"id"`
+	Objects []*stixObject `json:"objects"`
+}
+
+// stixObject holds the properties of every object type Net-Zilla writes;
+// each type fills its own.
+type stixObject struct {
+	Type         string `json:"type"`
+	SpecVersion  string `json:"spec_version"`
+	ID           string `json:"id"`
+	Created      string `json:"created,omitempty"`
+	Modified     string `json:"modified,omitempty"`
+	CreatedByRef string `json:"created_by_ref,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Confidence   *int   `json:"confidence,omitempty"`
+
+	// identity
+	IdentityClass string `json:"identity_class,omitempty"`
+
+	// indicator
+	IndicatorTypes     []string                `json:"indicator_types,omitempty"`
+	Pattern            string                  `json:"pattern,omitempty"`
+	PatternType        string                  `json:"pattern_type,omitempty"`
+	ValidFrom          string                  `json:"valid_from,omitempty"`
+	Labels             []string                `json:"labels,omitempty"`
+	ExternalReferences []stixExternalReference `json:"external_references,omitempty"`
+
+	// infrastructure
+	InfrastructureTypes []string `json:"infrastructure_types,omitempty"`
+	FirstSeen           string   `json:"first_seen,omitempty"`
+	LastSeen            string   `json:"last_seen,omitempty"`
+
+	// relationship
+	RelationshipType string `json:"relationship_type,omitempty"`
+	SourceRef        string `json:"source_ref,omitempty"`
+	TargetRef        string `json:"target_ref,omitempty"`
+
+	// report
+	ReportTypes []string `json:"report_types,omitempty"`
+	Published   string   `json:"published,omitempty"`
+	ObjectRefs  []string `json:"object_refs,omitempty"`
+
+	// url, domain-name, ipv4-addr and ipv6-addr
+	Value string `json:"value,omitempty"`
+	// file
+	Hashes map[string]string `json:"hashes,omitempty"`
+}
+
+type stixExternalReference struct {
+	SourceName string `json:"source_name"`
+	URL        string `json:"url,omitempty"`
+}
+
+// stixObservable is the cyber observable an indicator stands for and the
+// pattern that matches it.
+type stixObservable struct {
+	object  *stixObject
+	pattern string
+}
+
+// newSTIXObservable returns nil for values STIX cannot express, such as a hash
+// of unknown length.
+func newSTIXObservable(ind models.Indicator) *stixObservable {
+	var typ, prop string
+	switch ind.Type {
+	case models.IOCTypeURL:
+		typ, prop = "url", "value"
+	case models.IOCTypeDomain:
+		typ, prop = "domain-name", "value"
+	case models.IOCTypeIP:
+		ip := net.ParseIP(ind.Value)
+		if ip == nil {
+			return nil
+		}
+		typ, prop = "ipv4-addr", "value"
+		if ip.To4() == nil {
+			typ = "ipv6-addr"
+		}
+	case models.IOCTypeHash:
+		algorithm := hashAlgorithm(ind.Value)
+		if algorithm == "" {
+			return nil
+		}
+		value := strings.ToLower(ind.Value)
+		obj := &stixObject{Type: "file", SpecVersion: stixSpecVersion, Hashes: map[string]string{algorithm: value}}
+		obj.ID = stixObservableID(obj.Type, map[string]interface{}{"hashes": obj.Hashes})
+		return &stixObservable{object: obj, pattern: fmt.Sprintf("[file:hashes.'%s' = '%s']", algorithm, value)}
+	default:
+		return nil
+	}
+	if ind.Value == "" {
+		return nil
+	}
+	obj := &stixObject{Type: typ, SpecVersion: stixSpecVersion, Value: ind.Value}
+	obj.ID = stixObservableID(typ, map[string]interface{}{prop: ind.Value})
+	return &stixObservable{object: obj, pattern: fmt.Sprintf("[%s:%s = '%s']", typ, prop, stixEscape(ind.Value))}
+}
+
+// hashAlgorithm names a hex digest by its length, as the STIX hash vocabulary
+// spells it.
+func hashAlgorithm(digest string) string {
+	for _, r := range digest {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return ""
+		}
+	}
+	switch len(digest) {
+	case 32:
+		return "MD5"
+	case 40:
+		return "SHA-1"
+	case 64:
+		return "SHA-256"
+	case 128:
+		return "SHA-512"
+	}
+	return ""
+}
+
+// stixEscape escapes a string literal of a STIX pattern.
+func stixEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+// stixObservableID derives an observable's ID from its ID contributing
+// properties, as the specification requires for deterministic identifiers.
+func stixObservableID(typ string, contributing map[string]interface{}) string {
+	data, _ := json.Marshal(contributing) // Maps marshal with sorted keys
+	return typ + "--" + uuid5(stixNamespace, string(data))
+}
+
+func stixID(typ, name string) string {
+	return typ + "--" + uuid5(stixNamespace, typ+"|"+name)
+}
+
+// uuid5 returns the name-based (SHA-1) UUID of name in namespace.
+func uuid5(namespace [16]byte, name string) string {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+func stixTime(t time.Time) string {
+	return t.UTC().Format(stixTimeFormat)
+}
+
+// stixIdentityID names Net-Zilla, the producer every object is created by.
+var stixIdentityID = stixID("identity", "Net-Zilla")
+
+// FormatSTIX writes the reports as one STIX 2.1 bundle. Observables shared by
+// several reports appear once.
+func (ef *ExportFormatter) FormatSTIX(reports []*models.AdvancedReport) ([]byte, error) {
+	b := &stixBuilder{seen: make(map[string]bool)}
+	ids := make([]string, 0, len(reports))
+	earliest := time.Now()
+	for _, r := range reports {
+		if t := reportTime(r); t.Before(earliest) {
+			earliest = t
+		}
+		ids = append(ids, r.ReportID+"|"+r.Target)
+	}
+	b.add(&stixObject{
+		Type: "identity", SpecVersion: stixSpecVersion, ID: stixIdentityID,
+		Created: stixTime(earliest), Modified: stixTime(earliest),
+		Name: "Net-Zilla", IdentityClass: "system",
+	})
+	for _, r := range reports {
+		b.addReport(r)
+	}
+
+	bundle := stixBundle{Type: "bundle", ID: "bundle--" + uuid5(stixNamespace, strings.Join(ids, "\n")), Objects: b.objects}
+	return json.MarshalIndent(bundle, "", "  ")
+}
+
+type stixBuilder struct {
+	objects []*stixObject
+	seen    map[string]bool
+}
+
+// add appends obj unless an object with its ID is already in the bundle.
+func (b *stixBuilder) add(obj *stixObject) {
+	if b.seen[obj.ID] {
+		return
+	}
+	b.seen[obj.ID] = true
+	b.objects = append(b.objects, obj)
+}
+
+func (b *stixBuilder) addReport(r *models.AdvancedReport) {
+	at := stixTime(reportTime(r))
+	sdo := func(typ, key string) *stixObject {
+		return &stixObject{
+			Type: typ, SpecVersion: stixSpecVersion, ID: stixID(typ, r.ReportID+"|"+r.Target+"|"+key),
+			Created: at, Modified: at, CreatedByRef: stixIdentityID,
+		}
+	}
+	var refs []string
+	emit := func(obj *stixObject) {
+		b.add(obj)
+		refs = append(refs, obj.ID)
+	}
+	relate := func(source, typ, target string) {
+		rel := sdo("relationship", source+"|"+typ+"|"+target)
+		rel.RelationshipType, rel.SourceRef, rel.TargetRef = typ, source, target
+		emit(rel)
+	}
+
+	infra := sdo("infrastructure", "")
+	infra.Name = r.Target
+	infra.InfrastructureTypes = []string{infrastructureType(r)}
+	infra.FirstSeen, infra.LastSeen = at, at
+	if ra := r.RiskAssessment; ra != nil {
+		infra.Description = strings.TrimSpace(fmt.Sprintf("Rated %s (score %.2f). %s", strings.ToUpper(ra.OverallRiskLevel), ra.RiskScore, ra.Summary))
+	}
+	emit(infra)
+
+	detect := detectable(r)
+	observables := make(map[string]string) // Indicator value to observable ID
+	for _, ind := range reportIndicators(r) {
+		obs := newSTIXObservable(ind)
+		if obs == nil {
+			continue
+		}
+		emit(obs.object)
+		observables[ind.Value] = obs.object.ID
+		relate(infra.ID, "consists-of", obs.object.ID)
+
+		// Everything else the analysis saw is only part of the infrastructure
+		if !detect(ind) {
+			continue
+		}
+		indicator := sdo("indicator", string(ind.Type)+"|"+ind.Value)
+		indicator.Name = ind.Value
+		indicator.Description = ind.Description
+		indicator.IndicatorTypes = []string{"anomalous-activity"}
+		switch strings.ToLower(ind.Severity) {
+		case "high", "critical":
+			indicator.IndicatorTypes = []string{"malicious-activity"}
+		}
+		indicator.Pattern, indicator.PatternType = obs.pattern, "stix"
+		indicator.ValidFrom = at
+		if !ind.FirstSeen.IsZero() {
+			indicator.ValidFrom = stixTime(ind.FirstSeen)
+		}
+		if ind.Confidence > 0 {
+			confidence := int(math.Round(min(ind.Confidence, 1) * 100))
+			indicator.Confidence = &confidence
+		}
+		indicator.Labels = ind.Tags
+		if ind.Source != "" && ind.Source != "target" {
+			indicator.ExternalReferences = append(indicator.ExternalReferences, stixExternalReference{SourceName: ind.Source})
+		}
+		for _, ref := range ind.References {
+			indicator.ExternalReferences = append(indicator.ExternalReferences, stixExternalReference{SourceName: "reference", URL: ref})
+		}
+		emit(indicator)
+		relate(indicator.ID, "indicates", infra.ID)
+	}
+
+	// The target's host resolves to the addresses DNS returned
+	if host, dns := urlHost(r.Target), dnsInfo(r); host != "" && dns != nil {
+		if domain, ok := observables[host]; ok && strings.HasPrefix(domain, "domain-name--") {
+			for _, ip := range append(append([]string(nil), dns.ARecords...), dns.AAAARecords...) {
+				if addr, ok := observables[ip]; ok {
+					relate(domain, "resolves-to", addr)
+				}
+			}
+		}
+	}
+
+	report := sdo("report", "")
+	report.Name = "Net-Zilla analysis of " + r.Target
+	report.Description = strings.Join(r.Findings, "\n")
+	report.ReportTypes = []string{"threat-report"}
+	report.Published = at
+	report.ObjectRefs = refs
+	b.add(report)
+}
+
+// infrastructureType picks the infrastructure type the behavioral patterns
+// point to.
+func infrastructureType(r *models.AdvancedReport) string {
+	if r.BehavioralAnalysis != nil {
+		for _, p := range r.BehavioralAnalysis.Patterns {
+			switch p.Type {
+			case models.PatternPhishing:
+				return "phishing"
+			case models.PatternMalware:
+				return "hosting-malware"
+			}
+		}
+	}
+	return "unknown"
+}
+
+func dnsInfo(r *models.AdvancedReport) *models.DNSAnalysis {
+	if r.BasicAnalysis == nil {
+		return nil
+	}
+	return r.BasicAnalysis.DNSInfo
+}
+
+// reportTime is when a report was made, or now for reports without a timestamp.
+func reportTime(r *models.AdvancedReport) time.Time {
+	if r.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return r.Timestamp
+}
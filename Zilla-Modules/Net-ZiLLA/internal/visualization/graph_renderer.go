@@ -1,8 +1,13 @@
 package visualization
 
 import (
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"strings"
+	"time"
+
+	"net-zilla/internal/correlation"
 )
 
 // GraphRenderer handles visualization of network relationships.
@@ -33,3 +38,192 @@ func (gr *GraphRenderer) RenderASCIIChain(target string, hops []string) string {
 
 	return sb.String()
 }
+
+// Graph export formats.
+const (
+	GraphFormatJSON      = "json"
+	GraphFormatGraphML   = "graphml"
+	GraphFormatCytoscape = "cytoscape"
+	GraphFormatDOT       = "dot"
+)
+
+// GraphFormats lists the formats RenderGraph accepts.
+var GraphFormats = []string{GraphFormatJSON, GraphFormatGraphML, GraphFormatCytoscape, GraphFormatDOT}
+
+// RenderGraph renders an infrastructure graph in one of the GraphFormat
+// constants.
+func (gr *GraphRenderer) RenderGraph(g *correlation.RelationshipGraph, format string) ([]byte, error) {
+	switch format {
+	case GraphFormatJSON:
+		return json.MarshalIndent(g, "", "  ")
+	case GraphFormatGraphML:
+		return gr.RenderGraphML(g)
+	case GraphFormatCytoscape:
+		return gr.RenderCytoscape(g)
+	case GraphFormatDOT:
+		return []byte(gr.RenderDOT(g)), nil
+	}
+	return nil, fmt.Errorf("unsupported graph format %q (want one of %s)", format, strings.Join(GraphFormats, ", "))
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	Name     string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLItem `xml:"node"`
+	Edges       []graphMLItem `xml:"edge"`
+}
+
+type graphMLItem struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr,omitempty"`
+	Target string        `xml:"target,attr,omitempty"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphMLKeys declares the attributes every node and edge carries.
+var graphMLKeys = []graphMLKey{
+	{ID: "type", For: "node", Name: "type", AttrType: "string"},
+	{ID: "value", For: "node", Name: "value", AttrType: "string"},
+	{ID: "analyses", For: "all", Name: "analyses", AttrType: "string"},
+	{ID: "analysis_count", For: "all", Name: "analysis_count", AttrType: "int"},
+	{ID: "first_seen", For: "all", Name: "first_seen", AttrType: "string"},
+	{ID: "last_seen", For: "all", Name: "last_seen", AttrType: "string"},
+	{ID: "rel", For: "edge", Name: "rel", AttrType: "string"},
+}
+
+// RenderGraphML renders the graph as GraphML for Gephi, yEd and similar
+// tools. Analyses are listed space-separated.
+func (gr *GraphRenderer) RenderGraphML(g *correlation.RelationshipGraph) ([]byte, error) {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys:  graphMLKeys,
+		Graph: graphMLGraph{ID: "infrastructure", EdgeDefault: "directed"},
+	}
+	seen := func(analyses []string, first, last time.Time) []graphMLData {
+		data := []graphMLData{
+			{Key: "analyses", Value: strings.Join(analyses, " ")},
+			{Key: "analysis_count", Value: fmt.Sprint(len(analyses))},
+		}
+		if !first.IsZero() {
+			data = append(data,
+				graphMLData{Key: "first_seen", Value: first.UTC().Format(time.RFC3339)},
+				graphMLData{Key: "last_seen", Value: last.UTC().Format(time.RFC3339)})
+		}
+		return data
+	}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLItem{
+			ID:   n.ID,
+			Data: append([]graphMLData{{Key: "type", Value: n.Type}, {Key: "value", Value: n.Value}}, seen(n.Analyses, n.FirstSeen, n.LastSeen)...),
+		})
+	}
+	for i, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLItem{
+			ID: fmt.Sprintf("e%d", i), Source: e.From, Target: e.To,
+			Data: append([]graphMLData{{Key: "rel", Value: e.Rel}}, seen(e.Analyses, e.FirstSeen, e.LastSeen)...),
+		})
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// cytoscapeElement is a node or edge in Cytoscape.js JSON.
+type cytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// RenderCytoscape renders the graph as Cytoscape.js elements JSON, which
+// Cytoscape desktop also imports.
+func (gr *GraphRenderer) RenderCytoscape(g *correlation.RelationshipGraph) ([]byte, error) {
+	var doc struct {
+		Elements struct {
+			Nodes []cytoscapeElement `json:"nodes"`
+			Edges []cytoscapeElement `json:"edges"`
+		} `json:"elements"`
+	}
+	doc.Elements.Nodes = []cytoscapeElement{}
+	doc.Elements.Edges = []cytoscapeElement{}
+	for _, n := range g.Nodes {
+		data := map[string]interface{}{"id": n.ID, "label": n.Value, "type": n.Type}
+		cytoscapeSeen(data, n.Analyses, n.FirstSeen, n.LastSeen)
+		doc.Elements.Nodes = append(doc.Elements.Nodes, cytoscapeElement{Data: data})
+	}
+	for i, e := range g.Edges {
+		data := map[string]interface{}{"id": fmt.Sprintf("e%d", i), "source": e.From, "target": e.To, "label": e.Rel}
+		cytoscapeSeen(data, e.Analyses, e.FirstSeen, e.LastSeen)
+		doc.Elements.Edges = append(doc.Elements.Edges, cytoscapeElement{Data: data})
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func cytoscapeSeen(data map[string]interface{}, analyses []string, first, last time.Time) {
+	data["analyses"] = append([]string{}, analyses...)
+	if !first.IsZero() {
+		data["first_seen"] = first.UTC().Format(time.RFC3339)
+		data["last_seen"] = last.UTC().Format(time.RFC3339)
+	}
+}
+
+// dotShapes gives each node type its own shape in Graphviz output.
+var dotShapes = map[string]string{
+	correlation.NodeURL:         "note",
+	correlation.NodeDomain:      "ellipse",
+	correlation.NodeIP:          "box",
+	correlation.NodeASN:         "box3d",
+	correlation.NodeNameServer:  "diamond",
+	correlation.NodeCertificate: "component",
+	correlation.NodeRegistrar:   "house",
+}
+
+// RenderDOT renders the graph in Graphviz DOT. Nodes seen by more than one
+// analysis are drawn bold.
+func (gr *GraphRenderer) RenderDOT(g *correlation.RelationshipGraph) string {
+	var sb strings.Builder
+	sb.WriteString("digraph infrastructure {\n  rankdir=LR;\n  node [fontname=\"Helvetica\"];\n")
+	for _, n := range g.Nodes {
+		shape := dotShapes[n.Type]
+		if shape == "" {
+			shape = "ellipse"
+		}
+		style := ""
+		if len(n.Analyses) > 1 {
+			style = ", style=bold"
+		}
+		fmt.Fprintf(&sb, "  %s [label=%s, shape=%s%s];\n", dotQuote(n.ID), dotQuote(n.Type+"\n"+n.Value), shape, style)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "  %s -> %s [label=%s];\n", dotQuote(e.From), dotQuote(e.To), dotQuote(e.Rel))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// dotQuote returns s as a DOT quoted string. Newlines become centered line
+// breaks.
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
@@ -1,8 +1,13 @@
 package visualization
 
 import (
+	"encoding/json"
+	"encoding/xml"
 	"strings"
 	"testing"
+	"time"
+
+	"net-zilla/internal/correlation"
 )
 
 func TestGraphRenderer_RenderASCIIChain(t *testing.T) {
@@ -21,3 +26,74 @@ func TestGraphRenderer_RenderASCIIChain(t *testing.T) {
 		t.Error("rendered chain missing key elements")
 	}
 }
+
+func testGraph() *correlation.RelationshipGraph {
+	g := correlation.NewRelationshipGraph()
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	g.AddEdge(correlation.NodeDomain, `evil"quoted.example`, correlation.RelResolvesTo, correlation.NodeIP, "203.0.113.7", "NZ-1", at)
+	g.AddEdge(correlation.NodeDomain, "other.example", correlation.RelResolvesTo, correlation.NodeIP, "203.0.113.7", "NZ-2", at.Add(time.Hour))
+	return g
+}
+
+func TestGraphRenderer_RenderGraph(t *testing.T) {
+	gr := NewGraphRenderer()
+	g := testGraph()
+
+	out, err := gr.RenderGraph(g, GraphFormatGraphML)
+	if err != nil {
+		t.Fatalf("graphml: %v", err)
+	}
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID string `xml:"id,attr"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("graphml does not parse: %v", err)
+	}
+	if len(doc.Graph.Nodes) != 3 || len(doc.Graph.Edges) != 2 || doc.Graph.Edges[1].Target != "IP:203.0.113.7" {
+		t.Errorf("graphml = %s", out)
+	}
+
+	out, err = gr.RenderGraph(g, GraphFormatCytoscape)
+	if err != nil {
+		t.Fatalf("cytoscape: %v", err)
+	}
+	var cy struct {
+		Elements struct {
+			Nodes []struct{ Data map[string]interface{} } `json:"nodes"`
+			Edges []struct{ Data map[string]interface{} } `json:"edges"`
+		} `json:"elements"`
+	}
+	if err := json.Unmarshal(out, &cy); err != nil {
+		t.Fatalf("cytoscape does not parse: %v", err)
+	}
+	if len(cy.Elements.Nodes) != 3 || cy.Elements.Edges[0].Data["source"] != `DOMAIN:evil"quoted.example` ||
+		cy.Elements.Nodes[1].Data["first_seen"] != "2025-03-01T12:00:00Z" {
+		t.Errorf("cytoscape = %s", out)
+	}
+
+	out, err = gr.RenderGraph(g, GraphFormatDOT)
+	if err != nil {
+		t.Fatalf("dot: %v", err)
+	}
+	dot := string(out)
+	for _, want := range []string{
+		`"DOMAIN:evil\"quoted.example" -> "IP:203.0.113.7" [label="RESOLVES_TO"];`,
+		`"IP:203.0.113.7" [label="IP\n203.0.113.7", shape=box, style=bold];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("dot output missing %s:\n%s", want, dot)
+		}
+	}
+
+	if _, err := gr.RenderGraph(g, "svg"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
@@ -1,11 +1,30 @@
 package visualization
 
 import (
+	"encoding/json"
 	"fmt"
 	"net-zilla/internal/models"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
+// Report formats understood by Generate, as named in output.report_format.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatHTML = "html"
+	FormatPDF  = "pdf"
+)
+
+// formatExtensions maps each report format to its file extension.
+var formatExtensions = map[string]string{
+	FormatText: "txt",
+	FormatJSON: "json",
+	FormatHTML: "html",
+	FormatPDF:  "pdf",
+}
+
 // ReportGenerator creates human-readable security reports.
 type ReportGenerator struct{}
 
@@ -13,6 +32,43 @@ func NewReportGenerator() *ReportGenerator {
 	return &ReportGenerator{}
 }
 
+// Generate renders report in one of the Format constants.
+func (rg *ReportGenerator) Generate(report *models.AdvancedReport, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case FormatText:
+		return []byte(rg.GenerateTextReport(report)), nil
+	case FormatJSON:
+		return json.MarshalIndent(report, "", "  ")
+	case FormatHTML:
+		return rg.GenerateHTMLReport(report)
+	case FormatPDF:
+		return rg.GeneratePDFReport(report)
+	default:
+		return nil, fmt.Errorf("unsupported report format %q (want text, json, html or pdf)", format)
+	}
+}
+
+// SaveReport writes report to dir as <report ID>.<extension> and returns the
+// path written.
+func (rg *ReportGenerator) SaveReport(report *models.AdvancedReport, dir, format string) (string, error) {
+	data, err := rg.Generate(report, format)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+	name := filepath.Base(report.ReportID)
+	if report.ReportID == "" {
+		name = "report"
+	}
+	path := filepath.Join(dir, name+"."+formatExtensions[strings.ToLower(format)])
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	return path, nil
+}
+
 // GenerateTextReport produces a professional ASCII-formatted report.
 func (rg *ReportGenerator) GenerateTextReport(report *models.AdvancedReport) string {
 	var sb strings.Builder
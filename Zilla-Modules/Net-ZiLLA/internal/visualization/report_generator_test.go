@@ -1,6 +1,11 @@
 package visualization
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -61,4 +66,175 @@ func TestReportGenerator_GenerateTextReport_Minimal(t *testing.T) {
 	if !strings.Contains(got, "MIN-1") {
 		t.Error("report ID missing")
 	}
-}
\ No newline at end of file
+}
+func richReport() *models.AdvancedReport {
+	return &models.AdvancedReport{
+		ReportID:  "NZ-42",
+		Target:    "http://short.example/<script>alert(1)</script>",
+		Timestamp: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		RiskAssessment: &models.RiskAssessment{
+			OverallRiskLevel: "HIGH",
+			RiskScore:        0.74,
+			Summary:          "Redirects to a credential form",
+			Metrics: []models.RiskMetric{
+				{Vector: "screening", Value: 4, Impact: "44 points from URL and host screening"},
+				{Vector: "threat_intel", Value: 3, Impact: "30 points: flagged by 2 intelligence source(s)"},
+			},
+		},
+		Findings: []string{"Login form posts to a different domain"},
+		BasicAnalysis: &models.ThreatAnalysis{
+			RedirectChain: []models.RedirectDetail{
+				{HopNumber: 1, URL: "http://short.example/x", StatusCode: 301, Mechanism: models.RedirectHTTP},
+				{HopNumber: 2, URL: "https://track.example/c", StatusCode: 200, Mechanism: models.RedirectMetaRefresh, Warnings: []string{"meta refresh"}},
+				{HopNumber: 3, URL: "https://login-bank.example/", StatusCode: 200, IPAddress: "203.0.113.9"},
+			},
+			WhoisInfo: &models.WhoisAnalysis{Registrar: "Example Registrar", DomainAge: "3 days"},
+		},
+		ThreatIntelligence: &models.IOCRegistry{
+			TotalFound: 2,
+			Indicators: []models.Indicator{
+				{Type: models.IOCTypeDomain, Value: "login-bank.example", Severity: "HIGH", Source: "feed-a", Confidence: 0.9},
+				{Type: models.IOCTypeIP, Value: "203.0.113.9", Severity: "MEDIUM", Source: "feed-b", Confidence: 0.6},
+			},
+		},
+		Sandbox: &models.SandboxResult{IOCs: &models.IOCRegistry{Indicators: []models.Indicator{
+			{Type: models.IOCTypeIP, Value: "203.0.113.9", Severity: "MEDIUM", Source: "sandbox"},
+			{Type: models.IOCTypeURL, Value: "https://login-bank.example/post", Severity: "HIGH", Source: "sandbox"},
+		}}},
+	}
+}
+
+func TestReportGenerator_Generate(t *testing.T) {
+	rg := NewReportGenerator()
+	report := richReport()
+
+	tests := []struct {
+		format string
+		check  func(t *testing.T, data []byte)
+	}{
+		{FormatText, func(t *testing.T, data []byte) {
+			if !strings.Contains(string(data), "NZ-42") {
+				t.Error("report ID missing")
+			}
+		}},
+		{FormatJSON, func(t *testing.T, data []byte) {
+			var got models.AdvancedReport
+			if err := json.Unmarshal(data, &got); err != nil || got.ReportID != "NZ-42" {
+				t.Errorf("JSON does not round-trip: %v", err)
+			}
+		}},
+		{FormatHTML, func(t *testing.T, data []byte) {
+			html := string(data)
+			for _, want := range []string{
+				"<!DOCTYPE html>", "<style>", "NZ-42", "Redirects to a credential form",
+				"threat_intel", "width: 40%", // Score breakdown bar of the screening metric
+				"login-bank.example", "Example Registrar",
+				"&lt;script&gt;alert(1)&lt;/script&gt;",
+			} {
+				if !strings.Contains(html, want) {
+					t.Errorf("HTML does not contain %q", want)
+				}
+			}
+			// Self-contained: nothing is loaded from elsewhere
+			for _, bad := range []string{"<script", "<link", " src=", "@import"} {
+				if strings.Contains(html, bad) {
+					t.Errorf("HTML contains %q", bad)
+				}
+			}
+		}},
+		{FormatPDF, func(t *testing.T, data []byte) {
+			if !bytes.HasPrefix(data, []byte("%PDF-")) || !bytes.Contains(data[len(data)-16:], []byte("%%EOF")) {
+				t.Errorf("not a complete PDF: %q...", data[:min(len(data), 16)])
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := rg.Generate(report, tt.format)
+			if err != nil {
+				t.Fatalf("Generate(%s): %v", tt.format, err)
+			}
+			tt.check(t, data)
+		})
+	}
+
+	if _, err := rg.Generate(report, "docx"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestNewReportView(t *testing.T) {
+	v := newReportView(richReport())
+
+	if v.Score != 74 || v.LevelClass != "high" {
+		t.Errorf("score %d, class %s", v.Score, v.LevelClass)
+	}
+	if len(v.Metrics) != 2 || v.Metrics[0].Percent != 40 {
+		t.Errorf("metrics = %+v", v.Metrics)
+	}
+
+	// The sandbox repeats one intelligence indicator and adds one of its own
+	if len(v.IOCs) != 3 {
+		t.Errorf("got %d IOCs, want 3: %+v", len(v.IOCs), v.IOCs)
+	}
+
+	d := v.Diagram
+	if len(d.Nodes) != 3 || len(d.Arrows) != 2 {
+		t.Fatalf("diagram has %d nodes and %d arrows", len(d.Nodes), len(d.Arrows))
+	}
+	if d.Arrows[0].Label != "http" || d.Arrows[1].Label != "meta-refresh" {
+		t.Errorf("arrow labels %q, %q", d.Arrows[0].Label, d.Arrows[1].Label)
+	}
+	if !d.Nodes[1].Warn || d.Nodes[0].Warn {
+		t.Error("only the hop with warnings should be highlighted")
+	}
+	if last := d.Nodes[2]; last.Y+last.H > d.Height {
+		t.Errorf("last node ends at %d, below the diagram height %d", last.Y+last.H, d.Height)
+	}
+}
+
+func TestNewReportView_Minimal(t *testing.T) {
+	v := newReportView(&models.AdvancedReport{ReportID: "MIN-1", Target: "http://example.com"})
+
+	if v.Level != "UNKNOWN" || v.LevelClass != "unknown" {
+		t.Errorf("level %s, class %s", v.Level, v.LevelClass)
+	}
+	if len(v.Diagram.Nodes) != 1 || v.Diagram.Note == "" {
+		t.Errorf("a report without redirects should show the target alone with a note: %+v", v.Diagram)
+	}
+}
+
+func TestReportGenerator_PDFPaginates(t *testing.T) {
+	report := richReport()
+	for i := 0; i < 150; i++ {
+		report.ThreatIntelligence.Indicators = append(report.ThreatIntelligence.Indicators,
+			models.Indicator{Type: models.IOCTypeIP, Value: fmt.Sprintf("198.51.100.%d", i), Source: "feed-a"})
+	}
+
+	data, err := NewReportGenerator().GeneratePDFReport(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages := bytes.Count(data, []byte("/Type /Page\n")); pages < 3 {
+		t.Errorf("150 indicators fit on %d pages", pages)
+	}
+}
+
+func TestReportGenerator_SaveReport(t *testing.T) {
+	rg := NewReportGenerator()
+	dir := filepath.Join(t.TempDir(), "reports")
+
+	for format, ext := range formatExtensions {
+		path, err := rg.SaveReport(richReport(), dir, format)
+		if err != nil {
+			t.Fatalf("SaveReport(%s): %v", format, err)
+		}
+		if want := filepath.Join(dir, "NZ-42."+ext); path != want {
+			t.Errorf("path = %s, want %s", path, want)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("%s not written: %v", path, err)
+		}
+	}
+}
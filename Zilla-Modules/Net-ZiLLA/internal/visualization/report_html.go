@@ -0,0 +1,246 @@
+package visualization
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+
+	"net-zilla/internal/models"
+)
+
+//go:embed templates/report.html
+var reportTemplateSource string
+
+// reportTemplate renders a self-contained HTML page: styles are inline and the
+// redirect diagram is SVG, so the file can be mailed or archived on its own.
+var reportTemplate = template.Must(template.New("report").Parse(reportTemplateSource))
+
+// reportView is what the HTML and PDF reports show, derived once from a report.
+type reportView struct {
+	Report         *models.AdvancedReport
+	Level          string
+	LevelClass     string // critical, high, medium, low or unknown
+	Score          int    // 0-100
+	Summary        string
+	Metrics        []metricView
+	Findings       []string
+	Diagram        redirectDiagram
+	Infrastructure []keyValue
+	Patterns       []models.BehavioralPattern
+	IOCs           []models.Indicator
+	Generated      time.Time
+}
+
+type metricView struct {
+	Name    string
+	Value   int // 0-10
+	Percent int
+	Impact  string
+}
+
+type keyValue struct {
+	Key, Value string
+}
+
+func newReportView(r *models.AdvancedReport) *reportView {
+	v := &reportView{
+		Report:     r,
+		Level:      "UNKNOWN",
+		LevelClass: "unknown",
+		Findings:   r.Findings,
+		Diagram:    newRedirectDiagram(r),
+		IOCs:       collectIOCs(r),
+		Generated:  time.Now(),
+	}
+	if ra := r.RiskAssessment; ra != nil {
+		v.Level = strings.ToUpper(ra.OverallRiskLevel)
+		v.Score = int(math.Round(ra.RiskScore * 100))
+		v.Summary = ra.Summary
+		for _, m := range ra.Metrics {
+			value := min(max(m.Value, 0), 10)
+			v.Metrics = append(v.Metrics, metricView{Name: m.Vector, Value: value, Percent: value * 10, Impact: m.Impact})
+		}
+	}
+	switch v.Level {
+	case "CRITICAL", "HIGH", "MEDIUM", "LOW":
+		v.LevelClass = strings.ToLower(v.Level)
+	}
+	if r.BehavioralAnalysis != nil {
+		v.Patterns = r.BehavioralAnalysis.Patterns
+	}
+	v.Infrastructure = infrastructure(r)
+	return v
+}
+
+// collectIOCs merges the indicators from threat intelligence and the sandbox,
+// keeping the first of each type and value.
+func collectIOCs(r *models.AdvancedReport) []models.Indicator {
+	var sources [][]models.Indicator
+	if r.ThreatIntelligence != nil {
+		sources = append(sources, r.ThreatIntelligence.Indicators)
+	}
+	if r.Sandbox != nil && r.Sandbox.IOCs != nil {
+		sources = append(sources, r.Sandbox.IOCs.Indicators)
+	}
+	seen := make(map[string]bool)
+	var out []models.Indicator
+	for _, list := range sources {
+		for _, ind := range list {
+			key := string(ind.Type) + "|" + ind.Value
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, ind)
+		}
+	}
+	return out
+}
+
+// infrastructure lists the hosting, DNS, WHOIS and TLS facts a report carries.
+func infrastructure(r *models.AdvancedReport) []keyValue {
+	var kv []keyValue
+	add := func(k, v string) {
+		if v != "" {
+			kv = append(kv, keyValue{k, v})
+		}
+	}
+	b := r.BasicAnalysis
+	if b == nil {
+		return nil
+	}
+	if g := b.GeoAnalysis; g != nil {
+		add("IP address", g.IP)
+		add("Location", strings.Trim(g.City+", "+g.Country, ", "))
+		add("ASN / ISP", strings.TrimSpace(g.ASN+" "+g.ISP))
+		add("Hosting", g.HostingType)
+	}
+	if d := b.DNSInfo; d != nil {
+		add("A records", strings.Join(d.ARecords, ", "))
+		add("Name servers", strings.Join(d.NameServers, ", "))
+		add("MX records", strings.Join(d.MXRecords, ", "))
+	}
+	if w := b.WhoisInfo; w != nil {
+		add("Registrar", w.Registrar)
+		add("Registered", w.CreatedDate)
+		add("Domain age", w.DomainAge)
+	}
+	if t := b.TLSInfo; t != nil {
+		add("TLS issuer", t.Issuer)
+		validity := "invalid"
+		if t.CertificateValid {
+			validity = fmt.Sprintf("valid, expires in %d days", t.ExpiresInDays)
+		}
+		add("TLS certificate", validity)
+	}
+	return kv
+}
+
+// Layout of the redirect diagram, in SVG user units.
+const (
+	diagramWidth  = 720
+	diagramNodeW  = 560
+	diagramNodeH  = 44
+	diagramGap    = 34
+	diagramMargin = 8
+	diagramURLLen = 72
+)
+
+// redirectDiagram places one box per hop of the redirect chain, top to bottom,
+// with an arrow labeled by how each hop redirected.
+type redirectDiagram struct {
+	Width, Height int
+	LabelX        int
+	Nodes         []diagramNode
+	Arrows        []diagramArrow
+	Note          string
+}
+
+type diagramNode struct {
+	X, Y, W, H     int
+	TextX          int
+	Line1Y, Line2Y int
+	Caption        string
+	URL            string
+	Warn           bool
+}
+
+type diagramArrow struct {
+	X, Y1, Y2 int
+	LabelY    int
+	Label     string
+}
+
+type diagramHop struct {
+	caption, url, via string
+	warn              bool
+}
+
+func newRedirectDiagram(r *models.AdvancedReport) redirectDiagram {
+	var hops []diagramHop
+	var note string
+	switch {
+	case r.BasicAnalysis != nil && len(r.BasicAnalysis.RedirectChain) > 0:
+		for i, h := range r.BasicAnalysis.RedirectChain {
+			n := h.HopNumber
+			if n == 0 {
+				n = i + 1
+			}
+			caption := fmt.Sprintf("hop %d", n)
+			if h.StatusCode != 0 {
+				caption += fmt.Sprintf(" · HTTP %d", h.StatusCode)
+			}
+			if h.IPAddress != "" {
+				caption += " · " + h.IPAddress
+			}
+			hops = append(hops, diagramHop{caption: caption, url: h.URL, via: string(h.Mechanism), warn: len(h.Warnings) > 0})
+		}
+	case r.Sandbox != nil && r.Sandbox.FinalURL != "" && r.Sandbox.FinalURL != r.Target:
+		hops = []diagramHop{
+			{caption: "requested", url: r.Target, via: "browser navigation"},
+			{caption: "landed on (sandbox)", url: r.Sandbox.FinalURL},
+		}
+	default:
+		hops = []diagramHop{{caption: "requested", url: r.Target}}
+		note = "No redirects were recorded for this analysis."
+	}
+
+	d := redirectDiagram{Width: diagramWidth, LabelX: diagramMargin + diagramNodeW/2 + 12, Note: note}
+	x := diagramMargin
+	for i, h := range hops {
+		y := diagramMargin + i*(diagramNodeH+diagramGap)
+		d.Nodes = append(d.Nodes, diagramNode{
+			X: x, Y: y, W: diagramNodeW, H: diagramNodeH,
+			TextX: x + 12, Line1Y: y + 16, Line2Y: y + 34,
+			Caption: h.caption, URL: truncate(h.url, diagramURLLen), Warn: h.warn,
+		})
+		if i < len(hops)-1 {
+			y1 := y + diagramNodeH
+			d.Arrows = append(d.Arrows, diagramArrow{X: x + diagramNodeW/2, Y1: y1 + 2, Y2: y1 + diagramGap - 2, LabelY: y1 + diagramGap/2 + 4, Label: h.via})
+		}
+	}
+	d.Height = 2*diagramMargin + len(hops)*diagramNodeH + (len(hops)-1)*diagramGap
+	return d
+}
+
+// truncate shortens s to n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// GenerateHTMLReport renders report as a self-contained HTML page.
+func (rg *ReportGenerator) GenerateHTMLReport(report *models.AdvancedReport) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, newReportView(report)); err != nil {
+		return nil, fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
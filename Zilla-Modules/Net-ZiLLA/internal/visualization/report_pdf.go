@@ -0,0 +1,298 @@
+package visualization
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-pdf/fpdf"
+
+	"net-zilla/internal/models"
+)
+
+// PDF layout, in millimetres on A4.
+const (
+	pdfMargin    = 14.0
+	pdfLineH     = 5.5
+	pdfNodeH     = 11.0
+	pdfArrowH    = 8.0
+	pdfBarWidth  = 60.0
+	pdfBarHeight = 3.5
+)
+
+// rgb is a PDF fill, draw or text colour.
+type rgb struct{ r, g, b int }
+
+var (
+	pdfInk   = rgb{31, 35, 40}
+	pdfMuted = rgb{101, 109, 118}
+	pdfLine  = rgb{208, 215, 222}
+	pdfPanel = rgb{246, 248, 250}
+	pdfWarn  = rgb{232, 89, 12}
+	pdfBrand = rgb{253, 126, 20}
+
+	pdfLevelColors = map[string]rgb{
+		"critical": {179, 38, 30},
+		"high":     {232, 89, 12},
+		"medium":   {240, 162, 2},
+		"low":      {43, 138, 62},
+		"unknown":  {108, 117, 125},
+	}
+)
+
+// pdfReport writes one report with the core Helvetica font. Text is
+// translated to cp1252; characters it lacks are dropped by fpdf.
+type pdfReport struct {
+	pdf   *fpdf.Fpdf
+	tr    func(string) string
+	width float64 // Printable width
+}
+
+func (p *pdfReport) fill(c rgb)  { p.pdf.SetFillColor(c.r, c.g, c.b) }
+func (p *pdfReport) draw(c rgb)  { p.pdf.SetDrawColor(c.r, c.g, c.b) }
+func (p *pdfReport) color(c rgb) { p.pdf.SetTextColor(c.r, c.g, c.b) }
+
+// ensure starts a new page unless h millimetres still fit on this one.
+func (p *pdfReport) ensure(h float64) {
+	_, pageH := p.pdf.GetPageSize()
+	if p.pdf.GetY()+h > pageH-pdfMargin-8 {
+		p.pdf.AddPage()
+	}
+}
+
+func (p *pdfReport) heading(title string) {
+	p.ensure(16)
+	p.pdf.Ln(4)
+	p.pdf.SetFont("Helvetica", "B", 12)
+	p.color(pdfInk)
+	p.pdf.CellFormat(p.width, 7, p.tr(title), "B", 1, "L", false, 0, "")
+	p.pdf.Ln(2)
+}
+
+func (p *pdfReport) text(s string, style string, size float64, c rgb) {
+	p.pdf.SetFont("Helvetica", style, size)
+	p.color(c)
+	p.pdf.MultiCell(p.width, pdfLineH, p.tr(s), "", "L", false)
+}
+
+// fit shortens s with an ellipsis until it is at most w millimetres wide in
+// the current font.
+func (p *pdfReport) fit(s string, w float64) string {
+	s = p.tr(s)
+	if p.pdf.GetStringWidth(s) <= w {
+		return s
+	}
+	for len(s) > 0 && p.pdf.GetStringWidth(s+"...") > w {
+		s = s[:len(s)-1]
+	}
+	return s + "..."
+}
+
+// GeneratePDFReport renders report as a PDF document.
+func (rg *ReportGenerator) GeneratePDFReport(report *models.AdvancedReport) ([]byte, error) {
+	v := newReportView(report)
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin+8)
+	pdf.SetTitle("Net-Zilla report "+report.ReportID, true)
+	pdf.SetCreator("Net-Zilla", true)
+	pdf.AliasNbPages("")
+	pageW, _ := pdf.GetPageSize()
+	p := &pdfReport{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor(""), width: pageW - 2*pdfMargin}
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin - 2)
+		pdf.SetFont("Helvetica", "", 8)
+		p.color(pdfMuted)
+		pdf.CellFormat(p.width/2, 5, p.tr("Net-Zilla · "+report.ReportID), "", 0, "L", false, 0, "")
+		pdf.CellFormat(p.width/2, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Title bar
+	p.fill(pdfInk)
+	pdf.Rect(0, 0, pageW, 30, "F")
+	pdf.SetXY(pdfMargin, 8)
+	pdf.SetFont("Helvetica", "B", 16)
+	p.color(pdfBrand)
+	pdf.CellFormat(32, 8, "NET-ZILLA", "", 0, "L", false, 0, "")
+	p.color(rgb{255, 255, 255})
+	pdf.CellFormat(0, 8, "SECURITY REPORT", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	p.color(rgb{201, 209, 217})
+	meta := "Report " + report.ReportID
+	if !report.Timestamp.IsZero() {
+		meta += " · analyzed " + report.Timestamp.Format("2006-01-02 15:04:05 MST")
+	}
+	pdf.CellFormat(p.width, 5, p.fit(report.Target, p.width), "", 1, "L", false, 0, "")
+	pdf.CellFormat(p.width, 5, p.tr(meta), "", 1, "L", false, 0, "")
+	pdf.SetY(36)
+
+	// Verdict
+	level := pdfLevelColors[v.LevelClass]
+	p.fill(level)
+	p.color(rgb{255, 255, 255})
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(34, 10, v.Level, "", 0, "C", true, 0, "")
+	p.color(pdfInk)
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(30, 10, fmt.Sprintf("%d", v.Score), "", 0, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	p.color(pdfMuted)
+	pdf.CellFormat(14, 10, " / 100", "", 0, "L", false, 0, "")
+	p.bar(pdf.GetX()+4, pdf.GetY()+3.25, p.width-86, float64(v.Score)/100, level)
+	pdf.Ln(13)
+	if v.Summary != "" {
+		p.text(v.Summary, "", 10, pdfInk)
+	}
+
+	// Score breakdown
+	p.heading("Score breakdown")
+	if len(v.Metrics) == 0 {
+		p.text("No score components were recorded.", "I", 10, pdfMuted)
+	}
+	for _, m := range v.Metrics {
+		p.ensure(pdfLineH + 1)
+		pdf.SetFont("Helvetica", "B", 10)
+		p.color(pdfInk)
+		pdf.CellFormat(32, pdfLineH, p.tr(m.Name), "", 0, "L", false, 0, "")
+		p.bar(pdf.GetX(), pdf.GetY()+1, pdfBarWidth, float64(m.Value)/10, level)
+		pdf.SetX(pdf.GetX() + pdfBarWidth + 4)
+		pdf.SetFont("Helvetica", "", 9)
+		p.color(pdfMuted)
+		pdf.CellFormat(0, pdfLineH, p.fit(m.Impact, p.width-32-pdfBarWidth-4), "", 1, "L", false, 0, "")
+	}
+
+	// Findings
+	if len(v.Findings) > 0 {
+		p.heading(fmt.Sprintf("Findings (%d)", len(v.Findings)))
+		for _, f := range v.Findings {
+			p.text("- "+f, "", 10, pdfInk)
+		}
+	}
+
+	// Redirect chain
+	p.heading("Redirect chain")
+	for i, n := range v.Diagram.Nodes {
+		p.ensure(pdfNodeH + pdfArrowH)
+		x, y := pdfMargin, pdf.GetY()
+		p.fill(pdfPanel)
+		p.draw(pdfLine)
+		if n.Warn {
+			p.fill(rgb{255, 244, 229})
+			p.draw(pdfWarn)
+		}
+		pdf.RoundedRect(x, y, p.width*0.8, pdfNodeH, 1.5, "1234", "FD")
+		pdf.SetXY(x+3, y+1)
+		pdf.SetFont("Helvetica", "", 8)
+		p.color(pdfMuted)
+		pdf.CellFormat(p.width*0.8-6, 4, p.tr(n.Caption), "", 2, "L", false, 0, "")
+		pdf.SetFont("Courier", "", 9)
+		p.color(pdfInk)
+		pdf.CellFormat(p.width*0.8-6, 5, p.fit(n.URL, p.width*0.8-6), "", 1, "L", false, 0, "")
+		pdf.SetY(y + pdfNodeH)
+		if i < len(v.Diagram.Arrows) {
+			a := v.Diagram.Arrows[i]
+			p.arrow(x+p.width*0.4, pdf.GetY(), pdfArrowH)
+			if a.Label != "" {
+				pdf.SetXY(x+p.width*0.4+4, pdf.GetY()+1.5)
+				pdf.SetFont("Helvetica", "I", 8)
+				p.color(pdfMuted)
+				pdf.CellFormat(60, 5, p.tr(a.Label), "", 0, "L", false, 0, "")
+			}
+			pdf.SetY(y + pdfNodeH + pdfArrowH)
+		}
+	}
+	if v.Diagram.Note != "" {
+		pdf.Ln(2)
+		p.text(v.Diagram.Note, "I", 9, pdfMuted)
+	}
+
+	// Infrastructure
+	if len(v.Infrastructure) > 0 {
+		p.heading("Infrastructure")
+		for _, kv := range v.Infrastructure {
+			p.ensure(pdfLineH)
+			pdf.SetFont("Helvetica", "", 9)
+			p.color(pdfMuted)
+			pdf.CellFormat(40, pdfLineH, p.tr(kv.Key), "", 0, "L", false, 0, "")
+			pdf.SetFont("Helvetica", "", 10)
+			p.color(pdfInk)
+			pdf.MultiCell(p.width-40, pdfLineH, p.tr(kv.Value), "", "L", false)
+		}
+	}
+
+	// Behavioral patterns
+	if len(v.Patterns) > 0 {
+		p.heading("Behavioral patterns")
+		for _, pat := range v.Patterns {
+			p.ensure(2 * pdfLineH)
+			p.text(fmt.Sprintf("%s  [%s, weight %d]", pat.Name, pat.Type, pat.Weight), "B", 10, pdfInk)
+			if pat.Description != "" {
+				p.text(pat.Description, "", 9, pdfMuted)
+			}
+		}
+	}
+
+	// Indicators of compromise
+	p.heading("Indicators of compromise")
+	if len(v.IOCs) == 0 {
+		p.text("No indicators were recorded for this target.", "I", 10, pdfMuted)
+	} else {
+		widths := []float64{22, 76, 22, 40, 22}
+		header := func() {
+			pdf.SetFont("Helvetica", "B", 8)
+			p.fill(pdfPanel)
+			p.draw(pdfLine)
+			p.color(pdfMuted)
+			for i, h := range []string{"TYPE", "VALUE", "SEVERITY", "SOURCE", "CONFIDENCE"} {
+				pdf.CellFormat(widths[i], 6, h, "B", 0, "L", true, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+		header()
+		for _, ind := range v.IOCs {
+			if _, pageH := pdf.GetPageSize(); pdf.GetY()+6 > pageH-pdfMargin-8 {
+				pdf.AddPage()
+				header()
+			}
+			pdf.SetFont("Helvetica", "", 9)
+			p.color(pdfInk)
+			cells := []string{string(ind.Type), ind.Value, ind.Severity, ind.Source, fmt.Sprintf("%.2f", ind.Confidence)}
+			for i, c := range cells {
+				if i == 1 {
+					pdf.SetFont("Courier", "", 8)
+				}
+				pdf.CellFormat(widths[i], 6, p.fit(c, widths[i]-2), "B", 0, "L", false, 0, "")
+				pdf.SetFont("Helvetica", "", 9)
+			}
+			pdf.Ln(-1)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to render PDF report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// bar draws a progress bar filled to fraction (0-1).
+func (p *pdfReport) bar(x, y, w, fraction float64, c rgb) {
+	p.fill(rgb{234, 238, 242})
+	p.pdf.Rect(x, y, w, pdfBarHeight, "F")
+	if fraction > 0 {
+		p.fill(c)
+		p.pdf.Rect(x, y, w*min(fraction, 1), pdfBarHeight, "F")
+	}
+}
+
+// arrow draws a downward arrow of height h from (x, y).
+func (p *pdfReport) arrow(x, y, h float64) {
+	p.draw(pdfMuted)
+	p.fill(pdfMuted)
+	p.pdf.SetLineWidth(0.4)
+	p.pdf.Line(x, y+0.5, x, y+h-2)
+	p.pdf.Polygon([]fpdf.PointType{{X: x - 1.5, Y: y + h - 2.5}, {X: x + 1.5, Y: y + h - 2.5}, {X: x, Y: y + h - 0.5}}, "F")
+	p.pdf.SetLineWidth(0.2)
+}
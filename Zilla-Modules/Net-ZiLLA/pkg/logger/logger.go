@@ -3,6 +3,7 @@ package logger
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"sync"
@@ -59,6 +60,13 @@ func (l *Logger) SetJSON(b bool) {
 	l.jsonOutput = b
 }
 
+// SetOutput redirects log lines, e.g. to stderr when stdout carries command output.
+func (l *Logger) SetOutput(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.output.SetOutput(w)
+}
+
 func (l *Logger) SetLevel(level LogLevel) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
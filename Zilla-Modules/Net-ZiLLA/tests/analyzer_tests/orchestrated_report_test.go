@@ -0,0 +1,233 @@
+package analyzer_tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"net-zilla/internal/analyzer"
+	"net-zilla/internal/config"
+	"net-zilla/internal/correlation"
+	"net-zilla/internal/models"
+	"net-zilla/internal/network"
+	"net-zilla/internal/visualization"
+	"net-zilla/pkg/logger"
+)
+
+// The phishing site replayed by orchestratedReport: a week-old domain behind
+// three redirects, with a self-signed certificate and two A records in a VPN
+// range.
+const (
+	phishHost   = "login.cassette.test"
+	phishTarget = "https://" + phishHost + "/"
+)
+
+var phishRecordedAt = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// orchestratedReport runs the full pipeline against the phishing site replayed
+// from a cassette, so every stage sees the data a live run would produce.
+func orchestratedReport(t *testing.T) *models.AdvancedReport {
+	t.Helper()
+	vpnList := filepath.Join(t.TempDir(), "vpn.txt")
+	if err := os.WriteFile(vpnList, []byte("198.51.100.0/24 Example VPN\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{GeoIP: config.GeoIPConfig{VPNCIDRs: vpnList}}
+
+	ao := analyzer.NewAnalysisOrchestrator(logger.NewLogger(), cfg)
+	ao.UseCassette(phishCassette(t))
+	report, err := ao.Orchestrate(context.Background(), phishTarget)
+	if err != nil {
+		t.Fatalf("Orchestrate failed: %v", err)
+	}
+	if report.BasicAnalysis == nil {
+		t.Fatal("expected the infrastructure stage to set BasicAnalysis")
+	}
+	return report
+}
+
+func phishCassette(t *testing.T) *network.Cassette {
+	t.Helper()
+	c := network.NewCassette(network.CassetteReplay)
+	c.SetRecordedAt(phishRecordedAt)
+
+	c.Record("whois", "whois.iana.org "+phishHost, []byte("Domain Name: "+phishHost+"\nRegistrar Name: Example Registrar\n"+
+		"Creation Date: 2024-05-25T00:00:00Z\nName Server: ns1.bulletproof.test\n"), nil)
+	recordDNS(c, phishHost+".", [4]byte{198, 51, 100, 10}, [4]byte{198, 51, 100, 11})
+
+	hops := []string{"", "r/1", "r/2"}
+	for i, path := range hops {
+		next := "/verify"
+		if i+1 < len(hops) {
+			next = "/" + hops[i+1]
+		}
+		c.Record("http", "GET "+phishTarget+path, []byte("HTTP/1.1 302 Found\r\nLocation: "+next+"\r\nContent-Length: 0\r\n\r\n"), nil)
+	}
+	page := "<html><head><title>Verify your account</title></head><body><form action=\"/track/7/confirm.php\">" +
+		"<input name=\"password\" type=\"password\"></form></body></html>"
+	c.Record("http", "GET "+phishTarget+"verify", []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: %d\r\n\r\n%s", len(page), page)), nil)
+
+	// The verifying handshake fails on the self-signed certificate; the
+	// unverified one returns it.
+	handshake := func(verify bool) string {
+		return fmt.Sprintf("%s:443 versions=%#04x-%#04x ciphers=%x verify=%t", phishHost, uint16(0), uint16(0), []uint16(nil), verify)
+	}
+	c.Record("tls", handshake(true), nil, errors.New("tls: failed to verify certificate: x509: certificate signed by unknown authority"))
+	state, err := json.Marshal(map[string]interface{}{"version": 0x0304, "cipher_suite": 0x1301, "certificates": [][]byte{selfSignedCert(t)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Record("tls", handshake(false), state, nil)
+	return c
+}
+
+// selfSignedCert returns the DER of a certificate for phishHost valid at the
+// recording time.
+func selfSignedCert(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: phishHost, Organization: []string{"Account Security"}},
+		DNSNames:     []string{phishHost},
+		NotBefore:    phishRecordedAt.AddDate(0, 0, -7),
+		NotAfter:     phishRecordedAt.AddDate(0, 3, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// recordDNS adds the A answers for name to c, and empty answers for the other
+// record types the DNS client asks for.
+func recordDNS(c *network.Cassette, name string, a ...[4]byte) {
+	q := dnsmessage.MustNewName(name)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA, dnsmessage.TypeCNAME, dnsmessage.TypeMX, dnsmessage.TypeNS, dnsmessage.TypeTXT} {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+		b.StartQuestions()
+		b.Question(dnsmessage.Question{Name: q, Type: qtype, Class: dnsmessage.ClassINET})
+		b.StartAnswers()
+		if qtype == dnsmessage.TypeA {
+			for _, addr := range a {
+				b.AResource(dnsmessage.ResourceHeader{Name: q, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: addr})
+			}
+		}
+		msg, _ := b.Finish()
+		c.Record("dns", name+" "+strings.TrimPrefix(qtype.String(), "Type"), msg, nil)
+	}
+}
+
+func TestDefaultCorrelationRules_OrchestratedReport(t *testing.T) {
+	report := orchestratedReport(t)
+
+	var got []string
+	for _, in := range report.Insights {
+		got = append(got, in.RuleID)
+	}
+	want := []string{"new_domain_invalid_tls", "proxy_redirect_chain", "anonymous_multi_a"}
+	if !reflect.DeepEqual(got, want) {
+		basic := report.BasicAnalysis
+		t.Errorf("insights = %v, want %v\nwhois=%+v\ntls=%+v\ngeo=%+v\ndns=%+v\nredirects=%d",
+			got, want, basic.WhoisInfo, basic.TLSInfo, basic.GeoAnalysis, basic.DNSInfo, basic.RedirectCount)
+	}
+}
+
+func TestExtractCampaignFeatures_OrchestratedReport(t *testing.T) {
+	report := orchestratedReport(t)
+	f := correlation.ExtractCampaignFeatures(report)
+
+	if !reflect.DeepEqual(f.IPs, []string{"198.51.100.10", "198.51.100.11"}) {
+		t.Errorf("IPs = %v", f.IPs)
+	}
+	if !reflect.DeepEqual(f.NameServers, []string{"ns1.bulletproof.test"}) {
+		t.Errorf("name servers = %v", f.NameServers)
+	}
+	if len(f.Certificates) != 1 || f.Certificates[0] != report.BasicAnalysis.TLSInfo.Fingerprint {
+		t.Errorf("certificates = %v", f.Certificates)
+	}
+	if f.PathShape != "/verify" || f.ContentSimhash == "" {
+		t.Errorf("landing page path shape %q, simhash %q", f.PathShape, f.ContentSimhash)
+	}
+	if f.Registrar != "Example Registrar" || !f.DomainCreated.Equal(time.Date(2024, 5, 25, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("registration = %q created %v", f.Registrar, f.DomainCreated)
+	}
+}
+
+func TestGraphBuilder_OrchestratedReport(t *testing.T) {
+	report := orchestratedReport(t)
+	g := correlation.NewGraphBuilder().BuildFromReport(report)
+
+	edges := make(map[string]bool)
+	for _, e := range g.Edges {
+		edges[e.From+" "+e.Rel+" "+e.To] = true
+	}
+	domain := correlation.NodeID(correlation.NodeDomain, phishHost)
+	for _, want := range []string{
+		"URL:" + phishTarget + "r/2 " + correlation.RelRedirectsTo + " URL:" + phishTarget + "verify",
+		domain + " " + correlation.RelResolvesTo + " IP:198.51.100.10",
+		domain + " " + correlation.RelResolvesTo + " IP:198.51.100.11",
+		domain + " " + correlation.RelUsesNameServer + " NAMESERVER:ns1.bulletproof.test",
+		domain + " " + correlation.RelRegisteredWith + " REGISTRAR:Example Registrar",
+		domain + " " + correlation.RelPresentsCertificate + " " + correlation.NodeID(correlation.NodeCertificate, report.BasicAnalysis.TLSInfo.Fingerprint),
+	} {
+		if !edges[want] {
+			t.Errorf("missing edge %s", want)
+		}
+	}
+}
+
+func TestFormatSTIX_OrchestratedReport(t *testing.T) {
+	report := orchestratedReport(t)
+	data, err := visualization.NewExportFormatter().FormatSTIX([]*models.AdvancedReport{report})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle struct {
+		Objects []struct {
+			ID               string `json:"id"`
+			Type             string `json:"type"`
+			Value            string `json:"value"`
+			RelationshipType string `json:"relationship_type"`
+			SourceRef        string `json:"source_ref"`
+			TargetRef        string `json:"target_ref"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]string)
+	for _, obj := range bundle.Objects {
+		values[obj.ID] = obj.Value
+	}
+	var resolves []string
+	for _, obj := range bundle.Objects {
+		if obj.Type == "relationship" && obj.RelationshipType == "resolves-to" {
+			resolves = append(resolves, values[obj.SourceRef]+" -> "+values[obj.TargetRef])
+		}
+	}
+	want := []string{phishHost + " -> 198.51.100.10", phishHost + " -> 198.51.100.11"}
+	if !reflect.DeepEqual(resolves, want) {
+		t.Errorf("resolves-to relationships = %v, want %v", resolves, want)
+	}
+}